@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/SinaHo/email-marketing-backend/internal/config"
+	"github.com/SinaHo/email-marketing-backend/internal/server"
+	"go.uber.org/zap"
+)
+
+// maxBounceSize bounds the bounce messages read; bounces returning large
+// messages are truncated, which the parser tolerates.
+const maxBounceSize = 10 << 20
+
+// runBounce processes the bounce message in r, delivered to rcpt.
+func runBounce(ctx context.Context, cfg *config.Config, logger *zap.Logger, rcpt string, r io.Reader) error {
+	raw, err := io.ReadAll(io.LimitReader(r, maxBounceSize))
+	if err != nil {
+		return fmt.Errorf("read message: %w", err)
+	}
+	db, err := server.OpenPostgres(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	bounces, err := server.NewBounceProcessor(cfg, db).Process(ctx, rcpt, raw)
+	if err != nil {
+		return err
+	}
+	for _, b := range bounces {
+		logger.Sugar().Infof("%s bounce of %s for job %d: %s", b.Kind, b.Email, b.SendJobID, b.Diagnostic)
+	}
+	if len(bounces) == 0 {
+		logger.Sugar().Infof("no new bounces in message to %q", rcpt)
+	}
+	return nil
+}
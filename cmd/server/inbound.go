@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/SinaHo/email-marketing-backend/internal/config"
+	"github.com/SinaHo/email-marketing-backend/internal/inbound"
+	"github.com/SinaHo/email-marketing-backend/internal/server"
+	"go.uber.org/zap"
+)
+
+// runInbound receives bounces, complaints and replies over SMTP until ctx
+// is cancelled.
+func runInbound(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	if cfg.Server.SMTPPort == 0 {
+		return errors.New("server.smtp_port is required to receive mail")
+	}
+	db, err := server.OpenPostgres(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	sugar := logger.Sugar().Named("inbound")
+	srv, err := server.NewInboundServer(cfg, server.NewInboundMail(cfg, db, sugar), sugar)
+	if err != nil {
+		return err
+	}
+	addr := fmt.Sprintf(":%d", cfg.Server.SMTPPort)
+	done := make(chan error, 1)
+	go func() { done <- srv.ListenAndServe(addr) }()
+	sugar.Infof("SMTP server listening on %s", addr)
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	srv.Close()
+	if err := <-done; !errors.Is(err, inbound.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -2,6 +2,8 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"os"
 	"os/signal"
 	"syscall"
@@ -15,6 +17,14 @@ import (
 )
 
 func main() {
+	// -mode selects the processes to run: the API server, the campaign
+	// scheduler, the send worker, the inbound SMTP server, or all of them.
+	// All runs the inbound SMTP server only if server.smtp_port is set. The
+	// bounce mode instead processes one bounce message from stdin, for MTA
+	// pipe transports; its argument is the envelope recipient.
+	mode := flag.String("mode", "all", "server, scheduler, worker, inbound, all or bounce")
+	flag.Parse()
+
 	// Initialize zap logger
 	logger, err := zap.NewProduction()
 	if err != nil {
@@ -22,23 +32,91 @@ func main() {
 	}
 	defer logger.Sync()
 
+	runServer := *mode == "server" || *mode == "all"
+	runSched := *mode == "scheduler" || *mode == "all"
+	runWork := *mode == "worker" || *mode == "all"
+	runInbox := *mode == "inbound" || *mode == "all"
+	if !runServer && !runSched && !runWork && !runInbox && *mode != "bounce" {
+		logger.Sugar().Fatalf("unknown mode %q", *mode)
+	}
+
 	cfg, err := config.LoadConfig("internal/config")
 	if err != nil {
 		logger.Sugar().Fatalf("failed to load config: %v", err)
 	}
-
-	// Create AppServer with zap logger
-	app, err := server.NewAppServer(cfg, logger)
-	if err != nil {
-		logger.Sugar().Fatalf("failed to initialize server: %v", err)
+	if err := server.CheckLinkSigningKey(cfg.Public); err != nil {
+		logger.Sugar().Fatalf("invalid config: %v", err)
+	}
+	if *mode == "bounce" {
+		if err := runBounce(context.Background(), cfg, logger, flag.Arg(0), os.Stdin); err != nil {
+			logger.Sugar().Fatalf("bounce error: %v", err)
+		}
+		return
+	}
+	if runWork && *mode == "all" && cfg.Delivery.Provider == "" {
+		logger.Sugar().Warn("delivery.provider is not set, campaigns will not be sent")
+		runWork = false
+	}
+	if *mode == "all" && cfg.Server.SMTPPort == 0 {
+		runInbox = false
 	}
 
-	// Start server in a goroutine
-	go func() {
-		if err := app.Run(); err != nil {
-			logger.Sugar().Fatalf("server run error: %v", err)
+	var app *server.AppServer
+	if runServer {
+		// Create AppServer with zap logger
+		app, err = server.NewAppServer(cfg, logger)
+		if err != nil {
+			logger.Sugar().Fatalf("failed to initialize server: %v", err)
 		}
-	}()
+
+		// Start server in a goroutine
+		go func() {
+			if err := app.Run(); err != nil {
+				logger.Sugar().Fatalf("server run error: %v", err)
+			}
+		}()
+		go func() {
+			if err := app.RunHTTP(); err != nil {
+				logger.Sugar().Fatalf("http server error: %v", err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	schedDone := make(chan struct{})
+	if runSched {
+		go func() {
+			defer close(schedDone)
+			if err := runScheduler(ctx, cfg, logger); err != nil {
+				logger.Sugar().Fatalf("scheduler error: %v", err)
+			}
+		}()
+	} else {
+		close(schedDone)
+	}
+	workDone := make(chan struct{})
+	if runWork {
+		go func() {
+			defer close(workDone)
+			if err := runWorker(ctx, cfg, logger); err != nil {
+				logger.Sugar().Fatalf("worker error: %v", err)
+			}
+		}()
+	} else {
+		close(workDone)
+	}
+	inboxDone := make(chan struct{})
+	if runInbox {
+		go func() {
+			defer close(inboxDone)
+			if err := runInbound(ctx, cfg, logger); err != nil {
+				logger.Sugar().Fatalf("inbound error: %v", err)
+			}
+		}()
+	} else {
+		close(inboxDone)
+	}
+
 	go func() {
 		http.ListenAndServe(":8080", nil)
 	}()
@@ -49,6 +127,12 @@ func main() {
 	<-quit
 
 	logger.Sugar().Info("Received shutdown signal")
-	app.GracefulStop()
+	cancel()
+	<-schedDone
+	<-workDone
+	<-inboxDone
+	if app != nil {
+		app.GracefulStop()
+	}
 	logger.Sugar().Info("Server stopped")
 }
@@ -1 +1,39 @@
 package main
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/internal/config"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/scheduler"
+	"github.com/SinaHo/email-marketing-backend/internal/server"
+	"go.uber.org/zap"
+)
+
+// runScheduler starts due campaigns and rechecks sending domains until ctx
+// is cancelled. Any number of schedulers can run against the same database.
+func runScheduler(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	db, err := server.OpenPostgres(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	verifier := server.NewDomainVerifier(
+		cfg.SendingDomains,
+		repository.NewSendingDomainRepository(db),
+		repository.NewCampaignRepository(db),
+	)
+	s := scheduler.New(
+		repository.NewDispatchRepository(db),
+		repository.NewContactRepository(db),
+		verifier,
+		scheduler.Options{
+			PollInterval: cfg.Scheduler.PollInterval,
+			LeaseTTL:     cfg.Scheduler.LeaseTTL,
+			BatchSize:    cfg.Scheduler.BatchSize,
+		},
+		logger.Sugar().Named("scheduler"),
+	)
+	return s.Run(ctx)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SinaHo/email-marketing-backend/internal/config"
+	"github.com/SinaHo/email-marketing-backend/internal/queue"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/server"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/go-redis/redis/v8"
+	"go.uber.org/zap"
+)
+
+// runWorker sends campaign emails until ctx is cancelled. Any number of
+// workers can share the same queue.
+func runWorker(ctx context.Context, cfg *config.Config, logger *zap.Logger) error {
+	sender, err := server.NewSender(cfg.Delivery)
+	if err != nil {
+		return err
+	}
+	if sender == nil {
+		return errors.New("delivery.provider is required to send campaigns")
+	}
+	defer sender.Close()
+
+	db, err := server.OpenPostgres(cfg.Postgres)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	var rdb *redis.Client
+	if cfg.Queue.Backend == "redis" || cfg.RateLimit.Backend == "redis" {
+		if rdb, err = server.OpenRedis(ctx, cfg.Redis); err != nil {
+			return err
+		}
+		defer rdb.Close()
+	}
+	q, err := server.NewQueue(ctx, cfg.Queue, db, rdb)
+	if err != nil {
+		return err
+	}
+	limiter, err := server.NewRateLimiter(cfg.RateLimit, rdb)
+	if err != nil {
+		return err
+	}
+	box, err := server.NewSecretBox(cfg.DKIM)
+	if err != nil {
+		return err
+	}
+	var signer service.MessageSigner
+	if box != nil {
+		signer = service.NewMessageSigner(repository.NewSendingDomainRepository(db), box)
+	}
+
+	d := service.NewCampaignDelivery(
+		repository.NewCampaignRepository(db),
+		repository.NewTemplateRepository(db),
+		repository.NewContentBlockRepository(db),
+		repository.NewContactRepository(db),
+		service.NewSuppressionService(repository.NewSuppressionRepository(db)),
+		signer,
+		server.NewVERP(cfg),
+		server.NewReplyVERP(cfg),
+		server.NewUnsubscribeService(cfg, db),
+		server.NewPreferenceService(cfg, db),
+		server.NewTrackingService(cfg, db, logger.Sugar()),
+		sender,
+		limiter,
+		server.RateLimitPolicy(cfg),
+	)
+	w := queue.NewWorker(q, d.Deliver, queue.WorkerOptions{
+		Concurrency:  cfg.Queue.Concurrency,
+		PollInterval: cfg.Queue.PollInterval,
+		Policy: queue.RetryPolicy{
+			MaxAttempts: cfg.Queue.MaxAttempts,
+			BaseDelay:   cfg.Queue.BaseDelay,
+			MaxDelay:    cfg.Queue.MaxDelay,
+		},
+	}, logger.Sugar().Named("worker"))
+	return w.Run(ctx)
+}
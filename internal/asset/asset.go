@@ -0,0 +1,89 @@
+// Package asset inspects uploaded images.
+package asset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"net/http"
+
+	// Register decoders for image.DecodeConfig.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// ErrUnsupportedType is returned for content that is not an image format
+// email clients display.
+var ErrUnsupportedType = errors.New("unsupported file type")
+
+// Info describes an image.
+type Info struct {
+	// ContentType is sniffed from the content, never taken from the client.
+	ContentType string
+	// Ext is the file extension for ContentType, including the dot.
+	Ext    string
+	Width  int
+	Height int
+}
+
+var extensions = map[string]string{
+	"image/png":  ".png",
+	"image/jpeg": ".jpg",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Inspect sniffs the type of data and reads the image dimensions. SVG is
+// rejected: most email clients do not display it and it can carry scripts.
+func Inspect(data []byte) (Info, error) {
+	ct := http.DetectContentType(data)
+	ext, ok := extensions[ct]
+	if !ok {
+		return Info{}, ErrUnsupportedType
+	}
+	info := Info{ContentType: ct, Ext: ext}
+	var err error
+	if ct == "image/webp" {
+		info.Width, info.Height, err = webpSize(data)
+	} else {
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(bytes.NewReader(data))
+		info.Width, info.Height = cfg.Width, cfg.Height
+	}
+	if err != nil {
+		return Info{}, errors.New("corrupt image: " + err.Error())
+	}
+	return info, nil
+}
+
+// webpSize reads the canvas size from the first chunk of a WebP file
+// (lossy VP8, lossless VP8L or extended VP8X).
+func webpSize(b []byte) (int, int, error) {
+	if len(b) < 30 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WEBP" {
+		return 0, 0, errors.New("invalid WebP header")
+	}
+	chunk := b[20:]
+	switch string(b[12:16]) {
+	case "VP8 ":
+		// Frame tag (3 bytes), start code 9d 01 2a, then 14-bit sizes.
+		if chunk[3] != 0x9d || chunk[4] != 0x01 || chunk[5] != 0x2a {
+			return 0, 0, errors.New("invalid VP8 frame")
+		}
+		w := int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3fff)
+		h := int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3fff)
+		return w, h, nil
+	case "VP8L":
+		if chunk[0] != 0x2f {
+			return 0, 0, errors.New("invalid VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(chunk[1:5])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X":
+		w := int(uint32(chunk[4]) | uint32(chunk[5])<<8 | uint32(chunk[6])<<16)
+		h := int(uint32(chunk[7]) | uint32(chunk[8])<<8 | uint32(chunk[9])<<16)
+		return w + 1, h + 1, nil
+	}
+	return 0, 0, errors.New("unknown WebP chunk")
+}
@@ -0,0 +1,75 @@
+package asset_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/asset"
+	"github.com/stretchr/testify/assert"
+)
+
+func encode(t *testing.T, enc func(*bytes.Buffer, image.Image) error) []byte {
+	var buf bytes.Buffer
+	if err := enc(&buf, image.NewRGBA(image.Rect(0, 0, 120, 40))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// webp builds a minimal WebP file with one chunk.
+func webp(fourCC string, payload []byte) []byte {
+	payload = append(payload, make([]byte, 16)...)
+	var b bytes.Buffer
+	b.WriteString("RIFF")
+	binary.Write(&b, binary.LittleEndian, uint32(12+len(payload)))
+	b.WriteString("WEBP" + fourCC)
+	binary.Write(&b, binary.LittleEndian, uint32(len(payload)))
+	b.Write(payload)
+	return b.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	vp8l := []byte{0x2f, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint32(vp8l[1:], (120-1)|(40-1)<<14)
+	vp8x := []byte{0, 0, 0, 0, 119, 0, 0, 39, 0, 0}
+	vp8 := []byte{0, 0, 0, 0x9d, 0x01, 0x2a, 120, 0, 40, 0}
+
+	cases := []struct {
+		name string
+		data []byte
+		ct   string
+		ext  string
+	}{
+		{"png", encode(t, func(b *bytes.Buffer, m image.Image) error { return png.Encode(b, m) }), "image/png", ".png"},
+		{"jpeg", encode(t, func(b *bytes.Buffer, m image.Image) error { return jpeg.Encode(b, m, nil) }), "image/jpeg", ".jpg"},
+		{"gif", encode(t, func(b *bytes.Buffer, m image.Image) error { return gif.Encode(b, m, nil) }), "image/gif", ".gif"},
+		{"webp lossless", webp("VP8L", vp8l), "image/webp", ".webp"},
+		{"webp extended", webp("VP8X", vp8x), "image/webp", ".webp"},
+		{"webp lossy", webp("VP8 ", vp8), "image/webp", ".webp"},
+	}
+	for _, tc := range cases {
+		info, err := asset.Inspect(tc.data)
+		if !assert.NoError(t, err, tc.name) {
+			continue
+		}
+		assert.Equal(t, asset.Info{ContentType: tc.ct, Ext: tc.ext, Width: 120, Height: 40}, info, tc.name)
+	}
+}
+
+func TestInspect_Rejects(t *testing.T) {
+	svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+	_, err := asset.Inspect(svg)
+	assert.ErrorIs(t, err, asset.ErrUnsupportedType)
+
+	_, err = asset.Inspect([]byte("%PDF-1.7\n"))
+	assert.ErrorIs(t, err, asset.ErrUnsupportedType)
+
+	// A PNG signature followed by garbage.
+	_, err = asset.Inspect([]byte("\x89PNG\r\n\x1a\nnot really"))
+	assert.ErrorContains(t, err, "corrupt image")
+}
@@ -0,0 +1,80 @@
+package blobstore_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/blobstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocal(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := blobstore.NewLocal(dir, "https://cdn.example.com/assets/")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	key := "ws/abc123.png"
+	if !assert.NoError(t, store.Put(ctx, key, strings.NewReader("png bytes"))) {
+		return
+	}
+	assert.Equal(t, "https://cdn.example.com/assets/ws/abc123.png", store.URL(key))
+
+	r, err := store.Open(ctx, key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	assert.Equal(t, "png bytes", string(data))
+
+	// No temporary files are left behind.
+	entries, _ := os.ReadDir(filepath.Join(dir, "ws"))
+	assert.Len(t, entries, 1)
+
+	assert.NoError(t, store.Delete(ctx, key))
+	assert.NoError(t, store.Delete(ctx, key))
+	_, err = store.Open(ctx, key)
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+
+	for _, bad := range []string{"", "/etc/passwd", "../x", "ws/../../x", "ws/.upload-1", "ws//x"} {
+		assert.Error(t, store.Put(ctx, bad, strings.NewReader("x")), bad)
+	}
+}
+
+func TestLocal_Handler(t *testing.T) {
+	ctx := context.Background()
+	store, err := blobstore.NewLocal(t.TempDir(), "/assets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, store.Put(ctx, "ws/abc.png", strings.NewReader("\x89PNG"))) {
+		return
+	}
+	srv := http.StripPrefix("/assets", store.Handler())
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/ws/abc.png", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Cache-Control"), "immutable")
+	assert.Equal(t, "\x89PNG", rec.Body.String())
+
+	for _, p := range []string{"/assets/ws/missing.png", "/assets/ws", "/assets/../go.mod"} {
+		rec = httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, p, nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code, p)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/assets/ws/abc.png", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,71 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"strings"
+)
+
+// ErrNotComplaint is returned by ParseComplaint for messages that are not
+// feedback reports.
+var ErrNotComplaint = errors.New("not a complaint")
+
+// Complaint is a feedback report in the Abuse Reporting Format of RFC 5965,
+// which mailbox providers send through their feedback loops when a
+// recipient marks a message as spam.
+type Complaint struct {
+	// FeedbackType is "abuse" for spam complaints, or another RFC 5965
+	// type such as "fraud" or "not-spam".
+	FeedbackType string
+	// UserAgent names the software that sent the report.
+	UserAgent string
+	// MailFrom is the return path of the reported message, in lower case.
+	MailFrom string
+	// Recipients are the recipients of the reported message, in lower
+	// case. Providers often leave them out or redact them.
+	Recipients []string
+	// MessageID is the Message-ID of the reported message, without angle
+	// brackets, if the report included its headers.
+	MessageID string
+}
+
+// ParseComplaint parses a feedback report. It returns ErrNotComplaint for
+// messages of any other kind.
+func ParseComplaint(raw []byte) (*Complaint, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	var parts []part
+	if err := walk(textproto.MIMEHeader(msg.Header), msg.Body, 0, &parts); err != nil {
+		return nil, err
+	}
+	for _, p := range parts {
+		if p.typ != "message/feedback-report" {
+			continue
+		}
+		// The report is a single group of fields; some providers end it
+		// without a blank line.
+		h, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(p.body))).ReadMIMEHeader()
+		c := &Complaint{
+			FeedbackType: strings.ToLower(strings.TrimSpace(h.Get("Feedback-Type"))),
+			UserAgent:    strings.TrimSpace(h.Get("User-Agent")),
+			MailFrom:     dsnAddress(h.Get("Original-Mail-From")),
+			MessageID:    originalMessageID(parts),
+		}
+		for _, v := range h["Original-Rcpt-To"] {
+			if addr := dsnAddress(v); strings.Contains(addr, "@") {
+				c.Recipients = append(c.Recipients, addr)
+			}
+		}
+		if c.FeedbackType == "" {
+			return nil, ErrNotComplaint
+		}
+		return c, nil
+	}
+	return nil, ErrNotComplaint
+}
@@ -0,0 +1,238 @@
+// Package bounce parses and classifies bounce messages and complaints.
+//
+// Receivers report failed deliveries as RFC 3464 delivery status
+// notifications, or in one of the free-text formats older MTAs still use.
+// Parse understands both and returns the failed recipients with the status
+// and diagnostic the receiver gave, classified by Classify. ParseComplaint
+// parses the spam complaints feedback loops report, and ParseReply the
+// replies of recipients.
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+)
+
+// ErrNotBounce is returned by Parse for messages that do not report a
+// failed delivery, such as replies and out of office notices.
+var ErrNotBounce = errors.New("not a bounce")
+
+// Kind is the class of a bounce.
+type Kind string
+
+const (
+	// Hard bounces are permanent failures of the address itself, such as
+	// an unknown user or domain.
+	Hard Kind = "hard"
+	// Soft bounces are temporary failures or failures of one message.
+	Soft Kind = "soft"
+	// Block bounces are rejections of the sender, for example for its
+	// reputation, and say nothing about the address.
+	Block Kind = "block"
+	// MailboxFull bounces report a mailbox over its quota.
+	MailboxFull Kind = "mailbox_full"
+	// Delayed reports say the message is still being retried. They are
+	// not failures, however temporary.
+	Delayed Kind = "delayed"
+)
+
+// Report is a parsed bounce message.
+type Report struct {
+	// Format is "dsn" for delivery status notifications and "text" for
+	// free-text bounces.
+	Format string
+	// MessageID is the Message-ID of the bounced message, without angle
+	// brackets, if the bounce returned its headers.
+	MessageID string
+	// To lists the addresses the bounce was delivered to, from its
+	// Delivered-To, X-Original-To and To headers.
+	To []string
+	// Recipients are the failed or delayed recipients.
+	Recipients []Recipient
+}
+
+// Recipient is the outcome of the delivery to one recipient.
+type Recipient struct {
+	// Email is the final recipient address, in lower case.
+	Email string
+	// OriginalEmail is the address the message was sent to if an alias
+	// expanded it to Email, in lower case.
+	OriginalEmail string
+	// Action is the DSN action, "failed" or "delayed".
+	Action string
+	// Status is the enhanced status code such as "5.1.1", or empty if the
+	// receiver gave none.
+	Status string
+	// Diagnostic is the receiver's explanation, usually its SMTP reply.
+	Diagnostic string
+	Kind       Kind
+}
+
+// maxDepth bounds the nesting of multipart bodies Parse descends into.
+const maxDepth = 5
+
+// Parse parses a bounce message. It returns ErrNotBounce for messages of
+// any other kind.
+func Parse(raw []byte) (*Report, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	var parts []part
+	if err := walk(textproto.MIMEHeader(msg.Header), msg.Body, 0, &parts); err != nil {
+		return nil, err
+	}
+
+	var r *Report
+	for _, p := range parts {
+		if p.typ == "message/delivery-status" || p.typ == "message/global-delivery-status" {
+			if r, err = parseDSN(p.body); err != nil {
+				return nil, err
+			}
+			break
+		}
+	}
+	if r == nil {
+		if !looksLikeBounce(msg.Header) {
+			return nil, ErrNotBounce
+		}
+		r = parseText(msg.Header, parts)
+	}
+	if len(r.Recipients) == 0 {
+		return nil, ErrNotBounce
+	}
+
+	r.MessageID = originalMessageID(parts)
+	for _, name := range []string{"Delivered-To", "X-Original-To", "To"} {
+		for _, v := range msg.Header[name] {
+			if list, err := mail.ParseAddressList(v); err == nil {
+				for _, a := range list {
+					r.To = append(r.To, strings.ToLower(a.Address))
+				}
+			}
+		}
+	}
+	for i := range r.Recipients {
+		rcpt := &r.Recipients[i]
+		rcpt.Kind = Classify(rcpt.Action, rcpt.Status, rcpt.Diagnostic)
+	}
+	return r, nil
+}
+
+// part is a leaf of a message body with its transfer encoding undone.
+type part struct {
+	typ     string
+	charset string
+	body    []byte
+}
+
+// walk appends the leaves of the entity with header h and body to parts.
+// Attached messages are leaves too: they are the bounced message.
+func walk(h textproto.MIMEHeader, body io.Reader, depth int, parts *[]part) error {
+	typ, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		typ = "text/plain"
+	}
+	if strings.HasPrefix(typ, "multipart/") && depth < maxDepth {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := mr.NextRawPart()
+			if err != nil {
+				// Bounces often truncate the returned message, so a
+				// malformed end of the body is not an error either.
+				return nil
+			}
+			if err := walk(p.Header, p, depth+1, parts); err != nil {
+				return err
+			}
+		}
+	}
+	switch strings.ToLower(h.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, newlineStripper{body})
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil && len(data) == 0 {
+		return fmt.Errorf("read %s part: %w", typ, err)
+	}
+	*parts = append(*parts, part{typ: typ, charset: params["charset"], body: data})
+	return nil
+}
+
+// newlineStripper drops line breaks, which base64.NewDecoder does not
+// accept in every position.
+type newlineStripper struct{ r io.Reader }
+
+func (s newlineStripper) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:n] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+var bounceSubject = regexp.MustCompile(`(?i)undeliver|undelivered|delivery (status notification|failure|has failed|failed)|` +
+	`failure notice|mail delivery (failed|failure|system)|returned mail|could not be delivered|delivery problem|` +
+	`mail system error|nondeliverable|non-delivery|delayed mail|warning: message .* delayed`)
+
+var bounceSender = regexp.MustCompile(`(?i)^(mailer-daemon|postmaster|mail delivery (subsystem|system))\b`)
+
+// looksLikeBounce reports whether a message without a delivery status part
+// comes from a mail system reporting a failure.
+func looksLikeBounce(h mail.Header) bool {
+	if h.Get("X-Failed-Recipients") != "" {
+		return true
+	}
+	if from, err := mail.ParseAddress(h.Get("From")); err == nil {
+		if bounceSender.MatchString(from.Address) || bounceSender.MatchString(from.Name) {
+			return bounceSubject.MatchString(h.Get("Subject")) || h.Get("Subject") == ""
+		}
+	}
+	return false
+}
+
+// originalMessageID returns the Message-ID of the bounced message from the
+// returned headers, or from a copy of the message quoted in the text.
+func originalMessageID(parts []part) string {
+	for _, p := range parts {
+		switch p.typ {
+		case "message/rfc822", "message/global", "text/rfc822-headers", "message/global-headers":
+			// Returned headers may be cut off; use the fields read so far.
+			h, _ := textproto.NewReader(bufio.NewReader(bytes.NewReader(p.body))).ReadMIMEHeader()
+			if id := trimMessageID(h.Get("Message-Id")); id != "" {
+				return id
+			}
+		}
+	}
+	for _, p := range parts {
+		if p.typ == "text/plain" {
+			if m := quotedMessageID.FindSubmatch(p.body); m != nil {
+				return trimMessageID(string(m[1]))
+			}
+		}
+	}
+	return ""
+}
+
+var quotedMessageID = regexp.MustCompile(`(?im)^\s*Message-ID:\s*(<[^>\s]+>)`)
+
+func trimMessageID(id string) string {
+	id = strings.TrimSpace(id)
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
@@ -0,0 +1,227 @@
+package bounce_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestParse_Corpus parses the sample bounces in testdata, collected from
+// the MTAs and mailbox providers we see most.
+func TestParse_Corpus(t *testing.T) {
+	type rcpt struct {
+		email, original, action, status string
+		kind                            bounce.Kind
+	}
+	tests := []struct {
+		file      string
+		format    string
+		messageID string
+		to        string
+		rcpts     []rcpt
+	}{
+		{"postfix_user_unknown.eml", "dsn", "2f-0d4c1a8e9b7f@acme.com", "bounces+2f-0d4c1a8e9b7f@bounce.mailer.example",
+			[]rcpt{{"bob@example.org", "", "failed", "5.1.1", bounce.Hard}}},
+		{"gmail_mailbox_full.eml", "dsn", "a1-5e2b9c0d11aa@acme.com", "bounces+a1-5e2b9c0d11aa@bounce.mailer.example",
+			[]rcpt{{"carol@gmail.example", "", "failed", "5.2.2", bounce.MailboxFull}}},
+		{"office365_blocked.eml", "dsn", "b2-77aa01c3d9e4@acme.com", "bounces+b2-77aa01c3d9e4@bounce.mailer.example",
+			[]rcpt{{"dave@contoso.example", "", "failed", "5.7.606", bounce.Block}}},
+		{"postfix_delayed.eml", "dsn", "c3-1f2e3d4c5b6a@acme.com", "bounces+c3-1f2e3d4c5b6a@bounce.mailer.example",
+			[]rcpt{{"erin@slow.example", "", "delayed", "4.4.1", bounce.Delayed}}},
+		{"sendmail_multiple.eml", "dsn", "d4-aa00bb11cc22@acme.com", "news@acme.com", []rcpt{
+			{"frank@example.net", "", "failed", "5.1.1", bounce.Hard},
+			{"grace@example.net", "", "failed", "5.2.1", bounce.Hard},
+		}},
+		{"global_dsn.eml", "dsn", "e5-9f8e7d6c5b4a@acme.com", "bounces+e5-9f8e7d6c5b4a@bounce.mailer.example",
+			[]rcpt{{"jörg@beispiel.example", "", "failed", "5.1.1", bounce.Hard}}},
+		{"dsn_alias.eml", "dsn", "", "bounces+f6-0a1b2c3d4e5f@bounce.mailer.example",
+			[]rcpt{{"ivan.old@customer.example", "info@customer.example", "failed", "5.0.0", bounce.Hard}}},
+		{"qmail.eml", "text", "g7-3c4d5e6f7a8b@acme.com", "bounces+g7-3c4d5e6f7a8b@bounce.mailer.example",
+			[]rcpt{{"judy@qmail.example", "", "failed", "5.1.1", bounce.Hard}}},
+		{"exim.eml", "text", "h8-6a7b8c9d0e1f@acme.com", "bounces+h8-6a7b8c9d0e1f@bounce.mailer.example",
+			[]rcpt{{"kim@exim.example", "", "failed", "5.1.1", bounce.Hard}}},
+		{"exim_quota.eml", "text", "i9-112233445566@acme.com", "news@acme.com",
+			[]rcpt{{"leo@exim.example", "", "failed", "", bounce.MailboxFull}}},
+		{"exim_delayed.eml", "text", "", "bounces+j0-aabbccddeeff@bounce.mailer.example",
+			[]rcpt{{"mia@greylist.example", "", "delayed", "4.7.1", bounce.Delayed}}},
+		{"yahoo_legacy.eml", "text", "k1-0f0e0d0c0b0a@acme.com", "bounces+k1-0f0e0d0c0b0a@bounce.mailer.example",
+			[]rcpt{{"nick@yahoo.example", "", "failed", "5.0.0", bounce.Hard}}},
+		{"postfix_plain_blocked.eml", "text", "", "bounces+m2-99887766aabb@bounce.mailer.example",
+			[]rcpt{{"olga@partner.example", "", "failed", "5.7.1", bounce.Block}}},
+		{"exchange_text.eml", "text", "n3-123456abcdef@acme.com", "bounces+n3-123456abcdef@bounce.mailer.example",
+			[]rcpt{{"pat@fabrikam.example", "", "failed", "5.1.10", bounce.Hard}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if !assert.NoError(t, err) {
+				return
+			}
+			r, err := bounce.Parse(raw)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.format, r.Format)
+			assert.Equal(t, tt.messageID, r.MessageID)
+			assert.Contains(t, r.To, tt.to)
+			var got []rcpt
+			for _, rc := range r.Recipients {
+				got = append(got, rcpt{rc.Email, rc.OriginalEmail, rc.Action, rc.Status, rc.Kind})
+				assert.NotEmpty(t, rc.Diagnostic, rc.Email)
+			}
+			assert.Equal(t, tt.rcpts, got)
+		})
+	}
+}
+
+func TestParse_Diagnostic(t *testing.T) {
+	raw, err := os.ReadFile("testdata/postfix_user_unknown.eml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, err := bounce.Parse(raw)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "550 5.1.1 <bob@example.org>: Recipient address rejected: User unknown in virtual mailbox table",
+		r.Recipients[0].Diagnostic)
+}
+
+func TestParse_NotBounce(t *testing.T) {
+	for _, file := range []string{"auto_reply.eml", "reply.eml", "dsn_delivered.eml"} {
+		raw, err := os.ReadFile(filepath.Join("testdata", file))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = bounce.Parse(raw)
+		assert.ErrorIs(t, err, bounce.ErrNotBounce, file)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		action, status, diagnostic string
+		want                       bounce.Kind
+	}{
+		{"failed", "5.1.1", "550 5.1.1 user unknown", bounce.Hard},
+		{"failed", "5.0.0", "550 Requested action not taken: mailbox unavailable", bounce.Hard},
+		{"failed", "5.4.1", "550 5.4.1 Recipient address rejected: Access denied", bounce.Hard},
+		{"failed", "5.0.0", "554 delivery refused", bounce.Hard},
+		{"failed", "5.2.2", "552 5.2.2 mailbox full", bounce.MailboxFull},
+		{"failed", "5.0.0", "552 Quota exceeded for this user", bounce.MailboxFull},
+		{"failed", "5.7.1", "554 5.7.1 Message rejected", bounce.Block},
+		{"failed", "5.0.0", "550 Message rejected as spam", bounce.Block},
+		{"failed", "5.1.8", "553 5.1.8 Sender address rejected: Domain not found", bounce.Block},
+		{"failed", "5.3.4", "552 5.3.4 Message size exceeds fixed limit", bounce.Soft},
+		{"delayed", "4.4.1", "connection timed out", bounce.Delayed},
+		{"delayed", "4.2.2", "mailbox full", bounce.Delayed},
+		{"failed", "4.7.0", "421 4.7.0 Our system has detected an unusual rate of unsolicited mail", bounce.Block},
+		{"failed", "", "", bounce.Soft},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, bounce.Classify(tt.action, tt.status, tt.diagnostic), tt.diagnostic)
+	}
+}
+
+func TestVERP(t *testing.T) {
+	v := bounce.NewVERP([]byte("key"), "bounces@bounce.mailer.example")
+	rp := v.Address(1234)
+	assert.Regexp(t, `^bounces\+ya-[0-9a-f]{12}@bounce\.mailer\.example$`, rp)
+
+	job, ok := v.Job(rp)
+	assert.True(t, ok)
+	assert.Equal(t, int64(1234), job)
+	job, ok = v.Job("<" + v.MessageID(1234, "acme.com") + ">")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1234), job)
+
+	// Some MTAs change the case of local parts.
+	_, ok = v.Job("BOUNCES+YA-" + rp[len("bounces+ya-"):])
+	assert.True(t, ok)
+
+	for _, forged := range []string{
+		"bounces+yb-" + rp[len("bounces+ya-"):],
+		bounce.NewVERP([]byte("other"), "bounces@bounce.mailer.example").Address(1234),
+		"bounces@bounce.mailer.example",
+		"bob@example.org",
+	} {
+		_, ok := v.Job(forged)
+		assert.False(t, ok, forged)
+	}
+
+	assert.Empty(t, bounce.NewVERP([]byte("key"), "").Address(1234))
+}
+
+func TestParseComplaint(t *testing.T) {
+	tests := []struct {
+		file string
+		want bounce.Complaint
+	}{
+		{"arf_abuse.eml", bounce.Complaint{
+			FeedbackType: "abuse",
+			UserAgent:    "MailboxFBL/1.0",
+			MailFrom:     "bounces+p4-1a2b3c4d5e6f@bounce.mailer.example",
+			Recipients:   []string{"quinn@mailbox.example"},
+			MessageID:    "p4-1a2b3c4d5e6f@acme.com",
+		}},
+		{"arf_redacted.eml", bounce.Complaint{
+			FeedbackType: "abuse",
+			UserAgent:    "ISP-FBL/2.1",
+			MessageID:    "q5-6f5e4d3c2b1a@acme.com",
+		}},
+	}
+	for _, tt := range tests {
+		raw, err := os.ReadFile(filepath.Join("testdata", tt.file))
+		if !assert.NoError(t, err) {
+			return
+		}
+		c, err := bounce.ParseComplaint(raw)
+		if assert.NoError(t, err, tt.file) {
+			assert.Equal(t, tt.want, *c, tt.file)
+		}
+		_, err = bounce.Parse(raw)
+		assert.ErrorIs(t, err, bounce.ErrNotBounce, tt.file)
+	}
+
+	for _, file := range []string{"postfix_user_unknown.eml", "reply.eml"} {
+		raw, err := os.ReadFile(filepath.Join("testdata", file))
+		if !assert.NoError(t, err) {
+			return
+		}
+		_, err = bounce.ParseComplaint(raw)
+		assert.ErrorIs(t, err, bounce.ErrNotComplaint, file)
+	}
+}
+
+func TestParseReply(t *testing.T) {
+	raw, err := os.ReadFile("testdata/reply_latin1.eml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, err := bounce.ParseReply(raw)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &bounce.Reply{
+		FromEmail:  "renee@example.com",
+		FromName:   "Renée Müller",
+		Subject:    "Re: Frühlingsangebot",
+		MessageID:  "CAF3x9@mail.example.com",
+		References: []string{"r6-aabbccddeeff@acme.com", "older@acme.com", "r6-aabbccddeeff@acme.com"},
+		Text:       "Grüße, ich hätte gern mehr Informationen.",
+	}, r)
+
+	for file, auto := range map[string]bool{"auto_reply.eml": true, "reply.eml": false} {
+		raw, err := os.ReadFile(filepath.Join("testdata", file))
+		if !assert.NoError(t, err) {
+			return
+		}
+		r, err := bounce.ParseReply(raw)
+		if assert.NoError(t, err, file) {
+			assert.Equal(t, auto, r.AutoReply, file)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package bounce
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	enhancedStatus = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+	// statusInText finds an enhanced status code in a diagnostic, also in
+	// qmail's "(#5.1.1)" notation.
+	statusInText = regexp.MustCompile(`(?:^|[\s#(\[-])([245]\.\d{1,3}\.\d{1,3})\b`)
+	// replyInText finds an SMTP reply code, as in "550 user unknown" or
+	// "554-delivery error".
+	replyInText = regexp.MustCompile(`(?:^|[\s:])([245]\d\d)(?:[\s:-]|$)`)
+)
+
+// statusOf returns the enhanced status code in a diagnostic text. Without
+// one it derives the class from the SMTP reply code, returning "5.0.0" for
+// "550 no such user". It returns "" if the text has neither.
+func statusOf(text string) string {
+	if m := statusInText.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+	if m := replyInText.FindStringSubmatch(text); m != nil {
+		return m[1][:1] + ".0.0"
+	}
+	return ""
+}
+
+// Phrases receivers use for each kind of bounce, matched against the lower
+// case diagnostic. Status codes are often too generic to tell: many
+// servers answer 550 5.0.0 or 554 5.7.1 for anything.
+var (
+	fullPhrases = []string{
+		"mailbox full", "mailbox is full", "over quota", "overquota", "quota exceeded", "exceeded storage",
+		"exceeds quota", "insufficient storage", "mailbox size limit", "out of storage",
+	}
+	hardPhrases = []string{
+		"user unknown", "unknown user", "no such user", "no such recipient", "no such mailbox", "unknown recipient",
+		"invalid recipient", "recipient not found", "recipientnotfound", "recipient address rejected",
+		"address rejected", "does not exist", "doesn't exist", "no mailbox", "mailbox unavailable",
+		"mailbox not found", "account has been disabled", "account is disabled", "account disabled",
+		"user doesn't have", "doesn't have a", "not a valid", "invalid address", "bad destination",
+		"host or domain name not found", "domain not found", "no such domain", "unrouteable address",
+		"unrouteable domain", "address does not exist",
+	}
+	blockPhrases = []string{
+		"spam", "blocked", "blacklist", "blocklist", "block list", "denylist", "rbl", "spamhaus", "reputation",
+		"policy", "banned", "dmarc", "spf", "dkim", "not authorized to send", "rate limit", "too many",
+		"unsolicited", "bulk mail",
+	}
+)
+
+// Classify returns the kind of a bounce from its DSN action, enhanced
+// status code and diagnostic. The diagnostic wins where it is specific,
+// since receivers use status codes loosely.
+func Classify(action, status, diagnostic string) Kind {
+	text := strings.ToLower(diagnostic)
+	class, subject, detail := splitStatus(status)
+	switch {
+	case action == "delayed":
+		return Delayed
+	case subject == "2" && detail == "2" || contains(text, fullPhrases):
+		return MailboxFull
+	case class == "4":
+		if contains(text, blockPhrases) {
+			return Block
+		}
+		return Soft
+	case subject == "1" && (detail == "7" || detail == "8") || strings.Contains(text, "sender address"):
+		// 5.1.7 and 5.1.8 reject the sender's address, not the recipient's.
+		return Block
+	case contains(text, hardPhrases):
+		return Hard
+	case subject == "7" || contains(text, blockPhrases):
+		return Block
+	case class == "5" && (subject == "3" || subject == "5" || subject == "6"):
+		// System, protocol and content errors concern this message only.
+		return Soft
+	case class == "5":
+		return Hard
+	}
+	return Soft
+}
+
+func splitStatus(status string) (class, subject, detail string) {
+	if !enhancedStatus.MatchString(status) {
+		return "", "", ""
+	}
+	parts := strings.SplitN(status, ".", 3)
+	return parts[0], parts[1], parts[2]
+}
+
+func contains(text string, phrases []string) bool {
+	for _, p := range phrases {
+		if strings.Contains(text, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package bounce
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// parseDSN parses the body of a message/delivery-status part, RFC 3464
+// section 2.1: per-message fields followed by a group of fields for each
+// recipient, separated by blank lines. Recipients that were delivered are
+// left out.
+func parseDSN(body []byte) (*Report, error) {
+	r := &Report{Format: "dsn"}
+	tr := textproto.NewReader(bufio.NewReader(bytes.NewReader(body)))
+	first := true
+	for {
+		h, err := tr.ReadMIMEHeader()
+		if len(h) > 0 {
+			if first {
+				// The per-message fields say nothing we use.
+				first = false
+			} else if rcpt, ok := dsnRecipient(h); ok {
+				r.Recipients = append(r.Recipients, rcpt)
+			}
+		}
+		if err == io.EOF {
+			return r, nil
+		}
+		if err != nil {
+			// Keep the recipients parsed before a malformed group.
+			return r, nil
+		}
+	}
+}
+
+func dsnRecipient(h textproto.MIMEHeader) (Recipient, bool) {
+	rcpt := Recipient{
+		Email:         dsnAddress(h.Get("Final-Recipient")),
+		OriginalEmail: dsnAddress(h.Get("Original-Recipient")),
+		Action:        strings.ToLower(strings.TrimSpace(h.Get("Action"))),
+		Status:        strings.TrimSpace(h.Get("Status")),
+		Diagnostic:    dsnDiagnostic(h.Get("Diagnostic-Code")),
+	}
+	if rcpt.Email == "" {
+		rcpt.Email = rcpt.OriginalEmail
+	}
+	if rcpt.OriginalEmail == rcpt.Email {
+		rcpt.OriginalEmail = ""
+	}
+	// Status may carry a comment, as in "5.1.1 (bad destination mailbox)".
+	if i := strings.IndexAny(rcpt.Status, " \t("); i >= 0 {
+		rcpt.Status = rcpt.Status[:i]
+	}
+	if !enhancedStatus.MatchString(rcpt.Status) {
+		rcpt.Status = statusOf(rcpt.Diagnostic)
+	}
+	switch rcpt.Action {
+	case "failed", "delayed":
+	case "":
+		// Some MTAs leave Action out; the status class tells.
+		if rcpt.Status == "" || rcpt.Status[0] == '2' {
+			return rcpt, false
+		}
+		rcpt.Action = "failed"
+		if rcpt.Status[0] == '4' {
+			rcpt.Action = "delayed"
+		}
+	default:
+		// delivered, relayed or expanded.
+		return rcpt, false
+	}
+	return rcpt, rcpt.Email != ""
+}
+
+// dsnAddress returns the address of a recipient field such as
+// "rfc822; bob@example.com", in lower case.
+func dsnAddress(v string) string {
+	if _, addr, ok := strings.Cut(v, ";"); ok {
+		v = addr
+	}
+	v = strings.TrimSpace(v)
+	v = strings.TrimSuffix(strings.TrimPrefix(v, "<"), ">")
+	return strings.ToLower(v)
+}
+
+// dsnDiagnostic strips the diagnostic type, as in "smtp; 550 5.1.1 ...".
+func dsnDiagnostic(v string) string {
+	if typ, text, ok := strings.Cut(v, ";"); ok && !strings.ContainsAny(typ, " \t") {
+		v = text
+	}
+	return strings.Join(strings.Fields(v), " ")
+}
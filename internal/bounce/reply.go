@@ -0,0 +1,122 @@
+package bounce
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SinaHo/email-marketing-backend/internal/htmlmail"
+	"golang.org/x/net/html/charset"
+)
+
+// Reply is a message a recipient sent in reply to one of ours.
+type Reply struct {
+	// FromEmail is the sender address, in lower case.
+	FromEmail string
+	FromName  string
+	Subject   string
+	// MessageID is the Message-ID of the reply, without angle brackets.
+	MessageID string
+	// References are the Message-IDs of the messages replied to, from the
+	// In-Reply-To and References headers, without angle brackets.
+	References []string
+	// Text is the plain text body, or the text of the HTML body if the
+	// reply has no plain text part.
+	Text string
+	// AutoReply is set for out of office notices and other replies sent
+	// by software.
+	AutoReply bool
+}
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+var autoReplySubject = regexp.MustCompile(`(?i)^\s*(auto(matic)?[ -]?(reply|response)|out of (the )?office|` +
+	`abwesenheitsnotiz|réponse automatique|respuesta automática)\b`)
+
+// ParseReply parses a reply. Bounces and complaints parse as replies too,
+// so callers should try Parse and ParseComplaint first.
+func ParseReply(raw []byte) (*Reply, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+	var parts []part
+	if err := walk(textproto.MIMEHeader(msg.Header), msg.Body, 0, &parts); err != nil {
+		return nil, err
+	}
+
+	r := &Reply{MessageID: trimMessageID(msg.Header.Get("Message-Id"))}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	if from, err := parser.Parse(msg.Header.Get("From")); err == nil {
+		r.FromEmail, r.FromName = strings.ToLower(from.Address), from.Name
+	}
+	if r.Subject, err = wordDecoder.DecodeHeader(msg.Header.Get("Subject")); err != nil {
+		r.Subject = msg.Header.Get("Subject")
+	}
+	for _, name := range []string{"In-Reply-To", "References"} {
+		for _, id := range messageIDList.FindAllString(msg.Header.Get(name), -1) {
+			r.References = append(r.References, trimMessageID(id))
+		}
+	}
+	r.Text = replyText(parts)
+	r.AutoReply = isAutoReply(msg.Header, r.Subject)
+	return r, nil
+}
+
+var messageIDList = regexp.MustCompile(`<[^<>\s]+>`)
+
+// isAutoReply reports whether the message was sent by software, going by
+// RFC 3834 and the headers and subjects of common responders.
+func isAutoReply(h mail.Header, subject string) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "auto_reply", "bulk", "junk":
+		return true
+	}
+	return autoReplySubject.MatchString(subject)
+}
+
+// replyText returns the first plain text part, or the text of the first
+// HTML part, converted to UTF-8.
+func replyText(parts []part) string {
+	for _, typ := range []string{"text/plain", "text/html"} {
+		for _, p := range parts {
+			if p.typ != typ {
+				continue
+			}
+			text := decodeCharset(p.charset, p.body)
+			if typ == "text/html" {
+				return htmlmail.ToText(text)
+			}
+			return strings.TrimSpace(strings.ReplaceAll(text, "\r\n", "\n"))
+		}
+	}
+	return ""
+}
+
+// decodeCharset converts body from label to UTF-8. Bodies in unknown
+// charsets keep their valid UTF-8 only.
+func decodeCharset(label string, body []byte) string {
+	if label != "" && !strings.EqualFold(label, "utf-8") && !strings.EqualFold(label, "us-ascii") {
+		if r, err := charset.NewReaderLabel(label, bytes.NewReader(body)); err == nil {
+			if data, err := io.ReadAll(r); err == nil {
+				body = data
+			}
+		}
+	}
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return strings.ToValidUTF8(string(body), "�")
+}
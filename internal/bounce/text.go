@@ -0,0 +1,138 @@
+package bounce
+
+import (
+	"html"
+	"net/mail"
+	"regexp"
+	"strings"
+)
+
+var (
+	// recipientLine is a line naming a failed recipient the way qmail,
+	// Exim, Postfix without DSN and Exchange do:
+	//
+	//	<bob@example.com>:
+	//	<bob@example.com>: host mx.example.com said: 550 5.1.1 ...
+	//	  bob@example.com
+	//	bob@example.com (bob@example.com)
+	recipientLine = regexp.MustCompile(`^<?([^\s<>()@"]+@[^\s<>():]+\.[^\s<>():]+)>?(?:\s+\([^)]*\))?(?::\s*(.*))?$`)
+	// returnedMessage starts the copy of the bounced message.
+	returnedMessage = regexp.MustCompile(`(?im)^[\s>-]*(?:this is a copy of the message|below this line is a copy of the message|` +
+		`original message|the original message|undelivered message|copy of the message|message headers follow|` +
+		`original message headers|returned message)`)
+	replyLine = regexp.MustCompile(`\b[245]\d\d\b|\b[245]\.\d{1,3}\.\d{1,3}\b`)
+	tag       = regexp.MustCompile(`<[^>]*>`)
+	delayed   = regexp.MustCompile(`(?i)\bdelay|will (?:continue|keep) (?:trying|retrying)|still trying`)
+)
+
+// parseText parses a bounce in one of the free-text formats. Recipients
+// are found by the lines naming them, each followed by the receiver's
+// answer, or else in the X-Failed-Recipients header.
+func parseText(h mail.Header, parts []part) *Report {
+	text := bodyText(parts)
+	if loc := returnedMessage.FindStringIndex(text); loc != nil {
+		text = text[:loc[0]]
+	}
+	action := "failed"
+	if delayed.MatchString(h.Get("Subject")) {
+		action = "delayed"
+	}
+
+	r := &Report{Format: "text"}
+	index := map[string]int{}
+	add := func(email, diagnostic string) {
+		email = strings.ToLower(email)
+		if bounceSender.MatchString(email) {
+			return
+		}
+		diagnostic = strings.Join(strings.Fields(diagnostic), " ")
+		// Exchange names each recipient twice: for the sender and then
+		// with the server's answer for administrators.
+		if i, ok := index[email]; ok {
+			rcpt := &r.Recipients[i]
+			rcpt.Diagnostic = strings.TrimSpace(rcpt.Diagnostic + " " + diagnostic)
+			if rcpt.Status == "" {
+				rcpt.Status = statusOf(diagnostic)
+			}
+			return
+		}
+		index[email] = len(r.Recipients)
+		r.Recipients = append(r.Recipients, Recipient{
+			Email:      email,
+			Action:     action,
+			Status:     statusOf(diagnostic),
+			Diagnostic: diagnostic,
+		})
+	}
+
+	for _, para := range paragraphs(text) {
+		m := recipientLine.FindStringSubmatch(strings.TrimSpace(para[0]))
+		if m == nil {
+			continue
+		}
+		add(m[1], m[2]+" "+strings.Join(para[1:], " "))
+	}
+	if len(r.Recipients) == 0 {
+		// Without a recipient line, take the first line that looks like
+		// the receiver's answer as the diagnostic for every recipient.
+		diagnostic := ""
+		for _, line := range strings.Split(text, "\n") {
+			if replyLine.MatchString(line) {
+				diagnostic = line
+				break
+			}
+		}
+		for _, v := range h["X-Failed-Recipients"] {
+			for _, addr := range strings.Split(v, ",") {
+				if addr = strings.TrimSpace(addr); strings.Contains(addr, "@") {
+					add(addr, diagnostic)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// bodyText returns the text of the bounce itself, falling back to its HTML
+// with the markup removed.
+func bodyText(parts []part) string {
+	var plain, rich strings.Builder
+	for _, p := range parts {
+		switch p.typ {
+		case "text/plain":
+			plain.Write(p.body)
+			plain.WriteByte('\n')
+		case "text/html":
+			s := strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n\n", "</div>", "\n").
+				Replace(string(p.body))
+			rich.WriteString(html.UnescapeString(tag.ReplaceAllString(s, "")))
+			rich.WriteByte('\n')
+		}
+	}
+	text := plain.String()
+	if strings.TrimSpace(text) == "" {
+		text = rich.String()
+	}
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// paragraphs splits text at blank lines and returns the non-blank lines of
+// each paragraph.
+func paragraphs(text string) [][]string {
+	var out [][]string
+	var cur []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if cur != nil {
+				out = append(out, cur)
+				cur = nil
+			}
+			continue
+		}
+		cur = append(cur, strings.TrimSpace(line))
+	}
+	if cur != nil {
+		out = append(out, cur)
+	}
+	return out
+}
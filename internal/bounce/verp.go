@@ -0,0 +1,86 @@
+package bounce
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// tagMACLen is the number of hex digits of the MAC in a tag. 48 bits keep
+// return paths short while making forged tags impractical to guess.
+const tagMACLen = 12
+
+// VERP tags outgoing messages with the send job they deliver, in their
+// return path (variable envelope return path), Reply-To or Message-ID, so
+// bounces and replies can be traced back to the job. Tags carry a MAC so a
+// forged bounce cannot suppress arbitrary recipients.
+type VERP struct {
+	key    []byte
+	local  string
+	domain string
+}
+
+// NewVERP returns a VERP signing tags with key. addr is the address that
+// is tagged, such as "bounces@bounce.example.com", which becomes
+// "bounces+<tag>@bounce.example.com". If it is empty only Message-IDs are
+// tagged.
+func NewVERP(key []byte, addr string) *VERP {
+	v := &VERP{key: key}
+	if at := strings.LastIndexByte(addr, '@'); at > 0 {
+		v.local, v.domain = addr[:at], strings.ToLower(addr[at+1:])
+	}
+	return v
+}
+
+// Address returns the tagged address for the message of job, or "" if no
+// address is configured.
+func (v *VERP) Address(job int64) string {
+	if v.domain == "" {
+		return ""
+	}
+	return v.local + "+" + v.tag(job) + "@" + v.domain
+}
+
+// MessageID returns the Message-ID, without angle brackets, for the message
+// of job sent from domain.
+func (v *VERP) MessageID(job int64, domain string) string {
+	return v.tag(job) + "@" + domain
+}
+
+// Job returns the send job tagged in addr, which is a tagged address or a
+// Message-ID with or without angle brackets. It reports false if addr
+// carries no valid tag.
+func (v *VERP) Job(addr string) (int64, bool) {
+	addr = trimMessageID(addr)
+	at := strings.LastIndexByte(addr, '@')
+	if at < 0 {
+		return 0, false
+	}
+	tag := strings.ToLower(addr[:at])
+	if plus := strings.LastIndexByte(tag, '+'); plus >= 0 {
+		tag = tag[plus+1:]
+	}
+	id, mac, ok := strings.Cut(tag, "-")
+	if !ok {
+		return 0, false
+	}
+	job, err := strconv.ParseInt(id, 36, 64)
+	if err != nil || job <= 0 || !hmac.Equal([]byte(mac), []byte(v.mac(job))) {
+		return 0, false
+	}
+	return job, true
+}
+
+// tag is the job ID in base 36 and its MAC, in lower case because some
+// MTAs fold the case of local parts.
+func (v *VERP) tag(job int64) string {
+	return strconv.FormatInt(job, 36) + "-" + v.mac(job)
+}
+
+func (v *VERP) mac(job int64) string {
+	m := hmac.New(sha256.New, v.key)
+	m.Write([]byte("verp:" + strconv.FormatInt(job, 10)))
+	return hex.EncodeToString(m.Sum(nil))[:tagMACLen]
+}
@@ -3,12 +3,23 @@ package config
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type ServerConfig struct {
 	Port int `mapstructure:"port"`
+	// HTTPPort serves public HTTP endpoints such as uploaded assets. Zero
+	// disables them.
+	HTTPPort int `mapstructure:"http_port"`
+	// SMTPPort receives bounces, complaints and replies for the domains of
+	// InboundConfig. Zero disables the inbound SMTP server.
+	SMTPPort int `mapstructure:"smtp_port"`
+	// TrustedProxies are the addresses and CIDR ranges of the reverse
+	// proxies and gateways in front of the servers. X-Forwarded-For is
+	// only believed from them; empty trusts none.
+	TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type PostgresConfig struct {
@@ -30,17 +41,217 @@ type JWTConfig struct {
 	SigningKey string `mapstructure:"signing_key"`
 }
 
+type PublicConfig struct {
+	// BaseURL is the public web address that links in emails point to.
+	BaseURL string `mapstructure:"base_url"`
+	// LinkSigningKey signs tokens in confirmation and other public links,
+	// and the VERP tags of return paths and Reply-To addresses. It must be
+	// at least 32 random bytes.
+	LinkSigningKey string `mapstructure:"link_signing_key"`
+}
+
+type EmailValidationConfig struct {
+	// Optional list files replacing the built-in defaults.
+	DisposableDomainsFile string `mapstructure:"disposable_domains_file"`
+	RoleAddressesFile     string `mapstructure:"role_addresses_file"`
+	// CheckMX rejects addresses whose domain cannot receive mail.
+	CheckMX bool `mapstructure:"check_mx"`
+}
+
+type ExportConfig struct {
+	// Dir is where background export jobs write their files. Downloads
+	// may reach any API server replica, so with several replicas it must
+	// be a volume they all share.
+	Dir string `mapstructure:"dir"`
+	// Retention is how long export files can be downloaded before they
+	// are deleted. Zero selects a default.
+	Retention time.Duration `mapstructure:"retention"`
+}
+
+type AssetsConfig struct {
+	// Dir is where uploaded assets are stored. Empty disables assets.
+	Dir string `mapstructure:"dir"`
+	// PublicURL is the address assets are served at, for example a CDN
+	// in front of the HTTP server's /assets/ path. Defaults to
+	// public.base_url + "/assets".
+	PublicURL string `mapstructure:"public_url"`
+	// MaxSizeBytes limits uploads; zero selects a default.
+	MaxSizeBytes int64 `mapstructure:"max_size_bytes"`
+}
+
+type SMTPConfig struct {
+	Host     string `mapstructure:"host"`
+	Port     int    `mapstructure:"port"`
+	Username string `mapstructure:"username"`
+	Password string `mapstructure:"password"`
+	// TLS is "starttls" (the default), "implicit" or "none".
+	TLS string `mapstructure:"tls"`
+	// LocalName is the host name announced in EHLO.
+	LocalName string `mapstructure:"local_name"`
+	// MaxConns limits concurrent connections; zero selects a default.
+	MaxConns int `mapstructure:"max_conns"`
+}
+
+type DeliveryConfig struct {
+	// Provider is "smtp", "file" or "maildir". Empty only logs
+	// transactional emails.
+	Provider string `mapstructure:"provider"`
+	// Dir is where the file and maildir providers write messages.
+	Dir string `mapstructure:"dir"`
+	// FromEmail and FromName send transactional emails such as
+	// subscription confirmations.
+	FromEmail string     `mapstructure:"from_email"`
+	FromName  string     `mapstructure:"from_name"`
+	SMTP      SMTPConfig `mapstructure:"smtp"`
+}
+
+type SchedulerConfig struct {
+	// PollInterval is how often due campaigns are looked for.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	// LeaseTTL is how long a campaign stays leased to a scheduler that
+	// stopped renewing it, for example because it crashed.
+	LeaseTTL time.Duration `mapstructure:"lease_ttl"`
+	// BatchSize is how many recipients are enqueued per query.
+	BatchSize int `mapstructure:"batch_size"`
+}
+
+type QueueConfig struct {
+	// Backend is "postgres" (the default) or "redis".
+	Backend string `mapstructure:"backend"`
+	// VisibilityTimeout is how long a job stays leased to a worker that
+	// stopped working on it, for example because it crashed.
+	VisibilityTimeout time.Duration `mapstructure:"visibility_timeout"`
+	// MaxAttempts is how often a temporarily failing job is tried before
+	// it is dead-lettered.
+	MaxAttempts int `mapstructure:"max_attempts"`
+	// BaseDelay and MaxDelay bound the exponential backoff between tries.
+	BaseDelay time.Duration `mapstructure:"base_delay"`
+	MaxDelay  time.Duration `mapstructure:"max_delay"`
+	// Concurrency is how many jobs a worker sends at once.
+	Concurrency int `mapstructure:"concurrency"`
+	// PollInterval is how long an idle worker waits between polls.
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+}
+
+type RateConfig struct {
+	// PerSecond is the sustained rate; zero means no limit.
+	PerSecond float64 `mapstructure:"per_second"`
+	// Burst defaults to one second's worth of sends.
+	Burst int `mapstructure:"burst"`
+}
+
+type DomainRateConfig struct {
+	Domain     string `mapstructure:"domain"`
+	RateConfig `mapstructure:",squash"`
+}
+
+type RateLimitConfig struct {
+	// Backend is "memory" (the default), which limits each worker on its
+	// own, or "redis", which shares the limits between workers.
+	Backend string `mapstructure:"backend"`
+	// Domain is the rate per recipient domain, unless Domains overrides
+	// it.
+	Domain  RateConfig         `mapstructure:"domain"`
+	Domains []DomainRateConfig `mapstructure:"domains"`
+	// Provider is the rate of everything sent through the delivery
+	// provider.
+	Provider RateConfig `mapstructure:"provider"`
+	// Account is the rate per workspace.
+	Account RateConfig `mapstructure:"account"`
+}
+
+type DKIMConfig struct {
+	// EncryptionKey is the base64 encoding of the 32-byte key that DKIM
+	// private keys are encrypted with in the database. Empty disables
+	// sending domains and DKIM signing.
+	EncryptionKey string `mapstructure:"encryption_key"`
+	// Selector names the DNS record of generated keys; defaults to "em".
+	Selector string `mapstructure:"selector"`
+	// Algorithm is "rsa-sha256" (the default) or "ed25519-sha256" for
+	// domains created without choosing one.
+	Algorithm string `mapstructure:"algorithm"`
+}
+
+type SendingDomainsConfig struct {
+	// SPFInclude is the domain listing our mail servers, which the SPF
+	// records of sending domains must include. Empty accepts any SPF
+	// record.
+	SPFInclude string `mapstructure:"spf_include"`
+	// RecheckInterval is how often the scheduler checks verified domains
+	// again; UnverifiedRecheckInterval is for the others.
+	RecheckInterval           time.Duration `mapstructure:"recheck_interval"`
+	UnverifiedRecheckInterval time.Duration `mapstructure:"unverified_recheck_interval"`
+	// AllowUnverified lets campaigns be sent from any domain, for
+	// development setups.
+	AllowUnverified bool `mapstructure:"allow_unverified"`
+}
+
+type BouncesConfig struct {
+	// ReturnPath is the address bounces of campaign emails are sent to,
+	// such as "bounces@bounce.example.com". Each email is sent from
+	// "bounces+<tag>@bounce.example.com" so its bounces can be traced
+	// back. Empty keeps the campaign's From address as return path.
+	ReturnPath string `mapstructure:"return_path"`
+	// SoftLimit soft bounces within SoftWindow suppress an address.
+	SoftLimit  int           `mapstructure:"soft_limit"`
+	SoftWindow time.Duration `mapstructure:"soft_window"`
+}
+
+type InboundConfig struct {
+	// Hostname is announced to connecting MTAs; it should match the MX
+	// records of the domains. Empty uses the system hostname.
+	Hostname string `mapstructure:"hostname"`
+	// ReplyAddress is the address replies to campaign emails without a
+	// Reply-To are sent to, such as "reply@reply.example.com", tagged like
+	// the bounces return path. Empty leaves Reply-To unset.
+	ReplyAddress string `mapstructure:"reply_address"`
+	// Domains lists further domains to accept mail for, besides those of
+	// the bounces return path and ReplyAddress.
+	Domains []string `mapstructure:"domains"`
+	// TLSCertFile and TLSKeyFile enable STARTTLS when both are set.
+	TLSCertFile     string `mapstructure:"tls_cert_file"`
+	TLSKeyFile      string `mapstructure:"tls_key_file"`
+	MaxMessageBytes int64  `mapstructure:"max_message_bytes"`
+	// MaxConnections and MaxConnectionsPerIP bound the open connections,
+	// in all and of one client. Zero selects the defaults.
+	MaxConnections      int `mapstructure:"max_connections"`
+	MaxConnectionsPerIP int `mapstructure:"max_connections_per_ip"`
+}
+
+// TrackingConfig selects what campaign emails track. Links in emails sent
+// with tracking keep working when it is turned off.
+type TrackingConfig struct {
+	// Opens adds an open pixel to HTML bodies.
+	Opens bool `mapstructure:"opens"`
+	// Clicks rewrites the links of HTML bodies to the click redirector.
+	Clicks bool `mapstructure:"clicks"`
+}
+
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
 	Format string `mapstructure:"format"`
 }
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Postgres PostgresConfig `mapstructure:"postgres"`
-	Redis    RedisConfig    `mapstructure:"redis"`
-	JWT      JWTConfig      `mapstructure:"jwt"`
-	Logging  LoggingConfig  `mapstructure:"logging"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Postgres  PostgresConfig  `mapstructure:"postgres"`
+	Redis     RedisConfig     `mapstructure:"redis"`
+	JWT       JWTConfig       `mapstructure:"jwt"`
+	Logging   LoggingConfig   `mapstructure:"logging"`
+	Export    ExportConfig    `mapstructure:"export"`
+	Public    PublicConfig    `mapstructure:"public"`
+	Assets    AssetsConfig    `mapstructure:"assets"`
+	Scheduler SchedulerConfig `mapstructure:"scheduler"`
+	Delivery  DeliveryConfig  `mapstructure:"delivery"`
+	Queue     QueueConfig     `mapstructure:"queue"`
+	RateLimit RateLimitConfig `mapstructure:"rate_limit"`
+	DKIM      DKIMConfig      `mapstructure:"dkim"`
+
+	SendingDomains  SendingDomainsConfig  `mapstructure:"sending_domains"`
+	Bounces         BouncesConfig         `mapstructure:"bounces"`
+	Inbound         InboundConfig         `mapstructure:"inbound"`
+	Tracking        TrackingConfig        `mapstructure:"tracking"`
+	EmailValidation EmailValidationConfig `mapstructure:"email_validation"`
 }
 
 // LoadConfig reads config.yaml and environment variables into Config.
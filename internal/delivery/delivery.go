@@ -0,0 +1,107 @@
+// Package delivery hands built messages to a mail transport.
+//
+// Sender is implemented by SMTP, which relays through a mail server, and by
+// FileSink and Maildir, which write messages to disk for local development.
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrClosed is returned by Send after Close.
+var ErrClosed = errors.New("delivery: sender closed")
+
+// Envelope is the SMTP envelope of a message: where bounces go and who
+// receives it, independently of the From and To headers.
+type Envelope struct {
+	// From is the return path. Empty sends with the null sender, as used
+	// for bounces.
+	From string
+	To   []string
+}
+
+func (e Envelope) validate() error {
+	if len(e.To) == 0 {
+		return errors.New("delivery: no recipients")
+	}
+	if e.From != "" {
+		if err := validateAddress(e.From); err != nil {
+			return fmt.Errorf("delivery: return path: %w", err)
+		}
+	}
+	for _, to := range e.To {
+		if err := validateAddress(to); err != nil {
+			return fmt.Errorf("delivery: recipient: %w", err)
+		}
+	}
+	return nil
+}
+
+func validateAddress(addr string) error {
+	local, domain, ok := strings.Cut(addr, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(addr, "\r\n <>") {
+		return fmt.Errorf("invalid address %q", addr)
+	}
+	return nil
+}
+
+// Sender delivers raw RFC 5322 messages. Implementations are safe for
+// concurrent use.
+type Sender interface {
+	// Send delivers msg, whose lines end in CRLF, to the envelope
+	// recipients.
+	Send(ctx context.Context, env Envelope, msg []byte) error
+	// Close releases the sender's resources.
+	Close() error
+}
+
+// SMTPError is a negative reply from a mail server.
+type SMTPError struct {
+	Code int
+	// EnhancedCode is the RFC 3463 status code, such as "5.1.1", if the
+	// server sent one.
+	EnhancedCode string
+	Message      string
+}
+
+func (e *SMTPError) Error() string {
+	if e.EnhancedCode != "" {
+		return fmt.Sprintf("smtp: %d %s %s", e.Code, e.EnhancedCode, e.Message)
+	}
+	return fmt.Sprintf("smtp: %d %s", e.Code, e.Message)
+}
+
+// Temporary reports whether the server asked to try again later (4xx).
+func (e *SMTPError) Temporary() bool {
+	return e.Code >= 400 && e.Code < 500
+}
+
+// Rejection is a recipient the server refused.
+type Rejection struct {
+	Recipient string
+	Err       *SMTPError
+}
+
+// RecipientError reports recipients the server refused. If Delivered is
+// set, the message was accepted for the others.
+type RecipientError struct {
+	Rejected  []Rejection
+	Delivered bool
+}
+
+func (e *RecipientError) Error() string {
+	msgs := make([]string, len(e.Rejected))
+	for i, r := range e.Rejected {
+		msgs[i] = fmt.Sprintf("%s: %v", r.Recipient, r.Err)
+	}
+	return "recipients rejected: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the first rejection, so errors.As finds an *SMTPError for
+// single-recipient messages.
+func (e *RecipientError) Unwrap() error {
+	return e.Rejected[0].Err
+}
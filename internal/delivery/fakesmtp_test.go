@@ -0,0 +1,300 @@
+package delivery_test
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConfig selects the behaviour of a fakeServer.
+type fakeConfig struct {
+	implicitTLS bool
+	startTLS    bool
+	pipelining  bool
+	// auth lists the offered mechanisms; empty disables AUTH.
+	auth     []string
+	username string
+	password string
+	// reject maps recipients to the reply RCPT TO gets for them.
+	reject map[string]string
+	// dropAfter silently closes a connection after that many messages.
+	dropAfter int
+}
+
+type received struct {
+	From string
+	To   []string
+	Data string
+}
+
+// fakeServer is an in-process SMTP server recording what it receives.
+type fakeServer struct {
+	cfg  fakeConfig
+	ln   net.Listener
+	cert *x509.Certificate
+	tls  *tls.Config
+
+	mu        sync.Mutex
+	messages  []received
+	conns     int
+	open      int
+	maxOpen   int
+	pipelined bool
+	mechs     []string
+	tlsUsed   bool
+}
+
+func startFakeServer(t *testing.T, cfg fakeConfig) *fakeServer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake smtp"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		cfg:  cfg,
+		ln:   ln,
+		cert: cert,
+		tls: &tls.Config{Certificates: []tls.Certificate{{
+			Certificate: [][]byte{der},
+			PrivateKey:  key,
+		}}},
+	}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+// port is the listening port.
+func (s *fakeServer) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+// clientTLS trusts the server's certificate.
+func (s *fakeServer) clientTLS() *tls.Config {
+	pool := x509.NewCertPool()
+	pool.AddCert(s.cert)
+	return &tls.Config{RootCAs: pool}
+}
+
+func (s *fakeServer) received() []received {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]received(nil), s.messages...)
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		if s.cfg.implicitTLS {
+			nc = tls.Server(nc, s.tls)
+		}
+		s.mu.Lock()
+		s.conns++
+		s.open++
+		if s.open > s.maxOpen {
+			s.maxOpen = s.open
+		}
+		s.mu.Unlock()
+		go func() {
+			s.handle(nc)
+			nc.Close()
+			s.mu.Lock()
+			s.open--
+			s.mu.Unlock()
+		}()
+	}
+}
+
+func (s *fakeServer) handle(nc net.Conn) {
+	var (
+		br      = bufio.NewReader(nc)
+		r       = textproto.NewReader(br)
+		secure  = s.cfg.implicitTLS
+		authed  = len(s.cfg.auth) == 0
+		from    string
+		to      []string
+		inTx    bool
+		handled int
+	)
+	reply := func(lines ...string) bool {
+		_, err := nc.Write([]byte(strings.Join(lines, "\r\n") + "\r\n"))
+		return err == nil
+	}
+	checkAuth := func(user, pass string, mech string) bool {
+		if user != s.cfg.username || pass != s.cfg.password {
+			return reply("535 5.7.8 Authentication credentials invalid")
+		}
+		authed = true
+		s.mu.Lock()
+		s.mechs = append(s.mechs, mech)
+		s.tlsUsed = s.tlsUsed || secure
+		s.mu.Unlock()
+		return reply("235 2.7.0 Authentication successful")
+	}
+	decode := func(s string) string {
+		b, _ := base64.StdEncoding.DecodeString(s)
+		return string(b)
+	}
+
+	reply("220 fake ESMTP ready")
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		ok := true
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"250-fake greets " + arg, "250-SIZE 10485760", "250-8BITMIME"}
+			if s.cfg.startTLS && !secure {
+				lines = append(lines, "250-STARTTLS")
+			}
+			if len(s.cfg.auth) > 0 {
+				lines = append(lines, "250-AUTH "+strings.Join(s.cfg.auth, " "))
+			}
+			if s.cfg.pipelining {
+				lines = append(lines, "250-PIPELINING")
+			}
+			lines = append(lines, "250 ENHANCEDSTATUSCODES")
+			ok = reply(lines...)
+		case "STARTTLS":
+			if !s.cfg.startTLS || secure {
+				ok = reply("502 5.5.1 Not supported")
+				break
+			}
+			reply("220 2.0.0 Ready to start TLS")
+			tc := tls.Server(nc, s.tls)
+			if tc.Handshake() != nil {
+				return
+			}
+			nc, secure = tc, true
+			br = bufio.NewReader(nc)
+			r = textproto.NewReader(br)
+		case "AUTH":
+			mech, initial, _ := strings.Cut(arg, " ")
+			switch strings.ToUpper(mech) {
+			case "PLAIN":
+				parts := strings.Split(decode(initial), "\x00")
+				if len(parts) != 3 {
+					ok = reply("501 5.5.2 Malformed response")
+					break
+				}
+				ok = checkAuth(parts[1], parts[2], "PLAIN")
+			case "LOGIN":
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+				user, err := r.ReadLine()
+				if err != nil {
+					return
+				}
+				reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+				pass, err := r.ReadLine()
+				if err != nil {
+					return
+				}
+				ok = checkAuth(decode(user), decode(pass), "LOGIN")
+			default:
+				ok = reply("504 5.5.4 Unrecognized authentication type")
+			}
+		case "MAIL":
+			if !authed {
+				ok = reply("530 5.7.0 Authentication required")
+				break
+			}
+			if br.Buffered() > 0 {
+				s.mu.Lock()
+				s.pipelined = true
+				s.mu.Unlock()
+			}
+			from, to, inTx = between(arg), nil, true
+			ok = reply("250 2.1.0 Ok")
+		case "RCPT":
+			if !inTx {
+				ok = reply("503 5.5.1 Need MAIL command")
+				break
+			}
+			addr := between(arg)
+			if rej, found := s.cfg.reject[addr]; found {
+				ok = reply(rej)
+				break
+			}
+			to = append(to, addr)
+			ok = reply("250 2.1.5 Ok")
+		case "DATA":
+			if len(to) == 0 {
+				ok = reply("554 5.5.1 No valid recipients")
+				break
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			data, err := r.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, received{From: from, To: to, Data: string(data)})
+			s.mu.Unlock()
+			inTx, to = false, nil
+			ok = reply("250 2.0.0 Ok: queued")
+			handled++
+			if s.cfg.dropAfter > 0 && handled == s.cfg.dropAfter {
+				return
+			}
+		case "RSET":
+			inTx, to = false, nil
+			ok = reply("250 2.0.0 Ok")
+		case "NOOP":
+			ok = reply("250 2.0.0 Ok")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			ok = reply("502 5.5.2 Command not recognized")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// between returns the address in "FROM:<addr> PARAMS".
+func between(arg string) string {
+	start := strings.IndexByte(arg, '<')
+	end := strings.IndexByte(arg, '>')
+	if start < 0 || end < start {
+		return ""
+	}
+	return arg[start+1 : end]
+}
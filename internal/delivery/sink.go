@@ -0,0 +1,105 @@
+package delivery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// FileSink writes every message to a directory as a .eml file instead of
+// sending it. It is meant for local development.
+type FileSink struct {
+	dir string
+	seq atomic.Uint64
+}
+
+// NewFileSink returns a sink writing to dir, which is created if needed.
+func NewFileSink(dir string) (*FileSink, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("delivery: create sink dir: %w", err)
+	}
+	return &FileSink{dir: dir}, nil
+}
+
+func (s *FileSink) Send(ctx context.Context, env Envelope, msg []byte) error {
+	if err := env.validate(); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%06d.eml", time.Now().UTC().Format("20060102T150405.000000000"), s.seq.Add(1))
+	return writeAtomic(s.dir, filepath.Join(s.dir, name), withEnvelope(env, msg))
+}
+
+func (s *FileSink) Close() error { return nil }
+
+// Maildir delivers every message into a Maildir, so local mail clients can
+// read what would have been sent.
+type Maildir struct {
+	dir  string
+	host string
+	seq  atomic.Uint64
+}
+
+// NewMaildir returns a sink delivering into the Maildir at dir, creating its
+// tmp, new and cur subdirectories if needed.
+func NewMaildir(dir string) (*Maildir, error) {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o700); err != nil {
+			return nil, fmt.Errorf("delivery: create maildir: %w", err)
+		}
+	}
+	host, _ := os.Hostname()
+	// "/" and ":" are not allowed in Maildir file names.
+	host = strings.NewReplacer("/", `\057`, ":", `\072`).Replace(host)
+	return &Maildir{dir: dir, host: host}, nil
+}
+
+// Send writes the message to tmp and moves it to new, as Maildir requires.
+func (m *Maildir) Send(ctx context.Context, env Envelope, msg []byte) error {
+	if err := env.validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	name := fmt.Sprintf("%d.M%dP%dQ%d.%s", now.Unix(), now.Nanosecond()/1000, os.Getpid(), m.seq.Add(1), m.host)
+	return writeAtomic(filepath.Join(m.dir, "tmp"), filepath.Join(m.dir, "new", name), withEnvelope(env, msg))
+}
+
+func (m *Maildir) Close() error { return nil }
+
+// withEnvelope prepends the trace fields a delivery agent adds, so the
+// envelope can be inspected.
+func withEnvelope(env Envelope, msg []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("Return-Path: <" + env.From + ">\r\n")
+	for _, to := range env.To {
+		b.WriteString("Delivered-To: " + to + "\r\n")
+	}
+	b.Write(msg)
+	return b.Bytes()
+}
+
+// writeAtomic writes data to a temporary file in tmpDir and renames it to
+// path, so readers never see partial messages.
+func writeAtomic(tmpDir, path string, data []byte) error {
+	f, err := os.CreateTemp(tmpDir, ".delivery-"+strconv.Itoa(os.Getpid())+"-*")
+	if err != nil {
+		return fmt.Errorf("delivery: %w", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("delivery: write message: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("delivery: write message: %w", err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("delivery: %w", err)
+	}
+	return nil
+}
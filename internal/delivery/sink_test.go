@@ -0,0 +1,56 @@
+package delivery_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/stretchr/testify/assert"
+)
+
+const tracedMessage = "Return-Path: <bounces@example.com>\r\n" +
+	"Delivered-To: ana@example.org\r\n" +
+	testMessage
+
+func TestFileSink(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	sink, err := delivery.NewFileSink(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, send(sink, "ana@example.org")) {
+			return
+		}
+	}
+	assert.Error(t, send(sink))
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if !assert.Len(t, files, 2) {
+		return
+	}
+	assert.Equal(t, ".eml", filepath.Ext(files[0]))
+	data, _ := os.ReadFile(files[0])
+	assert.Equal(t, tracedMessage, string(data))
+}
+
+func TestMaildir(t *testing.T) {
+	dir := t.TempDir()
+	md, err := delivery.NewMaildir(dir)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.NoError(t, send(md, "ana@example.org")) {
+		return
+	}
+
+	delivered, _ := os.ReadDir(filepath.Join(dir, "new"))
+	if !assert.Len(t, delivered, 1) {
+		return
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "new", delivered[0].Name()))
+	assert.Equal(t, tracedMessage, string(data))
+	tmp, _ := os.ReadDir(filepath.Join(dir, "tmp"))
+	assert.Empty(t, tmp)
+}
@@ -0,0 +1,605 @@
+package delivery
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSMode selects how SMTP connections are encrypted.
+type TLSMode string
+
+const (
+	// TLSModeSTARTTLS upgrades a plain connection and fails if the server
+	// does not offer STARTTLS. Usually port 587.
+	TLSModeSTARTTLS TLSMode = "starttls"
+	// TLSModeImplicit encrypts from the first byte. Usually port 465.
+	TLSModeImplicit TLSMode = "implicit"
+	// TLSModeNone never encrypts. Credentials are only sent to loopback
+	// servers.
+	TLSModeNone TLSMode = "none"
+)
+
+const (
+	DefaultSMTPMaxConns    = 4
+	DefaultSMTPMaxMessages = 100
+	DefaultSMTPIdleTimeout = 30 * time.Second
+	DefaultSMTPTimeout     = time.Minute
+)
+
+// SMTPOptions configures an SMTP sender. Zero values select the defaults.
+type SMTPOptions struct {
+	Host string
+	Port int
+	// TLS defaults to TLSModeSTARTTLS.
+	TLS TLSMode
+	// TLSConfig overrides the client TLS configuration. ServerName
+	// defaults to Host.
+	TLSConfig *tls.Config
+	// Username and Password authenticate with AUTH PLAIN, or AUTH LOGIN if
+	// the server does not offer PLAIN. Empty skips authentication.
+	Username string
+	Password string
+	// LocalName is sent in EHLO. Defaults to "localhost".
+	LocalName string
+	// MaxConns limits open connections.
+	MaxConns int
+	// MaxMessages is how many messages are sent over a connection before
+	// it is replaced.
+	MaxMessages int
+	// IdleTimeout closes connections unused for that long.
+	IdleTimeout time.Duration
+	// Timeout bounds every command round trip.
+	Timeout time.Duration
+}
+
+// SMTP sends messages through a mail server over a pool of connections.
+// When the server supports PIPELINING, the envelope commands of a message
+// are sent in one round trip.
+type SMTP struct {
+	opts SMTPOptions
+	addr string
+	// sem holds a token per connection in use. Idle connections were all
+	// put back by a token holder, so the pool never exceeds MaxConns.
+	sem chan struct{}
+
+	mu     sync.Mutex
+	idle   []*smtpConn
+	closed bool
+}
+
+// NewSMTP returns a sender relaying through the server described by opts.
+// Connections are opened on first use.
+func NewSMTP(opts SMTPOptions) *SMTP {
+	if opts.TLS == "" {
+		opts.TLS = TLSModeSTARTTLS
+	}
+	if opts.LocalName == "" {
+		opts.LocalName = "localhost"
+	}
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = DefaultSMTPMaxConns
+	}
+	if opts.MaxMessages <= 0 {
+		opts.MaxMessages = DefaultSMTPMaxMessages
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultSMTPIdleTimeout
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultSMTPTimeout
+	}
+	return &SMTP{
+		opts: opts,
+		addr: net.JoinHostPort(opts.Host, strconv.Itoa(opts.Port)),
+		sem:  make(chan struct{}, opts.MaxConns),
+	}
+}
+
+func (s *SMTP) Send(ctx context.Context, env Envelope, msg []byte) error {
+	if err := env.validate(); err != nil {
+		return err
+	}
+	select {
+	case s.sem <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.sem }()
+
+	c, err := s.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = c.send(ctx, env, msg)
+	if c.reused && errors.Is(err, errStale) {
+		// The server dropped the idle connection; nothing was sent.
+		c.close()
+		if c, err = s.dial(ctx); err != nil {
+			return err
+		}
+		err = c.send(ctx, env, msg)
+	}
+	s.put(c, err)
+	if ctx.Err() != nil && err != nil && !isReply(err) {
+		return ctx.Err()
+	}
+	return err
+}
+
+// Close closes idle connections. Connections in use are closed when their
+// message has been sent.
+func (s *SMTP) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle = nil
+	s.closed = true
+	s.mu.Unlock()
+	for _, c := range idle {
+		c.quit()
+	}
+	return nil
+}
+
+// get returns the most recently used idle connection, or dials one.
+func (s *SMTP) get(ctx context.Context) (*smtpConn, error) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	for len(s.idle) > 0 {
+		c := s.idle[len(s.idle)-1]
+		s.idle = s.idle[:len(s.idle)-1]
+		if time.Since(c.lastUsed) < s.opts.IdleTimeout {
+			s.mu.Unlock()
+			c.reused = true
+			return c, nil
+		}
+		go c.quit()
+	}
+	s.mu.Unlock()
+	return s.dial(ctx)
+}
+
+// put returns c to the pool unless it is broken, worn out or the sender is
+// closed. err is the result of the last send over c.
+func (s *SMTP) put(c *smtpConn, err error) {
+	if err != nil && !isReply(err) {
+		c.close()
+		return
+	}
+	if c.messages >= s.opts.MaxMessages {
+		c.quit()
+		return
+	}
+	if err != nil {
+		// Abort the failed transaction before reusing the connection.
+		c.nc.SetDeadline(time.Now().Add(s.opts.Timeout))
+		if c.cmd("RSET", 250) != nil {
+			c.close()
+			return
+		}
+	}
+	c.lastUsed = time.Now()
+	c.reused = false
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		go c.quit()
+		return
+	}
+	s.idle = append(s.idle, c)
+}
+
+// isReply reports whether err is a well-formed negative reply, after which
+// the connection is still usable.
+func isReply(err error) bool {
+	var se *SMTPError
+	return errors.As(err, &se) && se.Code != 421
+}
+
+// errStale marks failures of the first command on a connection that may
+// have been closed by the server while idle.
+var errStale = errors.New("smtp: connection closed by server")
+
+type smtpConn struct {
+	opts     *SMTPOptions
+	nc       net.Conn
+	r        *textproto.Reader
+	w        *bufio.Writer
+	ext      map[string]string
+	tls      bool
+	messages int
+	lastUsed time.Time
+	reused   bool
+}
+
+func (s *SMTP) dial(ctx context.Context) (*smtpConn, error) {
+	tlsConfig := s.opts.TLSConfig.Clone()
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = s.opts.Host
+	}
+
+	d := net.Dialer{Timeout: s.opts.Timeout}
+	var (
+		nc  net.Conn
+		err error
+	)
+	if s.opts.TLS == TLSModeImplicit {
+		td := tls.Dialer{NetDialer: &d, Config: tlsConfig}
+		nc, err = td.DialContext(ctx, "tcp", s.addr)
+	} else {
+		nc, err = d.DialContext(ctx, "tcp", s.addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("smtp: dial %s: %w", s.addr, err)
+	}
+	c := &smtpConn{opts: &s.opts, tls: s.opts.TLS == TLSModeImplicit}
+	c.attach(nc)
+	if err := c.handshake(ctx, tlsConfig); err != nil {
+		c.close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *smtpConn) attach(nc net.Conn) {
+	c.nc = nc
+	c.r = textproto.NewReader(bufio.NewReader(nc))
+	c.w = bufio.NewWriter(nc)
+}
+
+// handshake reads the greeting, says EHLO, upgrades to TLS and
+// authenticates as configured.
+func (c *smtpConn) handshake(ctx context.Context, tlsConfig *tls.Config) error {
+	defer c.watch(ctx)()
+	if _, err := c.expect(220); err != nil {
+		return err
+	}
+	if err := c.hello(); err != nil {
+		return err
+	}
+	if c.opts.TLS == TLSModeSTARTTLS {
+		if _, ok := c.ext["STARTTLS"]; !ok {
+			return errors.New("smtp: server does not support STARTTLS")
+		}
+		if err := c.cmd("STARTTLS", 220); err != nil {
+			return err
+		}
+		tc := tls.Client(c.nc, tlsConfig)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("smtp: starttls: %w", err)
+		}
+		c.attach(tc)
+		c.tls = true
+		// Capabilities must be discarded after STARTTLS (RFC 3207 4.2).
+		if err := c.hello(); err != nil {
+			return err
+		}
+	}
+	if c.opts.Username != "" {
+		return c.auth()
+	}
+	return nil
+}
+
+func (c *smtpConn) hello() error {
+	if err := c.write("EHLO " + c.opts.LocalName); err != nil {
+		return err
+	}
+	lines, err := c.expect(250)
+	if err != nil {
+		if !isReply(err) {
+			return err
+		}
+		// Servers without ESMTP support get HELO and no extensions.
+		c.ext = map[string]string{}
+		return c.cmd("HELO "+c.opts.LocalName, 250)
+	}
+	c.ext = make(map[string]string)
+	for _, line := range lines[1:] {
+		k, v, _ := strings.Cut(line, " ")
+		c.ext[strings.ToUpper(k)] = v
+	}
+	return nil
+}
+
+func (c *smtpConn) auth() error {
+	if !c.tls && !isLoopback(c.opts.Host) {
+		return errors.New("smtp: refusing to authenticate over an unencrypted connection")
+	}
+	mechs := strings.Fields(strings.ToUpper(c.ext["AUTH"]))
+	has := func(m string) bool {
+		for _, x := range mechs {
+			if x == m {
+				return true
+			}
+		}
+		return false
+	}
+	enc := base64.StdEncoding.EncodeToString
+	switch {
+	case has("PLAIN"):
+		resp := enc([]byte("\x00" + c.opts.Username + "\x00" + c.opts.Password))
+		return c.cmd("AUTH PLAIN "+resp, 235)
+	case has("LOGIN"):
+		// The prompts are "Username:" and "Password:", in that order.
+		if err := c.cmd("AUTH LOGIN", 334); err != nil {
+			return err
+		}
+		if err := c.cmd(enc([]byte(c.opts.Username)), 334); err != nil {
+			return err
+		}
+		return c.cmd(enc([]byte(c.opts.Password)), 235)
+	}
+	return fmt.Errorf("smtp: no supported AUTH mechanism in %q", c.ext["AUTH"])
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// send runs one mail transaction.
+func (c *smtpConn) send(ctx context.Context, env Envelope, msg []byte) error {
+	defer c.watch(ctx)()
+
+	mailCmd := "MAIL FROM:<" + env.From + ">"
+	if _, ok := c.ext["SIZE"]; ok {
+		mailCmd += " SIZE=" + strconv.Itoa(len(msg))
+	}
+	if !isASCII(env.From + strings.Join(env.To, "")) {
+		if _, ok := c.ext["SMTPUTF8"]; !ok {
+			return errors.New("smtp: server does not support internationalized addresses")
+		}
+		mailCmd += " SMTPUTF8"
+	}
+	if _, ok := c.ext["8BITMIME"]; ok && !isASCII(string(msg)) {
+		mailCmd += " BODY=8BITMIME"
+	}
+
+	_, pipelining := c.ext["PIPELINING"]
+	var (
+		mailErr  error
+		rejected []Rejection
+		dataErr  error
+	)
+	if pipelining {
+		// Every command is sent before any reply is read (RFC 2920).
+		cmds := []string{mailCmd}
+		for _, to := range env.To {
+			cmds = append(cmds, "RCPT TO:<"+to+">")
+		}
+		cmds = append(cmds, "DATA")
+		if err := c.write(cmds...); err != nil {
+			return stale(err)
+		}
+		if _, err := c.expect(250); err != nil {
+			if !isReply(err) {
+				return stale(err)
+			}
+			mailErr = err
+		}
+		for _, to := range env.To {
+			if _, err := c.expect(250, 251); err != nil {
+				if !isReply(err) {
+					return err
+				}
+				rejected = append(rejected, Rejection{Recipient: to, Err: err.(*SMTPError)})
+			}
+		}
+		_, dataErr = c.expect(354)
+	} else {
+		if err := c.write(mailCmd); err != nil {
+			return stale(err)
+		}
+		if _, err := c.expect(250); err != nil {
+			return stale(err)
+		}
+		for _, to := range env.To {
+			if err := c.cmd("RCPT TO:<"+to+">", 250, 251); err != nil {
+				if !isReply(err) {
+					return err
+				}
+				rejected = append(rejected, Rejection{Recipient: to, Err: err.(*SMTPError)})
+			}
+		}
+		if len(rejected) == len(env.To) {
+			return &RecipientError{Rejected: rejected}
+		}
+		dataErr = c.cmd("DATA", 354)
+	}
+
+	if dataErr != nil {
+		if mailErr != nil {
+			return mailErr
+		}
+		if len(rejected) > 0 {
+			return &RecipientError{Rejected: rejected}
+		}
+		return dataErr
+	}
+	if mailErr != nil || len(rejected) == len(env.To) {
+		// The server accepted DATA without recipients; end it empty.
+		if err := c.write("."); err != nil {
+			return err
+		}
+		c.expect(250)
+		if mailErr != nil {
+			return mailErr
+		}
+		return &RecipientError{Rejected: rejected}
+	}
+
+	dw := textproto.NewWriter(c.w).DotWriter()
+	if _, err := dw.Write(msg); err != nil {
+		return fmt.Errorf("smtp: write message: %w", err)
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("smtp: write message: %w", err)
+	}
+	if _, err := c.expect(250); err != nil {
+		return err
+	}
+	c.messages++
+	if len(rejected) > 0 {
+		return &RecipientError{Rejected: rejected, Delivered: true}
+	}
+	return nil
+}
+
+// stale marks err as retryable on a fresh connection if it is a transport
+// failure or a 421 closing the connection.
+func stale(err error) error {
+	if isReply(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errStale, err)
+}
+
+// watch applies ctx and the command timeout to the connection until the
+// returned function is called.
+func (c *smtpConn) watch(ctx context.Context) func() {
+	deadline := time.Now().Add(c.opts.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.nc.SetDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() { c.nc.SetDeadline(time.Now()) })
+	return func() { stop() }
+}
+
+// cmd sends a command and reads its reply.
+func (c *smtpConn) cmd(line string, codes ...int) error {
+	if err := c.write(line); err != nil {
+		return err
+	}
+	_, err := c.expect(codes...)
+	return err
+}
+
+func (c *smtpConn) write(lines ...string) error {
+	for _, l := range lines {
+		c.w.WriteString(l)
+		c.w.WriteString("\r\n")
+	}
+	if err := c.w.Flush(); err != nil {
+		return fmt.Errorf("smtp: write: %w", err)
+	}
+	return nil
+}
+
+// expect reads a reply and returns its lines if its code is one of codes,
+// or an *SMTPError otherwise.
+func (c *smtpConn) expect(codes ...int) ([]string, error) {
+	code, lines, err := c.readReply()
+	if err != nil {
+		return nil, err
+	}
+	for _, want := range codes {
+		if code == want {
+			return lines, nil
+		}
+	}
+	return nil, replyError(code, lines)
+}
+
+func (c *smtpConn) readReply() (int, []string, error) {
+	var (
+		code  int
+		lines []string
+	)
+	for {
+		line, err := c.r.ReadLine()
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, nil, fmt.Errorf("smtp: read reply: %w", err)
+		}
+		if len(line) < 3 || (len(line) > 3 && line[3] != ' ' && line[3] != '-') {
+			return 0, nil, fmt.Errorf("smtp: malformed reply %q", line)
+		}
+		n, err := strconv.Atoi(line[:3])
+		if err != nil || n < 200 || (code != 0 && n != code) {
+			return 0, nil, fmt.Errorf("smtp: malformed reply %q", line)
+		}
+		code = n
+		if len(line) == 3 {
+			lines = append(lines, "")
+			return code, lines, nil
+		}
+		lines = append(lines, line[4:])
+		if line[3] == ' ' {
+			return code, lines, nil
+		}
+	}
+}
+
+// replyError converts a negative reply, splitting off an RFC 3463
+// enhanced status code.
+func replyError(code int, lines []string) *SMTPError {
+	e := &SMTPError{Code: code}
+	for i, l := range lines {
+		if enh, rest, ok := strings.Cut(l, " "); ok && isEnhancedCode(enh, code) {
+			if i == 0 {
+				e.EnhancedCode = enh
+			}
+			l = rest
+		}
+		if e.Message != "" {
+			e.Message += " "
+		}
+		e.Message += l
+	}
+	return e
+}
+
+func isEnhancedCode(s string, code int) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 || len(parts[0]) != 1 || parts[0][0] != byte('0'+code/100) {
+		return false
+	}
+	for _, p := range parts {
+		if _, err := strconv.Atoi(p); err != nil || len(p) > 3 {
+			return false
+		}
+	}
+	return true
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *smtpConn) quit() {
+	c.nc.SetDeadline(time.Now().Add(5 * time.Second))
+	c.cmd("QUIT", 221)
+	c.close()
+}
+
+func (c *smtpConn) close() {
+	c.nc.Close()
+}
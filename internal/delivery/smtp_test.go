@@ -0,0 +1,215 @@
+package delivery_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/stretchr/testify/assert"
+)
+
+const testMessage = "From: <news@example.com>\r\n" +
+	"To: <ana@example.org>\r\n" +
+	"Subject: Hello\r\n" +
+	"\r\n" +
+	"First line\r\n" +
+	".leading dot\r\n" +
+	"Last line\r\n"
+
+func newSMTP(s *fakeServer, opts delivery.SMTPOptions) *delivery.SMTP {
+	opts.Host = "127.0.0.1"
+	opts.Port = s.port()
+	opts.TLSConfig = s.clientTLS()
+	return delivery.NewSMTP(opts)
+}
+
+func send(sender delivery.Sender, to ...string) error {
+	return sender.Send(context.Background(), delivery.Envelope{From: "bounces@example.com", To: to}, []byte(testMessage))
+}
+
+func TestSMTP_STARTTLSWithAuthPlainAndPipelining(t *testing.T) {
+	srv := startFakeServer(t, fakeConfig{
+		startTLS:   true,
+		pipelining: true,
+		auth:       []string{"LOGIN", "PLAIN"},
+		username:   "user",
+		password:   "secret",
+	})
+	sender := newSMTP(srv, delivery.SMTPOptions{Username: "user", Password: "secret"})
+	defer sender.Close()
+
+	if !assert.NoError(t, send(sender, "ana@example.org", "bo@example.org")) {
+		return
+	}
+	msgs := srv.received()
+	if !assert.Len(t, msgs, 1) {
+		return
+	}
+	assert.Equal(t, "bounces@example.com", msgs[0].From)
+	assert.Equal(t, []string{"ana@example.org", "bo@example.org"}, msgs[0].To)
+	// Dot-stuffing is undone by the server.
+	assert.Equal(t, "From: <news@example.com>\nTo: <ana@example.org>\nSubject: Hello\n\nFirst line\n.leading dot\nLast line\n", msgs[0].Data)
+	assert.Equal(t, []string{"PLAIN"}, srv.mechs)
+	assert.True(t, srv.tlsUsed)
+	assert.True(t, srv.pipelined)
+}
+
+func TestSMTP_ImplicitTLSWithAuthLogin(t *testing.T) {
+	srv := startFakeServer(t, fakeConfig{
+		implicitTLS: true,
+		auth:        []string{"LOGIN"},
+		username:    "user",
+		password:    "secret",
+	})
+	sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeImplicit, Username: "user", Password: "secret"})
+	defer sender.Close()
+
+	if !assert.NoError(t, send(sender, "ana@example.org")) {
+		return
+	}
+	assert.Len(t, srv.received(), 1)
+	assert.Equal(t, []string{"LOGIN"}, srv.mechs)
+	assert.True(t, srv.tlsUsed)
+	assert.False(t, srv.pipelined)
+}
+
+func TestSMTP_Failures(t *testing.T) {
+	t.Run("STARTTLS required", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{})
+		sender := newSMTP(srv, delivery.SMTPOptions{})
+		defer sender.Close()
+
+		err := send(sender, "ana@example.org")
+		assert.ErrorContains(t, err, "does not support STARTTLS")
+		assert.Empty(t, srv.received())
+	})
+
+	t.Run("bad credentials", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{startTLS: true, auth: []string{"PLAIN"}, username: "user", password: "secret"})
+		sender := newSMTP(srv, delivery.SMTPOptions{Username: "user", Password: "wrong"})
+		defer sender.Close()
+
+		var se *delivery.SMTPError
+		if assert.ErrorAs(t, send(sender, "ana@example.org"), &se) {
+			assert.Equal(t, 535, se.Code)
+			assert.Equal(t, "5.7.8", se.EnhancedCode)
+		}
+	})
+
+	t.Run("invalid envelope", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{})
+		sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeNone})
+		defer sender.Close()
+
+		assert.Error(t, send(sender))
+		assert.Error(t, send(sender, "ana@example.org>\r\nRCPT TO:<eve@example.org"))
+		assert.Equal(t, 0, srv.conns)
+	})
+}
+
+func TestSMTP_RejectedRecipients(t *testing.T) {
+	for _, pipelining := range []bool{true, false} {
+		t.Run(fmt.Sprintf("pipelining=%v", pipelining), func(t *testing.T) {
+			srv := startFakeServer(t, fakeConfig{
+				pipelining: pipelining,
+				reject: map[string]string{
+					"gone@example.org": "550 5.1.1 User unknown",
+					"full@example.org": "452 4.2.2 Mailbox full",
+				},
+			})
+			sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeNone})
+			defer sender.Close()
+
+			// Some recipients accepted: delivered to them.
+			err := send(sender, "gone@example.org", "ana@example.org")
+			var re *delivery.RecipientError
+			if assert.ErrorAs(t, err, &re) {
+				assert.True(t, re.Delivered)
+				assert.Equal(t, "gone@example.org", re.Rejected[0].Recipient)
+			}
+			var se *delivery.SMTPError
+			if assert.ErrorAs(t, err, &se) {
+				assert.Equal(t, 550, se.Code)
+				assert.Equal(t, "5.1.1", se.EnhancedCode)
+				assert.Equal(t, "User unknown", se.Message)
+				assert.False(t, se.Temporary())
+			}
+
+			// All rejected: nothing delivered, temporary failure.
+			err = send(sender, "full@example.org")
+			if assert.ErrorAs(t, err, &se) {
+				assert.True(t, se.Temporary())
+			}
+			if assert.ErrorAs(t, err, &re) {
+				assert.False(t, re.Delivered)
+			}
+
+			// The connection was reset and is still usable.
+			assert.NoError(t, send(sender, "bo@example.org"))
+			msgs := srv.received()
+			if assert.Len(t, msgs, 2) {
+				assert.Equal(t, []string{"ana@example.org"}, msgs[0].To)
+				assert.Equal(t, []string{"bo@example.org"}, msgs[1].To)
+			}
+			assert.Equal(t, 1, srv.conns)
+		})
+	}
+}
+
+func TestSMTP_Pooling(t *testing.T) {
+	t.Run("reuses connections", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{pipelining: true})
+		sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeNone, MaxMessages: 2})
+		defer sender.Close()
+
+		for i := 0; i < 5; i++ {
+			if !assert.NoError(t, send(sender, "ana@example.org")) {
+				return
+			}
+		}
+		assert.Len(t, srv.received(), 5)
+		assert.Equal(t, 3, srv.conns)
+	})
+
+	t.Run("reconnects when the server dropped an idle connection", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{pipelining: true, dropAfter: 1})
+		sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeNone})
+		defer sender.Close()
+
+		for i := 0; i < 3; i++ {
+			if !assert.NoError(t, send(sender, "ana@example.org")) {
+				return
+			}
+		}
+		assert.Len(t, srv.received(), 3)
+		assert.Equal(t, 3, srv.conns)
+	})
+
+	t.Run("limits concurrent connections", func(t *testing.T) {
+		srv := startFakeServer(t, fakeConfig{pipelining: true})
+		sender := newSMTP(srv, delivery.SMTPOptions{TLS: delivery.TLSModeNone, MaxConns: 2})
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- send(sender, "ana@example.org")
+			}()
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			assert.NoError(t, err)
+		}
+		assert.Len(t, srv.received(), 20)
+		assert.LessOrEqual(t, srv.maxOpen, 2)
+
+		assert.NoError(t, sender.Close())
+		assert.True(t, errors.Is(send(sender, "ana@example.org"), delivery.ErrClosed))
+	})
+}
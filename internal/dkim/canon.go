@@ -0,0 +1,108 @@
+package dkim
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+// Canonicalization is a DKIM canonicalization algorithm.
+type Canonicalization string
+
+const (
+	Simple  Canonicalization = "simple"
+	Relaxed Canonicalization = "relaxed"
+)
+
+// field is a header field as it appears in the message, folding included,
+// without the trailing line break.
+type field struct {
+	name string
+	raw  string
+}
+
+// splitMessage separates the header fields of msg from its body. Lines may
+// end in CRLF or LF.
+func splitMessage(msg []byte) ([]field, []byte, error) {
+	var fields []field
+	rest := msg
+	for {
+		i := bytes.IndexByte(rest, '\n')
+		if i < 0 {
+			return nil, nil, errors.New("dkim: message has no body separator")
+		}
+		line := strings.TrimSuffix(string(rest[:i]), "\r")
+		rest = rest[i+1:]
+		if line == "" {
+			return fields, rest, nil
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(fields) == 0 {
+				return nil, nil, errors.New("dkim: message starts with a continuation line")
+			}
+			fields[len(fields)-1].raw += "\r\n" + line
+			continue
+		}
+		name, _, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, errors.New("dkim: malformed header field")
+		}
+		fields = append(fields, field{name: strings.TrimSpace(name), raw: line})
+	}
+}
+
+// canonHeader canonicalizes one header field, without a line break.
+func canonHeader(c Canonicalization, raw string) string {
+	if c == Simple {
+		return raw
+	}
+	name, value, _ := strings.Cut(raw, ":")
+	value = strings.NewReplacer("\r\n", "", "\n", "").Replace(value)
+	return strings.ToLower(strings.TrimRight(name, " \t")) + ":" + strings.TrimSpace(collapseWSP(value))
+}
+
+// canonBody canonicalizes a message body.
+func canonBody(c Canonicalization, body []byte) []byte {
+	lines := strings.Split(strings.ReplaceAll(string(body), "\r\n", "\n"), "\n")
+	// A body ending in a line break splits into a last empty element.
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if c == Relaxed {
+		for i, l := range lines {
+			lines[i] = strings.TrimRight(collapseWSP(l), " ")
+		}
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		if c == Simple {
+			return []byte("\r\n")
+		}
+		return nil
+	}
+	return []byte(strings.Join(lines, "\r\n") + "\r\n")
+}
+
+// collapseWSP replaces runs of spaces and tabs with a single space.
+func collapseWSP(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+// Package dkim signs and verifies email messages with DomainKeys Identified
+// Mail (RFC 6376).
+//
+// Messages are signed with rsa-sha256 or ed25519-sha256 (RFC 8463) using
+// relaxed/relaxed canonicalization. Verification accepts simple and relaxed
+// canonicalization and looks public keys up in DNS through a Resolver.
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Algorithm is a DKIM signing algorithm.
+type Algorithm string
+
+const (
+	RSASHA256     Algorithm = "rsa-sha256"
+	Ed25519SHA256 Algorithm = "ed25519-sha256"
+)
+
+// RSABits is the size of generated RSA keys.
+const RSABits = 2048
+
+// Resolver looks up DNS TXT records. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// GenerateKey returns a new private key for alg.
+func GenerateKey(alg Algorithm) (crypto.Signer, error) {
+	switch alg {
+	case RSASHA256:
+		return rsa.GenerateKey(rand.Reader, RSABits)
+	case Ed25519SHA256:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("dkim: unsupported algorithm %q", alg)
+}
+
+// AlgorithmOf returns the algorithm a key signs with.
+func AlgorithmOf(key crypto.Signer) (Algorithm, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return RSASHA256, nil
+	case ed25519.PrivateKey:
+		return Ed25519SHA256, nil
+	}
+	return "", fmt.Errorf("dkim: unsupported key type %T", key)
+}
+
+// MarshalPrivateKey encodes key as PKCS #8 DER.
+func MarshalPrivateKey(key crypto.Signer) ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+// ParsePrivateKey decodes a key encoded by MarshalPrivateKey.
+func ParsePrivateKey(der []byte) (crypto.Signer, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("dkim: parse private key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("dkim: unsupported key type %T", key)
+	}
+	if _, err := AlgorithmOf(signer); err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// RecordName returns the DNS name the public key of selector is published
+// at.
+func RecordName(selector, domain string) string {
+	return selector + "._domainkey." + domain
+}
+
+// TXTRecord returns the DNS TXT record publishing the public key of key.
+func TXTRecord(key crypto.Signer) (string, error) {
+	switch pub := key.Public().(type) {
+	case *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return "", err
+		}
+		return "v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(der), nil
+	case ed25519.PublicKey:
+		return "v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub), nil
+	}
+	return "", fmt.Errorf("dkim: unsupported key type %T", key)
+}
+
+// RecordKey returns the public key data, the p= tag, of a DKIM key
+// record. It is empty for revoked keys.
+func RecordKey(record string) (string, error) {
+	tags, err := parseTags(record)
+	if err != nil {
+		return "", err
+	}
+	if v := tags["v"]; v != "" && v != "DKIM1" {
+		return "", fmt.Errorf("dkim: unsupported key record version %q", v)
+	}
+	return tags["p"], nil
+}
+
+// parseTags parses a tag=value list such as a DKIM-Signature or a key
+// record. Whitespace is removed from values.
+func parseTags(s string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, part := range strings.Split(s, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, errors.New("dkim: malformed tag list")
+		}
+		name = strings.TrimSpace(name)
+		if _, dup := tags[name]; dup {
+			return nil, fmt.Errorf("dkim: duplicate tag %q", name)
+		}
+		tags[name] = strings.Join(strings.FieldsFunc(value, isFWS), "")
+	}
+	return tags, nil
+}
+
+func isFWS(r rune) bool {
+	return r == ' ' || r == '\t' || r == '\r' || r == '\n'
+}
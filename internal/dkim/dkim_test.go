@@ -0,0 +1,176 @@
+package dkim_test
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubResolver answers TXT lookups from a map.
+type stubResolver map[string][]string
+
+func (r stubResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	txt, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("lookup %s: no such host", name)
+	}
+	return txt, nil
+}
+
+const message = "From: Acme <news@acme.com>\r\n" +
+	"To: <ana@example.org>\r\n" +
+	"Subject: We launched\r\n" +
+	"Date: Sun, 01 Mar 2026 12:00:00 +0000\r\n" +
+	"Message-ID: <1@acme.com>\r\n" +
+	"X-Mailer: test\r\n" +
+	"\r\n" +
+	"Hello  Ana,\r\n" +
+	"\r\n" +
+	"We launched.\r\n"
+
+func newSigner(t *testing.T, alg dkim.Algorithm) (*dkim.Signer, stubResolver) {
+	key, err := dkim.GenerateKey(alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := dkim.NewSigner("acme.com", "s1", key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txt, err := dkim.TXTRecord(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Long records are published as several strings.
+	return signer, stubResolver{"s1._domainkey.acme.com": {txt[:40], txt[40:]}}
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, alg := range []dkim.Algorithm{dkim.RSASHA256, dkim.Ed25519SHA256} {
+		t.Run(string(alg), func(t *testing.T) {
+			signer, resolver := newSigner(t, alg)
+			signed, err := signer.Sign([]byte(message))
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.True(t, strings.HasPrefix(string(signed), "DKIM-Signature: v=1; a="+string(alg)+"; c=relaxed/relaxed; d=acme.com; s=s1;"))
+			assert.True(t, strings.HasSuffix(string(signed), message))
+
+			vs, err := dkim.Verify(context.Background(), resolver, signed)
+			if !assert.NoError(t, err) {
+				return
+			}
+			if assert.Len(t, vs, 1) {
+				assert.Equal(t, "acme.com", vs[0].Domain)
+				assert.Equal(t, alg, vs[0].Algorithm)
+				assert.Equal(t, []string{"from", "subject", "date", "to", "message-id"}, vs[0].Headers)
+			}
+		})
+	}
+}
+
+func TestVerify_RelaxedSurvivesWhitespaceChanges(t *testing.T) {
+	signer, resolver := newSigner(t, dkim.RSASHA256)
+	signed, err := signer.Sign([]byte(message))
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Relays may refold headers, change whitespace, trim trailing blank
+	// lines and add unsigned fields.
+	mangled := strings.NewReplacer(
+		"Subject: We launched\r\n", "subject:  We\r\n\t launched \r\n",
+		"Hello  Ana,", "Hello \t Ana,  ",
+	).Replace(string(signed))
+	mangled = strings.Replace(mangled, "X-Mailer: test\r\n", "X-Mailer: test\r\nReceived: by relay\r\n", 1)
+	mangled += "\r\n\r\n"
+
+	_, err = dkim.Verify(context.Background(), resolver, []byte(mangled))
+	assert.NoError(t, err)
+}
+
+func TestVerify_Failures(t *testing.T) {
+	signer, resolver := newSigner(t, dkim.Ed25519SHA256)
+	signed, err := signer.Sign([]byte(message))
+	if !assert.NoError(t, err) {
+		return
+	}
+	verify := func(msg string, r dkim.Resolver) error {
+		_, err := dkim.Verify(context.Background(), r, []byte(msg))
+		return err
+	}
+
+	assert.Equal(t, dkim.ErrNoSignature, verify(message, resolver))
+	assert.ErrorContains(t, verify(strings.Replace(string(signed), "We launched.", "We launched!", 1), resolver), "body hash")
+	assert.ErrorContains(t, verify(strings.Replace(string(signed), "Subject: We launched", "Subject: You won", 1), resolver), "does not verify")
+	// A From field added below the signed one is selected instead, so the
+	// signature breaks.
+	assert.ErrorContains(t, verify(strings.Replace(string(signed), "\r\n\r\n", "\r\nFrom: <eve@evil.example>\r\n\r\n", 1), resolver), "does not verify")
+
+	_, other := newSigner(t, dkim.Ed25519SHA256)
+	assert.ErrorContains(t, verify(string(signed), other), "does not verify")
+	_, rsaKey := newSigner(t, dkim.RSASHA256)
+	assert.ErrorContains(t, verify(string(signed), rsaKey), "does not match")
+	assert.ErrorContains(t, verify(string(signed), stubResolver{}), "look up key")
+	assert.ErrorContains(t, verify(string(signed), stubResolver{"s1._domainkey.acme.com": {"v=DKIM1; k=ed25519; p="}}), "revoked")
+}
+
+// TestVerify_RFC8463 checks the ed25519-sha256 example of RFC 8463,
+// appendix A.
+func TestVerify_RFC8463(t *testing.T) {
+	msg := strings.ReplaceAll(`DKIM-Signature: v=1; a=ed25519-sha256; c=relaxed/relaxed;
+ d=football.example.com; i=@football.example.com;
+ q=dns/txt; s=brisbane; t=1528637909; h=from : to :
+ subject : date : message-id : from : subject : date;
+ bh=2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8=;
+ b=/gCrinpcQOoIfuHNQIbq4pgh9kyIK3AQUdt9OdqQehSwhEIug4D11Bus
+ Fa3bT3FY5OsU7ZbnKELq+eXdp1Q1Dw==
+From: Joe SixPack <joe@football.example.com>
+To: Suzie Q <suzie@shopping.example.net>
+Subject: Is dinner ready?
+Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)
+Message-ID: <20030712040037.46341.5F8J@football.example.com>
+
+Hi.
+
+We lost the game.  Are you hungry yet?
+
+Joe.
+`, "\n", "\r\n")
+	resolver := stubResolver{"brisbane._domainkey.football.example.com": {
+		"v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo=",
+	}}
+
+	vs, err := dkim.Verify(context.Background(), resolver, []byte(msg))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, vs, 1) {
+		assert.Equal(t, "football.example.com", vs[0].Domain)
+		assert.Equal(t, "brisbane", vs[0].Selector)
+	}
+}
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	for _, alg := range []dkim.Algorithm{dkim.RSASHA256, dkim.Ed25519SHA256} {
+		key, err := dkim.GenerateKey(alg)
+		if !assert.NoError(t, err) {
+			return
+		}
+		der, err := dkim.MarshalPrivateKey(key)
+		if !assert.NoError(t, err) {
+			return
+		}
+		parsed, err := dkim.ParsePrivateKey(der)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, parsed.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()))
+		got, _ := dkim.AlgorithmOf(parsed)
+		assert.Equal(t, alg, got)
+	}
+}
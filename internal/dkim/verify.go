@@ -0,0 +1,200 @@
+package dkim
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSignature is returned by Verify for messages without a
+// DKIM-Signature.
+var ErrNoSignature = errors.New("dkim: message is not signed")
+
+// Verification is a valid signature of a message.
+type Verification struct {
+	Domain    string
+	Selector  string
+	Algorithm Algorithm
+	// Headers are the signed header fields.
+	Headers []string
+}
+
+// Verify checks the DKIM signatures of msg and returns the valid ones. It
+// fails if there is none, with the error of the first invalid signature.
+func Verify(ctx context.Context, r Resolver, msg []byte) ([]*Verification, error) {
+	fields, body, err := splitMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		valid    []*Verification
+		firstErr error
+	)
+	for _, f := range fields {
+		if !strings.EqualFold(f.name, "DKIM-Signature") {
+			continue
+		}
+		v, err := verifySignature(ctx, r, fields, body, f)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		valid = append(valid, v)
+	}
+	if len(valid) > 0 {
+		return valid, nil
+	}
+	if firstErr == nil {
+		firstErr = ErrNoSignature
+	}
+	return nil, firstErr
+}
+
+// bTag matches the value of the b= tag, which is left out when the
+// signature hashes itself.
+var bTag = regexp.MustCompile(`(^|[;:])([ \t\r\n]*b[ \t\r\n]*=)[^;]*`)
+
+func verifySignature(ctx context.Context, r Resolver, fields []field, body []byte, sigField field) (*Verification, error) {
+	_, value, _ := strings.Cut(sigField.raw, ":")
+	tags, err := parseTags(value)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range []string{"v", "a", "b", "bh", "d", "h", "s"} {
+		if tags[t] == "" {
+			return nil, fmt.Errorf("dkim: signature lacks the %s= tag", t)
+		}
+	}
+	if tags["v"] != "1" {
+		return nil, fmt.Errorf("dkim: unsupported signature version %q", tags["v"])
+	}
+	v := &Verification{Domain: strings.ToLower(tags["d"]), Selector: tags["s"], Algorithm: Algorithm(tags["a"])}
+	if v.Algorithm != RSASHA256 && v.Algorithm != Ed25519SHA256 {
+		return nil, fmt.Errorf("dkim: unsupported algorithm %q", v.Algorithm)
+	}
+	headerCanon, bodyCanon := Simple, Simple
+	if c := tags["c"]; c != "" {
+		hc, bc, _ := strings.Cut(c, "/")
+		headerCanon = Canonicalization(hc)
+		if bc != "" {
+			bodyCanon = Canonicalization(bc)
+		}
+	}
+	for _, c := range []Canonicalization{headerCanon, bodyCanon} {
+		if c != Simple && c != Relaxed {
+			return nil, fmt.Errorf("dkim: unsupported canonicalization %q", c)
+		}
+	}
+
+	canonical := canonBody(bodyCanon, body)
+	if l := tags["l"]; l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 || n > len(canonical) {
+			return nil, errors.New("dkim: invalid body length")
+		}
+		canonical = canonical[:n]
+	}
+	bodyHash := sha256.Sum256(canonical)
+	want, err := base64.StdEncoding.DecodeString(tags["bh"])
+	if err != nil || subtle.ConstantTimeCompare(want, bodyHash[:]) != 1 {
+		return nil, errors.New("dkim: body hash does not match")
+	}
+
+	h := sha256.New()
+	used := make(map[string]int)
+	for _, name := range strings.Split(tags["h"], ":") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		v.Headers = append(v.Headers, name)
+		// Each mention selects the next instance from the bottom; names
+		// without one more instance sign its absence.
+		instances := selectFields(fields, name)
+		if i := used[name]; i < len(instances) {
+			h.Write([]byte(canonHeader(headerCanon, instances[i].raw) + "\r\n"))
+		}
+		used[name]++
+	}
+	if used["from"] == 0 {
+		return nil, errors.New("dkim: From is not signed")
+	}
+	unsigned := bTag.ReplaceAllString(sigField.raw, "$1$2")
+	h.Write([]byte(canonHeader(headerCanon, unsigned)))
+	digest := h.Sum(nil)
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return nil, errors.New("dkim: malformed signature")
+	}
+	pub, err := lookupKey(ctx, r, v)
+	if err != nil {
+		return nil, err
+	}
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig)
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, digest, sig) {
+			err = errors.New("invalid signature")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("dkim: signature of %s does not verify: %w", v.Domain, err)
+	}
+	return v, nil
+}
+
+// lookupKey fetches the public key of a signature from DNS.
+func lookupKey(ctx context.Context, r Resolver, v *Verification) (crypto.PublicKey, error) {
+	txts, err := r.LookupTXT(ctx, RecordName(v.Selector, v.Domain))
+	if err != nil {
+		return nil, fmt.Errorf("dkim: look up key: %w", err)
+	}
+	if len(txts) == 0 {
+		return nil, errors.New("dkim: no key record")
+	}
+	// A record split into several strings is one value.
+	tags, err := parseTags(strings.Join(txts, ""))
+	if err != nil {
+		return nil, err
+	}
+	if ver := tags["v"]; ver != "" && ver != "DKIM1" {
+		return nil, fmt.Errorf("dkim: unsupported key record version %q", ver)
+	}
+	if tags["p"] == "" {
+		return nil, errors.New("dkim: key has been revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(tags["p"])
+	if err != nil {
+		return nil, errors.New("dkim: malformed key record")
+	}
+	k := tags["k"]
+	if k == "" {
+		k = "rsa"
+	}
+	switch {
+	case k == "rsa" && v.Algorithm == RSASHA256:
+		pub, err := x509.ParsePKIXPublicKey(der)
+		if err != nil {
+			return nil, fmt.Errorf("dkim: parse key: %w", err)
+		}
+		if rsaPub, ok := pub.(*rsa.PublicKey); ok {
+			return rsaPub, nil
+		}
+	case k == "ed25519" && v.Algorithm == Ed25519SHA256:
+		if len(der) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(der), nil
+		}
+	}
+	return nil, fmt.Errorf("dkim: key type %q does not match algorithm %s", k, v.Algorithm)
+}
@@ -0,0 +1,279 @@
+// Package domaincheck verifies the DNS setup of sending domains.
+//
+// A domain passes when it publishes its ownership token, an SPF record
+// that authorises our mail servers, the DKIM key we sign with and a DMARC
+// policy. Receivers increasingly reject bulk mail from domains missing any
+// of these.
+package domaincheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"golang.org/x/net/publicsuffix"
+)
+
+// OwnershipPrefix starts the TXT record proving ownership of a domain; the
+// verification token follows it.
+const OwnershipPrefix = "email-marketing-verification="
+
+// maxSPFLookups is the limit RFC 7208 puts on DNS lookups while
+// evaluating an SPF record.
+const maxSPFLookups = 10
+
+// Resolver looks up DNS records. *net.Resolver satisfies it. Records that
+// do not exist are reported as a *net.DNSError with IsNotFound set.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+	LookupCNAME(ctx context.Context, host string) (string, error)
+}
+
+// Checker checks the DNS records of sending domains.
+type Checker struct {
+	r          Resolver
+	spfInclude string
+}
+
+// New returns a Checker. SPF records have to include spfInclude, the
+// domain listing our mail servers; if it is empty any SPF record passes.
+func New(r Resolver, spfInclude string) *Checker {
+	return &Checker{r: r, spfInclude: strings.ToLower(strings.TrimSuffix(spfInclude, "."))}
+}
+
+// SPFInclude returns the domain SPF records have to include.
+func (c *Checker) SPFInclude() string {
+	return c.spfInclude
+}
+
+// OwnershipRecord returns the TXT record to publish at d to prove
+// ownership.
+func OwnershipRecord(d *model.SendingDomain) string {
+	return OwnershipPrefix + d.VerificationToken
+}
+
+// DMARCRecordName returns the name a domain publishes its DMARC policy at.
+func DMARCRecordName(domain string) string {
+	return "_dmarc." + domain
+}
+
+// Check looks up the records of d. Records that are missing or wrong fail
+// their check; lookups that fail for other reasons, such as a timeout,
+// return an error because they say nothing about the domain.
+func (c *Checker) Check(ctx context.Context, d *model.SendingDomain) (model.DomainChecks, error) {
+	var out model.DomainChecks
+	apex, err := c.txt(ctx, d.Domain)
+	if err != nil {
+		return out, err
+	}
+	out.Ownership = checkOwnership(d, apex)
+	if out.SPF, err = c.checkSPF(ctx, d.Domain, apex); err != nil {
+		return out, err
+	}
+	if out.DKIM, err = c.checkDKIM(ctx, d); err != nil {
+		return out, err
+	}
+	if out.DMARC, err = c.checkDMARC(ctx, d.Domain); err != nil {
+		return out, err
+	}
+	return out, nil
+}
+
+func checkOwnership(d *model.SendingDomain, apex []string) model.DomainCheck {
+	want := OwnershipRecord(d)
+	for _, rec := range apex {
+		if strings.TrimSpace(rec) == want {
+			return model.DomainCheck{OK: true}
+		}
+	}
+	return model.DomainCheck{Detail: fmt.Sprintf("no TXT record %q at %s", want, d.Domain)}
+}
+
+func (c *Checker) checkSPF(ctx context.Context, domain string, apex []string) (model.DomainCheck, error) {
+	records := spfRecords(apex)
+	switch {
+	case len(records) == 0:
+		return model.DomainCheck{Detail: "no SPF record at " + domain}, nil
+	case len(records) > 1:
+		return model.DomainCheck{Detail: "several SPF records at " + domain + "; receivers treat this as an error"}, nil
+	case c.spfInclude == "":
+		return model.DomainCheck{OK: true}, nil
+	}
+	lookups := 0
+	found, err := c.spfIncludes(ctx, records[0], &lookups)
+	if errors.Is(err, errTooManyLookups) {
+		return model.DomainCheck{Detail: fmt.Sprintf("SPF record needs more than %d DNS lookups", maxSPFLookups)}, nil
+	}
+	if err != nil {
+		return model.DomainCheck{}, err
+	}
+	if !found {
+		return model.DomainCheck{Detail: fmt.Sprintf("SPF record does not include %q", c.spfInclude)}, nil
+	}
+	return model.DomainCheck{OK: true}, nil
+}
+
+var errTooManyLookups = errors.New("too many SPF lookups")
+
+// spfIncludes reports whether record authorises our servers through an
+// include, directly or through the records it includes or redirects to.
+func (c *Checker) spfIncludes(ctx context.Context, record string, lookups *int) (bool, error) {
+	for _, term := range strings.Fields(record)[1:] {
+		term = strings.ToLower(term)
+		qualifier := byte('+')
+		if strings.IndexByte("+-~?", term[0]) >= 0 {
+			qualifier, term = term[0], term[1:]
+		}
+		var target string
+		switch name, value := cutMechanism(term); name {
+		case "include":
+			target = strings.TrimSuffix(value, ".")
+			if target == c.spfInclude {
+				// Only a pass qualifier authorises the included servers.
+				return qualifier == '+', nil
+			}
+		case "redirect":
+			target = strings.TrimSuffix(value, ".")
+		case "a", "mx", "ptr", "exists":
+			*lookups++
+			if *lookups > maxSPFLookups {
+				return false, errTooManyLookups
+			}
+		}
+		if target == "" {
+			continue
+		}
+		*lookups++
+		if *lookups > maxSPFLookups {
+			return false, errTooManyLookups
+		}
+		txt, err := c.txt(ctx, target)
+		if err != nil {
+			return false, err
+		}
+		if records := spfRecords(txt); len(records) == 1 {
+			found, err := c.spfIncludes(ctx, records[0], lookups)
+			if found || err != nil {
+				return found, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// cutMechanism splits an SPF term such as "include:example.com" or
+// "mx/24" into its name and value.
+func cutMechanism(term string) (name, value string) {
+	i := strings.IndexAny(term, ":=/")
+	if i < 0 {
+		return term, ""
+	}
+	return term[:i], term[i+1:]
+}
+
+func spfRecords(txt []string) []string {
+	var out []string
+	for _, rec := range txt {
+		rec = strings.TrimSpace(rec)
+		if strings.EqualFold(rec, "v=spf1") || len(rec) > 7 && strings.EqualFold(rec[:7], "v=spf1 ") {
+			out = append(out, rec)
+		}
+	}
+	return out
+}
+
+func (c *Checker) checkDKIM(ctx context.Context, d *model.SendingDomain) (model.DomainCheck, error) {
+	name := dkim.RecordName(d.DKIMSelector, d.Domain)
+	want, err := dkim.RecordKey(d.DKIMRecord)
+	if err != nil {
+		return model.DomainCheck{}, err
+	}
+	records, err := c.txt(ctx, name)
+	if err != nil {
+		return model.DomainCheck{}, err
+	}
+	if len(records) == 0 {
+		detail := "no DKIM record at " + name
+		// Some providers publish keys through a CNAME to their own zone;
+		// point out where it leads.
+		if target, err := c.r.LookupCNAME(ctx, name); err == nil {
+			if target = strings.TrimSuffix(target, "."); target != "" && !strings.EqualFold(target, name) {
+				detail += " (CNAME to " + target + ")"
+			}
+		}
+		return model.DomainCheck{Detail: detail}, nil
+	}
+	for _, rec := range records {
+		if got, err := dkim.RecordKey(rec); err == nil && got == want {
+			return model.DomainCheck{OK: true}, nil
+		}
+	}
+	return model.DomainCheck{Detail: "DKIM record at " + name + " does not match the domain's key"}, nil
+}
+
+func (c *Checker) checkDMARC(ctx context.Context, domain string) (model.DomainCheck, error) {
+	records, err := c.dmarcRecords(ctx, domain)
+	if err != nil {
+		return model.DomainCheck{}, err
+	}
+	inherited := ""
+	// Receivers fall back to the policy of the organizational domain.
+	if org, perr := publicsuffix.EffectiveTLDPlusOne(domain); len(records) == 0 && perr == nil && org != domain {
+		if records, err = c.dmarcRecords(ctx, org); err != nil {
+			return model.DomainCheck{}, err
+		}
+		inherited = " (from " + org + ")"
+	}
+	switch {
+	case len(records) == 0:
+		return model.DomainCheck{Detail: "no DMARC record at " + DMARCRecordName(domain)}, nil
+	case len(records) > 1:
+		return model.DomainCheck{Detail: "several DMARC records" + inherited + "; receivers ignore them"}, nil
+	}
+	policy := ""
+	for _, tag := range strings.Split(records[0], ";") {
+		name, value, _ := strings.Cut(tag, "=")
+		if strings.TrimSpace(name) == "p" {
+			policy = strings.ToLower(strings.TrimSpace(value))
+		}
+	}
+	switch policy {
+	case "none":
+		return model.DomainCheck{OK: true, Detail: "policy none" + inherited + ": receivers take no action on mail failing DMARC"}, nil
+	case "quarantine", "reject":
+		return model.DomainCheck{OK: true, Detail: "policy " + policy + inherited}, nil
+	}
+	return model.DomainCheck{Detail: "DMARC record" + inherited + " has no valid policy"}, nil
+}
+
+func (c *Checker) dmarcRecords(ctx context.Context, domain string) ([]string, error) {
+	txt, err := c.txt(ctx, DMARCRecordName(domain))
+	if err != nil {
+		return nil, err
+	}
+	var out []string
+	for _, rec := range txt {
+		rec = strings.TrimSpace(rec)
+		if v, _, _ := strings.Cut(rec, ";"); strings.EqualFold(strings.ReplaceAll(v, " ", ""), "v=DMARC1") {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// txt returns the TXT records at name, or nil if it has none.
+func (c *Checker) txt(ctx context.Context, name string) ([]string, error) {
+	records, err := c.r.LookupTXT(ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("look up TXT %s: %w", name, err)
+	}
+	return records, nil
+}
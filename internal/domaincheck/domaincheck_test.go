@@ -0,0 +1,154 @@
+package domaincheck_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/domaincheck"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+// zone is an in-memory Resolver. Names missing from it do not exist.
+type zone struct {
+	txt   map[string][]string
+	cname map[string]string
+	// fail makes lookups of these names time out.
+	fail map[string]bool
+}
+
+func (z *zone) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	if z.fail[name] {
+		return nil, &net.DNSError{Err: "i/o timeout", Name: name, IsTimeout: true}
+	}
+	txt, ok := z.txt[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return txt, nil
+}
+
+func (z *zone) LookupCNAME(ctx context.Context, host string) (string, error) {
+	if target, ok := z.cname[host]; ok {
+		return target + ".", nil
+	}
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+const dkimRecord = "v=DKIM1; k=ed25519; p=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+
+func newDomain() *model.SendingDomain {
+	return &model.SendingDomain{
+		Domain:            "news.acme.com",
+		DKIMSelector:      "em",
+		DKIMRecord:        dkimRecord,
+		VerificationToken: "tok",
+	}
+}
+
+// goodZone publishes everything news.acme.com needs, with SPF including
+// our servers through the customer's own include.
+func goodZone() *zone {
+	return &zone{
+		txt: map[string][]string{
+			"news.acme.com": {
+				"google-site-verification=abc",
+				"email-marketing-verification=tok",
+				"v=spf1 ip4:192.0.2.1 include:_spf.acme.com ~all",
+			},
+			"_spf.acme.com":                 {"v=spf1 include:spf.mailer.example -all"},
+			"spf.mailer.example":            {"v=spf1 ip4:198.51.100.0/24 -all"},
+			"em._domainkey.news.acme.com":   {"v=DKIM1; k=ed25519;\tp=11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="},
+			"_dmarc.news.acme.com":          {"v=DMARC1; p=quarantine; rua=mailto:d@acme.com"},
+			"unrelated._domainkey.acme.com": {"v=DKIM1; p="},
+		},
+	}
+}
+
+func TestCheck_Pass(t *testing.T) {
+	c := domaincheck.New(goodZone(), "spf.mailer.example.")
+	checks, err := c.Check(context.Background(), newDomain())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, checks.Passed(), "%+v", checks)
+	assert.Equal(t, "policy quarantine", checks.DMARC.Detail)
+}
+
+func TestCheck_Failures(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name   string
+		change func(z *zone)
+		check  func(c model.DomainChecks) model.DomainCheck
+		detail string
+	}{
+		{"missing token", func(z *zone) { z.txt["news.acme.com"] = z.txt["news.acme.com"][2:] },
+			func(c model.DomainChecks) model.DomainCheck { return c.Ownership },
+			`no TXT record "email-marketing-verification=tok" at news.acme.com`},
+		{"no SPF", func(z *zone) { z.txt["news.acme.com"] = z.txt["news.acme.com"][:2] },
+			func(c model.DomainChecks) model.DomainCheck { return c.SPF }, "no SPF record at news.acme.com"},
+		{"two SPF records", func(z *zone) { z.txt["news.acme.com"] = append(z.txt["news.acme.com"], "v=spf1 -all") },
+			func(c model.DomainChecks) model.DomainCheck { return c.SPF },
+			"several SPF records at news.acme.com; receivers treat this as an error"},
+		{"SPF without include", func(z *zone) { z.txt["_spf.acme.com"] = []string{"v=spf1 mx -all"} },
+			func(c model.DomainChecks) model.DomainCheck { return c.SPF }, `SPF record does not include "spf.mailer.example"`},
+		{"SPF include with fail qualifier", func(z *zone) { z.txt["_spf.acme.com"] = []string{"v=spf1 -include:spf.mailer.example"} },
+			func(c model.DomainChecks) model.DomainCheck { return c.SPF }, `SPF record does not include "spf.mailer.example"`},
+		{"SPF lookup limit", func(z *zone) {
+			z.txt["_spf.acme.com"] = []string{"v=spf1 a mx a:x mx:y exists:z ptr a a a a a include:spf.mailer.example"}
+		}, func(c model.DomainChecks) model.DomainCheck { return c.SPF }, "SPF record needs more than 10 DNS lookups"},
+		{"no DKIM key", func(z *zone) { delete(z.txt, "em._domainkey.news.acme.com") },
+			func(c model.DomainChecks) model.DomainCheck { return c.DKIM }, "no DKIM record at em._domainkey.news.acme.com"},
+		{"DKIM CNAME to nowhere", func(z *zone) {
+			delete(z.txt, "em._domainkey.news.acme.com")
+			z.cname = map[string]string{"em._domainkey.news.acme.com": "em.dkim.provider.example"}
+		}, func(c model.DomainChecks) model.DomainCheck { return c.DKIM },
+			"no DKIM record at em._domainkey.news.acme.com (CNAME to em.dkim.provider.example)"},
+		{"other DKIM key", func(z *zone) { z.txt["em._domainkey.news.acme.com"] = []string{"v=DKIM1; k=ed25519; p=AAAA"} },
+			func(c model.DomainChecks) model.DomainCheck { return c.DKIM },
+			"DKIM record at em._domainkey.news.acme.com does not match the domain's key"},
+		{"no DMARC", func(z *zone) { delete(z.txt, "_dmarc.news.acme.com") },
+			func(c model.DomainChecks) model.DomainCheck { return c.DMARC }, "no DMARC record at _dmarc.news.acme.com"},
+		{"DMARC without policy", func(z *zone) { z.txt["_dmarc.news.acme.com"] = []string{"v=DMARC1; rua=mailto:d@acme.com"} },
+			func(c model.DomainChecks) model.DomainCheck { return c.DMARC }, "DMARC record has no valid policy"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := goodZone()
+			tt.change(z)
+			checks, err := domaincheck.New(z, "spf.mailer.example").Check(ctx, newDomain())
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.False(t, checks.Passed())
+			got := tt.check(checks)
+			assert.False(t, got.OK)
+			assert.Equal(t, tt.detail, got.Detail)
+		})
+	}
+}
+
+func TestCheck_DMARCOfOrganizationalDomain(t *testing.T) {
+	z := goodZone()
+	delete(z.txt, "_dmarc.news.acme.com")
+	z.txt["_dmarc.acme.com"] = []string{"v=DMARC1;p=none"}
+	checks, err := domaincheck.New(z, "").Check(context.Background(), newDomain())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, checks.DMARC.OK)
+	assert.Equal(t, "policy none (from acme.com): receivers take no action on mail failing DMARC", checks.DMARC.Detail)
+	// Without a required include any single SPF record passes.
+	assert.True(t, checks.SPF.OK)
+}
+
+func TestCheck_TemporaryErrors(t *testing.T) {
+	z := goodZone()
+	z.fail = map[string]bool{"_spf.acme.com": true}
+	_, err := domaincheck.New(z, "spf.mailer.example").Check(context.Background(), newDomain())
+	var dnsErr *net.DNSError
+	assert.True(t, errors.As(err, &dnsErr) && dnsErr.IsTimeout)
+}
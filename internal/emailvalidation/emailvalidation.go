@@ -0,0 +1,330 @@
+// Package emailvalidation checks and normalises email addresses.
+//
+// Syntax follows the addr-spec of RFC 5322 without obsolete forms or
+// comments. Internationalised domains are converted to punycode; local parts
+// must be ASCII. Beyond syntax a Validator can reject disposable domains and
+// role addresses and verify that the domain accepts mail.
+package emailvalidation
+
+import (
+	"bufio"
+	"context"
+	"embed"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	maxLocalLength   = 64
+	maxAddressLength = 254
+	maxDomainLength  = 253
+	maxLabelLength   = 63
+)
+
+// Reason classifies why an address was rejected.
+type Reason string
+
+const (
+	ReasonEmpty      Reason = "empty"
+	ReasonSyntax     Reason = "syntax"
+	ReasonTooLong    Reason = "too_long"
+	ReasonDomain     Reason = "invalid_domain"
+	ReasonDisposable Reason = "disposable_domain"
+	ReasonRole       Reason = "role_address"
+	ReasonNoMX       Reason = "no_mail_server"
+	ReasonNullMX     Reason = "domain_rejects_mail"
+)
+
+// Error reports a rejected address. Compare with errors.Is against the
+// Err* values to test for a reason.
+type Error struct {
+	Reason Reason
+	Detail string
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return "invalid email address: " + string(e.Reason)
+	}
+	return fmt.Sprintf("invalid email address: %s: %s", e.Reason, e.Detail)
+}
+
+// Is matches any *Error with the same reason.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Reason == e.Reason
+}
+
+var (
+	ErrEmpty      = &Error{Reason: ReasonEmpty}
+	ErrSyntax     = &Error{Reason: ReasonSyntax}
+	ErrTooLong    = &Error{Reason: ReasonTooLong}
+	ErrDomain     = &Error{Reason: ReasonDomain}
+	ErrDisposable = &Error{Reason: ReasonDisposable}
+	ErrRole       = &Error{Reason: ReasonRole}
+	ErrNoMX       = &Error{Reason: ReasonNoMX}
+	ErrNullMX     = &Error{Reason: ReasonNullMX}
+)
+
+func reject(r Reason, detail string) error {
+	return &Error{Reason: r, Detail: detail}
+}
+
+// Resolver looks up DNS records. *net.Resolver satisfies it.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Set is a set of lower-case strings such as domains or local parts.
+type Set map[string]struct{}
+
+// Options configures a Validator. Nil fields disable the related check.
+type Options struct {
+	DisposableDomains Set
+	RoleAddresses     Set
+	Resolver          Resolver
+}
+
+// Validator applies syntax checks plus the policy checks in its Options.
+type Validator struct {
+	opts Options
+}
+
+// New constructs a Validator.
+func New(opts Options) *Validator {
+	return &Validator{opts: opts}
+}
+
+// Validate returns the normalised form of addr, or an *Error.
+func (v *Validator) Validate(ctx context.Context, addr string) (string, error) {
+	norm, err := Normalize(addr)
+	if err != nil {
+		return "", err
+	}
+	at := strings.LastIndexByte(norm, '@')
+	local, domain := norm[:at], norm[at+1:]
+
+	if v.opts.DisposableDomains != nil && matchDomain(v.opts.DisposableDomains, domain) {
+		return "", reject(ReasonDisposable, domain)
+	}
+	if v.opts.RoleAddresses != nil {
+		base, _, _ := strings.Cut(strings.Trim(local, `"`), "+")
+		if _, ok := v.opts.RoleAddresses[base]; ok {
+			return "", reject(ReasonRole, base)
+		}
+	}
+	if v.opts.Resolver != nil {
+		if err := checkMX(ctx, v.opts.Resolver, domain); err != nil {
+			return "", err
+		}
+	}
+	return norm, nil
+}
+
+// Normalize checks the syntax of addr and returns it lower-cased, with
+// surrounding whitespace removed and an internationalised domain in punycode.
+func Normalize(addr string) (string, error) {
+	addr = strings.TrimSpace(addr)
+	if addr == "" {
+		return "", ErrEmpty
+	}
+
+	at := strings.LastIndexByte(addr, '@')
+	if at <= 0 || at == len(addr)-1 {
+		return "", reject(ReasonSyntax, "missing local part or domain")
+	}
+	local, domain := addr[:at], addr[at+1:]
+
+	if err := checkLocal(local); err != nil {
+		return "", err
+	}
+	asciiDomain, err := normalizeDomain(domain)
+	if err != nil {
+		return "", err
+	}
+
+	norm := strings.ToLower(local) + "@" + asciiDomain
+	if len(norm) > maxAddressLength {
+		return "", reject(ReasonTooLong, "")
+	}
+	return norm, nil
+}
+
+// atext are the characters allowed in a dot-atom besides letters and digits.
+const atextSpecials = "!#$%&'*+-/=?^_`{|}~"
+
+func checkLocal(local string) error {
+	if len(local) > maxLocalLength {
+		return reject(ReasonTooLong, "local part")
+	}
+	if strings.HasPrefix(local, `"`) {
+		return checkQuotedLocal(local)
+	}
+	if strings.HasPrefix(local, ".") || strings.HasSuffix(local, ".") || strings.Contains(local, "..") {
+		return reject(ReasonSyntax, "misplaced dot in local part")
+	}
+	for _, r := range local {
+		switch {
+		case r > 0x7e:
+			return reject(ReasonSyntax, "non-ASCII local part")
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.':
+		case strings.ContainsRune(atextSpecials, r):
+		default:
+			return reject(ReasonSyntax, fmt.Sprintf("character %q in local part", r))
+		}
+	}
+	return nil
+}
+
+func checkQuotedLocal(local string) error {
+	if len(local) < 2 || !strings.HasSuffix(local, `"`) {
+		return reject(ReasonSyntax, "unterminated quoted local part")
+	}
+	body := local[1 : len(local)-1]
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case c == '\\':
+			// quoted-pair: any printable ASCII or space may follow.
+			i++
+			if i == len(body) || body[i] < 0x20 || body[i] > 0x7e {
+				return reject(ReasonSyntax, "invalid escape in quoted local part")
+			}
+		case c == '"':
+			return reject(ReasonSyntax, "unescaped quote in local part")
+		case c < 0x20 || c > 0x7e:
+			return reject(ReasonSyntax, "invalid character in quoted local part")
+		}
+	}
+	return nil
+}
+
+// NormalizeDomain checks the syntax of a domain and returns it lower-cased
+// and in punycode, without a trailing dot.
+func NormalizeDomain(domain string) (string, error) {
+	return normalizeDomain(strings.TrimSpace(domain))
+}
+
+func normalizeDomain(domain string) (string, error) {
+	if strings.HasPrefix(domain, "[") {
+		return "", reject(ReasonDomain, "address literals are not accepted")
+	}
+	ascii, err := idna.Lookup.ToASCII(strings.TrimSuffix(domain, "."))
+	if err != nil {
+		return "", reject(ReasonDomain, err.Error())
+	}
+	ascii = strings.ToLower(ascii)
+	if len(ascii) > maxDomainLength {
+		return "", reject(ReasonTooLong, "domain")
+	}
+	labels := strings.Split(ascii, ".")
+	if len(labels) < 2 {
+		return "", reject(ReasonDomain, "domain must have at least two labels")
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > maxLabelLength || l[0] == '-' || l[len(l)-1] == '-' {
+			return "", reject(ReasonDomain, fmt.Sprintf("invalid label %q", l))
+		}
+		for i := 0; i < len(l); i++ {
+			c := l[i]
+			if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-') {
+				return "", reject(ReasonDomain, fmt.Sprintf("invalid label %q", l))
+			}
+		}
+	}
+	if tld := labels[len(labels)-1]; strings.Trim(tld, "0123456789") == "" {
+		return "", reject(ReasonDomain, "numeric top-level domain")
+	}
+	return ascii, nil
+}
+
+// matchDomain reports whether domain or one of its parents is in set.
+func matchDomain(set Set, domain string) bool {
+	for {
+		if _, ok := set[domain]; ok {
+			return true
+		}
+		i := strings.IndexByte(domain, '.')
+		if i < 0 {
+			return false
+		}
+		domain = domain[i+1:]
+	}
+}
+
+// checkMX verifies that domain can receive mail: it has MX records, or,
+// failing that, an address record acting as implicit MX (RFC 5321 5.1).
+// A single "." MX is a null MX (RFC 7505) and rejects all mail.
+func checkMX(ctx context.Context, r Resolver, domain string) error {
+	mxs, err := r.LookupMX(ctx, domain)
+	if err == nil && len(mxs) > 0 {
+		if len(mxs) == 1 && (mxs[0].Host == "." || mxs[0].Host == "") {
+			return reject(ReasonNullMX, domain)
+		}
+		return nil
+	}
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsTemporary {
+		// Do not reject addresses because of a flaky resolver.
+		return nil
+	}
+	if hosts, err := r.LookupHost(ctx, domain); err == nil && len(hosts) > 0 {
+		return nil
+	}
+	return reject(ReasonNoMX, domain)
+}
+
+// LoadSet reads a newline-separated list from path. Blank lines and lines
+// starting with '#' are ignored; entries are lower-cased.
+func LoadSet(path string) (Set, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readSet(f)
+}
+
+//go:embed data/*.txt
+var data embed.FS
+
+// DefaultDisposableDomains returns the built-in list of disposable domains.
+func DefaultDisposableDomains() Set {
+	return mustEmbedded("data/disposable_domains.txt")
+}
+
+// DefaultRoleAddresses returns the built-in list of role local parts.
+func DefaultRoleAddresses() Set {
+	return mustEmbedded("data/role_addresses.txt")
+}
+
+func mustEmbedded(name string) Set {
+	f, err := data.Open(name)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	s, err := readSet(f)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func readSet(r io.Reader) (Set, error) {
+	s := Set{}
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		s[strings.ToLower(line)] = struct{}{}
+	}
+	return s, sc.Err()
+}
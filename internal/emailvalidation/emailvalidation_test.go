@@ -0,0 +1,151 @@
+package emailvalidation_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"Alice@Example.COM", "alice@example.com"},
+		{"  bob.smith+news@example.co.uk ", "bob.smith+news@example.co.uk"},
+		{"o'neil@example.com", "o'neil@example.com"},
+		{`"john doe"@example.com`, `"john doe"@example.com`},
+		{"user@mail.example.com.", "user@mail.example.com"},
+		{"ali@ایران.ir", "ali@xn--mgba3a4f16a.ir"},
+		{"info@Bücher.example", "info@xn--bcher-kva.example"},
+	}
+	for _, c := range cases {
+		got, err := emailvalidation.Normalize(c.in)
+		assert.NoError(t, err, c.in)
+		assert.Equal(t, c.want, got, c.in)
+	}
+}
+
+func TestNormalize_Rejects(t *testing.T) {
+	cases := []struct {
+		in   string
+		want error
+	}{
+		{"", emailvalidation.ErrEmpty},
+		{"   ", emailvalidation.ErrEmpty},
+		{"plainaddress", emailvalidation.ErrSyntax},
+		{"@example.com", emailvalidation.ErrSyntax},
+		{"user@", emailvalidation.ErrSyntax},
+		{".user@example.com", emailvalidation.ErrSyntax},
+		{"us..er@example.com", emailvalidation.ErrSyntax},
+		{"us er@example.com", emailvalidation.ErrSyntax},
+		{"user(comment)@example.com", emailvalidation.ErrSyntax},
+		{`"unterminated@example.com`, emailvalidation.ErrSyntax},
+		{"علی@example.com", emailvalidation.ErrSyntax},
+		{"user@localhost", emailvalidation.ErrDomain},
+		{"user@-example.com", emailvalidation.ErrDomain},
+		{"user@exa_mple.com", emailvalidation.ErrDomain},
+		{"user@[192.168.0.1]", emailvalidation.ErrDomain},
+		{"user@192.168.0.1", emailvalidation.ErrDomain},
+		{strings.Repeat("a", 65) + "@example.com", emailvalidation.ErrTooLong},
+		{"user@" + strings.Repeat("a", 64) + ".com", emailvalidation.ErrDomain},
+	}
+	for _, c := range cases {
+		_, err := emailvalidation.Normalize(c.in)
+		assert.True(t, errors.Is(err, c.want), "%q: got %v, want %v", c.in, err, c.want)
+	}
+}
+
+func TestValidator_Policy(t *testing.T) {
+	v := emailvalidation.New(emailvalidation.Options{
+		DisposableDomains: emailvalidation.DefaultDisposableDomains(),
+		RoleAddresses:     emailvalidation.DefaultRoleAddresses(),
+	})
+	ctx := context.Background()
+
+	_, err := v.Validate(ctx, "someone@eu.Mailinator.com")
+	assert.ErrorIs(t, err, emailvalidation.ErrDisposable)
+
+	_, err = v.Validate(ctx, "Support+tickets@example.com")
+	assert.ErrorIs(t, err, emailvalidation.ErrRole)
+
+	got, err := v.Validate(ctx, "Sara@Example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, "sara@example.com", got)
+
+	// Without policy lists only syntax is checked.
+	_, err = emailvalidation.New(emailvalidation.Options{}).Validate(ctx, "info@mailinator.com")
+	assert.NoError(t, err)
+}
+
+// stubResolver serves canned DNS answers.
+type stubResolver struct {
+	mx    map[string][]*net.MX
+	hosts map[string][]string
+	err   error
+}
+
+func (r *stubResolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if mx, ok := r.mx[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r *stubResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	if h, ok := r.hosts[host]; ok {
+		return h, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func TestValidator_MX(t *testing.T) {
+	r := &stubResolver{
+		mx: map[string][]*net.MX{
+			"example.com":  {{Host: "mx.example.com.", Pref: 10}},
+			"null.example": {{Host: ".", Pref: 0}},
+		},
+		hosts: map[string][]string{"implicit.example": {"192.0.2.1"}},
+	}
+	v := emailvalidation.New(emailvalidation.Options{Resolver: r})
+	ctx := context.Background()
+
+	_, err := v.Validate(ctx, "a@example.com")
+	assert.NoError(t, err)
+	_, err = v.Validate(ctx, "a@implicit.example")
+	assert.NoError(t, err)
+	_, err = v.Validate(ctx, "a@null.example")
+	assert.ErrorIs(t, err, emailvalidation.ErrNullMX)
+	_, err = v.Validate(ctx, "a@nowhere.example")
+	assert.ErrorIs(t, err, emailvalidation.ErrNoMX)
+
+	// Temporary DNS failures do not reject the address.
+	flaky := emailvalidation.New(emailvalidation.Options{Resolver: &stubResolver{
+		err: &net.DNSError{Err: "timeout", IsTemporary: true},
+	}})
+	_, err = flaky.Validate(ctx, "a@example.com")
+	assert.NoError(t, err)
+}
+
+func TestLoadSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("# comment\n\nExample.ORG\n  spam.test  \n"), 0o600))
+
+	s, err := emailvalidation.LoadSet(path)
+	assert.NoError(t, err)
+	assert.Len(t, s, 2)
+	assert.Contains(t, s, "example.org")
+	assert.Contains(t, s, "spam.test")
+
+	_, err = emailvalidation.LoadSet(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,188 @@
+// Package export encodes contacts as CSV or newline-delimited JSON.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+// customPrefix marks a field as a workspace-defined custom field.
+const customPrefix = "custom."
+
+// StandardFields are the built-in contact fields, in default output order.
+var StandardFields = []string{"id", "email", "first_name", "last_name", "lang", "status", "created_at"}
+
+// Writer encodes contacts to an underlying stream.
+type Writer interface {
+	Write(c *model.Contact) error
+	// Flush writes any buffered data to the underlying io.Writer.
+	Flush() error
+}
+
+// ValidateFields checks that every field is a standard field or a custom field
+// reference. An empty selection is valid and means StandardFields.
+func ValidateFields(fields []string) error {
+	seen := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		if seen[f] {
+			return fmt.Errorf("duplicate field %q", f)
+		}
+		seen[f] = true
+		if strings.HasPrefix(f, customPrefix) {
+			if f == customPrefix {
+				return fmt.Errorf("empty custom field name")
+			}
+			continue
+		}
+		if !isStandard(f) {
+			return fmt.Errorf("unknown field %q", f)
+		}
+	}
+	return nil
+}
+
+// NewWriter returns a Writer for the given format and field selection.
+func NewWriter(format Format, w io.Writer, fields []string) (Writer, error) {
+	if err := ValidateFields(fields); err != nil {
+		return nil, err
+	}
+	if len(fields) == 0 {
+		fields = StandardFields
+	}
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w), fields: fields}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{w: bufio.NewWriter(w), fields: fields}, nil
+	default:
+		return nil, fmt.Errorf("unsupported export format %q", format)
+	}
+}
+
+func isStandard(f string) bool {
+	for _, s := range StandardFields {
+		if s == f {
+			return true
+		}
+	}
+	return false
+}
+
+func standardValue(c *model.Contact, field string) string {
+	switch field {
+	case "id":
+		return c.ID.String()
+	case "email":
+		return c.Email
+	case "first_name":
+		return c.FirstName
+	case "last_name":
+		return c.LastName
+	case "lang":
+		return c.Lang.String()
+	case "status":
+		return string(c.Status)
+	case "created_at":
+		return c.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+type csvWriter struct {
+	w           *csv.Writer
+	fields      []string
+	wroteHeader bool
+}
+
+func (cw *csvWriter) Write(c *model.Contact) error {
+	if !cw.wroteHeader {
+		if err := cw.w.Write(cw.fields); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+	record := make([]string, len(cw.fields))
+	for i, f := range cw.fields {
+		if strings.HasPrefix(f, customPrefix) {
+			record[i] = sanitizeCell(c.CustomFields[strings.TrimPrefix(f, customPrefix)])
+		} else {
+			record[i] = sanitizeCell(standardValue(c, f))
+		}
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Flush() error {
+	// An empty export still gets a header so spreadsheets show the columns.
+	if !cw.wroteHeader {
+		if err := cw.w.Write(cw.fields); err != nil {
+			return err
+		}
+		cw.wroteHeader = true
+	}
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+// sanitizeCell neutralises values that spreadsheet applications would
+// otherwise evaluate as formulas.
+func sanitizeCell(v string) string {
+	if v == "" {
+		return v
+	}
+	switch v[0] {
+	case '=', '+', '-', '@', '\t', '\r':
+		return "'" + v
+	}
+	return v
+}
+
+type ndjsonWriter struct {
+	w      *bufio.Writer
+	fields []string
+}
+
+func (nw *ndjsonWriter) Write(c *model.Contact) error {
+	obj := make(map[string]interface{}, len(nw.fields))
+	var custom map[string]string
+	for _, f := range nw.fields {
+		if strings.HasPrefix(f, customPrefix) {
+			if custom == nil {
+				custom = make(map[string]string)
+			}
+			key := strings.TrimPrefix(f, customPrefix)
+			custom[key] = c.CustomFields[key]
+			continue
+		}
+		obj[f] = standardValue(c, f)
+	}
+	if custom != nil {
+		obj["custom_fields"] = custom
+	}
+	line, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	if _, err := nw.w.Write(line); err != nil {
+		return err
+	}
+	return nw.w.WriteByte('\n')
+}
+
+func (nw *ndjsonWriter) Flush() error {
+	return nw.w.Flush()
+}
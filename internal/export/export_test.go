@@ -0,0 +1,64 @@
+package export_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/export"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleContact() *model.Contact {
+	return &model.Contact{
+		ID:           uuid.MustParse("123e4567-e89b-12d3-a456-426655440000"),
+		Email:        "alice@example.com",
+		FirstName:    "Alice",
+		LastName:     "=HYPERLINK(\"x\")",
+		Lang:         model.Language_FA,
+		Status:       model.ContactStatus_Active,
+		CustomFields: model.CustomFields{"plan": "pro"},
+		CreatedAt:    time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatCSV, &buf, []string{"email", "last_name", "lang", "custom.plan"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(sampleContact()))
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "email,last_name,lang,custom.plan\nalice@example.com,\"'=HYPERLINK(\"\"x\"\")\",fa,pro\n", buf.String())
+}
+
+func TestCSVWriter_EmptyExportHasHeader(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatCSV, &buf, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Flush())
+	assert.Equal(t, "id,email,first_name,last_name,lang,status,created_at\n", buf.String())
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := export.NewWriter(export.FormatNDJSON, &buf, []string{"email", "created_at", "custom.plan", "custom.missing"})
+	assert.NoError(t, err)
+	assert.NoError(t, w.Write(sampleContact()))
+	assert.NoError(t, w.Write(sampleContact()))
+	assert.NoError(t, w.Flush())
+	line := `{"created_at":"2024-01-02T03:04:05Z","custom_fields":{"missing":"","plan":"pro"},"email":"alice@example.com"}` + "\n"
+	assert.Equal(t, line+line, buf.String())
+}
+
+func TestValidateFields(t *testing.T) {
+	assert.NoError(t, export.ValidateFields(nil))
+	assert.NoError(t, export.ValidateFields([]string{"email", "custom.plan"}))
+	assert.Error(t, export.ValidateFields([]string{"password_hash"}))
+	assert.Error(t, export.ValidateFields([]string{"custom."}))
+	assert.Error(t, export.ValidateFields([]string{"email", "email"}))
+
+	_, err := export.NewWriter("xml", &bytes.Buffer{}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"context"
+	"io"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AssetHandler is the gRPC server implementation of AssetService.
+type AssetHandler struct {
+	proto.UnimplementedAssetServiceServer
+	svc service.AssetService
+}
+
+// NewAssetHandler constructs a new handler, given an AssetService.
+func NewAssetHandler(svc service.AssetService) *AssetHandler {
+	return &AssetHandler{svc: svc}
+}
+
+func (h *AssetHandler) UploadAsset(stream proto.AssetService_UploadAssetServer) error {
+	workspaceID, err := workspaceFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return status.Error(codes.InvalidArgument, "upload is empty")
+	}
+	if err != nil {
+		return err
+	}
+	meta := first.GetMetadata()
+	if meta == nil {
+		return status.Error(codes.InvalidArgument, "upload must start with metadata")
+	}
+	res, err := h.svc.UploadAsset(stream.Context(), workspaceID, meta, &chunkReader{recv: stream.Recv})
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(res)
+}
+
+func (h *AssetHandler) ListAssets(ctx context.Context, req *proto.ListAssetsRequest) (*proto.ListAssetsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListAssets(ctx, workspaceID, req)
+}
+
+func (h *AssetHandler) GetAsset(ctx context.Context, req *proto.GetAssetRequest) (*proto.Asset, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetAsset(ctx, workspaceID, req)
+}
+
+func (h *AssetHandler) DeleteAsset(ctx context.Context, req *proto.DeleteAssetRequest) (*proto.DeleteAssetResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DeleteAsset(ctx, workspaceID, req)
+}
+
+// chunkReader adapts a client stream of UploadAssetRequest chunks to
+// io.Reader.
+type chunkReader struct {
+	recv func() (*proto.UploadAssetRequest, error)
+	buf  []byte
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		req, err := c.recv()
+		if err != nil {
+			return 0, err
+		}
+		if req.GetMetadata() != nil {
+			return 0, status.Error(codes.InvalidArgument, "metadata must only be sent first")
+		}
+		c.buf = req.GetChunk()
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
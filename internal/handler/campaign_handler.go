@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// CampaignHandler is the gRPC server implementation of CampaignService.
+type CampaignHandler struct {
+	proto.UnimplementedCampaignServiceServer
+	svc service.CampaignService
+}
+
+// NewCampaignHandler constructs a new handler, given a CampaignService.
+func NewCampaignHandler(svc service.CampaignService) *CampaignHandler {
+	return &CampaignHandler{svc: svc}
+}
+
+func (h *CampaignHandler) CreateCampaign(ctx context.Context, req *proto.CreateCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CreateCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) UpdateCampaign(ctx context.Context, req *proto.UpdateCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.UpdateCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) GetCampaign(ctx context.Context, req *proto.GetCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) ListCampaigns(ctx context.Context, req *proto.ListCampaignsRequest) (*proto.ListCampaignsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListCampaigns(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) ScheduleCampaign(ctx context.Context, req *proto.ScheduleCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ScheduleCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) CancelCampaign(ctx context.Context, req *proto.CancelCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CancelCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) PauseCampaign(ctx context.Context, req *proto.PauseCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.PauseCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) ResumeCampaign(ctx context.Context, req *proto.ResumeCampaignRequest) (*proto.Campaign, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ResumeCampaign(ctx, workspaceID, req)
+}
+
+func (h *CampaignHandler) RequeueDeadLetters(ctx context.Context, req *proto.RequeueDeadLettersRequest) (*proto.RequeueDeadLettersResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.RequeueDeadLetters(ctx, workspaceID, req)
+}
@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/middleware"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+)
+
+// exportChunkSize bounds the payload of each streamed export message.
+const exportChunkSize = 32 * 1024
+
+// ContactHandler is the gRPC server implementation of ContactService.
+type ContactHandler struct {
+	proto.UnimplementedContactServiceServer
+	exports service.ContactExportService
+}
+
+// NewContactHandler constructs a new handler, given a ContactExportService.
+func NewContactHandler(exports service.ContactExportService) *ContactHandler {
+	return &ContactHandler{exports: exports}
+}
+
+func (h *ContactHandler) ExportContacts(req *proto.ExportContactsRequest, stream proto.ContactService_ExportContactsServer) error {
+	workspaceID, err := workspaceFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriterSize(&chunkWriter{send: stream.Send}, exportChunkSize)
+	if err := h.exports.ExportContacts(stream.Context(), workspaceID, req, w); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func (h *ContactHandler) StartContactExport(ctx context.Context, req *proto.ExportContactsRequest) (*proto.ExportJob, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.exports.StartContactExport(ctx, workspaceID, req)
+}
+
+func (h *ContactHandler) GetContactExport(ctx context.Context, req *proto.GetContactExportRequest) (*proto.ExportJob, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.exports.GetContactExport(ctx, workspaceID, req)
+}
+
+func (h *ContactHandler) DownloadContactExport(req *proto.DownloadContactExportRequest, stream proto.ContactService_DownloadContactExportServer) error {
+	workspaceID, err := workspaceFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+	f, err := h.exports.OpenContactExport(stream.Context(), workspaceID, req)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.CopyBuffer(&chunkWriter{send: stream.Send}, f, make([]byte, exportChunkSize))
+	return err
+}
+
+// chunkWriter adapts a server stream of ExportContactsResponse to io.Writer.
+type chunkWriter struct {
+	send func(*proto.ExportContactsResponse) error
+}
+
+func (c *chunkWriter) Write(p []byte) (int, error) {
+	// gRPC may retain the message after Send returns, so copy the buffer.
+	data := make([]byte, len(p))
+	copy(data, p)
+	if err := c.send(&proto.ExportContactsResponse{Data: data}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// workspaceFromContext returns the authenticated workspace or an Unauthenticated error.
+func workspaceFromContext(ctx context.Context) (uuid.UUID, error) {
+	id, ok := middleware.WorkspaceIDFromContext(ctx)
+	if !ok {
+		return uuid.Nil, middleware.ErrUnauthenticated
+	}
+	return id, nil
+}
@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// ContentBlockHandler is the gRPC server implementation of ContentBlockService.
+type ContentBlockHandler struct {
+	proto.UnimplementedContentBlockServiceServer
+	svc service.ContentBlockService
+}
+
+// NewContentBlockHandler constructs a new handler, given a ContentBlockService.
+func NewContentBlockHandler(svc service.ContentBlockService) *ContentBlockHandler {
+	return &ContentBlockHandler{svc: svc}
+}
+
+func (h *ContentBlockHandler) CreateContentBlock(ctx context.Context, req *proto.CreateContentBlockRequest) (*proto.ContentBlock, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CreateContentBlock(ctx, workspaceID, req)
+}
+
+func (h *ContentBlockHandler) UpdateContentBlock(ctx context.Context, req *proto.UpdateContentBlockRequest) (*proto.UpdateContentBlockResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.UpdateContentBlock(ctx, workspaceID, req)
+}
+
+func (h *ContentBlockHandler) GetContentBlock(ctx context.Context, req *proto.GetContentBlockRequest) (*proto.ContentBlock, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetContentBlock(ctx, workspaceID, req)
+}
+
+func (h *ContentBlockHandler) ListContentBlocks(ctx context.Context, req *proto.ListContentBlocksRequest) (*proto.ListContentBlocksResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListContentBlocks(ctx, workspaceID, req)
+}
+
+func (h *ContentBlockHandler) DeleteContentBlock(ctx context.Context, req *proto.DeleteContentBlockRequest) (*proto.DeleteContentBlockResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DeleteContentBlock(ctx, workspaceID, req)
+}
+
+func (h *ContentBlockHandler) GetContentBlockDependents(ctx context.Context, req *proto.GetContentBlockDependentsRequest) (*proto.ContentBlockDependents, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetContentBlockDependents(ctx, workspaceID, req)
+}
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// PreferenceHandler is the gRPC server implementation of PreferenceService.
+type PreferenceHandler struct {
+	proto.UnimplementedPreferenceServiceServer
+	svc service.PreferenceService
+}
+
+// NewPreferenceHandler constructs a new handler, given a PreferenceService.
+func NewPreferenceHandler(svc service.PreferenceService) *PreferenceHandler {
+	return &PreferenceHandler{svc: svc}
+}
+
+func (h *PreferenceHandler) GetPreferences(ctx context.Context, req *proto.GetPreferencesRequest) (*proto.Preferences, error) {
+	return h.svc.GetPreferences(ctx, req)
+}
+
+func (h *PreferenceHandler) UpdatePreferences(ctx context.Context, req *proto.UpdatePreferencesRequest) (*proto.Preferences, error) {
+	return h.svc.UpdatePreferences(ctx, clientInfo(ctx), req)
+}
@@ -0,0 +1,216 @@
+package handler
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// pauseDays are the pauses the preference page offers.
+var pauseDays = []int{7, 30, 90}
+
+// PreferencePage serves the preference center links of campaign emails.
+// GET shows the contact's preferences in their language; POST saves the
+// form.
+type PreferencePage struct {
+	svc service.PreferenceService
+}
+
+// NewPreferencePage constructs a new page, given a PreferenceService.
+func NewPreferencePage(svc service.PreferenceService) *PreferencePage {
+	return &PreferencePage{svc: svc}
+}
+
+func (h *PreferencePage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	prefs, err := h.svc.GetPreferences(r.Context(), &proto.GetPreferencesRequest{Token: token})
+	saved := false
+	if err == nil && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+		prefs, err = h.svc.UpdatePreferences(r.Context(), httpClientInfo(r), preferencesForm(r, token, prefs))
+		saved = err == nil
+	}
+
+	page := preferencePageData{Action: "?token=" + template.URLQueryEscaper(token), Lang: model.Language_EN}
+	code := http.StatusOK
+	switch status.Code(err) {
+	case codes.OK:
+		page.State, page.Saved, page.Prefs = "form", saved, prefs
+		page.Lang, _ = model.ParseLanguage(prefs.Lang)
+		if prefs.PausedUntil != nil {
+			page.PausedUntil = prefs.PausedUntil.AsTime().Format("2006-01-02")
+		}
+	case codes.InvalidArgument, codes.NotFound:
+		code, page.State = http.StatusBadRequest, "invalid"
+	default:
+		code, page.State = http.StatusInternalServerError, "error"
+	}
+	page.Dir = textDir(page.Lang)
+	page.Text = preferenceText[page.Lang]
+	page.Languages = preferenceLanguages
+	for _, n := range pauseDays {
+		page.Pauses = append(page.Pauses, pageOption{Value: strconv.Itoa(n), Label: fmt.Sprintf(page.Text["days"], n)})
+	}
+	writePage(w, code, preferenceTemplate, page)
+}
+
+// preferencesForm converts the posted form to an update of prefs. The
+// form lists the lists to stay on, so the others are left.
+func preferencesForm(r *http.Request, token string, prefs *proto.Preferences) *proto.UpdatePreferencesRequest {
+	in := &proto.UpdatePreferencesRequest{Token: token, Lang: r.PostFormValue("lang")}
+	keep := make(map[string]bool)
+	for _, id := range r.PostForm["list"] {
+		keep[id] = true
+	}
+	for _, l := range prefs.Lists {
+		if l.Status != string(model.SubscriptionStatus_Unsubscribed) && !keep[l.ListId] {
+			in.UnsubscribeListIds = append(in.UnsubscribeListIds, l.ListId)
+		}
+	}
+	switch pause := r.PostFormValue("pause"); pause {
+	case "":
+	case "resume":
+		in.Resume = true
+	default:
+		n, _ := strconv.Atoi(pause)
+		in.PauseDays = int32(n)
+	}
+	return in
+}
+
+type pageOption struct {
+	Value string
+	Label string
+}
+
+type preferencePageData struct {
+	State       string
+	Saved       bool
+	Action      string
+	Lang        model.Language
+	Dir         string
+	Text        map[string]string
+	Prefs       *proto.Preferences
+	PausedUntil string
+	Languages   []pageOption
+	Pauses      []pageOption
+}
+
+// preferenceLanguages are the languages contacts can choose, named in
+// themselves.
+var preferenceLanguages = []pageOption{
+	{Value: "en", Label: "English"},
+	{Value: "fa", Label: "فارسی"},
+}
+
+// preferenceText holds the strings of the page in each language.
+var preferenceText = map[model.Language]map[string]string{
+	model.Language_EN: {
+		"title":      "Email preferences",
+		"intro":      "Choose which emails %s receives.",
+		"saved":      "Your preferences have been saved.",
+		"language":   "Language",
+		"lists":      "Lists",
+		"left":       "unsubscribed",
+		"no_lists":   "You are not on any list.",
+		"pause":      "Pause emails",
+		"paused":     "Emails are paused until %s.",
+		"pause_none": "Do not pause",
+		"days":       "For %d days",
+		"resume":     "Resume emails now",
+		"save":       "Save",
+		"invalid":    "This link is not valid. Please use the link from the latest email you received.",
+		"error":      "Something went wrong. Please try again later.",
+	},
+	model.Language_FA: {
+		"title":      "تنظیمات ایمیل",
+		"intro":      "انتخاب کنید %s چه ایمیل‌هایی دریافت کند.",
+		"saved":      "تنظیمات شما ذخیره شد.",
+		"language":   "زبان",
+		"lists":      "فهرست‌ها",
+		"left":       "لغو اشتراک شده",
+		"no_lists":   "شما در هیچ فهرستی نیستید.",
+		"pause":      "توقف ایمیل‌ها",
+		"paused":     "ایمیل‌ها تا %s متوقف شده‌اند.",
+		"pause_none": "بدون توقف",
+		"days":       "به مدت %d روز",
+		"resume":     "از سرگیری ایمیل‌ها",
+		"save":       "ذخیره",
+		"invalid":    "این پیوند معتبر نیست. لطفاً از پیوند آخرین ایمیلی که دریافت کرده‌اید استفاده کنید.",
+		"error":      "مشکلی پیش آمد. لطفاً بعداً دوباره تلاش کنید.",
+	},
+}
+
+var preferenceTemplate = template.Must(template.New("preferences").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{index .Text "title"}}</title>
+</head>
+<body>
+<main>
+<h1>{{index .Text "title"}}</h1>
+{{- if eq .State "form"}}
+{{- if .Saved}}
+<p role="status">{{index .Text "saved"}}</p>
+{{- end}}
+<form method="post" action="{{.Action}}">
+<p>{{printf (index .Text "intro") .Prefs.Email}}</p>
+<fieldset>
+<legend>{{index .Text "language"}}</legend>
+<select name="lang">
+{{- range .Languages}}
+<option value="{{.Value}}"{{if eq .Value $.Prefs.Lang}} selected{{end}}>{{.Label}}</option>
+{{- end}}
+</select>
+</fieldset>
+<fieldset>
+<legend>{{index .Text "lists"}}</legend>
+{{- range .Prefs.Lists}}
+{{- if eq .Status "unsubscribed"}}
+<p>{{.Name}} ({{index $.Text "left"}})</p>
+{{- else}}
+<p><label><input type="checkbox" name="list" value="{{.ListId}}" checked> {{.Name}}</label></p>
+{{- end}}
+{{- else}}
+<p>{{index .Text "no_lists"}}</p>
+{{- end}}
+</fieldset>
+<fieldset>
+<legend>{{index .Text "pause"}}</legend>
+{{- if .PausedUntil}}
+<p>{{printf (index .Text "paused") .PausedUntil}}</p>
+{{- end}}
+<select name="pause">
+<option value="">{{index .Text "pause_none"}}</option>
+{{- range .Pauses}}
+<option value="{{.Value}}">{{.Label}}</option>
+{{- end}}
+{{- if .PausedUntil}}
+<option value="resume">{{index .Text "resume"}}</option>
+{{- end}}
+</select>
+</fieldset>
+<button type="submit">{{index .Text "save"}}</button>
+</form>
+{{- else}}
+<p>{{index .Text .State}}</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// ReplyHandler is the gRPC server implementation of ReplyService.
+type ReplyHandler struct {
+	proto.UnimplementedReplyServiceServer
+	svc service.ReplyService
+}
+
+// NewReplyHandler constructs a new handler, given a ReplyService.
+func NewReplyHandler(svc service.ReplyService) *ReplyHandler {
+	return &ReplyHandler{svc: svc}
+}
+
+func (h *ReplyHandler) ListReplies(ctx context.Context, req *proto.ListRepliesRequest) (*proto.ListRepliesResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListReplies(ctx, workspaceID, req)
+}
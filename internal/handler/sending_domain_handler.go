@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// SendingDomainHandler is the gRPC server implementation of SendingDomainService.
+type SendingDomainHandler struct {
+	proto.UnimplementedSendingDomainServiceServer
+	svc service.SendingDomainService
+}
+
+// NewSendingDomainHandler constructs a new handler, given a SendingDomainService.
+func NewSendingDomainHandler(svc service.SendingDomainService) *SendingDomainHandler {
+	return &SendingDomainHandler{svc: svc}
+}
+
+func (h *SendingDomainHandler) CreateSendingDomain(ctx context.Context, req *proto.CreateSendingDomainRequest) (*proto.SendingDomain, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CreateSendingDomain(ctx, workspaceID, req)
+}
+
+func (h *SendingDomainHandler) GetSendingDomain(ctx context.Context, req *proto.GetSendingDomainRequest) (*proto.SendingDomain, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetSendingDomain(ctx, workspaceID, req)
+}
+
+func (h *SendingDomainHandler) ListSendingDomains(ctx context.Context, req *proto.ListSendingDomainsRequest) (*proto.ListSendingDomainsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListSendingDomains(ctx, workspaceID, req)
+}
+
+func (h *SendingDomainHandler) VerifySendingDomain(ctx context.Context, req *proto.VerifySendingDomainRequest) (*proto.SendingDomain, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.VerifySendingDomain(ctx, workspaceID, req)
+}
+
+func (h *SendingDomainHandler) DeleteSendingDomain(ctx context.Context, req *proto.DeleteSendingDomainRequest) (*proto.DeleteSendingDomainResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DeleteSendingDomain(ctx, workspaceID, req)
+}
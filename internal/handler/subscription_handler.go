@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/middleware"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/metadata"
+)
+
+// SubscriptionHandler is the gRPC server implementation of SubscriptionService.
+type SubscriptionHandler struct {
+	proto.UnimplementedSubscriptionServiceServer
+	svc service.SubscriptionService
+}
+
+// NewSubscriptionHandler constructs a new handler, given a SubscriptionService.
+func NewSubscriptionHandler(svc service.SubscriptionService) *SubscriptionHandler {
+	return &SubscriptionHandler{svc: svc}
+}
+
+func (h *SubscriptionHandler) Subscribe(ctx context.Context, req *proto.SubscribeRequest) (*proto.SubscribeResponse, error) {
+	return h.svc.Subscribe(ctx, clientInfo(ctx), req)
+}
+
+func (h *SubscriptionHandler) ConfirmSubscription(ctx context.Context, req *proto.ConfirmSubscriptionRequest) (*proto.ConfirmSubscriptionResponse, error) {
+	return h.svc.ConfirmSubscription(ctx, clientInfo(ctx), req)
+}
+
+func (h *SubscriptionHandler) GetConsentHistory(ctx context.Context, req *proto.GetConsentHistoryRequest) (*proto.GetConsentHistoryResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetConsentHistory(ctx, workspaceID, req)
+}
+
+// clientInfo extracts the end user's IP and user agent. Requests from browser
+// forms arrive through a gateway, which forwards the browser's user agent.
+func clientInfo(ctx context.Context) service.ClientInfo {
+	info := service.ClientInfo{IP: clientIP(ctx)}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, key := range []string{"grpcgateway-user-agent", "user-agent"} {
+		if ua := md.Get(key); len(ua) > 0 {
+			info.UserAgent = ua[0]
+			break
+		}
+	}
+	return info
+}
+
+// clientIP returns the client's address, resolved from the trusted proxies'
+// forwarded headers by the server's middleware.
+func clientIP(ctx context.Context) string {
+	ip, _ := middleware.ClientIPFromContext(ctx)
+	return ip
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// SubscriptionConfirmPage serves the links of double opt-in confirmation
+// emails. GET shows a page asking to confirm, so link scanners that follow
+// links do not confirm anyone's consent; POST confirms.
+type SubscriptionConfirmPage struct {
+	svc service.SubscriptionService
+}
+
+// NewSubscriptionConfirmPage constructs a new page, given a
+// SubscriptionService.
+func NewSubscriptionConfirmPage(svc service.SubscriptionService) *SubscriptionConfirmPage {
+	return &SubscriptionConfirmPage{svc: svc}
+}
+
+func (h *SubscriptionConfirmPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	sub, err := h.svc.LookupConfirmation(r.Context(), token)
+	confirmed := false
+	if err == nil && r.Method == http.MethodPost {
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+		_, err = h.svc.ConfirmSubscription(r.Context(), httpClientInfo(r), &proto.ConfirmSubscriptionRequest{Token: token})
+		confirmed = err == nil
+	}
+
+	page := subscriptionPageData{Action: "?token=" + template.URLQueryEscaper(token), Lang: model.Language_EN}
+	code := http.StatusOK
+	switch status.Code(err) {
+	case codes.OK:
+		page.State, page.Email, page.List, page.Lang = "confirm", sub.Email, sub.ListName, sub.Lang
+		if confirmed {
+			page.State = "done"
+		}
+	case codes.FailedPrecondition:
+		code, page.State = http.StatusGone, "expired"
+	case codes.InvalidArgument, codes.NotFound:
+		code, page.State = http.StatusBadRequest, "invalid"
+	default:
+		code, page.State = http.StatusInternalServerError, "error"
+	}
+	page.Dir = textDir(page.Lang)
+	page.Text = subscriptionText[page.Lang]
+	writePage(w, code, subscriptionTemplate, page)
+}
+
+type subscriptionPageData struct {
+	State  string
+	Email  string
+	List   string
+	Action string
+	Lang   model.Language
+	Dir    string
+	Text   map[string]string
+}
+
+// subscriptionText holds the strings of the page in each language.
+var subscriptionText = map[model.Language]map[string]string{
+	model.Language_EN: {
+		"title":   "Confirm your subscription",
+		"confirm": "Subscribe %s to %q?",
+		"button":  "Confirm subscription",
+		"done":    "Thank you. %s is now subscribed to %q.",
+		"expired": "This confirmation link has expired. Please subscribe again.",
+		"invalid": "This confirmation link is not valid. Please use the link from the latest email you received.",
+		"error":   "Something went wrong. Please try again later.",
+	},
+	model.Language_FA: {
+		"title":   "تأیید عضویت",
+		"confirm": "عضویت %s در «%s» تأیید شود؟",
+		"button":  "تأیید عضویت",
+		"done":    "سپاس. %s اکنون عضو «%s» است.",
+		"expired": "مهلت این پیوند تأیید به پایان رسیده است. لطفاً دوباره عضو شوید.",
+		"invalid": "این پیوند تأیید معتبر نیست. لطفاً از پیوند آخرین ایمیلی که دریافت کرده‌اید استفاده کنید.",
+		"error":   "مشکلی پیش آمد. لطفاً بعداً دوباره تلاش کنید.",
+	},
+}
+
+var subscriptionTemplate = template.Must(template.New("subscription").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{index .Text "title"}}</title>
+</head>
+<body>
+<main>
+<h1>{{index .Text "title"}}</h1>
+{{- if eq .State "confirm"}}
+<form method="post" action="{{.Action}}">
+<p>{{printf (index .Text "confirm") .Email .List}}</p>
+<button type="submit">{{index .Text "button"}}</button>
+</form>
+{{- else if eq .State "done"}}
+<p>{{printf (index .Text "done") .Email .List}}</p>
+{{- else}}
+<p>{{index .Text .State}}</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
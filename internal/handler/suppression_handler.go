@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"context"
+	"io"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// SuppressionHandler is the gRPC server implementation of SuppressionService.
+type SuppressionHandler struct {
+	proto.UnimplementedSuppressionServiceServer
+	svc service.SuppressionService
+}
+
+// NewSuppressionHandler constructs a new handler, given a SuppressionService.
+func NewSuppressionHandler(svc service.SuppressionService) *SuppressionHandler {
+	return &SuppressionHandler{svc: svc}
+}
+
+func (h *SuppressionHandler) AddSuppression(ctx context.Context, req *proto.AddSuppressionRequest) (*proto.Suppression, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.AddSuppression(ctx, workspaceID, req)
+}
+
+func (h *SuppressionHandler) RemoveSuppression(ctx context.Context, req *proto.RemoveSuppressionRequest) (*proto.RemoveSuppressionResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.RemoveSuppression(ctx, workspaceID, req)
+}
+
+func (h *SuppressionHandler) ListSuppressions(ctx context.Context, req *proto.ListSuppressionsRequest) (*proto.ListSuppressionsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListSuppressions(ctx, workspaceID, req)
+}
+
+func (h *SuppressionHandler) ImportSuppressions(stream proto.SuppressionService_ImportSuppressionsServer) error {
+	workspaceID, err := workspaceFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	total := &proto.ImportSuppressionsResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(total)
+		}
+		if err != nil {
+			return err
+		}
+		res, err := h.svc.ImportSuppressionBatch(stream.Context(), workspaceID, req, int(total.Received))
+		if err != nil {
+			return err
+		}
+		total.Received += res.Received
+		total.Imported += res.Imported
+		total.Duplicates += res.Duplicates
+		total.Errors = append(total.Errors, res.Errors...)
+	}
+}
+
+func (h *SuppressionHandler) SetListSubscription(ctx context.Context, req *proto.SetListSubscriptionRequest) (*proto.SetListSubscriptionResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.SetListSubscription(ctx, workspaceID, req)
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// TagHandler is the gRPC server implementation of TagService.
+type TagHandler struct {
+	proto.UnimplementedTagServiceServer
+	svc service.TagService
+}
+
+// NewTagHandler constructs a new handler, given a TagService.
+func NewTagHandler(svc service.TagService) *TagHandler {
+	return &TagHandler{svc: svc}
+}
+
+func (h *TagHandler) CreateTag(ctx context.Context, req *proto.CreateTagRequest) (*proto.Tag, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CreateTag(ctx, workspaceID, req)
+}
+
+func (h *TagHandler) ListTags(ctx context.Context, req *proto.ListTagsRequest) (*proto.ListTagsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListTags(ctx, workspaceID, req)
+}
+
+func (h *TagHandler) DeleteTag(ctx context.Context, req *proto.DeleteTagRequest) (*proto.DeleteTagResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DeleteTag(ctx, workspaceID, req)
+}
+
+func (h *TagHandler) TagContacts(ctx context.Context, req *proto.TagContactsRequest) (*proto.TagContactsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.TagContacts(ctx, workspaceID, req)
+}
+
+func (h *TagHandler) UntagContacts(ctx context.Context, req *proto.TagContactsRequest) (*proto.TagContactsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.UntagContacts(ctx, workspaceID, req)
+}
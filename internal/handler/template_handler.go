@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// TemplateHandler is the gRPC server implementation of TemplateService.
+type TemplateHandler struct {
+	proto.UnimplementedTemplateServiceServer
+	svc service.TemplateService
+}
+
+// NewTemplateHandler constructs a new handler, given a TemplateService.
+func NewTemplateHandler(svc service.TemplateService) *TemplateHandler {
+	return &TemplateHandler{svc: svc}
+}
+
+func (h *TemplateHandler) CreateTemplate(ctx context.Context, req *proto.CreateTemplateRequest) (*proto.Template, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.CreateTemplate(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) UpdateTemplate(ctx context.Context, req *proto.UpdateTemplateRequest) (*proto.Template, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.UpdateTemplate(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) ListTemplates(ctx context.Context, req *proto.ListTemplatesRequest) (*proto.ListTemplatesResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListTemplates(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) GetTemplate(ctx context.Context, req *proto.GetTemplateRequest) (*proto.TemplateVersion, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.GetTemplate(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) ListTemplateVersions(ctx context.Context, req *proto.ListTemplateVersionsRequest) (*proto.ListTemplateVersionsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListTemplateVersions(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) DiffTemplateVersions(ctx context.Context, req *proto.DiffTemplateVersionsRequest) (*proto.DiffTemplateVersionsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DiffTemplateVersions(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) RollbackTemplate(ctx context.Context, req *proto.RollbackTemplateRequest) (*proto.Template, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.RollbackTemplate(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) PreviewTemplate(ctx context.Context, req *proto.PreviewTemplateRequest) (*proto.PreviewTemplateResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.PreviewTemplate(ctx, workspaceID, req)
+}
+
+func (h *TemplateHandler) SendTestEmail(ctx context.Context, req *proto.SendTestEmailRequest) (*proto.SendTestEmailResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.SendTestEmail(ctx, workspaceID, req)
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// TestRecipientHandler is the gRPC server implementation of TestRecipientService.
+type TestRecipientHandler struct {
+	proto.UnimplementedTestRecipientServiceServer
+	svc service.TestRecipientService
+}
+
+// NewTestRecipientHandler constructs a new handler, given a TestRecipientService.
+func NewTestRecipientHandler(svc service.TestRecipientService) *TestRecipientHandler {
+	return &TestRecipientHandler{svc: svc}
+}
+
+func (h *TestRecipientHandler) AddTestRecipient(ctx context.Context, req *proto.AddTestRecipientRequest) (*proto.TestRecipient, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.AddTestRecipient(ctx, workspaceID, req)
+}
+
+func (h *TestRecipientHandler) ListTestRecipients(ctx context.Context, req *proto.ListTestRecipientsRequest) (*proto.ListTestRecipientsResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.ListTestRecipients(ctx, workspaceID, req)
+}
+
+func (h *TestRecipientHandler) DeleteTestRecipient(ctx context.Context, req *proto.DeleteTestRecipientRequest) (*proto.DeleteTestRecipientResponse, error) {
+	workspaceID, err := workspaceFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return h.svc.DeleteTestRecipient(ctx, workspaceID, req)
+}
+
+func (h *TestRecipientHandler) VerifyTestRecipient(ctx context.Context, req *proto.VerifyTestRecipientRequest) (*proto.TestRecipient, error) {
+	return h.svc.VerifyTestRecipient(ctx, req)
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestRecipientVerifyPage serves the links of test recipient verification
+// emails. GET shows a page asking to allow test emails, so link scanners
+// that follow links do not verify anyone; POST verifies.
+type TestRecipientVerifyPage struct {
+	svc service.TestRecipientService
+}
+
+// NewTestRecipientVerifyPage constructs a new page, given a
+// TestRecipientService.
+func NewTestRecipientVerifyPage(svc service.TestRecipientService) *TestRecipientVerifyPage {
+	return &TestRecipientVerifyPage{svc: svc}
+}
+
+func (h *TestRecipientVerifyPage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	page := testRecipientPageData{State: "confirm", Action: "?token=" + template.URLQueryEscaper(token)}
+	code := http.StatusOK
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPost:
+		rec, err := h.svc.VerifyTestRecipient(r.Context(), &proto.VerifyTestRecipientRequest{Token: token})
+		switch status.Code(err) {
+		case codes.OK:
+			page.State, page.Email = "done", rec.Email
+		case codes.FailedPrecondition:
+			code, page.State = http.StatusGone, "expired"
+		case codes.InvalidArgument, codes.NotFound:
+			code, page.State = http.StatusBadRequest, "invalid"
+		default:
+			code, page.State = http.StatusInternalServerError, "error"
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writePage(w, code, testRecipientTemplate, page)
+}
+
+type testRecipientPageData struct {
+	State  string
+	Email  string
+	Action string
+}
+
+// The verification email is in English, and so is its page.
+var testRecipientTemplate = template.Must(template.New("test-recipient").Parse(`<!DOCTYPE html>
+<html lang="en" dir="ltr">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>Test emails</title>
+</head>
+<body>
+<main>
+<h1>Test emails</h1>
+{{- if eq .State "confirm"}}
+<form method="post" action="{{.Action}}">
+<p>Allow test emails to be sent to this address?</p>
+<button type="submit">Allow test emails</button>
+</form>
+{{- else if eq .State "done"}}
+<p>{{.Email}} can now receive test emails.</p>
+{{- else if eq .State "expired"}}
+<p>This verification link has expired. Please ask for a new one.</p>
+{{- else if eq .State "invalid"}}
+<p>This verification link is not valid. Please use the link from the latest email you received.</p>
+{{- else}}
+<p>Something went wrong. Please try again later.</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+)
+
+// transparentGIF is a 1x1 transparent GIF image.
+var transparentGIF = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00, 0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00,
+	0x01, 0x00, 0x01, 0x00, 0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// OpenPixel serves the open tracking pixel of campaign emails. The image
+// is served whatever the token, so no message shows a broken image.
+type OpenPixel struct {
+	svc service.TrackingService
+}
+
+// NewOpenPixel constructs a new pixel, given a TrackingService.
+func NewOpenPixel(svc service.TrackingService) *OpenPixel {
+	return &OpenPixel{svc: svc}
+}
+
+func (h *OpenPixel) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	h.svc.Open(r.Context(), trackingHit(r), r.URL.Query().Get("token"))
+
+	// Every open must reach the server, so the image is never cached.
+	hd := w.Header()
+	hd.Set("Content-Type", "image/gif")
+	hd.Set("Cache-Control", "no-store, no-cache, must-revalidate, private")
+	hd.Set("Expires", "0")
+	w.Write(transparentGIF)
+}
+
+// ClickRedirect serves the tracked links of campaign emails, redirecting
+// to the link target the token was signed for.
+type ClickRedirect struct {
+	svc service.TrackingService
+}
+
+// NewClickRedirect constructs a new redirector, given a TrackingService.
+func NewClickRedirect(svc service.TrackingService) *ClickRedirect {
+	return &ClickRedirect{svc: svc}
+}
+
+func (h *ClickRedirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	target, err := h.svc.Click(r.Context(), trackingHit(r), r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, "invalid link", http.StatusBadRequest)
+		return
+	}
+	// The token must not reach the target as the referrer.
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// trackingHit describes a request to the pixel or a tracked link. Browsers
+// mark prefetches with one of several headers; HEAD requests come from
+// link checkers, never from a person following a link.
+func trackingHit(r *http.Request) service.TrackingHit {
+	hit := service.TrackingHit{Client: httpClientInfo(r), Prefetch: r.Method == http.MethodHead}
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		v := strings.ToLower(r.Header.Get(name))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") {
+			hit.Prefetch = true
+		}
+	}
+	return hit
+}
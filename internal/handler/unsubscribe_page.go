@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"html/template"
+	"net/http"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxFormBytes bounds the bodies of the public pages' POST requests.
+const maxFormBytes = 64 << 10
+
+// UnsubscribePage serves the unsubscribe links of campaign emails. GET
+// shows a page asking to confirm, so link scanners that follow links do
+// not unsubscribe anyone; POST unsubscribes, whether sent by the page or
+// by a mail client's one-click request (RFC 8058).
+type UnsubscribePage struct {
+	svc service.UnsubscribeService
+}
+
+// NewUnsubscribePage constructs a new page, given an UnsubscribeService.
+func NewUnsubscribePage(svc service.UnsubscribeService) *UnsubscribePage {
+	return &UnsubscribePage{svc: svc}
+}
+
+func (h *UnsubscribePage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	var (
+		u   *service.Unsubscriber
+		err error
+	)
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		u, err = h.svc.Lookup(r.Context(), token)
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBytes)
+		oneClick := r.PostFormValue("List-Unsubscribe") == "One-Click"
+		u, err = h.svc.Unsubscribe(r.Context(), httpClientInfo(r), token, oneClick)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	page := unsubscribePageData{Action: "?token=" + template.URLQueryEscaper(token), Lang: model.Language_EN}
+	code := http.StatusOK
+	switch {
+	case status.Code(err) == codes.InvalidArgument:
+		code, page.State = http.StatusBadRequest, "invalid"
+	case err != nil:
+		code, page.State = http.StatusInternalServerError, "error"
+	case u.Unsubscribed:
+		page.State, page.Email, page.Lang = "done", u.Email, u.Lang
+	default:
+		page.State, page.Email, page.Lang = "confirm", u.Email, u.Lang
+	}
+	page.Dir = textDir(page.Lang)
+	page.Text = unsubscribeText[page.Lang]
+	writePage(w, code, unsubscribeTemplate, page)
+}
+
+type unsubscribePageData struct {
+	State  string
+	Email  string
+	Action string
+	Lang   model.Language
+	Dir    string
+	Text   map[string]string
+}
+
+// unsubscribeText holds the strings of the page in each language.
+var unsubscribeText = map[model.Language]map[string]string{
+	model.Language_EN: {
+		"title":   "Unsubscribe",
+		"confirm": "Stop sending emails to %s?",
+		"button":  "Unsubscribe",
+		"done":    "%s has been unsubscribed and will not receive these emails any more.",
+		"invalid": "This unsubscribe link is not valid. Please use the link from the latest email you received.",
+		"error":   "Something went wrong. Please try again later.",
+	},
+	model.Language_FA: {
+		"title":   "لغو اشتراک",
+		"confirm": "ارسال ایمیل به %s متوقف شود؟",
+		"button":  "لغو اشتراک",
+		"done":    "اشتراک %s لغو شد و دیگر این ایمیل‌ها را دریافت نخواهد کرد.",
+		"invalid": "این پیوند لغو اشتراک معتبر نیست. لطفاً از پیوند آخرین ایمیلی که دریافت کرده‌اید استفاده کنید.",
+		"error":   "مشکلی پیش آمد. لطفاً بعداً دوباره تلاش کنید.",
+	},
+}
+
+var unsubscribeTemplate = template.Must(template.New("unsubscribe").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}" dir="{{.Dir}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{index .Text "title"}}</title>
+</head>
+<body>
+<main>
+<h1>{{index .Text "title"}}</h1>
+{{- if eq .State "confirm"}}
+<form method="post" action="{{.Action}}">
+<p>{{printf (index .Text "confirm") .Email}}</p>
+<button type="submit">{{index .Text "button"}}</button>
+</form>
+{{- else if eq .State "done"}}
+<p>{{printf (index .Text "done") .Email}}</p>
+{{- else}}
+<p>{{index .Text .State}}</p>
+{{- end}}
+</main>
+</body>
+</html>
+`))
+
+// textDir returns the dir attribute of pages in lang.
+func textDir(lang model.Language) string {
+	if lang.RTL() {
+		return "rtl"
+	}
+	return "ltr"
+}
+
+// writePage renders a public page. Pages are not cached or indexed, and
+// the signed tokens in their URLs are not sent as referrers.
+func writePage(w http.ResponseWriter, code int, tpl *template.Template, data any) {
+	h := w.Header()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Cache-Control", "no-store")
+	h.Set("Referrer-Policy", "no-referrer")
+	h.Set("X-Robots-Tag", "noindex")
+	h.Set("X-Frame-Options", "DENY")
+	w.WriteHeader(code)
+	tpl.Execute(w, data)
+}
+
+// httpClientInfo describes the client of an HTTP request for consent
+// records, like clientInfo does for RPCs.
+func httpClientInfo(r *http.Request) service.ClientInfo {
+	return service.ClientInfo{IP: clientIP(r.Context()), UserAgent: r.UserAgent()}
+}
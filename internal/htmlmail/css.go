@@ -0,0 +1,237 @@
+package htmlmail
+
+import (
+	"strings"
+)
+
+// declaration is one "property: value" pair.
+type declaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// rule is a style rule with a single selector.
+type rule struct {
+	selector  string
+	sel       *selector
+	decls     []declaration
+	order     int
+	inlinable bool
+}
+
+// stylesheet is the parsed content of the <style> blocks of a document.
+type stylesheet struct {
+	rules []rule
+	// retained holds CSS that cannot be inlined, such as media queries and
+	// pseudo-class rules, in source order. It is kept in a <style> block for
+	// the clients that support one.
+	retained []string
+}
+
+func stripComments(css string) string {
+	var b strings.Builder
+	for {
+		i := strings.Index(css, "/*")
+		if i < 0 {
+			b.WriteString(css)
+			return b.String()
+		}
+		b.WriteString(css[:i])
+		j := strings.Index(css[i+2:], "*/")
+		if j < 0 {
+			return b.String()
+		}
+		css = css[i+2+j+2:]
+	}
+}
+
+// parse parses css, appending to s. Warnings are reported through
+// warn.
+func (s *stylesheet) parse(css string, warn func(Warning)) {
+	css = stripComments(css)
+	for {
+		css = strings.TrimSpace(css)
+		if css == "" {
+			return
+		}
+		if css[0] == '@' {
+			css = s.parseAtRule(css, warn)
+			continue
+		}
+		open := strings.IndexByte(css, '{')
+		if open < 0 {
+			return
+		}
+		end := matchingBrace(css, open)
+		if end < 0 {
+			end = len(css) - 1
+		}
+		prelude := strings.TrimSpace(css[:open])
+		body := css[open+1 : end]
+		css = css[end+1:]
+		s.addRules(prelude, body, warn)
+	}
+}
+
+func (s *stylesheet) parseAtRule(css string, warn func(Warning)) string {
+	name := css[1:]
+	if i := strings.IndexAny(name, " \t\r\n{;("); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ToLower(name)
+
+	semi := strings.IndexByte(css, ';')
+	open := strings.IndexByte(css, '{')
+	if open < 0 || (semi >= 0 && semi < open) {
+		// Statement at-rule such as @import or @charset.
+		if semi < 0 {
+			semi = len(css) - 1
+		}
+		if name == "import" {
+			warn(Warning{Property: "@import", Message: "external stylesheets are not loaded by email clients"})
+		}
+		return css[semi+1:]
+	}
+	end := matchingBrace(css, open)
+	if end < 0 {
+		end = len(css) - 1
+	}
+	block := css[:end+1]
+	if name == "font-face" {
+		warn(Warning{Property: "@font-face", Message: "web fonts are ignored by most email clients"})
+	} else {
+		// Report unsupported CSS inside blocks such as @media.
+		var nested stylesheet
+		nested.parse(css[open+1:end], warn)
+	}
+	s.retained = append(s.retained, block)
+	return css[end+1:]
+}
+
+// addRules splits a selector list into one rule per selector.
+func (s *stylesheet) addRules(prelude, body string, warn func(Warning)) {
+	decls := parseDeclarations(body)
+	var kept []string
+	for _, raw := range splitTopLevel(prelude, ',') {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		checkDeclarations(raw, decls, warn)
+		sel, err := parseSelector(raw)
+		if err != nil {
+			if err != errPseudo {
+				warn(Warning{Property: raw, Message: "selector cannot be inlined: " + err.Error()})
+			}
+			kept = append(kept, raw)
+			continue
+		}
+		s.rules = append(s.rules, rule{
+			selector:  raw,
+			sel:       sel,
+			decls:     decls,
+			order:     len(s.rules),
+			inlinable: true,
+		})
+	}
+	if len(kept) > 0 {
+		s.retained = append(s.retained, strings.Join(kept, ", ")+" { "+formatDeclarations(decls, true)+" }")
+	}
+}
+
+// parseDeclarations parses the body of a rule or a style attribute.
+func parseDeclarations(body string) []declaration {
+	var out []declaration
+	for _, part := range splitTopLevel(body, ';') {
+		name, value, ok := strings.Cut(part, ":")
+		if !ok {
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if name == "" || value == "" {
+			continue
+		}
+		d := declaration{property: name, value: value}
+		if i := strings.LastIndex(strings.ToLower(value), "!important"); i >= 0 && strings.TrimSpace(value[i+len("!important"):]) == "" {
+			d.value = strings.TrimSpace(value[:i])
+			d.important = true
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func formatDeclarations(decls []declaration, keepImportant bool) string {
+	parts := make([]string, 0, len(decls))
+	for _, d := range decls {
+		v := d.value
+		if keepImportant && d.important {
+			v += " !important"
+		}
+		parts = append(parts, d.property+": "+v)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// splitTopLevel splits s on sep outside quotes, parentheses and brackets.
+func splitTopLevel(s string, sep byte) []string {
+	var (
+		out   []string
+		depth int
+		quote byte
+		start int
+	)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(' || c == '[':
+			depth++
+		case c == ')' || c == ']':
+			if depth > 0 {
+				depth--
+			}
+		case c == sep && depth == 0:
+			out = append(out, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(out, s[start:])
+}
+
+// matchingBrace returns the index of the brace closing the one at open, or
+// -1 if it is unbalanced.
+func matchingBrace(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
@@ -0,0 +1,110 @@
+package htmlmail_test
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/htmlmail"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, string(want), got, name)
+}
+
+func readInput(t *testing.T, name string) string {
+	t.Helper()
+	b, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestInlineCSS_Golden(t *testing.T) {
+	out, warnings, err := htmlmail.InlineCSS(readInput(t, "newsletter.html"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	golden(t, "newsletter.inlined.golden", out)
+
+	lines := make([]string, len(warnings))
+	for i, w := range warnings {
+		lines[i] = w.String()
+	}
+	golden(t, "newsletter.warnings.golden", strings.Join(lines, "\n")+"\n")
+}
+
+func TestToText_Golden(t *testing.T) {
+	golden(t, "newsletter.txt.golden", htmlmail.ToText(readInput(t, "newsletter.html")))
+}
+
+func TestInlineCSS_Cascade(t *testing.T) {
+	out, _, err := htmlmail.InlineCSS(`<style>
+p { color: red; margin: 0 }
+.a { color: green }
+p.a { color: blue }
+#x { color: black; margin: 1px !important }
+</style><p class="a" id="x" style="margin: 2px; color: pink">x</p><p>y</p>`)
+	assert.NoError(t, err)
+	assert.Equal(t,
+		`<p class="a" id="x" style="color: pink; margin: 1px">x</p><p style="color: red; margin: 0">y</p>`,
+		out)
+}
+
+func TestInlineCSS_Fragment(t *testing.T) {
+	out, warnings, err := htmlmail.InlineCSS(`<p style="position: absolute">x</p>`)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p style="position: absolute">x</p>`, out)
+	if assert.Len(t, warnings, 1) {
+		assert.Equal(t, "position", warnings[0].Property)
+	}
+}
+
+func TestToText_Links(t *testing.T) {
+	got := htmlmail.ToText(`<p>Visit <a href="https://a.example">our site</a>, ` +
+		`<a href="https://a.example">again</a>, <a href="#top">top</a> and ` +
+		`<a href="https://b.example">https://b.example</a>.</p>`)
+	assert.Equal(t, "Visit our site [1], again [1], top and https://b.example.\n\n[1] https://a.example\n", got)
+}
+
+func TestToText_Persian(t *testing.T) {
+	got := htmlmail.ToText(`<div dir="rtl"><h2>سلام</h2><p>به <a href="https://example.com">فروشگاه</a> خوش آمدید.</p></div>`)
+	assert.Equal(t, "سلام\n----\n\nبه فروشگاه [1] خوش آمدید.\n\n[1] https://example.com\n", got)
+}
+
+func TestTrack(t *testing.T) {
+	link := func(href string) (string, bool) {
+		if strings.Contains(href, "unsubscribe") {
+			return "", false
+		}
+		return "https://t.example/c?u=" + href, true
+	}
+
+	out, err := htmlmail.Track(`<p><a href=" https://a.example/x?y=1&amp;z=2 ">a</a> <a href="mailto:a@example.org">m</a> `+
+		`<a href="#top">t</a> <a href="https://a.example/unsubscribe">u</a></p>`, link, "https://t.example/o")
+	assert.NoError(t, err)
+	assert.Equal(t, `<p><a href="https://t.example/c?u=https://a.example/x?y=1&amp;z=2">a</a> <a href="mailto:a@example.org">m</a> `+
+		`<a href="#top">t</a> <a href="https://a.example/unsubscribe">u</a></p>`+
+		`<img src="https://t.example/o" width="1" height="1" alt="" style="display:block;width:1px;height:1px;border:0"/>`, out)
+
+	out, err = htmlmail.Track(`<!DOCTYPE html><html><body><p>x</p></body></html>`, link, "https://t.example/o")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `<p>x</p><img src="https://t.example/o" width="1" height="1" alt="" style="display:block;width:1px;height:1px;border:0"/></body>`)
+}
@@ -0,0 +1,223 @@
+// Package htmlmail post-processes rendered HTML emails: it moves CSS from
+// <style> blocks into style attributes, which is the only styling every
+// client honours, and derives a text/plain alternative from the HTML. Track
+// prepares messages for open and click tracking.
+package htmlmail
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var documentRE = regexp.MustCompile(`(?i)<(!doctype|html)\b`)
+
+// InlineCSS applies the rules of every <style> block in src to the matching
+// elements' style attributes and removes the blocks. CSS that cannot be
+// inlined, such as media queries and :hover rules, is kept in a single
+// <style> block. The warnings report CSS that email clients do not support.
+//
+// src may be a full document or a fragment; fragments stay fragments.
+func InlineCSS(src string) (string, []Warning, error) {
+	var (
+		warnings []Warning
+		seen     = make(map[string]bool)
+	)
+	warn := func(w Warning) {
+		if k := w.String(); !seen[k] {
+			seen[k] = true
+			warnings = append(warnings, w)
+		}
+	}
+
+	nodes, err := parse(src)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sheet stylesheet
+	var styles []*html.Node
+	for _, root := range nodes {
+		walk(root, func(n *html.Node) {
+			if n.Type != html.ElementNode {
+				return
+			}
+			switch n.DataAtom {
+			case atom.Style:
+				styles = append(styles, n)
+				if n.FirstChild != nil {
+					sheet.parse(n.FirstChild.Data, warn)
+				}
+			case atom.Link:
+				if strings.EqualFold(attr(n, "rel"), "stylesheet") {
+					warn(Warning{Property: "<link rel=stylesheet>", Message: "external stylesheets are not loaded by email clients"})
+				}
+			}
+		})
+	}
+
+	// Existing style attributes are checked too.
+	for _, root := range nodes {
+		walk(root, func(n *html.Node) {
+			if v, ok := lookupAttr(n, "style"); ok && n.Type == html.ElementNode {
+				checkDeclarations("<"+n.Data+"> style attribute", parseDeclarations(v), warn)
+			}
+		})
+	}
+
+	if len(styles) == 0 {
+		return src, warnings, nil
+	}
+
+	for _, root := range nodes {
+		walk(root, func(n *html.Node) {
+			if n.Type == html.ElementNode && n.DataAtom != atom.Style {
+				applyRules(n, sheet.rules)
+			}
+		})
+	}
+
+	// Replace the first <style> block with the retained CSS and drop the rest.
+	for i, st := range styles {
+		if i == 0 && len(sheet.retained) > 0 {
+			st.FirstChild.Data = "\n" + strings.Join(sheet.retained, "\n") + "\n"
+			for c := st.FirstChild.NextSibling; c != nil; c = c.NextSibling {
+				st.RemoveChild(c)
+			}
+			continue
+		}
+		if st.Parent != nil {
+			st.Parent.RemoveChild(st)
+		} else {
+			nodes = removeNode(nodes, st)
+		}
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		if err := html.Render(&b, n); err != nil {
+			return "", nil, err
+		}
+	}
+	return b.String(), warnings, nil
+}
+
+// parse returns the top-level nodes of src. Documents are parsed as such;
+// anything else is parsed as the content of a <body> so that rendering the
+// nodes does not add <html> and <body> tags.
+func parse(src string) ([]*html.Node, error) {
+	if documentRE.MatchString(src) {
+		doc, err := html.Parse(strings.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		var nodes []*html.Node
+		for c := doc.FirstChild; c != nil; c = c.NextSibling {
+			nodes = append(nodes, c)
+		}
+		return nodes, nil
+	}
+	body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	return html.ParseFragment(strings.NewReader(src), body)
+}
+
+func removeNode(nodes []*html.Node, n *html.Node) []*html.Node {
+	out := nodes[:0]
+	for _, m := range nodes {
+		if m != n {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func walk(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; {
+		// Read the sibling first so fn may detach c.
+		next := c.NextSibling
+		walk(c, fn)
+		c = next
+	}
+}
+
+type match struct {
+	spec  [3]int
+	order int
+	decls []declaration
+}
+
+// applyRules merges the declarations of the rules matching n into its style
+// attribute following the cascade: rules by specificity and source order,
+// then the existing style attribute, then !important declarations.
+func applyRules(n *html.Node, rules []rule) {
+	var matched []match
+	for _, r := range rules {
+		if r.inlinable && r.sel.matches(n) {
+			matched = append(matched, match{spec: r.sel.specificity(), order: r.order, decls: r.decls})
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	sort.SliceStable(matched, func(i, j int) bool {
+		a, b := matched[i], matched[j]
+		if a.spec != b.spec {
+			for k := range a.spec {
+				if a.spec[k] != b.spec[k] {
+					return a.spec[k] < b.spec[k]
+				}
+			}
+		}
+		return a.order < b.order
+	})
+
+	var p properties
+	for _, m := range matched {
+		for _, d := range m.decls {
+			if !d.important {
+				p.set(d)
+			}
+		}
+	}
+	existing, _ := lookupAttr(n, "style")
+	for _, d := range parseDeclarations(existing) {
+		p.set(d)
+	}
+	for _, m := range matched {
+		for _, d := range m.decls {
+			if d.important {
+				p.set(d)
+			}
+		}
+	}
+	setAttr(n, "style", formatDeclarations(p.list, false))
+}
+
+// properties is an insertion-ordered set of declarations.
+type properties struct {
+	list []declaration
+}
+
+func (p *properties) set(d declaration) {
+	for i := range p.list {
+		if p.list[i].property == d.property {
+			p.list[i] = d
+			return
+		}
+	}
+	p.list = append(p.list, d)
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i := range n.Attr {
+		if n.Attr[i].Namespace == "" && n.Attr[i].Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,255 @@
+package htmlmail
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// errPseudo marks selectors with pseudo-classes or pseudo-elements. They
+// describe states such as :hover that have no inline equivalent, so their
+// rules are kept in a <style> block without a warning.
+var errPseudo = errors.New("pseudo-class")
+
+// selector is a chain of compound selectors, rightmost last.
+type selector struct {
+	parts []compound
+	// combinators[i] joins parts[i] and parts[i+1]: ' ' or '>'.
+	combinators []byte
+}
+
+type compound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrMatch
+}
+
+type attrMatch struct {
+	name  string
+	value string
+	// exists matches the attribute regardless of its value.
+	exists bool
+}
+
+// specificity orders rules as (ids, classes and attributes, types).
+func (s *selector) specificity() [3]int {
+	var sp [3]int
+	for _, c := range s.parts {
+		if c.id != "" {
+			sp[0]++
+		}
+		sp[1] += len(c.classes) + len(c.attrs)
+		if c.tag != "" {
+			sp[2]++
+		}
+	}
+	return sp
+}
+
+// parseSelector parses the subset of CSS selectors that can be inlined:
+// type, universal, class, id and attribute selectors combined with
+// descendant and child combinators.
+func parseSelector(raw string) (*selector, error) {
+	s := &selector{}
+	cur := compound{}
+	empty := true
+	pending := byte(0)
+
+	flush := func() error {
+		if empty {
+			return errors.New("empty compound selector")
+		}
+		if len(s.parts) > 0 {
+			if pending == 0 {
+				pending = ' '
+			}
+			s.combinators = append(s.combinators, pending)
+		}
+		s.parts = append(s.parts, cur)
+		cur, empty, pending = compound{}, true, 0
+		return nil
+	}
+
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if !empty {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			i++
+		case c == '>':
+			if !empty {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if len(s.parts) == 0 {
+				return nil, errors.New("selector starts with a combinator")
+			}
+			pending = '>'
+			i++
+		case c == '+' || c == '~':
+			return nil, errors.New("sibling combinators are not supported")
+		case c == ':':
+			return nil, errPseudo
+		case c == '*':
+			empty = false
+			i++
+		case c == '.' || c == '#':
+			name, n := readIdent(raw[i+1:])
+			if name == "" {
+				return nil, errors.New("missing name after " + string(c))
+			}
+			if c == '.' {
+				cur.classes = append(cur.classes, name)
+			} else {
+				cur.id = name
+			}
+			empty = false
+			i += 1 + n
+		case c == '[':
+			end := strings.IndexByte(raw[i:], ']')
+			if end < 0 {
+				return nil, errors.New("unterminated attribute selector")
+			}
+			m, err := parseAttr(raw[i+1 : i+end])
+			if err != nil {
+				return nil, err
+			}
+			cur.attrs = append(cur.attrs, m)
+			empty = false
+			i += end + 1
+		default:
+			name, n := readIdent(raw[i:])
+			if name == "" {
+				return nil, errors.New("unexpected " + string(c))
+			}
+			cur.tag = strings.ToLower(name)
+			empty = false
+			i += n
+		}
+	}
+	if pending != 0 && empty {
+		return nil, errors.New("selector ends with a combinator")
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func readIdent(s string) (string, int) {
+	n := 0
+	for n < len(s) {
+		c := s[n]
+		if c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80 {
+			n++
+			continue
+		}
+		break
+	}
+	return s[:n], n
+}
+
+func parseAttr(s string) (attrMatch, error) {
+	name, value, ok := strings.Cut(s, "=")
+	name = strings.ToLower(strings.TrimSpace(name))
+	if !ok {
+		return attrMatch{name: name, exists: true}, nil
+	}
+	if strings.ContainsAny(name, "~|^$*") {
+		return attrMatch{}, errors.New("only [attr] and [attr=value] are supported")
+	}
+	value = strings.Trim(strings.TrimSpace(value), `"'`)
+	return attrMatch{name: name, value: value}, nil
+}
+
+// matches reports whether n matches the selector.
+func (s *selector) matches(n *html.Node) bool {
+	return s.matchFrom(n, len(s.parts)-1)
+}
+
+func (s *selector) matchFrom(n *html.Node, i int) bool {
+	if !s.parts[i].matches(n) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	switch s.combinators[i-1] {
+	case '>':
+		p := parentElement(n)
+		return p != nil && s.matchFrom(p, i-1)
+	default:
+		for p := parentElement(n); p != nil; p = parentElement(p) {
+			if s.matchFrom(p, i-1) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func (c *compound) matches(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && c.tag != n.Data {
+		return false
+	}
+	if c.id != "" && attr(n, "id") != c.id {
+		return false
+	}
+	if len(c.classes) > 0 {
+		have := strings.Fields(attr(n, "class"))
+		for _, want := range c.classes {
+			if !contains(have, want) {
+				return false
+			}
+		}
+	}
+	for _, a := range c.attrs {
+		v, ok := lookupAttr(n, a.name)
+		if !ok || !a.exists && v != a.value {
+			return false
+		}
+	}
+	return true
+}
+
+func parentElement(n *html.Node) *html.Node {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode {
+			return p
+		}
+	}
+	return nil
+}
+
+func attr(n *html.Node, name string) string {
+	v, _ := lookupAttr(n, name)
+	return v
+}
+
+func lookupAttr(n *html.Node, name string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+package htmlmail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Warning reports CSS that email clients do not support.
+type Warning struct {
+	// Property is the CSS property, at-rule or selector concerned.
+	Property string
+	Message  string
+}
+
+func (w Warning) String() string {
+	return w.Property + ": " + w.Message
+}
+
+// unsupportedProperties lists properties that the major clients (Gmail,
+// Outlook for Windows, Yahoo) ignore or render inconsistently.
+var unsupportedProperties = map[string]string{
+	"position":     "ignored by Gmail and Outlook",
+	"z-index":      "ignored by Gmail and Outlook",
+	"float":        "ignored by Outlook",
+	"box-shadow":   "ignored by Outlook",
+	"transform":    "ignored by Outlook and many webmail clients",
+	"transition":   "ignored by most email clients",
+	"animation":    "ignored by most email clients",
+	"filter":       "ignored by most email clients",
+	"clip-path":    "ignored by most email clients",
+	"object-fit":   "ignored by Outlook and Gmail",
+	"overflow":     "ignored by Outlook",
+	"content":      "ignored outside pseudo-elements",
+	"column-count": "ignored by Outlook and Gmail",
+}
+
+// unsupportedPrefixes covers property families.
+var unsupportedPrefixes = map[string]string{
+	"flex":        "flexbox layout is not supported by Outlook",
+	"grid":        "grid layout is not supported by most email clients",
+	"animation-":  "ignored by most email clients",
+	"transition-": "ignored by most email clients",
+}
+
+// checkDeclarations reports unsupported declarations of the rule or element
+// named by where.
+func checkDeclarations(where string, decls []declaration, warn func(Warning)) {
+	for _, d := range decls {
+		if msg := unsupported(d); msg != "" {
+			warn(Warning{Property: d.property, Message: fmt.Sprintf("%s (in %s)", msg, where)})
+		}
+	}
+}
+
+func unsupported(d declaration) string {
+	if msg, ok := unsupportedProperties[d.property]; ok {
+		return msg
+	}
+	for prefix, msg := range unsupportedPrefixes {
+		if strings.HasPrefix(d.property, prefix) {
+			return msg
+		}
+	}
+	if strings.HasPrefix(d.property, "--") || strings.Contains(d.value, "var(") {
+		return "CSS variables are not supported by Gmail or Outlook"
+	}
+	if d.property == "display" {
+		switch strings.ToLower(d.value) {
+		case "flex", "inline-flex":
+			return "flexbox layout is not supported by Outlook"
+		case "grid", "inline-grid":
+			return "grid layout is not supported by most email clients"
+		}
+	}
+	return ""
+}
@@ -0,0 +1,290 @@
+package htmlmail
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var blankLinesRE = regexp.MustCompile(`\n{3,}`)
+
+// ToText converts an HTML email into a readable plain text alternative.
+// Headings are underlined, list items get bullets or numbers, and link
+// targets are collected as numbered footnotes.
+func ToText(src string) string {
+	doc, err := html.Parse(strings.NewReader(src))
+	if err != nil {
+		return ""
+	}
+	notes := &footnotes{index: make(map[string]int)}
+	w := &textWriter{notes: notes}
+	w.children(doc)
+
+	out := w.String()
+	if len(notes.urls) > 0 {
+		var b strings.Builder
+		b.WriteString(out)
+		b.WriteString("\n\n")
+		for i, u := range notes.urls {
+			fmt.Fprintf(&b, "[%d] %s\n", i+1, u)
+		}
+		out = b.String()
+	}
+	return tidy(out)
+}
+
+type footnotes struct {
+	urls  []string
+	index map[string]int
+}
+
+// ref returns the footnote number of u, adding it if needed.
+func (f *footnotes) ref(u string) int {
+	if n, ok := f.index[u]; ok {
+		return n
+	}
+	f.urls = append(f.urls, u)
+	f.index[u] = len(f.urls)
+	return len(f.urls)
+}
+
+type list struct {
+	ordered bool
+	n       int
+}
+
+type textWriter struct {
+	b     strings.Builder
+	notes *footnotes
+	lists []list
+	pre   int
+	// space is set when whitespace was seen and not yet written.
+	space bool
+	// newlines counts the newlines at the end of b.
+	newlines int
+}
+
+func (w *textWriter) String() string {
+	return w.b.String()
+}
+
+func (w *textWriter) atLineStart() bool {
+	return w.b.Len() == 0 || w.newlines > 0
+}
+
+// text writes s, collapsing whitespace outside <pre>.
+func (w *textWriter) text(s string) {
+	if w.pre > 0 {
+		w.raw(s)
+		return
+	}
+	for _, r := range s {
+		if unicode.IsSpace(r) {
+			w.space = true
+			continue
+		}
+		if w.space && !w.atLineStart() && !strings.HasSuffix(w.b.String(), " ") {
+			w.b.WriteByte(' ')
+		}
+		w.space = false
+		w.b.WriteRune(r)
+		w.newlines = 0
+	}
+}
+
+func (w *textWriter) raw(s string) {
+	if s == "" {
+		return
+	}
+	w.b.WriteString(s)
+	trailing := len(s) - len(strings.TrimRight(s, "\n"))
+	if trailing == len(s) {
+		w.newlines += trailing
+	} else {
+		w.newlines = trailing
+	}
+	w.space = false
+}
+
+// block ends the current line and leaves n-1 blank lines, unless nothing
+// has been written yet.
+func (w *textWriter) block(n int) {
+	w.space = false
+	if w.b.Len() == 0 {
+		return
+	}
+	for w.newlines < n {
+		w.b.WriteByte('\n')
+		w.newlines++
+	}
+}
+
+func (w *textWriter) children(n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		w.node(c)
+	}
+}
+
+// inner renders the children of n on a separate writer sharing the
+// footnotes and returns the text on one line.
+func (w *textWriter) inner(n *html.Node) string {
+	sub := &textWriter{notes: w.notes}
+	sub.children(n)
+	return strings.Join(strings.Fields(sub.String()), " ")
+}
+
+func (w *textWriter) node(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		w.text(n.Data)
+		return
+	case html.ElementNode:
+	default:
+		w.children(n)
+		return
+	}
+
+	switch n.DataAtom {
+	case atom.Head, atom.Style, atom.Script, atom.Title, atom.Template:
+		return
+	case atom.Br:
+		w.raw("\n")
+	case atom.Hr:
+		w.block(2)
+		w.raw(strings.Repeat("-", 40))
+		w.block(2)
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		w.heading(n)
+	case atom.P, atom.Table, atom.Blockquote, atom.Section, atom.Article, atom.Header, atom.Footer:
+		w.block(2)
+		w.children(n)
+		w.block(2)
+	case atom.Div, atom.Tr, atom.Center, atom.Address, atom.Dd, atom.Dt:
+		w.block(1)
+		w.children(n)
+		w.block(1)
+	case atom.Td, atom.Th:
+		w.children(n)
+		w.space = true
+	case atom.Ul, atom.Ol:
+		w.list(n)
+	case atom.Li:
+		w.item(n)
+	case atom.Pre:
+		w.block(2)
+		w.pre++
+		w.children(n)
+		w.pre--
+		w.block(2)
+	case atom.A:
+		w.link(n)
+	case atom.Img:
+		if alt := strings.TrimSpace(attr(n, "alt")); alt != "" {
+			w.text(" " + alt + " ")
+		}
+	default:
+		w.children(n)
+	}
+}
+
+func (w *textWriter) heading(n *html.Node) {
+	text := w.inner(n)
+	if text == "" {
+		return
+	}
+	w.block(2)
+	switch n.DataAtom {
+	case atom.H1:
+		text = strings.ToUpper(text)
+		w.raw(text + "\n" + strings.Repeat("=", utf8.RuneCountInString(text)))
+	case atom.H2:
+		w.raw(text + "\n" + strings.Repeat("-", utf8.RuneCountInString(text)))
+	default:
+		w.raw(text)
+	}
+	w.block(2)
+}
+
+func (w *textWriter) list(n *html.Node) {
+	if len(w.lists) == 0 {
+		w.block(2)
+	} else {
+		w.block(1)
+	}
+	w.lists = append(w.lists, list{ordered: n.DataAtom == atom.Ol})
+	w.children(n)
+	w.lists = w.lists[:len(w.lists)-1]
+	if len(w.lists) == 0 {
+		w.block(2)
+	} else {
+		w.block(1)
+	}
+}
+
+func (w *textWriter) item(n *html.Node) {
+	w.block(1)
+	depth := len(w.lists)
+	marker := "* "
+	if depth > 0 {
+		l := &w.lists[depth-1]
+		l.n++
+		if l.ordered {
+			marker = fmt.Sprintf("%d. ", l.n)
+		}
+	} else {
+		depth = 1
+	}
+	w.raw(strings.Repeat("  ", depth-1) + marker)
+	w.children(n)
+	w.block(1)
+}
+
+func (w *textWriter) link(n *html.Node) {
+	href := strings.TrimSpace(attr(n, "href"))
+	text := w.inner(n)
+	target, ok := linkTarget(href)
+	switch {
+	case !ok:
+		w.text(text)
+	case text == "":
+		w.text(" " + target + " ")
+	case text == target || "mailto:"+text == target:
+		w.text(text)
+	default:
+		w.text(fmt.Sprintf("%s [%d]", text, w.notes.ref(target)))
+	}
+}
+
+// linkTarget returns the footnote for href, or false for links that lead
+// nowhere outside the message.
+func linkTarget(href string) (string, bool) {
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto", "tel":
+		return href, true
+	}
+	return "", false
+}
+
+// tidy trims trailing spaces from lines and collapses runs of blank lines.
+func tidy(s string) string {
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimRightFunc(l, unicode.IsSpace)
+	}
+	s = strings.Join(lines, "\n")
+	s = blankLinesRE.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s) + "\n"
+}
@@ -0,0 +1,78 @@
+package htmlmail
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Track prepares src for open and click tracking. The href of every http
+// and https link is replaced by link(href), unless link returns false, and
+// a 1x1 image loading pixelURL is appended to the body unless pixelURL is
+// empty.
+//
+// src may be a full document or a fragment; fragments stay fragments.
+func Track(src string, link func(href string) (string, bool), pixelURL string) (string, error) {
+	nodes, err := parse(src)
+	if err != nil {
+		return "", err
+	}
+	var body *html.Node
+	for _, root := range nodes {
+		walk(root, func(n *html.Node) {
+			if n.Type != html.ElementNode {
+				return
+			}
+			switch n.DataAtom {
+			case atom.Body:
+				body = n
+			case atom.A, atom.Area:
+				href, ok := lookupAttr(n, "href")
+				if !ok || !trackable(href) {
+					return
+				}
+				if tracked, ok := link(strings.TrimSpace(href)); ok {
+					setAttr(n, "href", tracked)
+				}
+			}
+		})
+	}
+
+	if pixelURL != "" {
+		img := &html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img, Attr: []html.Attribute{
+			{Key: "src", Val: pixelURL},
+			{Key: "width", Val: "1"},
+			{Key: "height", Val: "1"},
+			{Key: "alt", Val: ""},
+			{Key: "style", Val: "display:block;width:1px;height:1px;border:0"},
+		}}
+		if body != nil {
+			body.AppendChild(img)
+		} else {
+			nodes = append(nodes, img)
+		}
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		if err := html.Render(&b, n); err != nil {
+			return "", err
+		}
+	}
+	return b.String(), nil
+}
+
+// trackable reports whether href is an absolute web link.
+func trackable(href string) bool {
+	u, err := url.Parse(strings.TrimSpace(href))
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,565 @@
+// Package inbound is a receiving SMTP server (RFC 5321) for the mail that
+// comes back from campaigns: bounces, feedback loop reports and replies.
+//
+// It accepts mail for a fixed set of domains only and never relays. Each
+// message is handed to a Handler once the client has sent it; a handler
+// error is reported to the client as a temporary failure, so the sending
+// MTA keeps the message and retries.
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"net/textproto"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultMaxMessageBytes = 25 << 20
+	DefaultMaxRecipients   = 100
+	DefaultTimeout         = 5 * time.Minute
+	DefaultMaxConns        = 100
+	DefaultMaxConnsPerIP   = 10
+
+	// maxLineLength bounds command lines. RFC 5321 allows 512 octets;
+	// extensions make some clients send more.
+	maxLineLength = 4096
+	// maxErrors is how many failed commands end a session.
+	maxErrors = 10
+)
+
+// ErrServerClosed is returned by Serve after Close.
+var ErrServerClosed = errors.New("inbound: server closed")
+
+var (
+	errLineTooLong  = errors.New("line too long")
+	errTooManyConns = errors.New("too many connections")
+)
+
+// Handler receives the messages the server accepts.
+type Handler interface {
+	// Deliver handles a message from the envelope sender from, which is
+	// empty for the null sender of bounces, to the envelope recipients to.
+	// raw is the message with a Received header added, with LF line
+	// endings.
+	Deliver(ctx context.Context, from string, to []string, raw []byte) error
+}
+
+// Options configures a Server. Zero values select the defaults.
+type Options struct {
+	// Hostname is announced in the greeting and Received headers. Defaults
+	// to the system hostname.
+	Hostname string
+	// Domains lists the domains mail is accepted for, in any case.
+	Domains []string
+	// MaxMessageBytes bounds the size of a message.
+	MaxMessageBytes int64
+	// MaxRecipients bounds the recipients of a message.
+	MaxRecipients int
+	// Timeout bounds each command, the transfer of a message and its
+	// delivery to the handler.
+	Timeout time.Duration
+	// TLSConfig enables STARTTLS when set.
+	TLSConfig *tls.Config
+	// MaxConns bounds the open connections. Clients connecting beyond it
+	// are told to try again later.
+	MaxConns int
+	// MaxConnsPerIP bounds the open connections of one client address, or
+	// of one /64 network for IPv6 clients.
+	MaxConnsPerIP int
+}
+
+// Server is an SMTP server passing the messages it receives to a Handler.
+type Server struct {
+	handler Handler
+	opts    Options
+	domains map[string]bool
+	logger  *zap.SugaredLogger
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	clients   map[netip.Prefix]int
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a Server delivering to h.
+func New(h Handler, opts Options, logger *zap.SugaredLogger) *Server {
+	if opts.Hostname == "" {
+		opts.Hostname, _ = os.Hostname()
+	}
+	if opts.Hostname == "" {
+		opts.Hostname = "localhost"
+	}
+	if opts.MaxMessageBytes <= 0 {
+		opts.MaxMessageBytes = DefaultMaxMessageBytes
+	}
+	if opts.MaxRecipients <= 0 {
+		opts.MaxRecipients = DefaultMaxRecipients
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.MaxConns <= 0 {
+		opts.MaxConns = DefaultMaxConns
+	}
+	if opts.MaxConnsPerIP <= 0 {
+		opts.MaxConnsPerIP = DefaultMaxConnsPerIP
+	}
+	domains := make(map[string]bool, len(opts.Domains))
+	for _, d := range opts.Domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains[d] = true
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Server{
+		handler:   h,
+		opts:      opts,
+		domains:   domains,
+		logger:    logger,
+		ctx:       ctx,
+		cancel:    cancel,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+		clients:   make(map[netip.Prefix]int),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections
+// until Close.
+func (s *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve serves the connections accepted on l until Close. It always
+// returns a non-nil error, ErrServerClosed after Close.
+func (s *Server) Serve(l net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		l.Close()
+		return ErrServerClosed
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		nc, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, l)
+			s.mu.Unlock()
+			if closed {
+				return ErrServerClosed
+			}
+			var ne net.Error
+			if errors.As(err, &ne) && ne.Timeout() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+		switch err := s.track(nc); {
+		case errors.Is(err, errTooManyConns):
+			s.refuse(nc)
+			continue
+		case err != nil:
+			nc.Close()
+			return err
+		}
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(nc)
+			s.newSession(nc).serve()
+		}()
+	}
+}
+
+// Close stops the listeners and closes open connections, aborting the
+// messages being received, and waits for their handlers to return.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for l := range s.listeners {
+		l.Close()
+	}
+	for nc := range s.conns {
+		nc.Close()
+	}
+	s.mu.Unlock()
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+// track registers nc as open. It fails with ErrServerClosed after Close,
+// and with errTooManyConns when the server or the client is at its
+// connection limit.
+func (s *Server) track(nc net.Conn) error {
+	client := clientOf(nc)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closed:
+		return ErrServerClosed
+	case len(s.conns) >= s.opts.MaxConns, s.clients[client] >= s.opts.MaxConnsPerIP:
+		return errTooManyConns
+	}
+	s.conns[nc] = struct{}{}
+	s.clients[client]++
+	s.wg.Add(1)
+	return nil
+}
+
+func (s *Server) untrack(nc net.Conn) {
+	client := clientOf(nc)
+	s.mu.Lock()
+	delete(s.conns, nc)
+	if s.clients[client]--; s.clients[client] <= 0 {
+		delete(s.clients, client)
+	}
+	s.mu.Unlock()
+	nc.Close()
+}
+
+// refuse tells a client over the connection limits to try again later and
+// closes its connection. The reply fits in the socket buffer of a new
+// connection, so writing it does not hold up the accept loop; the deadline
+// covers the rest.
+func (s *Server) refuse(nc net.Conn) {
+	nc.SetWriteDeadline(time.Now().Add(time.Second))
+	fmt.Fprintf(nc, "421 4.7.0 %s Too many connections, try again later\r\n", s.opts.Hostname)
+	nc.Close()
+}
+
+// clientOf returns the network the connection limit per client applies to:
+// the client's address, or its /64 for IPv6, since a single host usually
+// has a whole /64 to connect from.
+func clientOf(nc net.Conn) netip.Prefix {
+	ap, err := netip.ParseAddrPort(nc.RemoteAddr().String())
+	if err != nil {
+		return netip.Prefix{}
+	}
+	addr := ap.Addr().Unmap().WithZone("")
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	p, _ := addr.Prefix(bits)
+	return p
+}
+
+// acceptsRecipient reports whether mail for addr is accepted: addresses
+// at one of the domains, and postmaster, which RFC 5321 requires.
+func (s *Server) acceptsRecipient(addr string) bool {
+	at := strings.LastIndexByte(addr, '@')
+	if at < 0 {
+		return strings.EqualFold(addr, "postmaster")
+	}
+	return s.domains[strings.ToLower(addr[at+1:])]
+}
+
+// session is the state of one client connection.
+type session struct {
+	s      *Server
+	nc     net.Conn
+	br     *bufio.Reader
+	bw     *bufio.Writer
+	tls    bool
+	helo   string
+	esmtp  bool
+	errors int
+
+	// The current transaction; inTx is set by MAIL.
+	inTx bool
+	from string
+	to   []string
+}
+
+func (s *Server) newSession(nc net.Conn) *session {
+	return &session{
+		s:  s,
+		nc: nc,
+		br: bufio.NewReaderSize(nc, maxLineLength),
+		bw: bufio.NewWriter(nc),
+	}
+}
+
+func (c *session) serve() {
+	if err := c.reply(220, "%s ESMTP ready", c.s.opts.Hostname); err != nil {
+		return
+	}
+	for {
+		c.nc.SetDeadline(time.Now().Add(c.s.opts.Timeout))
+		line, err := c.readLine()
+		if errors.Is(err, errLineTooLong) {
+			if c.fail(500, "5.5.2 Line too long") != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+		arg = strings.TrimSpace(arg)
+		switch strings.ToUpper(verb) {
+		case "HELO", "EHLO":
+			err = c.hello(strings.ToUpper(verb) == "EHLO", arg)
+		case "STARTTLS":
+			err = c.startTLS()
+		case "MAIL":
+			err = c.mail(arg)
+		case "RCPT":
+			err = c.rcpt(arg)
+		case "DATA":
+			err = c.data()
+		case "RSET":
+			c.reset()
+			err = c.reply(250, "2.0.0 OK")
+		case "NOOP":
+			err = c.reply(250, "2.0.0 OK")
+		case "VRFY":
+			err = c.reply(252, "2.5.0 Cannot verify the user")
+		case "HELP":
+			err = c.reply(214, "2.0.0 See RFC 5321")
+		case "QUIT":
+			c.reply(221, "2.0.0 Bye")
+			return
+		default:
+			err = c.fail(500, "5.5.2 Command not recognized")
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *session) hello(extended bool, domain string) error {
+	if domain == "" {
+		return c.fail(501, "5.5.4 Domain required")
+	}
+	c.reset()
+	c.helo, c.esmtp = domain, extended
+	if !extended {
+		return c.reply(250, "%s", c.s.opts.Hostname)
+	}
+	lines := []string{
+		c.s.opts.Hostname,
+		"PIPELINING",
+		"8BITMIME",
+		"SMTPUTF8",
+		"ENHANCEDSTATUSCODES",
+		"SIZE " + strconv.FormatInt(c.s.opts.MaxMessageBytes, 10),
+	}
+	if c.s.opts.TLSConfig != nil && !c.tls {
+		lines = append(lines, "STARTTLS")
+	}
+	for i, l := range lines {
+		sep := "-"
+		if i == len(lines)-1 {
+			sep = " "
+		}
+		fmt.Fprintf(c.bw, "250%s%s\r\n", sep, l)
+	}
+	return c.bw.Flush()
+}
+
+func (c *session) startTLS() error {
+	switch {
+	case c.s.opts.TLSConfig == nil:
+		return c.fail(502, "5.5.1 STARTTLS not supported")
+	case c.tls:
+		return c.fail(503, "5.5.1 TLS already active")
+	}
+	if err := c.reply(220, "2.0.0 Ready to start TLS"); err != nil {
+		return err
+	}
+	tc := tls.Server(c.nc, c.s.opts.TLSConfig)
+	if err := tc.Handshake(); err != nil {
+		return err
+	}
+	// Commands pipelined before the handshake are discarded along with
+	// the old reader, and the client starts over with EHLO.
+	c.nc, c.tls = tc, true
+	c.br = bufio.NewReaderSize(tc, maxLineLength)
+	c.bw = bufio.NewWriter(tc)
+	c.helo, c.esmtp = "", false
+	c.reset()
+	return nil
+}
+
+func (c *session) mail(arg string) error {
+	switch {
+	case c.helo == "":
+		return c.fail(503, "5.5.1 Send HELO first")
+	case c.inTx:
+		return c.fail(503, "5.5.1 Nested MAIL command")
+	}
+	addr, params, ok := parsePath(arg, "FROM:")
+	if !ok {
+		return c.fail(501, "5.5.4 Syntax: MAIL FROM:<address>")
+	}
+	for _, p := range params {
+		name, value, _ := strings.Cut(p, "=")
+		if !strings.EqualFold(name, "SIZE") {
+			continue
+		}
+		if size, err := strconv.ParseInt(value, 10, 64); err == nil && size > c.s.opts.MaxMessageBytes {
+			return c.fail(552, "5.3.4 Message too big")
+		}
+	}
+	c.inTx, c.from, c.to = true, addr, nil
+	return c.reply(250, "2.1.0 OK")
+}
+
+func (c *session) rcpt(arg string) error {
+	if !c.inTx {
+		return c.fail(503, "5.5.1 Send MAIL first")
+	}
+	addr, _, ok := parsePath(arg, "TO:")
+	if !ok || addr == "" {
+		return c.fail(501, "5.5.4 Syntax: RCPT TO:<address>")
+	}
+	if !c.s.acceptsRecipient(addr) {
+		return c.fail(550, "5.7.1 Relaying denied")
+	}
+	if len(c.to) >= c.s.opts.MaxRecipients {
+		return c.reply(452, "4.5.3 Too many recipients")
+	}
+	c.to = append(c.to, addr)
+	return c.reply(250, "2.1.5 OK")
+}
+
+func (c *session) data() error {
+	if !c.inTx || len(c.to) == 0 {
+		return c.fail(503, "5.5.1 Send RCPT first")
+	}
+	if err := c.reply(354, "End data with <CR><LF>.<CR><LF>"); err != nil {
+		return err
+	}
+	dr := textproto.NewReader(c.br).DotReader()
+	body, err := io.ReadAll(io.LimitReader(dr, c.s.opts.MaxMessageBytes+1))
+	if err != nil {
+		return err
+	}
+	from, to := c.from, c.to
+	c.reset()
+	if int64(len(body)) > c.s.opts.MaxMessageBytes {
+		if _, err := io.Copy(io.Discard, dr); err != nil {
+			return err
+		}
+		return c.reply(552, "5.3.4 Message too big")
+	}
+
+	raw := append([]byte(c.received(to)), body...)
+	ctx, cancel := context.WithTimeout(c.s.ctx, c.s.opts.Timeout)
+	defer cancel()
+	if err := c.s.handler.Deliver(ctx, from, to, raw); err != nil {
+		c.s.logger.Errorf("deliver message from %q to %v: %v", from, to, err)
+		return c.reply(451, "4.3.0 Temporary failure, try again later")
+	}
+	return c.reply(250, "2.0.0 OK")
+}
+
+// received returns the Received trace header of a message to rcpts.
+func (c *session) received(rcpts []string) string {
+	with := "SMTP"
+	if c.esmtp {
+		with = "ESMTP"
+		if c.tls {
+			with = "ESMTPS"
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Received: from %s (%s)\n\tby %s with %s", c.helo, c.nc.RemoteAddr(), c.s.opts.Hostname, with)
+	if len(rcpts) == 1 {
+		fmt.Fprintf(&b, "\n\tfor <%s>", rcpts[0])
+	}
+	fmt.Fprintf(&b, "; %s\n", time.Now().Format(time.RFC1123Z))
+	return b.String()
+}
+
+func (c *session) reset() {
+	c.inTx, c.from, c.to = false, "", nil
+}
+
+func (c *session) reply(code int, format string, args ...any) error {
+	fmt.Fprintf(c.bw, "%d %s\r\n", code, fmt.Sprintf(format, args...))
+	return c.bw.Flush()
+}
+
+// fail replies with an error and ends the session if the client made too
+// many.
+func (c *session) fail(code int, msg string) error {
+	c.errors++
+	if c.errors >= maxErrors {
+		c.reply(421, "4.7.0 %s Too many errors, closing connection", c.s.opts.Hostname)
+		return errors.New("too many errors")
+	}
+	return c.reply(code, "%s", msg)
+}
+
+// readLine reads a command line without its line ending. Lines longer than
+// maxLineLength are skipped and reported as errLineTooLong.
+func (c *session) readLine() (string, error) {
+	line, err := c.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		for errors.Is(err, bufio.ErrBufferFull) {
+			_, err = c.br.ReadSlice('\n')
+		}
+		if err != nil {
+			return "", err
+		}
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// parsePath parses the argument of MAIL or RCPT, "FROM:<addr> PARAMS" or
+// "TO:<addr> PARAMS". The null path "<>" yields an empty address.
+func parsePath(arg, prefix string) (addr string, params []string, ok bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", nil, false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	if !strings.HasPrefix(rest, "<") {
+		return "", nil, false
+	}
+	end := strings.IndexByte(rest, '>')
+	if end < 0 {
+		return "", nil, false
+	}
+	addr = rest[1:end]
+	// Drop a source route, "<@a,@b:user@domain>".
+	if strings.HasPrefix(addr, "@") {
+		if colon := strings.IndexByte(addr, ':'); colon >= 0 {
+			addr = addr[colon+1:]
+		}
+	}
+	return addr, strings.Fields(rest[end+1:]), true
+}
@@ -0,0 +1,287 @@
+package inbound_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/inbound"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type message struct {
+	from string
+	to   []string
+	raw  string
+}
+
+// recordingHandler records the messages delivered, failing while err is
+// set.
+type recordingHandler struct {
+	mu   sync.Mutex
+	msgs []message
+	err  error
+}
+
+func (h *recordingHandler) Deliver(ctx context.Context, from string, to []string, raw []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err != nil {
+		return h.err
+	}
+	h.msgs = append(h.msgs, message{from, to, string(raw)})
+	return nil
+}
+
+func (h *recordingHandler) received() []message {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]message(nil), h.msgs...)
+}
+
+// start serves h on a loopback port and returns the address.
+func start(t *testing.T, h inbound.Handler, opts inbound.Options) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.Hostname = "mx.mailer.example"
+	opts.Domains = []string{"bounce.mailer.example", "Reply.Mailer.Example"}
+	s := inbound.New(h, opts, zap.NewNop().Sugar())
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	t.Cleanup(func() {
+		s.Close()
+		assert.ErrorIs(t, <-done, inbound.ErrServerClosed)
+	})
+	return l.Addr().String()
+}
+
+// send sends body from from to to over a new connection.
+func send(addr, from string, to []string, body string) error {
+	c, err := smtp.Dial(addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if err := c.Hello("mx.example.org"); err != nil {
+		return err
+	}
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write([]byte(body)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// code returns the SMTP reply code of err, or 0.
+func code(err error) int {
+	var e *textproto.Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return 0
+}
+
+func TestServer_Deliver(t *testing.T) {
+	h := &recordingHandler{}
+	addr := start(t, h, inbound.Options{})
+
+	body := "From: bob@example.org\r\nSubject: Re: Spring sale\r\n\r\nThanks!\r\n.leading dot\r\n"
+	err := send(addr, "bob@example.org", []string{"reply+1-abc@reply.mailer.example", "Postmaster"}, body)
+	if !assert.NoError(t, err) {
+		return
+	}
+	msgs := h.received()
+	if !assert.Len(t, msgs, 1) {
+		return
+	}
+	assert.Equal(t, "bob@example.org", msgs[0].from)
+	assert.Equal(t, []string{"reply+1-abc@reply.mailer.example", "Postmaster"}, msgs[0].to)
+	assert.True(t, strings.HasPrefix(msgs[0].raw, "Received: from mx.example.org (127.0.0.1:"), msgs[0].raw)
+	assert.Contains(t, msgs[0].raw, "by mx.mailer.example with ESMTP;")
+	assert.True(t, strings.HasSuffix(msgs[0].raw, "\n"+strings.ReplaceAll(body, "\r\n", "\n")), msgs[0].raw)
+}
+
+func TestServer_NullSender(t *testing.T) {
+	h := &recordingHandler{}
+	addr := start(t, h, inbound.Options{})
+
+	c, err := smtp.Dial(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	// net/smtp cannot send MAIL FROM:<>.
+	for _, cmd := range []struct {
+		line string
+		code int
+	}{
+		{"EHLO mx.example.org", 250},
+		{"MAIL FROM:<> SIZE=1000", 250},
+		{"RCPT TO:<bounces+1-abc@BOUNCE.mailer.example>", 250},
+		{"DATA", 354},
+	} {
+		id, err := c.Text.Cmd("%s", cmd.line)
+		if !assert.NoError(t, err) {
+			return
+		}
+		c.Text.StartResponse(id)
+		_, _, err = c.Text.ReadResponse(cmd.code)
+		c.Text.EndResponse(id)
+		if !assert.NoError(t, err, cmd.line) {
+			return
+		}
+	}
+	w := c.Text.DotWriter()
+	w.Write([]byte("Subject: Undelivered Mail\r\n\r\nSorry.\r\n"))
+	w.Close()
+	_, _, err = c.Text.ReadResponse(250)
+	assert.NoError(t, err)
+
+	if msgs := h.received(); assert.Len(t, msgs, 1) {
+		assert.Equal(t, "", msgs[0].from)
+	}
+}
+
+func TestServer_Rejects(t *testing.T) {
+	h := &recordingHandler{}
+	addr := start(t, h, inbound.Options{MaxMessageBytes: 100, MaxRecipients: 1})
+
+	err := send(addr, "spammer@example.net", []string{"victim@example.org"}, "Hi\r\n")
+	assert.Equal(t, 550, code(err), err)
+
+	err = send(addr, "bob@example.org", []string{"a@bounce.mailer.example", "b@bounce.mailer.example"}, "Hi\r\n")
+	assert.Equal(t, 452, code(err), err)
+
+	err = send(addr, "bob@example.org", []string{"a@bounce.mailer.example"}, strings.Repeat("x", 200)+"\r\n")
+	assert.Equal(t, 552, code(err), err)
+
+	h.err = errors.New("database down")
+	err = send(addr, "bob@example.org", []string{"a@bounce.mailer.example"}, "Hi\r\n")
+	assert.Equal(t, 451, code(err), err)
+
+	assert.Empty(t, h.received())
+}
+
+func TestServer_ConnectionLimits(t *testing.T) {
+	greeting := func(addr string) (*textproto.Conn, int) {
+		c, err := textproto.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		code, _, err := c.ReadResponse(0)
+		if err != nil && code == 0 {
+			t.Fatal(err)
+		}
+		return c, code
+	}
+	for name, opts := range map[string]inbound.Options{
+		"server": {MaxConns: 1, MaxConnsPerIP: 5},
+		"client": {MaxConns: 5, MaxConnsPerIP: 1},
+	} {
+		addr := start(t, &recordingHandler{}, opts)
+
+		first, code := greeting(addr)
+		assert.Equal(t, 220, code, name)
+		second, code := greeting(addr)
+		assert.Equal(t, 421, code, name)
+		second.Close()
+
+		// The slot is free again once the first client leaves.
+		first.Close()
+		assert.Eventually(t, func() bool {
+			c, code := greeting(addr)
+			c.Close()
+			return code == 220
+		}, time.Second, 10*time.Millisecond, name)
+	}
+}
+
+func TestServer_StartTLS(t *testing.T) {
+	cert := selfSigned(t)
+	h := &recordingHandler{}
+	addr := start(t, h, inbound.Options{TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}}})
+
+	c, err := smtp.Dial(addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer c.Close()
+	if !assert.NoError(t, c.Hello("mx.example.org")) {
+		return
+	}
+	ok, _ := c.Extension("STARTTLS")
+	assert.True(t, ok)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+	if !assert.NoError(t, c.StartTLS(&tls.Config{RootCAs: pool, ServerName: "mx.mailer.example"})) {
+		return
+	}
+	ok, _ = c.Extension("STARTTLS")
+	assert.False(t, ok)
+
+	assert.NoError(t, c.Mail("bob@example.org"))
+	assert.NoError(t, c.Rcpt("reply@reply.mailer.example"))
+	w, err := c.Data()
+	if !assert.NoError(t, err) {
+		return
+	}
+	w.Write([]byte("Subject: Hi\r\n\r\nHi\r\n"))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, c.Quit())
+
+	if msgs := h.received(); assert.Len(t, msgs, 1) {
+		assert.Contains(t, msgs[0].raw, "with ESMTPS")
+	}
+}
+
+func selfSigned(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "mx.mailer.example"},
+		DNSNames:     []string{"mx.mailer.example"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
@@ -0,0 +1,20 @@
+package mail_test
+
+import (
+	"encoding/base64"
+	"io"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"strings"
+)
+
+// decode undoes the Content-Transfer-Encoding of a raw part.
+func decode(p *multipart.Part) io.Reader {
+	switch strings.ToLower(p.Header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, p)
+	case "quoted-printable":
+		return quotedprintable.NewReader(p)
+	}
+	return p
+}
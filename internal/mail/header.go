@@ -0,0 +1,106 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxLineLength is the line length header folding aims for (RFC 5322 2.1.1).
+const maxLineLength = 78
+
+var errHeaderInjection = errors.New("header value contains a line break")
+
+// Address is a mailbox with an optional display name.
+type Address struct {
+	Name  string
+	Email string
+}
+
+// String formats the address for a header, encoding a non-ASCII name as an
+// RFC 2047 encoded-word.
+func (a Address) String() string {
+	if a.Name == "" {
+		return "<" + a.Email + ">"
+	}
+	return encodePhrase(a.Name) + " <" + a.Email + ">"
+}
+
+func (a Address) validate() error {
+	if strings.ContainsAny(a.Name+a.Email, "\r\n") {
+		return errHeaderInjection
+	}
+	local, domain, ok := strings.Cut(a.Email, "@")
+	if !ok || local == "" || domain == "" || strings.ContainsAny(a.Email, " <>\"") {
+		return fmt.Errorf("invalid address %q", a.Email)
+	}
+	return nil
+}
+
+// encodeText encodes an unstructured header value such as Subject.
+func encodeText(s string) string {
+	if isPrintableASCII(s) {
+		return s
+	}
+	return mime.BEncoding.Encode("utf-8", s)
+}
+
+// encodePhrase encodes a display name, quoting ASCII names that contain
+// specials.
+func encodePhrase(s string) string {
+	if !isPrintableASCII(s) {
+		return mime.BEncoding.Encode("utf-8", s)
+	}
+	if strings.ContainsAny(s, `()<>[]:;@\,."`) {
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+	}
+	return s
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Header is a single header field.
+type Header struct {
+	Name  string
+	Value string
+}
+
+// headerWriter writes folded header fields.
+type headerWriter struct {
+	b *strings.Builder
+}
+
+// write folds value at spaces so lines stay within maxLineLength where
+// possible. Encoded-words contain no spaces, so they are never split.
+func (w headerWriter) write(name, value string) {
+	line := name + ":"
+	for i, word := range strings.Split(value, " ") {
+		sep := " "
+		if i > 0 && utf8.RuneCountInString(line)+1+len(word) > maxLineLength && strings.TrimSpace(line) != "" {
+			w.b.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += sep + word
+	}
+	w.b.WriteString(line + "\r\n")
+}
+
+func (w headerWriter) addresses(name string, list []Address) {
+	if len(list) == 0 {
+		return
+	}
+	parts := make([]string, len(list))
+	for i, a := range list {
+		parts[i] = a.String()
+	}
+	w.write(name, strings.Join(parts, ", "))
+}
@@ -0,0 +1,289 @@
+// Package mail builds RFC 5322 email messages with MIME (RFC 2045) bodies.
+//
+// A message with both a text and an HTML body is sent as
+// multipart/alternative; inline images referenced from the HTML by cid: URL
+// are wrapped with it in multipart/related, and attachments wrap everything
+// in multipart/mixed. Non-ASCII header text, such as Persian subjects, is
+// encoded as RFC 2047 encoded-words.
+//
+// Output is deterministic for a given message, clock and random source, so
+// tests can compare built messages byte for byte.
+package mail
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/quotedprintable"
+	"strings"
+	"time"
+)
+
+// Part is an attachment or inline image.
+type Part struct {
+	// Filename is suggested to the recipient; it may be non-ASCII.
+	Filename    string
+	ContentType string
+	Data        []byte
+	// ContentID identifies inline parts, which the HTML body references as
+	// "cid:<ContentID>". It is written without angle brackets.
+	ContentID string
+}
+
+// Message is an email to build.
+type Message struct {
+	From    Address
+	To      []Address
+	Cc      []Address
+	ReplyTo []Address
+	Subject string
+	// Date defaults to the builder's clock.
+	Date time.Time
+	// MessageID is generated when empty. It is written without angle
+	// brackets.
+	MessageID string
+	// Headers are extra header fields such as List-Unsubscribe, written
+	// after the standard ones in the given order.
+	Headers []Header
+
+	Text        string
+	HTML        string
+	Inline      []Part
+	Attachments []Part
+}
+
+// Builder serialises messages. Message-IDs use the builder's domain.
+type Builder struct {
+	domain string
+	rand   io.Reader
+	now    func() time.Time
+}
+
+// NewBuilder returns a builder generating Message-IDs in domain.
+func NewBuilder(domain string) *Builder {
+	return &Builder{domain: domain, rand: rand.Reader, now: time.Now}
+}
+
+// WithRand returns a copy of b that draws Message-IDs from r.
+func (b *Builder) WithRand(r io.Reader) *Builder {
+	c := *b
+	c.rand = r
+	return &c
+}
+
+// WithClock returns a copy of b that dates messages with now.
+func (b *Builder) WithClock(now func() time.Time) *Builder {
+	c := *b
+	c.now = now
+	return &c
+}
+
+// NewMessageID returns a unique Message-ID without angle brackets.
+func (b *Builder) NewMessageID() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := io.ReadFull(b.rand, buf); err != nil {
+		return "", fmt.Errorf("generate message id: %w", err)
+	}
+	return hex.EncodeToString(buf) + "@" + b.domain, nil
+}
+
+// Build serialises m with CRLF line endings and returns its Message-ID.
+func (b *Builder) Build(m *Message) (id string, raw []byte, err error) {
+	if err := m.validate(); err != nil {
+		return "", nil, err
+	}
+	id = m.MessageID
+	if id == "" {
+		if id, err = b.NewMessageID(); err != nil {
+			return "", nil, err
+		}
+	}
+	date := m.Date
+	if date.IsZero() {
+		date = b.now()
+	}
+
+	var h strings.Builder
+	hw := headerWriter{&h}
+	hw.addresses("From", []Address{m.From})
+	hw.addresses("To", m.To)
+	hw.addresses("Cc", m.Cc)
+	hw.addresses("Reply-To", m.ReplyTo)
+	hw.write("Subject", encodeText(m.Subject))
+	hw.write("Date", date.Format(time.RFC1123Z))
+	hw.write("Message-ID", "<"+id+">")
+	hw.write("MIME-Version", "1.0")
+	for _, x := range m.Headers {
+		hw.write(x.Name, x.Value)
+	}
+
+	// Boundaries start with "=_", which never occurs in quoted-printable or
+	// base64 bodies, so they need no randomness to be safe.
+	sum := sha256.Sum256([]byte(id))
+	seed := hex.EncodeToString(sum[:8])
+	body := m.body(seed)
+
+	var out bytes.Buffer
+	out.WriteString(h.String())
+	body.write(&out)
+	return id, out.Bytes(), nil
+}
+
+func (m *Message) validate() error {
+	if err := m.From.validate(); err != nil {
+		return fmt.Errorf("from: %w", err)
+	}
+	if len(m.To) == 0 {
+		return errors.New("message has no recipients")
+	}
+	for _, list := range [][]Address{m.To, m.Cc, m.ReplyTo} {
+		for _, a := range list {
+			if err := a.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if strings.ContainsAny(m.Subject+m.MessageID, "\r\n") {
+		return errHeaderInjection
+	}
+	for _, x := range m.Headers {
+		if strings.ContainsAny(x.Name+x.Value, "\r\n") || strings.ContainsAny(x.Name, ": ") || x.Name == "" {
+			return fmt.Errorf("invalid header %q", x.Name)
+		}
+	}
+	if m.Text == "" && m.HTML == "" {
+		return errors.New("message has no body")
+	}
+	if len(m.Inline) > 0 && m.HTML == "" {
+		return errors.New("inline parts require an HTML body")
+	}
+	for _, p := range m.Inline {
+		if p.ContentID == "" || strings.ContainsAny(p.ContentID, "<>\r\n ") {
+			return fmt.Errorf("inline part %q has an invalid content id", p.Filename)
+		}
+	}
+	return nil
+}
+
+// entity is a MIME entity: leaf content or a multipart container.
+type entity struct {
+	header   []Header
+	body     []byte
+	boundary string
+	parts    []*entity
+}
+
+func (m *Message) body(seed string) *entity {
+	var content *entity
+	switch {
+	case m.Text != "" && m.HTML != "":
+		content = multipart("alternative", "=_alt_"+seed, textPart("plain", m.Text), textPart("html", m.HTML))
+	case m.HTML != "":
+		content = textPart("html", m.HTML)
+	default:
+		content = textPart("plain", m.Text)
+	}
+	if len(m.Inline) > 0 {
+		parts := []*entity{content}
+		for _, p := range m.Inline {
+			parts = append(parts, binaryPart(p, "inline"))
+		}
+		content = multipart("related", "=_rel_"+seed, parts...)
+		// The HTML (or its alternative) is the root of the related set.
+		content.header[0].Value += `; type="` + rootType(parts[0]) + `"`
+	}
+	if len(m.Attachments) > 0 {
+		parts := []*entity{content}
+		for _, p := range m.Attachments {
+			parts = append(parts, binaryPart(p, "attachment"))
+		}
+		content = multipart("mixed", "=_mix_"+seed, parts...)
+	}
+	return content
+}
+
+func rootType(e *entity) string {
+	v := e.header[0].Value
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		v = v[:i]
+	}
+	return v
+}
+
+func multipart(subtype, boundary string, parts ...*entity) *entity {
+	return &entity{
+		header:   []Header{{"Content-Type", mime.FormatMediaType("multipart/"+subtype, map[string]string{"boundary": boundary})}},
+		boundary: boundary,
+		parts:    parts,
+	}
+}
+
+func textPart(subtype, s string) *entity {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var buf bytes.Buffer
+	w := quotedprintable.NewWriter(&buf)
+	_, _ = w.Write([]byte(s))
+	_ = w.Close()
+	return &entity{
+		header: []Header{
+			{"Content-Type", "text/" + subtype + "; charset=utf-8"},
+			{"Content-Transfer-Encoding", "quoted-printable"},
+		},
+		body: buf.Bytes(),
+	}
+}
+
+func binaryPart(p Part, disposition string) *entity {
+	ct := p.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	header := []Header{{"Content-Type", ct}, {"Content-Transfer-Encoding", "base64"}}
+	params := map[string]string{}
+	if p.Filename != "" {
+		params["filename"] = p.Filename
+	}
+	header = append(header, Header{"Content-Disposition", mime.FormatMediaType(disposition, params)})
+	if p.ContentID != "" {
+		header = append(header, Header{"Content-ID", "<" + p.ContentID + ">"})
+	}
+	return &entity{header: header, body: base64Lines(p.Data)}
+}
+
+// base64Lines encodes data in lines of 76 characters (RFC 2045 6.8).
+func base64Lines(data []byte) []byte {
+	enc := base64.StdEncoding.EncodeToString(data)
+	var buf bytes.Buffer
+	for len(enc) > 76 {
+		buf.WriteString(enc[:76] + "\r\n")
+		enc = enc[76:]
+	}
+	buf.WriteString(enc)
+	return buf.Bytes()
+}
+
+func (e *entity) write(out *bytes.Buffer) {
+	var h strings.Builder
+	hw := headerWriter{&h}
+	for _, x := range e.header {
+		hw.write(x.Name, x.Value)
+	}
+	out.WriteString(h.String())
+	out.WriteString("\r\n")
+	if e.parts == nil {
+		out.Write(e.body)
+		out.WriteString("\r\n")
+		return
+	}
+	for _, p := range e.parts {
+		out.WriteString("--" + e.boundary + "\r\n")
+		p.write(out)
+	}
+	out.WriteString("--" + e.boundary + "--\r\n")
+}
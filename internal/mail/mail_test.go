@@ -0,0 +1,211 @@
+package mail_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"mime"
+	"mime/multipart"
+	netmail "net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func builder() *mail.Builder {
+	return mail.NewBuilder("mail.example.com").
+		WithRand(bytes.NewReader(bytes.Repeat([]byte{0xab}, 64))).
+		WithClock(func() time.Time { return time.Date(2024, 3, 20, 10, 30, 0, 0, time.FixedZone("IRST", 12600)) })
+}
+
+// A 1x1 transparent GIF.
+var pixel = []byte("GIF89a\x01\x00\x01\x00\x80\x00\x00\x00\x00\x00\xff\xff\xff!\xf9\x04\x01\x00\x00\x00\x00,\x00\x00\x00\x00\x01\x00\x01\x00\x00\x02\x02D\x01\x00;")
+
+func fullMessage() *mail.Message {
+	return &mail.Message{
+		From:    mail.Address{Name: "فروشگاه نمونه", Email: "shop@example.com"},
+		To:      []mail.Address{{Name: "Sara Ahmadi", Email: "sara@example.com"}},
+		ReplyTo: []mail.Address{{Name: "Support, Example", Email: "help@example.com"}},
+		Subject: "سارا عزیز، حراج بهاره آغاز شد! تا ۵۰٪ تخفیف روی همه محصولات",
+		Headers: []mail.Header{{Name: "List-Unsubscribe", Value: "<https://example.com/u/abc>"}},
+		Text:    "سلام سارا\nحراج بهاره آغاز شد.\n",
+		HTML:    `<p dir="rtl">سلام سارا</p><img src="cid:logo@example.com">`,
+		Inline: []mail.Part{{
+			Filename:    "logo.gif",
+			ContentType: "image/gif",
+			Data:        pixel,
+			ContentID:   "logo@example.com",
+		}},
+		Attachments: []mail.Part{{
+			Filename:    "فاکتور.txt",
+			ContentType: "text/plain; charset=utf-8",
+			Data:        []byte("invoice 42\n"),
+		}},
+	}
+}
+
+func TestBuild_Golden(t *testing.T) {
+	id, raw, err := builder().Build(fullMessage())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "abababababababababababababababab@mail.example.com", id)
+
+	path := filepath.Join("testdata", "full.eml")
+	if *update {
+		if err := os.WriteFile(path, raw, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, string(want), string(raw))
+
+	// Building again gives the same bytes.
+	_, again, _ := builder().Build(fullMessage())
+	assert.Equal(t, raw, again)
+}
+
+func TestBuild_RoundTrip(t *testing.T) {
+	_, raw, err := builder().Build(fullMessage())
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, line := range strings.Split(string(raw), "\r\n") {
+		assert.LessOrEqual(t, len(line), 998)
+		assert.NotContains(t, line, "\n")
+	}
+
+	msg, err := netmail.ReadMessage(bytes.NewReader(raw))
+	if !assert.NoError(t, err) {
+		return
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	assert.NoError(t, err)
+	assert.Equal(t, fullMessage().Subject, subject)
+
+	from, err := msg.Header.AddressList("From")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "فروشگاه نمونه", from[0].Name)
+	}
+	replyTo, err := msg.Header.AddressList("Reply-To")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Support, Example", replyTo[0].Name)
+	}
+	assert.Equal(t, "<abababababababababababababababab@mail.example.com>", msg.Header.Get("Message-ID"))
+	assert.Equal(t, "Wed, 20 Mar 2024 10:30:00 +0330", msg.Header.Get("Date"))
+
+	got := leaves(t, msg.Header.Get("Content-Type"), "", msg.Body)
+	if !assert.Len(t, got, 4) {
+		return
+	}
+	assert.Equal(t, "multipart/mixed/multipart/related/multipart/alternative/text/plain", got[0].path)
+	assert.Equal(t, fullMessage().Text, strings.ReplaceAll(got[0].body, "\r\n", "\n"))
+	assert.Equal(t, "multipart/mixed/multipart/related/multipart/alternative/text/html", got[1].path)
+	assert.Equal(t, fullMessage().HTML, got[1].body)
+	assert.Equal(t, "multipart/mixed/multipart/related/image/gif", got[2].path)
+	assert.Equal(t, "<logo@example.com>", got[2].header.Get("Content-ID"))
+	assert.Equal(t, string(pixel), got[2].body)
+	assert.Equal(t, "فاکتور.txt", got[3].filename)
+	assert.Equal(t, "invoice 42\n", got[3].body)
+}
+
+type leaf struct {
+	path     string
+	header   textproto.MIMEHeader
+	filename string
+	body     string
+}
+
+// leaves walks a MIME tree depth first and returns its decoded leaf parts.
+func leaves(t *testing.T, contentType, path string, body io.Reader) []leaf {
+	t.Helper()
+	mt, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		t.Fatalf("content type %q: %v", contentType, err)
+	}
+	path = strings.TrimPrefix(path+"/"+mt, "/")
+	if !strings.HasPrefix(mt, "multipart/") {
+		t.Fatalf("%s is not multipart", path)
+	}
+	var out []leaf
+	r := multipart.NewReader(body, params["boundary"])
+	for {
+		p, err := r.NextRawPart()
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := p.Header.Get("Content-Type")
+		if strings.HasPrefix(ct, "multipart/") {
+			out = append(out, leaves(t, ct, path, p)...)
+			continue
+		}
+		b, err := io.ReadAll(decode(p))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pmt, _, _ := mime.ParseMediaType(ct)
+		out = append(out, leaf{path: path + "/" + pmt, header: p.Header, filename: p.FileName(), body: string(b)})
+	}
+}
+
+func TestBuild_TextOnly(t *testing.T) {
+	_, raw, err := builder().Build(&mail.Message{
+		From:    mail.Address{Email: "a@example.com"},
+		To:      []mail.Address{{Email: "b@example.com"}},
+		Subject: "Plain",
+		Text:    "Hello = world\n",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := string(raw)
+	assert.Contains(t, s, "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\nHello =3D world\r\n")
+	assert.NotContains(t, s, "multipart")
+}
+
+func TestBuild_Rejects(t *testing.T) {
+	base := func() *mail.Message {
+		return &mail.Message{
+			From: mail.Address{Email: "a@example.com"},
+			To:   []mail.Address{{Email: "b@example.com"}},
+			Text: "x",
+		}
+	}
+	cases := map[string]func(*mail.Message){
+		"subject injection": func(m *mail.Message) { m.Subject = "hi\r\nBcc: x@example.com" },
+		"header injection":  func(m *mail.Message) { m.Headers = []mail.Header{{Name: "X-Test", Value: "a\nb"}} },
+		"bad address":       func(m *mail.Message) { m.To = []mail.Address{{Email: "nobody"}} },
+		"no recipients":     func(m *mail.Message) { m.To = nil },
+		"no body":           func(m *mail.Message) { m.Text = "" },
+		"inline without html": func(m *mail.Message) {
+			m.Inline = []mail.Part{{ContentID: "x@y", Data: pixel}}
+		},
+	}
+	for name, mutate := range cases {
+		m := base()
+		mutate(m)
+		_, _, err := builder().Build(m)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestAddress_String(t *testing.T) {
+	assert.Equal(t, "<a@example.com>", mail.Address{Email: "a@example.com"}.String())
+	assert.Equal(t, "Sara <a@example.com>", mail.Address{Name: "Sara", Email: "a@example.com"}.String())
+	assert.Equal(t, `"Doe, Jane" <a@example.com>`, mail.Address{Name: "Doe, Jane", Email: "a@example.com"}.String())
+	assert.Equal(t, "=?utf-8?b?2LPYp9ix2Kc=?= <a@example.com>", mail.Address{Name: "سارا", Email: "a@example.com"}.String())
+}
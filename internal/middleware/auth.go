@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -16,54 +17,110 @@ import (
 // ErrUnauthenticated is returned when no or invalid token is provided.
 var ErrUnauthenticated = status.Errorf(codes.Unauthenticated, "unauthenticated")
 
+type workspaceKey struct{}
+
+// WithWorkspaceID returns a copy of ctx carrying the authenticated workspace ID.
+func WithWorkspaceID(ctx context.Context, id uuid.UUID) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, id)
+}
+
+// WorkspaceIDFromContext returns the workspace the caller is authenticated for.
+// The workspace is the account identified by the JWT "sub" claim.
+func WorkspaceIDFromContext(ctx context.Context) (uuid.UUID, bool) {
+	id, ok := ctx.Value(workspaceKey{}).(uuid.UUID)
+	return id, ok
+}
+
 // AuthInterceptor returns a unary interceptor that checks for a valid JWT.
-func AuthInterceptor(logger *zap.SugaredLogger, jwtSecret string) grpc.UnaryServerInterceptor {
+// Calls to publicMethods (full gRPC method names) skip the check.
+func AuthInterceptor(logger *zap.SugaredLogger, jwtSecret string, publicMethods ...string) grpc.UnaryServerInterceptor {
+	public := make(map[string]bool, len(publicMethods))
+	for _, m := range publicMethods {
+		public[m] = true
+	}
 	return func(
 		ctx context.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		// Skip health check or other public methods if needed:
-		// if info.FullMethod == "/grpc.health.v1.Health/Check" {
-		//     return handler(ctx, req)
-		// }
-
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			logger.Warn("Missing metadata in context")
-			return nil, ErrUnauthenticated
+		if public[info.FullMethod] {
+			return handler(ctx, req)
 		}
 
-		authHeaders := md.Get("authorization")
-		if len(authHeaders) == 0 {
-			logger.Warn("No authorization header provided")
-			return nil, ErrUnauthenticated
+		ctx, err := authenticate(ctx, logger, jwtSecret)
+		if err != nil {
+			return nil, err
 		}
+		return handler(ctx, req)
+	}
+}
 
-		tokenString := strings.TrimPrefix(authHeaders[0], "Bearer ")
-		if tokenString == "" {
-			logger.Warn("Empty bearer token")
-			return nil, ErrUnauthenticated
+// StreamAuthInterceptor is the streaming counterpart of AuthInterceptor.
+func StreamAuthInterceptor(logger *zap.SugaredLogger, jwtSecret string) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := authenticate(ss.Context(), logger, jwtSecret)
+		if err != nil {
+			return err
 		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			// Check signing method etc.
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, errors.New("unexpected signing method")
-			}
-			return []byte(jwtSecret), nil
-		})
-		if err != nil || !token.Valid {
-			logger.Warnw("Invalid token", "error", err)
-			return nil, ErrUnauthenticated
-		}
+// authStream overrides Context so handlers see the authenticated context.
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
 
-		// Optionally, you can extract claims and add to context.
-		// if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		//     ctx = context.WithValue(ctx, "user_id", claims["sub"])
-		// }
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
 
-		return handler(ctx, req)
+func authenticate(ctx context.Context, logger *zap.SugaredLogger, jwtSecret string) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		logger.Warn("Missing metadata in context")
+		return nil, ErrUnauthenticated
+	}
+
+	authHeaders := md.Get("authorization")
+	if len(authHeaders) == 0 {
+		logger.Warn("No authorization header provided")
+		return nil, ErrUnauthenticated
+	}
+
+	tokenString := strings.TrimPrefix(authHeaders[0], "Bearer ")
+	if tokenString == "" {
+		logger.Warn("Empty bearer token")
+		return nil, ErrUnauthenticated
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Check signing method etc.
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return []byte(jwtSecret), nil
+	})
+	if err != nil || !token.Valid {
+		logger.Warnw("Invalid token", "error", err)
+		return nil, ErrUnauthenticated
 	}
+
+	// The subject is the account ID; it scopes everything the caller can see.
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if sub, ok := claims["sub"].(string); ok {
+			if id, err := uuid.Parse(sub); err == nil {
+				ctx = WithWorkspaceID(ctx, id)
+			}
+		}
+	}
+
+	return ctx, nil
 }
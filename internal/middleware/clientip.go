@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// TrustedProxies are the reverse proxies and gateways in front of the
+// servers. X-Forwarded-For is only believed as far as it was added by them:
+// anyone else can set the header to anything.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// ParseTrustedProxies parses a list of IP addresses and CIDR ranges. An
+// empty list trusts no proxy, so the transport peer is the client.
+func ParseTrustedProxies(addrs []string) (*TrustedProxies, error) {
+	p := &TrustedProxies{}
+	for _, a := range addrs {
+		if !strings.Contains(a, "/") {
+			ip := net.ParseIP(a)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", a)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			p.nets = append(p.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(a)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", a, err)
+		}
+		p.nets = append(p.nets, n)
+	}
+	return p, nil
+}
+
+func (p *TrustedProxies) trusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of a request from remote,
+// the transport peer, carrying the given X-Forwarded-For values. Hops are
+// walked from the right, so the result is the right-most address not added
+// by a trusted proxy.
+func (p *TrustedProxies) ClientIP(remote string, forwardedFor []string) string {
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	if !p.trusted(remote) {
+		return remote
+	}
+	var hops []string
+	for _, v := range forwardedFor {
+		for _, hop := range strings.Split(v, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i]) == nil {
+			break
+		}
+		client = hops[i]
+		if !p.trusted(client) {
+			break
+		}
+	}
+	return client
+}
+
+type clientIPKey struct{}
+
+// WithClientIP returns a copy of ctx carrying the client's address.
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPKey{}, ip)
+}
+
+// ClientIPFromContext returns the client's address, as resolved by
+// ClientIPInterceptor or ClientIPHandler.
+func ClientIPFromContext(ctx context.Context) (string, bool) {
+	ip, ok := ctx.Value(clientIPKey{}).(string)
+	return ip, ok
+}
+
+// ClientIPInterceptor returns a unary interceptor that resolves the client's
+// address from the peer and x-forwarded-for metadata.
+func ClientIPInterceptor(proxies *TrustedProxies) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		var remote string
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			remote = p.Addr.String()
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		ip := proxies.ClientIP(remote, md.Get("x-forwarded-for"))
+		return handler(WithClientIP(ctx, ip), req)
+	}
+}
+
+// ClientIPHandler wraps next to resolve the client's address of HTTP
+// requests from RemoteAddr and X-Forwarded-For.
+func ClientIPHandler(proxies *TrustedProxies, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := proxies.ClientIP(r.RemoteAddr, r.Header.Values("X-Forwarded-For"))
+		next.ServeHTTP(w, r.WithContext(WithClientIP(r.Context(), ip)))
+	})
+}
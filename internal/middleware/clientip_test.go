@@ -0,0 +1,52 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/middleware"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := middleware.ParseTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	for _, tc := range []struct {
+		name   string
+		remote string
+		fwd    []string
+		want   string
+	}{
+		{"direct", "198.51.100.7:4000", nil, "198.51.100.7"},
+		{"forged by client", "198.51.100.7:4000", []string{"203.0.113.9"}, "198.51.100.7"},
+		{"through proxy", "10.1.2.3:4000", []string{"198.51.100.7"}, "198.51.100.7"},
+		{"spoofed hop before proxy", "10.1.2.3:4000", []string{"203.0.113.9, 198.51.100.7"}, "198.51.100.7"},
+		{"proxy chain", "192.0.2.1:4000", []string{"198.51.100.7, 10.9.9.9"}, "198.51.100.7"},
+		{"split headers", "10.1.2.3:4000", []string{"203.0.113.9", "198.51.100.7"}, "198.51.100.7"},
+		{"garbage hop", "10.1.2.3:4000", []string{"198.51.100.7, nonsense"}, "10.1.2.3"},
+		{"no header", "10.1.2.3:4000", nil, "10.1.2.3"},
+	} {
+		assert.Equal(t, tc.want, proxies.ClientIP(tc.remote, tc.fwd), tc.name)
+	}
+
+	_, err = middleware.ParseTrustedProxies([]string{"10.0.0.0/33"})
+	assert.Error(t, err)
+	_, err = middleware.ParseTrustedProxies([]string{"proxy.local"})
+	assert.Error(t, err)
+}
+
+func TestClientIPHandler(t *testing.T) {
+	proxies, _ := middleware.ParseTrustedProxies(nil)
+	var got string
+	h := middleware.ClientIPHandler(proxies, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = middleware.ClientIPFromContext(r.Context())
+	}))
+	r := httptest.NewRequest(http.MethodPost, "/unsubscribe", nil)
+	r.RemoteAddr = "198.51.100.7:4000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.9")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	assert.Equal(t, "198.51.100.7", got)
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Asset is an image uploaded for use in emails.
+type Asset struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	Filename    string    `db:"filename"`
+	ContentType string    `db:"content_type"`
+	Size        int64     `db:"size"`
+	Width       int       `db:"width"`
+	Height      int       `db:"height"`
+	// SHA256 is the hex digest of the content. It is part of the storage
+	// key, so an asset's URL changes whenever its content does.
+	SHA256     string    `db:"sha256"`
+	StorageKey string    `db:"storage_key"`
+	CreatedAt  time.Time `db:"created_at"`
+}
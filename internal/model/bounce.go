@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BounceKind is the class of a bounce. The values match bounce.Kind.
+type BounceKind string
+
+const (
+	BounceKind_Hard        BounceKind = "hard"
+	BounceKind_Soft        BounceKind = "soft"
+	BounceKind_Block       BounceKind = "block"
+	BounceKind_MailboxFull BounceKind = "mailbox_full"
+	BounceKind_Delayed     BounceKind = "delayed"
+)
+
+// Bounce is a failed or delayed delivery of a campaign email reported by
+// the receiving side.
+type Bounce struct {
+	ID          uuid.UUID  `db:"id"`
+	WorkspaceID uuid.UUID  `db:"workspace_id"`
+	CampaignID  uuid.UUID  `db:"campaign_id"`
+	ContactID   uuid.UUID  `db:"contact_id"`
+	SendJobID   int64      `db:"send_job_id"`
+	Email       string     `db:"email"`
+	Kind        BounceKind `db:"kind"`
+	// Status is the enhanced status code, such as "5.1.1", if the receiver
+	// gave one.
+	Status     string    `db:"status"`
+	Diagnostic string    `db:"diagnostic"`
+	CreatedAt  time.Time `db:"created_at"`
+}
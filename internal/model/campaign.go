@@ -0,0 +1,140 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CampaignStatus is the lifecycle state of a campaign.
+type CampaignStatus string
+
+const (
+	CampaignStatus_Draft     CampaignStatus = "draft"
+	CampaignStatus_Scheduled CampaignStatus = "scheduled"
+	CampaignStatus_Sending   CampaignStatus = "sending"
+	CampaignStatus_Sent      CampaignStatus = "sent"
+	CampaignStatus_Cancelled CampaignStatus = "cancelled"
+	CampaignStatus_Paused    CampaignStatus = "paused"
+)
+
+// campaignTransitions lists the states each state may move to. Scheduled
+// campaigns may be rescheduled; paused campaigns resume to scheduled or
+// sending depending on whether sending had started.
+var campaignTransitions = map[CampaignStatus][]CampaignStatus{
+	CampaignStatus_Draft:     {CampaignStatus_Scheduled, CampaignStatus_Cancelled},
+	CampaignStatus_Scheduled: {CampaignStatus_Scheduled, CampaignStatus_Sending, CampaignStatus_Paused, CampaignStatus_Cancelled},
+	CampaignStatus_Sending:   {CampaignStatus_Sent, CampaignStatus_Paused, CampaignStatus_Cancelled},
+	CampaignStatus_Paused:    {CampaignStatus_Scheduled, CampaignStatus_Sending, CampaignStatus_Cancelled},
+}
+
+// CanTransitionTo reports whether a campaign in state s may move to state to.
+func (s CampaignStatus) CanTransitionTo(to CampaignStatus) bool {
+	for _, t := range campaignTransitions[s] {
+		if t == to {
+			return true
+		}
+	}
+	return false
+}
+
+// CampaignStatusesTo returns the states that may move to state to.
+func CampaignStatusesTo(to CampaignStatus) []CampaignStatus {
+	var out []CampaignStatus
+	for _, from := range []CampaignStatus{
+		CampaignStatus_Draft, CampaignStatus_Scheduled, CampaignStatus_Sending, CampaignStatus_Paused,
+	} {
+		if from.CanTransitionTo(to) {
+			out = append(out, from)
+		}
+	}
+	return out
+}
+
+// Editable reports whether the content and audience of a campaign may still
+// change, which is until sending starts.
+func (s CampaignStatus) Editable() bool {
+	return s == CampaignStatus_Draft || s == CampaignStatus_Scheduled
+}
+
+// CampaignAudience is the lists and segments a campaign is sent to, stored
+// as JSONB. Contacts in several of them receive the campaign once.
+type CampaignAudience struct {
+	ListIDs    []uuid.UUID `json:"list_ids,omitempty"`
+	SegmentIDs []uuid.UUID `json:"segment_ids,omitempty"`
+}
+
+// Empty reports whether the audience has no lists or segments.
+func (a CampaignAudience) Empty() bool {
+	return len(a.ListIDs) == 0 && len(a.SegmentIDs) == 0
+}
+
+// Value implements driver.Valuer.
+func (a CampaignAudience) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+// Scan implements sql.Scanner.
+func (a *CampaignAudience) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return errors.New("campaign audience: unsupported source type")
+	}
+}
+
+// Campaign is an email sent to an audience from a pinned template version.
+type Campaign struct {
+	ID              uuid.UUID        `db:"id"`
+	WorkspaceID     uuid.UUID        `db:"workspace_id"`
+	Name            string           `db:"name"`
+	TemplateID      uuid.UUID        `db:"template_id"`
+	TemplateVersion int32            `db:"template_version"`
+	Audience        CampaignAudience `db:"audience"`
+	FromName        string           `db:"from_name"`
+	FromEmail       string           `db:"from_email"`
+	ReplyTo         string           `db:"reply_to"`
+	Status          CampaignStatus   `db:"status"`
+	ScheduledAt     *time.Time       `db:"scheduled_at"`
+	StartedAt       *time.Time       `db:"started_at"`
+	FinishedAt      *time.Time       `db:"finished_at"`
+	CreatedAt       time.Time        `db:"created_at"`
+	UpdatedAt       time.Time        `db:"updated_at"`
+}
+
+// SendJobStatus is the delivery state of one campaign recipient.
+type SendJobStatus string
+
+const (
+	SendJobStatus_Pending SendJobStatus = "pending"
+	SendJobStatus_Sent    SendJobStatus = "sent"
+	// Failed jobs were rejected permanently or ran out of retries. They are
+	// kept as dead letters and can be requeued.
+	SendJobStatus_Failed SendJobStatus = "failed"
+	// Skipped jobs were not sent, for example because the recipient was
+	// suppressed after the audience was expanded.
+	SendJobStatus_Skipped SendJobStatus = "skipped"
+)
+
+// SendJob is the delivery of a campaign to one contact.
+type SendJob struct {
+	ID          int64         `db:"id"`
+	CampaignID  uuid.UUID     `db:"campaign_id"`
+	WorkspaceID uuid.UUID     `db:"workspace_id"`
+	ContactID   uuid.UUID     `db:"contact_id"`
+	Email       string        `db:"email"`
+	Status      SendJobStatus `db:"status"`
+	// Attempts counts the times the job was leased to a worker.
+	Attempts int `db:"attempts"`
+	// AvailableAt is when the job may next be leased.
+	AvailableAt time.Time `db:"available_at"`
+	LastError   string    `db:"last_error"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
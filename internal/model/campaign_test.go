@@ -0,0 +1,23 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCampaignStatus_Transitions(t *testing.T) {
+	assert.True(t, model.CampaignStatus_Draft.CanTransitionTo(model.CampaignStatus_Scheduled))
+	assert.True(t, model.CampaignStatus_Sending.CanTransitionTo(model.CampaignStatus_Sent))
+	assert.False(t, model.CampaignStatus_Draft.CanTransitionTo(model.CampaignStatus_Sending))
+	assert.False(t, model.CampaignStatus_Sent.CanTransitionTo(model.CampaignStatus_Cancelled))
+	assert.False(t, model.CampaignStatus_Cancelled.CanTransitionTo(model.CampaignStatus_Scheduled))
+
+	assert.ElementsMatch(t, []model.CampaignStatus{
+		model.CampaignStatus_Draft, model.CampaignStatus_Scheduled, model.CampaignStatus_Sending, model.CampaignStatus_Paused,
+	}, model.CampaignStatusesTo(model.CampaignStatus_Cancelled))
+	assert.ElementsMatch(t, []model.CampaignStatus{
+		model.CampaignStatus_Scheduled, model.CampaignStatus_Sending,
+	}, model.CampaignStatusesTo(model.CampaignStatus_Paused))
+}
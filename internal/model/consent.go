@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ConsentAction is the kind of event captured in a contact's consent history.
+type ConsentAction string
+
+const (
+	ConsentAction_SubscribeRequested ConsentAction = "subscribe_requested"
+	ConsentAction_Confirmed          ConsentAction = "confirmed"
+	ConsentAction_Unsubscribed       ConsentAction = "unsubscribed"
+	ConsentAction_LanguageChanged    ConsentAction = "language_changed"
+	ConsentAction_Paused             ConsentAction = "paused"
+	ConsentAction_Resumed            ConsentAction = "resumed"
+)
+
+// ConsentRecord is an immutable audit entry proving how and when a contact
+// gave or changed their consent.
+type ConsentRecord struct {
+	ID          uuid.UUID     `db:"id"`
+	WorkspaceID uuid.UUID     `db:"workspace_id"`
+	ContactID   uuid.UUID     `db:"contact_id"`
+	ListID      *uuid.UUID    `db:"list_id"`
+	Action      ConsentAction `db:"action"`
+	IP          string        `db:"ip"`
+	UserAgent   string        `db:"user_agent"`
+	Source      string        `db:"source"`
+	CreatedAt   time.Time     `db:"created_at"`
+}
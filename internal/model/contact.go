@@ -0,0 +1,203 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// String returns the ISO 639-1 code of the language.
+func (l Language) String() string {
+	switch l {
+	case Language_FA:
+		return "fa"
+	default:
+		return "en"
+	}
+}
+
+// RTL reports whether the language is written right to left.
+func (l Language) RTL() bool {
+	return l == Language_FA
+}
+
+// ContactStatus is the lifecycle state of a contact within a workspace.
+type ContactStatus string
+
+const (
+	ContactStatus_Active       ContactStatus = "active"
+	ContactStatus_Pending      ContactStatus = "pending"
+	ContactStatus_Unsubscribed ContactStatus = "unsubscribed"
+	ContactStatus_Bounced      ContactStatus = "bounced"
+)
+
+// CustomFields holds workspace-defined contact attributes, stored as JSONB.
+type CustomFields map[string]string
+
+// Value implements driver.Valuer.
+func (c CustomFields) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+// Scan implements sql.Scanner.
+func (c *CustomFields) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		*c = CustomFields{}
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return errors.New("custom fields: unsupported source type")
+	}
+	return json.Unmarshal(data, c)
+}
+
+type Contact struct {
+	ID           uuid.UUID     `db:"id"`
+	WorkspaceID  uuid.UUID     `db:"workspace_id"`
+	Email        string        `db:"email"`
+	FirstName    string        `db:"first_name"`
+	LastName     string        `db:"last_name"`
+	Lang         Language      `db:"lang"`
+	Status       ContactStatus `db:"status"`
+	CustomFields CustomFields  `db:"custom_fields"`
+	// PausedUntil is set while the contact has paused campaign emails.
+	PausedUntil *time.Time `db:"paused_until"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at"`
+}
+
+// Paused reports whether the contact has paused campaign emails at now.
+func (c *Contact) Paused(now time.Time) bool {
+	return c.PausedUntil != nil && c.PausedUntil.After(now)
+}
+
+type List struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	Name        string    `db:"name"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type ListMembership struct {
+	ListID         uuid.UUID          `db:"list_id"`
+	ContactID      uuid.UUID          `db:"contact_id"`
+	Status         SubscriptionStatus `db:"status"`
+	UnsubscribedAt *time.Time         `db:"unsubscribed_at"`
+	CreatedAt      time.Time          `db:"created_at"`
+}
+
+// ListSubscription is a contact's membership in a list, with the list name.
+type ListSubscription struct {
+	ListID uuid.UUID          `db:"list_id"`
+	Name   string             `db:"name"`
+	Status SubscriptionStatus `db:"status"`
+}
+
+// SegmentMatch controls how the conditions of a segment are combined.
+type SegmentMatch string
+
+const (
+	SegmentMatch_All SegmentMatch = "all"
+	SegmentMatch_Any SegmentMatch = "any"
+)
+
+// SegmentCondition is a single predicate on a contact field. Field is either a
+// standard column (e.g. "email", "lang") or "custom.<key>" for custom fields.
+type SegmentCondition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value,omitempty"`
+}
+
+// SegmentFilter is the stored definition of a dynamic segment.
+type SegmentFilter struct {
+	Match      SegmentMatch       `json:"match"`
+	Conditions []SegmentCondition `json:"conditions"`
+}
+
+// Value implements driver.Valuer.
+func (f SegmentFilter) Value() (driver.Value, error) {
+	return json.Marshal(f)
+}
+
+// Scan implements sql.Scanner.
+func (f *SegmentFilter) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, f)
+	case string:
+		return json.Unmarshal([]byte(v), f)
+	default:
+		return errors.New("segment filter: unsupported source type")
+	}
+}
+
+type Segment struct {
+	ID          uuid.UUID     `db:"id"`
+	WorkspaceID uuid.UUID     `db:"workspace_id"`
+	Name        string        `db:"name"`
+	Filter      SegmentFilter `db:"filter"`
+	CreatedAt   time.Time     `db:"created_at"`
+}
+
+// ExportJobStatus is the state of a background contact export.
+type ExportJobStatus string
+
+const (
+	ExportJobStatus_Pending   ExportJobStatus = "pending"
+	ExportJobStatus_Running   ExportJobStatus = "running"
+	ExportJobStatus_Completed ExportJobStatus = "completed"
+	ExportJobStatus_Failed    ExportJobStatus = "failed"
+	// ExportJobStatus_Expired is a completed job whose file was deleted.
+	ExportJobStatus_Expired ExportJobStatus = "expired"
+)
+
+type ExportJob struct {
+	ID          uuid.UUID       `db:"id"`
+	WorkspaceID uuid.UUID       `db:"workspace_id"`
+	Format      string          `db:"format"`
+	Status      ExportJobStatus `db:"status"`
+	FilePath    string          `db:"file_path"`
+	RowCount    int64           `db:"row_count"`
+	Error       string          `db:"error"`
+	CreatedAt   time.Time       `db:"created_at"`
+	FinishedAt  *time.Time      `db:"finished_at"`
+	// HeartbeatAt is renewed while the export runs.
+	HeartbeatAt *time.Time `db:"heartbeat_at"`
+}
+
+// Stale reports whether the job is unfinished but its export has not
+// been heard from since before, for example because its server exited.
+func (j *ExportJob) Stale(before time.Time) bool {
+	if j.Status != ExportJobStatus_Pending && j.Status != ExportJobStatus_Running {
+		return false
+	}
+	last := j.CreatedAt
+	if j.HeartbeatAt != nil {
+		last = *j.HeartbeatAt
+	}
+	return last.Before(before)
+}
+
+// ParseLanguage maps an ISO 639-1 code to a Language.
+func ParseLanguage(code string) (Language, bool) {
+	switch code {
+	case "en":
+		return Language_EN, true
+	case "fa":
+		return Language_FA, true
+	default:
+		return Language_EN, false
+	}
+}
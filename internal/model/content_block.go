@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BlockKind distinguishes snippets included by templates from layouts that
+// templates extend.
+type BlockKind string
+
+const (
+	BlockKind_Block  BlockKind = "block"
+	BlockKind_Layout BlockKind = "layout"
+)
+
+// BlockContent is the HTML and text of a content block.
+type BlockContent struct {
+	HTMLBody string `db:"html_body" json:"html_body"`
+	TextBody string `db:"text_body" json:"text_body"`
+}
+
+// BlockVariants holds translated block content keyed by ISO 639-1 language
+// code, stored as JSONB.
+type BlockVariants map[string]BlockContent
+
+// Value implements driver.Valuer.
+func (v BlockVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements sql.Scanner.
+func (v *BlockVariants) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		*v = BlockVariants{}
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return errors.New("block variants: unsupported source type")
+	}
+	return json.Unmarshal(data, v)
+}
+
+// ContentBlock is a named piece of content shared by templates, such as a
+// footer, or a layout templates extend.
+type ContentBlock struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	Name        string    `db:"name"`
+	Kind        BlockKind `db:"kind"`
+	BlockContent
+	// Lang is the language of the embedded content, the fallback for
+	// templates in languages without a variant.
+	Lang      Language      `db:"lang"`
+	Variants  BlockVariants `db:"variants"`
+	CreatedAt time.Time     `db:"created_at"`
+	UpdatedAt time.Time     `db:"updated_at"`
+}
+
+// ContentFor returns the block content for a template written in lang.
+func (b *ContentBlock) ContentFor(lang Language) BlockContent {
+	if lang != b.Lang {
+		if c, ok := b.Variants[lang.String()]; ok {
+			return c
+		}
+	}
+	return b.BlockContent
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Reply is an email a contact sent in reply to a campaign email.
+type Reply struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	CampaignID  uuid.UUID `db:"campaign_id"`
+	ContactID   uuid.UUID `db:"contact_id"`
+	SendJobID   int64     `db:"send_job_id"`
+	FromEmail   string    `db:"from_email"`
+	FromName    string    `db:"from_name"`
+	Subject     string    `db:"subject"`
+	// Text is the plain text body, or the text of the HTML body if the
+	// reply had no plain text part.
+	Text string `db:"text"`
+	// AutoReply is set for out-of-office and other automatic replies.
+	AutoReply  bool      `db:"auto_reply"`
+	MessageID  string    `db:"message_id"`
+	ReceivedAt time.Time `db:"received_at"`
+}
@@ -0,0 +1,92 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SendingDomainStatus is the verification state of a sending domain.
+type SendingDomainStatus string
+
+const (
+	// SendingDomainStatus_Pending domains have never passed verification.
+	SendingDomainStatus_Pending SendingDomainStatus = "pending"
+	// SendingDomainStatus_Verified domains passed their last check.
+	SendingDomainStatus_Verified SendingDomainStatus = "verified"
+	// SendingDomainStatus_Failed domains were verified once but failed a
+	// recheck, for example because a DNS record was removed.
+	SendingDomainStatus_Failed SendingDomainStatus = "failed"
+)
+
+// DomainCheck is the outcome of checking one DNS record.
+type DomainCheck struct {
+	OK bool `json:"ok"`
+	// Detail explains a failure, or notes something about a pass such as
+	// a DMARC policy of none.
+	Detail string `json:"detail,omitempty"`
+}
+
+// DomainChecks are the DNS checks a sending domain has to pass, stored as
+// JSONB.
+type DomainChecks struct {
+	Ownership DomainCheck `json:"ownership"`
+	SPF       DomainCheck `json:"spf"`
+	DKIM      DomainCheck `json:"dkim"`
+	DMARC     DomainCheck `json:"dmarc"`
+}
+
+// Passed reports whether every check passed.
+func (c DomainChecks) Passed() bool {
+	return c.Ownership.OK && c.SPF.OK && c.DKIM.OK && c.DMARC.OK
+}
+
+// Value implements driver.Valuer.
+func (c DomainChecks) Value() (driver.Value, error) {
+	return json.Marshal(c)
+}
+
+// Scan implements sql.Scanner.
+func (c *DomainChecks) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		*c = DomainChecks{}
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return errors.New("domain checks: unsupported source type")
+	}
+	return json.Unmarshal(data, c)
+}
+
+// SendingDomain is a domain a workspace sends campaigns from. Campaigns
+// can only be sent from verified domains, and messages from them are
+// DKIM-signed with the domain's key.
+type SendingDomain struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	// Domain is lower case, without a trailing dot.
+	Domain        string `db:"domain"`
+	DKIMSelector  string `db:"dkim_selector"`
+	DKIMAlgorithm string `db:"dkim_algorithm"`
+	// DKIMPrivateKey is the encrypted PKCS #8 private key.
+	DKIMPrivateKey []byte `db:"dkim_private_key"`
+	// DKIMRecord is the TXT record to publish at the selector.
+	DKIMRecord string `db:"dkim_record"`
+	// VerificationToken is published in a TXT record to prove ownership.
+	VerificationToken string              `db:"verification_token"`
+	Status            SendingDomainStatus `db:"status"`
+	Checks            DomainChecks        `db:"checks"`
+	CheckedAt         *time.Time          `db:"checked_at"`
+	// VerifiedAt is when the domain first passed verification.
+	VerifiedAt *time.Time `db:"verified_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+	UpdatedAt  time.Time  `db:"updated_at"`
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SuppressionKind says whether a suppression matches one address or a whole domain.
+type SuppressionKind string
+
+const (
+	SuppressionKind_Email  SuppressionKind = "email"
+	SuppressionKind_Domain SuppressionKind = "domain"
+)
+
+// SuppressionReason records why an address must not be mailed.
+type SuppressionReason string
+
+const (
+	SuppressionReason_Unsubscribed SuppressionReason = "unsubscribed"
+	SuppressionReason_HardBounce   SuppressionReason = "hard_bounce"
+	SuppressionReason_SoftBounce   SuppressionReason = "soft_bounce"
+	SuppressionReason_Complaint    SuppressionReason = "complaint"
+	SuppressionReason_Manual       SuppressionReason = "manual"
+)
+
+// Suppression is a workspace-wide block on sending to an email or domain.
+type Suppression struct {
+	ID          uuid.UUID         `db:"id"`
+	WorkspaceID uuid.UUID         `db:"workspace_id"`
+	Kind        SuppressionKind   `db:"kind"`
+	Value       string            `db:"value"`
+	Reason      SuppressionReason `db:"reason"`
+	Source      string            `db:"source"`
+	CreatedAt   time.Time         `db:"created_at"`
+}
+
+// SubscriptionStatus is the state of a contact's membership in one list.
+type SubscriptionStatus string
+
+const (
+	SubscriptionStatus_Subscribed   SubscriptionStatus = "subscribed"
+	SubscriptionStatus_Unsubscribed SubscriptionStatus = "unsubscribed"
+	SubscriptionStatus_Pending      SubscriptionStatus = "pending"
+)
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Tag is a lightweight workspace label attached to any number of contacts.
+type Tag struct {
+	ID          uuid.UUID `db:"id"`
+	WorkspaceID uuid.UUID `db:"workspace_id"`
+	Name        string    `db:"name"`
+	CreatedAt   time.Time `db:"created_at"`
+	// ContactCount is only populated by usage queries.
+	ContactCount int64 `db:"contact_count"`
+}
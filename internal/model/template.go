@@ -0,0 +1,103 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Template is a reusable email design. Its content lives in immutable
+// TemplateVersions; CurrentVersion points at the latest one.
+type Template struct {
+	ID             uuid.UUID `db:"id"`
+	WorkspaceID    uuid.UUID `db:"workspace_id"`
+	Name           string    `db:"name"`
+	CurrentVersion int32     `db:"current_version"`
+	CreatedAt      time.Time `db:"created_at"`
+	UpdatedAt      time.Time `db:"updated_at"`
+}
+
+// TemplateContent is the editable part of a template.
+type TemplateContent struct {
+	Subject   string `db:"subject" json:"subject"`
+	Preheader string `db:"preheader" json:"preheader"`
+	HTMLBody  string `db:"html_body" json:"html_body"`
+	TextBody  string `db:"text_body" json:"text_body"`
+}
+
+// TemplateVariants holds translated content keyed by ISO 639-1 language
+// code, stored as JSONB.
+type TemplateVariants map[string]TemplateContent
+
+// Value implements driver.Valuer.
+func (v TemplateVariants) Value() (driver.Value, error) {
+	if v == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan implements sql.Scanner.
+func (v *TemplateVariants) Scan(src interface{}) error {
+	var data []byte
+	switch s := src.(type) {
+	case nil:
+		*v = TemplateVariants{}
+		return nil
+	case []byte:
+		data = s
+	case string:
+		data = []byte(s)
+	default:
+		return errors.New("template variants: unsupported source type")
+	}
+	return json.Unmarshal(data, v)
+}
+
+// LocalizedContent is a template's content in its fallback language plus
+// translations into other languages.
+type LocalizedContent struct {
+	TemplateContent
+	// Lang is the language of the embedded content, which is also the
+	// fallback for contacts whose language has no variant.
+	Lang     Language         `db:"lang"`
+	Variants TemplateVariants `db:"variants"`
+	// Layout names the layout block the content is placed in, if any.
+	Layout string `db:"layout"`
+}
+
+// TemplateVersion is an immutable snapshot of a template's content.
+type TemplateVersion struct {
+	TemplateID uuid.UUID `db:"template_id"`
+	Version    int32     `db:"version"`
+	LocalizedContent
+	AuthorID uuid.UUID `db:"author_id"`
+	// Note describes the change, e.g. "rollback to version 3".
+	Note      string    `db:"note"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ContentFor returns the content to send to a contact speaking lang and the
+// language it is written in.
+func (c *LocalizedContent) ContentFor(lang Language) (TemplateContent, Language) {
+	if lang != c.Lang {
+		if t, ok := c.Variants[lang.String()]; ok {
+			return t, lang
+		}
+	}
+	return c.TemplateContent, c.Lang
+}
+
+// Languages lists the languages the content exists for, fallback first.
+func (c *LocalizedContent) Languages() []Language {
+	out := []Language{c.Lang}
+	for _, l := range []Language{Language_EN, Language_FA} {
+		if _, ok := c.Variants[l.String()]; ok && l != c.Lang {
+			out = append(out, l)
+		}
+	}
+	return out
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestRecipient is an address a workspace may send template tests to. Test
+// sends are only allowed once the owner of the address has verified it.
+type TestRecipient struct {
+	ID          uuid.UUID  `db:"id"`
+	WorkspaceID uuid.UUID  `db:"workspace_id"`
+	Email       string     `db:"email"`
+	VerifiedAt  *time.Time `db:"verified_at"`
+	// VerificationSentAt is when the last verification email was sent.
+	VerificationSentAt *time.Time `db:"verification_sent_at"`
+	CreatedAt          time.Time  `db:"created_at"`
+}
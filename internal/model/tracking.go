@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrackingEventKind is the kind of a tracking event.
+type TrackingEventKind string
+
+const (
+	TrackingEventKind_Open  TrackingEventKind = "open"
+	TrackingEventKind_Click TrackingEventKind = "click"
+)
+
+// TrackingEvent is a request to the open pixel or a tracked link of a
+// campaign email.
+type TrackingEvent struct {
+	ID          uuid.UUID         `db:"id"`
+	WorkspaceID uuid.UUID         `db:"workspace_id"`
+	CampaignID  uuid.UUID         `db:"campaign_id"`
+	ContactID   uuid.UUID         `db:"contact_id"`
+	SendJobID   int64             `db:"send_job_id"`
+	Kind        TrackingEventKind `db:"kind"`
+	// URL is the link target of clicks.
+	URL string `db:"url"`
+	// Agent is the tracking.Class of the client: "human", "apple_mpp",
+	// "prefetch" or "bot".
+	Agent     string    `db:"agent"`
+	IP        string    `db:"ip"`
+	UserAgent string    `db:"user_agent"`
+	CreatedAt time.Time `db:"created_at"`
+}
@@ -0,0 +1,78 @@
+package queue
+
+import (
+	"context"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+)
+
+// DefaultVisibilityTimeout is how long a leased job stays hidden from other
+// workers.
+const DefaultVisibilityTimeout = 5 * time.Minute
+
+// Postgres serves jobs straight from the send_jobs table.
+type Postgres struct {
+	jobs       repository.SendJobRepository
+	visibility time.Duration
+}
+
+// NewPostgres returns a queue leasing jobs for visibility; zero selects
+// DefaultVisibilityTimeout.
+func NewPostgres(jobs repository.SendJobRepository, visibility time.Duration) *Postgres {
+	if visibility <= 0 {
+		visibility = DefaultVisibilityTimeout
+	}
+	return &Postgres{jobs: jobs, visibility: visibility}
+}
+
+func (q *Postgres) Dequeue(ctx context.Context, max int) ([]*Job, error) {
+	leased, err := q.jobs.Lease(ctx, max, q.visibility)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(leased), nil
+}
+
+func (q *Postgres) Complete(ctx context.Context, job *Job, status model.SendJobStatus, reason string) error {
+	return complete(ctx, q.jobs, job, status, reason)
+}
+
+func (q *Postgres) Retry(ctx context.Context, job *Job, at time.Time, reason string, deferral bool) error {
+	return retry(ctx, q.jobs, job, at, reason, deferral)
+}
+
+func wrap(leased []*model.SendJob) []*Job {
+	out := make([]*Job, len(leased))
+	for i, j := range leased {
+		out[i] = &Job{SendJob: *j}
+	}
+	return out
+}
+
+func complete(ctx context.Context, jobs repository.SendJobRepository, job *Job, status model.SendJobStatus, reason string) error {
+	ok, err := jobs.Complete(ctx, job.ID, job.Attempts, status, reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func retry(ctx context.Context, jobs repository.SendJobRepository, job *Job, at time.Time, reason string, deferral bool) error {
+	attempts := job.Attempts
+	if deferral {
+		attempts--
+	}
+	ok, err := jobs.Retry(ctx, job.ID, job.Attempts, attempts, at, reason)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrLeaseLost
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+// Package queue delivers campaign send jobs to workers.
+//
+// The send_jobs table is the durable record of every job and the authority
+// on who may work on it: a worker leases a job for a visibility timeout, and
+// a job whose worker crashed becomes visible again when it expires. Postgres
+// serves jobs by polling that table; Redis serves them from a stream fed by
+// a relay, so workers do not poll the database.
+//
+// Failed sends are classified as temporary (4xx replies, network errors)
+// and retried with exponential backoff and jitter, or permanent (5xx
+// replies) and dead-lettered. Dead letters stay in send_jobs with status
+// failed until they are requeued with the RequeueDeadLetters RPC.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+// ErrLeaseLost is returned when a job is settled after its lease expired
+// and another worker took it over.
+var ErrLeaseLost = errors.New("queue: job lease lost")
+
+// Job is a leased send job.
+type Job struct {
+	model.SendJob
+	// receipt identifies the delivery in the backend, such as a Redis
+	// stream entry.
+	receipt string
+}
+
+// Queue hands out send jobs. Jobs are added by the scheduler, which inserts
+// them into send_jobs.
+type Queue interface {
+	// Dequeue leases up to max jobs. It returns no jobs, not an error, when
+	// none are available.
+	Dequeue(ctx context.Context, max int) ([]*Job, error)
+	// Complete settles a job as sent, skipped or failed.
+	Complete(ctx context.Context, job *Job, status model.SendJobStatus, reason string) error
+	// Retry makes the job available again at at. A deferral does not count
+	// as an attempt.
+	Retry(ctx context.Context, job *Job, at time.Time, reason string, deferral bool) error
+}
+
+// skipError and deferError are returned by handlers to settle a job
+// without sending it.
+type skipError struct{ reason string }
+
+func (e *skipError) Error() string { return "skipped: " + e.reason }
+
+type deferError struct {
+	delay  time.Duration
+	reason string
+}
+
+func (e *deferError) Error() string { return "deferred: " + e.reason }
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Skip settles a job as skipped, for example because its recipient was
+// suppressed.
+func Skip(reason string) error {
+	return &skipError{reason: reason}
+}
+
+// Defer retries a job after delay without counting an attempt, for example
+// while its campaign is paused.
+func Defer(delay time.Duration, reason string) error {
+	return &deferError{delay: delay, reason: reason}
+}
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return &permanentError{err: err}
+}
+
+// Temporary reports whether a failed send may succeed when retried. SMTP
+// replies are classified by their code: 4xx is temporary and 5xx is
+// permanent. Errors marked Permanent are permanent; any other error, such as
+// a dropped connection, is temporary.
+func Temporary(err error) bool {
+	var pe *permanentError
+	if errors.As(err, &pe) {
+		return false
+	}
+	var se *delivery.SMTPError
+	if errors.As(err, &se) {
+		return se.Temporary()
+	}
+	return true
+}
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseDelay   = time.Minute
+	DefaultMaxDelay    = 6 * time.Hour
+)
+
+// RetryPolicy decides what happens to a job after an attempt. Zero values
+// select the defaults.
+type RetryPolicy struct {
+	// MaxAttempts is how many attempts a job gets before it is
+	// dead-lettered.
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Rand draws the jitter. It is not safe for concurrent use; nil uses
+	// the global source, which is.
+	Rand *rand.Rand
+}
+
+// Backoff returns the delay before the retry following the given attempt:
+// BaseDelay doubled for every previous attempt, capped at MaxDelay, of
+// which a random half is subtracted so that failures at the same time do
+// not retry in lockstep.
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	base, max := p.BaseDelay, p.MaxDelay
+	if base <= 0 {
+		base = DefaultBaseDelay
+	}
+	if max <= 0 {
+		max = DefaultMaxDelay
+	}
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	half := int64(d / 2)
+	var jitter int64
+	if p.Rand != nil {
+		jitter = p.Rand.Int63n(half + 1)
+	} else {
+		jitter = rand.Int63n(half + 1)
+	}
+	return time.Duration(half + jitter)
+}
+
+// Settle records the outcome of an attempt at job: err is nil if it was
+// sent, or what the handler returned.
+func (p RetryPolicy) Settle(ctx context.Context, q Queue, job *Job, err error, now time.Time) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	var (
+		skip *skipError
+		def  *deferError
+	)
+	switch {
+	case err == nil:
+		return q.Complete(ctx, job, model.SendJobStatus_Sent, "")
+	case errors.As(err, &skip):
+		return q.Complete(ctx, job, model.SendJobStatus_Skipped, skip.reason)
+	case errors.As(err, &def):
+		return q.Retry(ctx, job, now.Add(def.delay), def.reason, true)
+	case !Temporary(err):
+		return q.Complete(ctx, job, model.SendJobStatus_Failed, err.Error())
+	case job.Attempts >= maxAttempts:
+		return q.Complete(ctx, job, model.SendJobStatus_Failed, fmt.Sprintf("gave up after %d attempts: %v", job.Attempts, err))
+	}
+	return q.Retry(ctx, job, now.Add(p.Backoff(job.Attempts)), err.Error(), false)
+}
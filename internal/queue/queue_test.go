@@ -0,0 +1,103 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/queue"
+	"github.com/stretchr/testify/assert"
+)
+
+// outcome is how recordingQueue saw a job settled.
+type outcome struct {
+	status   model.SendJobStatus
+	reason   string
+	retryAt  time.Time
+	deferral bool
+}
+
+// recordingQueue is a queue.Queue keeping the last outcome.
+type recordingQueue struct {
+	last outcome
+}
+
+func (q *recordingQueue) Dequeue(ctx context.Context, max int) ([]*queue.Job, error) {
+	return nil, nil
+}
+func (q *recordingQueue) Complete(ctx context.Context, job *queue.Job, status model.SendJobStatus, reason string) error {
+	q.last = outcome{status: status, reason: reason}
+	return nil
+}
+func (q *recordingQueue) Retry(ctx context.Context, job *queue.Job, at time.Time, reason string, deferral bool) error {
+	q.last = outcome{status: model.SendJobStatus_Pending, reason: reason, retryAt: at, deferral: deferral}
+	return nil
+}
+
+func TestTemporary(t *testing.T) {
+	deferred := &delivery.SMTPError{Code: 451, Message: "try again later"}
+	unknown := &delivery.SMTPError{Code: 550, EnhancedCode: "5.1.1", Message: "User unknown"}
+
+	assert.True(t, queue.Temporary(deferred))
+	assert.False(t, queue.Temporary(unknown))
+	assert.True(t, queue.Temporary(&delivery.RecipientError{Rejected: []delivery.Rejection{{Recipient: "ana@example.org", Err: deferred}}}))
+	assert.False(t, queue.Temporary(&delivery.RecipientError{Rejected: []delivery.Rejection{{Recipient: "ana@example.org", Err: unknown}}}))
+	assert.True(t, queue.Temporary(io.ErrUnexpectedEOF))
+	assert.False(t, queue.Temporary(queue.Permanent(errors.New("template does not compile"))))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := queue.RetryPolicy{BaseDelay: time.Minute, MaxDelay: time.Hour, Rand: rand.New(rand.NewSource(1))}
+	for _, tc := range []struct {
+		attempt int
+		full    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{7, time.Hour},
+		{50, time.Hour},
+	} {
+		for i := 0; i < 20; i++ {
+			d := p.Backoff(tc.attempt)
+			assert.GreaterOrEqual(t, d, tc.full/2, "attempt %d", tc.attempt)
+			assert.LessOrEqual(t, d, tc.full, "attempt %d", tc.attempt)
+		}
+	}
+}
+
+func TestRetryPolicy_Settle(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := queue.RetryPolicy{MaxAttempts: 3, BaseDelay: time.Minute, MaxDelay: time.Hour}
+
+	settle := func(attempts int, err error) outcome {
+		q := &recordingQueue{}
+		job := &queue.Job{SendJob: model.SendJob{ID: 1, Attempts: attempts}}
+		assert.NoError(t, p.Settle(context.Background(), q, job, err, now))
+		return q.last
+	}
+
+	assert.Equal(t, outcome{status: model.SendJobStatus_Sent}, settle(1, nil))
+	assert.Equal(t, outcome{status: model.SendJobStatus_Skipped, reason: "suppressed"}, settle(1, queue.Skip("suppressed")))
+
+	got := settle(1, queue.Defer(time.Minute, "campaign paused"))
+	assert.Equal(t, outcome{status: model.SendJobStatus_Pending, reason: "campaign paused", retryAt: now.Add(time.Minute), deferral: true}, got)
+
+	got = settle(2, &delivery.SMTPError{Code: 421, Message: "too many connections"})
+	assert.Equal(t, model.SendJobStatus_Pending, got.status)
+	assert.False(t, got.deferral)
+	assert.True(t, !got.retryAt.Before(now.Add(time.Minute)) && !got.retryAt.After(now.Add(2*time.Minute)))
+
+	got = settle(1, &delivery.SMTPError{Code: 550, EnhancedCode: "5.1.1", Message: "User unknown"})
+	assert.Equal(t, model.SendJobStatus_Failed, got.status)
+	assert.Contains(t, got.reason, "User unknown")
+
+	got = settle(3, io.ErrUnexpectedEOF)
+	assert.Equal(t, model.SendJobStatus_Failed, got.status)
+	assert.Equal(t, "gave up after 3 attempts: unexpected EOF", got.reason)
+}
@@ -0,0 +1,200 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultRedisStream = "send_jobs"
+	DefaultRedisGroup  = "workers"
+	// DefaultRelayBatch is how many jobs a Dequeue relays to the stream.
+	DefaultRelayBatch = 500
+	// DefaultRedisBlock is how long Dequeue waits for new entries.
+	DefaultRedisBlock = 2 * time.Second
+)
+
+// RedisOptions configures a Redis queue. Zero values select the defaults.
+type RedisOptions struct {
+	Stream string
+	Group  string
+	// Consumer names this worker in the consumer group. Defaults to the
+	// host name and a random suffix.
+	Consumer   string
+	Visibility time.Duration
+	RelayBatch int
+	Block      time.Duration
+}
+
+// Redis serves jobs from a Redis stream read by a consumer group.
+//
+// Jobs that become available in send_jobs are relayed to the stream by
+// whichever worker dequeues next. Entries only carry the job ID: a worker
+// still leases the job in Postgres before working on it and drops entries
+// whose job is settled or leased elsewhere, so duplicate or stale entries
+// never cause a second send. Entries of crashed workers are reclaimed from
+// the pending entries list once idle for the visibility timeout, and jobs
+// still available that long after being relayed, for example because Redis
+// lost their entry, are relayed again.
+type Redis struct {
+	rdb  *redis.Client
+	jobs repository.SendJobRepository
+	opts RedisOptions
+}
+
+// NewRedis returns a queue on rdb, creating the stream and consumer group
+// if needed.
+func NewRedis(ctx context.Context, rdb *redis.Client, jobs repository.SendJobRepository, opts RedisOptions) (*Redis, error) {
+	if opts.Stream == "" {
+		opts.Stream = DefaultRedisStream
+	}
+	if opts.Group == "" {
+		opts.Group = DefaultRedisGroup
+	}
+	if opts.Consumer == "" {
+		host, _ := os.Hostname()
+		opts.Consumer = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+	if opts.Visibility <= 0 {
+		opts.Visibility = DefaultVisibilityTimeout
+	}
+	if opts.RelayBatch <= 0 {
+		opts.RelayBatch = DefaultRelayBatch
+	}
+	if opts.Block <= 0 {
+		opts.Block = DefaultRedisBlock
+	}
+	err := rdb.XGroupCreateMkStream(ctx, opts.Stream, opts.Group, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, fmt.Errorf("create consumer group: %w", err)
+	}
+	return &Redis{rdb: rdb, jobs: jobs, opts: opts}, nil
+}
+
+func (q *Redis) Dequeue(ctx context.Context, max int) ([]*Job, error) {
+	push := func(jobs []*model.SendJob) error { return q.push(ctx, jobs) }
+	if _, err := q.jobs.Relay(ctx, q.opts.RelayBatch, q.opts.Visibility, push); err != nil {
+		return nil, err
+	}
+
+	msgs, _, err := q.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   q.opts.Stream,
+		Group:    q.opts.Group,
+		Consumer: q.opts.Consumer,
+		MinIdle:  q.opts.Visibility,
+		Start:    "0-0",
+		Count:    int64(max),
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("reclaim stream entries: %w", err)
+	}
+	if len(msgs) < max {
+		streams, err := q.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    q.opts.Group,
+			Consumer: q.opts.Consumer,
+			Streams:  []string{q.opts.Stream, ">"},
+			Count:    int64(max - len(msgs)),
+			Block:    q.opts.Block,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("read stream: %w", err)
+		}
+		for _, s := range streams {
+			msgs = append(msgs, s.Messages...)
+		}
+	}
+	if len(msgs) == 0 {
+		return nil, nil
+	}
+
+	receipts := make(map[int64][]string, len(msgs))
+	ids := make([]int64, 0, len(msgs))
+	for _, m := range msgs {
+		raw, _ := m.Values["id"].(string)
+		id, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			// Not one of ours; drop it.
+			q.ack(ctx, m.ID)
+			continue
+		}
+		if len(receipts[id]) == 0 {
+			ids = append(ids, id)
+		}
+		receipts[id] = append(receipts[id], m.ID)
+	}
+	leased, err := q.jobs.Claim(ctx, ids, q.opts.Visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]*Job, 0, len(leased))
+	for _, j := range leased {
+		r := receipts[j.ID]
+		out = append(out, &Job{SendJob: *j, receipt: r[0]})
+		q.ack(ctx, r[1:]...)
+		delete(receipts, j.ID)
+	}
+	// The remaining jobs are settled, not yet available or leased by another
+	// worker. Those still pending are relayed again when they are available.
+	var stale []int64
+	for id, r := range receipts {
+		stale = append(stale, id)
+		q.ack(ctx, r...)
+	}
+	if err := q.jobs.Unrelay(ctx, stale); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// push appends jobs to the stream in one round trip.
+func (q *Redis) push(ctx context.Context, jobs []*model.SendJob) error {
+	pipe := q.rdb.Pipeline()
+	for _, j := range jobs {
+		pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: q.opts.Stream,
+			Values: map[string]interface{}{"id": strconv.FormatInt(j.ID, 10)},
+		})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("relay send jobs: %w", err)
+	}
+	return nil
+}
+
+// ack removes entries from the pending entries list and the stream. A
+// failure only leaves an entry to be reclaimed and dropped later.
+func (q *Redis) ack(ctx context.Context, ids ...string) {
+	if len(ids) == 0 {
+		return
+	}
+	pipe := q.rdb.Pipeline()
+	pipe.XAck(ctx, q.opts.Stream, q.opts.Group, ids...)
+	pipe.XDel(ctx, q.opts.Stream, ids...)
+	pipe.Exec(ctx)
+}
+
+func (q *Redis) Complete(ctx context.Context, job *Job, status model.SendJobStatus, reason string) error {
+	if err := complete(ctx, q.jobs, job, status, reason); err != nil {
+		return err
+	}
+	q.ack(ctx, job.receipt)
+	return nil
+}
+
+func (q *Redis) Retry(ctx context.Context, job *Job, at time.Time, reason string, deferral bool) error {
+	if err := retry(ctx, q.jobs, job, at, reason, deferral); err != nil {
+		return err
+	}
+	q.ack(ctx, job.receipt)
+	return nil
+}
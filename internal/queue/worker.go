@@ -0,0 +1,120 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultConcurrency  = 8
+	DefaultPollInterval = time.Second
+)
+
+// Handler attempts to deliver a job. It returns nil once the message was
+// sent, Skip or Defer to settle the job without sending, or the error the
+// attempt failed with.
+type Handler func(ctx context.Context, job *model.SendJob) error
+
+// WorkerOptions configures a Worker. Zero values select the defaults.
+type WorkerOptions struct {
+	// Concurrency is how many jobs are handled at once.
+	Concurrency int
+	// PollInterval is how long the worker waits when the queue is empty.
+	PollInterval time.Duration
+	Policy       RetryPolicy
+}
+
+// Worker takes jobs from a queue, hands them to a Handler and settles them.
+type Worker struct {
+	queue   Queue
+	handler Handler
+	opts    WorkerOptions
+	logger  *zap.SugaredLogger
+}
+
+// NewWorker constructs a Worker.
+func NewWorker(q Queue, handler Handler, opts WorkerOptions, logger *zap.SugaredLogger) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DefaultConcurrency
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	return &Worker{queue: q, handler: handler, opts: opts, logger: logger}
+}
+
+// Run handles jobs until ctx is cancelled, then waits for the jobs in
+// progress. Errors are logged and retried on the next poll.
+func (w *Worker) Run(ctx context.Context) error {
+	w.logger.Infof("send worker handling %d jobs at once", w.opts.Concurrency)
+	slots := make(chan struct{}, w.opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		// Only dequeue as many jobs as there are free slots, so leases are
+		// not held by jobs waiting for one.
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+		free := 1
+	fill:
+		for free < w.opts.Concurrency {
+			select {
+			case slots <- struct{}{}:
+				free++
+			default:
+				break fill
+			}
+		}
+
+		jobs, err := w.queue.Dequeue(ctx, free)
+		if err != nil && ctx.Err() == nil {
+			w.logger.Errorf("dequeue send jobs: %v", err)
+		}
+		for i := len(jobs); i < free; i++ {
+			<-slots
+		}
+		for _, job := range jobs {
+			wg.Add(1)
+			go func(job *Job) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+				w.process(ctx, job)
+			}(job)
+		}
+		if len(jobs) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(w.opts.PollInterval):
+			}
+		}
+	}
+}
+
+// process handles and settles one job. Settling uses a context of its own
+// so a job that was attempted during shutdown is still recorded.
+func (w *Worker) process(ctx context.Context, job *Job) {
+	err := w.handler(ctx, &job.SendJob)
+	if err != nil && ctx.Err() != nil {
+		// Interrupted by shutdown: the lease expires and the job is retried.
+		return
+	}
+	settleCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	switch err := w.opts.Policy.Settle(settleCtx, w.queue, job, err, time.Now()); {
+	case errors.Is(err, ErrLeaseLost):
+		w.logger.Warnf("send job %d: lease lost before it was settled", job.ID)
+	case err != nil:
+		w.logger.Errorf("settle send job %d: %v", job.ID, err)
+	}
+}
@@ -0,0 +1,123 @@
+package queue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/queue"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// memQueue is an in-memory queue.Queue handing out jobs that are due.
+type memQueue struct {
+	mu      sync.Mutex
+	jobs    []*queue.Job
+	settled map[int64]model.SendJobStatus
+	done    chan struct{}
+}
+
+func newMemQueue(n int) *memQueue {
+	q := &memQueue{settled: map[int64]model.SendJobStatus{}, done: make(chan struct{})}
+	for i := 1; i <= n; i++ {
+		q.jobs = append(q.jobs, &queue.Job{SendJob: model.SendJob{ID: int64(i), Status: model.SendJobStatus_Pending}})
+	}
+	return q
+}
+
+func (q *memQueue) Dequeue(ctx context.Context, max int) ([]*queue.Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	now := time.Now()
+	var out []*queue.Job
+	for _, j := range q.jobs {
+		if len(out) == max {
+			break
+		}
+		if j.Status == model.SendJobStatus_Pending && !j.AvailableAt.After(now) {
+			j.Attempts++
+			j.AvailableAt = now.Add(time.Hour)
+			leased := *j
+			out = append(out, &leased)
+		}
+	}
+	return out, nil
+}
+
+func (q *memQueue) Complete(ctx context.Context, job *queue.Job, status model.SendJobStatus, reason string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.ID == job.ID {
+			j.Status = status
+		}
+	}
+	q.settled[job.ID] = status
+	if len(q.settled) == len(q.jobs) {
+		close(q.done)
+	}
+	return nil
+}
+
+func (q *memQueue) Retry(ctx context.Context, job *queue.Job, at time.Time, reason string, deferral bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, j := range q.jobs {
+		if j.ID == job.ID {
+			j.AvailableAt = at
+		}
+	}
+	return nil
+}
+
+func TestWorker_Run(t *testing.T) {
+	q := newMemQueue(20)
+	var (
+		mu       sync.Mutex
+		attempts = map[int64]int{}
+	)
+	handler := func(ctx context.Context, job *model.SendJob) error {
+		mu.Lock()
+		attempts[job.ID]++
+		mu.Unlock()
+		switch {
+		case job.ID == 1:
+			return &delivery.SMTPError{Code: 550, Message: "User unknown"}
+		case job.ID == 2:
+			return queue.Skip("suppressed")
+		case job.ID%5 == 0 && job.Attempts == 1:
+			return errors.New("connection reset")
+		}
+		return nil
+	}
+	// A backoff of zero retries right away.
+	policy := queue.RetryPolicy{BaseDelay: time.Nanosecond, MaxDelay: time.Nanosecond}
+	w := queue.NewWorker(q, handler, queue.WorkerOptions{Concurrency: 4, PollInterval: time.Millisecond, Policy: policy}, zap.NewNop().Sugar())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		w.Run(ctx)
+		close(done)
+	}()
+	select {
+	case <-q.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("jobs were not settled")
+	}
+	cancel()
+	<-done
+
+	assert.Equal(t, model.SendJobStatus_Failed, q.settled[1])
+	assert.Equal(t, model.SendJobStatus_Skipped, q.settled[2])
+	for id := int64(3); id <= 20; id++ {
+		assert.Equal(t, model.SendJobStatus_Sent, q.settled[id], "job %d", id)
+	}
+	assert.Equal(t, 2, attempts[5])
+	assert.Equal(t, 1, attempts[6])
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory is a Limiter whose buckets live in this process.
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	state
+	expires time.Time
+}
+
+// NewMemory returns an empty Memory limiter.
+func NewMemory() *Memory {
+	return NewMemoryWithClock(time.Now)
+}
+
+// NewMemoryWithClock returns an empty Memory limiter reading the time from
+// now.
+func NewMemoryWithClock(now func() time.Time) *Memory {
+	return &Memory{buckets: make(map[string]*memoryBucket), now: now}
+}
+
+func (m *Memory) Take(ctx context.Context, buckets []Bucket) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var wait time.Duration
+	states := make([]*memoryBucket, len(buckets))
+	for i, b := range buckets {
+		s := m.get(b, now)
+		s.advance(b.Rate, now)
+		if w := s.wait(b.Rate); w > wait {
+			wait = w
+		}
+		states[i] = s
+	}
+	if wait > 0 {
+		return wait, nil
+	}
+	for _, s := range states {
+		s.tokens--
+	}
+	m.sweep(now)
+	return 0, nil
+}
+
+func (m *Memory) Penalize(ctx context.Context, b Bucket) error {
+	if b.Rate.PerSecond <= 0 {
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	s := m.get(b, now)
+	s.advance(b.Rate, now)
+	s.factor *= PenaltyFactor
+	if s.factor < MinFactor {
+		s.factor = MinFactor
+	}
+	if s.tokens > 0 {
+		s.tokens = 0
+	}
+	return nil
+}
+
+// get returns the state of b, creating a full bucket.
+func (m *Memory) get(b Bucket, now time.Time) *memoryBucket {
+	s := m.buckets[b.Key]
+	if s == nil {
+		s = &memoryBucket{state: state{tokens: b.Rate.burst(), factor: 1, at: now}}
+		m.buckets[b.Key] = s
+	}
+	s.expires = now.Add(ttl(b.Rate))
+	return s
+}
+
+// sweep forgets buckets untouched for long enough to be full again. It
+// runs at most once a minute, once many buckets have accumulated.
+func (m *Memory) sweep(now time.Time) {
+	if len(m.buckets) < 10000 || now.Sub(m.swept) < time.Minute {
+		return
+	}
+	m.swept = now
+	for k, s := range m.buckets {
+		if now.After(s.expires) {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Package ratelimit paces outgoing mail with token buckets.
+//
+// Every send takes a token from the bucket of its recipient domain, of the
+// provider or IP it is sent through and of the account sending it, so that
+// no receiving provider sees more than it accepts and no account crowds out
+// the others. Buckets slow down when the receiving side defers messages
+// with 421 or 451 replies and recover gradually afterwards.
+//
+// Redis holds buckets shared by all workers; Memory holds buckets for one
+// process, for development and tests.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// PenaltyFactor scales the rate of a bucket every time it is penalised.
+	PenaltyFactor = 0.5
+	// MinFactor bounds how far penalties slow a bucket down.
+	MinFactor = 1.0 / 32
+	// RecoveryTime is how long a bucket at MinFactor takes to recover its
+	// full rate.
+	RecoveryTime = 10 * time.Minute
+)
+
+// Rate is a sustained rate and the burst allowed above it. A zero
+// PerSecond means no limit.
+type Rate struct {
+	PerSecond float64
+	// Burst defaults to one second's worth of tokens, at least one.
+	Burst int
+}
+
+func (r Rate) burst() float64 {
+	if r.Burst > 0 {
+		return float64(r.Burst)
+	}
+	return math.Max(1, math.Ceil(r.PerSecond))
+}
+
+// Bucket is a token bucket shared by the sends with the same key.
+type Bucket struct {
+	Key  string
+	Rate Rate
+}
+
+// Limiter takes tokens from buckets, which must be limited.
+type Limiter interface {
+	// Take takes a token from each of buckets if all have one, and returns
+	// zero. Otherwise it takes none and returns how long until they
+	// would.
+	Take(ctx context.Context, buckets []Bucket) (time.Duration, error)
+	// Penalize scales the rate of a bucket by PenaltyFactor and empties
+	// it. Unlimited buckets are left alone.
+	Penalize(ctx context.Context, bucket Bucket) error
+}
+
+// DomainRate overrides the default rate for one recipient domain.
+type DomainRate struct {
+	Domain string
+	Rate   Rate
+}
+
+// Policy maps sends to the buckets they take tokens from.
+type Policy struct {
+	// Domain is the rate per recipient domain, unless Domains overrides it.
+	Domain  Rate
+	Domains []DomainRate
+	// Provider is the rate of everything sent through ProviderName, such
+	// as the relay host or sending IP.
+	ProviderName string
+	Provider     Rate
+	// Account is the rate per sending workspace.
+	Account Rate
+}
+
+// DomainBucket returns the bucket of a recipient domain.
+func (p Policy) DomainBucket(domain string) Bucket {
+	domain = strings.ToLower(domain)
+	rate := p.Domain
+	for _, d := range p.Domains {
+		if strings.EqualFold(d.Domain, domain) {
+			rate = d.Rate
+			break
+		}
+	}
+	return Bucket{Key: "domain:" + domain, Rate: rate}
+}
+
+// Buckets returns the limited buckets a send from workspaceID to email
+// takes tokens from.
+func (p Policy) Buckets(workspaceID uuid.UUID, email string) []Bucket {
+	all := []Bucket{
+		p.DomainBucket(email[strings.LastIndexByte(email, '@')+1:]),
+		{Key: "provider:" + p.ProviderName, Rate: p.Provider},
+		{Key: "account:" + workspaceID.String(), Rate: p.Account},
+	}
+	out := all[:0]
+	for _, b := range all {
+		if b.Rate.PerSecond > 0 {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// Wait takes a token from each of buckets, sleeping for them as long as
+// each wait is at most maxWait. It returns zero once the tokens were
+// taken, or the wait that was longer than maxWait.
+func Wait(ctx context.Context, l Limiter, buckets []Bucket, maxWait time.Duration) (time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+	for {
+		wait, err := l.Take(ctx, buckets)
+		if err != nil || wait == 0 || wait > maxWait {
+			return wait, err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return 0, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// state is a bucket's tokens and rate factor at a point in time.
+type state struct {
+	tokens float64
+	factor float64
+	at     time.Time
+}
+
+// advance refills s up to now, recovering its factor first.
+func (s *state) advance(r Rate, now time.Time) {
+	elapsed := now.Sub(s.at).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	s.factor = math.Min(1, s.factor+elapsed/RecoveryTime.Seconds())
+	s.tokens = math.Min(r.burst(), s.tokens+elapsed*r.PerSecond*s.factor)
+	s.at = now
+}
+
+// wait returns how long until s has a token.
+func (s *state) wait(r Rate) time.Duration {
+	if s.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - s.tokens) / (r.PerSecond * s.factor) * float64(time.Second))
+}
+
+// ttl is how long an untouched bucket takes to become full and fully
+// recovered, after which it need not be kept.
+func ttl(r Rate) time.Duration {
+	full := time.Duration(r.burst() / r.PerSecond * float64(time.Second) / MinFactor)
+	if full < RecoveryTime {
+		full = RecoveryTime
+	}
+	return full + time.Minute
+}
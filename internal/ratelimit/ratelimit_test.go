@@ -0,0 +1,127 @@
+package ratelimit_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/ratelimit"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// clock is a manual clock for Memory.
+type clock struct{ t time.Time }
+
+func newClock() *clock {
+	return &clock{t: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func take(l ratelimit.Limiter, b ...ratelimit.Bucket) time.Duration {
+	wait, _ := l.Take(context.Background(), b)
+	return wait
+}
+
+func TestMemory_TokenBucket(t *testing.T) {
+	c := newClock()
+	l := ratelimit.NewMemoryWithClock(c.now)
+	gmail := ratelimit.Bucket{Key: "domain:gmail.com", Rate: ratelimit.Rate{PerSecond: 10, Burst: 3}}
+
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, take(l, gmail), "burst token %d", i)
+	}
+	assert.Equal(t, 100*time.Millisecond, take(l, gmail))
+	c.advance(50 * time.Millisecond)
+	assert.Equal(t, 50*time.Millisecond, take(l, gmail))
+	c.advance(50 * time.Millisecond)
+	assert.Zero(t, take(l, gmail))
+
+	// Refills stop at the burst.
+	c.advance(time.Hour)
+	for i := 0; i < 3; i++ {
+		assert.Zero(t, take(l, gmail))
+	}
+	assert.NotZero(t, take(l, gmail))
+}
+
+func TestMemory_TakesFromAllBucketsOrNone(t *testing.T) {
+	c := newClock()
+	l := ratelimit.NewMemoryWithClock(c.now)
+	domain := ratelimit.Bucket{Key: "domain:example.org", Rate: ratelimit.Rate{PerSecond: 1, Burst: 5}}
+	account := ratelimit.Bucket{Key: "account:a", Rate: ratelimit.Rate{PerSecond: 1, Burst: 1}}
+
+	assert.Zero(t, take(l, domain, account))
+	assert.Equal(t, time.Second, take(l, domain, account))
+	// The failed take left the domain bucket alone: 4 tokens remain.
+	for i := 0; i < 4; i++ {
+		assert.Zero(t, take(l, domain), "token %d", i)
+	}
+	assert.NotZero(t, take(l, domain))
+}
+
+func TestMemory_PenalizeAndRecover(t *testing.T) {
+	c := newClock()
+	l := ratelimit.NewMemoryWithClock(c.now)
+	yahoo := ratelimit.Bucket{Key: "domain:yahoo.com", Rate: ratelimit.Rate{PerSecond: 10, Burst: 1}}
+
+	assert.NoError(t, l.Penalize(context.Background(), yahoo))
+	assert.NoError(t, l.Penalize(context.Background(), yahoo))
+	// At a quarter of the rate a token takes 400ms.
+	assert.Equal(t, 400*time.Millisecond, take(l, yahoo))
+
+	// After the recovery time the full rate is back.
+	c.advance(ratelimit.RecoveryTime)
+	assert.Zero(t, take(l, yahoo))
+	assert.Equal(t, 100*time.Millisecond, take(l, yahoo))
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, l.Penalize(context.Background(), yahoo))
+	}
+	assert.Equal(t, time.Duration(float64(time.Second)/(10*ratelimit.MinFactor)), take(l, yahoo))
+}
+
+func TestPolicy_Buckets(t *testing.T) {
+	account := uuid.MustParse("6c1d3f4e-8a2b-4c5d-9e6f-7a8b9c0d1e2f")
+	p := ratelimit.Policy{
+		Domain:       ratelimit.Rate{PerSecond: 5},
+		Domains:      []ratelimit.DomainRate{{Domain: "gmail.com", Rate: ratelimit.Rate{PerSecond: 50, Burst: 100}}},
+		ProviderName: "smtp.example.com",
+		Provider:     ratelimit.Rate{PerSecond: 200},
+	}
+
+	assert.Equal(t, []ratelimit.Bucket{
+		{Key: "domain:gmail.com", Rate: ratelimit.Rate{PerSecond: 50, Burst: 100}},
+		{Key: "provider:smtp.example.com", Rate: ratelimit.Rate{PerSecond: 200}},
+	}, p.Buckets(account, "ana@GMail.com"))
+
+	p.Account = ratelimit.Rate{PerSecond: 20}
+	assert.Equal(t, []ratelimit.Bucket{
+		{Key: "domain:example.org", Rate: ratelimit.Rate{PerSecond: 5}},
+		{Key: "provider:smtp.example.com", Rate: ratelimit.Rate{PerSecond: 200}},
+		{Key: "account:" + account.String(), Rate: ratelimit.Rate{PerSecond: 20}},
+	}, p.Buckets(account, "bo@example.org"))
+
+	assert.Empty(t, ratelimit.Policy{}.Buckets(account, "bo@example.org"))
+}
+
+func TestWait(t *testing.T) {
+	l := ratelimit.NewMemory()
+	slow := []ratelimit.Bucket{{Key: "domain:example.org", Rate: ratelimit.Rate{PerSecond: 50, Burst: 1}}}
+	ctx := context.Background()
+
+	wait, err := ratelimit.Wait(ctx, l, slow, time.Second)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	// The next token is 20ms away: short enough to sleep for.
+	wait, err = ratelimit.Wait(ctx, l, slow, time.Second)
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+	// Too long to sleep for: the wait is returned.
+	wait, err = ratelimit.Wait(ctx, l, slow, time.Millisecond)
+	assert.NoError(t, err)
+	assert.Greater(t, wait, time.Millisecond)
+}
@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultRedisPrefix namespaces bucket keys in Redis.
+const DefaultRedisPrefix = "ratelimit:"
+
+// takeScript is Memory.Take for buckets stored as hashes of tokens (t),
+// factor (f) and the time they were last updated (ts, in milliseconds).
+// KEYS are the buckets; ARGV is now, the recovery per millisecond and then
+// the rate per millisecond, burst and TTL of every bucket.
+var takeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local recovery = tonumber(ARGV[2])
+local wait = 0
+local tokens = {}
+local factors = {}
+for i, key in ipairs(KEYS) do
+  local rate = tonumber(ARGV[3*i])
+  local burst = tonumber(ARGV[3*i+1])
+  local h = redis.call('HMGET', key, 't', 'f', 'ts')
+  local t = tonumber(h[1]) or burst
+  local f = tonumber(h[2]) or 1
+  local elapsed = math.max(0, now - (tonumber(h[3]) or now))
+  f = math.min(1, f + elapsed * recovery)
+  t = math.min(burst, t + elapsed * rate * f)
+  if t < 1 then
+    wait = math.max(wait, (1 - t) / (rate * f))
+  end
+  tokens[i] = t
+  factors[i] = f
+end
+for i, key in ipairs(KEYS) do
+  local t = tokens[i]
+  if wait == 0 then
+    t = t - 1
+  end
+  redis.call('HSET', key, 't', t, 'f', factors[i], 'ts', now)
+  redis.call('PEXPIRE', key, ARGV[3*i+2])
+end
+return tostring(wait)
+`)
+
+// penalizeScript is Memory.Penalize. ARGV is now, the recovery per
+// millisecond, the bucket's rate per millisecond, burst and TTL, the
+// penalty factor and the minimum factor.
+var penalizeScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local rate = tonumber(ARGV[3])
+local burst = tonumber(ARGV[4])
+local h = redis.call('HMGET', KEYS[1], 't', 'f', 'ts')
+local t = tonumber(h[1]) or burst
+local f = tonumber(h[2]) or 1
+local elapsed = math.max(0, now - (tonumber(h[3]) or now))
+f = math.min(1, f + elapsed * tonumber(ARGV[2]))
+t = math.min(burst, t + elapsed * rate * f)
+f = math.max(tonumber(ARGV[7]), f * tonumber(ARGV[6]))
+redis.call('HSET', KEYS[1], 't', math.min(t, 0), 'f', f, 'ts', now)
+redis.call('PEXPIRE', KEYS[1], ARGV[5])
+return 1
+`)
+
+// Redis is a Limiter whose buckets are shared through Redis. Buckets are
+// updated by scripts, so concurrent workers never take the same token.
+type Redis struct {
+	rdb    *redis.Client
+	prefix string
+}
+
+// NewRedis returns a limiter storing buckets in rdb under prefix; empty
+// selects DefaultRedisPrefix.
+func NewRedis(rdb *redis.Client, prefix string) *Redis {
+	if prefix == "" {
+		prefix = DefaultRedisPrefix
+	}
+	return &Redis{rdb: rdb, prefix: prefix}
+}
+
+func (l *Redis) Take(ctx context.Context, buckets []Bucket) (time.Duration, error) {
+	if len(buckets) == 0 {
+		return 0, nil
+	}
+	keys := make([]string, len(buckets))
+	args := []interface{}{nowMillis(), recoveryPerMilli()}
+	for i, b := range buckets {
+		keys[i] = l.prefix + b.Key
+		args = append(args, b.Rate.PerSecond/1000, b.Rate.burst(), ttl(b.Rate).Milliseconds())
+	}
+	res, err := takeScript.Run(ctx, l.rdb, keys, args...).Text()
+	if err != nil {
+		return 0, fmt.Errorf("take rate limit tokens: %w", err)
+	}
+	ms, err := strconv.ParseFloat(res, 64)
+	if err != nil {
+		return 0, fmt.Errorf("take rate limit tokens: %w", err)
+	}
+	return time.Duration(ms * float64(time.Millisecond)), nil
+}
+
+func (l *Redis) Penalize(ctx context.Context, b Bucket) error {
+	if b.Rate.PerSecond <= 0 {
+		return nil
+	}
+	err := penalizeScript.Run(ctx, l.rdb, []string{l.prefix + b.Key},
+		nowMillis(), recoveryPerMilli(),
+		b.Rate.PerSecond/1000, b.Rate.burst(), ttl(b.Rate).Milliseconds(),
+		PenaltyFactor, MinFactor,
+	).Err()
+	if err != nil {
+		return fmt.Errorf("penalize rate limit bucket: %w", err)
+	}
+	return nil
+}
+
+func nowMillis() float64 {
+	return float64(time.Now().UnixNano()) / float64(time.Millisecond)
+}
+
+func recoveryPerMilli() float64 {
+	return 1 / float64(RecoveryTime.Milliseconds())
+}
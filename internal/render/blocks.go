@@ -0,0 +1,240 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+// Blocks are the shared content blocks and layouts of a workspace, keyed by
+// name.
+//
+// A template includes a block with {{include "footer"}} and extends a layout
+// by naming it; the layout marks where the template body goes with
+// {{content}}. Both are expanded into the template source before it is
+// parsed, so merge tags in blocks are escaped for the context they end up in.
+type Blocks map[string]*model.ContentBlock
+
+const (
+	// maxBlockDepth bounds how deeply blocks may include other blocks.
+	maxBlockDepth = 8
+	// maxIncludes bounds the includes expanded into one part of a template,
+	// and maxExpandedBytes the size of the part with them expanded.
+	maxIncludes      = 200
+	maxExpandedBytes = 512 << 10
+)
+
+var (
+	includeRe = regexp.MustCompile(`\{\{\s*include\s+"([^"\\]*)"\s*\}\}`)
+	contentRe = regexp.MustCompile(`\{\{\s*content\s*\}\}`)
+)
+
+// Includes returns the names of the blocks src includes directly, sorted and
+// without duplicates.
+func Includes(src ...string) []string {
+	seen := make(map[string]bool)
+	for _, s := range src {
+		for _, m := range includeRe.FindAllStringSubmatch(s, -1) {
+			seen[m[1]] = true
+		}
+	}
+	return sortedNames(seen)
+}
+
+// TemplateRefs returns the layout and blocks any variant of content uses
+// directly.
+func TemplateRefs(content model.LocalizedContent) []string {
+	var src []string
+	for _, lang := range content.Languages() {
+		c, _ := content.ContentFor(lang)
+		src = append(src, c.Subject, c.Preheader, c.HTMLBody, c.TextBody)
+	}
+	refs := Includes(src...)
+	if content.Layout != "" {
+		refs = append(refs, content.Layout)
+		sort.Strings(refs)
+		refs = dedupe(refs)
+	}
+	return refs
+}
+
+// BlockRefs returns the blocks any variant of b includes directly.
+func BlockRefs(b *model.ContentBlock) []string {
+	src := []string{b.HTMLBody, b.TextBody}
+	for _, v := range b.Variants {
+		src = append(src, v.HTMLBody, v.TextBody)
+	}
+	return Includes(src...)
+}
+
+// ValidateBlock reports problems in every variant of b as if it were
+// included in a template. opts.Blocks need not contain b itself.
+func ValidateBlock(b *model.ContentBlock, opts Options) error {
+	blocks := make(Blocks, len(opts.Blocks)+1)
+	for name, other := range opts.Blocks {
+		blocks[name] = other
+	}
+	blocks[b.Name] = b
+	opts.Blocks = blocks
+	opts.Layout = ""
+
+	langs := []model.Language{b.Lang}
+	for code := range b.Variants {
+		if lang, ok := model.ParseLanguage(code); ok && lang != b.Lang {
+			langs = append(langs, lang)
+		}
+	}
+	for _, lang := range langs {
+		opts.Lang = lang
+		var content model.TemplateContent
+		if b.Kind == model.BlockKind_Layout {
+			c := b.ContentFor(lang)
+			if err := checkLayout(c); err != nil {
+				return fmt.Errorf("%s variant: %w", lang, err)
+			}
+			content = model.TemplateContent{HTMLBody: fill(c.HTMLBody, ""), TextBody: fill(c.TextBody, "")}
+		} else {
+			// Compile through an include so cycles back to b are found.
+			ref := `{{include "` + b.Name + `"}}`
+			content = model.TemplateContent{HTMLBody: ref, TextBody: ref}
+		}
+		if _, err := Compile(content, opts); err != nil {
+			return fmt.Errorf("%s variant: %w", lang, err)
+		}
+	}
+	return nil
+}
+
+func checkLayout(c model.BlockContent) error {
+	var problems []Problem
+	if !contentRe.MatchString(c.HTMLBody) {
+		problems = append(problems, Problem{Part: PartHTML, Message: "layout has no {{content}} placeholder"})
+	}
+	if c.TextBody != "" && !contentRe.MatchString(c.TextBody) {
+		problems = append(problems, Problem{Part: PartText, Message: "layout has no {{content}} placeholder"})
+	}
+	if len(problems) > 0 {
+		return &CompileError{Problems: problems}
+	}
+	return nil
+}
+
+// layout places the body of content in the layout named by c.opts.Layout.
+func (c *compiler) layout(content model.TemplateContent) model.TemplateContent {
+	name := c.opts.Layout
+	if name == "" {
+		return content
+	}
+	l, ok := c.opts.Blocks[name]
+	if !ok || l.Kind != model.BlockKind_Layout {
+		c.report(PartHTML, "unknown layout %q", name)
+		return content
+	}
+	lc := l.ContentFor(c.opts.Lang)
+	if content.HTMLBody != "" {
+		content.HTMLBody = fill(lc.HTMLBody, content.HTMLBody)
+	}
+	if content.TextBody != "" && lc.TextBody != "" {
+		content.TextBody = fill(lc.TextBody, content.TextBody)
+	}
+	return content
+}
+
+func fill(layout, body string) string {
+	return contentRe.ReplaceAllLiteralString(layout, body)
+}
+
+// expand replaces every {{include}} in src with the block's source for part,
+// recursively.
+func (c *compiler) expand(part Part, src string) string {
+	e := &expansion{part: part, size: len(src)}
+	out := c.include(e, src, nil)
+	if e.exceeded {
+		return ""
+	}
+	return out
+}
+
+// expansion tracks the includes expanded into one part. A few blocks
+// including each other many times can otherwise blow a small template up
+// exponentially before it is parsed.
+type expansion struct {
+	part     Part
+	includes int
+	size     int
+	exceeded bool
+}
+
+// include expands the includes of src. stack holds the blocks being
+// expanded.
+func (c *compiler) include(e *expansion, src string, stack []string) string {
+	if !strings.Contains(src, "include") {
+		return src
+	}
+	part := e.part
+	return includeRe.ReplaceAllStringFunc(src, func(m string) string {
+		if e.exceeded {
+			return ""
+		}
+		name := includeRe.FindStringSubmatch(m)[1]
+		if part != PartHTML && part != PartText {
+			c.report(part, "blocks can only be included in the body")
+			return ""
+		}
+		for _, s := range stack {
+			if s == name {
+				c.report(part, "block %q is included recursively", name)
+				return ""
+			}
+		}
+		if len(stack) >= maxBlockDepth {
+			c.report(part, "blocks nested more than %d deep", maxBlockDepth)
+			return ""
+		}
+		b, ok := c.opts.Blocks[name]
+		if !ok || b.Kind != model.BlockKind_Block {
+			c.report(part, "unknown block %q", name)
+			return ""
+		}
+		bc := b.ContentFor(c.opts.Lang)
+		body := bc.HTMLBody
+		if part == PartText {
+			body = bc.TextBody
+		}
+		e.includes++
+		e.size += len(body)
+		switch {
+		case e.includes > maxIncludes:
+			c.report(part, "more than %d blocks are included", maxIncludes)
+			e.exceeded = true
+			return ""
+		case e.size > maxExpandedBytes:
+			c.report(part, "included blocks exceed %d bytes", maxExpandedBytes)
+			e.exceeded = true
+			return ""
+		}
+		return c.include(e, body, append(stack[:len(stack):len(stack)], name))
+	})
+}
+
+func sortedNames(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for name := range set {
+		out = append(out, name)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func dedupe(sorted []string) []string {
+	out := sorted[:0]
+	for i, s := range sorted {
+		if i == 0 || s != sorted[i-1] {
+			out = append(out, s)
+		}
+	}
+	return out
+}
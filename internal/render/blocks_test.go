@@ -0,0 +1,136 @@
+package render_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func testBlocks() render.Blocks {
+	return render.Blocks{
+		"footer": {
+			Name: "footer", Kind: model.BlockKind_Block,
+			BlockContent: model.BlockContent{
+				HTMLBody: `<footer>{{include "address"}} · <a href="{{vars.unsubscribe_url}}">Unsubscribe</a></footer>`,
+				TextBody: `{{include "address"}}` + "\nUnsubscribe: {{vars.unsubscribe_url}}",
+			},
+			Variants: model.BlockVariants{"fa": {HTMLBody: `<footer>لغو اشتراک</footer>`}},
+		},
+		"address": {
+			Name: "address", Kind: model.BlockKind_Block,
+			BlockContent: model.BlockContent{HTMLBody: `Acme &amp; Co`, TextBody: `Acme & Co`},
+		},
+		"main": {
+			Name: "main", Kind: model.BlockKind_Layout,
+			BlockContent: model.BlockContent{
+				HTMLBody: `<div class="wrap">{{content}}{{include "footer"}}</div>`,
+				TextBody: "{{content}}\n--\n" + `{{include "footer"}}`,
+			},
+		},
+	}
+}
+
+func TestCompileSet_LayoutAndBlocks(t *testing.T) {
+	set, err := render.CompileSet(model.LocalizedContent{
+		TemplateContent: model.TemplateContent{
+			Subject:  "Hi",
+			HTMLBody: `<p>Hello {{contact.first_name}}</p>`,
+			TextBody: `Hello {{contact.first_name}}`,
+		},
+		Variants: model.TemplateVariants{"fa": {Subject: "سلام", HTMLBody: `<p>سلام</p>`}},
+		Layout:   "main",
+	}, render.Options{Blocks: testBlocks()})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := set.Render(context.Background(), render.Data{
+		Contact: &model.Contact{FirstName: "<b>"},
+		Vars:    map[string]string{"unsubscribe_url": "https://x.test/u?a=1&b=2"},
+	}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `<div class="wrap"><p>Hello &lt;b&gt;</p><footer>Acme &amp; Co · <a href="https://x.test/u?a=1&amp;b=2">Unsubscribe</a></footer></div>`, out.HTML)
+	assert.Equal(t, "Hello <b>\n--\nAcme & Co\nUnsubscribe: https://x.test/u?a=1&b=2", out.Text)
+
+	// The Persian variant uses the Persian footer.
+	out, err = set.Render(context.Background(), render.Data{
+		Contact: &model.Contact{Lang: model.Language_FA},
+	}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, out.HTML, `<p>سلام</p><footer>لغو اشتراک</footer>`)
+}
+
+func TestCompile_BlockProblems(t *testing.T) {
+	blocks := testBlocks()
+	blocks["loop"] = &model.ContentBlock{Name: "loop", Kind: model.BlockKind_Block,
+		BlockContent: model.BlockContent{HTMLBody: `{{include "loop"}}`}}
+	// Each level includes the next ten times.
+	for i, next := range []string{"fan1", "fan2", "address"} {
+		name := fmt.Sprintf("fan%d", i)
+		blocks[name] = &model.ContentBlock{Name: name, Kind: model.BlockKind_Block,
+			BlockContent: model.BlockContent{HTMLBody: strings.Repeat(`{{include "`+next+`"}}`, 10)}}
+	}
+	blocks["big"] = &model.ContentBlock{Name: "big", Kind: model.BlockKind_Block,
+		BlockContent: model.BlockContent{HTMLBody: strings.Repeat("x", 300<<10)}}
+
+	cases := []struct {
+		name    string
+		content model.TemplateContent
+		layout  string
+		want    string
+	}{
+		{"unknown block", model.TemplateContent{HTMLBody: `{{include "nope"}}`}, "", `html_body: unknown block "nope"`},
+		{"layout included", model.TemplateContent{HTMLBody: `{{include "main"}}`}, "", `html_body: unknown block "main"`},
+		{"recursive", model.TemplateContent{HTMLBody: `{{include "loop"}}`}, "", `html_body: block "loop" is included recursively`},
+		{"subject", model.TemplateContent{Subject: `{{include "address"}}`}, "", `subject: blocks can only be included in the body`},
+		{"fan out", model.TemplateContent{HTMLBody: `{{include "fan0"}}`}, "", `html_body: more than 200 blocks are included`},
+		{"too large", model.TemplateContent{HTMLBody: `{{include "big"}}{{include "big"}}`}, "", `html_body: included blocks exceed 524288 bytes`},
+		{"unknown layout", model.TemplateContent{HTMLBody: `x`}, "footer", `html_body: unknown layout "footer"`},
+	}
+	for _, tc := range cases {
+		_, err := render.Compile(tc.content, render.Options{Blocks: blocks, Layout: tc.layout})
+		var cerr *render.CompileError
+		if assert.True(t, errors.As(err, &cerr), tc.name) {
+			assert.Equal(t, tc.want, string(cerr.Problems[0].Part)+": "+cerr.Problems[0].Message, tc.name)
+		}
+	}
+}
+
+func TestValidateBlock(t *testing.T) {
+	blocks := testBlocks()
+	assert.NoError(t, render.ValidateBlock(blocks["footer"], render.Options{Blocks: blocks}))
+	assert.NoError(t, render.ValidateBlock(blocks["main"], render.Options{Blocks: blocks}))
+
+	// Making the address include the footer would create a cycle.
+	cyclic := &model.ContentBlock{Name: "address", Kind: model.BlockKind_Block,
+		BlockContent: model.BlockContent{HTMLBody: `{{include "footer"}}`}}
+	assert.ErrorContains(t, render.ValidateBlock(cyclic, render.Options{Blocks: blocks}), "included recursively")
+
+	noSlot := &model.ContentBlock{Name: "bare", Kind: model.BlockKind_Layout,
+		BlockContent: model.BlockContent{HTMLBody: `<div></div>`}}
+	assert.ErrorContains(t, render.ValidateBlock(noSlot, render.Options{}), "no {{content}} placeholder")
+
+	bad := &model.ContentBlock{Name: "social", Kind: model.BlockKind_Block,
+		BlockContent: model.BlockContent{HTMLBody: `{{contact.nope}}`}}
+	assert.ErrorContains(t, render.ValidateBlock(bad, render.Options{}), "unknown field contact.nope")
+}
+
+func TestTemplateRefs(t *testing.T) {
+	refs := render.TemplateRefs(model.LocalizedContent{
+		TemplateContent: model.TemplateContent{HTMLBody: `{{include "footer"}}{{ include "social" }}`},
+		Variants:        model.TemplateVariants{"fa": {TextBody: `{{include "address"}}{{include "footer"}}`}},
+		Layout:          "main",
+	})
+	assert.Equal(t, []string{"address", "footer", "main", "social"}, refs)
+	assert.Equal(t, []string{"address"}, render.BlockRefs(testBlocks()["footer"]))
+}
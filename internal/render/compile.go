@@ -0,0 +1,286 @@
+package render
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// Merge tag roots. {{contact.first_name}} is parsed as a call to the
+// placeholder function "contact" followed by a field chain; the compiler
+// rewrites it into a lookup on the data map.
+const (
+	rootContact = "contact"
+	rootVars    = "vars"
+)
+
+// ContactFields are the standard fields available under "contact".
+var ContactFields = []string{
+	"id", "email", "first_name", "last_name", "full_name", "lang", "created_at", "custom",
+}
+
+var contactFieldSet = func() map[string]bool {
+	m := make(map[string]bool, len(ContactFields))
+	for _, f := range ContactFields {
+		m[f] = true
+	}
+	return m
+}()
+
+type compiler struct {
+	opts     Options
+	custom   map[string]bool
+	problems []Problem
+	// fields maps each merge tag written to the output to whether every
+	// use of it has a default.
+	fields map[string]bool
+}
+
+// use describes where a field reference appears.
+type use struct {
+	// output is set for references written to the output, as opposed to
+	// conditions.
+	output     bool
+	hasDefault bool
+}
+
+func (c *compiler) report(part Part, format string, args ...interface{}) {
+	c.problems = append(c.problems, Problem{Part: part, Message: fmt.Sprintf(format, args...)})
+}
+
+func (c *compiler) text(part Part, src string) *template.Template {
+	t, err := template.New(string(part)).
+		Option("missingkey=zero").
+		Funcs(funcs(c.opts.Lang)).
+		Parse(src)
+	if err != nil {
+		c.report(part, "%v", err)
+		return nil
+	}
+	if len(t.Templates()) > 1 {
+		c.report(part, "nested template definitions are not allowed")
+	}
+	c.check(part, t.Tree)
+	return t
+}
+
+func (c *compiler) html(part Part, src string) *htmltemplate.Template {
+	t, err := htmltemplate.New(string(part)).
+		Option("missingkey=zero").
+		Funcs(htmltemplate.FuncMap(funcs(c.opts.Lang))).
+		Parse(src)
+	if err != nil {
+		c.report(part, "%v", err)
+		return nil
+	}
+	if len(t.Templates()) > 1 {
+		c.report(part, "nested template definitions are not allowed")
+	}
+	c.check(part, t.Tree)
+	return t
+}
+
+// check walks tree, rewriting merge tags in place and reporting unknown
+// fields and constructs the sandbox does not allow.
+func (c *compiler) check(part Part, tree *parse.Tree) {
+	if tree == nil || tree.Root == nil {
+		return
+	}
+	c.walk(part, tree.Root)
+}
+
+func (c *compiler) walk(part Part, node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.walk(part, child)
+		}
+	case *parse.ActionNode:
+		c.pipe(part, n.Pipe, true)
+	case *parse.IfNode:
+		c.branch(part, &n.BranchNode)
+	case *parse.WithNode:
+		c.branch(part, &n.BranchNode)
+	case *parse.RangeNode:
+		switch {
+		case rangesOverNumber(n.Pipe):
+			c.report(part, "line %d: range over a number is not allowed", n.Line)
+		case !rangesOverData(n.Pipe):
+			c.report(part, "line %d: range is only allowed over fields and variables", n.Line)
+		}
+		c.branch(part, &n.BranchNode)
+		guardLoop(n)
+	case *parse.TemplateNode:
+		c.report(part, "line %d: {{template}} is not allowed", n.Line)
+	}
+}
+
+func (c *compiler) branch(part Part, n *parse.BranchNode) {
+	c.pipe(part, n.Pipe, false)
+	c.walk(part, n.List)
+	if n.ElseList != nil {
+		c.walk(part, n.ElseList)
+	}
+}
+
+func (c *compiler) pipe(part Part, p *parse.PipeNode, output bool) {
+	if p == nil {
+		return
+	}
+	// $ must stay the template data, which carries the loop guard.
+	for _, v := range p.Decl {
+		if v.Ident[0] == "$" {
+			c.report(part, "line %d: assigning to $ is not allowed", p.Line)
+		}
+	}
+	// Only the value that reaches the output matters: in
+	// {{contact.first_name | default "friend"}} the field is covered.
+	u := use{output: output && len(p.Decl) == 0}
+	for _, cmd := range p.Cmds[1:] {
+		if id, ok := cmd.Args[0].(*parse.IdentifierNode); ok && id.Ident == "default" {
+			u.hasDefault = true
+		}
+	}
+	for _, cmd := range p.Cmds {
+		for i, arg := range cmd.Args {
+			cmd.Args[i] = c.arg(part, p.Line, arg, u)
+		}
+	}
+}
+
+// arg validates one command argument and returns its replacement.
+func (c *compiler) arg(part Part, line int, node parse.Node, u use) parse.Node {
+	switch n := node.(type) {
+	case *parse.PipeNode:
+		c.pipe(part, n, u.output)
+	case *parse.ChainNode:
+		if id, ok := n.Node.(*parse.IdentifierNode); ok && isRoot(id.Ident) {
+			ident := append([]string{id.Ident}, n.Field...)
+			c.field(part, line, ident, u)
+			return &parse.FieldNode{NodeType: parse.NodeField, Pos: n.Pos, Ident: ident}
+		}
+		if p, ok := n.Node.(*parse.PipeNode); ok {
+			c.pipe(part, p, u.output)
+		}
+	case *parse.IdentifierNode:
+		if isRoot(n.Ident) {
+			return &parse.FieldNode{NodeType: parse.NodeField, Pos: n.Pos, Ident: []string{n.Ident}}
+		}
+	case *parse.FieldNode:
+		c.field(part, line, n.Ident, u)
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			c.field(part, line, n.Ident[1:], u)
+		}
+	}
+	return node
+}
+
+// field validates a field path rooted at the template data and records
+// merge tags written to the output.
+func (c *compiler) field(part Part, line int, ident []string, u use) {
+	if len(ident) == 0 {
+		return
+	}
+	n := 2
+	switch ident[0] {
+	case rootContact:
+		if len(ident) < 2 {
+			return
+		}
+		if !contactFieldSet[ident[1]] {
+			c.report(part, "line %d: unknown field contact.%s", line, ident[1])
+			return
+		}
+		if ident[1] == "custom" {
+			if len(ident) < 3 {
+				return
+			}
+			if c.custom != nil && !c.custom[ident[2]] {
+				c.report(part, "line %d: unknown custom field contact.custom.%s", line, ident[2])
+				return
+			}
+			n = 3
+		}
+	case rootVars:
+		if len(ident) < 2 {
+			return
+		}
+	default:
+		c.report(part, "line %d: unknown field %s", line, ident[0])
+		return
+	}
+	if !u.output {
+		return
+	}
+	if c.fields == nil {
+		c.fields = make(map[string]bool)
+	}
+	path := strings.Join(ident[:n], ".")
+	if covered, seen := c.fields[path]; !seen || covered {
+		c.fields[path] = u.hasDefault
+	}
+}
+
+func isRoot(name string) bool {
+	return name == rootContact || name == rootVars
+}
+
+func rangesOverNumber(p *parse.PipeNode) bool {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return false
+	}
+	_, ok := p.Cmds[0].Args[0].(*parse.NumberNode)
+	return ok
+}
+
+// rangesOverData reports whether p is a single field, variable or merge tag,
+// as opposed to a command computing what to range over.
+func rangesOverData(p *parse.PipeNode) bool {
+	if p == nil || len(p.Cmds) != 1 || len(p.Cmds[0].Args) != 1 {
+		return false
+	}
+	switch n := p.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode, *parse.VariableNode, *parse.DotNode:
+		return true
+	case *parse.IdentifierNode:
+		return isRoot(n.Ident)
+	case *parse.ChainNode:
+		id, ok := n.Node.(*parse.IdentifierNode)
+		return ok && isRoot(id.Ident)
+	}
+	return false
+}
+
+// guardLoop makes every iteration of n call the loop guard first. The call
+// is a declaration, so it writes nothing and html/template leaves it alone.
+func guardLoop(n *parse.RangeNode) {
+	if n.List == nil {
+		n.List = &parse.ListNode{NodeType: parse.NodeList, Pos: n.Pos}
+	}
+	call := &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      n.Pos,
+		Line:     n.Line,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      n.Pos,
+			Line:     n.Line,
+			Decl:     []*parse.VariableNode{{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: []string{"$" + loopGuardFunc}}},
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      n.Pos,
+				Args: []parse.Node{
+					parse.NewIdentifier(loopGuardFunc).SetPos(n.Pos),
+					&parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Pos, Ident: []string{"$"}},
+				},
+			}},
+		},
+	}
+	n.List.Nodes = append([]parse.Node{call}, n.List.Nodes...)
+}
@@ -0,0 +1,204 @@
+package render
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+// Named date layouts accepted by the date function in addition to Go
+// reference layouts.
+var dateLayouts = map[string]string{
+	"short":    "2006-01-02",
+	"medium":   "Jan 2, 2006",
+	"long":     "January 2, 2006",
+	"datetime": "2006-01-02 15:04",
+}
+
+// funcs is the curated function set available to templates. Nothing here
+// touches the filesystem, network or clock beyond "now".
+func funcs(lang model.Language) template.FuncMap {
+	m := template.FuncMap{
+		// Placeholders so merge tag roots parse; the compiler rewrites
+		// every use into a data lookup.
+		rootContact: func() map[string]interface{} { return nil },
+		rootVars:    func() map[string]string { return nil },
+
+		"default":  defaultValue,
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"title":    title,
+		"trim":     strings.TrimSpace,
+		"truncate": truncate,
+		"contains": func(substr, s string) bool { return strings.Contains(s, substr) },
+		"has":      has,
+		"date":     formatDate,
+		"now":      time.Now,
+
+		loopGuardFunc: checkLoop,
+	}
+	for name, fn := range localeFuncs(lang) {
+		m[name] = fn
+	}
+	return m
+}
+
+// defaultValue returns def when v is empty, so that
+// {{contact.first_name | default "friend"}} reads naturally.
+func defaultValue(def string, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Map, reflect.Slice, reflect.Array:
+		return rv.Len() == 0
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.IsZero()
+	}
+	return rv.IsZero()
+}
+
+func title(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsSpace(prev) {
+			return unicode.ToTitle(r)
+		}
+		return r
+	}, s)
+}
+
+func truncate(n int, s string) string {
+	r := []rune(s)
+	if n < 0 || len(r) <= n {
+		return s
+	}
+	return string(r[:n]) + "…"
+}
+
+// has reports whether key is set to a non-empty value in m, for
+// conditionals such as {{if contact.custom | has "plan"}}.
+func has(key string, m map[string]string) bool {
+	return m[key] != ""
+}
+
+// formatDate formats a time.Time or RFC 3339 string with a named or Go
+// reference layout.
+func formatDate(layout string, v interface{}) (string, error) {
+	t, ok, err := toTime(v)
+	if err != nil || !ok {
+		return "", err
+	}
+	if named, ok := dateLayouts[layout]; ok {
+		layout = named
+	}
+	return t.Format(layout), nil
+}
+
+// toTime accepts a time.Time or RFC 3339 string. ok is false for empty
+// values, which format as the empty string.
+func toTime(v interface{}) (t time.Time, ok bool, err error) {
+	switch x := v.(type) {
+	case time.Time:
+		t = x
+	case *time.Time:
+		if x == nil {
+			return t, false, nil
+		}
+		t = *x
+	case string:
+		if x == "" {
+			return t, false, nil
+		}
+		if t, err = time.Parse(time.RFC3339, x); err != nil {
+			return t, false, fmt.Errorf("%q is not an RFC 3339 time", x)
+		}
+	default:
+		return t, false, fmt.Errorf("unsupported time value of type %T", v)
+	}
+	return t, !t.IsZero(), nil
+}
+
+// dataMap builds the template data. Every standard contact field is present
+// so that missing values render as empty strings.
+func dataMap(d Data) map[string]interface{} {
+	contact := map[string]interface{}{
+		"id":         "",
+		"email":      "",
+		"first_name": "",
+		"last_name":  "",
+		"full_name":  "",
+		"lang":       model.Language_EN.String(),
+		"created_at": time.Time{},
+		"custom":     map[string]string{},
+	}
+	if c := d.Contact; c != nil {
+		contact["id"] = c.ID.String()
+		contact["email"] = c.Email
+		contact["first_name"] = c.FirstName
+		contact["last_name"] = c.LastName
+		contact["full_name"] = strings.TrimSpace(c.FirstName + " " + c.LastName)
+		contact["lang"] = c.Lang.String()
+		contact["created_at"] = c.CreatedAt
+		custom := make(map[string]string, len(c.CustomFields))
+		for k, v := range c.CustomFields {
+			custom[k] = v
+		}
+		contact["custom"] = custom
+	}
+	vars := make(map[string]string, len(d.Vars))
+	for k, v := range d.Vars {
+		vars[k] = v
+	}
+	return map[string]interface{}{
+		rootContact: contact,
+		rootVars:    vars,
+	}
+}
+
+// loopGuardFunc is called by the compiler at the start of every range
+// iteration, with the template data, which carries a *loopGuard under
+// loopGuardKey. Template identifiers cannot spell the key.
+const (
+	loopGuardFunc = "loop_guard"
+	loopGuardKey  = "\x00loop_guard"
+)
+
+// loopGuard stops loops once their render is cancelled or has iterated
+// maxIterations times. Without it, a loop that writes nothing would keep
+// running after Render gave up on it.
+type loopGuard struct {
+	ctx context.Context
+	n   atomic.Int64
+}
+
+func checkLoop(data map[string]interface{}) (string, error) {
+	g, _ := data[loopGuardKey].(*loopGuard)
+	if g == nil {
+		return "", nil
+	}
+	if err := g.ctx.Err(); err != nil {
+		return "", err
+	}
+	if g.n.Add(1) > maxIterations {
+		return "", ErrTooManyIterations
+	}
+	return "", nil
+}
@@ -0,0 +1,146 @@
+package render
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+var persianMonths = [...]string{
+	"فروردین", "اردیبهشت", "خرداد", "تیر", "مرداد", "شهریور",
+	"مهر", "آبان", "آذر", "دی", "بهمن", "اسفند",
+}
+
+// persianDigits replaces ASCII digits in s with Persian ones.
+func persianDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return '۰' + (r - '0')
+		}
+		return r
+	}, s)
+}
+
+// toJalali converts a Gregorian date to the Solar Hijri (Jalali) calendar
+// using the 33-year arithmetic cycle, which matches the official calendar
+// for 1178–1633 AP.
+func toJalali(t time.Time) (year, month, day int) {
+	gy, gm, gd := t.Year(), int(t.Month()), t.Day()
+	cumulative := [...]int{0, 31, 59, 90, 120, 151, 181, 212, 243, 273, 304, 334}
+	gy2 := gy
+	if gm > 2 {
+		gy2 = gy + 1
+	}
+	days := 355666 + 365*gy + (gy2+3)/4 - (gy2+99)/100 + (gy2+399)/400 + gd + cumulative[gm-1]
+	year = -1595 + 33*(days/12053)
+	days %= 12053
+	year += 4 * (days / 1461)
+	days %= 1461
+	if days > 365 {
+		year += (days - 1) / 365
+		days = (days - 1) % 365
+	}
+	if days < 186 {
+		month = 1 + days/31
+		day = 1 + days%31
+	} else {
+		month = 7 + (days-186)/30
+		day = 1 + (days-186)%30
+	}
+	return year, month, day
+}
+
+// formatJalali formats t as "short" (1403/01/01) or "long" (1 فروردین 1403).
+func formatJalali(layout string, t time.Time) (string, error) {
+	y, m, d := toJalali(t)
+	switch layout {
+	case "short":
+		return fmt.Sprintf("%04d/%02d/%02d", y, m, d), nil
+	case "long":
+		return fmt.Sprintf("%d %s %d", d, persianMonths[m-1], y), nil
+	default:
+		return "", fmt.Errorf("jalali: unknown layout %q, want short or long", layout)
+	}
+}
+
+// localeFuncs returns the helpers whose output depends on the template
+// language. In Persian templates numbers are written with Persian digits.
+func localeFuncs(lang model.Language) map[string]interface{} {
+	digits := func(s string) string { return s }
+	if lang == model.Language_FA {
+		digits = persianDigits
+	}
+	jalali := func(layout string, v interface{}) (string, error) {
+		t, ok, err := toTime(v)
+		if err != nil || !ok {
+			return "", err
+		}
+		s, err := formatJalali(layout, t)
+		return digits(s), err
+	}
+	return map[string]interface{}{
+		"persianDigits": func(v interface{}) string { return persianDigits(fmt.Sprint(v)) },
+		"digits":        func(v interface{}) string { return digits(fmt.Sprint(v)) },
+		"jalali":        jalali,
+		// localDate uses the calendar of the template language.
+		"localDate": func(layout string, v interface{}) (string, error) {
+			if lang == model.Language_FA {
+				return jalali(layout, v)
+			}
+			return formatDate(layout, v)
+		},
+	}
+}
+
+var (
+	htmlTagRE  = regexp.MustCompile(`(?i)<html\b[^>]*>`)
+	bodyOpenRE = regexp.MustCompile(`(?i)<body\b[^>]*>`)
+	bodyEndRE  = regexp.MustCompile(`(?i)</body\s*>`)
+	langAttrRE = regexp.MustCompile(`(?i)\slang\s*=`)
+	dirAttrRE  = regexp.MustCompile(`(?i)\sdir\s*=`)
+)
+
+const rtlWrapperOpen = `<div dir="rtl" style="direction:rtl;text-align:right;">`
+
+// applyDirection marks rendered HTML with its language and, for right to
+// left languages, wraps the body in a direction container. Many clients drop
+// attributes on <html> and <body>, so the wrapper is what actually lays the
+// message out.
+func applyDirection(html string, lang model.Language) string {
+	if html == "" {
+		return html
+	}
+	explicit := false
+	html = htmlTagRE.ReplaceAllStringFunc(html, func(tag string) string {
+		attrs := ""
+		if !langAttrRE.MatchString(tag) {
+			attrs += fmt.Sprintf(` lang="%s"`, lang)
+		}
+		if dirAttrRE.MatchString(tag) {
+			explicit = true
+		} else if lang.RTL() {
+			attrs += ` dir="rtl"`
+		}
+		return tag[:len(tag)-1] + attrs + ">"
+	})
+	// A direction chosen by the author wins.
+	if !lang.RTL() || explicit {
+		return html
+	}
+
+	open := bodyOpenRE.FindStringIndex(html)
+	end := bodyEndRE.FindStringIndex(html)
+	if open != nil && dirAttrRE.MatchString(html[open[0]:open[1]]) {
+		return html
+	}
+	if open == nil || end == nil || end[0] < open[1] {
+		if htmlTagRE.MatchString(html) {
+			return html
+		}
+		return rtlWrapperOpen + html + "</div>"
+	}
+	return html[:open[1]] + rtlWrapperOpen + html[open[1]:end[0]] + "</div>" + html[end[0]:]
+}
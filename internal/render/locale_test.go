@@ -0,0 +1,119 @@
+package render
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+func TestToJalali(t *testing.T) {
+	cases := []struct {
+		date    string
+		y, m, d int
+	}{
+		{"2024-03-20", 1403, 1, 1},
+		{"2023-03-21", 1402, 1, 1},
+		{"2024-12-21", 1403, 10, 1},
+		{"2025-03-20", 1403, 12, 30},
+		{"1979-02-11", 1357, 11, 22},
+	}
+	for _, c := range cases {
+		g, _ := time.Parse("2006-01-02", c.date)
+		y, m, d := toJalali(g)
+		assert.Equal(t, [3]int{c.y, c.m, c.d}, [3]int{y, m, d}, c.date)
+	}
+}
+
+func TestPersianDigits(t *testing.T) {
+	assert.Equal(t, "۱۴۰۳/۰۱/۰۱ abc", persianDigits("1403/01/01 abc"))
+}
+
+func TestApplyDirection(t *testing.T) {
+	assert.Equal(t,
+		`<div dir="rtl" style="direction:rtl;text-align:right;"><p>سلام</p></div>`,
+		applyDirection(`<p>سلام</p>`, model.Language_FA))
+	assert.Equal(t, `<p>Hi</p>`, applyDirection(`<p>Hi</p>`, model.Language_EN))
+	assert.Equal(t,
+		`<html lang="en" dir="ltr"><body>x</body></html>`,
+		applyDirection(`<html lang="en" dir="ltr"><body>x</body></html>`, model.Language_FA))
+}
+
+func TestRender_Golden(t *testing.T) {
+	html := func(name string) string {
+		b, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	set, err := CompileSet(model.LocalizedContent{
+		Lang: model.Language_EN,
+		TemplateContent: model.TemplateContent{
+			Subject:  `Welcome {{contact.first_name | default "friend"}}`,
+			HTMLBody: html("welcome.html"),
+			TextBody: `Joined {{contact.created_at | localDate "short"}}`,
+		},
+		Variants: model.TemplateVariants{
+			"fa": {
+				Subject:  `{{contact.first_name | default "دوست"}}، خوش آمدید`,
+				HTMLBody: html("welcome.fa.html"),
+				TextBody: `عضویت از {{contact.created_at | localDate "short"}}`,
+			},
+		},
+	}, Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, lang := range []model.Language{model.Language_EN, model.Language_FA} {
+		out, err := set.Render(context.Background(), Data{
+			Contact: &model.Contact{
+				FirstName:    "Sara",
+				Lang:         lang,
+				CustomFields: model.CustomFields{"credits": "1250"},
+				CreatedAt:    time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC),
+			},
+			Vars: map[string]string{"unsubscribe_url": "https://example.com/u?t=1&x=2"},
+		}, Limits{})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, lang, out.Lang)
+
+		got := fmt.Sprintf("Subject: %s\n\n%s\n--- text ---\n%s\n", out.Subject, out.HTML, out.Text)
+		golden := filepath.Join("testdata", "welcome."+lang.String()+".golden")
+		if *update {
+			if err := os.WriteFile(golden, []byte(got), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want, err := os.ReadFile(golden)
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.Equal(t, string(want), got, lang.String())
+	}
+}
+
+func TestSet_FallsBack(t *testing.T) {
+	set, err := CompileSet(model.LocalizedContent{
+		Lang:            model.Language_FA,
+		TemplateContent: model.TemplateContent{Subject: "سلام", TextBody: "x"},
+	}, Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := set.Render(context.Background(), Data{Contact: &model.Contact{Lang: model.Language_EN}}, Limits{})
+	assert.NoError(t, err)
+	assert.Equal(t, "سلام", out.Subject)
+	assert.Equal(t, model.Language_FA, out.Lang)
+}
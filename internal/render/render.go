@@ -0,0 +1,342 @@
+// Package render personalises email templates.
+//
+// Templates use Go template syntax with merge tags rooted at "contact" and
+// "vars", for example {{contact.first_name | default "friend"}} or
+// {{if eq contact.custom.plan "pro"}}…{{end}}. HTML bodies are rendered with
+// html/template so merged values are escaped for their context; subject,
+// preheader and text bodies use text/template.
+//
+// Rendered HTML is post-processed by package htmlmail: CSS is inlined and,
+// when the template has no text part, a text alternative is generated.
+//
+// Shared blocks are included with {{include "footer"}} and templates may
+// extend a layout; see Blocks.
+//
+// Templates are sandboxed: nested template definitions and ranges over
+// anything but fields and variables are rejected when compiling, and
+// execution is bounded by a timeout, an output size limit and a number of
+// loop iterations.
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/htmlmail"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+const (
+	DefaultTimeout        = 2 * time.Second
+	DefaultMaxOutputBytes = 1 << 20
+	// maxIterations bounds the loop iterations of one render.
+	maxIterations = 100000
+)
+
+var (
+	ErrTimeout        = errors.New("template execution timed out")
+	ErrOutputTooLarge = errors.New("template output exceeds size limit")
+	// ErrTooManyIterations is returned when loops iterate more than a
+	// render allows.
+	ErrTooManyIterations = errors.New("template loops iterate too often")
+)
+
+// Part identifies one templated field of an email.
+type Part string
+
+const (
+	PartSubject   Part = "subject"
+	PartPreheader Part = "preheader"
+	PartHTML      Part = "html_body"
+	PartText      Part = "text_body"
+)
+
+// Problem is a single compile-time finding.
+type Problem struct {
+	Part    Part
+	Message string
+}
+
+// CompileError lists every problem found in a template.
+type CompileError struct {
+	Problems []Problem
+}
+
+func (e *CompileError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = fmt.Sprintf("%s: %s", p.Part, p.Message)
+	}
+	return "invalid template: " + strings.Join(msgs, "; ")
+}
+
+// Options configures compilation.
+type Options struct {
+	// Lang is the language the content is written in. It selects the
+	// calendar and digits of the locale helpers and the text direction.
+	Lang model.Language
+	// CustomFields lists the custom contact fields known to the workspace.
+	// References to other custom fields are reported. Nil accepts any.
+	CustomFields []string
+	// Blocks resolves {{include}} and the layout. Nil means the workspace
+	// has none.
+	Blocks Blocks
+	// Layout names the layout the bodies are placed in, if any.
+	Layout string
+}
+
+// Limits bounds template execution. Zero values select the defaults.
+type Limits struct {
+	Timeout        time.Duration
+	MaxOutputBytes int
+}
+
+// Data is the input of a render.
+type Data struct {
+	Contact *model.Contact
+	// Vars are system values such as unsubscribe links, available as
+	// {{vars.name}}.
+	Vars map[string]string
+}
+
+// Output is a rendered email.
+type Output struct {
+	Lang      model.Language
+	Subject   string
+	Preheader string
+	HTML      string
+	Text      string
+	// CSSWarnings report CSS in the HTML that email clients do not support.
+	CSSWarnings []htmlmail.Warning
+}
+
+// Template is a compiled, concurrency-safe email template.
+type Template struct {
+	lang      model.Language
+	fields    []Field
+	subject   *template.Template
+	preheader *template.Template
+	html      *htmltemplate.Template
+	text      *template.Template
+	// generateText is set when the template has no text part, so the text
+	// alternative is derived from the HTML.
+	generateText bool
+}
+
+// Compile parses and validates every part of content, written in
+// opts.Lang.
+func Compile(content model.TemplateContent, opts Options) (*Template, error) {
+	c := &compiler{opts: opts}
+	if opts.CustomFields != nil {
+		c.custom = make(map[string]bool, len(opts.CustomFields))
+		for _, f := range opts.CustomFields {
+			c.custom[f] = true
+		}
+	}
+
+	// Text is generated from HTML when the template itself has none, even
+	// if its layout does.
+	generateText := strings.TrimSpace(content.TextBody) == ""
+	content = c.layout(content)
+	t := &Template{
+		lang:      opts.Lang,
+		subject:   c.text(PartSubject, c.expand(PartSubject, content.Subject)),
+		preheader: c.text(PartPreheader, c.expand(PartPreheader, content.Preheader)),
+		html:      c.html(PartHTML, c.expand(PartHTML, content.HTMLBody)),
+		text:      c.text(PartText, c.expand(PartText, content.TextBody)),
+
+		generateText: generateText,
+	}
+	if len(c.problems) > 0 {
+		return nil, &CompileError{Problems: c.problems}
+	}
+	for path, hasDefault := range c.fields {
+		t.fields = append(t.fields, Field{Path: path, HasDefault: hasDefault})
+	}
+	sortFields(t.fields)
+	return t, nil
+}
+
+// Field is a merge tag written to the output of a template, such as
+// "contact.first_name", "contact.custom.plan" or "vars.unsubscribe_url".
+type Field struct {
+	Path string
+	// HasDefault is set when every use supplies a default value.
+	HasDefault bool
+}
+
+// Fields lists the merge tags the template outputs, sorted by path.
+func (t *Template) Fields() []Field {
+	return t.fields
+}
+
+func sortFields(fields []Field) {
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+}
+
+// Validate reports the problems Compile would find.
+func Validate(content model.TemplateContent, opts Options) error {
+	_, err := Compile(content, opts)
+	return err
+}
+
+// Render executes every part of the template for data.
+func (t *Template) Render(ctx context.Context, data Data, limits Limits) (*Output, error) {
+	if limits.Timeout <= 0 {
+		limits.Timeout = DefaultTimeout
+	}
+	if limits.MaxOutputBytes <= 0 {
+		limits.MaxOutputBytes = DefaultMaxOutputBytes
+	}
+	ctx, cancel := context.WithTimeout(ctx, limits.Timeout)
+	defer cancel()
+
+	dot := dataMap(data)
+	dot[loopGuardKey] = &loopGuard{ctx: ctx}
+	// All parts share one output budget.
+	budget := limits.MaxOutputBytes
+	run := func(part Part, exec func(io.Writer, interface{}) error) (string, error) {
+		s, err := execute(ctx, budget, func(w io.Writer) error { return exec(w, dot) })
+		if err != nil {
+			return "", fmt.Errorf("render %s: %w", part, err)
+		}
+		budget -= len(s)
+		return s, nil
+	}
+
+	var (
+		out = Output{Lang: t.lang}
+		err error
+	)
+	if out.Subject, err = run(PartSubject, t.subject.Execute); err != nil {
+		return nil, err
+	}
+	if out.Preheader, err = run(PartPreheader, t.preheader.Execute); err != nil {
+		return nil, err
+	}
+	if out.HTML, err = run(PartHTML, t.html.Execute); err != nil {
+		return nil, err
+	}
+	if out.Text, err = run(PartText, t.text.Execute); err != nil {
+		return nil, err
+	}
+	if out.HTML != "" {
+		out.HTML = applyDirection(out.HTML, t.lang)
+		if out.HTML, out.CSSWarnings, err = htmlmail.InlineCSS(out.HTML); err != nil {
+			return nil, fmt.Errorf("render %s: inline CSS: %w", PartHTML, err)
+		}
+		if t.generateText {
+			out.Text = htmlmail.ToText(out.HTML)
+		}
+	}
+	// Header fields must be single-line.
+	out.Subject = singleLine(out.Subject)
+	out.Preheader = singleLine(out.Preheader)
+	return &out, nil
+}
+
+// execute runs exec on a goroutine so a runaway template cannot block the
+// caller past the deadline. The writer fails once the deadline passes or the
+// budget is spent, which stops execution at its next write, and the loop
+// guard stops loops that write nothing at their next iteration.
+func execute(ctx context.Context, budget int, exec func(io.Writer) error) (string, error) {
+	w := &limitedWriter{ctx: ctx, max: budget}
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("template panic: %v", r)
+			}
+		}()
+		done <- exec(w)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			switch {
+			case w.overflow:
+				return "", ErrOutputTooLarge
+			case ctx.Err() != nil:
+				return "", ErrTimeout
+			case errors.Is(err, ErrTooManyIterations):
+				return "", ErrTooManyIterations
+			}
+			return "", err
+		}
+		return w.buf.String(), nil
+	case <-ctx.Done():
+		return "", ErrTimeout
+	}
+}
+
+type limitedWriter struct {
+	ctx      context.Context
+	buf      bytes.Buffer
+	max      int
+	overflow bool
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	if w.buf.Len()+len(p) > w.max {
+		w.overflow = true
+		return 0, ErrOutputTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+func singleLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// Set is a template compiled for each of its language variants.
+type Set struct {
+	fallback model.Language
+	byLang   map[model.Language]*Template
+}
+
+// CompileSet compiles the fallback content and every variant. Problems are
+// reported per language.
+func CompileSet(content model.LocalizedContent, opts Options) (*Set, error) {
+	s := &Set{fallback: content.Lang, byLang: make(map[model.Language]*Template)}
+	for _, lang := range content.Languages() {
+		c, _ := content.ContentFor(lang)
+		opts.Lang = lang
+		opts.Layout = content.Layout
+		t, err := Compile(c, opts)
+		if err != nil {
+			return nil, fmt.Errorf("%s variant: %w", lang, err)
+		}
+		s.byLang[lang] = t
+	}
+	return s, nil
+}
+
+// For returns the template for a contact speaking lang, falling back to the
+// default language.
+func (s *Set) For(lang model.Language) *Template {
+	if t, ok := s.byLang[lang]; ok {
+		return t
+	}
+	return s.byLang[s.fallback]
+}
+
+// Render renders the variant matching the contact's language.
+func (s *Set) Render(ctx context.Context, data Data, limits Limits) (*Output, error) {
+	lang := s.fallback
+	if data.Contact != nil {
+		lang = data.Contact.Lang
+	}
+	return s.For(lang).Render(ctx, data, limits)
+}
@@ -0,0 +1,195 @@
+package render_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/stretchr/testify/assert"
+)
+
+func contact() *model.Contact {
+	return &model.Contact{
+		Email:        "sara@example.com",
+		FirstName:    "Sara",
+		LastName:     "Ahmadi",
+		Lang:         model.Language_FA,
+		CustomFields: model.CustomFields{"plan": "pro"},
+		CreatedAt:    time.Date(2024, 3, 20, 10, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestRender_MergeTags(t *testing.T) {
+	tpl, err := render.Compile(model.TemplateContent{
+		Subject:  `Hi {{contact.first_name | default "friend"}}`,
+		HTMLBody: `<p>{{contact.full_name}} &lt;{{contact.email}}&gt;</p>{{if eq contact.custom.plan "pro"}}<b>Pro</b>{{end}}`,
+		TextBody: `Joined {{contact.created_at | date "long"}}. {{vars.unsubscribe_url}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := tpl.Render(context.Background(), render.Data{
+		Contact: contact(),
+		Vars:    map[string]string{"unsubscribe_url": "https://x.test/u"},
+	}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Hi Sara", out.Subject)
+	assert.Equal(t, "<p>Sara Ahmadi &lt;sara@example.com&gt;</p><b>Pro</b>", out.HTML)
+	assert.Equal(t, "Joined March 20, 2024. https://x.test/u", out.Text)
+}
+
+func TestRender_DefaultsAndEscaping(t *testing.T) {
+	tpl, err := render.Compile(model.TemplateContent{
+		Subject:  "Hello\n{{contact.first_name | default \"friend\"}}",
+		HTMLBody: `<p>{{contact.first_name}}</p>{{if contact.custom | has "plan"}}x{{end}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	out, err := tpl.Render(context.Background(), render.Data{
+		Contact: &model.Contact{FirstName: "<script>"},
+	}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Hello <script>", out.Subject)
+	assert.Equal(t, "<p>&lt;script&gt;</p>", out.HTML)
+
+	out, err = tpl.Render(context.Background(), render.Data{}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Hello friend", out.Subject)
+}
+
+func TestCompile_ReportsProblems(t *testing.T) {
+	err := render.Validate(model.TemplateContent{
+		Subject:  `{{contact.nickname}}`,
+		HTMLBody: `{{contact.custom.tier}} {{range 1000000000}}{{end}}`,
+		TextBody: `{{define "x"}}{{template "x"}}{{end}}{{.account}}`,
+	}, render.Options{CustomFields: []string{"plan"}})
+
+	var cerr *render.CompileError
+	if !assert.True(t, errors.As(err, &cerr)) {
+		return
+	}
+	msgs := make([]string, len(cerr.Problems))
+	for i, p := range cerr.Problems {
+		msgs[i] = string(p.Part) + ": " + p.Message
+	}
+	assert.Equal(t, []string{
+		"subject: line 1: unknown field contact.nickname",
+		"html_body: line 1: unknown custom field contact.custom.tier",
+		"html_body: line 1: range over a number is not allowed",
+		"text_body: nested template definitions are not allowed",
+		"text_body: line 1: unknown field account",
+	}, msgs)
+}
+
+func TestCompile_SyntaxError(t *testing.T) {
+	err := render.Validate(model.TemplateContent{Subject: `{{contact.first_name`}, render.Options{})
+	assert.Error(t, err)
+
+	err = render.Validate(model.TemplateContent{Subject: `{{exec "rm"}}`}, render.Options{})
+	assert.Error(t, err)
+}
+
+func TestRender_Limits(t *testing.T) {
+	tpl, err := render.Compile(model.TemplateContent{
+		TextBody: `{{range $i, $c := contact.custom}}{{$c}}{{end}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	c := contact()
+	c.CustomFields = model.CustomFields{"a": "0123456789", "b": "0123456789"}
+	_, err = tpl.Render(context.Background(), render.Data{Contact: c}, render.Limits{MaxOutputBytes: 15})
+	assert.ErrorIs(t, err, render.ErrOutputTooLarge)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tpl.Render(ctx, render.Data{Contact: c}, render.Limits{})
+	assert.ErrorIs(t, err, render.ErrTimeout)
+}
+
+func TestRender_ComputedRanges(t *testing.T) {
+	err := render.Validate(model.TemplateContent{
+		TextBody: `{{range len "xxxxxxxx"}}{{end}}{{$ = 1}}`,
+	}, render.Options{})
+	var cerr *render.CompileError
+	if assert.True(t, errors.As(err, &cerr)) && assert.Len(t, cerr.Problems, 2) {
+		assert.Equal(t, "line 1: range is only allowed over fields and variables", cerr.Problems[0].Message)
+		assert.Equal(t, "line 1: assigning to $ is not allowed", cerr.Problems[1].Message)
+	}
+
+	// Ranging over a variable holding a number is still a loop that writes
+	// nothing; the loop guard stops it instead of the writer.
+	tpl, err := render.Compile(model.TemplateContent{
+		TextBody: `{{$n := len "` + strings.Repeat("x", 1000) + `"}}{{range $n}}{{range $n}}{{range $n}}{{end}}{{end}}{{end}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = tpl.Render(context.Background(), render.Data{Contact: contact()}, render.Limits{Timeout: time.Minute})
+	assert.ErrorIs(t, err, render.ErrTooManyIterations)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = tpl.Render(ctx, render.Data{Contact: contact()}, render.Limits{})
+	assert.ErrorIs(t, err, render.ErrTimeout)
+
+	tpl, err = render.Compile(model.TemplateContent{
+		TextBody: `{{$n := len "xxx"}}{{range $i := $n}}{{range $n}}.{{end}}{{end}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := tpl.Render(context.Background(), render.Data{Contact: contact()}, render.Limits{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, ".........", strings.TrimSpace(out.Text))
+	}
+}
+
+func TestTemplate_Fields(t *testing.T) {
+	tpl, err := render.Compile(model.TemplateContent{
+		Subject:  `{{contact.first_name | default "friend"}}`,
+		HTMLBody: `{{contact.first_name}} {{if contact.custom.vip}}VIP{{end}}<a href="{{vars.unsubscribe_url}}">x</a>`,
+		TextBody: `{{contact.custom.plan | default "free"}}`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []render.Field{
+		{Path: "contact.custom.plan", HasDefault: true},
+		{Path: "contact.first_name", HasDefault: false},
+		{Path: "vars.unsubscribe_url", HasDefault: false},
+	}, tpl.Fields())
+}
+
+func TestRender_PostProcessing(t *testing.T) {
+	tpl, err := render.Compile(model.TemplateContent{
+		HTMLBody: `<style>p { color: #333 } .x { position: fixed }</style>` +
+			`<h1>Hi {{contact.first_name}}</h1><p>Read <a href="https://example.com">more</a></p>`,
+	}, render.Options{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	out, err := tpl.Render(context.Background(), render.Data{Contact: contact()}, render.Limits{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, `<h1>Hi Sara</h1><p style="color: #333">Read <a href="https://example.com">more</a></p>`, out.HTML)
+	assert.Equal(t, "HI SARA\n=======\n\nRead more [1]\n\n[1] https://example.com\n", out.Text)
+	if assert.Len(t, out.CSSWarnings, 1) {
+		assert.Equal(t, "position", out.CSSWarnings[0].Property)
+	}
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const assetColumns = `id, workspace_id, filename, content_type, size, width, height, sha256, storage_key, created_at`
+
+// AssetRepository stores the metadata of uploaded assets; their content
+// lives in a blobstore.Store.
+type AssetRepository interface {
+	// Create inserts a, or returns the workspace's existing asset with the
+	// same content.
+	Create(ctx context.Context, a *model.Asset) (*model.Asset, error)
+	// Get returns (nil, nil) if the asset does not exist.
+	Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error)
+	List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Asset, error)
+	// Delete returns the deleted asset, or (nil, nil) if it does not exist.
+	Delete(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error)
+}
+
+type assetRepository struct {
+	db *sqlx.DB
+}
+
+// NewAssetRepository constructs a new AssetRepository backed by a sqlx.DB.
+func NewAssetRepository(db *sqlx.DB) AssetRepository {
+	return &assetRepository{db: db}
+}
+
+func (r *assetRepository) Create(ctx context.Context, a *model.Asset) (*model.Asset, error) {
+	var out model.Asset
+	// The no-op update makes RETURNING yield the existing row on conflict.
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO assets (`+assetColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (workspace_id, sha256) DO UPDATE SET sha256 = EXCLUDED.sha256
+		RETURNING `+assetColumns,
+		a.ID, a.WorkspaceID, a.Filename, a.ContentType, a.Size, a.Width, a.Height, a.SHA256, a.StorageKey, a.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting asset: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *assetRepository) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error) {
+	var out model.Asset
+	err := r.db.GetContext(ctx, &out, `
+		SELECT `+assetColumns+`
+		FROM assets
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting asset: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *assetRepository) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Asset, error) {
+	var out []*model.Asset
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+assetColumns+`
+		FROM assets
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`, workspaceID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting assets: %w", err)
+	}
+	return out, nil
+}
+
+func (r *assetRepository) Delete(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error) {
+	var out model.Asset
+	err := r.db.GetContext(ctx, &out, `
+		DELETE FROM assets
+		WHERE workspace_id = $1 AND id = $2
+		RETURNING `+assetColumns,
+		workspaceID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error deleting asset: %w", err)
+	}
+	return &out, nil
+}
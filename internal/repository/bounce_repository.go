@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// BounceRepository stores the bounces of campaign emails.
+type BounceRepository interface {
+	// Add inserts b, filling in its ID and CreatedAt. It returns false if
+	// the job already bounced with the same kind.
+	Add(ctx context.Context, b *model.Bounce) (bool, error)
+	// CountSince counts the bounces of the given kinds of email since
+	// since, one per send job.
+	CountSince(ctx context.Context, workspaceID uuid.UUID, email string, kinds []model.BounceKind, since time.Time) (int, error)
+}
+
+type bounceRepository struct {
+	db *sqlx.DB
+}
+
+// NewBounceRepository constructs a new BounceRepository backed by a sqlx.DB.
+func NewBounceRepository(db *sqlx.DB) BounceRepository {
+	return &bounceRepository{db: db}
+}
+
+func (r *bounceRepository) Add(ctx context.Context, b *model.Bounce) (bool, error) {
+	b.ID = uuid.New()
+	b.CreatedAt = time.Now().UTC()
+	query := `
+		INSERT INTO bounces (
+			id, workspace_id, campaign_id, contact_id, send_job_id, email, kind, status, diagnostic, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (send_job_id, kind) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query,
+		b.ID, b.WorkspaceID, b.CampaignID, b.ContactID, b.SendJobID, b.Email, b.Kind, b.Status, b.Diagnostic, b.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("error inserting bounce: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *bounceRepository) CountSince(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	email string,
+	kinds []model.BounceKind,
+	since time.Time,
+) (int, error) {
+	names := make([]string, len(kinds))
+	for i, k := range kinds {
+		names[i] = string(k)
+	}
+	var n int
+	query := `
+		SELECT COUNT(DISTINCT send_job_id)
+		FROM bounces
+		WHERE workspace_id = $1 AND email = $2 AND kind = ANY($3) AND created_at >= $4
+	`
+	if err := r.db.GetContext(ctx, &n, query, workspaceID, email, pq.Array(names), since); err != nil {
+		return 0, fmt.Errorf("error counting bounces: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const campaignColumns = `id, workspace_id, name, template_id, template_version, audience, from_name, from_email, reply_to, status, scheduled_at, started_at, finished_at, created_at, updated_at`
+
+// CampaignRepository stores campaigns. Status changes are compare-and-set so
+// API calls and the scheduler cannot overwrite each other's transitions.
+type CampaignRepository interface {
+	Create(ctx context.Context, c *model.Campaign) (*model.Campaign, error)
+	// Update replaces the name, template, audience and sender of c if its
+	// status is one of allowed. Returns (nil, nil) otherwise.
+	Update(ctx context.Context, c *model.Campaign, allowed []model.CampaignStatus) (*model.Campaign, error)
+	// Get returns (nil, nil) if the campaign does not exist.
+	Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Campaign, error)
+	// List returns campaigns in any of statuses, or in any status when it
+	// is empty.
+	List(ctx context.Context, workspaceID uuid.UUID, statuses []model.CampaignStatus, limit, offset int) ([]*model.Campaign, error)
+	// Transition moves the campaign to status to if its status is one of
+	// from, and returns it. A non-nil scheduledAt replaces the send time.
+	// Returns (nil, nil) if the campaign does not exist or is in another
+	// state.
+	Transition(ctx context.Context, workspaceID, id uuid.UUID, from []model.CampaignStatus, to model.CampaignStatus, scheduledAt *time.Time) (*model.Campaign, error)
+	// PauseFromDomain pauses the scheduled and sending campaigns of the
+	// workspace whose sender address is at domain, and returns them.
+	PauseFromDomain(ctx context.Context, workspaceID uuid.UUID, domain string) ([]*model.Campaign, error)
+}
+
+type campaignRepository struct {
+	db *sqlx.DB
+}
+
+// NewCampaignRepository constructs a new CampaignRepository backed by a sqlx.DB.
+func NewCampaignRepository(db *sqlx.DB) CampaignRepository {
+	return &campaignRepository{db: db}
+}
+
+func (r *campaignRepository) Create(ctx context.Context, c *model.Campaign) (*model.Campaign, error) {
+	var out model.Campaign
+	now := time.Now().UTC()
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO campaigns (id, workspace_id, name, template_id, template_version, audience, from_name, from_email, reply_to, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $11)
+		RETURNING `+campaignColumns,
+		uuid.New(), c.WorkspaceID, c.Name, c.TemplateID, c.TemplateVersion, c.Audience,
+		c.FromName, c.FromEmail, c.ReplyTo, model.CampaignStatus_Draft, now)
+	if err != nil {
+		return nil, fmt.Errorf("error inserting campaign: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *campaignRepository) Update(ctx context.Context, c *model.Campaign, allowed []model.CampaignStatus) (*model.Campaign, error) {
+	var out model.Campaign
+	err := r.db.GetContext(ctx, &out, `
+		UPDATE campaigns
+		SET name = $3, template_id = $4, template_version = $5, audience = $6,
+		    from_name = $7, from_email = $8, reply_to = $9, updated_at = $10
+		WHERE workspace_id = $1 AND id = $2 AND status = ANY($11)
+		RETURNING `+campaignColumns,
+		c.WorkspaceID, c.ID, c.Name, c.TemplateID, c.TemplateVersion, c.Audience,
+		c.FromName, c.FromEmail, c.ReplyTo, time.Now().UTC(), pq.Array(statusStrings(allowed)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating campaign: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *campaignRepository) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Campaign, error) {
+	var out model.Campaign
+	err := r.db.GetContext(ctx, &out, `
+		SELECT `+campaignColumns+`
+		FROM campaigns
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting campaign: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *campaignRepository) List(ctx context.Context, workspaceID uuid.UUID, statuses []model.CampaignStatus, limit, offset int) ([]*model.Campaign, error) {
+	var out []*model.Campaign
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+campaignColumns+`
+		FROM campaigns
+		WHERE workspace_id = $1 AND (cardinality($2::text[]) = 0 OR status = ANY($2))
+		ORDER BY created_at DESC, id
+		LIMIT $3 OFFSET $4
+	`, workspaceID, pq.Array(statusStrings(statuses)), limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting campaigns: %w", err)
+	}
+	return out, nil
+}
+
+func (r *campaignRepository) Transition(
+	ctx context.Context,
+	workspaceID, id uuid.UUID,
+	from []model.CampaignStatus,
+	to model.CampaignStatus,
+	scheduledAt *time.Time,
+) (*model.Campaign, error) {
+	var out model.Campaign
+	err := r.db.GetContext(ctx, &out, `
+		UPDATE campaigns
+		SET status = $3,
+		    scheduled_at = COALESCE($4, scheduled_at),
+		    started_at = CASE WHEN $3 = 'sending' THEN COALESCE(started_at, $5) ELSE started_at END,
+		    finished_at = CASE WHEN $3 IN ('sent', 'cancelled') THEN $5 ELSE finished_at END,
+		    updated_at = $5
+		WHERE workspace_id = $1 AND id = $2 AND status = ANY($6)
+		RETURNING `+campaignColumns,
+		workspaceID, id, to, scheduledAt, time.Now().UTC(), pq.Array(statusStrings(from)))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating campaign status: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *campaignRepository) PauseFromDomain(ctx context.Context, workspaceID uuid.UUID, domain string) ([]*model.Campaign, error) {
+	var out []*model.Campaign
+	err := r.db.SelectContext(ctx, &out, `
+		UPDATE campaigns
+		SET status = 'paused', updated_at = $3
+		WHERE workspace_id = $1
+		  AND status IN ('scheduled', 'sending')
+		  AND lower(substring(from_email FROM '@([^@]*)$')) = $2
+		RETURNING `+campaignColumns,
+		workspaceID, domain, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error pausing campaigns: %w", err)
+	}
+	return out, nil
+}
+
+func statusStrings(statuses []model.CampaignStatus) []string {
+	out := make([]string, len(statuses))
+	for i, s := range statuses {
+		out[i] = string(s)
+	}
+	return out
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ConsentRepository stores the append-only consent history of contacts.
+type ConsentRepository interface {
+	Record(ctx context.Context, rec *model.ConsentRecord) error
+	ListByContact(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ConsentRecord, error)
+}
+
+type consentRepository struct {
+	db *sqlx.DB
+}
+
+// NewConsentRepository constructs a new ConsentRepository backed by a sqlx.DB.
+func NewConsentRepository(db *sqlx.DB) ConsentRepository {
+	return &consentRepository{db: db}
+}
+
+// Record inserts rec, filling in its ID and CreatedAt.
+func (r *consentRepository) Record(ctx context.Context, rec *model.ConsentRecord) error {
+	rec.ID = uuid.New()
+	rec.CreatedAt = time.Now().UTC()
+	query := `
+		INSERT INTO consent_records (
+			id, workspace_id, contact_id, list_id, action, ip, user_agent, source, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		rec.ID, rec.WorkspaceID, rec.ContactID, rec.ListID, rec.Action,
+		rec.IP, rec.UserAgent, rec.Source, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting consent record: %w", err)
+	}
+	return nil
+}
+
+func (r *consentRepository) ListByContact(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ConsentRecord, error) {
+	var out []*model.ConsentRecord
+	query := `
+		SELECT id, workspace_id, contact_id, list_id, action, ip, user_agent, source, created_at
+		FROM consent_records
+		WHERE workspace_id = $1 AND contact_id = $2
+		ORDER BY created_at, id
+	`
+	if err := r.db.SelectContext(ctx, &out, query, workspaceID, contactID); err != nil {
+		return nil, fmt.Errorf("error selecting consent records: %w", err)
+	}
+	return out, nil
+}
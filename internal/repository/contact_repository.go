@@ -0,0 +1,319 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const contactColumns = `c.id, c.workspace_id, c.email, c.first_name, c.last_name, c.lang, c.status, c.custom_fields, c.paused_until, c.created_at, c.updated_at`
+
+// ContactRepository defines read access to contacts, lists and segments.
+// Every method is scoped to a workspace.
+type ContactRepository interface {
+	GetList(ctx context.Context, workspaceID, listID uuid.UUID) (*model.List, error)
+	GetSegment(ctx context.Context, workspaceID, segmentID uuid.UUID) (*model.Segment, error)
+	// IterateList calls fn for every contact that is a member of the list.
+	IterateList(ctx context.Context, workspaceID, listID uuid.UUID, fn func(*model.Contact) error) error
+	// IterateSegment calls fn for every contact matching the segment filter.
+	IterateSegment(ctx context.Context, workspaceID uuid.UUID, filter model.SegmentFilter, fn func(*model.Contact) error) error
+	GetContact(ctx context.Context, workspaceID, contactID uuid.UUID) (*model.Contact, error)
+
+	// GetListByID fetches a list without workspace scoping. It is only for
+	// public entry points such as subscription forms, where the list ID
+	// determines the workspace.
+	GetListByID(ctx context.Context, listID uuid.UUID) (*model.List, error)
+	// CreatePending inserts a pending contact, or returns the existing contact
+	// with the same email unchanged.
+	CreatePending(ctx context.Context, c *model.Contact) (*model.Contact, error)
+	// AddPendingMembership adds the contact to the list awaiting confirmation
+	// and returns the resulting status. Confirmed memberships are kept.
+	AddPendingMembership(ctx context.Context, listID, contactID uuid.UUID) (model.SubscriptionStatus, error)
+	// ConfirmSubscription activates the contact and its pending list
+	// membership. It reports false, changing nothing, if the membership is
+	// not pending, for example because the contact unsubscribed since.
+	ConfirmSubscription(ctx context.Context, workspaceID, contactID, listID uuid.UUID) (bool, error)
+	// SetStatus sets the status of a contact whose status is one of from.
+	// It returns false if the contact does not exist or is in another
+	// status.
+	SetStatus(ctx context.Context, workspaceID, contactID uuid.UUID, from []model.ContactStatus, to model.ContactStatus) (bool, error)
+	// ListSubscriptions returns the list memberships of a contact, ordered
+	// by list name.
+	ListSubscriptions(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ListSubscription, error)
+	// SetLang sets the language of a contact. It returns false if the
+	// contact does not exist.
+	SetLang(ctx context.Context, workspaceID, contactID uuid.UUID, lang model.Language) (bool, error)
+	// SetPausedUntil pauses campaign emails to a contact until the given
+	// time, or resumes them if until is nil. It returns false if the
+	// contact does not exist.
+	SetPausedUntil(ctx context.Context, workspaceID, contactID uuid.UUID, until *time.Time) (bool, error)
+}
+
+type contactRepository struct {
+	db *sqlx.DB
+}
+
+// NewContactRepository constructs a new ContactRepository backed by a sqlx.DB.
+func NewContactRepository(db *sqlx.DB) ContactRepository {
+	return &contactRepository{db: db}
+}
+
+// GetList fetches a list by ID. Returns (nil, nil) if not found.
+func (r *contactRepository) GetList(ctx context.Context, workspaceID, listID uuid.UUID) (*model.List, error) {
+	var l model.List
+	query := `
+		SELECT id, workspace_id, name, created_at
+		FROM lists
+		WHERE workspace_id = $1 AND id = $2
+	`
+	err := r.db.GetContext(ctx, &l, query, workspaceID, listID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting list: %w", err)
+	}
+	return &l, nil
+}
+
+// GetSegment fetches a segment by ID. Returns (nil, nil) if not found.
+func (r *contactRepository) GetSegment(ctx context.Context, workspaceID, segmentID uuid.UUID) (*model.Segment, error) {
+	var s model.Segment
+	query := `
+		SELECT id, workspace_id, name, filter, created_at
+		FROM segments
+		WHERE workspace_id = $1 AND id = $2
+	`
+	err := r.db.GetContext(ctx, &s, query, workspaceID, segmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting segment: %w", err)
+	}
+	return &s, nil
+}
+
+// GetContact fetches a contact by ID. Returns (nil, nil) if not found.
+func (r *contactRepository) GetContact(ctx context.Context, workspaceID, contactID uuid.UUID) (*model.Contact, error) {
+	var c model.Contact
+	query := `
+		SELECT ` + contactColumns + `
+		FROM contacts c
+		WHERE c.workspace_id = $1 AND c.id = $2
+	`
+	err := r.db.GetContext(ctx, &c, query, workspaceID, contactID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting contact: %w", err)
+	}
+	return &c, nil
+}
+
+// GetListByID fetches a list by ID in any workspace. Returns (nil, nil) if not found.
+func (r *contactRepository) GetListByID(ctx context.Context, listID uuid.UUID) (*model.List, error) {
+	var l model.List
+	err := r.db.GetContext(ctx, &l, `SELECT id, workspace_id, name, created_at FROM lists WHERE id = $1`, listID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting list: %w", err)
+	}
+	return &l, nil
+}
+
+func (r *contactRepository) CreatePending(ctx context.Context, c *model.Contact) (*model.Contact, error) {
+	// The no-op update makes RETURNING yield the existing row on conflict.
+	query := `
+		INSERT INTO contacts AS c (
+			id, workspace_id, email, first_name, last_name, lang, status, custom_fields, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $9)
+		ON CONFLICT (workspace_id, email) DO UPDATE SET updated_at = c.updated_at
+		RETURNING ` + contactColumns + `
+	`
+	var out model.Contact
+	err := r.db.GetContext(ctx, &out, query,
+		uuid.New(), c.WorkspaceID, c.Email, c.FirstName, c.LastName, int32(c.Lang),
+		model.ContactStatus_Pending, c.CustomFields, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting contact: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *contactRepository) AddPendingMembership(ctx context.Context, listID, contactID uuid.UUID) (model.SubscriptionStatus, error) {
+	query := `
+		INSERT INTO list_members AS m (list_id, contact_id, status, created_at)
+		VALUES ($1, $2, 'pending', NOW())
+		ON CONFLICT (list_id, contact_id) DO UPDATE
+		SET status = CASE WHEN m.status = 'subscribed' THEN m.status ELSE 'pending' END
+		RETURNING status
+	`
+	var st model.SubscriptionStatus
+	if err := r.db.GetContext(ctx, &st, query, listID, contactID); err != nil {
+		return "", fmt.Errorf("error inserting list membership: %w", err)
+	}
+	return st, nil
+}
+
+func (r *contactRepository) ConfirmSubscription(ctx context.Context, workspaceID, contactID, listID uuid.UUID) (bool, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `
+		UPDATE list_members
+		SET status = 'subscribed', unsubscribed_at = NULL
+		WHERE list_id = $1 AND contact_id = $2 AND status = 'pending'
+	`, listID, contactID)
+	if err != nil {
+		return false, fmt.Errorf("error confirming list membership: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	// Bounced addresses stay bounced: confirming does not make them deliverable.
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contacts
+		SET status = 'active', updated_at = NOW()
+		WHERE workspace_id = $1 AND id = $2 AND status IN ('pending', 'unsubscribed')
+	`, workspaceID, contactID)
+	if err != nil {
+		return false, fmt.Errorf("error activating contact: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("error committing confirmation: %w", err)
+	}
+	return true, nil
+}
+
+func (r *contactRepository) SetStatus(
+	ctx context.Context,
+	workspaceID, contactID uuid.UUID,
+	from []model.ContactStatus,
+	to model.ContactStatus,
+) (bool, error) {
+	names := make([]string, len(from))
+	for i, st := range from {
+		names[i] = string(st)
+	}
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE contacts
+		SET status = $4, updated_at = NOW()
+		WHERE workspace_id = $1 AND id = $2 AND status = ANY($3)
+	`, workspaceID, contactID, pq.Array(names), to)
+	if err != nil {
+		return false, fmt.Errorf("error updating contact status: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *contactRepository) ListSubscriptions(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ListSubscription, error) {
+	query := `
+		SELECT m.list_id, l.name, m.status
+		FROM list_members m
+		JOIN lists l ON l.id = m.list_id
+		WHERE l.workspace_id = $1 AND m.contact_id = $2
+		ORDER BY l.name, l.id
+	`
+	var out []*model.ListSubscription
+	if err := r.db.SelectContext(ctx, &out, query, workspaceID, contactID); err != nil {
+		return nil, fmt.Errorf("error selecting list memberships: %w", err)
+	}
+	return out, nil
+}
+
+func (r *contactRepository) SetLang(ctx context.Context, workspaceID, contactID uuid.UUID, lang model.Language) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE contacts
+		SET lang = $3, updated_at = NOW()
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, contactID, int32(lang))
+	if err != nil {
+		return false, fmt.Errorf("error updating contact language: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *contactRepository) SetPausedUntil(ctx context.Context, workspaceID, contactID uuid.UUID, until *time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE contacts
+		SET paused_until = $3, updated_at = NOW()
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, contactID, until)
+	if err != nil {
+		return false, fmt.Errorf("error updating contact pause: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *contactRepository) IterateList(
+	ctx context.Context,
+	workspaceID, listID uuid.UUID,
+	fn func(*model.Contact) error,
+) error {
+	query := `
+		SELECT ` + contactColumns + `
+		FROM contacts c
+		JOIN list_members m ON m.contact_id = c.id
+		WHERE c.workspace_id = $1 AND m.list_id = $2
+		ORDER BY c.created_at, c.id
+	`
+	return r.iterate(ctx, fn, query, workspaceID, listID)
+}
+
+func (r *contactRepository) IterateSegment(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	filter model.SegmentFilter,
+	fn func(*model.Contact) error,
+) error {
+	where, args, err := buildSegmentWhere(filter, 1)
+	if err != nil {
+		return err
+	}
+	query := `
+		SELECT ` + contactColumns + `
+		FROM contacts c
+		WHERE c.workspace_id = $1 AND ` + where + `
+		ORDER BY c.created_at, c.id
+	`
+	return r.iterate(ctx, fn, query, append([]interface{}{workspaceID}, args...)...)
+}
+
+// iterate streams rows one at a time so large audiences are never held in memory.
+func (r *contactRepository) iterate(ctx context.Context, fn func(*model.Contact) error, query string, args ...interface{}) error {
+	rows, err := r.db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error querying contacts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c model.Contact
+		if err := rows.StructScan(&c); err != nil {
+			return fmt.Errorf("error scanning contact: %w", err)
+		}
+		if err := fn(&c); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating contacts: %w", err)
+	}
+	return nil
+}
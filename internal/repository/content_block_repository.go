@@ -0,0 +1,191 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrBlockExists is returned when a content block name is already taken.
+var ErrBlockExists = errors.New("content block already exists")
+
+const contentBlockColumns = `id, workspace_id, name, kind, lang, html_body, text_body, variants, created_at, updated_at`
+
+// BlockDependents is everything that uses a content block.
+type BlockDependents struct {
+	// Blocks lists the blocks including it, directly or indirectly.
+	Blocks []string
+	// Templates lists the templates whose current version uses it or one
+	// of Blocks, with CurrentVersion set.
+	Templates []*model.Template
+	// Campaigns lists the unfinished campaigns whose template version uses
+	// it or one of Blocks. Blocks are resolved when a campaign is sent, so
+	// they pick up the change.
+	Campaigns []*model.Campaign
+}
+
+// ContentBlockRepository stores the shared content blocks and layouts of
+// workspaces. refs are the names of the blocks a block includes.
+type ContentBlockRepository interface {
+	// Create returns ErrBlockExists if the name is taken.
+	Create(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error)
+	// Update replaces the content of the block named b.Name. Returns
+	// (nil, nil) if it does not exist.
+	Update(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error)
+	// Get returns (nil, nil) if the block does not exist.
+	Get(ctx context.Context, workspaceID uuid.UUID, name string) (*model.ContentBlock, error)
+	List(ctx context.Context, workspaceID uuid.UUID) ([]*model.ContentBlock, error)
+	// Delete returns false if the block does not exist.
+	Delete(ctx context.Context, workspaceID uuid.UUID, name string) (bool, error)
+	Dependents(ctx context.Context, workspaceID uuid.UUID, name string) (*BlockDependents, error)
+}
+
+type contentBlockRepository struct {
+	db *sqlx.DB
+}
+
+// NewContentBlockRepository constructs a new ContentBlockRepository backed by a sqlx.DB.
+func NewContentBlockRepository(db *sqlx.DB) ContentBlockRepository {
+	return &contentBlockRepository{db: db}
+}
+
+func (r *contentBlockRepository) Create(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error) {
+	var out model.ContentBlock
+	now := time.Now().UTC()
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO content_blocks (id, workspace_id, name, kind, lang, html_body, text_body, variants, block_refs, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, COALESCE($9::text[], '{}'), $10, $10)
+		ON CONFLICT (workspace_id, name) DO NOTHING
+		RETURNING `+contentBlockColumns,
+		uuid.New(), b.WorkspaceID, b.Name, b.Kind, b.Lang, b.HTMLBody, b.TextBody, b.Variants, pq.Array(refs), now)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrBlockExists
+		}
+		return nil, fmt.Errorf("error inserting content block: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *contentBlockRepository) Update(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error) {
+	var out model.ContentBlock
+	err := r.db.GetContext(ctx, &out, `
+		UPDATE content_blocks
+		SET lang = $3, html_body = $4, text_body = $5, variants = $6,
+		    block_refs = COALESCE($7::text[], '{}'), updated_at = $8
+		WHERE workspace_id = $1 AND name = $2
+		RETURNING `+contentBlockColumns,
+		b.WorkspaceID, b.Name, b.Lang, b.HTMLBody, b.TextBody, b.Variants, pq.Array(refs), time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating content block: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *contentBlockRepository) Get(ctx context.Context, workspaceID uuid.UUID, name string) (*model.ContentBlock, error) {
+	var out model.ContentBlock
+	err := r.db.GetContext(ctx, &out, `
+		SELECT `+contentBlockColumns+`
+		FROM content_blocks
+		WHERE workspace_id = $1 AND name = $2
+	`, workspaceID, name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting content block: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *contentBlockRepository) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.ContentBlock, error) {
+	var out []*model.ContentBlock
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+contentBlockColumns+`
+		FROM content_blocks
+		WHERE workspace_id = $1
+		ORDER BY name
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting content blocks: %w", err)
+	}
+	return out, nil
+}
+
+func (r *contentBlockRepository) Delete(ctx context.Context, workspaceID uuid.UUID, name string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM content_blocks WHERE workspace_id = $1 AND name = $2
+	`, workspaceID, name)
+	if err != nil {
+		return false, fmt.Errorf("error deleting content block: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error deleting content block: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *contentBlockRepository) Dependents(ctx context.Context, workspaceID uuid.UUID, name string) (*BlockDependents, error) {
+	tx, err := r.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true, Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// UNION rather than UNION ALL stops the walk at cycles.
+	var blocks []string
+	err = tx.SelectContext(ctx, &blocks, `
+		WITH RECURSIVE deps(name) AS (
+			SELECT $2::text
+			UNION
+			SELECT b.name
+			FROM content_blocks b
+			JOIN deps d ON d.name = ANY(b.block_refs)
+			WHERE b.workspace_id = $1
+		)
+		SELECT name FROM deps WHERE name <> $2 ORDER BY name
+	`, workspaceID, name)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting dependent blocks: %w", err)
+	}
+
+	names := pq.Array(append([]string{name}, blocks...))
+	var templates []*model.Template
+	err = tx.SelectContext(ctx, &templates, `
+		SELECT t.id, t.workspace_id, t.name, t.current_version, t.created_at, t.updated_at
+		FROM templates t
+		JOIN template_versions v ON v.template_id = t.id AND v.version = t.current_version
+		WHERE t.workspace_id = $1 AND v.block_refs && $2::text[]
+		ORDER BY t.name, t.id
+	`, workspaceID, names)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting dependent templates: %w", err)
+	}
+
+	var campaigns []*model.Campaign
+	err = tx.SelectContext(ctx, &campaigns, `
+		SELECT c.id, c.workspace_id, c.name, c.template_id, c.template_version, c.audience,
+		       c.from_name, c.from_email, c.reply_to, c.status, c.scheduled_at, c.started_at,
+		       c.finished_at, c.created_at, c.updated_at
+		FROM campaigns c
+		JOIN template_versions v ON v.template_id = c.template_id AND v.version = c.template_version
+		WHERE c.workspace_id = $1 AND v.block_refs && $2::text[]
+		  AND c.status IN ('draft', 'scheduled', 'sending', 'paused')
+		ORDER BY c.scheduled_at NULLS LAST, c.name, c.id
+	`, workspaceID, names)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting dependent campaigns: %w", err)
+	}
+	return &BlockDependents{Blocks: blocks, Templates: templates, Campaigns: campaigns}, nil
+}
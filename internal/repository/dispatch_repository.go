@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// DispatchRepository leases due campaigns to a scheduler and expands their
+// audiences into send jobs.
+//
+// A campaign is expanded by exactly one lease holder at a time. Send jobs
+// are unique per campaign and contact, so when a lease expires mid-expansion
+// the next holder can start over without duplicating recipients.
+type DispatchRepository interface {
+	// LeaseCampaigns moves up to limit due scheduled campaigns to sending and
+	// leases them to owner for ttl. Sending campaigns whose expansion is
+	// unfinished and whose lease has expired are leased again. Campaigns
+	// locked by another caller are skipped.
+	LeaseCampaigns(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*model.Campaign, error)
+	// RenewLease extends owner's lease. It returns false if owner no longer
+	// holds the lease or the campaign stopped sending, for example because it
+	// was paused or cancelled.
+	RenewLease(ctx context.Context, campaignID uuid.UUID, owner string, ttl time.Duration) (bool, error)
+	// EnqueueList adds send jobs for the next limit subscribed, active
+	// members of the list with a contact ID greater than after. It returns
+	// the last contact ID read and the number read; fewer than limit means
+	// the list is exhausted.
+	EnqueueList(ctx context.Context, c *model.Campaign, listID, after uuid.UUID, limit int) (uuid.UUID, int, error)
+	// EnqueueSegment is EnqueueList for the active contacts matching filter.
+	EnqueueSegment(ctx context.Context, c *model.Campaign, filter model.SegmentFilter, after uuid.UUID, limit int) (uuid.UUID, int, error)
+	// FinishExpansion marks the audience as fully expanded and releases
+	// owner's lease. It returns false if owner no longer holds the lease.
+	FinishExpansion(ctx context.Context, campaignID uuid.UUID, owner string) (bool, error)
+	// CompleteCampaigns marks expanded sending campaigns without pending
+	// jobs as sent and returns how many there were.
+	CompleteCampaigns(ctx context.Context) (int64, error)
+}
+
+type dispatchRepository struct {
+	db *sqlx.DB
+}
+
+// NewDispatchRepository constructs a new DispatchRepository backed by a sqlx.DB.
+func NewDispatchRepository(db *sqlx.DB) DispatchRepository {
+	return &dispatchRepository{db: db}
+}
+
+func (r *dispatchRepository) LeaseCampaigns(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*model.Campaign, error) {
+	now := time.Now().UTC()
+	var out []*model.Campaign
+	// SKIP LOCKED lets concurrent schedulers lease disjoint campaigns
+	// instead of waiting on each other's row locks.
+	err := r.db.SelectContext(ctx, &out, `
+		WITH due AS (
+			SELECT id FROM campaigns
+			WHERE (status = 'scheduled' AND scheduled_at <= $1)
+			   OR (status = 'sending' AND expanded_at IS NULL
+			       AND (lease_expires_at IS NULL OR lease_expires_at < $1))
+			ORDER BY scheduled_at NULLS FIRST, id
+			LIMIT $4
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE campaigns
+		SET status = 'sending',
+		    started_at = COALESCE(started_at, $1),
+		    lease_owner = $2,
+		    lease_expires_at = $3,
+		    updated_at = $1
+		FROM due
+		WHERE campaigns.id = due.id
+		RETURNING campaigns.id, campaigns.workspace_id, campaigns.name, campaigns.template_id, campaigns.template_version, campaigns.audience, campaigns.from_name, campaigns.from_email, campaigns.reply_to, campaigns.status, campaigns.scheduled_at, campaigns.started_at, campaigns.finished_at, campaigns.created_at, campaigns.updated_at
+	`, now, owner, now.Add(ttl), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error leasing campaigns: %w", err)
+	}
+	return out, nil
+}
+
+func (r *dispatchRepository) RenewLease(ctx context.Context, campaignID uuid.UUID, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE campaigns
+		SET lease_expires_at = $3
+		WHERE id = $1 AND lease_owner = $2 AND status = 'sending' AND expanded_at IS NULL
+	`, campaignID, owner, now.Add(ttl))
+	if err != nil {
+		return false, fmt.Errorf("error renewing campaign lease: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error renewing campaign lease: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *dispatchRepository) EnqueueList(ctx context.Context, c *model.Campaign, listID, after uuid.UUID, limit int) (uuid.UUID, int, error) {
+	return r.enqueue(ctx, c, `
+		SELECT c.id, c.email
+		FROM contacts c
+		JOIN list_members m ON m.contact_id = c.id
+		WHERE c.workspace_id = $2 AND c.id > $3 AND c.status = 'active'
+		  AND (c.paused_until IS NULL OR c.paused_until <= $5)
+		  AND m.list_id = $6 AND m.status = 'subscribed'
+	`, after, limit, listID)
+}
+
+func (r *dispatchRepository) EnqueueSegment(ctx context.Context, c *model.Campaign, filter model.SegmentFilter, after uuid.UUID, limit int) (uuid.UUID, int, error) {
+	where, args, err := buildSegmentWhere(filter, 5)
+	if err != nil {
+		return uuid.Nil, 0, err
+	}
+	return r.enqueue(ctx, c, `
+		SELECT c.id, c.email
+		FROM contacts c
+		WHERE c.workspace_id = $2 AND c.id > $3 AND c.status = 'active'
+		  AND (c.paused_until IS NULL OR c.paused_until <= $5) AND `+where+`
+	`, after, limit, args...)
+}
+
+// enqueue inserts jobs for the first limit rows of audience in contact ID
+// order. audience selects id and email; $1 to $5 are the campaign ID,
+// workspace ID, cursor, limit and insert time, and args follow from $6.
+func (r *dispatchRepository) enqueue(
+	ctx context.Context,
+	c *model.Campaign,
+	audience string,
+	after uuid.UUID,
+	limit int,
+	args ...interface{},
+) (uuid.UUID, int, error) {
+	query := `
+		WITH batch AS (` + audience + `
+			ORDER BY c.id
+			LIMIT $4
+		), ins AS (
+			INSERT INTO send_jobs (campaign_id, workspace_id, contact_id, email, status, created_at, updated_at)
+			SELECT $1, $2, id, email, 'pending', $5, $5 FROM batch
+			ON CONFLICT (campaign_id, contact_id) DO NOTHING
+		)
+		SELECT (SELECT id FROM batch ORDER BY id DESC LIMIT 1) AS last, (SELECT COUNT(*) FROM batch) AS n
+	`
+	var row struct {
+		Last uuid.NullUUID `db:"last"`
+		N    int           `db:"n"`
+	}
+	all := append([]interface{}{c.ID, c.WorkspaceID, after, limit, time.Now().UTC()}, args...)
+	if err := r.db.GetContext(ctx, &row, query, all...); err != nil {
+		return uuid.Nil, 0, fmt.Errorf("error inserting send jobs: %w", err)
+	}
+	if !row.Last.Valid {
+		return after, 0, nil
+	}
+	return row.Last.UUID, row.N, nil
+}
+
+func (r *dispatchRepository) FinishExpansion(ctx context.Context, campaignID uuid.UUID, owner string) (bool, error) {
+	var id uuid.UUID
+	err := r.db.GetContext(ctx, &id, `
+		UPDATE campaigns
+		SET expanded_at = $3, lease_owner = NULL, lease_expires_at = NULL, updated_at = $3
+		WHERE id = $1 AND lease_owner = $2 AND status = 'sending' AND expanded_at IS NULL
+		RETURNING id
+	`, campaignID, owner, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("error finishing campaign expansion: %w", err)
+	}
+	return true, nil
+}
+
+func (r *dispatchRepository) CompleteCampaigns(ctx context.Context) (int64, error) {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE campaigns c
+		SET status = 'sent', finished_at = $1, updated_at = $1
+		WHERE c.status = 'sending' AND c.expanded_at IS NOT NULL
+		  AND NOT EXISTS (
+			SELECT 1 FROM send_jobs j WHERE j.campaign_id = c.id AND j.status = 'pending'
+		  )
+	`, now)
+	if err != nil {
+		return 0, fmt.Errorf("error completing campaigns: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error completing campaigns: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportJobRepository persists background contact export jobs.
+type ExportJobRepository interface {
+	Create(ctx context.Context, workspaceID uuid.UUID, format string) (*model.ExportJob, error)
+	Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.ExportJob, error)
+	MarkRunning(ctx context.Context, id uuid.UUID) error
+	// Heartbeat records that the export of a running job is alive.
+	Heartbeat(ctx context.Context, id uuid.UUID) error
+	MarkCompleted(ctx context.Context, id uuid.UUID, filePath string, rowCount int64) error
+	MarkFailed(ctx context.Context, id uuid.UUID, reason string) error
+	// FailStale fails the pending and running jobs not heard from since
+	// before and returns how many there were.
+	FailStale(ctx context.Context, before time.Time, reason string) (int64, error)
+	// Expire marks the jobs completed before before as expired and returns
+	// the paths of their files, which can then be deleted.
+	Expire(ctx context.Context, before time.Time) ([]string, error)
+}
+
+type exportJobRepository struct {
+	db *sqlx.DB
+}
+
+// NewExportJobRepository constructs a new ExportJobRepository backed by a sqlx.DB.
+func NewExportJobRepository(db *sqlx.DB) ExportJobRepository {
+	return &exportJobRepository{db: db}
+}
+
+func (r *exportJobRepository) Create(ctx context.Context, workspaceID uuid.UUID, format string) (*model.ExportJob, error) {
+	query := `
+		INSERT INTO export_jobs (id, workspace_id, format, status, created_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, workspace_id, format, status, file_path, row_count, error, created_at, finished_at, heartbeat_at
+	`
+	var j model.ExportJob
+	err := r.db.GetContext(ctx, &j, query, uuid.New(), workspaceID, format, model.ExportJobStatus_Pending, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting export job: %w", err)
+	}
+	return &j, nil
+}
+
+// Get fetches an export job by ID. Returns (nil, nil) if not found.
+func (r *exportJobRepository) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.ExportJob, error) {
+	var j model.ExportJob
+	query := `
+		SELECT id, workspace_id, format, status, file_path, row_count, error, created_at, finished_at, heartbeat_at
+		FROM export_jobs
+		WHERE workspace_id = $1 AND id = $2
+	`
+	err := r.db.GetContext(ctx, &j, query, workspaceID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting export job: %w", err)
+	}
+	return &j, nil
+}
+
+func (r *exportJobRepository) MarkRunning(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE export_jobs SET status = $2, heartbeat_at = NOW() WHERE id = $1`, id, model.ExportJobStatus_Running)
+	if err != nil {
+		return fmt.Errorf("error updating export job: %w", err)
+	}
+	return nil
+}
+
+func (r *exportJobRepository) Heartbeat(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE export_jobs SET heartbeat_at = NOW() WHERE id = $1 AND status = $2`, id, model.ExportJobStatus_Running)
+	if err != nil {
+		return fmt.Errorf("error updating export job: %w", err)
+	}
+	return nil
+}
+
+func (r *exportJobRepository) MarkCompleted(ctx context.Context, id uuid.UUID, filePath string, rowCount int64) error {
+	query := `
+		UPDATE export_jobs
+		SET status = $2, file_path = $3, row_count = $4, finished_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, model.ExportJobStatus_Completed, filePath, rowCount)
+	if err != nil {
+		return fmt.Errorf("error updating export job: %w", err)
+	}
+	return nil
+}
+
+func (r *exportJobRepository) MarkFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	query := `
+		UPDATE export_jobs
+		SET status = $2, error = $3, finished_at = NOW()
+		WHERE id = $1
+	`
+	_, err := r.db.ExecContext(ctx, query, id, model.ExportJobStatus_Failed, reason)
+	if err != nil {
+		return fmt.Errorf("error updating export job: %w", err)
+	}
+	return nil
+}
+
+func (r *exportJobRepository) Expire(ctx context.Context, before time.Time) ([]string, error) {
+	query := `
+		UPDATE export_jobs j
+		SET status = $1, file_path = ''
+		FROM (
+			SELECT id, file_path FROM export_jobs
+			WHERE status = $2 AND finished_at < $3
+			FOR UPDATE SKIP LOCKED
+		) old
+		WHERE j.id = old.id
+		RETURNING old.file_path
+	`
+	var paths []string
+	err := r.db.SelectContext(ctx, &paths, query, model.ExportJobStatus_Expired, model.ExportJobStatus_Completed, before)
+	if err != nil {
+		return nil, fmt.Errorf("error expiring export jobs: %w", err)
+	}
+	return paths, nil
+}
+
+func (r *exportJobRepository) FailStale(ctx context.Context, before time.Time, reason string) (int64, error) {
+	query := `
+		UPDATE export_jobs
+		SET status = $1, error = $2, finished_at = NOW()
+		WHERE status IN ($3, $4) AND COALESCE(heartbeat_at, created_at) < $5
+	`
+	res, err := r.db.ExecContext(ctx, query, model.ExportJobStatus_Failed, reason,
+		model.ExportJobStatus_Pending, model.ExportJobStatus_Running, before)
+	if err != nil {
+		return 0, fmt.Errorf("error failing stale export jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error failing stale export jobs: %w", err)
+	}
+	return n, nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ReplyRepository stores the replies to campaign emails.
+type ReplyRepository interface {
+	// Add inserts r, filling in its ID and ReceivedAt. It returns false if
+	// the same message was already stored for the job.
+	Add(ctx context.Context, r *model.Reply) (bool, error)
+	// List returns the replies of the workspace, newest first, optionally
+	// only those to campaignID.
+	List(ctx context.Context, workspaceID uuid.UUID, campaignID *uuid.UUID, limit, offset int) ([]*model.Reply, error)
+}
+
+type replyRepository struct {
+	db *sqlx.DB
+}
+
+// NewReplyRepository constructs a new ReplyRepository backed by a sqlx.DB.
+func NewReplyRepository(db *sqlx.DB) ReplyRepository {
+	return &replyRepository{db: db}
+}
+
+func (r *replyRepository) Add(ctx context.Context, rp *model.Reply) (bool, error) {
+	rp.ID = uuid.New()
+	rp.ReceivedAt = time.Now().UTC()
+	query := `
+		INSERT INTO replies (
+			id, workspace_id, campaign_id, contact_id, send_job_id, from_email, from_name,
+			subject, text, auto_reply, message_id, received_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		ON CONFLICT (send_job_id, message_id) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query,
+		rp.ID, rp.WorkspaceID, rp.CampaignID, rp.ContactID, rp.SendJobID, rp.FromEmail, rp.FromName,
+		rp.Subject, rp.Text, rp.AutoReply, rp.MessageID, rp.ReceivedAt)
+	if err != nil {
+		return false, fmt.Errorf("error inserting reply: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *replyRepository) List(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	campaignID *uuid.UUID,
+	limit, offset int,
+) ([]*model.Reply, error) {
+	var out []*model.Reply
+	query := `
+		SELECT id, workspace_id, campaign_id, contact_id, send_job_id, from_email, from_name,
+		       subject, text, auto_reply, message_id, received_at
+		FROM replies
+		WHERE workspace_id = $1 AND ($2::uuid IS NULL OR campaign_id = $2)
+		ORDER BY received_at DESC, id
+		LIMIT $3 OFFSET $4
+	`
+	if err := r.db.SelectContext(ctx, &out, query, workspaceID, campaignID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error selecting replies: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+)
+
+// segmentColumns maps filterable standard fields to their contacts column.
+var segmentColumns = map[string]string{
+	"email":      "c.email",
+	"first_name": "c.first_name",
+	"last_name":  "c.last_name",
+	"lang":       "c.lang",
+	"status":     "c.status",
+	"created_at": "c.created_at",
+}
+
+// ValidateSegmentFilter reports whether f can be compiled into a query.
+func ValidateSegmentFilter(f model.SegmentFilter) error {
+	_, _, err := buildSegmentWhere(f, 0)
+	return err
+}
+
+// buildSegmentWhere compiles a segment filter into a SQL boolean expression
+// over the contacts table aliased as "c". The pseudo-field "tag" matches
+// contacts by tag name. Placeholders are numbered starting
+// after argOffset so the expression can be appended to an existing query.
+func buildSegmentWhere(f model.SegmentFilter, argOffset int) (string, []interface{}, error) {
+	if len(f.Conditions) == 0 {
+		return "TRUE", nil, nil
+	}
+
+	joiner := " AND "
+	switch f.Match {
+	case model.SegmentMatch_All, "":
+	case model.SegmentMatch_Any:
+		joiner = " OR "
+	default:
+		return "", nil, fmt.Errorf("unknown segment match %q", f.Match)
+	}
+
+	var (
+		parts []string
+		args  []interface{}
+	)
+	next := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", argOffset+len(args))
+	}
+
+	for _, cond := range f.Conditions {
+		if cond.Field == "tag" {
+			expr, err := tagCondition(cond, next)
+			if err != nil {
+				return "", nil, err
+			}
+			parts = append(parts, "("+expr+")")
+			continue
+		}
+
+		var col string
+		switch {
+		case strings.HasPrefix(cond.Field, "custom."):
+			key := strings.TrimPrefix(cond.Field, "custom.")
+			if key == "" {
+				return "", nil, fmt.Errorf("empty custom field name")
+			}
+			col = "(c.custom_fields->>" + next(key) + ")"
+		default:
+			var ok bool
+			col, ok = segmentColumns[cond.Field]
+			if !ok {
+				return "", nil, fmt.Errorf("unknown segment field %q", cond.Field)
+			}
+		}
+
+		value := interface{}(cond.Value)
+		if cond.Field == "lang" {
+			lang, ok := model.ParseLanguage(cond.Value)
+			if !ok && cond.Op != "exists" && cond.Op != "not_exists" {
+				return "", nil, fmt.Errorf("unknown language %q", cond.Value)
+			}
+			value = int32(lang)
+		}
+
+		var expr string
+		switch cond.Op {
+		case "eq":
+			expr = col + " = " + next(value)
+		case "neq":
+			expr = col + " IS DISTINCT FROM " + next(value)
+		case "contains":
+			expr = col + " ILIKE " + next("%"+escapeLike(cond.Value)+"%")
+		case "starts_with":
+			expr = col + " ILIKE " + next(escapeLike(cond.Value)+"%")
+		case "gt":
+			expr = col + " > " + next(value)
+		case "lt":
+			expr = col + " < " + next(value)
+		case "exists":
+			expr = col + " IS NOT NULL AND " + col + " <> ''"
+			if cond.Field == "lang" || cond.Field == "created_at" {
+				expr = col + " IS NOT NULL"
+			}
+		case "not_exists":
+			expr = col + " IS NULL OR " + col + " = ''"
+			if cond.Field == "lang" || cond.Field == "created_at" {
+				expr = col + " IS NULL"
+			}
+		default:
+			return "", nil, fmt.Errorf("unknown segment operator %q", cond.Op)
+		}
+		parts = append(parts, "("+expr+")")
+	}
+
+	return "(" + strings.Join(parts, joiner) + ")", args, nil
+}
+
+// tagCondition compiles "has"/"not_has" conditions on tag names.
+func tagCondition(cond model.SegmentCondition, next func(interface{}) string) (string, error) {
+	if cond.Value == "" {
+		return "", fmt.Errorf("tag condition requires a tag name")
+	}
+	exists := `EXISTS (
+		SELECT 1 FROM contact_tags ct JOIN tags t ON t.id = ct.tag_id
+		WHERE ct.contact_id = c.id AND t.name = ` + next(cond.Value) + `)`
+	switch cond.Op {
+	case "has":
+		return exists, nil
+	case "not_has":
+		return "NOT " + exists, nil
+	default:
+		return "", fmt.Errorf("unknown tag operator %q", cond.Op)
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,56 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildSegmentWhere(t *testing.T) {
+	where, args, err := buildSegmentWhere(model.SegmentFilter{
+		Match: model.SegmentMatch_Any,
+		Conditions: []model.SegmentCondition{
+			{Field: "email", Op: "contains", Value: "50%_off"},
+			{Field: "lang", Op: "eq", Value: "fa"},
+			{Field: "custom.plan", Op: "eq", Value: "pro"},
+		},
+	}, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "((c.email ILIKE $2) OR (c.lang = $3) OR ((c.custom_fields->>$4) = $5))", where)
+	assert.Equal(t, []interface{}{`%50\%\_off%`, int32(model.Language_FA), "plan", "pro"}, args)
+}
+
+func TestBuildSegmentWhere_Tags(t *testing.T) {
+	where, args, err := buildSegmentWhere(model.SegmentFilter{
+		Conditions: []model.SegmentCondition{
+			{Field: "tag", Op: "has", Value: "vip"},
+			{Field: "tag", Op: "not_has", Value: "churned"},
+		},
+	}, 0)
+	assert.NoError(t, err)
+	assert.Contains(t, where, "(EXISTS (")
+	assert.Contains(t, where, "t.name = $1)")
+	assert.Contains(t, where, ") AND (NOT EXISTS (")
+	assert.Contains(t, where, "t.name = $2)")
+	assert.Equal(t, []interface{}{"vip", "churned"}, args)
+}
+
+func TestBuildSegmentWhere_Errors(t *testing.T) {
+	for _, cond := range []model.SegmentCondition{
+		{Field: "password_hash", Op: "eq", Value: "x"},
+		{Field: "email", Op: "regex", Value: "x"},
+		{Field: "lang", Op: "eq", Value: "de"},
+		{Field: "tag", Op: "eq", Value: "vip"},
+		{Field: "tag", Op: "has"},
+		{Field: "custom.", Op: "eq", Value: "x"},
+	} {
+		_, _, err := buildSegmentWhere(model.SegmentFilter{Conditions: []model.SegmentCondition{cond}}, 0)
+		assert.Error(t, err, cond)
+	}
+
+	where, args, err := buildSegmentWhere(model.SegmentFilter{}, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "TRUE", where)
+	assert.Empty(t, args)
+}
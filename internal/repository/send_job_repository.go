@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const sendJobColumns = `id, campaign_id, workspace_id, contact_id, email, status, attempts, available_at, last_error, created_at, updated_at`
+
+// SendJobRepository leases send jobs to delivery workers and records their
+// outcome.
+//
+// A lease hides a pending job until its available_at and increments its
+// attempts. Settling a job requires the attempts value the lease returned,
+// so a worker whose lease expired and was taken over cannot overwrite the
+// new holder's result.
+type SendJobRepository interface {
+	// Get fetches a job by ID in any workspace. Returns (nil, nil) if not
+	// found.
+	Get(ctx context.Context, id int64) (*model.SendJob, error)
+	// Lease leases up to limit available pending jobs for visibility.
+	// Jobs leased by other callers are skipped.
+	Lease(ctx context.Context, limit int, visibility time.Duration) ([]*model.SendJob, error)
+	// Claim leases the jobs among ids that are pending and available, and
+	// returns them. The others are settled or leased elsewhere.
+	Claim(ctx context.Context, ids []int64, visibility time.Duration) ([]*model.SendJob, error)
+	// Complete settles a leased job with a final status. It returns false if
+	// the lease was lost.
+	Complete(ctx context.Context, id int64, attempts int, status model.SendJobStatus, reason string) (bool, error)
+	// Retry makes a leased job available again at at, to be relayed again
+	// then. Its attempts are set to retryAttempts, which is lower than
+	// attempts for deferrals that do not count as a try. It returns false
+	// if the lease was lost.
+	Retry(ctx context.Context, id int64, attempts, retryAttempts int, at time.Time, reason string) (bool, error)
+	// RequeueFailed makes failed jobs of the workspace pending again, only
+	// those of campaignID unless it is uuid.Nil. It returns how many there
+	// were.
+	RequeueFailed(ctx context.Context, workspaceID, campaignID uuid.UUID) (int64, error)
+	// Relay passes up to limit available pending jobs to push and marks
+	// them relayed if it succeeds. Jobs are relayed if they were not yet,
+	// or again if they were relayed more than stale ago and are still
+	// pending, since their entry may have been lost. Concurrent relays get
+	// disjoint jobs.
+	Relay(ctx context.Context, limit int, stale time.Duration, push func([]*model.SendJob) error) (int, error)
+	// Unrelay marks the pending jobs among ids as not relayed, so Relay
+	// pushes them again once they are available.
+	Unrelay(ctx context.Context, ids []int64) error
+}
+
+type sendJobRepository struct {
+	db *sqlx.DB
+}
+
+// NewSendJobRepository constructs a new SendJobRepository backed by a sqlx.DB.
+func NewSendJobRepository(db *sqlx.DB) SendJobRepository {
+	return &sendJobRepository{db: db}
+}
+
+func (r *sendJobRepository) Get(ctx context.Context, id int64) (*model.SendJob, error) {
+	var j model.SendJob
+	err := r.db.GetContext(ctx, &j, `SELECT `+sendJobColumns+` FROM send_jobs WHERE id = $1`, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting send job: %w", err)
+	}
+	return &j, nil
+}
+
+func (r *sendJobRepository) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*model.SendJob, error) {
+	return r.lease(ctx, `TRUE`, visibility, limit)
+}
+
+func (r *sendJobRepository) Claim(ctx context.Context, ids []int64, visibility time.Duration) ([]*model.SendJob, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return r.lease(ctx, `id = ANY($4)`, visibility, len(ids), pq.Array(ids))
+}
+
+// lease leases up to limit available pending jobs matching where, which may
+// use placeholders from $4.
+func (r *sendJobRepository) lease(ctx context.Context, where string, visibility time.Duration, limit int, args ...interface{}) ([]*model.SendJob, error) {
+	now := time.Now().UTC()
+	var out []*model.SendJob
+	err := r.db.SelectContext(ctx, &out, `
+		WITH leased AS (
+			SELECT id FROM send_jobs
+			WHERE status = 'pending' AND available_at <= $1 AND `+where+`
+			ORDER BY available_at, id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE send_jobs j
+		SET attempts = j.attempts + 1, available_at = $2, updated_at = $1
+		FROM leased
+		WHERE j.id = leased.id
+		RETURNING j.id, j.campaign_id, j.workspace_id, j.contact_id, j.email, j.status, j.attempts, j.available_at, j.last_error, j.created_at, j.updated_at
+	`, append([]interface{}{now, now.Add(visibility), limit}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("error leasing send jobs: %w", err)
+	}
+	return out, nil
+}
+
+func (r *sendJobRepository) Complete(ctx context.Context, id int64, attempts int, status model.SendJobStatus, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE send_jobs
+		SET status = $3, last_error = $4, updated_at = $5
+		WHERE id = $1 AND attempts = $2 AND status = 'pending'
+	`, id, attempts, status, reason, time.Now().UTC())
+	if err != nil {
+		return false, fmt.Errorf("error completing send job: %w", err)
+	}
+	return affected(res)
+}
+
+func (r *sendJobRepository) Retry(ctx context.Context, id int64, attempts, retryAttempts int, at time.Time, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE send_jobs
+		SET attempts = $3, available_at = $4, last_error = $5, relayed_at = NULL, updated_at = $6
+		WHERE id = $1 AND attempts = $2 AND status = 'pending'
+	`, id, attempts, retryAttempts, at.UTC(), reason, time.Now().UTC())
+	if err != nil {
+		return false, fmt.Errorf("error retrying send job: %w", err)
+	}
+	return affected(res)
+}
+
+func (r *sendJobRepository) RequeueFailed(ctx context.Context, workspaceID, campaignID uuid.UUID) (int64, error) {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE send_jobs
+		SET status = 'pending', attempts = 0, available_at = $3, relayed_at = NULL, updated_at = $3
+		WHERE workspace_id = $1 AND status = 'failed'
+		  AND ($2 = '00000000-0000-0000-0000-000000000000'::uuid OR campaign_id = $2)
+	`, workspaceID, campaignID, now)
+	if err != nil {
+		return 0, fmt.Errorf("error requeueing send jobs: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("error requeueing send jobs: %w", err)
+	}
+	return n, nil
+}
+
+func (r *sendJobRepository) Relay(ctx context.Context, limit int, stale time.Duration, push func([]*model.SendJob) error) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The row locks are held while pushing, so concurrent relays skip these
+	// jobs instead of pushing them twice.
+	var jobs []*model.SendJob
+	query, args := relayQuery(limit, time.Now().UTC(), stale)
+	err = tx.SelectContext(ctx, &jobs, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error selecting unrelayed send jobs: %w", err)
+	}
+	if len(jobs) == 0 {
+		return 0, nil
+	}
+	if err := push(jobs); err != nil {
+		return 0, err
+	}
+	ids := make([]int64, len(jobs))
+	for i, j := range jobs {
+		ids[i] = j.ID
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE send_jobs SET relayed_at = $2 WHERE id = ANY($1)
+	`, pq.Array(ids), time.Now().UTC())
+	if err != nil {
+		return 0, fmt.Errorf("error marking send jobs relayed: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing relay: %w", err)
+	}
+	return len(jobs), nil
+}
+
+// relayQuery selects the jobs Relay pushes at now. Leased jobs are not
+// available, so a job relayed before now-stale and still available was
+// either never read from the queue, because its entry was lost, or its
+// worker stopped. Pushing it again at worst adds an entry that is dropped.
+func relayQuery(limit int, now time.Time, stale time.Duration) (string, []interface{}) {
+	return `
+		SELECT ` + sendJobColumns + `
+		FROM send_jobs
+		WHERE status = 'pending' AND available_at <= $2
+		  AND (relayed_at IS NULL OR relayed_at <= $3)
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, []interface{}{limit, now, now.Add(-stale)}
+}
+
+func (r *sendJobRepository) Unrelay(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := r.db.ExecContext(ctx, `
+		UPDATE send_jobs SET relayed_at = NULL WHERE id = ANY($1) AND status = 'pending'
+	`, pq.Array(ids))
+	if err != nil {
+		return fmt.Errorf("error unrelaying send jobs: %w", err)
+	}
+	return nil
+}
+
+func affected(res interface{ RowsAffected() (int64, error) }) (bool, error) {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error reading affected rows: %w", err)
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,19 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelayQuery_RelaysStaleJobsAgain(t *testing.T) {
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	query, args := relayQuery(500, now, 5*time.Minute)
+
+	assert.Contains(t, query, "status = 'pending' AND available_at <= $2")
+	// Jobs relayed before the cutoff whose entry never reached a worker
+	// are picked up again, not only those never relayed.
+	assert.Contains(t, query, "(relayed_at IS NULL OR relayed_at <= $3)")
+	assert.Equal(t, []interface{}{500, now, now.Add(-5 * time.Minute)}, args)
+}
@@ -0,0 +1,172 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrSendingDomainExists is returned when a workspace already has the
+// domain.
+var ErrSendingDomainExists = errors.New("sending domain already exists")
+
+const sendingDomainColumns = `id, workspace_id, domain, dkim_selector, dkim_algorithm, dkim_private_key, dkim_record, verification_token, status, checks, checked_at, verified_at, created_at, updated_at`
+
+// SendingDomainRepository stores the domains workspaces send from and
+// their DKIM keys.
+type SendingDomainRepository interface {
+	// Create returns ErrSendingDomainExists if the workspace has the
+	// domain.
+	Create(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error)
+	// Get returns (nil, nil) if the domain does not exist.
+	Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.SendingDomain, error)
+	// GetByDomain returns (nil, nil) if the workspace does not have the
+	// domain.
+	GetByDomain(ctx context.Context, workspaceID uuid.UUID, domain string) (*model.SendingDomain, error)
+	List(ctx context.Context, workspaceID uuid.UUID) ([]*model.SendingDomain, error)
+	// Delete returns false if the domain does not exist.
+	Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error)
+	// SaveChecks stores the status, checks and check times of d. Returns
+	// (nil, nil) if the domain does not exist.
+	SaveChecks(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error)
+	// ClaimDue returns up to limit domains of any workspace that are due
+	// for a recheck: verified domains last checked before verifiedBefore,
+	// others before unverifiedBefore. Their check time is set to now so
+	// that other callers skip them.
+	ClaimDue(ctx context.Context, verifiedBefore, unverifiedBefore time.Time, limit int) ([]*model.SendingDomain, error)
+}
+
+type sendingDomainRepository struct {
+	db *sqlx.DB
+}
+
+// NewSendingDomainRepository constructs a new SendingDomainRepository backed by a sqlx.DB.
+func NewSendingDomainRepository(db *sqlx.DB) SendingDomainRepository {
+	return &sendingDomainRepository{db: db}
+}
+
+func (r *sendingDomainRepository) Create(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error) {
+	var out model.SendingDomain
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO sending_domains (id, workspace_id, domain, dkim_selector, dkim_algorithm, dkim_private_key, dkim_record, verification_token, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		ON CONFLICT (workspace_id, domain) DO NOTHING
+		RETURNING `+sendingDomainColumns,
+		d.ID, d.WorkspaceID, d.Domain, d.DKIMSelector, d.DKIMAlgorithm, d.DKIMPrivateKey, d.DKIMRecord,
+		d.VerificationToken, model.SendingDomainStatus_Pending, d.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrSendingDomainExists
+		}
+		return nil, fmt.Errorf("error inserting sending domain: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *sendingDomainRepository) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.SendingDomain, error) {
+	var out model.SendingDomain
+	err := r.db.GetContext(ctx, &out, `
+		SELECT `+sendingDomainColumns+`
+		FROM sending_domains
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting sending domain: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *sendingDomainRepository) GetByDomain(ctx context.Context, workspaceID uuid.UUID, domain string) (*model.SendingDomain, error) {
+	var out model.SendingDomain
+	err := r.db.GetContext(ctx, &out, `
+		SELECT `+sendingDomainColumns+`
+		FROM sending_domains
+		WHERE workspace_id = $1 AND domain = $2
+	`, workspaceID, domain)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting sending domain: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *sendingDomainRepository) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.SendingDomain, error) {
+	var out []*model.SendingDomain
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+sendingDomainColumns+`
+		FROM sending_domains
+		WHERE workspace_id = $1
+		ORDER BY domain
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting sending domains: %w", err)
+	}
+	return out, nil
+}
+
+func (r *sendingDomainRepository) Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM sending_domains
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting sending domain: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error deleting sending domain: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *sendingDomainRepository) SaveChecks(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error) {
+	var out model.SendingDomain
+	err := r.db.GetContext(ctx, &out, `
+		UPDATE sending_domains
+		SET status = $3, checks = $4, checked_at = $5, verified_at = $6, updated_at = $7
+		WHERE workspace_id = $1 AND id = $2
+		RETURNING `+sendingDomainColumns,
+		d.WorkspaceID, d.ID, d.Status, d.Checks, d.CheckedAt, d.VerifiedAt, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error updating sending domain checks: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *sendingDomainRepository) ClaimDue(ctx context.Context, verifiedBefore, unverifiedBefore time.Time, limit int) ([]*model.SendingDomain, error) {
+	var out []*model.SendingDomain
+	// SKIP LOCKED lets several schedulers claim disjoint batches.
+	err := r.db.SelectContext(ctx, &out, `
+		UPDATE sending_domains
+		SET checked_at = $4
+		WHERE id IN (
+			SELECT id
+			FROM sending_domains
+			WHERE checked_at IS NULL
+			   OR (status = 'verified' AND checked_at < $1)
+			   OR (status <> 'verified' AND checked_at < $2)
+			ORDER BY checked_at NULLS FIRST
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+sendingDomainColumns,
+		verifiedBefore, unverifiedBefore, limit, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error claiming sending domains: %w", err)
+	}
+	return out, nil
+}
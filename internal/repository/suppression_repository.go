@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// SuppressionRepository stores the workspace suppression list and the
+// per-list subscription status of contacts.
+type SuppressionRepository interface {
+	// Add inserts a suppression, or returns the existing one for the same value.
+	Add(ctx context.Context, s *model.Suppression) (*model.Suppression, error)
+	// BulkAdd inserts suppressions in one transaction, skipping duplicates,
+	// and returns how many were newly inserted.
+	BulkAdd(ctx context.Context, items []*model.Suppression) (int, error)
+	Remove(ctx context.Context, workspaceID uuid.UUID, kind model.SuppressionKind, value string) (bool, error)
+	List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Suppression, error)
+	// Match returns the suppression blocking the email address itself or its
+	// domain. Returns (nil, nil) if the address may be mailed.
+	Match(ctx context.Context, workspaceID uuid.UUID, email, domain string) (*model.Suppression, error)
+	SetSubscriptionStatus(ctx context.Context, workspaceID, listID, contactID uuid.UUID, status model.SubscriptionStatus) (bool, error)
+}
+
+type suppressionRepository struct {
+	db *sqlx.DB
+}
+
+// NewSuppressionRepository constructs a new SuppressionRepository backed by a sqlx.DB.
+func NewSuppressionRepository(db *sqlx.DB) SuppressionRepository {
+	return &suppressionRepository{db: db}
+}
+
+const insertSuppression = `
+	INSERT INTO suppressions (id, workspace_id, kind, value, reason, source, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (workspace_id, kind, value) DO NOTHING
+`
+
+func (r *suppressionRepository) Add(ctx context.Context, s *model.Suppression) (*model.Suppression, error) {
+	_, err := r.db.ExecContext(ctx, insertSuppression,
+		uuid.New(), s.WorkspaceID, s.Kind, s.Value, s.Reason, s.Source, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting suppression: %w", err)
+	}
+
+	var out model.Suppression
+	query := `
+		SELECT id, workspace_id, kind, value, reason, source, created_at
+		FROM suppressions
+		WHERE workspace_id = $1 AND kind = $2 AND value = $3
+	`
+	if err := r.db.GetContext(ctx, &out, query, s.WorkspaceID, s.Kind, s.Value); err != nil {
+		return nil, fmt.Errorf("error selecting suppression: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *suppressionRepository) BulkAdd(ctx context.Context, items []*model.Suppression) (int, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PreparexContext(ctx, insertSuppression)
+	if err != nil {
+		return 0, fmt.Errorf("error preparing suppression insert: %w", err)
+	}
+	defer stmt.Close()
+
+	now := time.Now().UTC()
+	inserted := 0
+	for _, s := range items {
+		res, err := stmt.ExecContext(ctx, uuid.New(), s.WorkspaceID, s.Kind, s.Value, s.Reason, s.Source, now)
+		if err != nil {
+			return 0, fmt.Errorf("error inserting suppression: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			inserted++
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing suppressions: %w", err)
+	}
+	return inserted, nil
+}
+
+func (r *suppressionRepository) Remove(ctx context.Context, workspaceID uuid.UUID, kind model.SuppressionKind, value string) (bool, error) {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM suppressions WHERE workspace_id = $1 AND kind = $2 AND value = $3`,
+		workspaceID, kind, value)
+	if err != nil {
+		return false, fmt.Errorf("error deleting suppression: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *suppressionRepository) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Suppression, error) {
+	var out []*model.Suppression
+	query := `
+		SELECT id, workspace_id, kind, value, reason, source, created_at
+		FROM suppressions
+		WHERE workspace_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`
+	if err := r.db.SelectContext(ctx, &out, query, workspaceID, limit, offset); err != nil {
+		return nil, fmt.Errorf("error selecting suppressions: %w", err)
+	}
+	return out, nil
+}
+
+func (r *suppressionRepository) Match(ctx context.Context, workspaceID uuid.UUID, email, domain string) (*model.Suppression, error) {
+	var s model.Suppression
+	// Prefer the address-level entry: its reason is the more specific one.
+	query := `
+		SELECT id, workspace_id, kind, value, reason, source, created_at
+		FROM suppressions
+		WHERE workspace_id = $1
+		  AND ((kind = 'email' AND value = $2) OR (kind = 'domain' AND value = $3))
+		ORDER BY kind = 'email' DESC
+		LIMIT 1
+	`
+	err := r.db.GetContext(ctx, &s, query, workspaceID, email, domain)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error matching suppression: %w", err)
+	}
+	return &s, nil
+}
+
+func (r *suppressionRepository) SetSubscriptionStatus(
+	ctx context.Context,
+	workspaceID, listID, contactID uuid.UUID,
+	status model.SubscriptionStatus,
+) (bool, error) {
+	query := `
+		UPDATE list_members m
+		SET status = $4::text,
+		    unsubscribed_at = CASE WHEN $4::text = 'unsubscribed' THEN NOW() ELSE NULL END
+		FROM lists l
+		WHERE l.id = m.list_id AND l.workspace_id = $1 AND m.list_id = $2 AND m.contact_id = $3
+	`
+	res, err := r.db.ExecContext(ctx, query, workspaceID, listID, contactID, status)
+	if err != nil {
+		return false, fmt.Errorf("error updating subscription status: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,180 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// TagTarget selects the contacts of a bulk tag operation: either explicit
+// contact IDs or every contact matching a segment filter.
+type TagTarget struct {
+	ContactIDs []uuid.UUID
+	Filter     *model.SegmentFilter
+}
+
+// TagRepository stores tags and their assignment to contacts.
+type TagRepository interface {
+	// Ensure returns the tags with the given names, creating missing ones.
+	Ensure(ctx context.Context, workspaceID uuid.UUID, names []string) ([]*model.Tag, error)
+	GetByNames(ctx context.Context, workspaceID uuid.UUID, names []string) ([]*model.Tag, error)
+	// ListWithCounts returns all tags with the number of tagged contacts.
+	ListWithCounts(ctx context.Context, workspaceID uuid.UUID) ([]*model.Tag, error)
+	Delete(ctx context.Context, workspaceID, tagID uuid.UUID) (bool, error)
+	// Tag attaches the tags to every targeted contact and returns the number
+	// of new assignments.
+	Tag(ctx context.Context, workspaceID uuid.UUID, tagIDs []uuid.UUID, target TagTarget) (int64, error)
+	// Untag removes the tags from every targeted contact and returns the
+	// number of removed assignments.
+	Untag(ctx context.Context, workspaceID uuid.UUID, tagIDs []uuid.UUID, target TagTarget) (int64, error)
+}
+
+type tagRepository struct {
+	db *sqlx.DB
+}
+
+// NewTagRepository constructs a new TagRepository backed by a sqlx.DB.
+func NewTagRepository(db *sqlx.DB) TagRepository {
+	return &tagRepository{db: db}
+}
+
+func (r *tagRepository) Ensure(ctx context.Context, workspaceID uuid.UUID, names []string) ([]*model.Tag, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	for _, name := range names {
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO tags (id, workspace_id, name, created_at)
+			VALUES ($1, $2, $3, $4)
+			ON CONFLICT (workspace_id, name) DO NOTHING
+		`, uuid.New(), workspaceID, name, now)
+		if err != nil {
+			return nil, fmt.Errorf("error inserting tag: %w", err)
+		}
+	}
+
+	var tags []*model.Tag
+	err = tx.SelectContext(ctx, &tags, `
+		SELECT id, workspace_id, name, created_at, 0 AS contact_count
+		FROM tags
+		WHERE workspace_id = $1 AND name = ANY($2)
+		ORDER BY name
+	`, workspaceID, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("error selecting tags: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *tagRepository) GetByNames(ctx context.Context, workspaceID uuid.UUID, names []string) ([]*model.Tag, error) {
+	var tags []*model.Tag
+	query := `
+		SELECT id, workspace_id, name, created_at, 0 AS contact_count
+		FROM tags
+		WHERE workspace_id = $1 AND name = ANY($2)
+		ORDER BY name
+	`
+	if err := r.db.SelectContext(ctx, &tags, query, workspaceID, pq.Array(names)); err != nil {
+		return nil, fmt.Errorf("error selecting tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *tagRepository) ListWithCounts(ctx context.Context, workspaceID uuid.UUID) ([]*model.Tag, error) {
+	var tags []*model.Tag
+	query := `
+		SELECT t.id, t.workspace_id, t.name, t.created_at, COUNT(ct.contact_id) AS contact_count
+		FROM tags t
+		LEFT JOIN contact_tags ct ON ct.tag_id = t.id
+		WHERE t.workspace_id = $1
+		GROUP BY t.id
+		ORDER BY t.name
+	`
+	if err := r.db.SelectContext(ctx, &tags, query, workspaceID); err != nil {
+		return nil, fmt.Errorf("error selecting tags: %w", err)
+	}
+	return tags, nil
+}
+
+func (r *tagRepository) Delete(ctx context.Context, workspaceID, tagID uuid.UUID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM tags WHERE workspace_id = $1 AND id = $2`, workspaceID, tagID)
+	if err != nil {
+		return false, fmt.Errorf("error deleting tag: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (r *tagRepository) Tag(ctx context.Context, workspaceID uuid.UUID, tagIDs []uuid.UUID, target TagTarget) (int64, error) {
+	contacts, args, err := targetContacts(workspaceID, tagIDs, target)
+	if err != nil {
+		return 0, err
+	}
+	// Tag IDs are re-checked against the workspace so callers cannot attach
+	// another workspace's tags.
+	query := `
+		INSERT INTO contact_tags (contact_id, tag_id, created_at)
+		SELECT c.id, t.id, NOW()
+		FROM (` + contacts + `) c
+		JOIN tags t ON t.workspace_id = $1 AND t.id = ANY($2::uuid[])
+		ON CONFLICT (contact_id, tag_id) DO NOTHING
+	`
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error tagging contacts: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+func (r *tagRepository) Untag(ctx context.Context, workspaceID uuid.UUID, tagIDs []uuid.UUID, target TagTarget) (int64, error) {
+	contacts, args, err := targetContacts(workspaceID, tagIDs, target)
+	if err != nil {
+		return 0, err
+	}
+	query := `
+		DELETE FROM contact_tags ct
+		USING tags t
+		WHERE t.id = ct.tag_id AND t.workspace_id = $1 AND t.id = ANY($2::uuid[])
+		  AND ct.contact_id IN (SELECT id FROM (` + contacts + `) c)
+	`
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error untagging contacts: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// targetContacts returns a sub-select of contact IDs for target. Its
+// arguments start with the workspace ($1) and the tag IDs ($2).
+func targetContacts(workspaceID uuid.UUID, tagIDs []uuid.UUID, target TagTarget) (string, []interface{}, error) {
+	args := []interface{}{workspaceID, pq.Array(uuidStrings(tagIDs))}
+	if target.Filter != nil {
+		where, fargs, err := buildSegmentWhere(*target.Filter, len(args))
+		if err != nil {
+			return "", nil, err
+		}
+		return `SELECT c.id FROM contacts c WHERE c.workspace_id = $1 AND ` + where, append(args, fargs...), nil
+	}
+	args = append(args, pq.Array(uuidStrings(target.ContactIDs)))
+	return `SELECT c.id FROM contacts c WHERE c.workspace_id = $1 AND c.id = ANY($3::uuid[])`, args, nil
+}
+
+func uuidStrings(ids []uuid.UUID) []string {
+	out := make([]string, len(ids))
+	for i, id := range ids {
+		out[i] = id.String()
+	}
+	return out
+}
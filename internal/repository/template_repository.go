@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrVersionConflict is returned when a template changed since the version
+// the caller based its edit on.
+var ErrVersionConflict = errors.New("template was modified concurrently")
+
+const templateVersionColumns = `template_id, version, subject, preheader, html_body, text_body, lang, variants, layout, author_id, note, created_at`
+
+// TemplateRepository stores templates and their immutable versions.
+type TemplateRepository interface {
+	// Create inserts a template together with its first version. refs are
+	// the names of the content blocks the version uses.
+	Create(ctx context.Context, workspaceID uuid.UUID, name string, content model.LocalizedContent, refs []string, authorID uuid.UUID) (*model.Template, *model.TemplateVersion, error)
+	// AddVersion appends a version and makes it current. A non-zero
+	// baseVersion must equal the current version or ErrVersionConflict is
+	// returned. An empty name keeps the existing one. Returns (nil, nil) if
+	// the template does not exist.
+	AddVersion(ctx context.Context, workspaceID, templateID uuid.UUID, name string, content model.LocalizedContent, refs []string, authorID uuid.UUID, note string, baseVersion int32) (*model.TemplateVersion, error)
+	Get(ctx context.Context, workspaceID, templateID uuid.UUID) (*model.Template, error)
+	// GetVersion fetches one version; version 0 means the current one.
+	// Returns (nil, nil) if not found.
+	GetVersion(ctx context.Context, workspaceID, templateID uuid.UUID, version int32) (*model.TemplateVersion, error)
+	List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Template, error)
+	ListVersions(ctx context.Context, workspaceID, templateID uuid.UUID) ([]*model.TemplateVersion, error)
+}
+
+type templateRepository struct {
+	db *sqlx.DB
+}
+
+// NewTemplateRepository constructs a new TemplateRepository backed by a sqlx.DB.
+func NewTemplateRepository(db *sqlx.DB) TemplateRepository {
+	return &templateRepository{db: db}
+}
+
+func (r *templateRepository) Create(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	name string,
+	content model.LocalizedContent,
+	refs []string,
+	authorID uuid.UUID,
+) (*model.Template, *model.TemplateVersion, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	var t model.Template
+	err = tx.GetContext(ctx, &t, `
+		INSERT INTO templates (id, workspace_id, name, current_version, created_at, updated_at)
+		VALUES ($1, $2, $3, 1, $4, $4)
+		RETURNING id, workspace_id, name, current_version, created_at, updated_at
+	`, uuid.New(), workspaceID, name, now)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error inserting template: %w", err)
+	}
+
+	v, err := insertTemplateVersion(ctx, tx, t.ID, 1, content, refs, authorID, "", now)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, nil, fmt.Errorf("error committing template: %w", err)
+	}
+	return &t, v, nil
+}
+
+func (r *templateRepository) AddVersion(
+	ctx context.Context,
+	workspaceID, templateID uuid.UUID,
+	name string,
+	content model.LocalizedContent,
+	refs []string,
+	authorID uuid.UUID,
+	note string,
+	baseVersion int32,
+) (*model.TemplateVersion, error) {
+	tx, err := r.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the template row so concurrent edits get consecutive versions.
+	var current int32
+	err = tx.GetContext(ctx, &current, `
+		SELECT current_version FROM templates
+		WHERE workspace_id = $1 AND id = $2
+		FOR UPDATE
+	`, workspaceID, templateID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error locking template: %w", err)
+	}
+	if baseVersion != 0 && baseVersion != current {
+		return nil, ErrVersionConflict
+	}
+
+	now := time.Now().UTC()
+	next := current + 1
+	v, err := insertTemplateVersion(ctx, tx, templateID, next, content, refs, authorID, note, now)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE templates
+		SET current_version = $2, updated_at = $3, name = COALESCE(NULLIF($4, ''), name)
+		WHERE id = $1
+	`, templateID, next, now, name)
+	if err != nil {
+		return nil, fmt.Errorf("error updating template: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing template version: %w", err)
+	}
+	return v, nil
+}
+
+func insertTemplateVersion(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	templateID uuid.UUID,
+	version int32,
+	content model.LocalizedContent,
+	refs []string,
+	authorID uuid.UUID,
+	note string,
+	now time.Time,
+) (*model.TemplateVersion, error) {
+	var v model.TemplateVersion
+	err := tx.GetContext(ctx, &v, `
+		INSERT INTO template_versions (`+templateVersionColumns+`, block_refs)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, COALESCE($13::text[], '{}'))
+		RETURNING `+templateVersionColumns,
+		templateID, version, content.Subject, content.Preheader, content.HTMLBody, content.TextBody,
+		content.Lang, content.Variants, content.Layout, authorID, note, now, pq.Array(refs))
+	if err != nil {
+		return nil, fmt.Errorf("error inserting template version: %w", err)
+	}
+	return &v, nil
+}
+
+// Get fetches a template by ID. Returns (nil, nil) if not found.
+func (r *templateRepository) Get(ctx context.Context, workspaceID, templateID uuid.UUID) (*model.Template, error) {
+	var t model.Template
+	err := r.db.GetContext(ctx, &t, `
+		SELECT id, workspace_id, name, current_version, created_at, updated_at
+		FROM templates
+		WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, templateID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting template: %w", err)
+	}
+	return &t, nil
+}
+
+func (r *templateRepository) GetVersion(ctx context.Context, workspaceID, templateID uuid.UUID, version int32) (*model.TemplateVersion, error) {
+	var v model.TemplateVersion
+	err := r.db.GetContext(ctx, &v, `
+		SELECT v.template_id, v.version, v.subject, v.preheader, v.html_body, v.text_body, v.lang, v.variants, v.layout, v.author_id, v.note, v.created_at
+		FROM template_versions v
+		JOIN templates t ON t.id = v.template_id
+		WHERE t.workspace_id = $1 AND t.id = $2
+		  AND v.version = CASE WHEN $3::int = 0 THEN t.current_version ELSE $3::int END
+	`, workspaceID, templateID, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error selecting template version: %w", err)
+	}
+	return &v, nil
+}
+
+func (r *templateRepository) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Template, error) {
+	var out []*model.Template
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT id, workspace_id, name, current_version, created_at, updated_at
+		FROM templates
+		WHERE workspace_id = $1
+		ORDER BY updated_at DESC, id
+		LIMIT $2 OFFSET $3
+	`, workspaceID, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting templates: %w", err)
+	}
+	return out, nil
+}
+
+func (r *templateRepository) ListVersions(ctx context.Context, workspaceID, templateID uuid.UUID) ([]*model.TemplateVersion, error) {
+	var out []*model.TemplateVersion
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT v.template_id, v.version, v.subject, v.preheader, v.html_body, v.text_body, v.lang, v.variants, v.layout, v.author_id, v.note, v.created_at
+		FROM template_versions v
+		JOIN templates t ON t.id = v.template_id
+		WHERE t.workspace_id = $1 AND t.id = $2
+		ORDER BY v.version DESC
+	`, workspaceID, templateID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting template versions: %w", err)
+	}
+	return out, nil
+}
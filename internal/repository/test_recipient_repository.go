@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+const testRecipientColumns = `id, workspace_id, email, verified_at, verification_sent_at, created_at`
+
+// TestRecipientRepository stores the addresses workspaces send template
+// tests to.
+type TestRecipientRepository interface {
+	// Add inserts an unverified recipient, or returns the existing one.
+	Add(ctx context.Context, workspaceID uuid.UUID, email string) (*model.TestRecipient, error)
+	List(ctx context.Context, workspaceID uuid.UUID) ([]*model.TestRecipient, error)
+	// Delete returns false if the recipient does not exist.
+	Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error)
+	// MarkVerified returns (nil, nil) if the recipient does not exist.
+	MarkVerified(ctx context.Context, workspaceID, id uuid.UUID) (*model.TestRecipient, error)
+	// MarkVerificationSent records that a verification email is sent to the
+	// recipient now. It returns false, recording nothing, if one was sent
+	// to the same address after since, from any workspace.
+	MarkVerificationSent(ctx context.Context, workspaceID, id uuid.UUID, since time.Time) (bool, error)
+	// GetByEmails fetches the recipients among emails.
+	GetByEmails(ctx context.Context, workspaceID uuid.UUID, emails []string) ([]*model.TestRecipient, error)
+}
+
+type testRecipientRepository struct {
+	db *sqlx.DB
+}
+
+// NewTestRecipientRepository constructs a new TestRecipientRepository backed by a sqlx.DB.
+func NewTestRecipientRepository(db *sqlx.DB) TestRecipientRepository {
+	return &testRecipientRepository{db: db}
+}
+
+func (r *testRecipientRepository) Add(ctx context.Context, workspaceID uuid.UUID, email string) (*model.TestRecipient, error) {
+	var out model.TestRecipient
+	// The no-op update makes RETURNING yield the existing row on conflict.
+	err := r.db.GetContext(ctx, &out, `
+		INSERT INTO test_recipients (id, workspace_id, email, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (workspace_id, email) DO UPDATE SET email = EXCLUDED.email
+		RETURNING `+testRecipientColumns,
+		uuid.New(), workspaceID, email, time.Now().UTC())
+	if err != nil {
+		return nil, fmt.Errorf("error inserting test recipient: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *testRecipientRepository) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.TestRecipient, error) {
+	var out []*model.TestRecipient
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+testRecipientColumns+`
+		FROM test_recipients
+		WHERE workspace_id = $1
+		ORDER BY email
+	`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting test recipients: %w", err)
+	}
+	return out, nil
+}
+
+func (r *testRecipientRepository) Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		DELETE FROM test_recipients WHERE workspace_id = $1 AND id = $2
+	`, workspaceID, id)
+	if err != nil {
+		return false, fmt.Errorf("error deleting test recipient: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error deleting test recipient: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *testRecipientRepository) MarkVerified(ctx context.Context, workspaceID, id uuid.UUID) (*model.TestRecipient, error) {
+	var out model.TestRecipient
+	err := r.db.GetContext(ctx, &out, `
+		UPDATE test_recipients
+		SET verified_at = COALESCE(verified_at, $3)
+		WHERE workspace_id = $1 AND id = $2
+		RETURNING `+testRecipientColumns,
+		workspaceID, id, time.Now().UTC())
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error verifying test recipient: %w", err)
+	}
+	return &out, nil
+}
+
+func (r *testRecipientRepository) MarkVerificationSent(ctx context.Context, workspaceID, id uuid.UUID, since time.Time) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE test_recipients t
+		SET verification_sent_at = $4
+		WHERE t.workspace_id = $1 AND t.id = $2 AND NOT EXISTS (
+			SELECT 1 FROM test_recipients o
+			WHERE o.email = t.email AND o.verification_sent_at > $3
+		)
+	`, workspaceID, id, since.UTC(), time.Now().UTC())
+	if err != nil {
+		return false, fmt.Errorf("error marking test recipient verification sent: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error marking test recipient verification sent: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *testRecipientRepository) GetByEmails(ctx context.Context, workspaceID uuid.UUID, emails []string) ([]*model.TestRecipient, error) {
+	var out []*model.TestRecipient
+	err := r.db.SelectContext(ctx, &out, `
+		SELECT `+testRecipientColumns+`
+		FROM test_recipients
+		WHERE workspace_id = $1 AND email = ANY($2)
+	`, workspaceID, pq.Array(emails))
+	if err != nil {
+		return nil, fmt.Errorf("error selecting test recipients: %w", err)
+	}
+	return out, nil
+}
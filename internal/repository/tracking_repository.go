@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// TrackingRepository stores the opens and clicks of campaign emails.
+type TrackingRepository interface {
+	// Add inserts e, filling in its ID and CreatedAt.
+	Add(ctx context.Context, e *model.TrackingEvent) error
+}
+
+type trackingRepository struct {
+	db *sqlx.DB
+}
+
+// NewTrackingRepository constructs a new TrackingRepository backed by a sqlx.DB.
+func NewTrackingRepository(db *sqlx.DB) TrackingRepository {
+	return &trackingRepository{db: db}
+}
+
+func (r *trackingRepository) Add(ctx context.Context, e *model.TrackingEvent) error {
+	e.ID = uuid.New()
+	e.CreatedAt = time.Now().UTC()
+	query := `
+		INSERT INTO tracking_events (
+			id, workspace_id, campaign_id, contact_id, send_job_id, kind, url, agent, ip, user_agent, created_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`
+	_, err := r.db.ExecContext(ctx, query,
+		e.ID, e.WorkspaceID, e.CampaignID, e.ContactID, e.SendJobID, e.Kind, e.URL, e.Agent, e.IP, e.UserAgent, e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("error inserting tracking event: %w", err)
+	}
+	return nil
+}
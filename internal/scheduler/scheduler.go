@@ -0,0 +1,213 @@
+// Package scheduler starts due campaigns.
+//
+// Every replica of the scheduler polls for campaigns whose send time has
+// passed, leases them and expands their audience into send jobs. Leases are
+// taken with FOR UPDATE SKIP LOCKED so replicas never expand the same
+// campaign at once, and expire so a campaign whose scheduler crashed is
+// picked up by another. Send jobs are unique per recipient, so a campaign
+// expanded again after a crash gets each recipient exactly once.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultPollInterval = 10 * time.Second
+	DefaultLeaseTTL     = time.Minute
+	DefaultBatchSize    = 1000
+	// DefaultMaxCampaigns is how many campaigns are leased per poll.
+	DefaultMaxCampaigns = 10
+)
+
+// Options configures a Scheduler. Zero values select the defaults.
+type Options struct {
+	// Owner identifies this replica in leases. Defaults to the host name
+	// and a random suffix.
+	Owner        string
+	PollInterval time.Duration
+	LeaseTTL     time.Duration
+	BatchSize    int
+	MaxCampaigns int
+}
+
+// DomainRechecker verifies the sending domains that are due for a check.
+// service.DomainVerifier satisfies it.
+type DomainRechecker interface {
+	RecheckDomains(ctx context.Context) (int, error)
+}
+
+// Scheduler expands due campaigns into send jobs and rechecks sending
+// domains.
+type Scheduler struct {
+	dispatch repository.DispatchRepository
+	contacts repository.ContactRepository
+	domains  DomainRechecker
+	opts     Options
+	logger   *zap.SugaredLogger
+}
+
+// New constructs a Scheduler. Sending domains are not rechecked if domains
+// is nil.
+func New(
+	dispatch repository.DispatchRepository,
+	contacts repository.ContactRepository,
+	domains DomainRechecker,
+	opts Options,
+	logger *zap.SugaredLogger,
+) *Scheduler {
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		opts.Owner = fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.LeaseTTL <= 0 {
+		opts.LeaseTTL = DefaultLeaseTTL
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.MaxCampaigns <= 0 {
+		opts.MaxCampaigns = DefaultMaxCampaigns
+	}
+	return &Scheduler{dispatch: dispatch, contacts: contacts, domains: domains, opts: opts, logger: logger}
+}
+
+// Run polls until ctx is cancelled. Errors are logged and retried on the
+// next poll.
+func (s *Scheduler) Run(ctx context.Context) error {
+	s.logger.Infof("scheduler %s polling every %s", s.opts.Owner, s.opts.PollInterval)
+	ticker := time.NewTicker(s.opts.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := s.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			s.logger.Errorf("scheduler poll: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce leases the campaigns that are due, expands each of them and marks
+// campaigns whose jobs have all been processed as sent. It then rechecks
+// the sending domains that are due.
+func (s *Scheduler) RunOnce(ctx context.Context) error {
+	campaigns, err := s.dispatch.LeaseCampaigns(ctx, s.opts.Owner, s.opts.LeaseTTL, s.opts.MaxCampaigns)
+	if err != nil {
+		return err
+	}
+	for _, c := range campaigns {
+		if err := s.expand(ctx, c); err != nil {
+			// The lease expires and another poll retries the campaign.
+			s.logger.Errorf("expand campaign %s: %v", c.ID, err)
+		}
+	}
+	n, err := s.dispatch.CompleteCampaigns(ctx)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.logger.Infof("%d campaigns sent", n)
+	}
+	if s.domains != nil {
+		checked, err := s.domains.RecheckDomains(ctx)
+		if checked > 0 {
+			s.logger.Infof("%d sending domains rechecked", checked)
+		}
+		if err != nil {
+			return fmt.Errorf("recheck sending domains: %w", err)
+		}
+	}
+	return nil
+}
+
+// errLeaseLost stops an expansion whose lease was taken over or whose
+// campaign was paused or cancelled.
+var errLeaseLost = errors.New("campaign lease lost")
+
+// expand enqueues a job for every recipient of c. Recipients in several
+// lists or segments get a single job.
+func (s *Scheduler) expand(ctx context.Context, c *model.Campaign) error {
+	for _, id := range c.Audience.ListIDs {
+		listID := id
+		err := s.drain(ctx, c, func(after uuid.UUID) (uuid.UUID, int, error) {
+			return s.dispatch.EnqueueList(ctx, c, listID, after, s.opts.BatchSize)
+		})
+		if err != nil {
+			return s.stop(c, err)
+		}
+	}
+	for _, id := range c.Audience.SegmentIDs {
+		seg, err := s.contacts.GetSegment(ctx, c.WorkspaceID, id)
+		if err != nil {
+			return err
+		}
+		if seg == nil {
+			s.logger.Warnf("campaign %s: segment %s no longer exists", c.ID, id)
+			continue
+		}
+		err = s.drain(ctx, c, func(after uuid.UUID) (uuid.UUID, int, error) {
+			return s.dispatch.EnqueueSegment(ctx, c, seg.Filter, after, s.opts.BatchSize)
+		})
+		if err != nil {
+			return s.stop(c, err)
+		}
+	}
+
+	ok, err := s.dispatch.FinishExpansion(ctx, c.ID, s.opts.Owner)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return s.stop(c, errLeaseLost)
+	}
+	s.logger.Infof("campaign %s expanded", c.ID)
+	return nil
+}
+
+// drain calls next with an advancing cursor until a batch comes back short,
+// renewing the lease between batches.
+func (s *Scheduler) drain(ctx context.Context, c *model.Campaign, next func(after uuid.UUID) (uuid.UUID, int, error)) error {
+	after := uuid.Nil
+	for {
+		last, n, err := next(after)
+		if err != nil {
+			return err
+		}
+		if n < s.opts.BatchSize {
+			return nil
+		}
+		after = last
+		ok, err := s.dispatch.RenewLease(ctx, c.ID, s.opts.Owner, s.opts.LeaseTTL)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return errLeaseLost
+		}
+	}
+}
+
+// stop reports a lost lease as a normal outcome: the campaign was paused,
+// cancelled or taken over by another replica.
+func (s *Scheduler) stop(c *model.Campaign, err error) error {
+	if err == errLeaseLost {
+		s.logger.Infof("campaign %s: stopped expanding, lease lost", c.ID)
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,269 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/scheduler"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+type lease struct {
+	owner    string
+	expires  time.Time
+	expanded bool
+}
+
+// fakeDispatch is an in-memory repository.DispatchRepository with a manual
+// clock.
+type fakeDispatch struct {
+	now       time.Time
+	campaigns map[uuid.UUID]*model.Campaign
+	leases    map[uuid.UUID]*lease
+	lists     map[uuid.UUID][]uuid.UUID
+	// jobs counts enqueue attempts per campaign and contact; the unique key
+	// of send_jobs keeps one row however many there are.
+	jobs map[[2]uuid.UUID]int
+	// crashAfter fails enqueues once that many succeeded; zero never fails.
+	crashAfter int
+	enqueues   int
+}
+
+func newFakeDispatch() *fakeDispatch {
+	return &fakeDispatch{
+		now:       time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC),
+		campaigns: map[uuid.UUID]*model.Campaign{},
+		leases:    map[uuid.UUID]*lease{},
+		lists:     map[uuid.UUID][]uuid.UUID{},
+		jobs:      map[[2]uuid.UUID]int{},
+	}
+}
+
+func (f *fakeDispatch) addList(size int) uuid.UUID {
+	id := uuid.New()
+	var contacts []uuid.UUID
+	for i := 0; i < size; i++ {
+		contacts = append(contacts, uuid.New())
+	}
+	sort.Slice(contacts, func(i, j int) bool { return contacts[i].String() < contacts[j].String() })
+	f.lists[id] = contacts
+	return id
+}
+
+func (f *fakeDispatch) LeaseCampaigns(ctx context.Context, owner string, ttl time.Duration, limit int) ([]*model.Campaign, error) {
+	var out []*model.Campaign
+	for id, c := range f.campaigns {
+		l := f.leases[id]
+		due := c.Status == model.CampaignStatus_Scheduled && !c.ScheduledAt.After(f.now)
+		expired := c.Status == model.CampaignStatus_Sending && l != nil && !l.expanded && l.expires.Before(f.now)
+		if !due && !expired || len(out) == limit {
+			continue
+		}
+		c.Status = model.CampaignStatus_Sending
+		f.leases[id] = &lease{owner: owner, expires: f.now.Add(ttl)}
+		cp := *c
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (f *fakeDispatch) holds(id uuid.UUID, owner string) bool {
+	l := f.leases[id]
+	return l != nil && l.owner == owner && !l.expanded && f.campaigns[id].Status == model.CampaignStatus_Sending
+}
+
+func (f *fakeDispatch) RenewLease(ctx context.Context, id uuid.UUID, owner string, ttl time.Duration) (bool, error) {
+	if !f.holds(id, owner) {
+		return false, nil
+	}
+	f.leases[id].expires = f.now.Add(ttl)
+	return true, nil
+}
+
+func (f *fakeDispatch) EnqueueList(ctx context.Context, c *model.Campaign, listID, after uuid.UUID, limit int) (uuid.UUID, int, error) {
+	if f.crashAfter > 0 && f.enqueues == f.crashAfter {
+		return uuid.Nil, 0, errors.New("connection reset")
+	}
+	f.enqueues++
+	n := 0
+	last := after
+	for _, id := range f.lists[listID] {
+		if id.String() <= after.String() || n == limit {
+			continue
+		}
+		f.jobs[[2]uuid.UUID{c.ID, id}]++
+		last = id
+		n++
+	}
+	return last, n, nil
+}
+
+func (f *fakeDispatch) EnqueueSegment(ctx context.Context, c *model.Campaign, filter model.SegmentFilter, after uuid.UUID, limit int) (uuid.UUID, int, error) {
+	return after, 0, nil
+}
+
+func (f *fakeDispatch) FinishExpansion(ctx context.Context, id uuid.UUID, owner string) (bool, error) {
+	if !f.holds(id, owner) {
+		return false, nil
+	}
+	f.leases[id].expanded = true
+	return true, nil
+}
+
+func (f *fakeDispatch) CompleteCampaigns(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// noSegments satisfies repository.ContactRepository; the tests only use lists.
+type noSegments struct {
+	repository.ContactRepository
+}
+
+func (noSegments) GetSegment(ctx context.Context, workspaceID, segmentID uuid.UUID) (*model.Segment, error) {
+	return nil, nil
+}
+
+func (f *fakeDispatch) schedule(lists ...uuid.UUID) *model.Campaign {
+	at := f.now.Add(-time.Second)
+	c := &model.Campaign{
+		ID:          uuid.New(),
+		WorkspaceID: uuid.New(),
+		Status:      model.CampaignStatus_Scheduled,
+		ScheduledAt: &at,
+		Audience:    model.CampaignAudience{ListIDs: lists},
+	}
+	f.campaigns[c.ID] = c
+	return c
+}
+
+func newScheduler(f *fakeDispatch, owner string) *scheduler.Scheduler {
+	return scheduler.New(f, noSegments{}, nil, scheduler.Options{
+		Owner:     owner,
+		LeaseTTL:  time.Minute,
+		BatchSize: 10,
+	}, zap.NewNop().Sugar())
+}
+
+func (f *fakeDispatch) assertExactlyOnce(t *testing.T, c *model.Campaign) {
+	want := map[uuid.UUID]bool{}
+	for _, list := range c.Audience.ListIDs {
+		for _, id := range f.lists[list] {
+			want[id] = true
+		}
+	}
+	got := 0
+	for key := range f.jobs {
+		if key[0] == c.ID {
+			assert.True(t, want[key[1]], "job for a contact outside the audience")
+			got++
+		}
+	}
+	assert.Equal(t, len(want), got)
+}
+
+func TestScheduler_ExpandsDueCampaigns(t *testing.T) {
+	f := newFakeDispatch()
+	shared := f.addList(25)
+	c := f.schedule(shared, f.addList(10), shared)
+	later := f.schedule(f.addList(5))
+	*f.campaigns[later.ID].ScheduledAt = f.now.Add(time.Hour)
+
+	err := newScheduler(f, "a").RunOnce(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.Equal(t, model.CampaignStatus_Sending, f.campaigns[c.ID].Status)
+	assert.True(t, f.leases[c.ID].expanded)
+	f.assertExactlyOnce(t, c)
+	assert.Equal(t, model.CampaignStatus_Scheduled, f.campaigns[later.ID].Status)
+	assert.Nil(t, f.leases[later.ID])
+}
+
+func TestScheduler_ResumesAfterCrash(t *testing.T) {
+	f := newFakeDispatch()
+	c := f.schedule(f.addList(35), f.addList(12))
+
+	// Replica a dies after two batches, holding the lease.
+	f.crashAfter = 2
+	err := newScheduler(f, "a").RunOnce(context.Background())
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.False(t, f.leases[c.ID].expanded)
+	f.crashAfter = 0
+
+	// Replica b cannot take the campaign while the lease is held.
+	b := newScheduler(f, "b")
+	if !assert.NoError(t, b.RunOnce(context.Background())) {
+		return
+	}
+	assert.Equal(t, "a", f.leases[c.ID].owner)
+
+	// Once it expires, b expands the campaign from the start.
+	f.now = f.now.Add(2 * time.Minute)
+	if !assert.NoError(t, b.RunOnce(context.Background())) {
+		return
+	}
+	assert.Equal(t, "b", f.leases[c.ID].owner)
+	assert.True(t, f.leases[c.ID].expanded)
+	f.assertExactlyOnce(t, c)
+	// Recipients of the first batches were enqueued twice and kept once.
+	assert.Equal(t, 2, f.jobs[[2]uuid.UUID{c.ID, f.lists[c.Audience.ListIDs[0]][0]}])
+}
+
+func TestScheduler_StopsWhenCampaignIsPaused(t *testing.T) {
+	f := newFakeDispatch()
+	c := f.schedule(f.addList(30))
+	// Pausing between batches makes the lease renewal fail.
+	dispatch := &pausingDispatch{fakeDispatch: f}
+	s := scheduler.New(dispatch, noSegments{}, nil, scheduler.Options{Owner: "a", BatchSize: 10}, zap.NewNop().Sugar())
+
+	if !assert.NoError(t, s.RunOnce(context.Background())) {
+		return
+	}
+	assert.Equal(t, model.CampaignStatus_Paused, f.campaigns[c.ID].Status)
+	assert.False(t, f.leases[c.ID].expanded)
+	assert.Len(t, f.jobs, 10)
+}
+
+// pausingDispatch pauses every campaign after its first batch.
+type pausingDispatch struct {
+	*fakeDispatch
+}
+
+func (p *pausingDispatch) EnqueueList(ctx context.Context, c *model.Campaign, listID, after uuid.UUID, limit int) (uuid.UUID, int, error) {
+	last, n, err := p.fakeDispatch.EnqueueList(ctx, c, listID, after, limit)
+	p.campaigns[c.ID].Status = model.CampaignStatus_Paused
+	return last, n, err
+}
+
+// countingRechecker records how often sending domains were rechecked.
+type countingRechecker struct {
+	calls int
+	err   error
+}
+
+func (r *countingRechecker) RecheckDomains(ctx context.Context) (int, error) {
+	r.calls++
+	return 2, r.err
+}
+
+func TestScheduler_RechecksDomains(t *testing.T) {
+	ctx := context.Background()
+	domains := &countingRechecker{}
+	s := scheduler.New(newFakeDispatch(), noSegments{}, domains, scheduler.Options{Owner: "a"}, zap.NewNop().Sugar())
+
+	assert.NoError(t, s.RunOnce(ctx))
+	assert.Equal(t, 1, domains.calls)
+
+	domains.err = errors.New("dns down")
+	assert.EqualError(t, s.RunOnce(ctx), "recheck sending domains: dns down")
+}
@@ -0,0 +1,72 @@
+// Package secretbox encrypts secrets stored in the database, such as DKIM
+// private keys, with AES-256-GCM.
+package secretbox
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// KeySize is the length of an encryption key.
+const KeySize = 32
+
+var ErrDecrypt = errors.New("secretbox: message authentication failed")
+
+// Box seals and opens secrets with one key.
+type Box struct {
+	aead cipher.AEAD
+}
+
+// New returns a Box using a KeySize-byte key.
+func New(key []byte) (*Box, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("secretbox: key must be %d bytes, got %d", KeySize, len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Box{aead: aead}, nil
+}
+
+// NewFromBase64 returns a Box using a base64-encoded key, as found in
+// configuration files.
+func NewFromBase64(key string) (*Box, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("secretbox: decode key: %w", err)
+	}
+	return New(raw)
+}
+
+// Seal encrypts plaintext. The result carries its random nonce. Data that
+// is not secret but must not be swapped, such as the row a secret belongs
+// to, can be bound to it as additional data.
+func (b *Box) Seal(plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, b.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return b.aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+// Open decrypts a message sealed with the same key and additional data.
+func (b *Box) Open(sealed, additional []byte) ([]byte, error) {
+	n := b.aead.NonceSize()
+	if len(sealed) < n {
+		return nil, ErrDecrypt
+	}
+	plaintext, err := b.aead.Open(nil, sealed[:n], sealed[n:], additional)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
@@ -0,0 +1,49 @@
+package secretbox_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/secretbox"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBox(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, secretbox.KeySize)
+	box, err := secretbox.New(key)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	sealed, err := box.Seal([]byte("private key"), []byte("row-1"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.NotContains(t, string(sealed), "private key")
+	again, _ := box.Seal([]byte("private key"), []byte("row-1"))
+	assert.NotEqual(t, sealed, again, "nonces are random")
+
+	opened, err := box.Open(sealed, []byte("row-1"))
+	assert.NoError(t, err)
+	assert.Equal(t, "private key", string(opened))
+
+	_, err = box.Open(sealed, []byte("row-2"))
+	assert.Equal(t, secretbox.ErrDecrypt, err)
+	sealed[len(sealed)-1] ^= 1
+	_, err = box.Open(sealed, []byte("row-1"))
+	assert.Equal(t, secretbox.ErrDecrypt, err)
+	_, err = box.Open([]byte("short"), nil)
+	assert.Equal(t, secretbox.ErrDecrypt, err)
+
+	other, _ := secretbox.NewFromBase64(base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{8}, secretbox.KeySize)))
+	_, err = other.Open(again, []byte("row-1"))
+	assert.Equal(t, secretbox.ErrDecrypt, err)
+}
+
+func TestNew_KeySize(t *testing.T) {
+	_, err := secretbox.New([]byte("short"))
+	assert.Error(t, err)
+	_, err = secretbox.NewFromBase64("not base64!")
+	assert.Error(t, err)
+}
@@ -2,16 +2,33 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/blobstore"
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
 	"github.com/SinaHo/email-marketing-backend/internal/config"
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/domaincheck"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
 	"github.com/SinaHo/email-marketing-backend/internal/handler"
+	"github.com/SinaHo/email-marketing-backend/internal/inbound"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
 	"github.com/SinaHo/email-marketing-backend/internal/middleware"
+	"github.com/SinaHo/email-marketing-backend/internal/queue"
+	"github.com/SinaHo/email-marketing-backend/internal/ratelimit"
 	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/secretbox"
 	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	"go.uber.org/zap"
@@ -21,24 +38,36 @@ import (
 	_ "github.com/lib/pq"
 )
 
+// publicMethods can be called without a JWT.
+var publicMethods = []string{
+	"/proto.Authentication/Register",
+	"/proto.Authentication/Login",
+	"/proto.SubscriptionService/Subscribe",
+	"/proto.SubscriptionService/ConfirmSubscription",
+	"/proto.TestRecipientService/VerifyTestRecipient",
+	"/proto.PreferenceService/GetPreferences",
+	"/proto.PreferenceService/UpdatePreferences",
+}
+
 type AppServer struct {
 	cfg    *config.Config
 	logger *zap.Logger
 	db     *sqlx.DB
 	rdb    *redis.Client
 	GRPC   *grpc.Server
+	// HTTP serves the public endpoints emails link to.
+	HTTP *http.Server
+	// sender is nil when emails are only logged.
+	sender delivery.Sender
+	// stop ends the background work of the server.
+	stop context.CancelFunc
 }
 
 func NewAppServer(cfg *config.Config, logger *zap.Logger) (*AppServer, error) {
 	sugar := logger.Sugar()
 
 	// PostgreSQL (via sqlx)
-	pg := cfg.Postgres
-	dsn := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		pg.Host, pg.Port, pg.User, pg.Password, pg.DBName, pg.SSLMode,
-	)
-	db, err := sqlx.Connect("postgres", dsn)
+	db, err := OpenPostgres(cfg.Postgres)
 	if err != nil {
 		sugar.Errorf("failed to connect to postgres: %v", err)
 		return nil, fmt.Errorf("postgres connect: %w", err)
@@ -56,32 +85,495 @@ func NewAppServer(cfg *config.Config, logger *zap.Logger) (*AppServer, error) {
 	// 	return nil, fmt.Errorf("redis ping: %w", err)
 	// }
 
+	// Client addresses for consent records, through the trusted proxies.
+	proxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		sugar.Errorf("failed to parse trusted proxies: %v", err)
+		return nil, fmt.Errorf("server.trusted_proxies: %w", err)
+	}
+	clientIPInt := middleware.ClientIPInterceptor(proxies)
+
 	// Logging interceptor & Auth interceptor
-	authInt := middleware.AuthInterceptor(sugar, cfg.JWT.SigningKey)
+	authInt := middleware.AuthInterceptor(sugar, cfg.JWT.SigningKey, publicMethods...)
 	logInt := middleware.UnaryLoggingInterceptor(sugar)
+	streamAuthInt := middleware.StreamAuthInterceptor(sugar, cfg.JWT.SigningKey)
 
 	grpcServer := grpc.NewServer(
-		grpc.ChainUnaryInterceptor(logInt, authInt),
+		grpc.ChainUnaryInterceptor(logInt, clientIPInt, authInt),
+		grpc.ChainStreamInterceptor(streamAuthInt),
 	)
 
+	// Email validation policies: accounts only reject throwaway domains,
+	// contacts also reject role addresses.
+	accountEmails, contactEmails, err := newEmailValidators(cfg.EmailValidation)
+	if err != nil {
+		sugar.Errorf("failed to load email validation lists: %v", err)
+		return nil, fmt.Errorf("email validation: %w", err)
+	}
+
 	// Repository → Service → Handler
 	userRepo := repository.NewUserRepository(db)
-	userSvc := service.NewAuthService(userRepo, []byte(cfg.JWT.SigningKey), 1*time.Hour)
+	userSvc := service.NewAuthService(userRepo, accountEmails, []byte(cfg.JWT.SigningKey), 1*time.Hour)
 	userHandler := handler.NewAuthHandler(userSvc)
 
+	contactRepo := repository.NewContactRepository(db)
+	exportJobRepo := repository.NewExportJobRepository(db)
+	exportSvc := service.NewContactExportService(contactRepo, exportJobRepo, cfg.Export.Dir, cfg.Export.Retention, sugar)
+	if err := exportSvc.FailStaleExports(context.Background()); err != nil {
+		sugar.Errorf("failed to clean up interrupted export jobs: %v", err)
+	}
+	contactHandler := handler.NewContactHandler(exportSvc)
+
+	suppressionRepo := repository.NewSuppressionRepository(db)
+	suppressionSvc := service.NewSuppressionService(suppressionRepo)
+	suppressionHandler := handler.NewSuppressionHandler(suppressionSvc)
+
+	tagRepo := repository.NewTagRepository(db)
+	tagSvc := service.NewTagService(tagRepo, contactRepo)
+	tagHandler := handler.NewTagHandler(tagSvc)
+
+	linkSigner := signedlink.New([]byte(cfg.Public.LinkSigningKey))
+	sender, err := NewSender(cfg.Delivery)
+	if err != nil {
+		sugar.Errorf("failed to configure delivery: %v", err)
+		return nil, fmt.Errorf("delivery: %w", err)
+	}
+	box, err := NewSecretBox(cfg.DKIM)
+	if err != nil {
+		sugar.Errorf("failed to configure DKIM: %v", err)
+		return nil, fmt.Errorf("dkim: %w", err)
+	}
+	sendingDomainRepo := repository.NewSendingDomainRepository(db)
+	var campaignDomains repository.SendingDomainRepository
+	if !cfg.SendingDomains.AllowUnverified {
+		campaignDomains = sendingDomainRepo
+	}
+	mailer := service.NewLogMailer(sugar)
+	// Template tests are only logged too when no sender is configured.
+	var testSender service.TestSender
+	if sender != nil {
+		from := mail.Address{Name: cfg.Delivery.FromName, Email: cfg.Delivery.FromEmail}
+		mailer = service.NewDeliveryMailer(sender, from)
+		var signer service.MessageSigner
+		if box != nil {
+			signer = service.NewMessageSigner(sendingDomainRepo, box)
+		}
+		testSender = service.NewTestSender(campaignDomains, signer, NewVERP(cfg), sender, from)
+	}
+
+	testRecipientRepo := repository.NewTestRecipientRepository(db)
+	testRecipientSvc := service.NewTestRecipientService(testRecipientRepo, accountEmails, mailer, linkSigner, cfg.Public.BaseURL)
+	testRecipientHandler := handler.NewTestRecipientHandler(testRecipientSvc)
+
+	blockRepo := repository.NewContentBlockRepository(db)
+	blockSvc := service.NewContentBlockService(blockRepo)
+	blockHandler := handler.NewContentBlockHandler(blockSvc)
+
+	templateRepo := repository.NewTemplateRepository(db)
+	templateSvc := service.NewTemplateService(templateRepo, blockRepo, contactRepo, testRecipientRepo, mailer, testSender)
+	templateHandler := handler.NewTemplateHandler(templateSvc)
+
+	campaignRepo := repository.NewCampaignRepository(db)
+	campaignSvc := service.NewCampaignService(campaignRepo, templateRepo, blockRepo, contactRepo, repository.NewSendJobRepository(db), campaignDomains, accountEmails)
+	campaignHandler := handler.NewCampaignHandler(campaignSvc)
+
+	// Assets are only stored and served when a directory is configured.
+	var assetStore blobstore.Store
+	var assetFiles http.Handler
+	if cfg.Assets.Dir != "" {
+		assetsURL := cfg.Assets.PublicURL
+		if assetsURL == "" {
+			assetsURL = strings.TrimRight(cfg.Public.BaseURL, "/") + "/assets"
+		}
+		local, err := blobstore.NewLocal(cfg.Assets.Dir, assetsURL)
+		if err != nil {
+			sugar.Errorf("failed to open asset store: %v", err)
+			return nil, fmt.Errorf("asset store: %w", err)
+		}
+		assetStore, assetFiles = local, local.Handler()
+	}
+	assetRepo := repository.NewAssetRepository(db)
+	assetSvc := service.NewAssetService(assetRepo, assetStore, cfg.Assets.MaxSizeBytes)
+	assetHandler := handler.NewAssetHandler(assetSvc)
+
+	consentRepo := repository.NewConsentRepository(db)
+	subscriptionSvc := service.NewSubscriptionService(contactRepo, consentRepo, suppressionSvc, contactEmails, mailer, linkSigner, cfg.Public.BaseURL)
+	subscriptionHandler := handler.NewSubscriptionHandler(subscriptionSvc)
+
+	sendingDomainSvc := service.NewSendingDomainService(
+		sendingDomainRepo,
+		NewDomainVerifier(cfg.SendingDomains, sendingDomainRepo, campaignRepo),
+		box,
+		cfg.DKIM.Selector,
+		dkim.Algorithm(cfg.DKIM.Algorithm),
+		cfg.SendingDomains.SPFInclude,
+	)
+	sendingDomainHandler := handler.NewSendingDomainHandler(sendingDomainSvc)
+
+	replySvc := service.NewReplyService(repository.NewReplyRepository(db))
+	replyHandler := handler.NewReplyHandler(replySvc)
+
+	unsubscribeSvc := service.NewUnsubscribeService(contactRepo, suppressionRepo, consentRepo, linkSigner, cfg.Public.BaseURL)
+	preferenceSvc := service.NewPreferenceService(contactRepo, suppressionRepo, consentRepo, linkSigner, cfg.Public.BaseURL)
+	preferenceHandler := handler.NewPreferenceHandler(preferenceSvc)
+
 	proto.RegisterAuthenticationServer(grpcServer, userHandler)
+	proto.RegisterContactServiceServer(grpcServer, contactHandler)
+	proto.RegisterSuppressionServiceServer(grpcServer, suppressionHandler)
+	proto.RegisterSubscriptionServiceServer(grpcServer, subscriptionHandler)
+	proto.RegisterTagServiceServer(grpcServer, tagHandler)
+	proto.RegisterTemplateServiceServer(grpcServer, templateHandler)
+	proto.RegisterTestRecipientServiceServer(grpcServer, testRecipientHandler)
+	proto.RegisterContentBlockServiceServer(grpcServer, blockHandler)
+	proto.RegisterAssetServiceServer(grpcServer, assetHandler)
+	proto.RegisterCampaignServiceServer(grpcServer, campaignHandler)
+	proto.RegisterSendingDomainServiceServer(grpcServer, sendingDomainHandler)
+	proto.RegisterReplyServiceServer(grpcServer, replyHandler)
+	proto.RegisterPreferenceServiceServer(grpcServer, preferenceHandler)
 	reflection.Register(grpcServer)
 
+	mux := http.NewServeMux()
+	if assetFiles != nil {
+		mux.Handle("/assets/", http.StripPrefix("/assets", assetFiles))
+	}
+	mux.Handle("/subscribe/confirm", handler.NewSubscriptionConfirmPage(subscriptionSvc))
+	mux.Handle("/test-recipients/verify", handler.NewTestRecipientVerifyPage(testRecipientSvc))
+	mux.Handle("/unsubscribe", handler.NewUnsubscribePage(unsubscribeSvc))
+	mux.Handle("/preferences", handler.NewPreferencePage(preferenceSvc))
+	trackingSvc := NewTrackingService(cfg, db, sugar)
+	mux.Handle("/track/open", handler.NewOpenPixel(trackingSvc))
+	mux.Handle("/track/click", handler.NewClickRedirect(trackingSvc))
+	httpServer := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Server.HTTPPort),
+		Handler:           middleware.ClientIPHandler(proxies, mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	background, stop := context.WithCancel(context.Background())
+	go purgeExports(background, exportSvc, sugar)
+
 	sugar.Infof("AppServer initialized successfully")
 	return &AppServer{
 		cfg:    cfg,
 		logger: logger,
 		db:     db,
 		// rdb:    rdb,
-		GRPC: grpcServer,
+		GRPC:   grpcServer,
+		HTTP:   httpServer,
+		sender: sender,
+		stop:   stop,
 	}, nil
 }
 
+// exportPurgeInterval is how often expired export files are deleted.
+const exportPurgeInterval = time.Hour
+
+// purgeExports deletes expired export files now and every
+// exportPurgeInterval until ctx is done.
+func purgeExports(ctx context.Context, svc service.ContactExportService, logger *zap.SugaredLogger) {
+	t := time.NewTicker(exportPurgeInterval)
+	defer t.Stop()
+	for {
+		if err := svc.PurgeExports(ctx); err != nil && ctx.Err() == nil {
+			logger.Errorf("failed to purge export files: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// NewSender returns the configured delivery provider, or nil if emails
+// should only be logged.
+func NewSender(cfg config.DeliveryConfig) (delivery.Sender, error) {
+	if cfg.Provider != "" && !strings.Contains(cfg.FromEmail, "@") {
+		return nil, errors.New("delivery.from_email is required")
+	}
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "smtp":
+		return delivery.NewSMTP(delivery.SMTPOptions{
+			Host:      cfg.SMTP.Host,
+			Port:      cfg.SMTP.Port,
+			TLS:       delivery.TLSMode(cfg.SMTP.TLS),
+			Username:  cfg.SMTP.Username,
+			Password:  cfg.SMTP.Password,
+			LocalName: cfg.SMTP.LocalName,
+			MaxConns:  cfg.SMTP.MaxConns,
+		}), nil
+	case "file":
+		return delivery.NewFileSink(cfg.Dir)
+	case "maildir":
+		return delivery.NewMaildir(cfg.Dir)
+	}
+	return nil, fmt.Errorf("unknown provider %q", cfg.Provider)
+}
+
+// NewQueue returns the configured send queue. rdb is only used by the
+// redis backend.
+func NewQueue(ctx context.Context, cfg config.QueueConfig, db *sqlx.DB, rdb *redis.Client) (queue.Queue, error) {
+	jobs := repository.NewSendJobRepository(db)
+	switch cfg.Backend {
+	case "", "postgres":
+		return queue.NewPostgres(jobs, cfg.VisibilityTimeout), nil
+	case "redis":
+		return queue.NewRedis(ctx, rdb, jobs, queue.RedisOptions{Visibility: cfg.VisibilityTimeout})
+	}
+	return nil, fmt.Errorf("unknown queue backend %q", cfg.Backend)
+}
+
+// NewSecretBox returns the box DKIM keys are encrypted with, or nil if no
+// encryption key is configured.
+func NewSecretBox(cfg config.DKIMConfig) (*secretbox.Box, error) {
+	switch dkim.Algorithm(cfg.Algorithm) {
+	case "", dkim.RSASHA256, dkim.Ed25519SHA256:
+	default:
+		return nil, fmt.Errorf("unknown DKIM algorithm %q", cfg.Algorithm)
+	}
+	if cfg.EncryptionKey == "" {
+		return nil, nil
+	}
+	return secretbox.NewFromBase64(cfg.EncryptionKey)
+}
+
+// NewDomainVerifier returns the verifier of sending domain DNS records,
+// querying the system resolver. Failing domains pause their campaigns
+// unless unverified domains are allowed.
+func NewDomainVerifier(cfg config.SendingDomainsConfig, domains repository.SendingDomainRepository, campaigns repository.CampaignRepository) service.DomainVerifier {
+	if cfg.AllowUnverified {
+		campaigns = nil
+	}
+	return service.NewDomainVerifier(
+		domains,
+		campaigns,
+		domaincheck.New(net.DefaultResolver, cfg.SPFInclude),
+		service.DomainVerifierOptions{
+			RecheckInterval:           cfg.RecheckInterval,
+			UnverifiedRecheckInterval: cfg.UnverifiedRecheckInterval,
+		},
+	)
+}
+
+// minLinkSigningKey is the least number of bytes public.link_signing_key
+// must have. The key signs every public link and the VERP tags of return
+// paths, so a guessable one lets anyone confirm, unsubscribe or bounce
+// addresses they do not own.
+const minLinkSigningKey = 32
+
+// CheckLinkSigningKey reports whether the link signing key is long enough
+// and not an obvious placeholder. Run it before serving anything signed
+// with the key.
+func CheckLinkSigningKey(cfg config.PublicConfig) error {
+	key := cfg.LinkSigningKey
+	if len(key) < minLinkSigningKey {
+		return fmt.Errorf("public.link_signing_key must be at least %d random bytes, for example from \"openssl rand -base64 %d\"", minLinkSigningKey, minLinkSigningKey)
+	}
+	// Random keys of this length use many different bytes; repeated
+	// words and characters do not.
+	distinct := make(map[byte]bool)
+	for i := 0; i < len(key); i++ {
+		distinct[key[i]] = true
+	}
+	if len(distinct) < minLinkSigningKey/2 {
+		return fmt.Errorf("public.link_signing_key does not look random")
+	}
+	return nil
+}
+
+// NewVERP returns the tagger of campaign emails that lets bounces be
+// traced to their send job.
+func NewVERP(cfg *config.Config) *bounce.VERP {
+	return bounce.NewVERP([]byte(cfg.Public.LinkSigningKey), cfg.Bounces.ReturnPath)
+}
+
+// NewReplyVERP returns the tagger of the Reply-To address of campaign
+// emails, which lets replies be traced to their send job.
+func NewReplyVERP(cfg *config.Config) *bounce.VERP {
+	return bounce.NewVERP([]byte(cfg.Public.LinkSigningKey), cfg.Inbound.ReplyAddress)
+}
+
+// NewUnsubscribeService returns the service behind the unsubscribe links
+// of campaign emails.
+func NewUnsubscribeService(cfg *config.Config, db *sqlx.DB) service.UnsubscribeService {
+	return service.NewUnsubscribeService(
+		repository.NewContactRepository(db),
+		repository.NewSuppressionRepository(db),
+		repository.NewConsentRepository(db),
+		signedlink.New([]byte(cfg.Public.LinkSigningKey)),
+		cfg.Public.BaseURL,
+	)
+}
+
+// NewPreferenceService returns the service behind the preference center
+// links of campaign emails.
+func NewPreferenceService(cfg *config.Config, db *sqlx.DB) service.PreferenceService {
+	return service.NewPreferenceService(
+		repository.NewContactRepository(db),
+		repository.NewSuppressionRepository(db),
+		repository.NewConsentRepository(db),
+		signedlink.New([]byte(cfg.Public.LinkSigningKey)),
+		cfg.Public.BaseURL,
+	)
+}
+
+// NewTrackingService returns the service behind the open pixel and tracked
+// links of campaign emails.
+func NewTrackingService(cfg *config.Config, db *sqlx.DB, logger *zap.SugaredLogger) service.TrackingService {
+	return service.NewTrackingService(
+		repository.NewTrackingRepository(db),
+		signedlink.New([]byte(cfg.Public.LinkSigningKey)),
+		cfg.Public.BaseURL,
+		service.TrackingOptions{Opens: cfg.Tracking.Opens, Clicks: cfg.Tracking.Clicks},
+		logger,
+	)
+}
+
+// NewBounceProcessor returns the configured bounce processor.
+func NewBounceProcessor(cfg *config.Config, db *sqlx.DB) service.BounceProcessor {
+	return service.NewBounceProcessor(
+		repository.NewSendJobRepository(db),
+		repository.NewBounceRepository(db),
+		repository.NewSuppressionRepository(db),
+		repository.NewContactRepository(db),
+		NewVERP(cfg),
+		service.BounceOptions{SoftLimit: cfg.Bounces.SoftLimit, SoftWindow: cfg.Bounces.SoftWindow},
+	)
+}
+
+// NewInboundMail returns the router of the mail the inbound SMTP server
+// receives.
+func NewInboundMail(cfg *config.Config, db *sqlx.DB, logger *zap.SugaredLogger) service.InboundMail {
+	return service.NewInboundMail(
+		NewBounceProcessor(cfg, db),
+		repository.NewSendJobRepository(db),
+		repository.NewSuppressionRepository(db),
+		repository.NewContactRepository(db),
+		repository.NewReplyRepository(db),
+		NewVERP(cfg),
+		logger,
+	)
+}
+
+// NewInboundServer returns the inbound SMTP server, accepting mail for the
+// domains of the bounces return path and reply address and the configured
+// extra domains.
+func NewInboundServer(cfg *config.Config, h inbound.Handler, logger *zap.SugaredLogger) (*inbound.Server, error) {
+	var domains []string
+	for _, addr := range []string{cfg.Bounces.ReturnPath, cfg.Inbound.ReplyAddress} {
+		if at := strings.LastIndexByte(addr, '@'); at >= 0 {
+			domains = append(domains, addr[at+1:])
+		}
+	}
+	domains = append(domains, cfg.Inbound.Domains...)
+	if len(domains) == 0 {
+		return nil, errors.New("inbound: no domains to accept mail for")
+	}
+	opts := inbound.Options{
+		Hostname:        cfg.Inbound.Hostname,
+		Domains:         domains,
+		MaxMessageBytes: cfg.Inbound.MaxMessageBytes,
+		MaxConns:        cfg.Inbound.MaxConnections,
+		MaxConnsPerIP:   cfg.Inbound.MaxConnectionsPerIP,
+	}
+	if cfg.Inbound.TLSCertFile != "" && cfg.Inbound.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Inbound.TLSCertFile, cfg.Inbound.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("inbound tls: %w", err)
+		}
+		opts.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	return inbound.New(h, opts, logger), nil
+}
+
+// NewRateLimiter returns the configured rate limiter. rdb is only used by
+// the redis backend.
+func NewRateLimiter(cfg config.RateLimitConfig, rdb *redis.Client) (ratelimit.Limiter, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return ratelimit.NewMemory(), nil
+	case "redis":
+		return ratelimit.NewRedis(rdb, ""), nil
+	}
+	return nil, fmt.Errorf("unknown rate limit backend %q", cfg.Backend)
+}
+
+// RateLimitPolicy returns the configured send rates. The provider bucket is
+// named after the SMTP relay, or the provider when it has none.
+func RateLimitPolicy(cfg *config.Config) ratelimit.Policy {
+	rate := func(r config.RateConfig) ratelimit.Rate {
+		return ratelimit.Rate{PerSecond: r.PerSecond, Burst: r.Burst}
+	}
+	p := ratelimit.Policy{
+		Domain:       rate(cfg.RateLimit.Domain),
+		ProviderName: cfg.Delivery.Provider,
+		Provider:     rate(cfg.RateLimit.Provider),
+		Account:      rate(cfg.RateLimit.Account),
+	}
+	if cfg.Delivery.Provider == "smtp" {
+		p.ProviderName = cfg.Delivery.SMTP.Host
+	}
+	for _, d := range cfg.RateLimit.Domains {
+		p.Domains = append(p.Domains, ratelimit.DomainRate{Domain: d.Domain, Rate: rate(d.RateConfig)})
+	}
+	return p
+}
+
+// OpenRedis connects to the configured Redis server.
+func OpenRedis(ctx context.Context, cfg config.RedisConfig) (*redis.Client, error) {
+	rdb := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("redis ping: %w", err)
+	}
+	return rdb, nil
+}
+
+// OpenPostgres connects to the configured database.
+func OpenPostgres(pg config.PostgresConfig) (*sqlx.DB, error) {
+	dsn := fmt.Sprintf(
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		pg.Host, pg.Port, pg.User, pg.Password, pg.DBName, pg.SSLMode,
+	)
+	return sqlx.Connect("postgres", dsn)
+}
+
+func newEmailValidators(cfg config.EmailValidationConfig) (account, contact *emailvalidation.Validator, err error) {
+	disposable := emailvalidation.DefaultDisposableDomains()
+	if cfg.DisposableDomainsFile != "" {
+		if disposable, err = emailvalidation.LoadSet(cfg.DisposableDomainsFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	roles := emailvalidation.DefaultRoleAddresses()
+	if cfg.RoleAddressesFile != "" {
+		if roles, err = emailvalidation.LoadSet(cfg.RoleAddressesFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	var resolver emailvalidation.Resolver
+	if cfg.CheckMX {
+		resolver = net.DefaultResolver
+	}
+
+	account = emailvalidation.New(emailvalidation.Options{
+		DisposableDomains: disposable,
+		Resolver:          resolver,
+	})
+	contact = emailvalidation.New(emailvalidation.Options{
+		DisposableDomains: disposable,
+		RoleAddresses:     roles,
+		Resolver:          resolver,
+	})
+	return account, contact, nil
+}
+
 func (a *AppServer) Run() error {
 	sugar := a.logger.Sugar()
 	addr := fmt.Sprintf(":%d", a.cfg.Server.Port)
@@ -94,10 +586,32 @@ func (a *AppServer) Run() error {
 	return a.GRPC.Serve(lis)
 }
 
+// RunHTTP serves the public HTTP endpoints. It returns nil without serving
+// when no HTTP port is configured.
+func (a *AppServer) RunHTTP() error {
+	if a.cfg.Server.HTTPPort == 0 {
+		return nil
+	}
+	a.logger.Sugar().Infof("HTTP server listening on %s", a.HTTP.Addr)
+	if err := a.HTTP.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("http serve: %w", err)
+	}
+	return nil
+}
+
 func (a *AppServer) GracefulStop() {
 	sugar := a.logger.Sugar()
 	sugar.Info("Shutting down gRPC server gracefully")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.HTTP.Shutdown(ctx); err != nil {
+		sugar.Errorf("http shutdown: %v", err)
+	}
 	a.GRPC.GracefulStop()
+	a.stop()
+	if a.sender != nil {
+		a.sender.Close()
+	}
 	a.db.Close()
 	a.rdb.Close()
 	sugar.Info("Resources closed, server stopped")
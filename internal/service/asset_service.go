@@ -0,0 +1,216 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/asset"
+	"github.com/SinaHo/email-marketing-backend/internal/blobstore"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// DefaultMaxAssetSize applies when no limit is configured. Large images
+	// slow down email rendering and get clipped by some clients.
+	DefaultMaxAssetSize = 5 << 20
+	maxFilenameLength   = 255
+)
+
+// AssetService manages the images workspaces upload for their emails.
+type AssetService interface {
+	// UploadAsset stores the image read from r.
+	UploadAsset(ctx context.Context, workspaceID uuid.UUID, meta *proto.UploadAssetMetadata, r io.Reader) (*proto.Asset, error)
+	ListAssets(ctx context.Context, workspaceID uuid.UUID, in *proto.ListAssetsRequest) (*proto.ListAssetsResponse, error)
+	GetAsset(ctx context.Context, workspaceID uuid.UUID, in *proto.GetAssetRequest) (*proto.Asset, error)
+	DeleteAsset(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteAssetRequest) (*proto.DeleteAssetResponse, error)
+}
+
+type assetService struct {
+	repo    repository.AssetRepository
+	store   blobstore.Store
+	maxSize int64
+}
+
+// NewAssetService constructs a new AssetService keeping content in store.
+// Uploads larger than maxSize bytes are rejected; zero selects
+// DefaultMaxAssetSize. A nil store disables assets: every call fails with
+// FAILED_PRECONDITION.
+func NewAssetService(repo repository.AssetRepository, store blobstore.Store, maxSize int64) AssetService {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxAssetSize
+	}
+	return &assetService{repo: repo, store: store, maxSize: maxSize}
+}
+
+func (s *assetService) UploadAsset(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	meta *proto.UploadAssetMetadata,
+	r io.Reader,
+) (*proto.Asset, error) {
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, status.Errorf(codes.InvalidArgument, "asset exceeds %d bytes", s.maxSize)
+	}
+	if len(data) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "asset is empty")
+	}
+	info, err := asset.Inspect(data)
+	if errors.Is(err, asset.ErrUnsupportedType) {
+		return nil, status.Error(codes.InvalidArgument, "asset must be a PNG, JPEG, GIF or WebP image")
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	a := &model.Asset{
+		ID:          uuid.New(),
+		WorkspaceID: workspaceID,
+		Filename:    assetFilename(meta.GetFilename(), info.Ext),
+		ContentType: info.ContentType,
+		Size:        int64(len(data)),
+		Width:       info.Width,
+		Height:      info.Height,
+		SHA256:      hash,
+		StorageKey:  workspaceID.String() + "/" + hash + info.Ext,
+		CreatedAt:   time.Now().UTC(),
+	}
+	// The key is derived from the content, so storing before the row exists
+	// is idempotent and a failed insert only leaves an unreferenced blob.
+	if err := s.store.Put(ctx, a.StorageKey, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("store asset: %w", err)
+	}
+	out, err := s.repo.Create(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	return s.toProto(out), nil
+}
+
+func (s *assetService) ListAssets(ctx context.Context, workspaceID uuid.UUID, in *proto.ListAssetsRequest) (*proto.ListAssetsResponse, error) {
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	limit, offset := pagination(in.PageSize, in.PageNumber)
+	items, err := s.repo.List(ctx, workspaceID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListAssetsResponse{Assets: make([]*proto.Asset, 0, len(items))}
+	for _, a := range items {
+		out.Assets = append(out.Assets, s.toProto(a))
+	}
+	return out, nil
+}
+
+func (s *assetService) GetAsset(ctx context.Context, workspaceID uuid.UUID, in *proto.GetAssetRequest) (*proto.Asset, error) {
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	id, err := parseAssetID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.repo.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return nil, status.Error(codes.NotFound, "asset not found")
+	}
+	return s.toProto(a), nil
+}
+
+func (s *assetService) DeleteAsset(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteAssetRequest) (*proto.DeleteAssetResponse, error) {
+	if err := s.configured(); err != nil {
+		return nil, err
+	}
+	id, err := parseAssetID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	a, err := s.repo.Delete(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if a == nil {
+		return &proto.DeleteAssetResponse{Deleted: false}, nil
+	}
+	if err := s.store.Delete(ctx, a.StorageKey); err != nil {
+		return nil, fmt.Errorf("delete asset content: %w", err)
+	}
+	return &proto.DeleteAssetResponse{Deleted: true}, nil
+}
+
+func (s *assetService) configured() error {
+	if s.store == nil {
+		return status.Error(codes.FailedPrecondition, "asset storage is not configured")
+	}
+	return nil
+}
+
+func (s *assetService) toProto(a *model.Asset) *proto.Asset {
+	return &proto.Asset{
+		Id:          a.ID.String(),
+		Filename:    a.Filename,
+		ContentType: a.ContentType,
+		SizeBytes:   a.Size,
+		Width:       int32(a.Width),
+		Height:      int32(a.Height),
+		Sha256:      a.SHA256,
+		Url:         s.store.URL(a.StorageKey),
+		CreatedAt:   timestamppb.New(a.CreatedAt),
+	}
+}
+
+// assetFilename keeps the base name the client sent, for display only,
+// with the extension of the sniffed type.
+func assetFilename(name, ext string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if name == "" || name == "." || name == "/" || !utf8.ValidString(name) {
+		name = "image"
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, name)
+	for len(name)+len(ext) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name + ext
+}
+
+func parseAssetID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid asset id")
+	}
+	return id, nil
+}
@@ -0,0 +1,124 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/blobstore"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeAssetRepo is an in-memory repository.AssetRepository
+type fakeAssetRepo struct {
+	assets map[uuid.UUID]*model.Asset
+}
+
+func (f *fakeAssetRepo) Create(ctx context.Context, a *model.Asset) (*model.Asset, error) {
+	for _, existing := range f.assets {
+		if existing.WorkspaceID == a.WorkspaceID && existing.SHA256 == a.SHA256 {
+			return existing, nil
+		}
+	}
+	f.assets[a.ID] = a
+	return a, nil
+}
+func (f *fakeAssetRepo) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error) {
+	a := f.assets[id]
+	if a == nil || a.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	return a, nil
+}
+func (f *fakeAssetRepo) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Asset, error) {
+	return nil, nil
+}
+func (f *fakeAssetRepo) Delete(ctx context.Context, workspaceID, id uuid.UUID) (*model.Asset, error) {
+	a, _ := f.Get(ctx, workspaceID, id)
+	delete(f.assets, id)
+	return a, nil
+}
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestAssetService_Upload(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	store, err := blobstore.NewLocal(t.TempDir(), "https://cdn.example.com/assets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	svc := service.NewAssetService(&fakeAssetRepo{assets: map[uuid.UUID]*model.Asset{}}, store, 0)
+
+	logo := pngBytes(t, 200, 50)
+	a, err := svc.UploadAsset(ctx, workspace, &proto.UploadAssetMetadata{Filename: `C:\brand\logo.JPG`}, bytes.NewReader(logo))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "logo.png", a.Filename)
+	assert.Equal(t, "image/png", a.ContentType)
+	assert.Equal(t, int64(len(logo)), a.SizeBytes)
+	assert.Equal(t, int32(200), a.Width)
+	assert.Equal(t, int32(50), a.Height)
+	assert.Equal(t, "https://cdn.example.com/assets/"+workspace.String()+"/"+a.Sha256+".png", a.Url)
+
+	// The same content is stored once.
+	again, err := svc.UploadAsset(ctx, workspace, &proto.UploadAssetMetadata{Filename: "copy.png"}, bytes.NewReader(logo))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, a.Id, again.Id)
+
+	res, err := svc.DeleteAsset(ctx, workspace, &proto.DeleteAssetRequest{Id: a.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, res.Deleted)
+	_, err = store.Open(ctx, workspace.String()+"/"+a.Sha256+".png")
+	assert.ErrorIs(t, err, blobstore.ErrNotFound)
+}
+
+func TestAssetService_Rejects(t *testing.T) {
+	ctx := context.Background()
+	store, err := blobstore.NewLocal(t.TempDir(), "/assets")
+	if !assert.NoError(t, err) {
+		return
+	}
+	svc := service.NewAssetService(&fakeAssetRepo{assets: map[uuid.UUID]*model.Asset{}}, store, 1024)
+
+	cases := map[string][]byte{
+		"too large": pngBytes(t, 400, 400),
+		"svg":       []byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`),
+		"html":      []byte(strings.Repeat("<p>x</p>", 10)),
+		"empty":     nil,
+	}
+	for name, data := range cases {
+		_, err := svc.UploadAsset(ctx, uuid.New(), &proto.UploadAssetMetadata{Filename: "x.png"}, bytes.NewReader(data))
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), name)
+	}
+}
+
+func TestAssetService_NotConfigured(t *testing.T) {
+	ctx := context.Background()
+	svc := service.NewAssetService(&fakeAssetRepo{assets: map[uuid.UUID]*model.Asset{}}, nil, 0)
+
+	_, err := svc.UploadAsset(ctx, uuid.New(), &proto.UploadAssetMetadata{Filename: "x.png"}, bytes.NewReader(pngBytes(t, 1, 1)))
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	_, err = svc.ListAssets(ctx, uuid.New(), &proto.ListAssetsRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
 	"github.com/SinaHo/email-marketing-backend/internal/model"
 	"github.com/SinaHo/email-marketing-backend/internal/repository"
 	"github.com/golang-jwt/jwt/v5"
@@ -20,14 +21,16 @@ type AuthService interface {
 
 type authService struct {
 	repo        repository.UserRepository
+	emails      EmailValidator
 	jwtSecret   []byte
 	tokenExpiry time.Duration
 }
 
 // NewAuthService constructs a new AuthService.
-func NewAuthService(repo repository.UserRepository, jwtSecret []byte, tokenExpiry time.Duration) AuthService {
+func NewAuthService(repo repository.UserRepository, emails EmailValidator, jwtSecret []byte, tokenExpiry time.Duration) AuthService {
 	return &authService{
 		repo:        repo,
+		emails:      emails,
 		jwtSecret:   jwtSecret,
 		tokenExpiry: tokenExpiry,
 	}
@@ -39,6 +42,10 @@ func (s *authService) Register(ctx context.Context, in *proto.RegisterRequest) (
 	if in.Email == "" || in.Password == "" {
 		return nil, errors.New("email and password are required")
 	}
+	email, err := s.emails.Validate(ctx, in.Email)
+	if err != nil {
+		return nil, emailError(err)
+	}
 
 	// 2. Hash password
 	hashed, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
@@ -58,7 +65,7 @@ func (s *authService) Register(ctx context.Context, in *proto.RegisterRequest) (
 	}
 
 	// 4. Insert into repository
-	u, err := s.repo.Create(ctx, in.Email, string(hashed), lang, in.ReferrerCode)
+	u, err := s.repo.Create(ctx, email, string(hashed), lang, in.ReferrerCode)
 	if err != nil {
 		return nil, err
 	}
@@ -88,11 +95,17 @@ func (s *authService) Login(ctx context.Context, in *proto.LoginRequest) (*proto
 		return nil, errors.New("email and password are required")
 	}
 
-	// 1. Fetch user by email
+	// 1. Fetch user by email. Registration stores normalised addresses;
+	//    accounts created before that are matched on the raw input.
 	u, err := s.repo.GetByEmail(ctx, in.Email)
 	if err != nil {
 		return nil, err
 	}
+	if norm, nerr := emailvalidation.Normalize(in.Email); u == nil && nerr == nil && norm != in.Email {
+		if u, err = s.repo.GetByEmail(ctx, norm); err != nil {
+			return nil, err
+		}
+	}
 	if u == nil {
 		return nil, errors.New("invalid email or password")
 	}
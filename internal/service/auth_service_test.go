@@ -7,11 +7,14 @@ import (
 	"time"
 
 	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
 	"github.com/SinaHo/email-marketing-backend/internal/model"
 	"github.com/SinaHo/email-marketing-backend/internal/service"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // mockUserRepo implements repository.UserRepository for unit testing
@@ -64,7 +67,7 @@ func TestRegister_Success(t *testing.T) {
 		createResult: mockUser,
 		createError:  nil,
 	}
-	authSvc := service.NewAuthService(repo, []byte("test-secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("test-secret"), time.Hour)
 	// 1) Successful register
 	req := &proto.RegisterRequest{
 		Email:        "alice@example.com",
@@ -88,7 +91,7 @@ func TestRegister_Success(t *testing.T) {
 func TestRegister_MissingEmailOrPassword(t *testing.T) {
 	ctx := context.Background()
 	repo := &mockUserRepo{}
-	authSvc := service.NewAuthService(repo, []byte("secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("secret"), time.Hour)
 	// Missing email
 	_, err := authSvc.Register(ctx, &proto.RegisterRequest{
 		Email:        "",
@@ -111,7 +114,7 @@ func TestRegister_RepoError(t *testing.T) {
 	repo := &mockUserRepo{
 		createError: errors.New("something went wrong"),
 	}
-	authSvc := service.NewAuthService(repo, []byte("secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("secret"), time.Hour)
 	_, err := authSvc.Register(ctx, &proto.RegisterRequest{
 		Email:        "charlie@example.com",
 		Password:     "pass",
@@ -138,7 +141,7 @@ func TestLogin_Success(t *testing.T) {
 		getByEmailUser:  existingUser,
 		getByEmailError: nil,
 	}
-	authSvc := service.NewAuthService(repo, []byte("another-secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("another-secret"), time.Hour)
 	req := &proto.LoginRequest{
 		Email:    "dana@example.com",
 		Password: "mysecurepass",
@@ -159,7 +162,7 @@ func TestLogin_UserNotFound(t *testing.T) {
 		getByEmailUser:  nil,
 		getByEmailError: nil,
 	}
-	authSvc := service.NewAuthService(repo, []byte("secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("secret"), time.Hour)
 	_, err := authSvc.Login(ctx, &proto.LoginRequest{
 		Email:    "nonexistent@example.com",
 		Password: "whatever",
@@ -171,10 +174,41 @@ func TestLogin_RepoError(t *testing.T) {
 	repo := &mockUserRepo{
 		getByEmailError: errors.New("db issue"),
 	}
-	authSvc := service.NewAuthService(repo, []byte("secret"), time.Hour)
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("secret"), time.Hour)
 	_, err := authSvc.Login(ctx, &proto.LoginRequest{
 		Email:    "error@example.com",
 		Password: "pass",
 	})
 	assert.Error(t, err)
 }
+
+func TestRegister_InvalidEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockUserRepo{}
+	emails := emailvalidation.New(emailvalidation.Options{
+		DisposableDomains: emailvalidation.DefaultDisposableDomains(),
+	})
+	authSvc := service.NewAuthService(repo, emails, []byte("secret"), time.Hour)
+	for _, email := range []string{"not-an-email", "temp@mailinator.com"} {
+		_, err := authSvc.Register(ctx, &proto.RegisterRequest{
+			Email:    email,
+			Password: "pass",
+		})
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), email)
+	}
+	assert.Empty(t, repo.createdEmail)
+}
+
+func TestRegister_NormalizesEmail(t *testing.T) {
+	ctx := context.Background()
+	repo := &mockUserRepo{
+		createResult: &model.User{ID: uuid.New(), Email: "erin@example.com"},
+	}
+	authSvc := service.NewAuthService(repo, emailvalidation.New(emailvalidation.Options{}), []byte("secret"), time.Hour)
+	_, err := authSvc.Register(ctx, &proto.RegisterRequest{
+		Email:    " Erin@Example.COM",
+		Password: "pass",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "erin@example.com", repo.createdEmail)
+}
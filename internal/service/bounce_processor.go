@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// DefaultSoftBounceLimit is how many soft bounces within the window
+	// suppress an address as if it bounced hard.
+	DefaultSoftBounceLimit = 3
+	// DefaultSoftBounceWindow is the period soft bounces are counted over.
+	DefaultSoftBounceWindow = 30 * 24 * time.Hour
+	// bounceSource is the source of suppressions added for bounces.
+	bounceSource = "bounce"
+)
+
+// BounceProcessor records the bounces of campaign emails and stops sending
+// to addresses that cannot receive mail.
+type BounceProcessor interface {
+	// Process handles one bounce message. rcpt is the envelope recipient
+	// it was delivered to, or "" if unknown. It returns the bounces
+	// recorded, which are none for messages that are not bounces or
+	// cannot be traced to a send job, and for bounces processed before.
+	Process(ctx context.Context, rcpt string, raw []byte) ([]*model.Bounce, error)
+}
+
+// BounceOptions configures a BounceProcessor. Zero values select the
+// defaults.
+type BounceOptions struct {
+	SoftLimit  int
+	SoftWindow time.Duration
+}
+
+type bounceProcessor struct {
+	jobs         repository.SendJobRepository
+	bounces      repository.BounceRepository
+	suppressions repository.SuppressionRepository
+	contacts     repository.ContactRepository
+	verp         *bounce.VERP
+	opts         BounceOptions
+	now          func() time.Time
+}
+
+// NewBounceProcessor returns a BounceProcessor tracing bounces to send
+// jobs by the tags verp put in their return path and Message-ID.
+func NewBounceProcessor(
+	jobs repository.SendJobRepository,
+	bounces repository.BounceRepository,
+	suppressions repository.SuppressionRepository,
+	contacts repository.ContactRepository,
+	verp *bounce.VERP,
+	opts BounceOptions,
+) BounceProcessor {
+	if opts.SoftLimit <= 0 {
+		opts.SoftLimit = DefaultSoftBounceLimit
+	}
+	if opts.SoftWindow <= 0 {
+		opts.SoftWindow = DefaultSoftBounceWindow
+	}
+	return &bounceProcessor{
+		jobs:         jobs,
+		bounces:      bounces,
+		suppressions: suppressions,
+		contacts:     contacts,
+		verp:         verp,
+		opts:         opts,
+		now:          time.Now,
+	}
+}
+
+func (p *bounceProcessor) Process(ctx context.Context, rcpt string, raw []byte) ([]*model.Bounce, error) {
+	report, err := bounce.Parse(raw)
+	if errors.Is(err, bounce.ErrNotBounce) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	job, err := p.job(ctx, rcpt, report)
+	if err != nil || job == nil {
+		return nil, err
+	}
+
+	var out []*model.Bounce
+	for _, r := range report.Recipients {
+		// Our messages have one recipient, but the report may list the
+		// address an alias expanded it to.
+		if len(report.Recipients) > 1 && !strings.EqualFold(r.Email, job.Email) && !strings.EqualFold(r.OriginalEmail, job.Email) {
+			continue
+		}
+		b := &model.Bounce{
+			WorkspaceID: job.WorkspaceID,
+			CampaignID:  job.CampaignID,
+			ContactID:   job.ContactID,
+			SendJobID:   job.ID,
+			Email:       strings.ToLower(job.Email),
+			Kind:        model.BounceKind(r.Kind),
+			Status:      r.Status,
+			Diagnostic:  r.Diagnostic,
+		}
+		added, err := p.bounces.Add(ctx, b)
+		if err != nil {
+			return out, err
+		}
+		if !added {
+			continue
+		}
+		out = append(out, b)
+		if err := p.apply(ctx, b); err != nil {
+			return out, err
+		}
+	}
+	return out, nil
+}
+
+// job returns the send job the bounce reports on, found by the return path
+// the bounce was delivered to or the Message-ID of the bounced message.
+func (p *bounceProcessor) job(ctx context.Context, rcpt string, report *bounce.Report) (*model.SendJob, error) {
+	for _, addr := range append(append([]string{rcpt}, report.To...), report.MessageID) {
+		id, ok := p.verp.Job(addr)
+		if !ok {
+			continue
+		}
+		job, err := p.jobs.Get(ctx, id)
+		if err != nil || job != nil {
+			return job, err
+		}
+	}
+	return nil, nil
+}
+
+// apply suppresses the address of b if it bounced hard, or soft too often.
+// Block bounces and delays are only recorded: the former concern the
+// sender, the latter are followed by a bounce if delivery fails for good.
+func (p *bounceProcessor) apply(ctx context.Context, b *model.Bounce) error {
+	reason := model.SuppressionReason_HardBounce
+	switch b.Kind {
+	case model.BounceKind_Hard:
+	case model.BounceKind_Soft, model.BounceKind_MailboxFull:
+		reason = model.SuppressionReason_SoftBounce
+		n, err := p.bounces.CountSince(ctx, b.WorkspaceID, b.Email,
+			[]model.BounceKind{model.BounceKind_Soft, model.BounceKind_MailboxFull}, p.now().Add(-p.opts.SoftWindow))
+		if err != nil {
+			return err
+		}
+		if n < p.opts.SoftLimit {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	_, err := p.suppressions.Add(ctx, &model.Suppression{
+		WorkspaceID: b.WorkspaceID,
+		Kind:        model.SuppressionKind_Email,
+		Value:       b.Email,
+		Reason:      reason,
+		Source:      bounceSource,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = p.contacts.SetStatus(ctx, b.WorkspaceID, b.ContactID,
+		[]model.ContactStatus{model.ContactStatus_Active, model.ContactStatus_Pending, model.ContactStatus_Unsubscribed},
+		model.ContactStatus_Bounced)
+	return err
+}
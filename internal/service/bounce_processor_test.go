@@ -0,0 +1,190 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeBounceRepo implements repository.BounceRepository in memory.
+type fakeBounceRepo struct {
+	items []*model.Bounce
+}
+
+func (f *fakeBounceRepo) Add(ctx context.Context, b *model.Bounce) (bool, error) {
+	for _, old := range f.items {
+		if old.SendJobID == b.SendJobID && old.Kind == b.Kind {
+			return false, nil
+		}
+	}
+	b.ID = uuid.New()
+	b.CreatedAt = time.Now()
+	f.items = append(f.items, b)
+	return true, nil
+}
+func (f *fakeBounceRepo) CountSince(ctx context.Context, workspaceID uuid.UUID, email string, kinds []model.BounceKind, since time.Time) (int, error) {
+	jobs := map[int64]bool{}
+	for _, b := range f.items {
+		for _, k := range kinds {
+			if b.WorkspaceID == workspaceID && b.Email == email && b.Kind == k && !b.CreatedAt.Before(since) {
+				jobs[b.SendJobID] = true
+			}
+		}
+	}
+	return len(jobs), nil
+}
+
+type bounceFixture struct {
+	svc          service.BounceProcessor
+	bounces      *fakeBounceRepo
+	suppressions *mockSuppressionRepo
+	contact      *model.Contact
+	jobs         map[int64]*model.SendJob
+}
+
+func newBounceFixture() *bounceFixture {
+	workspace := uuid.New()
+	f := &bounceFixture{
+		bounces:      &fakeBounceRepo{},
+		suppressions: &mockSuppressionRepo{},
+		contact:      &model.Contact{ID: uuid.New(), WorkspaceID: workspace, Email: "Bob@example.org", Status: model.ContactStatus_Active},
+		jobs:         map[int64]*model.SendJob{},
+	}
+	for id := int64(1); id <= 3; id++ {
+		f.jobs[id] = &model.SendJob{ID: id, WorkspaceID: workspace, CampaignID: uuid.New(), ContactID: f.contact.ID, Email: f.contact.Email}
+	}
+	f.svc = service.NewBounceProcessor(
+		&fakeSendJobRepo{jobs: f.jobs},
+		f.bounces,
+		f.suppressions,
+		&mockContactRepo{contacts: []*model.Contact{f.contact}},
+		testVERP,
+		service.BounceOptions{SoftLimit: 2},
+	)
+	return f
+}
+
+// dsn returns a delivery status notification sent to to, reporting on the
+// message with Message-ID id.
+func dsn(to, id, status, diagnostic string) []byte {
+	return []byte(fmt.Sprintf(`From: MAILER-DAEMON@mx.example.org (Mail Delivery System)
+To: %s
+Subject: Undelivered Mail Returned to Sender
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=delivery-status; boundary="b"
+
+--b
+Content-Type: message/delivery-status
+
+Reporting-MTA: dns; mx.example.org
+
+Final-Recipient: rfc822; bob@example.org
+Action: failed
+Status: %s
+Diagnostic-Code: smtp; %s
+
+--b
+Content-Type: text/rfc822-headers
+
+Message-ID: <%s>
+
+--b--
+`, to, status, diagnostic, id))
+}
+
+func TestBounceProcessor_Hard(t *testing.T) {
+	ctx := context.Background()
+	f := newBounceFixture()
+	msg := dsn(testVERP.Address(1), "unrelated@acme.com", "5.1.1", "550 5.1.1 User unknown")
+
+	bounces, err := f.svc.Process(ctx, testVERP.Address(1), msg)
+	if !assert.NoError(t, err) || !assert.Len(t, bounces, 1) {
+		return
+	}
+	assert.Equal(t, model.BounceKind_Hard, bounces[0].Kind)
+	assert.Equal(t, "5.1.1", bounces[0].Status)
+	assert.Equal(t, f.jobs[1].CampaignID, bounces[0].CampaignID)
+	if assert.Len(t, f.suppressions.added, 1) {
+		s := f.suppressions.added[0]
+		assert.Equal(t, "bob@example.org", s.Value)
+		assert.Equal(t, model.SuppressionReason_HardBounce, s.Reason)
+		assert.Equal(t, "bounce", s.Source)
+	}
+	assert.Equal(t, model.ContactStatus_Bounced, f.contact.Status)
+
+	// The same bounce received again changes nothing.
+	bounces, err = f.svc.Process(ctx, testVERP.Address(1), msg)
+	assert.NoError(t, err)
+	assert.Empty(t, bounces)
+	assert.Len(t, f.suppressions.added, 1)
+}
+
+func TestBounceProcessor_SoftLimit(t *testing.T) {
+	ctx := context.Background()
+	f := newBounceFixture()
+
+	// Delays are recorded, but do not count: the message is still retried.
+	delayed := bytes.Replace(dsn(testVERP.Address(2), "", "4.4.1", "connection timed out"), []byte("Action: failed"), []byte("Action: delayed"), 1)
+	bounces, err := f.svc.Process(ctx, testVERP.Address(2), delayed)
+	if !assert.NoError(t, err) || !assert.Len(t, bounces, 1) {
+		return
+	}
+	assert.Equal(t, model.BounceKind_Delayed, bounces[0].Kind)
+
+	// Without a tagged return path the bounce is traced by Message-ID.
+	bounces, err = f.svc.Process(ctx, "", dsn("news@acme.com", testVERP.MessageID(1, "acme.com"), "4.2.2", "452 4.2.2 Mailbox full"))
+	if !assert.NoError(t, err) || !assert.Len(t, bounces, 1) {
+		return
+	}
+	assert.Equal(t, model.BounceKind_MailboxFull, bounces[0].Kind)
+	assert.Empty(t, f.suppressions.added)
+
+	_, err = f.svc.Process(ctx, "", dsn("news@acme.com", testVERP.MessageID(2, "acme.com"), "4.4.1", "connection timed out"))
+	assert.NoError(t, err)
+	if assert.Len(t, f.suppressions.added, 1) {
+		assert.Equal(t, model.SuppressionReason_SoftBounce, f.suppressions.added[0].Reason)
+	}
+	assert.Equal(t, model.ContactStatus_Bounced, f.contact.Status)
+}
+
+func TestBounceProcessor_Block(t *testing.T) {
+	ctx := context.Background()
+	f := newBounceFixture()
+
+	bounces, err := f.svc.Process(ctx, testVERP.Address(3), dsn("", "", "5.7.1", "554 5.7.1 Client host blocked using zen.spamhaus.org"))
+	if !assert.NoError(t, err) || !assert.Len(t, bounces, 1) {
+		return
+	}
+	assert.Equal(t, model.BounceKind_Block, bounces[0].Kind)
+	assert.Empty(t, f.suppressions.added)
+	assert.Equal(t, model.ContactStatus_Active, f.contact.Status)
+}
+
+func TestBounceProcessor_Untraced(t *testing.T) {
+	ctx := context.Background()
+	f := newBounceFixture()
+
+	for _, rcpt := range []string{
+		"bounces@bounce.mailer.example",
+		// A tag with a forged MAC.
+		"bounces+1-000000000000@bounce.mailer.example",
+		// A valid tag of a job that does not exist.
+		testVERP.Address(99),
+	} {
+		bounces, err := f.svc.Process(ctx, rcpt, dsn(rcpt, "x@acme.com", "5.1.1", "550 5.1.1 User unknown"))
+		assert.NoError(t, err)
+		assert.Empty(t, bounces, rcpt)
+	}
+
+	bounces, err := f.svc.Process(ctx, testVERP.Address(1), []byte("From: bob@example.org\nSubject: Re: Spring sale\n\nThanks!\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, bounces)
+	assert.Empty(t, f.suppressions.added)
+}
@@ -0,0 +1,343 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/queue"
+	"github.com/SinaHo/email-marketing-backend/internal/ratelimit"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// pausedRetryDelay is how long the jobs of a paused campaign wait
+	// before they are looked at again.
+	pausedRetryDelay = time.Minute
+	// compiledTTL bounds how long a compiled campaign template is reused,
+	// so edits to its content blocks reach the rest of the send.
+	compiledTTL = time.Minute
+	// rateLimitMaxWait is how long a worker waits for rate limit tokens
+	// before it defers the job instead.
+	rateLimitMaxWait = 2 * time.Second
+	// unsubscribeURLVar is the template variable of the unsubscribe link.
+	unsubscribeURLVar = "unsubscribe_url"
+	// preferencesURLVar is the template variable of the preference center
+	// link.
+	preferencesURLVar = "preferences_url"
+)
+
+// CampaignDelivery renders and sends campaign send jobs. Its Deliver
+// method is a queue.Handler.
+type CampaignDelivery interface {
+	Deliver(ctx context.Context, job *model.SendJob) error
+}
+
+type compiledCampaign struct {
+	set     *render.Set
+	expires time.Time
+}
+
+type campaignDelivery struct {
+	campaigns    repository.CampaignRepository
+	templates    repository.TemplateRepository
+	blocks       repository.ContentBlockRepository
+	contacts     repository.ContactRepository
+	suppressions SuppressionService
+	signer       MessageSigner
+	verp         *bounce.VERP
+	replies      *bounce.VERP
+	unsubscribe  UnsubscribeService
+	preferences  PreferenceService
+	tracking     TrackingService
+	sender       delivery.Sender
+	limiter      ratelimit.Limiter
+	limits       ratelimit.Policy
+
+	mu       sync.Mutex
+	compiled map[uuid.UUID]*compiledCampaign
+}
+
+// NewCampaignDelivery returns a CampaignDelivery sending with sender at
+// the rates limits allows, paced by limiter. Messages are DKIM-signed by
+// signer unless it is nil, and tagged with their send job by verp unless it
+// is nil, so their bounces can be processed. Campaigns without a Reply-To
+// get the address of replies tagged with the job, if it is configured, so
+// replies reach the reply inbox. Messages carry one-click unsubscribe
+// links (RFC 8058) made by unsubscribe unless it is nil; templates place
+// the link with {{vars.unsubscribe_url}}, and the preference center link
+// of preferences, unless it is nil, with {{vars.preferences_url}}. The
+// opens and clicks of the HTML body are tracked by tracking unless it is
+// nil; the unsubscribe and preference center links are not.
+func NewCampaignDelivery(
+	campaigns repository.CampaignRepository,
+	templates repository.TemplateRepository,
+	blocks repository.ContentBlockRepository,
+	contacts repository.ContactRepository,
+	suppressions SuppressionService,
+	signer MessageSigner,
+	verp *bounce.VERP,
+	replies *bounce.VERP,
+	unsubscribe UnsubscribeService,
+	preferences PreferenceService,
+	tracking TrackingService,
+	sender delivery.Sender,
+	limiter ratelimit.Limiter,
+	limits ratelimit.Policy,
+) CampaignDelivery {
+	return &campaignDelivery{
+		campaigns:    campaigns,
+		templates:    templates,
+		blocks:       blocks,
+		contacts:     contacts,
+		suppressions: suppressions,
+		signer:       signer,
+		verp:         verp,
+		replies:      replies,
+		unsubscribe:  unsubscribe,
+		preferences:  preferences,
+		tracking:     tracking,
+		sender:       sender,
+		limiter:      limiter,
+		limits:       limits,
+		compiled:     make(map[uuid.UUID]*compiledCampaign),
+	}
+}
+
+// Deliver sends the campaign to the job's contact. The campaign, contact,
+// suppressions and list memberships are checked again because they may have
+// changed since the audience was expanded.
+func (d *campaignDelivery) Deliver(ctx context.Context, job *model.SendJob) error {
+	c, err := d.campaigns.Get(ctx, job.WorkspaceID, job.CampaignID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case c == nil:
+		return queue.Skip("campaign deleted")
+	case c.Status == model.CampaignStatus_Cancelled:
+		return queue.Skip("campaign cancelled")
+	case c.Status == model.CampaignStatus_Paused:
+		return queue.Defer(pausedRetryDelay, "campaign paused")
+	}
+
+	sup, err := d.suppressions.CheckSuppressed(ctx, job.WorkspaceID, job.Email)
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			return queue.Permanent(err)
+		}
+		return err
+	}
+	if sup != nil {
+		return queue.Skip(fmt.Sprintf("suppressed: %s", sup.Reason))
+	}
+	contact, err := d.contacts.GetContact(ctx, job.WorkspaceID, job.ContactID)
+	if err != nil {
+		return err
+	}
+	if contact == nil {
+		return queue.Skip("contact deleted")
+	}
+	if contact.Status != model.ContactStatus_Active {
+		return queue.Skip(fmt.Sprintf("contact %s", contact.Status))
+	}
+	if contact.Paused(time.Now()) {
+		return queue.Skip("contact paused")
+	}
+	reason, err := d.checkMembership(ctx, c, contact)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return queue.Skip(reason)
+	}
+
+	set, err := d.compile(ctx, c)
+	if err != nil {
+		return err
+	}
+	data := render.Data{Contact: contact, Vars: map[string]string{}}
+	var headers []mail.Header
+	if d.unsubscribe != nil {
+		link := d.unsubscribe.URL(job)
+		data.Vars[unsubscribeURLVar] = link
+		headers = unsubscribeHeaders(link)
+	}
+	if d.preferences != nil {
+		data.Vars[preferencesURLVar] = d.preferences.URL(job)
+	}
+	out, err := set.For(contact.Lang).Render(ctx, data, render.Limits{})
+	if err != nil {
+		if errors.Is(err, render.ErrTimeout) {
+			return err
+		}
+		return queue.Permanent(fmt.Errorf("render campaign: %w", err))
+	}
+	if d.tracking != nil && out.HTML != "" {
+		out.HTML, err = d.tracking.Track(job, out.HTML, data.Vars[unsubscribeURLVar], data.Vars[preferencesURLVar])
+		if err != nil {
+			return queue.Permanent(fmt.Errorf("track links: %w", err))
+		}
+	}
+
+	msg := &mail.Message{
+		From:    mail.Address{Name: c.FromName, Email: c.FromEmail},
+		To:      []mail.Address{{Name: strings.TrimSpace(contact.FirstName + " " + contact.LastName), Email: job.Email}},
+		Subject: out.Subject,
+		Text:    out.Text,
+		HTML:    out.HTML,
+		Headers: headers,
+	}
+	if c.ReplyTo != "" {
+		msg.ReplyTo = []mail.Address{{Email: c.ReplyTo}}
+	} else if d.replies != nil {
+		if addr := d.replies.Address(job.ID); addr != "" {
+			msg.ReplyTo = []mail.Address{{Name: c.FromName, Email: addr}}
+		}
+	}
+	env, raw, err := buildCampaignEmail(d.verp, job.ID, msg, job.Email)
+	if err != nil {
+		return queue.Permanent(fmt.Errorf("build email: %w", err))
+	}
+	if d.signer != nil {
+		// Failures are retried: they are database errors, or a wrong
+		// encryption key that will be fixed in the configuration.
+		if raw, err = d.signer.Sign(ctx, job.WorkspaceID, c.FromEmail, raw); err != nil {
+			return fmt.Errorf("sign email: %w", err)
+		}
+	}
+
+	wait, err := ratelimit.Wait(ctx, d.limiter, d.limits.Buckets(job.WorkspaceID, job.Email), rateLimitMaxWait)
+	if err != nil {
+		return err
+	}
+	if wait > 0 {
+		return queue.Defer(wait, "rate limited")
+	}
+	err = d.sender.Send(ctx, env, raw)
+	if throttled(err) {
+		// The receiving side asks us to slow down.
+		domain := job.Email[strings.LastIndexByte(job.Email, '@')+1:]
+		if perr := d.limiter.Penalize(ctx, d.limits.DomainBucket(domain)); perr != nil {
+			return fmt.Errorf("%w (and %v)", err, perr)
+		}
+	}
+	return err
+}
+
+// unsubscribeHeaders returns the one-click unsubscribe headers (RFC 8058)
+// of link.
+func unsubscribeHeaders(link string) []mail.Header {
+	return []mail.Header{
+		{Name: "List-Unsubscribe", Value: "<" + link + ">"},
+		{Name: "List-Unsubscribe-Post", Value: "List-Unsubscribe=One-Click"},
+	}
+}
+
+// buildCampaignEmail builds msg for delivery to the address to. Unless verp
+// is nil, its return path and Message-ID are tagged with job so bounces can
+// be traced back to it; jobs below 1 get a return path that traces to no
+// job and a random Message-ID.
+func buildCampaignEmail(verp *bounce.VERP, job int64, msg *mail.Message, to string) (delivery.Envelope, []byte, error) {
+	domain := msg.From.Email[strings.LastIndexByte(msg.From.Email, '@')+1:]
+	env := delivery.Envelope{From: msg.From.Email, To: []string{to}}
+	if verp != nil {
+		if job > 0 {
+			msg.MessageID = verp.MessageID(job, domain)
+		}
+		if rp := verp.Address(job); rp != "" {
+			env.From = rp
+		}
+	}
+	_, raw, err := mail.NewBuilder(domain).Build(msg)
+	return env, raw, err
+}
+
+// throttled reports whether err is a 421 or 451 deferral, which receivers
+// use to signal that mail is arriving too fast.
+func throttled(err error) bool {
+	var se *delivery.SMTPError
+	return errors.As(err, &se) && (se.Code == 421 || se.Code == 451)
+}
+
+// checkMembership returns why contact no longer receives campaign c
+// through its lists, or "" if it does. Contacts left in the audience by a
+// segment still receive it, unless they left one of the campaign's lists:
+// leaving the list wins.
+func (d *campaignDelivery) checkMembership(ctx context.Context, c *model.Campaign, contact *model.Contact) (string, error) {
+	if len(c.Audience.ListIDs) == 0 {
+		return "", nil
+	}
+	subs, err := d.contacts.ListSubscriptions(ctx, contact.WorkspaceID, contact.ID)
+	if err != nil {
+		return "", err
+	}
+	left := false
+	for _, sub := range subs {
+		if !slices.Contains(c.Audience.ListIDs, sub.ListID) {
+			continue
+		}
+		switch sub.Status {
+		case model.SubscriptionStatus_Subscribed:
+			return "", nil
+		case model.SubscriptionStatus_Unsubscribed:
+			left = true
+		}
+	}
+	switch {
+	case left:
+		return "unsubscribed from list", nil
+	case len(c.Audience.SegmentIDs) == 0:
+		return "not subscribed to list", nil
+	}
+	return "", nil
+}
+
+// compile returns the compiled template version of c, compiling it at most
+// once per compiledTTL.
+func (d *campaignDelivery) compile(ctx context.Context, c *model.Campaign) (*render.Set, error) {
+	now := time.Now()
+	d.mu.Lock()
+	cc := d.compiled[c.ID]
+	d.mu.Unlock()
+	if cc != nil && now.Before(cc.expires) {
+		return cc.set, nil
+	}
+
+	v, err := d.templates.GetVersion(ctx, c.WorkspaceID, c.TemplateID, c.TemplateVersion)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, queue.Permanent(fmt.Errorf("template version %d not found", c.TemplateVersion))
+	}
+	set, err := compileTemplate(ctx, d.blocks, c.WorkspaceID, v.LocalizedContent)
+	if err != nil {
+		if status.Code(err) == codes.FailedPrecondition {
+			return nil, queue.Permanent(err)
+		}
+		return nil, err
+	}
+
+	d.mu.Lock()
+	for id, old := range d.compiled {
+		if !now.Before(old.expires) {
+			delete(d.compiled, id)
+		}
+	}
+	d.compiled[c.ID] = &compiledCampaign{set: set, expires: now.Add(compiledTTL)}
+	d.mu.Unlock()
+	return set, nil
+}
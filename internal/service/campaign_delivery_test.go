@@ -0,0 +1,226 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/ratelimit"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+// testVERP tags the emails sent in tests, and testReplyVERP their reply
+// address.
+var (
+	testVERP      = bounce.NewVERP([]byte("verp key"), "bounces@bounce.mailer.example")
+	testReplyVERP = bounce.NewVERP([]byte("verp key"), "reply@reply.mailer.example")
+)
+
+type deliveryFixture struct {
+	svc          service.CampaignDelivery
+	campaign     *model.Campaign
+	ana, bo      *model.Contact
+	contacts     *mockContactRepo
+	suppressions *mockSuppressionRepo
+	domains      service.SendingDomainService
+	sender       *recordingSender
+	limiter      *ratelimit.Memory
+	tracking     *markingTracker
+}
+
+// markingTracker marks the HTML bodies it tracks and records the links it
+// was told to skip.
+type markingTracker struct {
+	service.TrackingService
+	skip []string
+}
+
+func (m *markingTracker) Track(job *model.SendJob, html string, skip ...string) (string, error) {
+	m.skip = skip
+	return html + "<!-- tracked -->", nil
+}
+
+func newDeliveryFixture(limits ratelimit.Policy) *deliveryFixture {
+	ctx := context.Background()
+	workspace := uuid.New()
+	templates := newFakeTemplateRepo()
+	tpl, _, _ := templates.Create(ctx, workspace, "Launch", model.LocalizedContent{
+		Lang: model.Language_EN,
+		TemplateContent: model.TemplateContent{
+			Subject:  "Hi {{contact.first_name}}",
+			HTMLBody: "<p>We launched</p>",
+			TextBody: "We launched\nPreferences: {{vars.preferences_url}}\nUnsubscribe: {{vars.unsubscribe_url}}",
+		},
+	}, nil, uuid.New())
+
+	f := &deliveryFixture{
+		campaign: &model.Campaign{
+			ID:              uuid.New(),
+			WorkspaceID:     workspace,
+			TemplateID:      tpl.ID,
+			TemplateVersion: 1,
+			FromName:        "Acme",
+			FromEmail:       "news@acme.com",
+			ReplyTo:         "help@acme.com",
+			Status:          model.CampaignStatus_Sending,
+		},
+		ana:          &model.Contact{ID: uuid.New(), WorkspaceID: workspace, Email: "ana@example.org", FirstName: "Ana", Lang: model.Language_EN, Status: model.ContactStatus_Active},
+		bo:           &model.Contact{ID: uuid.New(), WorkspaceID: workspace, Email: "bo@example.org", Lang: model.Language_EN, Status: model.ContactStatus_Unsubscribed},
+		suppressions: &mockSuppressionRepo{},
+		sender:       &recordingSender{},
+		limiter:      ratelimit.NewMemory(),
+		tracking:     &markingTracker{},
+	}
+	contacts := &mockContactRepo{contacts: []*model.Contact{f.ana, f.bo}}
+	f.contacts = contacts
+	domainRepo := newFakeSendingDomainRepo()
+	f.domains = service.NewSendingDomainService(domainRepo, nil, newTestBox(), "", "", "")
+	f.svc = service.NewCampaignDelivery(
+		&fakeCampaignRepo{campaigns: map[uuid.UUID]*model.Campaign{f.campaign.ID: f.campaign}},
+		templates,
+		newFakeBlockRepo(templates),
+		contacts,
+		service.NewSuppressionService(f.suppressions),
+		service.NewMessageSigner(domainRepo, newTestBox()),
+		testVERP,
+		testReplyVERP,
+		service.NewUnsubscribeService(contacts, f.suppressions, &mockConsentRepo{}, signedlink.New([]byte("k")), "https://mailer.example/"),
+		service.NewPreferenceService(contacts, f.suppressions, &mockConsentRepo{}, signedlink.New([]byte("k")), "https://mailer.example/"),
+		f.tracking,
+		f.sender,
+		f.limiter,
+		limits,
+	)
+	return f
+}
+
+func (f *deliveryFixture) job(c *model.Contact) *model.SendJob {
+	return &model.SendJob{ID: 1, CampaignID: f.campaign.ID, WorkspaceID: f.campaign.WorkspaceID, ContactID: c.ID, Email: c.Email}
+}
+
+func TestCampaignDelivery_Deliver(t *testing.T) {
+	ctx := context.Background()
+	f := newDeliveryFixture(ratelimit.Policy{})
+
+	if !assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana))) {
+		return
+	}
+	if assert.Len(t, f.sender.msgs, 1) {
+		assert.Equal(t, testVERP.Address(1), f.sender.envs[0].From)
+		assert.Contains(t, f.sender.msgs[0], "Message-ID: <"+testVERP.MessageID(1, "acme.com")+">\r\n")
+		assert.Equal(t, []string{"ana@example.org"}, f.sender.envs[0].To)
+		assert.Contains(t, f.sender.msgs[0], "From: Acme <news@acme.com>\r\n")
+		assert.Contains(t, f.sender.msgs[0], "Reply-To: <help@acme.com>\r\n")
+		assert.Contains(t, f.sender.msgs[0], "Subject: Hi Ana\r\n")
+		assert.Contains(t, f.sender.msgs[0], "List-Unsubscribe: <https://mailer.example/unsubscribe?token=")
+		assert.Contains(t, f.sender.msgs[0], "List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n")
+		assert.Contains(t, f.sender.msgs[0], "Unsubscribe: https://mailer.example/unsubscribe?token=")
+		assert.Contains(t, f.sender.msgs[0], "Preferences: https://mailer.example/preferences?token=")
+		assert.Contains(t, f.sender.msgs[0], "<!-- tracked -->")
+		if assert.Len(t, f.tracking.skip, 2) {
+			assert.Contains(t, f.tracking.skip[0], "/unsubscribe?token=")
+			assert.Contains(t, f.tracking.skip[1], "/preferences?token=")
+		}
+	}
+
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.bo)), "skipped: contact unsubscribed")
+
+	until := time.Now().Add(time.Hour)
+	f.ana.PausedUntil = &until
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: contact paused")
+	f.ana.PausedUntil = nil
+
+	f.suppressions.matchResult = &model.Suppression{Reason: model.SuppressionReason_HardBounce}
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: suppressed: hard_bounce")
+	f.suppressions.matchResult = nil
+
+	f.campaign.Status = model.CampaignStatus_Paused
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "deferred: campaign paused")
+	f.campaign.Status = model.CampaignStatus_Cancelled
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: campaign cancelled")
+
+	assert.Len(t, f.sender.msgs, 1)
+}
+
+func TestCampaignDelivery_ListMembership(t *testing.T) {
+	ctx := context.Background()
+	f := newDeliveryFixture(ratelimit.Policy{})
+	news, offers := uuid.New(), uuid.New()
+	f.campaign.Audience = model.CampaignAudience{ListIDs: []uuid.UUID{news, offers}}
+	f.contacts.subscriptions = []*model.ListSubscription{
+		{ListID: news, Status: model.SubscriptionStatus_Unsubscribed},
+		{ListID: offers, Status: model.SubscriptionStatus_Subscribed},
+	}
+	assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana)))
+
+	// Leaving the list after the audience was expanded stops the email.
+	f.contacts.subscriptions[1].Status = model.SubscriptionStatus_Unsubscribed
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: unsubscribed from list")
+	f.campaign.Audience.SegmentIDs = []uuid.UUID{uuid.New()}
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: unsubscribed from list")
+
+	// Contacts on none of the lists came in through a segment.
+	f.contacts.subscriptions = nil
+	assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana)))
+	f.campaign.Audience.SegmentIDs = nil
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "skipped: not subscribed to list")
+
+	assert.Len(t, f.sender.msgs, 2)
+}
+
+func TestCampaignDelivery_ReplyAddress(t *testing.T) {
+	ctx := context.Background()
+	f := newDeliveryFixture(ratelimit.Policy{})
+	f.campaign.ReplyTo = ""
+
+	if assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana))) && assert.Len(t, f.sender.msgs, 1) {
+		assert.Contains(t, f.sender.msgs[0], "Reply-To: Acme <"+testReplyVERP.Address(1)+">\r\n")
+	}
+}
+
+func TestCampaignDelivery_DKIM(t *testing.T) {
+	ctx := context.Background()
+	f := newDeliveryFixture(ratelimit.Policy{})
+	d, err := f.domains.CreateSendingDomain(ctx, f.campaign.WorkspaceID, &proto.CreateSendingDomainRequest{Domain: "acme.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	dns := dnsStub{}
+	dns.publish(d)
+
+	if !assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana))) {
+		return
+	}
+	vs, err := dkim.Verify(ctx, dns, []byte(f.sender.msgs[0]))
+	if assert.NoError(t, err) && assert.Len(t, vs, 1) {
+		assert.Equal(t, "acme.com", vs[0].Domain)
+		assert.Subset(t, vs[0].Headers, []string{"from", "to", "subject", "reply-to", "message-id", "content-type"})
+	}
+}
+
+func TestCampaignDelivery_RateLimits(t *testing.T) {
+	ctx := context.Background()
+	domain := ratelimit.Rate{PerSecond: 0.01, Burst: 1}
+	f := newDeliveryFixture(ratelimit.Policy{Domain: domain})
+
+	assert.NoError(t, f.svc.Deliver(ctx, f.job(f.ana)))
+	assert.EqualError(t, f.svc.Deliver(ctx, f.job(f.ana)), "deferred: rate limited")
+	assert.Len(t, f.sender.msgs, 1)
+
+	// A 421 reply slows the recipient domain down.
+	f = newDeliveryFixture(ratelimit.Policy{Domain: domain})
+	f.sender.err = &delivery.SMTPError{Code: 421, EnhancedCode: "4.7.0", Message: "Try again later"}
+	var se *delivery.SMTPError
+	assert.ErrorAs(t, f.svc.Deliver(ctx, f.job(f.ana)), &se)
+	bucket := ratelimit.Bucket{Key: "domain:example.org", Rate: domain}
+	wait, _ := f.limiter.Take(ctx, []ratelimit.Bucket{bucket})
+	assert.Greater(t, wait, 150*time.Second)
+}
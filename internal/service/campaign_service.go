@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// scheduleGrace tolerates clock skew between clients and the server when
+// checking that a send time is not in the past.
+const scheduleGrace = time.Minute
+
+// CampaignService manages campaigns and their lifecycle. Transitions the
+// current status does not allow fail with FailedPrecondition.
+type CampaignService interface {
+	CreateCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateCampaignRequest) (*proto.Campaign, error)
+	UpdateCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateCampaignRequest) (*proto.Campaign, error)
+	GetCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.GetCampaignRequest) (*proto.Campaign, error)
+	ListCampaigns(ctx context.Context, workspaceID uuid.UUID, in *proto.ListCampaignsRequest) (*proto.ListCampaignsResponse, error)
+	ScheduleCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.ScheduleCampaignRequest) (*proto.Campaign, error)
+	CancelCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.CancelCampaignRequest) (*proto.Campaign, error)
+	PauseCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.PauseCampaignRequest) (*proto.Campaign, error)
+	ResumeCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.ResumeCampaignRequest) (*proto.Campaign, error)
+	RequeueDeadLetters(ctx context.Context, workspaceID uuid.UUID, in *proto.RequeueDeadLettersRequest) (*proto.RequeueDeadLettersResponse, error)
+}
+
+type campaignService struct {
+	repo      repository.CampaignRepository
+	templates repository.TemplateRepository
+	blocks    repository.ContentBlockRepository
+	contacts  repository.ContactRepository
+	jobs      repository.SendJobRepository
+	domains   repository.SendingDomainRepository
+	emails    EmailValidator
+	now       func() time.Time
+}
+
+// NewCampaignService constructs a new CampaignService. Sender addresses
+// are checked with emails. Campaigns are only sent from verified sending
+// domains, unless domains is nil.
+func NewCampaignService(
+	repo repository.CampaignRepository,
+	templates repository.TemplateRepository,
+	blocks repository.ContentBlockRepository,
+	contacts repository.ContactRepository,
+	jobs repository.SendJobRepository,
+	domains repository.SendingDomainRepository,
+	emails EmailValidator,
+) CampaignService {
+	return &campaignService{
+		repo:      repo,
+		templates: templates,
+		blocks:    blocks,
+		contacts:  contacts,
+		jobs:      jobs,
+		domains:   domains,
+		emails:    emails,
+		now:       time.Now,
+	}
+}
+
+func (s *campaignService) CreateCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateCampaignRequest) (*proto.Campaign, error) {
+	c := &model.Campaign{WorkspaceID: workspaceID, Name: strings.TrimSpace(in.Name)}
+	if c.Name == "" {
+		return nil, status.Error(codes.InvalidArgument, "campaign name is required")
+	}
+	if in.TemplateId == "" {
+		return nil, status.Error(codes.InvalidArgument, "template_id is required")
+	}
+	if err := s.setTemplate(ctx, c, in.TemplateId, in.TemplateVersion); err != nil {
+		return nil, err
+	}
+	if err := s.setAudience(ctx, c, in.Audience); err != nil {
+		return nil, err
+	}
+	if err := s.setSender(ctx, c, in.Sender); err != nil {
+		return nil, err
+	}
+	out, err := s.repo.Create(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return campaignToProto(out), nil
+}
+
+func (s *campaignService) UpdateCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateCampaignRequest) (*proto.Campaign, error) {
+	c, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Status.Editable() {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot edit a %s campaign", c.Status)
+	}
+	if name := strings.TrimSpace(in.Name); name != "" {
+		c.Name = name
+	}
+	if in.TemplateId != "" {
+		if err := s.setTemplate(ctx, c, in.TemplateId, in.TemplateVersion); err != nil {
+			return nil, err
+		}
+	} else if in.TemplateVersion != 0 {
+		if err := s.setTemplate(ctx, c, c.TemplateID.String(), in.TemplateVersion); err != nil {
+			return nil, err
+		}
+	}
+	if in.Audience != nil {
+		if err := s.setAudience(ctx, c, in.Audience); err != nil {
+			return nil, err
+		}
+	}
+	if in.Sender != nil {
+		if err := s.setSender(ctx, c, in.Sender); err != nil {
+			return nil, err
+		}
+	}
+	// A scheduled campaign stays ready to send, as ScheduleCampaign found
+	// it.
+	if c.Status == model.CampaignStatus_Scheduled {
+		if err := s.checkReady(ctx, c); err != nil {
+			return nil, err
+		}
+	}
+	// The campaign may have been scheduled or started sending since it was
+	// read, so only a campaign still in the status checked is updated.
+	out, err := s.repo.Update(ctx, c, []model.CampaignStatus{c.Status})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		cur, err := s.repo.Get(ctx, workspaceID, c.ID)
+		if err == nil && cur != nil && cur.Status.Editable() {
+			return nil, status.Error(codes.Aborted, "campaign changed while it was edited, try again")
+		}
+		return nil, s.transitionError(ctx, workspaceID, c.ID, "edit")
+	}
+	return campaignToProto(out), nil
+}
+
+func (s *campaignService) GetCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.GetCampaignRequest) (*proto.Campaign, error) {
+	c, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	return campaignToProto(c), nil
+}
+
+func (s *campaignService) ListCampaigns(ctx context.Context, workspaceID uuid.UUID, in *proto.ListCampaignsRequest) (*proto.ListCampaignsResponse, error) {
+	limit, offset := pagination(in.PageSize, in.PageNumber)
+	statuses := make([]model.CampaignStatus, 0, len(in.Statuses))
+	for _, st := range in.Statuses {
+		statuses = append(statuses, campaignStatusFromProto(st))
+	}
+	items, err := s.repo.List(ctx, workspaceID, statuses, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListCampaignsResponse{Campaigns: make([]*proto.Campaign, 0, len(items))}
+	for _, c := range items {
+		out.Campaigns = append(out.Campaigns, campaignToProto(c))
+	}
+	return out, nil
+}
+
+// ScheduleCampaign checks the campaign can be sent and schedules it.
+func (s *campaignService) ScheduleCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.ScheduleCampaignRequest) (*proto.Campaign, error) {
+	c, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Status.CanTransitionTo(model.CampaignStatus_Scheduled) || c.Status == model.CampaignStatus_Paused {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot schedule a %s campaign", c.Status)
+	}
+	now := s.now().UTC()
+	sendAt := now
+	if in.SendAt != nil {
+		if err := in.SendAt.CheckValid(); err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid send_at")
+		}
+		sendAt = in.SendAt.AsTime()
+		if sendAt.Before(now.Add(-scheduleGrace)) {
+			return nil, status.Error(codes.InvalidArgument, "send_at is in the past")
+		}
+	}
+	if err := s.checkReady(ctx, c); err != nil {
+		return nil, err
+	}
+	from := []model.CampaignStatus{model.CampaignStatus_Draft, model.CampaignStatus_Scheduled}
+	return s.transition(ctx, workspaceID, c.ID, from, model.CampaignStatus_Scheduled, &sendAt, "schedule")
+}
+
+func (s *campaignService) CancelCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.CancelCampaignRequest) (*proto.Campaign, error) {
+	id, err := parseCampaignID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	to := model.CampaignStatus_Cancelled
+	return s.transition(ctx, workspaceID, id, model.CampaignStatusesTo(to), to, nil, "cancel")
+}
+
+func (s *campaignService) PauseCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.PauseCampaignRequest) (*proto.Campaign, error) {
+	id, err := parseCampaignID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	to := model.CampaignStatus_Paused
+	return s.transition(ctx, workspaceID, id, model.CampaignStatusesTo(to), to, nil, "pause")
+}
+
+// ResumeCampaign returns a paused campaign to sending, or to scheduled if
+// it was paused before sending started. A campaign whose send time passed
+// while paused is sent right away. Campaigns paused because their sending
+// domain failed verification resume once it verifies again.
+func (s *campaignService) ResumeCampaign(ctx context.Context, workspaceID uuid.UUID, in *proto.ResumeCampaignRequest) (*proto.Campaign, error) {
+	c, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if c.Status != model.CampaignStatus_Paused {
+		return nil, status.Errorf(codes.FailedPrecondition, "cannot resume a %s campaign", c.Status)
+	}
+	if err := s.checkSendingDomain(ctx, c); err != nil {
+		return nil, err
+	}
+	to := model.CampaignStatus_Sending
+	if c.StartedAt == nil {
+		to = model.CampaignStatus_Scheduled
+	}
+	return s.transition(ctx, workspaceID, c.ID, []model.CampaignStatus{model.CampaignStatus_Paused}, to, nil, "resume")
+}
+
+// RequeueDeadLetters makes the failed send jobs of a campaign, or of all
+// campaigns of the workspace, pending again with a fresh retry budget.
+func (s *campaignService) RequeueDeadLetters(ctx context.Context, workspaceID uuid.UUID, in *proto.RequeueDeadLettersRequest) (*proto.RequeueDeadLettersResponse, error) {
+	campaignID := uuid.Nil
+	if in.CampaignId != "" {
+		c, err := s.get(ctx, workspaceID, in.CampaignId)
+		if err != nil {
+			return nil, err
+		}
+		campaignID = c.ID
+	}
+	n, err := s.jobs.RequeueFailed(ctx, workspaceID, campaignID)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RequeueDeadLettersResponse{Requeued: n}, nil
+}
+
+func (s *campaignService) transition(
+	ctx context.Context,
+	workspaceID, id uuid.UUID,
+	from []model.CampaignStatus,
+	to model.CampaignStatus,
+	scheduledAt *time.Time,
+	verb string,
+) (*proto.Campaign, error) {
+	c, err := s.repo.Transition(ctx, workspaceID, id, from, to, scheduledAt)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, s.transitionError(ctx, workspaceID, id, verb)
+	}
+	return campaignToProto(c), nil
+}
+
+// transitionError explains why a compare-and-set on the status matched no
+// campaign.
+func (s *campaignService) transitionError(ctx context.Context, workspaceID, id uuid.UUID, verb string) error {
+	c, err := s.repo.Get(ctx, workspaceID, id)
+	if err != nil {
+		return err
+	}
+	if c == nil {
+		return status.Error(codes.NotFound, "campaign not found")
+	}
+	return status.Errorf(codes.FailedPrecondition, "cannot %s a %s campaign", verb, c.Status)
+}
+
+// checkReady reports what keeps a campaign from being sent.
+func (s *campaignService) checkReady(ctx context.Context, c *model.Campaign) error {
+	if c.Audience.Empty() {
+		return status.Error(codes.FailedPrecondition, "campaign has no audience")
+	}
+	if c.FromEmail == "" {
+		return status.Error(codes.FailedPrecondition, "campaign has no sender address")
+	}
+	if err := s.checkSendingDomain(ctx, c); err != nil {
+		return err
+	}
+	v, err := s.templates.GetVersion(ctx, c.WorkspaceID, c.TemplateID, c.TemplateVersion)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return status.Error(codes.FailedPrecondition, "campaign template not found")
+	}
+	// Blocks may have changed since the version was saved.
+	if _, err := compileTemplate(ctx, s.blocks, c.WorkspaceID, v.LocalizedContent); err != nil {
+		return err
+	}
+	return nil
+}
+
+// checkSendingDomain reports whether the domain of the campaign's sender
+// address is a verified sending domain of the workspace.
+func (s *campaignService) checkSendingDomain(ctx context.Context, c *model.Campaign) error {
+	if s.domains == nil {
+		return nil
+	}
+	return checkSendingDomain(ctx, s.domains, c.WorkspaceID, c.FromEmail)
+}
+
+// checkSendingDomain reports whether the domain of email is a verified
+// sending domain of the workspace in domains.
+func checkSendingDomain(ctx context.Context, domains repository.SendingDomainRepository, workspaceID uuid.UUID, email string) error {
+	domain := email[strings.LastIndexByte(email, '@')+1:]
+	d, err := domains.GetByDomain(ctx, workspaceID, domain)
+	if err != nil {
+		return err
+	}
+	if d == nil {
+		return status.Errorf(codes.FailedPrecondition, "%s is not a sending domain of the workspace", domain)
+	}
+	if d.Status != model.SendingDomainStatus_Verified {
+		return status.Errorf(codes.FailedPrecondition, "sending domain %s is not verified", domain)
+	}
+	return nil
+}
+
+func (s *campaignService) setTemplate(ctx context.Context, c *model.Campaign, rawID string, version int32) error {
+	id, err := parseTemplateID(rawID)
+	if err != nil {
+		return err
+	}
+	if version < 0 {
+		return status.Error(codes.InvalidArgument, "invalid template version")
+	}
+	v, err := s.templates.GetVersion(ctx, c.WorkspaceID, id, version)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		return status.Error(codes.NotFound, "template version not found")
+	}
+	c.TemplateID, c.TemplateVersion = v.TemplateID, v.Version
+	return nil
+}
+
+func (s *campaignService) setAudience(ctx context.Context, c *model.Campaign, in *proto.CampaignAudience) error {
+	var a model.CampaignAudience
+	seen := make(map[uuid.UUID]bool)
+	for _, raw := range in.GetListIds() {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "invalid list id")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		l, err := s.contacts.GetList(ctx, c.WorkspaceID, id)
+		if err != nil {
+			return err
+		}
+		if l == nil {
+			return status.Errorf(codes.NotFound, "list %s not found", id)
+		}
+		a.ListIDs = append(a.ListIDs, id)
+	}
+	for _, raw := range in.GetSegmentIds() {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, "invalid segment id")
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		seg, err := s.contacts.GetSegment(ctx, c.WorkspaceID, id)
+		if err != nil {
+			return err
+		}
+		if seg == nil {
+			return status.Errorf(codes.NotFound, "segment %s not found", id)
+		}
+		a.SegmentIDs = append(a.SegmentIDs, id)
+	}
+	c.Audience = a
+	return nil
+}
+
+func (s *campaignService) setSender(ctx context.Context, c *model.Campaign, in *proto.SenderIdentity) error {
+	c.FromName = strings.TrimSpace(in.GetFromName())
+	c.FromEmail, c.ReplyTo = "", ""
+	if strings.ContainsAny(c.FromName, "\r\n") {
+		return status.Error(codes.InvalidArgument, "invalid sender name")
+	}
+	if raw := strings.TrimSpace(in.GetFromEmail()); raw != "" {
+		email, err := s.emails.Validate(ctx, raw)
+		if err != nil {
+			return emailError(err)
+		}
+		c.FromEmail = email
+	}
+	if raw := strings.TrimSpace(in.GetReplyTo()); raw != "" {
+		email, err := s.emails.Validate(ctx, raw)
+		if err != nil {
+			return emailError(err)
+		}
+		c.ReplyTo = email
+	}
+	return nil
+}
+
+func (s *campaignService) get(ctx context.Context, workspaceID uuid.UUID, rawID string) (*model.Campaign, error) {
+	id, err := parseCampaignID(rawID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.repo.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "campaign not found")
+	}
+	return c, nil
+}
+
+func parseCampaignID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid campaign id")
+	}
+	return id, nil
+}
+
+var campaignStatuses = map[model.CampaignStatus]proto.CampaignStatus{
+	model.CampaignStatus_Draft:     proto.CampaignStatus_CAMPAIGN_STATUS_DRAFT,
+	model.CampaignStatus_Scheduled: proto.CampaignStatus_CAMPAIGN_STATUS_SCHEDULED,
+	model.CampaignStatus_Sending:   proto.CampaignStatus_CAMPAIGN_STATUS_SENDING,
+	model.CampaignStatus_Sent:      proto.CampaignStatus_CAMPAIGN_STATUS_SENT,
+	model.CampaignStatus_Cancelled: proto.CampaignStatus_CAMPAIGN_STATUS_CANCELLED,
+	model.CampaignStatus_Paused:    proto.CampaignStatus_CAMPAIGN_STATUS_PAUSED,
+}
+
+func campaignStatusToProto(s model.CampaignStatus) proto.CampaignStatus {
+	return campaignStatuses[s]
+}
+
+func campaignStatusFromProto(p proto.CampaignStatus) model.CampaignStatus {
+	for s, ps := range campaignStatuses {
+		if ps == p {
+			return s
+		}
+	}
+	return model.CampaignStatus_Draft
+}
+
+func campaignToProto(c *model.Campaign) *proto.Campaign {
+	out := &proto.Campaign{
+		Id:              c.ID.String(),
+		Name:            c.Name,
+		TemplateId:      c.TemplateID.String(),
+		TemplateVersion: c.TemplateVersion,
+		Audience:        &proto.CampaignAudience{},
+		Sender: &proto.SenderIdentity{
+			FromName:  c.FromName,
+			FromEmail: c.FromEmail,
+			ReplyTo:   c.ReplyTo,
+		},
+		Status:    campaignStatusToProto(c.Status),
+		CreatedAt: timestamppb.New(c.CreatedAt),
+		UpdatedAt: timestamppb.New(c.UpdatedAt),
+	}
+	for _, id := range c.Audience.ListIDs {
+		out.Audience.ListIds = append(out.Audience.ListIds, id.String())
+	}
+	for _, id := range c.Audience.SegmentIDs {
+		out.Audience.SegmentIds = append(out.Audience.SegmentIds, id.String())
+	}
+	if c.ScheduledAt != nil {
+		out.ScheduledAt = timestamppb.New(*c.ScheduledAt)
+	}
+	if c.StartedAt != nil {
+		out.StartedAt = timestamppb.New(*c.StartedAt)
+	}
+	if c.FinishedAt != nil {
+		out.FinishedAt = timestamppb.New(*c.FinishedAt)
+	}
+	return out
+}
@@ -0,0 +1,388 @@
+package service_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fakeCampaignRepo is an in-memory repository.CampaignRepository
+type fakeCampaignRepo struct {
+	campaigns map[uuid.UUID]*model.Campaign
+}
+
+func hasStatus(statuses []model.CampaignStatus, s model.CampaignStatus) bool {
+	for _, st := range statuses {
+		if st == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeCampaignRepo) Create(ctx context.Context, c *model.Campaign) (*model.Campaign, error) {
+	out := *c
+	out.ID = uuid.New()
+	out.Status = model.CampaignStatus_Draft
+	f.campaigns[out.ID] = &out
+	return &out, nil
+}
+func (f *fakeCampaignRepo) Update(ctx context.Context, c *model.Campaign, allowed []model.CampaignStatus) (*model.Campaign, error) {
+	old, _ := f.Get(ctx, c.WorkspaceID, c.ID)
+	if old == nil || !hasStatus(allowed, old.Status) {
+		return nil, nil
+	}
+	out := *c
+	out.Status = old.Status
+	f.campaigns[c.ID] = &out
+	return &out, nil
+}
+func (f *fakeCampaignRepo) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.Campaign, error) {
+	c := f.campaigns[id]
+	if c == nil || c.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	out := *c
+	return &out, nil
+}
+func (f *fakeCampaignRepo) List(ctx context.Context, workspaceID uuid.UUID, statuses []model.CampaignStatus, limit, offset int) ([]*model.Campaign, error) {
+	return nil, nil
+}
+func (f *fakeCampaignRepo) Transition(ctx context.Context, workspaceID, id uuid.UUID, from []model.CampaignStatus, to model.CampaignStatus, scheduledAt *time.Time) (*model.Campaign, error) {
+	c := f.campaigns[id]
+	if c == nil || c.WorkspaceID != workspaceID || !hasStatus(from, c.Status) {
+		return nil, nil
+	}
+	c.Status = to
+	if scheduledAt != nil {
+		c.ScheduledAt = scheduledAt
+	}
+	now := time.Now()
+	if to == model.CampaignStatus_Sending && c.StartedAt == nil {
+		c.StartedAt = &now
+	}
+	out := *c
+	return &out, nil
+}
+func (f *fakeCampaignRepo) PauseFromDomain(ctx context.Context, workspaceID uuid.UUID, domain string) ([]*model.Campaign, error) {
+	var out []*model.Campaign
+	for _, c := range f.campaigns {
+		if c.WorkspaceID == workspaceID && strings.HasSuffix(c.FromEmail, "@"+domain) &&
+			(c.Status == model.CampaignStatus_Scheduled || c.Status == model.CampaignStatus_Sending) {
+			c.Status = model.CampaignStatus_Paused
+			cp := *c
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+// fakeSendJobRepo is a repository.SendJobRepository holding dead letters
+// and jobs to look up only.
+type fakeSendJobRepo struct {
+	failed map[uuid.UUID]int64
+	jobs   map[int64]*model.SendJob
+}
+
+func (f *fakeSendJobRepo) Get(ctx context.Context, id int64) (*model.SendJob, error) {
+	return f.jobs[id], nil
+}
+
+func (f *fakeSendJobRepo) Lease(ctx context.Context, limit int, visibility time.Duration) ([]*model.SendJob, error) {
+	return nil, nil
+}
+func (f *fakeSendJobRepo) Claim(ctx context.Context, ids []int64, visibility time.Duration) ([]*model.SendJob, error) {
+	return nil, nil
+}
+func (f *fakeSendJobRepo) Complete(ctx context.Context, id int64, attempts int, status model.SendJobStatus, reason string) (bool, error) {
+	return false, nil
+}
+func (f *fakeSendJobRepo) Retry(ctx context.Context, id int64, attempts, retryAttempts int, at time.Time, reason string) (bool, error) {
+	return false, nil
+}
+func (f *fakeSendJobRepo) RequeueFailed(ctx context.Context, workspaceID, campaignID uuid.UUID) (int64, error) {
+	var n int64
+	for id, failed := range f.failed {
+		if campaignID == uuid.Nil || id == campaignID {
+			n += failed
+			delete(f.failed, id)
+		}
+	}
+	return n, nil
+}
+func (f *fakeSendJobRepo) Relay(ctx context.Context, limit int, stale time.Duration, push func([]*model.SendJob) error) (int, error) {
+	return 0, nil
+}
+func (f *fakeSendJobRepo) Unrelay(ctx context.Context, ids []int64) error {
+	return nil
+}
+
+type campaignFixture struct {
+	svc       service.CampaignService
+	repo      *fakeCampaignRepo
+	jobs      *fakeSendJobRepo
+	domains   *fakeSendingDomainRepo
+	workspace uuid.UUID
+	template  string
+	list      string
+}
+
+func newCampaignFixture(t *testing.T) *campaignFixture {
+	ctx := context.Background()
+	workspace := uuid.New()
+	templates := newFakeTemplateRepo()
+	blocks := newFakeBlockRepo(templates)
+	tpl, err := service.NewTemplateService(templates, blocks, &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil).
+		CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+			Name:    "Launch",
+			Content: &proto.TemplateContent{Subject: "We launched", HtmlBody: "<p>Hello</p>"},
+		})
+	if err != nil {
+		t.Fatal(err)
+	}
+	listID := uuid.New()
+	contacts := &mockContactRepo{lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace}}}
+	repo := &fakeCampaignRepo{campaigns: map[uuid.UUID]*model.Campaign{}}
+	jobs := &fakeSendJobRepo{failed: map[uuid.UUID]int64{}}
+	domains := newFakeSendingDomainRepo()
+	domain, _ := domains.Create(ctx, &model.SendingDomain{ID: uuid.New(), WorkspaceID: workspace, Domain: "acme.com"})
+	domains.items[domain.ID].Status = model.SendingDomainStatus_Verified
+	return &campaignFixture{
+		svc:       service.NewCampaignService(repo, templates, blocks, contacts, jobs, domains, emailvalidation.New(emailvalidation.Options{})),
+		repo:      repo,
+		jobs:      jobs,
+		domains:   domains,
+		workspace: workspace,
+		template:  tpl.Id,
+		list:      listID.String(),
+	}
+}
+
+func TestCampaignService_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	f := newCampaignFixture(t)
+
+	c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{
+		Name:       "Launch",
+		TemplateId: f.template,
+		Audience:   &proto.CampaignAudience{ListIds: []string{f.list, f.list}},
+		Sender:     &proto.SenderIdentity{FromName: "Acme", FromEmail: "News@Acme.com"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_DRAFT, c.Status)
+	assert.Equal(t, int32(1), c.TemplateVersion)
+	assert.Equal(t, []string{f.list}, c.Audience.ListIds)
+	assert.Equal(t, "news@acme.com", c.Sender.FromEmail)
+
+	sendAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	c, err = f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: c.Id, SendAt: timestamppb.New(sendAt)})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_SCHEDULED, c.Status)
+	assert.Equal(t, sendAt, c.ScheduledAt.AsTime())
+
+	// Paused before sending starts, a campaign resumes to scheduled.
+	c, err = f.svc.PauseCampaign(ctx, f.workspace, &proto.PauseCampaignRequest{Id: c.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_PAUSED, c.Status)
+	_, err = f.svc.UpdateCampaign(ctx, f.workspace, &proto.UpdateCampaignRequest{Id: c.Id, Name: "Renamed"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	c, err = f.svc.ResumeCampaign(ctx, f.workspace, &proto.ResumeCampaignRequest{Id: c.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_SCHEDULED, c.Status)
+
+	// Once sending started, it resumes to sending.
+	id, _ := uuid.Parse(c.Id)
+	_, _ = f.repo.Transition(ctx, f.workspace, id, []model.CampaignStatus{model.CampaignStatus_Scheduled}, model.CampaignStatus_Sending, nil)
+	if _, err = f.svc.PauseCampaign(ctx, f.workspace, &proto.PauseCampaignRequest{Id: c.Id}); !assert.NoError(t, err) {
+		return
+	}
+	c, err = f.svc.ResumeCampaign(ctx, f.workspace, &proto.ResumeCampaignRequest{Id: c.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_SENDING, c.Status)
+
+	c, err = f.svc.CancelCampaign(ctx, f.workspace, &proto.CancelCampaignRequest{Id: c.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_CANCELLED, c.Status)
+}
+
+func TestCampaignService_RejectsInvalidTransitions(t *testing.T) {
+	ctx := context.Background()
+	f := newCampaignFixture(t)
+	create := func() string {
+		c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{
+			Name:       "Launch",
+			TemplateId: f.template,
+			Audience:   &proto.CampaignAudience{ListIds: []string{f.list}},
+			Sender:     &proto.SenderIdentity{FromEmail: "news@acme.com"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.Id
+	}
+
+	draft := create()
+	_, err := f.svc.ResumeCampaign(ctx, f.workspace, &proto.ResumeCampaignRequest{Id: draft})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "resume draft")
+	_, err = f.svc.PauseCampaign(ctx, f.workspace, &proto.PauseCampaignRequest{Id: draft})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err), "pause draft")
+	_, err = f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{
+		Id: draft, SendAt: timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err), "schedule in the past")
+
+	cancelled := create()
+	_, err = f.svc.CancelCampaign(ctx, f.workspace, &proto.CancelCampaignRequest{Id: cancelled})
+	assert.NoError(t, err)
+	for name, call := range map[string]func() error{
+		"cancel": func() error {
+			_, err := f.svc.CancelCampaign(ctx, f.workspace, &proto.CancelCampaignRequest{Id: cancelled})
+			return err
+		},
+		"schedule": func() error {
+			_, err := f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: cancelled})
+			return err
+		},
+		"edit": func() error {
+			_, err := f.svc.UpdateCampaign(ctx, f.workspace, &proto.UpdateCampaignRequest{Id: cancelled, Name: "x"})
+			return err
+		},
+	} {
+		assert.Equal(t, codes.FailedPrecondition, status.Code(call()), name+" cancelled")
+	}
+
+	// A draft without an audience cannot be scheduled.
+	c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{Name: "Empty", TemplateId: f.template})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: c.Id})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = f.svc.CancelCampaign(ctx, f.workspace, &proto.CancelCampaignRequest{Id: uuid.NewString()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{
+		Name: "Bad", TemplateId: f.template, Audience: &proto.CampaignAudience{ListIds: []string{uuid.NewString()}},
+	})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestCampaignService_RequiresVerifiedDomain(t *testing.T) {
+	ctx := context.Background()
+	f := newCampaignFixture(t)
+	create := func(from string) *proto.Campaign {
+		c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{
+			Name:       "Launch",
+			TemplateId: f.template,
+			Audience:   &proto.CampaignAudience{ListIds: []string{f.list}},
+			Sender:     &proto.SenderIdentity{FromEmail: from},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	c := create("news@other.com")
+	_, err := f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: c.Id})
+	assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = other.com is not a sending domain of the workspace")
+
+	c = create("news@acme.com")
+	c, err = f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: c.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// The domain fails a recheck and its campaigns are paused; they cannot
+	// resume until it verifies again.
+	d, _ := f.domains.GetByDomain(ctx, f.workspace, "acme.com")
+	d.Status = model.SendingDomainStatus_Failed
+	_, _ = f.svc.PauseCampaign(ctx, f.workspace, &proto.PauseCampaignRequest{Id: c.Id})
+	_, err = f.svc.ResumeCampaign(ctx, f.workspace, &proto.ResumeCampaignRequest{Id: c.Id})
+	assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = sending domain acme.com is not verified")
+	d.Status = model.SendingDomainStatus_Verified
+	_, err = f.svc.ResumeCampaign(ctx, f.workspace, &proto.ResumeCampaignRequest{Id: c.Id})
+	assert.NoError(t, err)
+}
+
+func TestCampaignService_UpdateScheduled(t *testing.T) {
+	ctx := context.Background()
+	f := newCampaignFixture(t)
+	c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{
+		Name:       "Launch",
+		TemplateId: f.template,
+		Audience:   &proto.CampaignAudience{ListIds: []string{f.list}},
+		Sender:     &proto.SenderIdentity{FromEmail: "news@acme.com"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if _, err = f.svc.ScheduleCampaign(ctx, f.workspace, &proto.ScheduleCampaignRequest{Id: c.Id}); !assert.NoError(t, err) {
+		return
+	}
+
+	// Edits must leave a scheduled campaign as sendable as scheduling
+	// required.
+	_, err = f.svc.UpdateCampaign(ctx, f.workspace, &proto.UpdateCampaignRequest{Id: c.Id, Sender: &proto.SenderIdentity{FromEmail: "news@other.com"}})
+	assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = other.com is not a sending domain of the workspace")
+	_, err = f.svc.UpdateCampaign(ctx, f.workspace, &proto.UpdateCampaignRequest{Id: c.Id, Sender: &proto.SenderIdentity{FromName: "Acme"}})
+	assert.EqualError(t, err, "rpc error: code = FailedPrecondition desc = campaign has no sender address")
+	got, err := f.svc.GetCampaign(ctx, f.workspace, &proto.GetCampaignRequest{Id: c.Id})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "news@acme.com", got.Sender.FromEmail)
+	}
+
+	c, err = f.svc.UpdateCampaign(ctx, f.workspace, &proto.UpdateCampaignRequest{Id: c.Id, Name: "Renamed"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Renamed", c.Name)
+		assert.Equal(t, proto.CampaignStatus_CAMPAIGN_STATUS_SCHEDULED, c.Status)
+	}
+}
+
+func TestCampaignService_RequeueDeadLetters(t *testing.T) {
+	ctx := context.Background()
+	f := newCampaignFixture(t)
+	var ids []string
+	for _, name := range []string{"Launch", "Follow-up"} {
+		c, err := f.svc.CreateCampaign(ctx, f.workspace, &proto.CreateCampaignRequest{Name: name, TemplateId: f.template})
+		if !assert.NoError(t, err) {
+			return
+		}
+		ids = append(ids, c.Id)
+		f.jobs.failed[uuid.MustParse(c.Id)] = 2
+	}
+
+	resp, err := f.svc.RequeueDeadLetters(ctx, f.workspace, &proto.RequeueDeadLettersRequest{CampaignId: ids[0]})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), resp.Requeued)
+	}
+	resp, err = f.svc.RequeueDeadLetters(ctx, f.workspace, &proto.RequeueDeadLettersRequest{})
+	if assert.NoError(t, err) {
+		assert.Equal(t, int64(2), resp.Requeued)
+	}
+
+	_, err = f.svc.RequeueDeadLetters(ctx, uuid.New(), &proto.RequeueDeadLettersRequest{CampaignId: ids[0]})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
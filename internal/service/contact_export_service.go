@@ -0,0 +1,392 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/export"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	// exportHeartbeat is how often a running export renews its heartbeat.
+	exportHeartbeat = 30 * time.Second
+	// ExportStaleAfter is how long an unfinished export job may go without
+	// a heartbeat before it is taken for interrupted and failed.
+	ExportStaleAfter = 4 * exportHeartbeat
+	// exportInterrupted is the error of jobs failed for being stale.
+	exportInterrupted = "export was interrupted, please start it again"
+	// exportFailed is the error of jobs that failed while they ran. The
+	// cause is logged rather than shown, since it may name database
+	// objects or paths.
+	exportFailed = "export failed, please start it again"
+	// DefaultExportRetention is how long export files are kept by default.
+	DefaultExportRetention = 7 * 24 * time.Hour
+)
+
+// ContactExportService defines business logic for exporting contacts.
+type ContactExportService interface {
+	// ExportContacts writes the requested contacts to w.
+	ExportContacts(ctx context.Context, workspaceID uuid.UUID, in *proto.ExportContactsRequest, w io.Writer) error
+	StartContactExport(ctx context.Context, workspaceID uuid.UUID, in *proto.ExportContactsRequest) (*proto.ExportJob, error)
+	GetContactExport(ctx context.Context, workspaceID uuid.UUID, in *proto.GetContactExportRequest) (*proto.ExportJob, error)
+	// OpenContactExport opens the file produced by a completed export job.
+	OpenContactExport(ctx context.Context, workspaceID uuid.UUID, in *proto.DownloadContactExportRequest) (io.ReadCloser, error)
+	// FailStaleExports fails the export jobs that stopped without finishing,
+	// for example because the server running them exited. It is called at
+	// startup; jobs found stale when polled are failed then.
+	FailStaleExports(ctx context.Context) error
+	// PurgeExports deletes the files of the jobs completed longer than the
+	// retention ago, and the partial files of exports that were
+	// interrupted. It is called periodically.
+	PurgeExports(ctx context.Context) error
+}
+
+type contactExportService struct {
+	contacts  repository.ContactRepository
+	jobs      repository.ExportJobRepository
+	dir       string
+	retention time.Duration
+	logger    *zap.SugaredLogger
+}
+
+// NewContactExportService constructs a new ContactExportService. Background
+// export files are written to dir and kept for retention, or
+// DefaultExportRetention if it is zero.
+func NewContactExportService(
+	contacts repository.ContactRepository,
+	jobs repository.ExportJobRepository,
+	dir string,
+	retention time.Duration,
+	logger *zap.SugaredLogger,
+) ContactExportService {
+	if retention <= 0 {
+		retention = DefaultExportRetention
+	}
+	return &contactExportService{
+		contacts:  contacts,
+		jobs:      jobs,
+		dir:       dir,
+		retention: retention,
+		logger:    logger,
+	}
+}
+
+func (s *contactExportService) ExportContacts(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ExportContactsRequest,
+	w io.Writer,
+) error {
+	source, err := s.resolveSource(ctx, workspaceID, in)
+	if err != nil {
+		return err
+	}
+	_, err = s.write(ctx, workspaceID, source, in, w)
+	return err
+}
+
+func (s *contactExportService) StartContactExport(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ExportContactsRequest,
+) (*proto.ExportJob, error) {
+	// Validate synchronously so callers get argument errors immediately
+	// rather than a failed job.
+	source, err := s.resolveSource(ctx, workspaceID, in)
+	if err != nil {
+		return nil, err
+	}
+	if err := export.ValidateFields(in.Fields); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	job, err := s.jobs.Create(ctx, workspaceID, string(exportFormat(in.Format)))
+	if err != nil {
+		return nil, err
+	}
+
+	go s.runJob(job, source, in)
+
+	return exportJobToProto(job), nil
+}
+
+func (s *contactExportService) GetContactExport(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.GetContactExportRequest,
+) (*proto.ExportJob, error) {
+	job, err := s.getJob(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Stale(time.Now().Add(-ExportStaleAfter)) {
+		if err := s.jobs.MarkFailed(ctx, job.ID, exportInterrupted); err != nil {
+			return nil, err
+		}
+		job.Status, job.Error = model.ExportJobStatus_Failed, exportInterrupted
+	}
+	return exportJobToProto(job), nil
+}
+
+func (s *contactExportService) OpenContactExport(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.DownloadContactExportRequest,
+) (io.ReadCloser, error) {
+	job, err := s.getJob(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.ExportJobStatus_Completed {
+		return nil, status.Errorf(codes.FailedPrecondition, "export job is %s", job.Status)
+	}
+	f, err := os.Open(job.FilePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, status.Error(codes.NotFound, "export file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open export file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *contactExportService) FailStaleExports(ctx context.Context) error {
+	n, err := s.jobs.FailStale(ctx, time.Now().Add(-ExportStaleAfter), exportInterrupted)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		s.logger.Warnf("failed %d interrupted export jobs", n)
+	}
+	return nil
+}
+
+func (s *contactExportService) PurgeExports(ctx context.Context) error {
+	before := time.Now().Add(-s.retention)
+	paths, err := s.jobs.Expire(ctx, before)
+	if err != nil {
+		return err
+	}
+	// Partial files outlive their job only if its server exited.
+	parts, err := filepath.Glob(filepath.Join(s.dir, "*.part"))
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if fi, err := os.Stat(p); err == nil && fi.ModTime().Before(before) {
+			paths = append(paths, p)
+		}
+	}
+	for _, p := range paths {
+		if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			s.logger.Errorf("delete export file: %v", err)
+		}
+	}
+	return nil
+}
+
+// exportSource is a resolved list or segment to export from.
+type exportSource struct {
+	listID  uuid.UUID
+	segment *model.Segment
+}
+
+func (s *contactExportService) resolveSource(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ExportContactsRequest,
+) (exportSource, error) {
+	switch {
+	case in.GetListId() != "":
+		id, err := uuid.Parse(in.GetListId())
+		if err != nil {
+			return exportSource{}, status.Error(codes.InvalidArgument, "invalid list id")
+		}
+		l, err := s.contacts.GetList(ctx, workspaceID, id)
+		if err != nil {
+			return exportSource{}, err
+		}
+		if l == nil {
+			return exportSource{}, status.Error(codes.NotFound, "list not found")
+		}
+		return exportSource{listID: l.ID}, nil
+	case in.GetSegmentId() != "":
+		id, err := uuid.Parse(in.GetSegmentId())
+		if err != nil {
+			return exportSource{}, status.Error(codes.InvalidArgument, "invalid segment id")
+		}
+		seg, err := s.contacts.GetSegment(ctx, workspaceID, id)
+		if err != nil {
+			return exportSource{}, err
+		}
+		if seg == nil {
+			return exportSource{}, status.Error(codes.NotFound, "segment not found")
+		}
+		return exportSource{segment: seg}, nil
+	default:
+		return exportSource{}, status.Error(codes.InvalidArgument, "list_id or segment_id is required")
+	}
+}
+
+// write encodes every contact of the source to w and returns the row count.
+func (s *contactExportService) write(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	source exportSource,
+	in *proto.ExportContactsRequest,
+	w io.Writer,
+) (int64, error) {
+	ew, err := export.NewWriter(exportFormat(in.Format), w, in.Fields)
+	if err != nil {
+		return 0, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var rows int64
+	fn := func(c *model.Contact) error {
+		rows++
+		return ew.Write(c)
+	}
+	if source.segment != nil {
+		err = s.contacts.IterateSegment(ctx, workspaceID, source.segment.Filter, fn)
+	} else {
+		err = s.contacts.IterateList(ctx, workspaceID, source.listID, fn)
+	}
+	if err != nil {
+		return rows, err
+	}
+	return rows, ew.Flush()
+}
+
+// runJob performs a background export. The file is written under a temporary
+// name and renamed once complete so partial output is never downloadable.
+// The job's heartbeat is renewed until it finishes, and a panic fails the
+// job instead of leaving it running.
+func (s *contactExportService) runJob(job *model.ExportJob, source exportSource, in *proto.ExportContactsRequest) {
+	ctx := context.Background()
+	if err := s.jobs.MarkRunning(ctx, job.ID); err != nil {
+		s.logger.Errorf("export job %s: %v", job.ID, err)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go s.heartbeat(ctx, job.ID, done)
+	defer func() {
+		if r := recover(); r != nil {
+			s.logger.Errorf("export job %s panicked: %v", job.ID, r)
+			if err := s.jobs.MarkFailed(ctx, job.ID, exportFailed); err != nil {
+				s.logger.Errorf("export job %s: %v", job.ID, err)
+			}
+		}
+	}()
+
+	rows, path, err := s.writeJobFile(ctx, job, source, in)
+	if err != nil {
+		s.logger.Errorf("export job %s failed: %v", job.ID, err)
+		if err := s.jobs.MarkFailed(ctx, job.ID, exportFailed); err != nil {
+			s.logger.Errorf("export job %s: %v", job.ID, err)
+		}
+		return
+	}
+	if err := s.jobs.MarkCompleted(ctx, job.ID, path, rows); err != nil {
+		s.logger.Errorf("export job %s: %v", job.ID, err)
+	}
+}
+
+// heartbeat renews the heartbeat of a running job until done is closed.
+func (s *contactExportService) heartbeat(ctx context.Context, id uuid.UUID, done <-chan struct{}) {
+	t := time.NewTicker(exportHeartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			if err := s.jobs.Heartbeat(ctx, id); err != nil {
+				s.logger.Errorf("export job %s: %v", id, err)
+			}
+		}
+	}
+}
+
+func (s *contactExportService) writeJobFile(
+	ctx context.Context,
+	job *model.ExportJob,
+	source exportSource,
+	in *proto.ExportContactsRequest,
+) (int64, string, error) {
+	if err := os.MkdirAll(s.dir, 0o750); err != nil {
+		return 0, "", fmt.Errorf("create export dir: %w", err)
+	}
+	path := filepath.Join(s.dir, job.ID.String()+"."+job.Format)
+	tmp := path + ".part"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, "", fmt.Errorf("create export file: %w", err)
+	}
+	rows, err := s.write(ctx, job.WorkspaceID, source, in, f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, "", fmt.Errorf("finalize export file: %w", err)
+	}
+	return rows, path, nil
+}
+
+func (s *contactExportService) getJob(ctx context.Context, workspaceID uuid.UUID, rawID string) (*model.ExportJob, error) {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid export job id")
+	}
+	job, err := s.jobs.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, status.Error(codes.NotFound, "export job not found")
+	}
+	return job, nil
+}
+
+func exportFormat(f proto.ExportFormat) export.Format {
+	if f == proto.ExportFormat_EXPORT_FORMAT_NDJSON {
+		return export.FormatNDJSON
+	}
+	return export.FormatCSV
+}
+
+func exportJobToProto(j *model.ExportJob) *proto.ExportJob {
+	out := &proto.ExportJob{
+		Id:        j.ID.String(),
+		Format:    proto.ExportFormat_EXPORT_FORMAT_CSV,
+		Status:    string(j.Status),
+		RowCount:  j.RowCount,
+		Error:     j.Error,
+		CreatedAt: timestamppb.New(j.CreatedAt),
+	}
+	if export.Format(j.Format) == export.FormatNDJSON {
+		out.Format = proto.ExportFormat_EXPORT_FORMAT_NDJSON
+	}
+	if j.FinishedAt != nil {
+		out.FinishedAt = timestamppb.New(*j.FinishedAt)
+	}
+	return out
+}
@@ -0,0 +1,394 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockContactRepo implements repository.ContactRepository for unit testing
+type mockContactRepo struct {
+	lists    map[uuid.UUID]*model.List
+	segments map[uuid.UUID]*model.Segment
+	contacts []*model.Contact
+	// capture inputs
+	iteratedWorkspace uuid.UUID
+	iteratedFilter    *model.SegmentFilter
+	created           *model.Contact
+	confirmed         [2]uuid.UUID
+	// control outputs
+	membershipStatus model.SubscriptionStatus
+	subscriptions    []*model.ListSubscription
+}
+
+func (m *mockContactRepo) GetList(ctx context.Context, workspaceID, listID uuid.UUID) (*model.List, error) {
+	l := m.lists[listID]
+	if l == nil || l.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	return l, nil
+}
+func (m *mockContactRepo) GetSegment(ctx context.Context, workspaceID, segmentID uuid.UUID) (*model.Segment, error) {
+	s := m.segments[segmentID]
+	if s == nil || s.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	return s, nil
+}
+func (m *mockContactRepo) IterateList(ctx context.Context, workspaceID, listID uuid.UUID, fn func(*model.Contact) error) error {
+	m.iteratedWorkspace = workspaceID
+	for _, c := range m.contacts {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+func (m *mockContactRepo) IterateSegment(ctx context.Context, workspaceID uuid.UUID, filter model.SegmentFilter, fn func(*model.Contact) error) error {
+	m.iteratedWorkspace = workspaceID
+	m.iteratedFilter = &filter
+	for _, c := range m.contacts {
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockContactRepo) GetContact(ctx context.Context, workspaceID, contactID uuid.UUID) (*model.Contact, error) {
+	for _, c := range m.contacts {
+		if c.ID == contactID && c.WorkspaceID == workspaceID {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+func (m *mockContactRepo) GetListByID(ctx context.Context, listID uuid.UUID) (*model.List, error) {
+	return m.lists[listID], nil
+}
+func (m *mockContactRepo) CreatePending(ctx context.Context, c *model.Contact) (*model.Contact, error) {
+	for _, existing := range m.contacts {
+		if existing.WorkspaceID == c.WorkspaceID && existing.Email == c.Email {
+			return existing, nil
+		}
+	}
+	out := *c
+	out.ID = uuid.New()
+	out.Status = model.ContactStatus_Pending
+	m.created = &out
+	m.contacts = append(m.contacts, &out)
+	return &out, nil
+}
+func (m *mockContactRepo) AddPendingMembership(ctx context.Context, listID, contactID uuid.UUID) (model.SubscriptionStatus, error) {
+	if m.membershipStatus != model.SubscriptionStatus_Subscribed {
+		m.membershipStatus = model.SubscriptionStatus_Pending
+	}
+	return m.membershipStatus, nil
+}
+func (m *mockContactRepo) ConfirmSubscription(ctx context.Context, workspaceID, contactID, listID uuid.UUID) (bool, error) {
+	if m.membershipStatus != model.SubscriptionStatus_Pending {
+		return false, nil
+	}
+	m.membershipStatus = model.SubscriptionStatus_Subscribed
+	m.confirmed = [2]uuid.UUID{contactID, listID}
+	return true, nil
+}
+func (m *mockContactRepo) SetStatus(ctx context.Context, workspaceID, contactID uuid.UUID, from []model.ContactStatus, to model.ContactStatus) (bool, error) {
+	for _, c := range m.contacts {
+		if c.ID == contactID && c.WorkspaceID == workspaceID {
+			for _, st := range from {
+				if c.Status == st {
+					c.Status = to
+					return true, nil
+				}
+			}
+		}
+	}
+	return false, nil
+}
+func (m *mockContactRepo) ListSubscriptions(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ListSubscription, error) {
+	return m.subscriptions, nil
+}
+func (m *mockContactRepo) SetLang(ctx context.Context, workspaceID, contactID uuid.UUID, lang model.Language) (bool, error) {
+	c, _ := m.GetContact(ctx, workspaceID, contactID)
+	if c == nil {
+		return false, nil
+	}
+	c.Lang = lang
+	return true, nil
+}
+func (m *mockContactRepo) SetPausedUntil(ctx context.Context, workspaceID, contactID uuid.UUID, until *time.Time) (bool, error) {
+	c, _ := m.GetContact(ctx, workspaceID, contactID)
+	if c == nil {
+		return false, nil
+	}
+	c.PausedUntil = until
+	return true, nil
+}
+
+func TestExportContacts_List(t *testing.T) {
+	workspace := uuid.New()
+	listID := uuid.New()
+	repo := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace}},
+		contacts: []*model.Contact{
+			{Email: "a@example.com", FirstName: "A", CreatedAt: time.Now()},
+			{Email: "b@example.com", FirstName: "B", CreatedAt: time.Now()},
+		},
+	}
+	svc := service.NewContactExportService(repo, nil, t.TempDir(), 0, zap.NewNop().Sugar())
+
+	var buf bytes.Buffer
+	err := svc.ExportContacts(context.Background(), workspace, &proto.ExportContactsRequest{
+		Source: &proto.ExportContactsRequest_ListId{ListId: listID.String()},
+		Format: proto.ExportFormat_EXPORT_FORMAT_CSV,
+		Fields: []string{"email", "first_name"},
+	}, &buf)
+	assert.NoError(t, err)
+	assert.Equal(t, "email,first_name\na@example.com,A\nb@example.com,B\n", buf.String())
+	assert.Equal(t, workspace, repo.iteratedWorkspace)
+}
+
+func TestExportContacts_SegmentOfOtherWorkspace(t *testing.T) {
+	segID := uuid.New()
+	repo := &mockContactRepo{
+		segments: map[uuid.UUID]*model.Segment{segID: {ID: segID, WorkspaceID: uuid.New()}},
+	}
+	svc := service.NewContactExportService(repo, nil, t.TempDir(), 0, zap.NewNop().Sugar())
+
+	err := svc.ExportContacts(context.Background(), uuid.New(), &proto.ExportContactsRequest{
+		Source: &proto.ExportContactsRequest_SegmentId{SegmentId: segID.String()},
+	}, &bytes.Buffer{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	assert.Nil(t, repo.iteratedFilter)
+}
+
+func TestExportContacts_InvalidFields(t *testing.T) {
+	workspace := uuid.New()
+	listID := uuid.New()
+	repo := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace}},
+	}
+	svc := service.NewContactExportService(repo, nil, t.TempDir(), 0, zap.NewNop().Sugar())
+
+	err := svc.ExportContacts(context.Background(), workspace, &proto.ExportContactsRequest{
+		Source: &proto.ExportContactsRequest_ListId{ListId: listID.String()},
+		Fields: []string{"password_hash"},
+	}, &bytes.Buffer{})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// fakeExportJobRepo is an in-memory repository.ExportJobRepository. Jobs run
+// in the background, so it is safe for concurrent use.
+type fakeExportJobRepo struct {
+	mu   sync.Mutex
+	jobs map[uuid.UUID]*model.ExportJob
+}
+
+func newFakeExportJobRepo() *fakeExportJobRepo {
+	return &fakeExportJobRepo{jobs: map[uuid.UUID]*model.ExportJob{}}
+}
+
+func (f *fakeExportJobRepo) Create(ctx context.Context, workspaceID uuid.UUID, format string) (*model.ExportJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j := &model.ExportJob{ID: uuid.New(), WorkspaceID: workspaceID, Format: format, Status: model.ExportJobStatus_Pending, CreatedAt: time.Now()}
+	f.jobs[j.ID] = j
+	out := *j
+	return &out, nil
+}
+func (f *fakeExportJobRepo) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.ExportJob, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	j, ok := f.jobs[id]
+	if !ok || j.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	out := *j
+	return &out, nil
+}
+func (f *fakeExportJobRepo) update(id uuid.UUID, fn func(*model.ExportJob)) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if j, ok := f.jobs[id]; ok {
+		fn(j)
+	}
+	return nil
+}
+func (f *fakeExportJobRepo) MarkRunning(ctx context.Context, id uuid.UUID) error {
+	return f.update(id, func(j *model.ExportJob) {
+		now := time.Now()
+		j.Status, j.HeartbeatAt = model.ExportJobStatus_Running, &now
+	})
+}
+func (f *fakeExportJobRepo) Heartbeat(ctx context.Context, id uuid.UUID) error {
+	return f.update(id, func(j *model.ExportJob) {
+		now := time.Now()
+		j.HeartbeatAt = &now
+	})
+}
+func (f *fakeExportJobRepo) MarkCompleted(ctx context.Context, id uuid.UUID, filePath string, rowCount int64) error {
+	return f.update(id, func(j *model.ExportJob) {
+		now := time.Now()
+		j.Status, j.FilePath, j.RowCount, j.FinishedAt = model.ExportJobStatus_Completed, filePath, rowCount, &now
+	})
+}
+func (f *fakeExportJobRepo) MarkFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	return f.update(id, func(j *model.ExportJob) {
+		j.Status, j.Error = model.ExportJobStatus_Failed, reason
+	})
+}
+func (f *fakeExportJobRepo) FailStale(ctx context.Context, before time.Time, reason string) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var n int64
+	for _, j := range f.jobs {
+		if j.Stale(before) {
+			j.Status, j.Error = model.ExportJobStatus_Failed, reason
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (f *fakeExportJobRepo) Expire(ctx context.Context, before time.Time) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var paths []string
+	for _, j := range f.jobs {
+		if j.Status == model.ExportJobStatus_Completed && j.FinishedAt.Before(before) {
+			paths = append(paths, j.FilePath)
+			j.Status, j.FilePath = model.ExportJobStatus_Expired, ""
+		}
+	}
+	return paths, nil
+}
+
+// panickingContactRepo panics while a list is exported.
+type panickingContactRepo struct {
+	*mockContactRepo
+}
+
+func (p panickingContactRepo) IterateList(ctx context.Context, workspaceID, listID uuid.UUID, fn func(*model.Contact) error) error {
+	panic("boom")
+}
+
+// waitExport polls an export job until it finishes.
+func waitExport(t *testing.T, svc service.ContactExportService, workspace uuid.UUID, id string) *proto.ExportJob {
+	for range 200 {
+		job, err := svc.GetContactExport(context.Background(), workspace, &proto.GetContactExportRequest{Id: id})
+		if !assert.NoError(t, err) {
+			return nil
+		}
+		if job.Status == "completed" || job.Status == "failed" {
+			return job
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("export did not finish")
+	return nil
+}
+
+func TestStartContactExport_Panic(t *testing.T) {
+	workspace := uuid.New()
+	listID := uuid.New()
+	repo := panickingContactRepo{&mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace}},
+	}}
+	svc := service.NewContactExportService(repo, newFakeExportJobRepo(), t.TempDir(), 0, zap.NewNop().Sugar())
+
+	job, err := svc.StartContactExport(context.Background(), workspace, &proto.ExportContactsRequest{
+		Source: &proto.ExportContactsRequest_ListId{ListId: listID.String()},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if done := waitExport(t, svc, workspace, job.Id); done != nil {
+		assert.Equal(t, "failed", done.Status)
+		assert.Equal(t, "export failed, please start it again", done.Error)
+	}
+}
+
+func TestContactExport_StaleJobs(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	jobs := newFakeExportJobRepo()
+	svc := service.NewContactExportService(&mockContactRepo{}, jobs, t.TempDir(), 0, zap.NewNop().Sugar())
+
+	// A job whose server exited while it ran, and one still running.
+	stale, _ := jobs.Create(ctx, workspace, "csv")
+	live, _ := jobs.Create(ctx, workspace, "csv")
+	gone := time.Now().Add(-2 * service.ExportStaleAfter)
+	jobs.jobs[stale.ID].Status, jobs.jobs[stale.ID].HeartbeatAt = model.ExportJobStatus_Running, &gone
+	jobs.MarkRunning(ctx, live.ID)
+
+	got, err := svc.GetContactExport(ctx, workspace, &proto.GetContactExportRequest{Id: stale.ID.String()})
+	assert.NoError(t, err)
+	assert.Equal(t, "failed", got.Status)
+	assert.NotEmpty(t, got.Error)
+	got, _ = svc.GetContactExport(ctx, workspace, &proto.GetContactExportRequest{Id: live.ID.String()})
+	assert.Equal(t, "running", got.Status)
+
+	// At startup, jobs created before a restart are failed.
+	old, _ := jobs.Create(ctx, workspace, "csv")
+	jobs.jobs[old.ID].CreatedAt = gone
+	assert.NoError(t, svc.FailStaleExports(ctx))
+	assert.Equal(t, model.ExportJobStatus_Failed, jobs.jobs[old.ID].Status)
+	assert.Equal(t, model.ExportJobStatus_Running, jobs.jobs[live.ID].Status)
+}
+
+func TestContactExport_Purge(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	dir := t.TempDir()
+	jobs := newFakeExportJobRepo()
+	svc := service.NewContactExportService(&mockContactRepo{}, jobs, dir, time.Hour, zap.NewNop().Sugar())
+
+	file := func(name string, age time.Duration) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("email\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-age)
+		os.Chtimes(path, old, old)
+		return path
+	}
+	completed := func(age time.Duration) (*model.ExportJob, string) {
+		j, _ := jobs.Create(ctx, workspace, "csv")
+		path := file(j.ID.String()+".csv", age)
+		jobs.MarkCompleted(ctx, j.ID, path, 1)
+		finished := time.Now().Add(-age)
+		jobs.jobs[j.ID].FinishedAt = &finished
+		return j, path
+	}
+	expired, expiredPath := completed(2 * time.Hour)
+	recent, recentPath := completed(time.Minute)
+	abandoned := file(uuid.NewString()+".csv.part", 2*time.Hour)
+	writing := file(uuid.NewString()+".csv.part", time.Minute)
+
+	assert.NoError(t, svc.PurgeExports(ctx))
+	assert.NoFileExists(t, expiredPath)
+	assert.NoFileExists(t, abandoned)
+	assert.FileExists(t, recentPath)
+	assert.FileExists(t, writing)
+
+	_, err := svc.OpenContactExport(ctx, workspace, &proto.DownloadContactExportRequest{Id: expired.ID.String()})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	f, err := svc.OpenContactExport(ctx, workspace, &proto.DownloadContactExportRequest{Id: recent.ID.String()})
+	if assert.NoError(t, err) {
+		f.Close()
+	}
+}
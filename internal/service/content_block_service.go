@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var blockNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// ContentBlockService manages the shared content blocks and layouts
+// templates are built from.
+type ContentBlockService interface {
+	CreateContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateContentBlockRequest) (*proto.ContentBlock, error)
+	UpdateContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateContentBlockRequest) (*proto.UpdateContentBlockResponse, error)
+	GetContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.GetContentBlockRequest) (*proto.ContentBlock, error)
+	ListContentBlocks(ctx context.Context, workspaceID uuid.UUID, in *proto.ListContentBlocksRequest) (*proto.ListContentBlocksResponse, error)
+	DeleteContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteContentBlockRequest) (*proto.DeleteContentBlockResponse, error)
+	GetContentBlockDependents(ctx context.Context, workspaceID uuid.UUID, in *proto.GetContentBlockDependentsRequest) (*proto.ContentBlockDependents, error)
+}
+
+type contentBlockService struct {
+	repo repository.ContentBlockRepository
+}
+
+// NewContentBlockService constructs a new ContentBlockService.
+func NewContentBlockService(repo repository.ContentBlockRepository) ContentBlockService {
+	return &contentBlockService{repo: repo}
+}
+
+func (s *contentBlockService) CreateContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateContentBlockRequest) (*proto.ContentBlock, error) {
+	b, err := contentBlockFromProto(in.Name, in.Language, in.Content, in.Variants)
+	if err != nil {
+		return nil, err
+	}
+	b.WorkspaceID = workspaceID
+	b.Kind = model.BlockKind_Block
+	if in.Kind == proto.ContentBlockKind_CONTENT_BLOCK_KIND_LAYOUT {
+		b.Kind = model.BlockKind_Layout
+	}
+	if err := s.validate(ctx, b); err != nil {
+		return nil, err
+	}
+	out, err := s.repo.Create(ctx, b, render.BlockRefs(b))
+	if errors.Is(err, repository.ErrBlockExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "content block %q already exists", b.Name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contentBlockToProto(out), nil
+}
+
+// UpdateContentBlock replaces the content of a block. The change is
+// rejected if it would break the block itself, for example by including a
+// block that includes it.
+func (s *contentBlockService) UpdateContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateContentBlockRequest) (*proto.UpdateContentBlockResponse, error) {
+	b, err := contentBlockFromProto(in.Name, in.Language, in.Content, in.Variants)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := s.get(ctx, workspaceID, b.Name)
+	if err != nil {
+		return nil, err
+	}
+	b.WorkspaceID = workspaceID
+	b.Kind = existing.Kind
+	if err := s.validate(ctx, b); err != nil {
+		return nil, err
+	}
+	out, err := s.repo.Update(ctx, b, render.BlockRefs(b))
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, status.Error(codes.NotFound, "content block not found")
+	}
+	deps, err := s.repo.Dependents(ctx, workspaceID, b.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.UpdateContentBlockResponse{
+		Block:      contentBlockToProto(out),
+		Dependents: blockDependentsToProto(deps),
+	}, nil
+}
+
+func (s *contentBlockService) GetContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.GetContentBlockRequest) (*proto.ContentBlock, error) {
+	b, err := s.get(ctx, workspaceID, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return contentBlockToProto(b), nil
+}
+
+func (s *contentBlockService) ListContentBlocks(ctx context.Context, workspaceID uuid.UUID, in *proto.ListContentBlocksRequest) (*proto.ListContentBlocksResponse, error) {
+	items, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListContentBlocksResponse{Blocks: make([]*proto.ContentBlock, 0, len(items))}
+	for _, b := range items {
+		out.Blocks = append(out.Blocks, contentBlockToProto(b))
+	}
+	return out, nil
+}
+
+func (s *contentBlockService) DeleteContentBlock(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteContentBlockRequest) (*proto.DeleteContentBlockResponse, error) {
+	deps, err := s.repo.Dependents(ctx, workspaceID, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(deps.Blocks) > 0 || len(deps.Templates) > 0 || len(deps.Campaigns) > 0 {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"content block is used by %d templates, %d campaigns and %d blocks",
+			len(deps.Templates), len(deps.Campaigns), len(deps.Blocks))
+	}
+	deleted, err := s.repo.Delete(ctx, workspaceID, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DeleteContentBlockResponse{Deleted: deleted}, nil
+}
+
+func (s *contentBlockService) GetContentBlockDependents(ctx context.Context, workspaceID uuid.UUID, in *proto.GetContentBlockDependentsRequest) (*proto.ContentBlockDependents, error) {
+	if _, err := s.get(ctx, workspaceID, in.Name); err != nil {
+		return nil, err
+	}
+	deps, err := s.repo.Dependents(ctx, workspaceID, in.Name)
+	if err != nil {
+		return nil, err
+	}
+	return blockDependentsToProto(deps), nil
+}
+
+func (s *contentBlockService) get(ctx context.Context, workspaceID uuid.UUID, name string) (*model.ContentBlock, error) {
+	b, err := s.repo.Get(ctx, workspaceID, name)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, status.Error(codes.NotFound, "content block not found")
+	}
+	return b, nil
+}
+
+// validate compiles b against the other blocks of the workspace.
+func (s *contentBlockService) validate(ctx context.Context, b *model.ContentBlock) error {
+	blocks, err := loadBlocks(ctx, s.repo, b.WorkspaceID)
+	if err != nil {
+		return err
+	}
+	if err := render.ValidateBlock(b, render.Options{Blocks: blocks}); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	return nil
+}
+
+// loadBlocks returns every content block of the workspace for compiling.
+func loadBlocks(ctx context.Context, repo repository.ContentBlockRepository, workspaceID uuid.UUID) (render.Blocks, error) {
+	items, err := repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	out := make(render.Blocks, len(items))
+	for _, b := range items {
+		out[b.Name] = b
+	}
+	return out, nil
+}
+
+func contentBlockFromProto(
+	name string,
+	lang proto.Language,
+	c *proto.ContentBlockContent,
+	variants []*proto.ContentBlockVariant,
+) (*model.ContentBlock, error) {
+	b := &model.ContentBlock{Name: strings.TrimSpace(name), Lang: languageFromProto(lang)}
+	if !blockNameRe.MatchString(b.Name) {
+		return nil, status.Error(codes.InvalidArgument, "block name must be 1-64 lowercase letters, digits, '-' or '_'")
+	}
+	var err error
+	if b.BlockContent, err = blockContentFromProto(c); err != nil {
+		return nil, err
+	}
+	if len(variants) > 0 {
+		b.Variants = make(model.BlockVariants, len(variants))
+	}
+	for _, v := range variants {
+		vl := languageFromProto(v.GetLanguage())
+		if vl == b.Lang {
+			return nil, status.Errorf(codes.InvalidArgument, "%s variant duplicates the block language", vl)
+		}
+		if _, dup := b.Variants[vl.String()]; dup {
+			return nil, status.Errorf(codes.InvalidArgument, "duplicate %s variant", vl)
+		}
+		content, err := blockContentFromProto(v.GetContent())
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s variant: %s", vl, status.Convert(err).Message())
+		}
+		b.Variants[vl.String()] = content
+	}
+	return b, nil
+}
+
+func blockContentFromProto(c *proto.ContentBlockContent) (model.BlockContent, error) {
+	out := model.BlockContent{HTMLBody: c.GetHtmlBody(), TextBody: c.GetTextBody()}
+	if out.HTMLBody == "" && out.TextBody == "" {
+		return out, status.Error(codes.InvalidArgument, "an HTML or text body is required")
+	}
+	if len(out.HTMLBody) > maxTemplateBodySize || len(out.TextBody) > maxTemplateBodySize {
+		return out, status.Errorf(codes.InvalidArgument, "block body exceeds %d bytes", maxTemplateBodySize)
+	}
+	return out, nil
+}
+
+func contentBlockToProto(b *model.ContentBlock) *proto.ContentBlock {
+	out := &proto.ContentBlock{
+		Id:        b.ID.String(),
+		Name:      b.Name,
+		Kind:      proto.ContentBlockKind_CONTENT_BLOCK_KIND_BLOCK,
+		Language:  languageToProto(b.Lang),
+		Content:   &proto.ContentBlockContent{HtmlBody: b.HTMLBody, TextBody: b.TextBody},
+		CreatedAt: timestamppb.New(b.CreatedAt),
+		UpdatedAt: timestamppb.New(b.UpdatedAt),
+	}
+	if b.Kind == model.BlockKind_Layout {
+		out.Kind = proto.ContentBlockKind_CONTENT_BLOCK_KIND_LAYOUT
+	}
+	for _, lang := range []model.Language{model.Language_EN, model.Language_FA} {
+		if c, ok := b.Variants[lang.String()]; ok && lang != b.Lang {
+			out.Variants = append(out.Variants, &proto.ContentBlockVariant{
+				Language: languageToProto(lang),
+				Content:  &proto.ContentBlockContent{HtmlBody: c.HTMLBody, TextBody: c.TextBody},
+			})
+		}
+	}
+	return out
+}
+
+func blockDependentsToProto(d *repository.BlockDependents) *proto.ContentBlockDependents {
+	out := &proto.ContentBlockDependents{Blocks: d.Blocks}
+	for _, t := range d.Templates {
+		out.Templates = append(out.Templates, &proto.TemplateRef{
+			Id:      t.ID.String(),
+			Name:    t.Name,
+			Version: t.CurrentVersion,
+		})
+	}
+	for _, c := range d.Campaigns {
+		ref := &proto.CampaignRef{
+			Id:     c.ID.String(),
+			Name:   c.Name,
+			Status: campaignStatusToProto(c.Status),
+		}
+		if c.ScheduledAt != nil {
+			ref.ScheduledAt = timestamppb.New(*c.ScheduledAt)
+		}
+		out.Campaigns = append(out.Campaigns, ref)
+	}
+	return out
+}
@@ -0,0 +1,222 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeBlockRepo is an in-memory repository.ContentBlockRepository. Template
+// dependents are looked up in templates when set.
+type fakeBlockRepo struct {
+	blocks    map[string]*model.ContentBlock
+	refs      map[string][]string
+	templates *fakeTemplateRepo
+}
+
+func newFakeBlockRepo(templates *fakeTemplateRepo) *fakeBlockRepo {
+	return &fakeBlockRepo{
+		blocks:    map[string]*model.ContentBlock{},
+		refs:      map[string][]string{},
+		templates: templates,
+	}
+}
+
+func (f *fakeBlockRepo) Create(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error) {
+	if _, ok := f.blocks[b.Name]; ok {
+		return nil, repository.ErrBlockExists
+	}
+	b.ID = uuid.New()
+	f.blocks[b.Name] = b
+	f.refs[b.Name] = refs
+	return b, nil
+}
+func (f *fakeBlockRepo) Update(ctx context.Context, b *model.ContentBlock, refs []string) (*model.ContentBlock, error) {
+	old, ok := f.blocks[b.Name]
+	if !ok {
+		return nil, nil
+	}
+	b.ID = old.ID
+	f.blocks[b.Name] = b
+	f.refs[b.Name] = refs
+	return b, nil
+}
+func (f *fakeBlockRepo) Get(ctx context.Context, workspaceID uuid.UUID, name string) (*model.ContentBlock, error) {
+	return f.blocks[name], nil
+}
+func (f *fakeBlockRepo) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.ContentBlock, error) {
+	var out []*model.ContentBlock
+	for _, b := range f.blocks {
+		out = append(out, b)
+	}
+	return out, nil
+}
+func (f *fakeBlockRepo) Delete(ctx context.Context, workspaceID uuid.UUID, name string) (bool, error) {
+	_, ok := f.blocks[name]
+	delete(f.blocks, name)
+	return ok, nil
+}
+func (f *fakeBlockRepo) Dependents(ctx context.Context, workspaceID uuid.UUID, name string) (*repository.BlockDependents, error) {
+	uses := func(refs []string, names map[string]bool) bool {
+		for _, r := range refs {
+			if names[r] {
+				return true
+			}
+		}
+		return false
+	}
+	names := map[string]bool{name: true}
+	out := &repository.BlockDependents{}
+	for changed := true; changed; {
+		changed = false
+		for b, refs := range f.refs {
+			if !names[b] && uses(refs, names) {
+				names[b] = true
+				out.Blocks = append(out.Blocks, b)
+				changed = true
+			}
+		}
+	}
+	if f.templates != nil {
+		for id, refs := range f.templates.refs {
+			if uses(refs, names) {
+				out.Templates = append(out.Templates, f.templates.templates[id])
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestContentBlockService_Dependents(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	templates := newFakeTemplateRepo()
+	blocks := newFakeBlockRepo(templates)
+	svc := service.NewContentBlockService(blocks)
+	tplSvc := service.NewTemplateService(templates, blocks, &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil)
+
+	_, err := svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+		Name:    "address",
+		Content: &proto.ContentBlockContent{HtmlBody: "Acme, 1 Main St"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+		Name:    "footer",
+		Content: &proto.ContentBlockContent{HtmlBody: `<footer>{{include "address"}}</footer>`},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+		Name:    "main",
+		Kind:    proto.ContentBlockKind_CONTENT_BLOCK_KIND_LAYOUT,
+		Content: &proto.ContentBlockContent{HtmlBody: `<div>{{content}}{{include "footer"}}</div>`},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	tpl, err := tplSvc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Welcome",
+		Content: &proto.TemplateContent{Subject: "Hi", HtmlBody: "<p>Welcome</p>"},
+		Layout:  "main",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "main", tpl.Current.Layout)
+
+	// Updating the address affects the footer, the layout and the template.
+	res, err := svc.UpdateContentBlock(ctx, workspace, &proto.UpdateContentBlockRequest{
+		Name:    "address",
+		Content: &proto.ContentBlockContent{HtmlBody: "Acme, 2 Main St"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.ElementsMatch(t, []string{"footer", "main"}, res.Dependents.Blocks)
+	if assert.Len(t, res.Dependents.Templates, 1) {
+		assert.Equal(t, tpl.Id, res.Dependents.Templates[0].Id)
+	}
+
+	preview, err := tplSvc.PreviewTemplate(ctx, workspace, &proto.PreviewTemplateRequest{Id: tpl.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, preview.HtmlBody, "<div><p>Welcome</p><footer>Acme, 2 Main St</footer></div>")
+
+	// Blocks in use cannot be deleted.
+	_, err = svc.DeleteContentBlock(ctx, workspace, &proto.DeleteContentBlockRequest{Name: "address"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestContentBlockService_Rejects(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	svc := service.NewContentBlockService(newFakeBlockRepo(nil))
+
+	_, err := svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+		Name:    "footer",
+		Content: &proto.ContentBlockContent{HtmlBody: "<footer>Acme</footer>"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	_, err = svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+		Name:    "social",
+		Content: &proto.ContentBlockContent{HtmlBody: `<p>Follow us</p>{{include "footer"}}`},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	cases := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"duplicate", func() error {
+			_, err := svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+				Name: "footer", Content: &proto.ContentBlockContent{HtmlBody: "x"},
+			})
+			return err
+		}, codes.AlreadyExists},
+		{"bad name", func() error {
+			_, err := svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+				Name: "Footer!", Content: &proto.ContentBlockContent{HtmlBody: "x"},
+			})
+			return err
+		}, codes.InvalidArgument},
+		{"layout without slot", func() error {
+			_, err := svc.CreateContentBlock(ctx, workspace, &proto.CreateContentBlockRequest{
+				Name: "main", Kind: proto.ContentBlockKind_CONTENT_BLOCK_KIND_LAYOUT,
+				Content: &proto.ContentBlockContent{HtmlBody: "<div></div>"},
+			})
+			return err
+		}, codes.InvalidArgument},
+		{"cycle", func() error {
+			_, err := svc.UpdateContentBlock(ctx, workspace, &proto.UpdateContentBlockRequest{
+				Name: "footer", Content: &proto.ContentBlockContent{HtmlBody: `{{include "social"}}`},
+			})
+			return err
+		}, codes.InvalidArgument},
+		{"missing", func() error {
+			_, err := svc.UpdateContentBlock(ctx, workspace, &proto.UpdateContentBlockRequest{
+				Name: "header", Content: &proto.ContentBlockContent{HtmlBody: "x"},
+			})
+			return err
+		}, codes.NotFound},
+	}
+	for _, tc := range cases {
+		assert.Equal(t, tc.want, status.Code(tc.call()), tc.name)
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/domaincheck"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultDomainRecheckInterval           = 24 * time.Hour
+	DefaultUnverifiedDomainRecheckInterval = time.Hour
+	// domainRecheckBatch is how many domains are claimed per recheck.
+	domainRecheckBatch = 100
+)
+
+// DomainVerifier checks the DNS records of sending domains and stores the
+// outcome.
+type DomainVerifier interface {
+	// Verify checks d now. It returns (nil, nil) if d was deleted
+	// meanwhile, and an Unavailable error without changing d if DNS could
+	// not be queried.
+	Verify(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error)
+	// RecheckDomains verifies the domains of all workspaces that are due
+	// for a check, and returns how many were checked.
+	RecheckDomains(ctx context.Context) (int, error)
+}
+
+// DomainVerifierOptions configures a DomainVerifier. Zero values select
+// the defaults.
+type DomainVerifierOptions struct {
+	// RecheckInterval is how often verified domains are checked again.
+	RecheckInterval time.Duration
+	// UnverifiedRecheckInterval is how often other domains are checked,
+	// so that they verify soon after their records are published.
+	UnverifiedRecheckInterval time.Duration
+}
+
+type domainVerifier struct {
+	domains   repository.SendingDomainRepository
+	campaigns repository.CampaignRepository
+	checker   *domaincheck.Checker
+	opts      DomainVerifierOptions
+	now       func() time.Time
+}
+
+// NewDomainVerifier returns a DomainVerifier. Campaigns sending from
+// domains that fail verification are paused, unless campaigns is nil.
+func NewDomainVerifier(
+	domains repository.SendingDomainRepository,
+	campaigns repository.CampaignRepository,
+	checker *domaincheck.Checker,
+	opts DomainVerifierOptions,
+) DomainVerifier {
+	if opts.RecheckInterval <= 0 {
+		opts.RecheckInterval = DefaultDomainRecheckInterval
+	}
+	if opts.UnverifiedRecheckInterval <= 0 {
+		opts.UnverifiedRecheckInterval = DefaultUnverifiedDomainRecheckInterval
+	}
+	return &domainVerifier{domains: domains, campaigns: campaigns, checker: checker, opts: opts, now: time.Now}
+}
+
+func (v *domainVerifier) Verify(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error) {
+	checks, err := v.checker.Check(ctx, d)
+	if err != nil {
+		return nil, status.Errorf(codes.Unavailable, "check DNS records of %s: %v", d.Domain, err)
+	}
+	now := v.now().UTC()
+	out := *d
+	out.Checks = checks
+	out.CheckedAt = &now
+	switch {
+	case checks.Passed():
+		out.Status = model.SendingDomainStatus_Verified
+		if out.VerifiedAt == nil {
+			out.VerifiedAt = &now
+		}
+	case out.VerifiedAt != nil:
+		out.Status = model.SendingDomainStatus_Failed
+	default:
+		out.Status = model.SendingDomainStatus_Pending
+	}
+	saved, err := v.domains.SaveChecks(ctx, &out)
+	if err != nil || saved == nil {
+		return nil, err
+	}
+	if saved.Status != model.SendingDomainStatus_Verified && v.campaigns != nil {
+		// Campaigns cannot be scheduled from such domains, but may have
+		// been while the domain was verified.
+		if _, err := v.campaigns.PauseFromDomain(ctx, saved.WorkspaceID, saved.Domain); err != nil {
+			return nil, err
+		}
+	}
+	return saved, nil
+}
+
+func (v *domainVerifier) RecheckDomains(ctx context.Context) (int, error) {
+	now := v.now()
+	due, err := v.domains.ClaimDue(ctx, now.Add(-v.opts.RecheckInterval), now.Add(-v.opts.UnverifiedRecheckInterval), domainRecheckBatch)
+	if err != nil {
+		return 0, err
+	}
+	var errs []error
+	for _, d := range due {
+		// A failed check is retried at the next interval.
+		if _, err := v.Verify(ctx, d); err != nil {
+			errs = append(errs, fmt.Errorf("domain %s: %w", d.Domain, err))
+		}
+	}
+	return len(due), errors.Join(errs...)
+}
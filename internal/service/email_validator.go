@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EmailValidator checks an email address and returns its normalised form.
+// *emailvalidation.Validator satisfies it.
+type EmailValidator interface {
+	Validate(ctx context.Context, addr string) (string, error)
+}
+
+// emailError maps a validation failure to an InvalidArgument status that
+// names the rejection reason.
+func emailError(err error) error {
+	var verr *emailvalidation.Error
+	if errors.As(err, &verr) {
+		return status.Error(codes.InvalidArgument, verr.Error())
+	}
+	return err
+}
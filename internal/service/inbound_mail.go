@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"go.uber.org/zap"
+)
+
+// complaintSource is the source of suppressions added for spam complaints.
+const complaintSource = "complaint"
+
+// InboundMail routes the mail received for our return path and reply
+// domains: bounces to the BounceProcessor, spam complaints to suppressions
+// and replies to the reply inbox. Mail that cannot be traced to a send job
+// is dropped.
+type InboundMail interface {
+	// Deliver handles one message received from the envelope sender from
+	// for the envelope recipients to. Errors are temporary: the message
+	// should be delivered again later.
+	Deliver(ctx context.Context, from string, to []string, raw []byte) error
+}
+
+type inboundMail struct {
+	bounces      BounceProcessor
+	jobs         repository.SendJobRepository
+	suppressions repository.SuppressionRepository
+	contacts     repository.ContactRepository
+	replies      repository.ReplyRepository
+	verp         *bounce.VERP
+	logger       *zap.SugaredLogger
+}
+
+// NewInboundMail returns an InboundMail tracing messages to send jobs by
+// the tags verp put in the return path, Reply-To and Message-ID of
+// campaign emails.
+func NewInboundMail(
+	bounces BounceProcessor,
+	jobs repository.SendJobRepository,
+	suppressions repository.SuppressionRepository,
+	contacts repository.ContactRepository,
+	replies repository.ReplyRepository,
+	verp *bounce.VERP,
+	logger *zap.SugaredLogger,
+) InboundMail {
+	return &inboundMail{
+		bounces:      bounces,
+		jobs:         jobs,
+		suppressions: suppressions,
+		contacts:     contacts,
+		replies:      replies,
+		verp:         verp,
+		logger:       logger,
+	}
+}
+
+func (m *inboundMail) Deliver(ctx context.Context, from string, to []string, raw []byte) error {
+	complaint, err := bounce.ParseComplaint(raw)
+	if err == nil {
+		return m.complaint(ctx, to, complaint)
+	}
+	if !errors.Is(err, bounce.ErrNotComplaint) {
+		m.logger.Warnf("dropping unreadable message from %q: %v", from, err)
+		return nil
+	}
+	if _, err := bounce.Parse(raw); err == nil {
+		return m.bounce(ctx, to, raw)
+	}
+	// Anything else, automatic replies included, is a reply.
+	reply, err := bounce.ParseReply(raw)
+	if err != nil {
+		m.logger.Warnf("dropping unreadable message from %q: %v", from, err)
+		return nil
+	}
+	return m.reply(ctx, to, reply)
+}
+
+func (m *inboundMail) bounce(ctx context.Context, to []string, raw []byte) error {
+	rcpts := to
+	if len(rcpts) == 0 {
+		rcpts = []string{""}
+	}
+	// Bounces already recorded are ignored, so processing the message for
+	// each recipient records it once.
+	for _, rcpt := range rcpts {
+		bounces, err := m.bounces.Process(ctx, rcpt, raw)
+		if err != nil {
+			return err
+		}
+		for _, b := range bounces {
+			m.logger.Infof("%s bounce of %s for job %d: %s", b.Kind, b.Email, b.SendJobID, b.Diagnostic)
+		}
+	}
+	return nil
+}
+
+// complaint unsubscribes the recipient of the reported message. Only abuse
+// reports do: the other feedback types do not come from the recipient.
+func (m *inboundMail) complaint(ctx context.Context, to []string, c *bounce.Complaint) error {
+	if c.FeedbackType != "abuse" {
+		return nil
+	}
+	job, err := m.job(ctx, append(append([]string{c.MailFrom, c.MessageID}, c.Recipients...), to...))
+	if err != nil || job == nil {
+		return err
+	}
+	email := strings.ToLower(job.Email)
+	_, err = m.suppressions.Add(ctx, &model.Suppression{
+		WorkspaceID: job.WorkspaceID,
+		Kind:        model.SuppressionKind_Email,
+		Value:       email,
+		Reason:      model.SuppressionReason_Complaint,
+		Source:      complaintSource,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = m.contacts.SetStatus(ctx, job.WorkspaceID, job.ContactID,
+		[]model.ContactStatus{model.ContactStatus_Active, model.ContactStatus_Pending},
+		model.ContactStatus_Unsubscribed)
+	if err != nil {
+		return err
+	}
+	m.logger.Infof("complaint about job %d from %s", job.ID, email)
+	return nil
+}
+
+func (m *inboundMail) reply(ctx context.Context, to []string, r *bounce.Reply) error {
+	job, err := m.job(ctx, append(append([]string{}, to...), r.References...))
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		m.logger.Infof("dropping untraced message from %q to %v", r.FromEmail, to)
+		return nil
+	}
+	_, err = m.replies.Add(ctx, &model.Reply{
+		WorkspaceID: job.WorkspaceID,
+		CampaignID:  job.CampaignID,
+		ContactID:   job.ContactID,
+		SendJobID:   job.ID,
+		FromEmail:   r.FromEmail,
+		FromName:    r.FromName,
+		Subject:     r.Subject,
+		Text:        r.Text,
+		AutoReply:   r.AutoReply,
+		MessageID:   r.MessageID,
+	})
+	return err
+}
+
+// job returns the send job tagged in the first of addrs, which are
+// addresses or Message-IDs, that carries a valid tag of an existing job.
+func (m *inboundMail) job(ctx context.Context, addrs []string) (*model.SendJob, error) {
+	for _, addr := range addrs {
+		id, ok := m.verp.Job(addr)
+		if !ok {
+			continue
+		}
+		job, err := m.jobs.Get(ctx, id)
+		if err != nil || job != nil {
+			return job, err
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,188 @@
+package service_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// fakeReplyRepo implements repository.ReplyRepository in memory.
+type fakeReplyRepo struct {
+	items []*model.Reply
+}
+
+func (f *fakeReplyRepo) Add(ctx context.Context, r *model.Reply) (bool, error) {
+	for _, old := range f.items {
+		if old.SendJobID == r.SendJobID && old.MessageID == r.MessageID {
+			return false, nil
+		}
+	}
+	r.ID = uuid.New()
+	r.ReceivedAt = time.Now()
+	f.items = append(f.items, r)
+	return true, nil
+}
+func (f *fakeReplyRepo) List(ctx context.Context, workspaceID uuid.UUID, campaignID *uuid.UUID, limit, offset int) ([]*model.Reply, error) {
+	var out []*model.Reply
+	for i := len(f.items) - 1; i >= 0; i-- {
+		r := f.items[i]
+		if r.WorkspaceID == workspaceID && (campaignID == nil || r.CampaignID == *campaignID) {
+			out = append(out, r)
+		}
+	}
+	if offset >= len(out) {
+		return nil, nil
+	}
+	return out[offset:min(offset+limit, len(out))], nil
+}
+
+type inboundFixture struct {
+	*bounceFixture
+	svc     service.InboundMail
+	replies *fakeReplyRepo
+}
+
+func newInboundFixture() *inboundFixture {
+	f := &inboundFixture{bounceFixture: newBounceFixture(), replies: &fakeReplyRepo{}}
+	f.svc = service.NewInboundMail(
+		f.bounceFixture.svc,
+		&fakeSendJobRepo{jobs: f.jobs},
+		f.suppressions,
+		&mockContactRepo{contacts: []*model.Contact{f.contact}},
+		f.replies,
+		testVERP,
+		zap.NewNop().Sugar(),
+	)
+	return f
+}
+
+// arf returns a spam complaint about the message of job 1.
+func arf(feedbackType string) []byte {
+	return []byte(fmt.Sprintf(`From: fbl@mailbox.example
+To: fbl@bounce.mailer.example
+Subject: Complaint
+MIME-Version: 1.0
+Content-Type: multipart/report; report-type=feedback-report; boundary="b"
+
+--b
+Content-Type: text/plain
+
+This is an email abuse report.
+
+--b
+Content-Type: message/feedback-report
+
+Feedback-Type: %s
+User-Agent: MailboxFBL/1.0
+Version: 1
+Original-Mail-From: <%s>
+
+--b
+Content-Type: text/rfc822-headers
+
+From: news@acme.com
+Subject: Spring sale
+
+--b--
+`, feedbackType, testVERP.Address(1)))
+}
+
+func TestInboundMail_Complaint(t *testing.T) {
+	ctx := context.Background()
+	f := newInboundFixture()
+
+	if !assert.NoError(t, f.svc.Deliver(ctx, "fbl@mailbox.example", []string{"fbl@bounce.mailer.example"}, arf("not-spam"))) {
+		return
+	}
+	assert.Empty(t, f.suppressions.added)
+
+	if !assert.NoError(t, f.svc.Deliver(ctx, "fbl@mailbox.example", []string{"fbl@bounce.mailer.example"}, arf("abuse"))) {
+		return
+	}
+	if assert.Len(t, f.suppressions.added, 1) {
+		s := f.suppressions.added[0]
+		assert.Equal(t, "bob@example.org", s.Value)
+		assert.Equal(t, model.SuppressionReason_Complaint, s.Reason)
+		assert.Equal(t, "complaint", s.Source)
+	}
+	assert.Equal(t, model.ContactStatus_Unsubscribed, f.contact.Status)
+	assert.Empty(t, f.replies.items)
+}
+
+func TestInboundMail_Bounce(t *testing.T) {
+	ctx := context.Background()
+	f := newInboundFixture()
+
+	rcpt := testVERP.Address(2)
+	err := f.svc.Deliver(ctx, "", []string{rcpt}, dsn(rcpt, "", "5.1.1", "550 5.1.1 User unknown"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	if assert.Len(t, f.bounces.items, 1) {
+		assert.Equal(t, int64(2), f.bounces.items[0].SendJobID)
+	}
+	assert.Equal(t, model.ContactStatus_Bounced, f.contact.Status)
+	assert.Empty(t, f.replies.items)
+}
+
+func TestInboundMail_Reply(t *testing.T) {
+	ctx := context.Background()
+	f := newInboundFixture()
+
+	reply := []byte("From: Bob <Bob@example.org>\nSubject: Re: Spring sale\nMessage-ID: <r1@example.org>\n\nDo you ship to Canada?\n")
+	for i := 0; i < 2; i++ {
+		if !assert.NoError(t, f.svc.Deliver(ctx, "bob@example.org", []string{testReplyVERP.Address(3)}, reply)) {
+			return
+		}
+	}
+	// Traced by In-Reply-To when sent to an untagged address.
+	raw, err := os.ReadFile("../bounce/testdata/auto_reply.eml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	raw = append([]byte("In-Reply-To: <"+testVERP.MessageID(1, "acme.com")+">\n"), raw...)
+	if !assert.NoError(t, f.svc.Deliver(ctx, "", []string{"reply@reply.mailer.example"}, raw)) {
+		return
+	}
+	// Untraced replies are dropped.
+	if !assert.NoError(t, f.svc.Deliver(ctx, "eve@example.net", []string{"reply@reply.mailer.example"}, []byte("Subject: Hi\n\nHi\n"))) {
+		return
+	}
+
+	if !assert.Len(t, f.replies.items, 2) {
+		return
+	}
+	r := f.replies.items[0]
+	assert.Equal(t, int64(3), r.SendJobID)
+	assert.Equal(t, f.jobs[3].CampaignID, r.CampaignID)
+	assert.Equal(t, "bob@example.org", r.FromEmail)
+	assert.Equal(t, "Bob", r.FromName)
+	assert.Equal(t, "Do you ship to Canada?", r.Text)
+	assert.False(t, r.AutoReply)
+	assert.Equal(t, int64(1), f.replies.items[1].SendJobID)
+	assert.True(t, f.replies.items[1].AutoReply)
+	assert.Empty(t, f.suppressions.added)
+	assert.Equal(t, model.ContactStatus_Active, f.contact.Status)
+
+	svc := service.NewReplyService(f.replies)
+	res, err := svc.ListReplies(ctx, f.contact.WorkspaceID, &proto.ListRepliesRequest{CampaignId: r.CampaignID.String()})
+	if assert.NoError(t, err) && assert.Len(t, res.Replies, 1) {
+		assert.Equal(t, r.ID.String(), res.Replies[0].Id)
+		assert.Equal(t, "Re: Spring sale", res.Replies[0].Subject)
+	}
+	res, err = svc.ListReplies(ctx, f.contact.WorkspaceID, &proto.ListRepliesRequest{})
+	if assert.NoError(t, err) {
+		assert.Len(t, res.Replies, 2)
+	}
+	_, err = svc.ListReplies(ctx, f.contact.WorkspaceID, &proto.ListRepliesRequest{CampaignId: "nope"})
+	assert.Error(t, err)
+}
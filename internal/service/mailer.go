@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"go.uber.org/zap"
+)
+
+// Message is a rendered email ready to send.
+type Message struct {
+	To       string
+	Subject  string
+	TextBody string
+	// HTMLBody is optional; messages without it are sent as plain text.
+	HTMLBody string
+}
+
+// Mailer sends transactional (non-campaign) emails such as subscription
+// confirmations and, when no TestSender is configured, template tests.
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+type logMailer struct {
+	logger *zap.SugaredLogger
+}
+
+// NewLogMailer returns a Mailer that only logs messages. It is meant for
+// local development where no mail server is configured.
+func NewLogMailer(logger *zap.SugaredLogger) Mailer {
+	return &logMailer{logger: logger}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	m.logger.Infow("Transactional email",
+		"to", msg.To, "subject", msg.Subject, "body", msg.TextBody, "html_bytes", len(msg.HTMLBody))
+	return nil
+}
+
+type deliveryMailer struct {
+	sender  delivery.Sender
+	builder *mail.Builder
+	from    mail.Address
+}
+
+// NewDeliveryMailer returns a Mailer that builds messages from the given
+// address and delivers them with sender. Bounces go to the From address.
+func NewDeliveryMailer(sender delivery.Sender, from mail.Address) Mailer {
+	domain := from.Email[strings.LastIndexByte(from.Email, '@')+1:]
+	return &deliveryMailer{sender: sender, builder: mail.NewBuilder(domain), from: from}
+}
+
+func (m *deliveryMailer) Send(ctx context.Context, msg *Message) error {
+	_, raw, err := m.builder.Build(&mail.Message{
+		From:    m.from,
+		To:      []mail.Address{{Email: msg.To}},
+		Subject: msg.Subject,
+		Text:    msg.TextBody,
+		HTML:    msg.HTMLBody,
+	})
+	if err != nil {
+		return fmt.Errorf("build email: %w", err)
+	}
+	env := delivery.Envelope{From: m.from.Email, To: []string{msg.To}}
+	if err := m.sender.Send(ctx, env, raw); err != nil {
+		return fmt.Errorf("deliver email: %w", err)
+	}
+	return nil
+}
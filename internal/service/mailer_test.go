@@ -0,0 +1,48 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingSender is a delivery.Sender keeping what it was given. Sends
+// fail with err when it is set.
+type recordingSender struct {
+	envs []delivery.Envelope
+	msgs []string
+	err  error
+}
+
+func (r *recordingSender) Send(ctx context.Context, env delivery.Envelope, msg []byte) error {
+	r.envs = append(r.envs, env)
+	r.msgs = append(r.msgs, string(msg))
+	return r.err
+}
+
+func (r *recordingSender) Close() error { return nil }
+
+func TestDeliveryMailer_Send(t *testing.T) {
+	sender := &recordingSender{}
+	mailer := service.NewDeliveryMailer(sender, mail.Address{Name: "Example", Email: "no-reply@example.com"})
+
+	err := mailer.Send(context.Background(), &service.Message{
+		To:       "ana@example.org",
+		Subject:  "Confirm",
+		TextBody: "Open the link.",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	if !assert.Len(t, sender.envs, 1) {
+		return
+	}
+	assert.Equal(t, delivery.Envelope{From: "no-reply@example.com", To: []string{"ana@example.org"}}, sender.envs[0])
+	assert.Contains(t, sender.msgs[0], "From: Example <no-reply@example.com>\r\n")
+	assert.Contains(t, sender.msgs[0], "To: <ana@example.org>\r\n")
+	assert.Regexp(t, `Message-ID: <[0-9a-f]+@example\.com>\r\n`, sender.msgs[0])
+}
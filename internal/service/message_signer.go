@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/secretbox"
+	"github.com/google/uuid"
+)
+
+// signerTTL bounds how long a decrypted DKIM key is reused, so deleted
+// domains stop being signed for shortly after.
+const signerTTL = time.Minute
+
+// MessageSigner DKIM-signs the messages workspaces send from their sending
+// domains.
+type MessageSigner interface {
+	// Sign returns raw signed with the key of the workspace's sending
+	// domain for the address from. Messages from other domains are
+	// returned unchanged.
+	Sign(ctx context.Context, workspaceID uuid.UUID, from string, raw []byte) ([]byte, error)
+}
+
+type signerKey struct {
+	workspaceID uuid.UUID
+	domain      string
+}
+
+type cachedSigner struct {
+	// signer is nil for domains without a key.
+	signer  *dkim.Signer
+	expires time.Time
+}
+
+type messageSigner struct {
+	domains repository.SendingDomainRepository
+	box     *secretbox.Box
+
+	mu      sync.Mutex
+	signers map[signerKey]*cachedSigner
+}
+
+// NewMessageSigner returns a MessageSigner using the keys of domains,
+// decrypted with box.
+func NewMessageSigner(domains repository.SendingDomainRepository, box *secretbox.Box) MessageSigner {
+	return &messageSigner{domains: domains, box: box, signers: make(map[signerKey]*cachedSigner)}
+}
+
+func (s *messageSigner) Sign(ctx context.Context, workspaceID uuid.UUID, from string, raw []byte) ([]byte, error) {
+	domain := strings.ToLower(from[strings.LastIndexByte(from, '@')+1:])
+	signer, err := s.signer(ctx, signerKey{workspaceID: workspaceID, domain: domain})
+	if err != nil || signer == nil {
+		return raw, err
+	}
+	return signer.Sign(raw)
+}
+
+func (s *messageSigner) signer(ctx context.Context, key signerKey) (*dkim.Signer, error) {
+	now := time.Now()
+	s.mu.Lock()
+	cs := s.signers[key]
+	s.mu.Unlock()
+	if cs != nil && now.Before(cs.expires) {
+		return cs.signer, nil
+	}
+
+	d, err := s.domains.GetByDomain(ctx, key.workspaceID, key.domain)
+	if err != nil {
+		return nil, err
+	}
+	var signer *dkim.Signer
+	if d != nil {
+		der, err := s.box.Open(d.DKIMPrivateKey, d.ID[:])
+		if err != nil {
+			return nil, fmt.Errorf("decrypt DKIM key of %s: %w", d.Domain, err)
+		}
+		pk, err := dkim.ParsePrivateKey(der)
+		if err != nil {
+			return nil, err
+		}
+		if signer, err = dkim.NewSigner(d.Domain, d.DKIMSelector, pk); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	for k, old := range s.signers {
+		if !now.Before(old.expires) {
+			delete(s.signers, k)
+		}
+	}
+	s.signers[key] = &cachedSigner{signer: signer, expires: now.Add(signerTTL)}
+	s.mu.Unlock()
+	return signer, nil
+}
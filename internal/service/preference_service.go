@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	preferencesPurpose = "preferences"
+	// preferenceSource is the consent source of changes made in the
+	// preference center.
+	preferenceSource = "preference_center"
+	maxPauseDays     = 365
+)
+
+// PreferenceService implements the preference center, where contacts
+// change their language, leave lists and pause campaign emails. Like
+// unsubscribe links, its links carry a token signed for one contact.
+type PreferenceService interface {
+	// URL returns the preference center link of the recipient of job.
+	URL(job *model.SendJob) string
+	GetPreferences(ctx context.Context, in *proto.GetPreferencesRequest) (*proto.Preferences, error)
+	// UpdatePreferences applies the changes in, recording each in the
+	// consent history.
+	UpdatePreferences(ctx context.Context, client ClientInfo, in *proto.UpdatePreferencesRequest) (*proto.Preferences, error)
+}
+
+type preferenceService struct {
+	contacts     repository.ContactRepository
+	suppressions repository.SuppressionRepository
+	consent      repository.ConsentRepository
+	signer       *signedlink.Signer
+	baseURL      string
+}
+
+// NewPreferenceService constructs a new PreferenceService. Links point to
+// baseURL and are signed with signer.
+func NewPreferenceService(
+	contacts repository.ContactRepository,
+	suppressions repository.SuppressionRepository,
+	consent repository.ConsentRepository,
+	signer *signedlink.Signer,
+	baseURL string,
+) PreferenceService {
+	return &preferenceService{
+		contacts:     contacts,
+		suppressions: suppressions,
+		consent:      consent,
+		signer:       signer,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// URL signs tokens without expiry, like unsubscribe links.
+func (s *preferenceService) URL(job *model.SendJob) string {
+	token := s.signer.Sign(preferencesPurpose, map[string]string{
+		"workspace": job.WorkspaceID.String(),
+		"contact":   job.ContactID.String(),
+	}, 0)
+	return s.baseURL + "/preferences?token=" + url.QueryEscape(token)
+}
+
+// contact returns the contact the token was signed for.
+func (s *preferenceService) contact(ctx context.Context, token string) (*model.Contact, error) {
+	claims, err := s.signer.Verify(preferencesPurpose, token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid preferences link")
+	}
+	workspaceID, err1 := uuid.Parse(claims["workspace"])
+	contactID, err2 := uuid.Parse(claims["contact"])
+	if err1 != nil || err2 != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid preferences link")
+	}
+	c, err := s.contacts.GetContact(ctx, workspaceID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "contact not found")
+	}
+	return c, nil
+}
+
+func (s *preferenceService) GetPreferences(ctx context.Context, in *proto.GetPreferencesRequest) (*proto.Preferences, error) {
+	c, err := s.contact(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := s.contacts.ListSubscriptions(ctx, c.WorkspaceID, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	return preferencesToProto(c, subs), nil
+}
+
+// UpdatePreferences validates every change before applying any. Changes
+// that do not change anything, such as leaving a list twice, are not
+// recorded.
+func (s *preferenceService) UpdatePreferences(
+	ctx context.Context,
+	client ClientInfo,
+	in *proto.UpdatePreferencesRequest,
+) (*proto.Preferences, error) {
+	c, err := s.contact(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	lang := c.Lang
+	if in.Lang != "" {
+		var ok bool
+		if lang, ok = model.ParseLanguage(in.Lang); !ok {
+			return nil, status.Error(codes.InvalidArgument, "unsupported language")
+		}
+	}
+	if in.PauseDays < 0 || in.PauseDays > maxPauseDays {
+		return nil, status.Errorf(codes.InvalidArgument, "pause_days must be between 0 and %d", maxPauseDays)
+	}
+	if in.PauseDays > 0 && in.Resume {
+		return nil, status.Error(codes.InvalidArgument, "pause_days and resume are exclusive")
+	}
+	subs, err := s.contacts.ListSubscriptions(ctx, c.WorkspaceID, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]*model.ListSubscription, len(subs))
+	for _, sub := range subs {
+		byID[sub.ListID] = sub
+	}
+	var leave []*model.ListSubscription
+	for _, id := range in.UnsubscribeListIds {
+		listID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, "invalid list id")
+		}
+		sub := byID[listID]
+		if sub == nil {
+			return nil, status.Error(codes.NotFound, "list not found")
+		}
+		if sub.Status != model.SubscriptionStatus_Unsubscribed {
+			sub.Status = model.SubscriptionStatus_Unsubscribed
+			leave = append(leave, sub)
+		}
+	}
+
+	record := func(action model.ConsentAction, listID *uuid.UUID, detail string) error {
+		source := preferenceSource
+		if detail != "" {
+			source += ":" + detail
+		}
+		return s.consent.Record(ctx, &model.ConsentRecord{
+			WorkspaceID: c.WorkspaceID,
+			ContactID:   c.ID,
+			ListID:      listID,
+			Action:      action,
+			IP:          client.IP,
+			UserAgent:   client.UserAgent,
+			Source:      source,
+		})
+	}
+	if lang != c.Lang {
+		if _, err := s.contacts.SetLang(ctx, c.WorkspaceID, c.ID, lang); err != nil {
+			return nil, err
+		}
+		if err := record(model.ConsentAction_LanguageChanged, nil, "lang/"+lang.String()); err != nil {
+			return nil, err
+		}
+		c.Lang = lang
+	}
+	for _, sub := range leave {
+		_, err := s.suppressions.SetSubscriptionStatus(ctx, c.WorkspaceID, sub.ListID, c.ID, model.SubscriptionStatus_Unsubscribed)
+		if err != nil {
+			return nil, err
+		}
+		if err := record(model.ConsentAction_Unsubscribed, &sub.ListID, ""); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now().UTC()
+	switch {
+	case in.PauseDays > 0:
+		until := now.AddDate(0, 0, int(in.PauseDays))
+		if _, err := s.contacts.SetPausedUntil(ctx, c.WorkspaceID, c.ID, &until); err != nil {
+			return nil, err
+		}
+		if err := record(model.ConsentAction_Paused, nil, "until/"+until.Format(time.RFC3339)); err != nil {
+			return nil, err
+		}
+		c.PausedUntil = &until
+	case in.Resume && c.Paused(now):
+		if _, err := s.contacts.SetPausedUntil(ctx, c.WorkspaceID, c.ID, nil); err != nil {
+			return nil, err
+		}
+		if err := record(model.ConsentAction_Resumed, nil, ""); err != nil {
+			return nil, err
+		}
+		c.PausedUntil = nil
+	}
+	return preferencesToProto(c, subs), nil
+}
+
+func preferencesToProto(c *model.Contact, subs []*model.ListSubscription) *proto.Preferences {
+	out := &proto.Preferences{Email: c.Email, Lang: c.Lang.String()}
+	for _, sub := range subs {
+		out.Lists = append(out.Lists, &proto.ListPreference{
+			ListId: sub.ListID.String(),
+			Name:   sub.Name,
+			Status: string(sub.Status),
+		})
+	}
+	if c.Paused(time.Now()) {
+		out.PausedUntil = timestamppb.New(*c.PausedUntil)
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type preferenceFixture struct {
+	svc          service.PreferenceService
+	contact      *model.Contact
+	news, offers uuid.UUID
+	suppressions *mockSuppressionRepo
+	consent      *mockConsentRepo
+	token        string
+}
+
+func newPreferenceFixture() *preferenceFixture {
+	workspace := uuid.New()
+	f := &preferenceFixture{
+		contact:      &model.Contact{ID: uuid.New(), WorkspaceID: workspace, Email: "ana@example.org", Lang: model.Language_EN, Status: model.ContactStatus_Active},
+		news:         uuid.New(),
+		offers:       uuid.New(),
+		suppressions: &mockSuppressionRepo{subscriptions: map[uuid.UUID]model.SubscriptionStatus{}},
+		consent:      &mockConsentRepo{},
+	}
+	contacts := &mockContactRepo{
+		contacts: []*model.Contact{f.contact},
+		subscriptions: []*model.ListSubscription{
+			{ListID: f.news, Name: "News", Status: model.SubscriptionStatus_Subscribed},
+			{ListID: f.offers, Name: "Offers", Status: model.SubscriptionStatus_Subscribed},
+		},
+	}
+	f.svc = service.NewPreferenceService(contacts, f.suppressions, f.consent, signedlink.New([]byte("k")), "https://mailer.example")
+	link, _ := url.Parse(f.svc.URL(&model.SendJob{WorkspaceID: workspace, ContactID: f.contact.ID, Email: f.contact.Email}))
+	f.token = link.Query().Get("token")
+	return f
+}
+
+func TestPreferences_Get(t *testing.T) {
+	f := newPreferenceFixture()
+	f.contact.Lang = model.Language_FA
+
+	prefs, err := f.svc.GetPreferences(context.Background(), &proto.GetPreferencesRequest{Token: f.token})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "ana@example.org", prefs.Email)
+	assert.Equal(t, "fa", prefs.Lang)
+	if assert.Len(t, prefs.Lists, 2) {
+		assert.Equal(t, &proto.ListPreference{ListId: f.news.String(), Name: "News", Status: "subscribed"}, prefs.Lists[0])
+	}
+	assert.Nil(t, prefs.PausedUntil)
+
+	_, err = f.svc.GetPreferences(context.Background(), &proto.GetPreferencesRequest{Token: "forged.token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestPreferences_Update(t *testing.T) {
+	ctx := context.Background()
+	f := newPreferenceFixture()
+	client := service.ClientInfo{IP: "203.0.113.7", UserAgent: "browser"}
+
+	prefs, err := f.svc.UpdatePreferences(ctx, client, &proto.UpdatePreferencesRequest{
+		Token:              f.token,
+		Lang:               "fa",
+		UnsubscribeListIds: []string{f.offers.String()},
+		PauseDays:          30,
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "fa", prefs.Lang)
+	assert.Equal(t, model.Language_FA, f.contact.Lang)
+	assert.Equal(t, "unsubscribed", prefs.Lists[1].Status)
+	assert.Equal(t, map[uuid.UUID]model.SubscriptionStatus{f.offers: model.SubscriptionStatus_Unsubscribed}, f.suppressions.subscriptions)
+	assert.True(t, f.contact.Paused(time.Now().AddDate(0, 0, 29)))
+	assert.False(t, f.contact.Paused(time.Now().AddDate(0, 0, 31)))
+	if assert.NotNil(t, prefs.PausedUntil) {
+		assert.Equal(t, *f.contact.PausedUntil, prefs.PausedUntil.AsTime())
+	}
+
+	if assert.Len(t, f.consent.records, 3) {
+		assert.Equal(t, model.ConsentAction_LanguageChanged, f.consent.records[0].Action)
+		assert.Equal(t, "preference_center:lang/fa", f.consent.records[0].Source)
+		assert.Equal(t, model.ConsentAction_Unsubscribed, f.consent.records[1].Action)
+		assert.Equal(t, &f.offers, f.consent.records[1].ListID)
+		assert.Equal(t, "preference_center", f.consent.records[1].Source)
+		assert.Equal(t, model.ConsentAction_Paused, f.consent.records[2].Action)
+		assert.Equal(t, "preference_center:until/"+f.contact.PausedUntil.Format(time.RFC3339), f.consent.records[2].Source)
+		for _, r := range f.consent.records {
+			assert.Equal(t, "203.0.113.7", r.IP)
+			assert.Equal(t, "browser", r.UserAgent)
+		}
+	}
+
+	// Saving the same preferences again records nothing.
+	_, err = f.svc.UpdatePreferences(ctx, client, &proto.UpdatePreferencesRequest{
+		Token:              f.token,
+		Lang:               "fa",
+		UnsubscribeListIds: []string{f.offers.String()},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, f.consent.records, 3)
+
+	prefs, err = f.svc.UpdatePreferences(ctx, client, &proto.UpdatePreferencesRequest{Token: f.token, Resume: true})
+	if assert.NoError(t, err) {
+		assert.Nil(t, prefs.PausedUntil)
+		assert.Nil(t, f.contact.PausedUntil)
+		assert.Equal(t, "fa", prefs.Lang)
+	}
+	if assert.Len(t, f.consent.records, 4) {
+		assert.Equal(t, model.ConsentAction_Resumed, f.consent.records[3].Action)
+	}
+}
+
+func TestPreferences_UpdateInvalid(t *testing.T) {
+	f := newPreferenceFixture()
+	for _, tc := range []struct {
+		in   *proto.UpdatePreferencesRequest
+		code codes.Code
+	}{
+		{&proto.UpdatePreferencesRequest{Token: "forged.token"}, codes.InvalidArgument},
+		{&proto.UpdatePreferencesRequest{Token: f.token, Lang: "de"}, codes.InvalidArgument},
+		{&proto.UpdatePreferencesRequest{Token: f.token, PauseDays: 366}, codes.InvalidArgument},
+		{&proto.UpdatePreferencesRequest{Token: f.token, PauseDays: 7, Resume: true}, codes.InvalidArgument},
+		{&proto.UpdatePreferencesRequest{Token: f.token, UnsubscribeListIds: []string{"news"}}, codes.InvalidArgument},
+		// Valid changes are not applied when others fail.
+		{&proto.UpdatePreferencesRequest{Token: f.token, Lang: "fa", UnsubscribeListIds: []string{uuid.NewString()}}, codes.NotFound},
+	} {
+		_, err := f.svc.UpdatePreferences(context.Background(), service.ClientInfo{}, tc.in)
+		assert.Equal(t, tc.code, status.Code(err), tc.in)
+	}
+	assert.Equal(t, model.Language_EN, f.contact.Lang)
+	assert.Empty(t, f.consent.records)
+}
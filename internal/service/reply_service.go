@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ReplyService defines business logic for the inbox of replies to
+// campaign emails, which InboundMail fills.
+type ReplyService interface {
+	ListReplies(ctx context.Context, workspaceID uuid.UUID, in *proto.ListRepliesRequest) (*proto.ListRepliesResponse, error)
+}
+
+type replyService struct {
+	repo repository.ReplyRepository
+}
+
+// NewReplyService constructs a new ReplyService.
+func NewReplyService(repo repository.ReplyRepository) ReplyService {
+	return &replyService{repo: repo}
+}
+
+func (s *replyService) ListReplies(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ListRepliesRequest,
+) (*proto.ListRepliesResponse, error) {
+	var campaignID *uuid.UUID
+	if in.CampaignId != "" {
+		id, err := parseCampaignID(in.CampaignId)
+		if err != nil {
+			return nil, err
+		}
+		campaignID = &id
+	}
+	limit, offset := pagination(in.PageSize, in.PageNumber)
+	items, err := s.repo.List(ctx, workspaceID, campaignID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListRepliesResponse{Replies: make([]*proto.Reply, 0, len(items))}
+	for _, item := range items {
+		out.Replies = append(out.Replies, replyToProto(item))
+	}
+	return out, nil
+}
+
+func replyToProto(r *model.Reply) *proto.Reply {
+	return &proto.Reply{
+		Id:         r.ID.String(),
+		CampaignId: r.CampaignID.String(),
+		ContactId:  r.ContactID.String(),
+		FromEmail:  r.FromEmail,
+		FromName:   r.FromName,
+		Subject:    r.Subject,
+		Text:       r.Text,
+		AutoReply:  r.AutoReply,
+		ReceivedAt: timestamppb.New(r.ReceivedAt),
+	}
+}
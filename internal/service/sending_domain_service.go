@@ -0,0 +1,270 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/domaincheck"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/secretbox"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultDKIMSelector names the DNS record of generated DKIM keys.
+const DefaultDKIMSelector = "em"
+
+// SendingDomainService manages the domains workspaces send from and their
+// DKIM keys.
+type SendingDomainService interface {
+	CreateSendingDomain(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateSendingDomainRequest) (*proto.SendingDomain, error)
+	GetSendingDomain(ctx context.Context, workspaceID uuid.UUID, in *proto.GetSendingDomainRequest) (*proto.SendingDomain, error)
+	ListSendingDomains(ctx context.Context, workspaceID uuid.UUID, in *proto.ListSendingDomainsRequest) (*proto.ListSendingDomainsResponse, error)
+	VerifySendingDomain(ctx context.Context, workspaceID uuid.UUID, in *proto.VerifySendingDomainRequest) (*proto.SendingDomain, error)
+	DeleteSendingDomain(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteSendingDomainRequest) (*proto.DeleteSendingDomainResponse, error)
+}
+
+type sendingDomainService struct {
+	repo       repository.SendingDomainRepository
+	verifier   DomainVerifier
+	box        *secretbox.Box
+	selector   string
+	alg        dkim.Algorithm
+	spfInclude string
+}
+
+// NewSendingDomainService constructs a new SendingDomainService. Private
+// keys are encrypted with box; a nil box disables creating domains. New
+// keys are published at selector and use alg unless the request picks
+// another algorithm. spfInclude is the domain listing our mail servers
+// that SPF records are asked to include.
+func NewSendingDomainService(
+	repo repository.SendingDomainRepository,
+	verifier DomainVerifier,
+	box *secretbox.Box,
+	selector string,
+	alg dkim.Algorithm,
+	spfInclude string,
+) SendingDomainService {
+	if selector == "" {
+		selector = DefaultDKIMSelector
+	}
+	if alg == "" {
+		alg = dkim.RSASHA256
+	}
+	return &sendingDomainService{
+		repo:       repo,
+		verifier:   verifier,
+		box:        box,
+		selector:   selector,
+		alg:        alg,
+		spfInclude: spfInclude,
+	}
+}
+
+// CreateSendingDomain generates a DKIM key and a verification token for
+// the domain. The key is stored encrypted.
+func (s *sendingDomainService) CreateSendingDomain(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.CreateSendingDomainRequest,
+) (*proto.SendingDomain, error) {
+	if s.box == nil {
+		return nil, status.Error(codes.FailedPrecondition, "DKIM signing is not configured")
+	}
+	domain, err := emailvalidation.NormalizeDomain(in.Domain)
+	if err != nil {
+		var verr *emailvalidation.Error
+		if errors.As(err, &verr) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid domain: %s", verr.Detail)
+		}
+		return nil, err
+	}
+	alg := s.alg
+	switch in.DkimAlgorithm {
+	case proto.DKIMAlgorithm_DKIM_ALGORITHM_RSA_SHA256:
+		alg = dkim.RSASHA256
+	case proto.DKIMAlgorithm_DKIM_ALGORITHM_ED25519_SHA256:
+		alg = dkim.Ed25519SHA256
+	}
+
+	key, err := dkim.GenerateKey(alg)
+	if err != nil {
+		return nil, fmt.Errorf("generate DKIM key: %w", err)
+	}
+	der, err := dkim.MarshalPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode DKIM key: %w", err)
+	}
+	record, err := dkim.TXTRecord(key)
+	if err != nil {
+		return nil, fmt.Errorf("encode DKIM key: %w", err)
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	d := &model.SendingDomain{
+		ID:                uuid.New(),
+		WorkspaceID:       workspaceID,
+		Domain:            domain,
+		DKIMSelector:      s.selector,
+		DKIMAlgorithm:     string(alg),
+		DKIMRecord:        record,
+		VerificationToken: hex.EncodeToString(token),
+		CreatedAt:         time.Now().UTC(),
+	}
+	// Binding the key to its row keeps it from being copied to another
+	// workspace's domain.
+	if d.DKIMPrivateKey, err = s.box.Seal(der, d.ID[:]); err != nil {
+		return nil, fmt.Errorf("encrypt DKIM key: %w", err)
+	}
+
+	out, err := s.repo.Create(ctx, d)
+	if errors.Is(err, repository.ErrSendingDomainExists) {
+		return nil, status.Errorf(codes.AlreadyExists, "sending domain %q already exists", domain)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.toProto(out), nil
+}
+
+func (s *sendingDomainService) GetSendingDomain(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.GetSendingDomainRequest,
+) (*proto.SendingDomain, error) {
+	d, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toProto(d), nil
+}
+
+func (s *sendingDomainService) ListSendingDomains(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ListSendingDomainsRequest,
+) (*proto.ListSendingDomainsResponse, error) {
+	items, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListSendingDomainsResponse{Domains: make([]*proto.SendingDomain, 0, len(items))}
+	for _, d := range items {
+		out.Domains = append(out.Domains, s.toProto(d))
+	}
+	return out, nil
+}
+
+// VerifySendingDomain checks the DNS records of the domain now.
+func (s *sendingDomainService) VerifySendingDomain(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.VerifySendingDomainRequest,
+) (*proto.SendingDomain, error) {
+	d, err := s.get(ctx, workspaceID, in.Id)
+	if err != nil {
+		return nil, err
+	}
+	out, err := s.verifier.Verify(ctx, d)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return nil, status.Error(codes.NotFound, "sending domain not found")
+	}
+	return s.toProto(out), nil
+}
+
+func (s *sendingDomainService) DeleteSendingDomain(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.DeleteSendingDomainRequest,
+) (*proto.DeleteSendingDomainResponse, error) {
+	id, err := uuid.Parse(in.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid sending domain id")
+	}
+	deleted, err := s.repo.Delete(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DeleteSendingDomainResponse{Deleted: deleted}, nil
+}
+
+func (s *sendingDomainService) get(ctx context.Context, workspaceID uuid.UUID, rawID string) (*model.SendingDomain, error) {
+	id, err := uuid.Parse(rawID)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid sending domain id")
+	}
+	d, err := s.repo.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		return nil, status.Error(codes.NotFound, "sending domain not found")
+	}
+	return d, nil
+}
+
+var sendingDomainStatuses = map[model.SendingDomainStatus]proto.SendingDomainStatus{
+	model.SendingDomainStatus_Pending:  proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_PENDING,
+	model.SendingDomainStatus_Verified: proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_VERIFIED,
+	model.SendingDomainStatus_Failed:   proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_FAILED,
+}
+
+func (s *sendingDomainService) toProto(d *model.SendingDomain) *proto.SendingDomain {
+	spf := "v=spf1 ~all"
+	if s.spfInclude != "" {
+		spf = "v=spf1 include:" + s.spfInclude + " ~all"
+	}
+	record := func(purpose, name, value string, check model.DomainCheck) *proto.DNSRecord {
+		return &proto.DNSRecord{
+			Type:    "TXT",
+			Name:    name,
+			Value:   value,
+			Purpose: purpose,
+			Valid:   check.OK,
+			Detail:  check.Detail,
+		}
+	}
+	out := &proto.SendingDomain{
+		Id:           d.ID.String(),
+		Domain:       d.Domain,
+		DkimSelector: d.DKIMSelector,
+		DnsRecords: []*proto.DNSRecord{
+			record("ownership", d.Domain, domaincheck.OwnershipRecord(d), d.Checks.Ownership),
+			record("spf", d.Domain, spf, d.Checks.SPF),
+			record("dkim", dkim.RecordName(d.DKIMSelector, d.Domain), d.DKIMRecord, d.Checks.DKIM),
+			record("dmarc", domaincheck.DMARCRecordName(d.Domain), "v=DMARC1; p=none", d.Checks.DMARC),
+		},
+		Status:    sendingDomainStatuses[d.Status],
+		CreatedAt: timestamppb.New(d.CreatedAt),
+		UpdatedAt: timestamppb.New(d.UpdatedAt),
+	}
+	if d.CheckedAt != nil {
+		out.CheckedAt = timestamppb.New(*d.CheckedAt)
+	}
+	if d.VerifiedAt != nil {
+		out.VerifiedAt = timestamppb.New(*d.VerifiedAt)
+	}
+	switch dkim.Algorithm(d.DKIMAlgorithm) {
+	case dkim.RSASHA256:
+		out.DkimAlgorithm = proto.DKIMAlgorithm_DKIM_ALGORITHM_RSA_SHA256
+	case dkim.Ed25519SHA256:
+		out.DkimAlgorithm = proto.DKIMAlgorithm_DKIM_ALGORITHM_ED25519_SHA256
+	}
+	return out
+}
@@ -0,0 +1,289 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/domaincheck"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/secretbox"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSendingDomainRepo is an in-memory repository.SendingDomainRepository
+type fakeSendingDomainRepo struct {
+	items map[uuid.UUID]*model.SendingDomain
+}
+
+func newFakeSendingDomainRepo() *fakeSendingDomainRepo {
+	return &fakeSendingDomainRepo{items: map[uuid.UUID]*model.SendingDomain{}}
+}
+
+func (f *fakeSendingDomainRepo) Create(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error) {
+	if existing, _ := f.GetByDomain(ctx, d.WorkspaceID, d.Domain); existing != nil {
+		return nil, repository.ErrSendingDomainExists
+	}
+	out := *d
+	out.Status = model.SendingDomainStatus_Pending
+	out.UpdatedAt = out.CreatedAt
+	f.items[out.ID] = &out
+	return &out, nil
+}
+func (f *fakeSendingDomainRepo) Get(ctx context.Context, workspaceID, id uuid.UUID) (*model.SendingDomain, error) {
+	d, ok := f.items[id]
+	if !ok || d.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	return d, nil
+}
+func (f *fakeSendingDomainRepo) GetByDomain(ctx context.Context, workspaceID uuid.UUID, domain string) (*model.SendingDomain, error) {
+	for _, d := range f.items {
+		if d.WorkspaceID == workspaceID && d.Domain == domain {
+			return d, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakeSendingDomainRepo) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.SendingDomain, error) {
+	var out []*model.SendingDomain
+	for _, d := range f.items {
+		if d.WorkspaceID == workspaceID {
+			out = append(out, d)
+		}
+	}
+	return out, nil
+}
+func (f *fakeSendingDomainRepo) Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error) {
+	d, ok := f.items[id]
+	if !ok || d.WorkspaceID != workspaceID {
+		return false, nil
+	}
+	delete(f.items, id)
+	return true, nil
+}
+func (f *fakeSendingDomainRepo) SaveChecks(ctx context.Context, d *model.SendingDomain) (*model.SendingDomain, error) {
+	if _, ok := f.items[d.ID]; !ok {
+		return nil, nil
+	}
+	out := *d
+	f.items[d.ID] = &out
+	return &out, nil
+}
+func (f *fakeSendingDomainRepo) ClaimDue(ctx context.Context, verifiedBefore, unverifiedBefore time.Time, limit int) ([]*model.SendingDomain, error) {
+	var out []*model.SendingDomain
+	now := time.Now()
+	for _, d := range f.items {
+		before := unverifiedBefore
+		if d.Status == model.SendingDomainStatus_Verified {
+			before = verifiedBefore
+		}
+		if len(out) < limit && (d.CheckedAt == nil || d.CheckedAt.Before(before)) {
+			d.CheckedAt = &now
+			cp := *d
+			out = append(out, &cp)
+		}
+	}
+	return out, nil
+}
+
+// dnsStub answers TXT lookups from the records of sending domains, the way
+// DNS would once they are published.
+type dnsStub map[string][]string
+
+func (r dnsStub) publish(d *proto.SendingDomain) {
+	for _, rec := range d.DnsRecords {
+		r[rec.Name] = append(r[rec.Name], rec.Value)
+	}
+}
+
+func (r dnsStub) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	txt, ok := r[name]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	return txt, nil
+}
+
+func (r dnsStub) LookupCNAME(ctx context.Context, host string) (string, error) {
+	return "", &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func dnsRecord(d *proto.SendingDomain, purpose string) *proto.DNSRecord {
+	for _, rec := range d.DnsRecords {
+		if rec.Purpose == purpose {
+			return rec
+		}
+	}
+	return nil
+}
+
+func newTestBox() *secretbox.Box {
+	box, _ := secretbox.New(bytes.Repeat([]byte{1}, secretbox.KeySize))
+	return box
+}
+
+func TestSendingDomainService_Create(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	repo := newFakeSendingDomainRepo()
+	svc := service.NewSendingDomainService(repo, nil, newTestBox(), "", "", "spf.mailer.example")
+
+	d, err := svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: " Acme.COM. "})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "acme.com", d.Domain)
+	assert.Equal(t, "em", d.DkimSelector)
+	assert.Equal(t, proto.DKIMAlgorithm_DKIM_ALGORITHM_RSA_SHA256, d.DkimAlgorithm)
+	assert.Equal(t, proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_PENDING, d.Status)
+	if rec := dnsRecord(d, "dkim"); assert.NotNil(t, rec) {
+		assert.Equal(t, "TXT", rec.Type)
+		assert.Equal(t, "em._domainkey.acme.com", rec.Name)
+		assert.True(t, strings.HasPrefix(rec.Value, "v=DKIM1; k=rsa; p="))
+	}
+	if rec := dnsRecord(d, "ownership"); assert.NotNil(t, rec) {
+		assert.Equal(t, "acme.com", rec.Name)
+		assert.Regexp(t, "^email-marketing-verification=[0-9a-f]{32}$", rec.Value)
+	}
+	assert.Equal(t, "v=spf1 include:spf.mailer.example ~all", dnsRecord(d, "spf").Value)
+	assert.Equal(t, "_dmarc.acme.com", dnsRecord(d, "dmarc").Name)
+	// The private key is only stored encrypted.
+	stored := repo.items[uuid.MustParse(d.Id)]
+	_, err = dkim.ParsePrivateKey(stored.DKIMPrivateKey)
+	assert.Error(t, err)
+
+	_, err = svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.com"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+	_, err = svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "not a domain"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	ed, err := svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{
+		Domain:        "news.acme.com",
+		DkimAlgorithm: proto.DKIMAlgorithm_DKIM_ALGORITHM_ED25519_SHA256,
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, proto.DKIMAlgorithm_DKIM_ALGORITHM_ED25519_SHA256, ed.DkimAlgorithm)
+		assert.True(t, strings.HasPrefix(dnsRecord(ed, "dkim").Value, "v=DKIM1; k=ed25519; p="))
+	}
+
+	list, _ := svc.ListSendingDomains(ctx, workspace, &proto.ListSendingDomainsRequest{})
+	assert.Len(t, list.Domains, 2)
+	_, err = svc.GetSendingDomain(ctx, uuid.New(), &proto.GetSendingDomainRequest{Id: d.Id})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	del, _ := svc.DeleteSendingDomain(ctx, workspace, &proto.DeleteSendingDomainRequest{Id: d.Id})
+	assert.True(t, del.Deleted)
+
+	unconfigured := service.NewSendingDomainService(repo, nil, nil, "", "", "")
+	_, err = unconfigured.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.org"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestSendingDomainService_Verify(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	repo := newFakeSendingDomainRepo()
+	campaigns := &fakeCampaignRepo{campaigns: map[uuid.UUID]*model.Campaign{}}
+	dns := dnsStub{"spf.mailer.example": {"v=spf1 ip4:198.51.100.0/24 -all"}}
+	verifier := service.NewDomainVerifier(repo, campaigns, domaincheck.New(dns, "spf.mailer.example"), service.DomainVerifierOptions{})
+	svc := service.NewSendingDomainService(repo, verifier, newTestBox(), "", dkim.Ed25519SHA256, "spf.mailer.example")
+
+	d, err := svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	// Nothing is published yet.
+	d, err = svc.VerifySendingDomain(ctx, workspace, &proto.VerifySendingDomainRequest{Id: d.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_PENDING, d.Status)
+	assert.NotNil(t, d.CheckedAt)
+	assert.Nil(t, d.VerifiedAt)
+	assert.False(t, dnsRecord(d, "dkim").Valid)
+	assert.Equal(t, "no DKIM record at em._domainkey.acme.com", dnsRecord(d, "dkim").Detail)
+
+	dns.publish(d)
+	d, err = svc.VerifySendingDomain(ctx, workspace, &proto.VerifySendingDomainRequest{Id: d.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_VERIFIED, d.Status)
+	assert.NotNil(t, d.VerifiedAt)
+	for _, rec := range d.DnsRecords {
+		assert.True(t, rec.Valid, rec.Purpose)
+	}
+
+	// Removing a record fails the domain and pauses its campaigns.
+	campaign := &model.Campaign{ID: uuid.New(), WorkspaceID: workspace, FromEmail: "news@acme.com", Status: model.CampaignStatus_Sending}
+	campaigns.campaigns[campaign.ID] = campaign
+	delete(dns, "_dmarc.acme.com")
+	d, err = svc.VerifySendingDomain(ctx, workspace, &proto.VerifySendingDomainRequest{Id: d.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.SendingDomainStatus_SENDING_DOMAIN_STATUS_FAILED, d.Status)
+	assert.Equal(t, model.CampaignStatus_Paused, campaign.Status)
+
+	// Domains never checked are due for a recheck.
+	_, _ = svc.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.org"})
+	n, err := verifier.RecheckDomains(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	n, _ = verifier.RecheckDomains(ctx)
+	assert.Equal(t, 0, n)
+}
+
+func TestMessageSigner(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	repo := newFakeSendingDomainRepo()
+	box := newTestBox()
+	domains := service.NewSendingDomainService(repo, nil, box, "s1", dkim.Ed25519SHA256, "")
+	signer := service.NewMessageSigner(repo, box)
+	msg := []byte("From: <news@acme.com>\r\nTo: <ana@example.org>\r\nSubject: Hi\r\n\r\nHello\r\n")
+
+	// Messages from domains without a key are sent unsigned.
+	out, err := signer.Sign(ctx, workspace, "news@acme.com", msg)
+	assert.NoError(t, err)
+	assert.Equal(t, msg, out)
+
+	for _, alg := range []proto.DKIMAlgorithm{proto.DKIMAlgorithm_DKIM_ALGORITHM_RSA_SHA256, proto.DKIMAlgorithm_DKIM_ALGORITHM_ED25519_SHA256} {
+		workspace := uuid.New()
+		d, err := domains.CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.com", DkimAlgorithm: alg})
+		if !assert.NoError(t, err) {
+			return
+		}
+		dns := dnsStub{}
+		dns.publish(d)
+
+		signed, err := signer.Sign(ctx, workspace, "News@ACME.com", msg)
+		if !assert.NoError(t, err) {
+			return
+		}
+		vs, err := dkim.Verify(ctx, dns, signed)
+		if assert.NoError(t, err) && assert.Len(t, vs, 1) {
+			assert.Equal(t, "acme.com", vs[0].Domain)
+			assert.Equal(t, "s1", vs[0].Selector)
+		}
+	}
+
+	// A key sealed for another row cannot be decrypted.
+	other := uuid.New()
+	d, _ := domains.CreateSendingDomain(ctx, other, &proto.CreateSendingDomainRequest{Domain: "acme.org"})
+	stored := repo.items[uuid.MustParse(d.Id)]
+	stored.ID = uuid.New()
+	repo.items[stored.ID] = stored
+	_, err = signer.Sign(ctx, other, "news@acme.org", msg)
+	assert.ErrorIs(t, err, secretbox.ErrDecrypt)
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	confirmPurpose  = "confirm_subscription"
+	confirmTokenTTL = 7 * 24 * time.Hour
+)
+
+// ClientInfo describes the caller of a public RPC for consent records.
+type ClientInfo struct {
+	IP        string
+	UserAgent string
+}
+
+// PendingSubscription is the subscription a confirmation link confirms.
+type PendingSubscription struct {
+	Email    string
+	ListName string
+	// Lang is the contact's language, for the confirmation page.
+	Lang model.Language
+}
+
+// SubscriptionService implements double opt-in subscriptions.
+type SubscriptionService interface {
+	Subscribe(ctx context.Context, client ClientInfo, in *proto.SubscribeRequest) (*proto.SubscribeResponse, error)
+	// LookupConfirmation verifies a confirmation token and returns the
+	// subscription it confirms, without confirming it.
+	LookupConfirmation(ctx context.Context, token string) (*PendingSubscription, error)
+	ConfirmSubscription(ctx context.Context, client ClientInfo, in *proto.ConfirmSubscriptionRequest) (*proto.ConfirmSubscriptionResponse, error)
+	GetConsentHistory(ctx context.Context, workspaceID uuid.UUID, in *proto.GetConsentHistoryRequest) (*proto.GetConsentHistoryResponse, error)
+}
+
+type subscriptionService struct {
+	contacts     repository.ContactRepository
+	consent      repository.ConsentRepository
+	suppressions SuppressionService
+	emails       EmailValidator
+	mailer       Mailer
+	signer       *signedlink.Signer
+	baseURL      string
+}
+
+// NewSubscriptionService constructs a new SubscriptionService. Confirmation
+// links point to baseURL and are signed with signer.
+func NewSubscriptionService(
+	contacts repository.ContactRepository,
+	consent repository.ConsentRepository,
+	suppressions SuppressionService,
+	emails EmailValidator,
+	mailer Mailer,
+	signer *signedlink.Signer,
+	baseURL string,
+) SubscriptionService {
+	return &subscriptionService{
+		contacts:     contacts,
+		consent:      consent,
+		suppressions: suppressions,
+		emails:       emails,
+		mailer:       mailer,
+		signer:       signer,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// Subscribe creates a pending contact on the list and emails a confirmation
+// link. Contacts already confirmed on the list are not emailed again, and
+// pending ones only once per confirmTokenTTL, while their earlier link is
+// still valid. Suppressed addresses fail with FAILED_PRECONDITION.
+func (s *subscriptionService) Subscribe(
+	ctx context.Context,
+	client ClientInfo,
+	in *proto.SubscribeRequest,
+) (*proto.SubscribeResponse, error) {
+	email, err := s.emails.Validate(ctx, in.Email)
+	if err != nil {
+		return nil, emailError(err)
+	}
+	listID, err := uuid.Parse(in.ListId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid list id")
+	}
+	list, err := s.contacts.GetListByID(ctx, listID)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, status.Error(codes.NotFound, "list not found")
+	}
+	sup, err := s.suppressions.CheckSuppressed(ctx, list.WorkspaceID, email)
+	if err != nil {
+		return nil, err
+	}
+	if sup != nil {
+		return nil, status.Error(codes.FailedPrecondition, "this address cannot be subscribed")
+	}
+
+	lang := model.Language_EN
+	if in.Lang == proto.Language_LANGUAGE_FA {
+		lang = model.Language_FA
+	}
+	c, err := s.contacts.CreatePending(ctx, &model.Contact{
+		WorkspaceID: list.WorkspaceID,
+		Email:       email,
+		FirstName:   strings.TrimSpace(in.FirstName),
+		LastName:    strings.TrimSpace(in.LastName),
+		Lang:        lang,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := s.contacts.AddPendingMembership(ctx, list.ID, c.ID)
+	if err != nil {
+		return nil, err
+	}
+	if st == model.SubscriptionStatus_Subscribed {
+		return &proto.SubscribeResponse{Status: string(st)}, nil
+	}
+	// The form is public, so anyone could use it to mail an address over
+	// and over.
+	recent, err := s.recentlyRequested(ctx, list.WorkspaceID, c.ID, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	if recent {
+		return &proto.SubscribeResponse{Status: string(st)}, nil
+	}
+
+	token := s.signer.Sign(confirmPurpose, map[string]string{
+		"contact": c.ID.String(),
+		"list":    list.ID.String(),
+		"source":  in.FormSource,
+	}, confirmTokenTTL)
+	link := s.baseURL + "/subscribe/confirm?token=" + url.QueryEscape(token)
+
+	// The stored contact language wins for returning contacts.
+	subject, body := confirmationMessage(c.Lang, list.Name, link)
+	if err := s.mailer.Send(ctx, &Message{To: c.Email, Subject: subject, TextBody: body}); err != nil {
+		return nil, fmt.Errorf("send confirmation: %w", err)
+	}
+	// Recorded once the email is out, so a failed send neither claims a
+	// request nor throttles the next attempt.
+	err = s.consent.Record(ctx, &model.ConsentRecord{
+		WorkspaceID: list.WorkspaceID,
+		ContactID:   c.ID,
+		ListID:      &list.ID,
+		Action:      model.ConsentAction_SubscribeRequested,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		Source:      in.FormSource,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proto.SubscribeResponse{Status: string(model.SubscriptionStatus_Pending)}, nil
+}
+
+// ConfirmSubscription verifies a confirmation token, activates the pending
+// subscription and records the consent. Confirming an active subscription
+// again succeeds without a record; one that is no longer pending, or an
+// address suppressed since, fails with FAILED_PRECONDITION.
+func (s *subscriptionService) ConfirmSubscription(
+	ctx context.Context,
+	client ClientInfo,
+	in *proto.ConfirmSubscriptionRequest,
+) (*proto.ConfirmSubscriptionResponse, error) {
+	claims, contactID, list, err := s.verifyConfirmation(ctx, in.Token)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.contacts.GetContact(ctx, list.WorkspaceID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "contact not found")
+	}
+	// The address may have been suppressed since the link was sent.
+	sup, err := s.suppressions.CheckSuppressed(ctx, list.WorkspaceID, c.Email)
+	if err != nil {
+		return nil, err
+	}
+	if sup != nil {
+		return nil, status.Error(codes.FailedPrecondition, "this address cannot be subscribed")
+	}
+	confirmed, err := s.contacts.ConfirmSubscription(ctx, list.WorkspaceID, contactID, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmed {
+		// A link followed twice confirms nothing new. One followed after
+		// unsubscribing must not subscribe again.
+		subscribed, err := s.isSubscribed(ctx, list.WorkspaceID, contactID, list.ID)
+		if err != nil {
+			return nil, err
+		}
+		if !subscribed {
+			return nil, status.Error(codes.FailedPrecondition, "subscription is no longer pending")
+		}
+		return &proto.ConfirmSubscriptionResponse{
+			ContactId: contactID.String(),
+			ListId:    list.ID.String(),
+		}, nil
+	}
+
+	err = s.consent.Record(ctx, &model.ConsentRecord{
+		WorkspaceID: list.WorkspaceID,
+		ContactID:   contactID,
+		ListID:      &list.ID,
+		Action:      model.ConsentAction_Confirmed,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		Source:      claims["source"],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &proto.ConfirmSubscriptionResponse{
+		ContactId: contactID.String(),
+		ListId:    list.ID.String(),
+	}, nil
+}
+
+func (s *subscriptionService) LookupConfirmation(ctx context.Context, token string) (*PendingSubscription, error) {
+	_, contactID, list, err := s.verifyConfirmation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	c, err := s.contacts.GetContact(ctx, list.WorkspaceID, contactID)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "contact not found")
+	}
+	return &PendingSubscription{Email: c.Email, ListName: list.Name, Lang: c.Lang}, nil
+}
+
+func (s *subscriptionService) isSubscribed(ctx context.Context, workspaceID, contactID, listID uuid.UUID) (bool, error) {
+	subs, err := s.contacts.ListSubscriptions(ctx, workspaceID, contactID)
+	if err != nil {
+		return false, err
+	}
+	for _, sub := range subs {
+		if sub.ListID == listID {
+			return sub.Status == model.SubscriptionStatus_Subscribed, nil
+		}
+	}
+	return false, nil
+}
+
+// verifyConfirmation verifies a confirmation token and returns its claims,
+// contact and list.
+func (s *subscriptionService) verifyConfirmation(
+	ctx context.Context,
+	token string,
+) (map[string]string, uuid.UUID, *model.List, error) {
+	claims, err := s.signer.Verify(confirmPurpose, token)
+	if err != nil {
+		if errors.Is(err, signedlink.ErrExpired) {
+			return nil, uuid.Nil, nil, status.Error(codes.FailedPrecondition, "confirmation link expired")
+		}
+		return nil, uuid.Nil, nil, status.Error(codes.InvalidArgument, "invalid confirmation link")
+	}
+	contactID, err1 := uuid.Parse(claims["contact"])
+	listID, err2 := uuid.Parse(claims["list"])
+	if err1 != nil || err2 != nil {
+		return nil, uuid.Nil, nil, status.Error(codes.InvalidArgument, "invalid confirmation link")
+	}
+	list, err := s.contacts.GetListByID(ctx, listID)
+	if err != nil {
+		return nil, uuid.Nil, nil, err
+	}
+	if list == nil {
+		return nil, uuid.Nil, nil, status.Error(codes.NotFound, "list not found")
+	}
+	return claims, contactID, list, nil
+}
+
+// recentlyRequested reports whether a confirmation of the contact's
+// subscription to the list was requested within confirmTokenTTL.
+func (s *subscriptionService) recentlyRequested(ctx context.Context, workspaceID, contactID, listID uuid.UUID) (bool, error) {
+	records, err := s.consent.ListByContact(ctx, workspaceID, contactID)
+	if err != nil {
+		return false, err
+	}
+	since := time.Now().Add(-confirmTokenTTL)
+	for _, r := range records {
+		if r.Action == model.ConsentAction_SubscribeRequested && r.ListID != nil && *r.ListID == listID &&
+			r.CreatedAt.After(since) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *subscriptionService) GetConsentHistory(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.GetConsentHistoryRequest,
+) (*proto.GetConsentHistoryResponse, error) {
+	contactID, err := uuid.Parse(in.ContactId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid contact id")
+	}
+	records, err := s.consent.ListByContact(ctx, workspaceID, contactID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &proto.GetConsentHistoryResponse{Records: make([]*proto.ConsentRecord, 0, len(records))}
+	for _, r := range records {
+		rec := &proto.ConsentRecord{
+			Id:        r.ID.String(),
+			ContactId: r.ContactID.String(),
+			Action:    string(r.Action),
+			Ip:        r.IP,
+			UserAgent: r.UserAgent,
+			Source:    r.Source,
+			CreatedAt: timestamppb.New(r.CreatedAt),
+		}
+		if r.ListID != nil {
+			rec.ListId = r.ListID.String()
+		}
+		out.Records = append(out.Records, rec)
+	}
+	return out, nil
+}
+
+// confirmationMessage returns the subject and plain-text body of the
+// confirmation email in the contact's language.
+func confirmationMessage(lang model.Language, listName, link string) (string, string) {
+	if lang == model.Language_FA {
+		subject := "لطفاً عضویت خود را تأیید کنید"
+		body := fmt.Sprintf(
+			"سلام،\n\nبرای تأیید عضویت در «%s» روی پیوند زیر کلیک کنید:\n\n%s\n\nاگر شما این درخواست را نداده‌اید، این ایمیل را نادیده بگیرید.\n",
+			listName, link)
+		return subject, body
+	}
+	subject := "Please confirm your subscription"
+	body := fmt.Sprintf(
+		"Hello,\n\nPlease confirm your subscription to %q by opening the link below:\n\n%s\n\nIf you did not request this, you can ignore this email.\n",
+		listName, link)
+	return subject, body
+}
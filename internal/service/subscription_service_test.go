@@ -0,0 +1,281 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/SinaHo/email-marketing-backend/internal/handler"
+	"github.com/SinaHo/email-marketing-backend/internal/middleware"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockConsentRepo implements repository.ConsentRepository for unit testing
+type mockConsentRepo struct {
+	records []*model.ConsentRecord
+}
+
+func (m *mockConsentRepo) Record(ctx context.Context, rec *model.ConsentRecord) error {
+	rec.CreatedAt = time.Now()
+	m.records = append(m.records, rec)
+	return nil
+}
+func (m *mockConsentRepo) ListByContact(ctx context.Context, workspaceID, contactID uuid.UUID) ([]*model.ConsentRecord, error) {
+	return m.records, nil
+}
+
+// mockMailer implements service.Mailer and captures sent messages
+type mockMailer struct {
+	to, subject, body string
+	html              string
+	sent              int
+	err               error
+}
+
+func (m *mockMailer) Send(ctx context.Context, msg *service.Message) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.to, m.subject, m.body, m.html = msg.To, msg.Subject, msg.TextBody, msg.HTMLBody
+	m.sent++
+	return nil
+}
+
+func TestSubscribe_DoubleOptIn(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace, Name: "News"}},
+	}
+	consent := &mockConsentRepo{}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, consent, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com/")
+
+	resp, err := svc.Subscribe(ctx, service.ClientInfo{IP: "203.0.113.7", UserAgent: "form"}, &proto.SubscribeRequest{
+		ListId:     listID.String(),
+		Email:      " Sara@Example.com ",
+		Lang:       proto.Language_LANGUAGE_FA,
+		FormSource: "footer",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "pending", resp.Status)
+	assert.Equal(t, "sara@example.com", contacts.created.Email)
+	assert.Equal(t, model.Language_FA, contacts.created.Lang)
+	assert.Equal(t, "sara@example.com", mailer.to)
+	assert.Contains(t, mailer.subject, "تأیید")
+	assert.Len(t, consent.records, 1)
+	assert.Equal(t, model.ConsentAction_SubscribeRequested, consent.records[0].Action)
+
+	// Follow the emailed link.
+	i := strings.Index(mailer.body, "https://example.com/subscribe/confirm?token=")
+	assert.GreaterOrEqual(t, i, 0)
+	link, err := url.Parse(strings.Fields(mailer.body[i:])[0])
+	assert.NoError(t, err)
+
+	conf, err := svc.ConfirmSubscription(ctx, service.ClientInfo{IP: "198.51.100.1", UserAgent: "browser"}, &proto.ConfirmSubscriptionRequest{
+		Token: link.Query().Get("token"),
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, contacts.created.ID.String(), conf.ContactId)
+	assert.Equal(t, [2]uuid.UUID{contacts.created.ID, listID}, contacts.confirmed)
+	assert.Len(t, consent.records, 2)
+	rec := consent.records[1]
+	assert.Equal(t, model.ConsentAction_Confirmed, rec.Action)
+	assert.Equal(t, "198.51.100.1", rec.IP)
+	assert.Equal(t, "browser", rec.UserAgent)
+	assert.Equal(t, "footer", rec.Source)
+	assert.Equal(t, workspace, rec.WorkspaceID)
+}
+
+func TestSubscribe_AlreadySubscribed(t *testing.T) {
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists:            map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: uuid.New()}},
+		membershipStatus: model.SubscriptionStatus_Subscribed,
+	}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, &mockConsentRepo{}, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+
+	resp, err := svc.Subscribe(context.Background(), service.ClientInfo{}, &proto.SubscribeRequest{
+		ListId: listID.String(),
+		Email:  "a@example.com",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "subscribed", resp.Status)
+	assert.Equal(t, 0, mailer.sent)
+}
+
+func TestConfirmSubscription_InvalidToken(t *testing.T) {
+	svc := service.NewSubscriptionService(&mockContactRepo{}, &mockConsentRepo{}, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), &mockMailer{}, signedlink.New([]byte("k")), "")
+
+	_, err := svc.ConfirmSubscription(context.Background(), service.ClientInfo{}, &proto.ConfirmSubscriptionRequest{Token: "forged.token"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestSubscribe_ConfirmLink(t *testing.T) {
+	workspace := uuid.New()
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: workspace, Name: "News"}},
+	}
+	consent := &mockConsentRepo{}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, consent, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+	_, err := svc.Subscribe(context.Background(), service.ClientInfo{}, &proto.SubscribeRequest{ListId: listID.String(), Email: "sara@example.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Follow the emailed link to the page the server serves it with.
+	proxies, _ := middleware.ParseTrustedProxies(nil)
+	mux := http.NewServeMux()
+	mux.Handle("/subscribe/confirm", handler.NewSubscriptionConfirmPage(svc))
+	page := middleware.ClientIPHandler(proxies, mux)
+	i := strings.Index(mailer.body, "https://example.com/subscribe/confirm?token=")
+	if !assert.GreaterOrEqual(t, i, 0) {
+		return
+	}
+	link := strings.Fields(mailer.body[i:])[0]
+
+	// Opening the link does not confirm, so scanners cannot.
+	w := httptest.NewRecorder()
+	page.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `<form method="post"`)
+	assert.Equal(t, [2]uuid.UUID{}, contacts.confirmed)
+
+	r := httptest.NewRequest(http.MethodPost, link, nil)
+	r.RemoteAddr = "198.51.100.1:5000"
+	r.Header.Set("User-Agent", "browser")
+	w = httptest.NewRecorder()
+	page.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "is now subscribed")
+	assert.Equal(t, [2]uuid.UUID{contacts.created.ID, listID}, contacts.confirmed)
+	if assert.Len(t, consent.records, 2) {
+		rec := consent.records[1]
+		assert.Equal(t, model.ConsentAction_Confirmed, rec.Action)
+		assert.Equal(t, "198.51.100.1", rec.IP)
+		assert.Equal(t, "browser", rec.UserAgent)
+	}
+
+	w = httptest.NewRecorder()
+	page.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/subscribe/confirm?token=forged.token", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConfirmSubscription_Replay(t *testing.T) {
+	ctx := context.Background()
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: uuid.New()}},
+	}
+	consent := &mockConsentRepo{}
+	suppressions := &mockSuppressionRepo{}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, consent, service.NewSuppressionService(suppressions), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+	_, err := svc.Subscribe(ctx, service.ClientInfo{}, &proto.SubscribeRequest{ListId: listID.String(), Email: "sara@example.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	link, err := url.Parse(strings.Fields(mailer.body[strings.Index(mailer.body, "https://"):])[0])
+	if !assert.NoError(t, err) {
+		return
+	}
+	req := &proto.ConfirmSubscriptionRequest{Token: link.Query().Get("token")}
+
+	// Suppressed since the link was sent.
+	suppressions.matchResult = &model.Suppression{Reason: model.SuppressionReason_Complaint}
+	_, err = svc.ConfirmSubscription(ctx, service.ClientInfo{}, req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, model.SubscriptionStatus_Pending, contacts.membershipStatus)
+	suppressions.matchResult = nil
+
+	_, err = svc.ConfirmSubscription(ctx, service.ClientInfo{}, req)
+	assert.NoError(t, err)
+	assert.Len(t, consent.records, 2)
+
+	// Following the link twice confirms nothing new.
+	contacts.subscriptions = []*model.ListSubscription{{ListID: listID, Status: model.SubscriptionStatus_Subscribed}}
+	_, err = svc.ConfirmSubscription(ctx, service.ClientInfo{}, req)
+	assert.NoError(t, err)
+	assert.Len(t, consent.records, 2)
+
+	// Nor does following it after unsubscribing.
+	contacts.membershipStatus = model.SubscriptionStatus_Unsubscribed
+	contacts.subscriptions[0].Status = model.SubscriptionStatus_Unsubscribed
+	_, err = svc.ConfirmSubscription(ctx, service.ClientInfo{}, req)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, model.SubscriptionStatus_Unsubscribed, contacts.membershipStatus)
+	assert.Len(t, consent.records, 2)
+}
+
+func TestSubscribe_Suppressed(t *testing.T) {
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: uuid.New()}},
+	}
+	suppressions := &mockSuppressionRepo{matchResult: &model.Suppression{Reason: model.SuppressionReason_HardBounce}}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, &mockConsentRepo{}, service.NewSuppressionService(suppressions), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+
+	_, err := svc.Subscribe(context.Background(), service.ClientInfo{}, &proto.SubscribeRequest{ListId: listID.String(), Email: "Gone@Example.com"})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, "gone@example.com", suppressions.matchedEmail)
+	assert.Nil(t, contacts.created)
+	assert.Equal(t, 0, mailer.sent)
+}
+
+func TestSubscribe_ThrottlesConfirmations(t *testing.T) {
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: uuid.New()}},
+	}
+	consent := &mockConsentRepo{}
+	mailer := &mockMailer{}
+	svc := service.NewSubscriptionService(contacts, consent, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+
+	for range 3 {
+		resp, err := svc.Subscribe(context.Background(), service.ClientInfo{}, &proto.SubscribeRequest{ListId: listID.String(), Email: "a@example.com"})
+		assert.NoError(t, err)
+		assert.Equal(t, "pending", resp.Status)
+	}
+	assert.Equal(t, 1, mailer.sent)
+	assert.Len(t, consent.records, 1)
+}
+
+func TestSubscribe_SendFails(t *testing.T) {
+	listID := uuid.New()
+	contacts := &mockContactRepo{
+		lists: map[uuid.UUID]*model.List{listID: {ID: listID, WorkspaceID: uuid.New()}},
+	}
+	consent := &mockConsentRepo{}
+	mailer := &mockMailer{err: errors.New("smtp down")}
+	svc := service.NewSubscriptionService(contacts, consent, service.NewSuppressionService(&mockSuppressionRepo{}), emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com")
+
+	req := &proto.SubscribeRequest{ListId: listID.String(), Email: "a@example.com"}
+	_, err := svc.Subscribe(context.Background(), service.ClientInfo{}, req)
+	assert.Error(t, err)
+	assert.Empty(t, consent.records)
+
+	// Nothing was sent, so trying again is not throttled.
+	mailer.err = nil
+	_, err = svc.Subscribe(context.Background(), service.ClientInfo{}, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mailer.sent)
+	assert.Len(t, consent.records, 1)
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// SuppressionService defines business logic for the suppression list.
+type SuppressionService interface {
+	AddSuppression(ctx context.Context, workspaceID uuid.UUID, in *proto.AddSuppressionRequest) (*proto.Suppression, error)
+	RemoveSuppression(ctx context.Context, workspaceID uuid.UUID, in *proto.RemoveSuppressionRequest) (*proto.RemoveSuppressionResponse, error)
+	ListSuppressions(ctx context.Context, workspaceID uuid.UUID, in *proto.ListSuppressionsRequest) (*proto.ListSuppressionsResponse, error)
+	// ImportSuppressionBatch imports one streamed batch. offset is the number
+	// of entries received in earlier batches and is used to index errors.
+	ImportSuppressionBatch(ctx context.Context, workspaceID uuid.UUID, in *proto.ImportSuppressionsRequest, offset int) (*proto.ImportSuppressionsResponse, error)
+	SetListSubscription(ctx context.Context, workspaceID uuid.UUID, in *proto.SetListSubscriptionRequest) (*proto.SetListSubscriptionResponse, error)
+	// CheckSuppressed returns the suppression that blocks sending to email, or
+	// nil if the address may be mailed. Every send path must call it.
+	CheckSuppressed(ctx context.Context, workspaceID uuid.UUID, email string) (*model.Suppression, error)
+}
+
+type suppressionService struct {
+	repo repository.SuppressionRepository
+}
+
+// NewSuppressionService constructs a new SuppressionService.
+func NewSuppressionService(repo repository.SuppressionRepository) SuppressionService {
+	return &suppressionService{repo: repo}
+}
+
+func (s *suppressionService) AddSuppression(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.AddSuppressionRequest,
+) (*proto.Suppression, error) {
+	sup, err := suppressionFromProto(workspaceID, in)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	out, err := s.repo.Add(ctx, sup)
+	if err != nil {
+		return nil, err
+	}
+	return suppressionToProto(out), nil
+}
+
+func (s *suppressionService) RemoveSuppression(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.RemoveSuppressionRequest,
+) (*proto.RemoveSuppressionResponse, error) {
+	kind := suppressionKindFromProto(in.Kind)
+	value, err := normalizeSuppressionValue(kind, in.Value)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	removed, err := s.repo.Remove(ctx, workspaceID, kind, value)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.RemoveSuppressionResponse{Removed: removed}, nil
+}
+
+func (s *suppressionService) ListSuppressions(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ListSuppressionsRequest,
+) (*proto.ListSuppressionsResponse, error) {
+	limit, offset := pagination(in.PageSize, in.PageNumber)
+	items, err := s.repo.List(ctx, workspaceID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListSuppressionsResponse{Suppressions: make([]*proto.Suppression, 0, len(items))}
+	for _, item := range items {
+		out.Suppressions = append(out.Suppressions, suppressionToProto(item))
+	}
+	return out, nil
+}
+
+func (s *suppressionService) ImportSuppressionBatch(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ImportSuppressionsRequest,
+	offset int,
+) (*proto.ImportSuppressionsResponse, error) {
+	out := &proto.ImportSuppressionsResponse{Received: int32(len(in.Suppressions))}
+
+	valid := make([]*model.Suppression, 0, len(in.Suppressions))
+	for i, item := range in.Suppressions {
+		sup, err := suppressionFromProto(workspaceID, item)
+		if err != nil {
+			out.Errors = append(out.Errors, &proto.ImportSuppressionError{
+				Index:  int32(offset + i),
+				Value:  item.Value,
+				Reason: err.Error(),
+			})
+			continue
+		}
+		valid = append(valid, sup)
+	}
+	if len(valid) == 0 {
+		return out, nil
+	}
+
+	inserted, err := s.repo.BulkAdd(ctx, valid)
+	if err != nil {
+		return nil, err
+	}
+	out.Imported = int32(inserted)
+	out.Duplicates = int32(len(valid) - inserted)
+	return out, nil
+}
+
+func (s *suppressionService) SetListSubscription(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.SetListSubscriptionRequest,
+) (*proto.SetListSubscriptionResponse, error) {
+	listID, err := uuid.Parse(in.ListId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid list id")
+	}
+	contactID, err := uuid.Parse(in.ContactId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid contact id")
+	}
+
+	var st model.SubscriptionStatus
+	switch in.Status {
+	case proto.SubscriptionStatus_SUBSCRIPTION_STATUS_UNSUBSCRIBED:
+		st = model.SubscriptionStatus_Unsubscribed
+	case proto.SubscriptionStatus_SUBSCRIPTION_STATUS_PENDING:
+		st = model.SubscriptionStatus_Pending
+	default:
+		st = model.SubscriptionStatus_Subscribed
+	}
+
+	found, err := s.repo.SetSubscriptionStatus(ctx, workspaceID, listID, contactID, st)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, status.Error(codes.NotFound, "list membership not found")
+	}
+	return &proto.SetListSubscriptionResponse{}, nil
+}
+
+func (s *suppressionService) CheckSuppressed(ctx context.Context, workspaceID uuid.UUID, email string) (*model.Suppression, error) {
+	addr, err := normalizeSuppressionValue(model.SuppressionKind_Email, email)
+	if err != nil {
+		return nil, err
+	}
+	domain := addr[strings.LastIndexByte(addr, '@')+1:]
+	return s.repo.Match(ctx, workspaceID, addr, domain)
+}
+
+// normalizeSuppressionValue canonicalises an email address or domain so that
+// lookups are case-insensitive.
+func normalizeSuppressionValue(kind model.SuppressionKind, value string) (string, error) {
+	v := strings.ToLower(strings.TrimSpace(value))
+	switch kind {
+	case model.SuppressionKind_Email:
+		at := strings.LastIndexByte(v, '@')
+		if at <= 0 || at == len(v)-1 {
+			return "", status.Errorf(codes.InvalidArgument, "invalid email address %q", value)
+		}
+	case model.SuppressionKind_Domain:
+		v = strings.TrimPrefix(v, "@")
+		if v == "" || strings.ContainsAny(v, "@ ") {
+			return "", status.Errorf(codes.InvalidArgument, "invalid domain %q", value)
+		}
+	}
+	return v, nil
+}
+
+func suppressionFromProto(workspaceID uuid.UUID, in *proto.AddSuppressionRequest) (*model.Suppression, error) {
+	kind := suppressionKindFromProto(in.Kind)
+	value, err := normalizeSuppressionValue(kind, in.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var reason model.SuppressionReason
+	switch in.Reason {
+	case proto.SuppressionReason_SUPPRESSION_REASON_UNSUBSCRIBED:
+		reason = model.SuppressionReason_Unsubscribed
+	case proto.SuppressionReason_SUPPRESSION_REASON_HARD_BOUNCE:
+		reason = model.SuppressionReason_HardBounce
+	case proto.SuppressionReason_SUPPRESSION_REASON_SOFT_BOUNCE:
+		reason = model.SuppressionReason_SoftBounce
+	case proto.SuppressionReason_SUPPRESSION_REASON_COMPLAINT:
+		reason = model.SuppressionReason_Complaint
+	default:
+		reason = model.SuppressionReason_Manual
+	}
+
+	source := in.Source
+	if source == "" {
+		source = "api"
+	}
+	return &model.Suppression{
+		WorkspaceID: workspaceID,
+		Kind:        kind,
+		Value:       value,
+		Reason:      reason,
+		Source:      source,
+	}, nil
+}
+
+func suppressionKindFromProto(k proto.SuppressionKind) model.SuppressionKind {
+	if k == proto.SuppressionKind_SUPPRESSION_KIND_DOMAIN {
+		return model.SuppressionKind_Domain
+	}
+	return model.SuppressionKind_Email
+}
+
+func suppressionToProto(s *model.Suppression) *proto.Suppression {
+	out := &proto.Suppression{
+		Id:        s.ID.String(),
+		Kind:      proto.SuppressionKind_SUPPRESSION_KIND_EMAIL,
+		Value:     s.Value,
+		Source:    s.Source,
+		CreatedAt: timestamppb.New(s.CreatedAt),
+	}
+	if s.Kind == model.SuppressionKind_Domain {
+		out.Kind = proto.SuppressionKind_SUPPRESSION_KIND_DOMAIN
+	}
+	switch s.Reason {
+	case model.SuppressionReason_Unsubscribed:
+		out.Reason = proto.SuppressionReason_SUPPRESSION_REASON_UNSUBSCRIBED
+	case model.SuppressionReason_HardBounce:
+		out.Reason = proto.SuppressionReason_SUPPRESSION_REASON_HARD_BOUNCE
+	case model.SuppressionReason_SoftBounce:
+		out.Reason = proto.SuppressionReason_SUPPRESSION_REASON_SOFT_BOUNCE
+	case model.SuppressionReason_Complaint:
+		out.Reason = proto.SuppressionReason_SUPPRESSION_REASON_COMPLAINT
+	default:
+		out.Reason = proto.SuppressionReason_SUPPRESSION_REASON_MANUAL
+	}
+	return out
+}
+
+// pagination converts 1-based page parameters into LIMIT/OFFSET values.
+func pagination(pageSize, pageNumber int32) (int, int) {
+	limit := int(pageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	page := int(pageNumber)
+	if page < 1 {
+		page = 1
+	}
+	return limit, (page - 1) * limit
+}
@@ -0,0 +1,104 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// mockSuppressionRepo implements repository.SuppressionRepository for unit testing
+type mockSuppressionRepo struct {
+	// capture inputs
+	added         []*model.Suppression
+	matchedEmail  string
+	matchedDomain string
+	// control outputs
+	bulkInserted int
+	matchResult  *model.Suppression
+	// subscriptions records list subscription changes by list ID.
+	subscriptions map[uuid.UUID]model.SubscriptionStatus
+}
+
+func (m *mockSuppressionRepo) Add(ctx context.Context, s *model.Suppression) (*model.Suppression, error) {
+	m.added = append(m.added, s)
+	out := *s
+	out.ID = uuid.New()
+	return &out, nil
+}
+func (m *mockSuppressionRepo) BulkAdd(ctx context.Context, items []*model.Suppression) (int, error) {
+	m.added = append(m.added, items...)
+	return m.bulkInserted, nil
+}
+func (m *mockSuppressionRepo) Remove(ctx context.Context, workspaceID uuid.UUID, kind model.SuppressionKind, value string) (bool, error) {
+	return true, nil
+}
+func (m *mockSuppressionRepo) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Suppression, error) {
+	return nil, nil
+}
+func (m *mockSuppressionRepo) Match(ctx context.Context, workspaceID uuid.UUID, email, domain string) (*model.Suppression, error) {
+	m.matchedEmail = email
+	m.matchedDomain = domain
+	return m.matchResult, nil
+}
+func (m *mockSuppressionRepo) SetSubscriptionStatus(ctx context.Context, workspaceID, listID, contactID uuid.UUID, status model.SubscriptionStatus) (bool, error) {
+	if m.subscriptions == nil {
+		return false, nil
+	}
+	m.subscriptions[listID] = status
+	return true, nil
+}
+
+func TestAddSuppression_NormalizesValue(t *testing.T) {
+	repo := &mockSuppressionRepo{}
+	svc := service.NewSuppressionService(repo)
+
+	resp, err := svc.AddSuppression(context.Background(), uuid.New(), &proto.AddSuppressionRequest{
+		Kind:   proto.SuppressionKind_SUPPRESSION_KIND_DOMAIN,
+		Value:  " @Example.COM ",
+		Reason: proto.SuppressionReason_SUPPRESSION_REASON_COMPLAINT,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com", resp.Value)
+	assert.Equal(t, proto.SuppressionReason_SUPPRESSION_REASON_COMPLAINT, resp.Reason)
+	assert.Equal(t, "api", repo.added[0].Source)
+}
+
+func TestImportSuppressionBatch(t *testing.T) {
+	repo := &mockSuppressionRepo{bulkInserted: 1}
+	svc := service.NewSuppressionService(repo)
+
+	resp, err := svc.ImportSuppressionBatch(context.Background(), uuid.New(), &proto.ImportSuppressionsRequest{
+		Suppressions: []*proto.AddSuppressionRequest{
+			{Value: "a@example.com"},
+			{Value: "not-an-email"},
+			{Value: "A@example.com"},
+		},
+	}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), resp.Received)
+	assert.Equal(t, int32(1), resp.Imported)
+	assert.Equal(t, int32(1), resp.Duplicates)
+	assert.Len(t, resp.Errors, 1)
+	assert.Equal(t, int32(11), resp.Errors[0].Index)
+}
+
+func TestCheckSuppressed(t *testing.T) {
+	repo := &mockSuppressionRepo{matchResult: &model.Suppression{Reason: model.SuppressionReason_HardBounce}}
+	svc := service.NewSuppressionService(repo)
+
+	sup, err := svc.CheckSuppressed(context.Background(), uuid.New(), "Bob@Mail.Example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, model.SuppressionReason_HardBounce, sup.Reason)
+	assert.Equal(t, "bob@mail.example.com", repo.matchedEmail)
+	assert.Equal(t, "mail.example.com", repo.matchedDomain)
+
+	_, err = svc.CheckSuppressed(context.Background(), uuid.New(), "nobody")
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxTagNameLength  = 64
+	maxTagContactIDs  = 10000
+	maxTagsPerRequest = 50
+)
+
+// TagService defines business logic for contact tags.
+type TagService interface {
+	CreateTag(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateTagRequest) (*proto.Tag, error)
+	ListTags(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTagsRequest) (*proto.ListTagsResponse, error)
+	DeleteTag(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteTagRequest) (*proto.DeleteTagResponse, error)
+	TagContacts(ctx context.Context, workspaceID uuid.UUID, in *proto.TagContactsRequest) (*proto.TagContactsResponse, error)
+	UntagContacts(ctx context.Context, workspaceID uuid.UUID, in *proto.TagContactsRequest) (*proto.TagContactsResponse, error)
+}
+
+type tagService struct {
+	tags     repository.TagRepository
+	contacts repository.ContactRepository
+}
+
+// NewTagService constructs a new TagService.
+func NewTagService(tags repository.TagRepository, contacts repository.ContactRepository) TagService {
+	return &tagService{tags: tags, contacts: contacts}
+}
+
+func (s *tagService) CreateTag(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateTagRequest) (*proto.Tag, error) {
+	names, err := tagNames([]string{in.Name})
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.tags.Ensure(ctx, workspaceID, names)
+	if err != nil {
+		return nil, err
+	}
+	return tagToProto(tags[0]), nil
+}
+
+func (s *tagService) ListTags(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTagsRequest) (*proto.ListTagsResponse, error) {
+	tags, err := s.tags.ListWithCounts(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListTagsResponse{Tags: make([]*proto.Tag, 0, len(tags))}
+	for _, t := range tags {
+		out.Tags = append(out.Tags, tagToProto(t))
+	}
+	return out, nil
+}
+
+func (s *tagService) DeleteTag(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteTagRequest) (*proto.DeleteTagResponse, error) {
+	id, err := uuid.Parse(in.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid tag id")
+	}
+	deleted, err := s.tags.Delete(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DeleteTagResponse{Deleted: deleted}, nil
+}
+
+func (s *tagService) TagContacts(ctx context.Context, workspaceID uuid.UUID, in *proto.TagContactsRequest) (*proto.TagContactsResponse, error) {
+	names, err := tagNames(in.Tags)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.tagTarget(ctx, workspaceID, in)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.tags.Ensure(ctx, workspaceID, names)
+	if err != nil {
+		return nil, err
+	}
+	n, err := s.tags.Tag(ctx, workspaceID, tagIDs(tags), target)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.TagContactsResponse{Affected: n}, nil
+}
+
+func (s *tagService) UntagContacts(ctx context.Context, workspaceID uuid.UUID, in *proto.TagContactsRequest) (*proto.TagContactsResponse, error) {
+	names, err := tagNames(in.Tags)
+	if err != nil {
+		return nil, err
+	}
+	target, err := s.tagTarget(ctx, workspaceID, in)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.tags.GetByNames(ctx, workspaceID, names)
+	if err != nil {
+		return nil, err
+	}
+	if len(tags) == 0 {
+		return &proto.TagContactsResponse{}, nil
+	}
+	n, err := s.tags.Untag(ctx, workspaceID, tagIDs(tags), target)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.TagContactsResponse{Affected: n}, nil
+}
+
+// tagTarget resolves the contacts a bulk tag request applies to.
+func (s *tagService) tagTarget(ctx context.Context, workspaceID uuid.UUID, in *proto.TagContactsRequest) (repository.TagTarget, error) {
+	switch t := in.Target.(type) {
+	case *proto.TagContactsRequest_Contacts:
+		ids := t.Contacts.GetIds()
+		if len(ids) == 0 {
+			return repository.TagTarget{}, status.Error(codes.InvalidArgument, "no contact ids given")
+		}
+		if len(ids) > maxTagContactIDs {
+			return repository.TagTarget{}, status.Errorf(codes.InvalidArgument, "at most %d contact ids per request", maxTagContactIDs)
+		}
+		out := make([]uuid.UUID, 0, len(ids))
+		for _, raw := range ids {
+			id, err := uuid.Parse(raw)
+			if err != nil {
+				return repository.TagTarget{}, status.Errorf(codes.InvalidArgument, "invalid contact id %q", raw)
+			}
+			out = append(out, id)
+		}
+		return repository.TagTarget{ContactIDs: out}, nil
+	case *proto.TagContactsRequest_Filter:
+		f := segmentFilterFromProto(t.Filter)
+		if err := repository.ValidateSegmentFilter(f); err != nil {
+			return repository.TagTarget{}, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return repository.TagTarget{Filter: &f}, nil
+	case *proto.TagContactsRequest_SegmentId:
+		id, err := uuid.Parse(t.SegmentId)
+		if err != nil {
+			return repository.TagTarget{}, status.Error(codes.InvalidArgument, "invalid segment id")
+		}
+		seg, err := s.contacts.GetSegment(ctx, workspaceID, id)
+		if err != nil {
+			return repository.TagTarget{}, err
+		}
+		if seg == nil {
+			return repository.TagTarget{}, status.Error(codes.NotFound, "segment not found")
+		}
+		return repository.TagTarget{Filter: &seg.Filter}, nil
+	default:
+		return repository.TagTarget{}, status.Error(codes.InvalidArgument, "contacts, filter or segment_id is required")
+	}
+}
+
+// tagNames trims and de-duplicates tag names and checks their length.
+func tagNames(raw []string) ([]string, error) {
+	if len(raw) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one tag is required")
+	}
+	if len(raw) > maxTagsPerRequest {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d tags per request", maxTagsPerRequest)
+	}
+	seen := make(map[string]bool, len(raw))
+	out := make([]string, 0, len(raw))
+	for _, name := range raw {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, status.Error(codes.InvalidArgument, "tag name is required")
+		}
+		if utf8.RuneCountInString(name) > maxTagNameLength {
+			return nil, status.Errorf(codes.InvalidArgument, "tag name longer than %d characters", maxTagNameLength)
+		}
+		if !seen[name] {
+			seen[name] = true
+			out = append(out, name)
+		}
+	}
+	return out, nil
+}
+
+func tagIDs(tags []*model.Tag) []uuid.UUID {
+	ids := make([]uuid.UUID, len(tags))
+	for i, t := range tags {
+		ids[i] = t.ID
+	}
+	return ids
+}
+
+func tagToProto(t *model.Tag) *proto.Tag {
+	return &proto.Tag{
+		Id:           t.ID.String(),
+		Name:         t.Name,
+		ContactCount: t.ContactCount,
+		CreatedAt:    timestamppb.New(t.CreatedAt),
+	}
+}
+
+func segmentFilterFromProto(f *proto.SegmentFilter) model.SegmentFilter {
+	out := model.SegmentFilter{Match: model.SegmentMatch(f.GetMatch())}
+	for _, c := range f.GetConditions() {
+		out.Conditions = append(out.Conditions, model.SegmentCondition{
+			Field: c.Field,
+			Op:    c.Op,
+			Value: c.Value,
+		})
+	}
+	return out
+}
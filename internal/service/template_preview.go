@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	maxTestRecipients = 5
+	testSubjectPrefix = "[Test] "
+	// Gmail truncates HTML bodies larger than this behind a "View entire
+	// message" link.
+	htmlClipSize = 102 * 1024
+	// previewVarsBase stands in for system links such as unsubscribe URLs,
+	// which only exist once a campaign is sent.
+	previewVarsBase = "https://preview.invalid/"
+)
+
+// Preview warning codes.
+const (
+	warnMissingField = "missing_field"
+	warnBrokenLink   = "broken_link"
+	warnSize         = "size"
+	warnCSS          = "unsupported_css"
+)
+
+// PreviewTemplate renders a template version for a sample contact.
+func (s *templateService) PreviewTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.PreviewTemplateRequest) (*proto.PreviewTemplateResponse, error) {
+	p, err := s.preview(ctx, workspaceID, in.Id, in.Version, in.GetContactId(), in.GetContact())
+	if err != nil {
+		return nil, err
+	}
+	return &proto.PreviewTemplateResponse{
+		Subject:   p.out.Subject,
+		Preheader: p.out.Preheader,
+		HtmlBody:  p.out.HTML,
+		TextBody:  p.out.Text,
+		Language:  languageToProto(p.out.Lang),
+		Warnings:  p.warnings,
+	}, nil
+}
+
+// SendTestEmail renders a template version once and sends it to verified
+// test recipients, through the TestSender like a campaign email when there
+// is one.
+func (s *templateService) SendTestEmail(ctx context.Context, workspaceID uuid.UUID, in *proto.SendTestEmailRequest) (*proto.SendTestEmailResponse, error) {
+	recipients, err := s.testRecipients(ctx, workspaceID, in.Recipients)
+	if err != nil {
+		return nil, err
+	}
+	email, err := testEmailFrom(in.Sender)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.preview(ctx, workspaceID, in.Id, in.Version, in.GetContactId(), in.GetContact())
+	if err != nil {
+		return nil, err
+	}
+
+	out := &proto.SendTestEmailResponse{Warnings: p.warnings}
+	if s.tests != nil {
+		email.To = recipients
+		email.Subject, email.Text, email.HTML = testSubjectPrefix+p.out.Subject, p.out.Text, p.out.HTML
+		email.UnsubscribeURL = previewVarsBase + unsubscribeURLVar
+		if err := s.tests.SendTest(ctx, workspaceID, email); err != nil {
+			if _, ok := status.FromError(err); ok {
+				return nil, err
+			}
+			return nil, fmt.Errorf("send test email: %w", err)
+		}
+		out.Sent = int32(len(recipients))
+		return out, nil
+	}
+	for _, to := range recipients {
+		err := s.mailer.Send(ctx, &Message{
+			To:       to,
+			Subject:  testSubjectPrefix + p.out.Subject,
+			TextBody: p.out.Text,
+			HTMLBody: p.out.HTML,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("send test email: %w", err)
+		}
+		out.Sent++
+	}
+	return out, nil
+}
+
+// testEmailFrom returns a test email from the sender in, if it names one.
+func testEmailFrom(in *proto.SenderIdentity) (*TestEmail, error) {
+	email := &TestEmail{}
+	name := strings.TrimSpace(in.GetFromName())
+	if strings.ContainsAny(name, "\r\n") {
+		return nil, status.Error(codes.InvalidArgument, "invalid sender name")
+	}
+	if raw := strings.TrimSpace(in.GetFromEmail()); raw != "" {
+		addr, err := emailvalidation.Normalize(raw)
+		if err != nil {
+			return nil, emailError(err)
+		}
+		email.From = mail.Address{Name: name, Email: addr}
+	}
+	if raw := strings.TrimSpace(in.GetReplyTo()); raw != "" {
+		addr, err := emailvalidation.Normalize(raw)
+		if err != nil {
+			return nil, emailError(err)
+		}
+		email.ReplyTo = addr
+	}
+	return email, nil
+}
+
+// testRecipients normalises and deduplicates addresses and checks every one
+// is a verified test recipient of the workspace.
+func (s *templateService) testRecipients(ctx context.Context, workspaceID uuid.UUID, addrs []string) ([]string, error) {
+	seen := make(map[string]bool, len(addrs))
+	var emails []string
+	for _, a := range addrs {
+		e, err := emailvalidation.Normalize(a)
+		if err != nil {
+			return nil, emailError(err)
+		}
+		if !seen[e] {
+			seen[e] = true
+			emails = append(emails, e)
+		}
+	}
+	if len(emails) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "at least one recipient is required")
+	}
+	if len(emails) > maxTestRecipients {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d recipients are allowed", maxTestRecipients)
+	}
+
+	known, err := s.recipients.GetByEmails(ctx, workspaceID, emails)
+	if err != nil {
+		return nil, err
+	}
+	verified := make(map[string]bool, len(known))
+	for _, r := range known {
+		verified[r.Email] = r.VerifiedAt != nil
+	}
+	for _, e := range emails {
+		if !verified[e] {
+			return nil, status.Errorf(codes.FailedPrecondition, "%s is not a verified test recipient", e)
+		}
+	}
+	return emails, nil
+}
+
+type preview struct {
+	out      *render.Output
+	warnings []*proto.PreviewWarning
+}
+
+func (s *templateService) preview(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	rawID string,
+	version int32,
+	contactID string,
+	sample *proto.SampleContact,
+) (*preview, error) {
+	id, err := parseTemplateID(rawID)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.getVersion(ctx, workspaceID, id, version)
+	if err != nil {
+		return nil, err
+	}
+	// Versions saved before validation existed, or whose blocks changed
+	// since, may not compile.
+	set, err := s.compile(ctx, workspaceID, v.LocalizedContent)
+	if err != nil {
+		return nil, err
+	}
+
+	var c *model.Contact
+	switch {
+	case contactID != "":
+		if c, err = s.sampleFromContact(ctx, workspaceID, contactID); err != nil {
+			return nil, err
+		}
+	case sample != nil:
+		c = sampleFromProto(sample)
+	default:
+		c = syntheticContact(v.Lang, set.For(v.Lang).Fields())
+	}
+
+	tpl := set.For(c.Lang)
+	vars := make(map[string]string)
+	for _, f := range tpl.Fields() {
+		if name, ok := strings.CutPrefix(f.Path, "vars."); ok {
+			vars[name] = previewVarsBase + name
+		}
+	}
+	out, err := tpl.Render(ctx, render.Data{Contact: c, Vars: vars}, render.Limits{})
+	if err != nil {
+		if errors.Is(err, render.ErrTimeout) || errors.Is(err, render.ErrOutputTooLarge) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	p := &preview{out: out}
+	p.warnings = append(p.warnings, missingFieldWarnings(tpl.Fields(), c)...)
+	p.warnings = append(p.warnings, linkWarnings(out.HTML)...)
+	for _, w := range out.CSSWarnings {
+		p.warnings = append(p.warnings, &proto.PreviewWarning{Code: warnCSS, Message: w.String()})
+	}
+	if n := len(out.HTML); n > htmlClipSize {
+		p.warnings = append(p.warnings, &proto.PreviewWarning{
+			Code:    warnSize,
+			Message: fmt.Sprintf("HTML body is %d KB; Gmail clips messages over %d KB", n/1024, htmlClipSize/1024),
+		})
+	}
+	return p, nil
+}
+
+func (s *templateService) sampleFromContact(ctx context.Context, workspaceID uuid.UUID, raw string) (*model.Contact, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid contact id")
+	}
+	c, err := s.contacts.GetContact(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, status.Error(codes.NotFound, "contact not found")
+	}
+	return c, nil
+}
+
+func sampleFromProto(in *proto.SampleContact) *model.Contact {
+	c := &model.Contact{
+		Email:        strings.TrimSpace(in.Email),
+		FirstName:    strings.TrimSpace(in.FirstName),
+		LastName:     strings.TrimSpace(in.LastName),
+		Lang:         languageFromProto(in.Language),
+		CustomFields: model.CustomFields{},
+		CreatedAt:    time.Now().UTC(),
+	}
+	for k, v := range in.CustomFields {
+		c.CustomFields[k] = v
+	}
+	return c
+}
+
+// syntheticContact fills every field the template outputs so the preview
+// shows where merged values land.
+func syntheticContact(lang model.Language, fields []render.Field) *model.Contact {
+	c := &model.Contact{
+		Email:        "jane.doe@example.com",
+		FirstName:    "Jane",
+		LastName:     "Doe",
+		Lang:         lang,
+		CustomFields: model.CustomFields{},
+		CreatedAt:    time.Now().UTC(),
+	}
+	for _, f := range fields {
+		if key, ok := strings.CutPrefix(f.Path, "contact.custom."); ok {
+			c.CustomFields[key] = "[" + key + "]"
+		}
+	}
+	return c
+}
+
+func missingFieldWarnings(fields []render.Field, c *model.Contact) []*proto.PreviewWarning {
+	var out []*proto.PreviewWarning
+	for _, f := range fields {
+		if f.HasDefault || strings.HasPrefix(f.Path, "vars.") || contactValue(c, f.Path) != "" {
+			continue
+		}
+		out = append(out, &proto.PreviewWarning{
+			Code:    warnMissingField,
+			Message: fmt.Sprintf("%s is empty for this contact and has no default", f.Path),
+		})
+	}
+	return out
+}
+
+func contactValue(c *model.Contact, path string) string {
+	if key, ok := strings.CutPrefix(path, "contact.custom."); ok {
+		return c.CustomFields[key]
+	}
+	switch strings.TrimPrefix(path, "contact.") {
+	case "id":
+		return c.ID.String()
+	case "email":
+		return c.Email
+	case "first_name":
+		return c.FirstName
+	case "last_name":
+		return c.LastName
+	case "full_name":
+		return strings.TrimSpace(c.FirstName + " " + c.LastName)
+	case "created_at":
+		if c.CreatedAt.IsZero() {
+			return ""
+		}
+		return c.CreatedAt.String()
+	default:
+		return c.Lang.String()
+	}
+}
+
+// linkWarnings reports links and images in body that cannot work in an
+// email. Links are checked statically; nothing is fetched.
+func linkWarnings(body string) []*proto.PreviewWarning {
+	seen := make(map[string]bool)
+	var problems []string
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			break
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		tok := z.Token()
+		var attr string
+		switch tok.Data {
+		case "a", "area":
+			attr = "href"
+		case "img":
+			attr = "src"
+		default:
+			continue
+		}
+		for _, a := range tok.Attr {
+			if a.Key != attr {
+				continue
+			}
+			if msg := checkLink(a.Val); msg != "" && !seen[a.Val] {
+				seen[a.Val] = true
+				problems = append(problems, fmt.Sprintf("<%s %s=%q>: %s", tok.Data, attr, a.Val, msg))
+			}
+		}
+	}
+	sort.Strings(problems)
+
+	out := make([]*proto.PreviewWarning, 0, len(problems))
+	for _, p := range problems {
+		out = append(out, &proto.PreviewWarning{Code: warnBrokenLink, Message: p})
+	}
+	return out
+}
+
+func checkLink(raw string) string {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case raw == "" || raw == "#":
+		return "empty link"
+	case strings.Contains(raw, "ZgotmplZ"):
+		// html/template's marker for a value it refused to use as a URL.
+		return "unsafe URL removed by the renderer"
+	case strings.HasPrefix(raw, previewVarsBase):
+		return ""
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "malformed URL"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "URL has no host"
+		}
+	case "mailto", "tel", "cid":
+	case "":
+		return "relative URL will not resolve in an email"
+	default:
+		return fmt.Sprintf("unsupported URL scheme %q", u.Scheme)
+	}
+	return ""
+}
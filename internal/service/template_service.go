@@ -0,0 +1,393 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/render"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/textdiff"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	maxTemplateBodySize = 512 * 1024
+	diffContextLines    = 3
+)
+
+// TemplateService defines business logic for versioned email templates.
+type TemplateService interface {
+	CreateTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateTemplateRequest) (*proto.Template, error)
+	UpdateTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateTemplateRequest) (*proto.Template, error)
+	ListTemplates(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTemplatesRequest) (*proto.ListTemplatesResponse, error)
+	GetTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.GetTemplateRequest) (*proto.TemplateVersion, error)
+	ListTemplateVersions(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTemplateVersionsRequest) (*proto.ListTemplateVersionsResponse, error)
+	DiffTemplateVersions(ctx context.Context, workspaceID uuid.UUID, in *proto.DiffTemplateVersionsRequest) (*proto.DiffTemplateVersionsResponse, error)
+	RollbackTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.RollbackTemplateRequest) (*proto.Template, error)
+	PreviewTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.PreviewTemplateRequest) (*proto.PreviewTemplateResponse, error)
+	SendTestEmail(ctx context.Context, workspaceID uuid.UUID, in *proto.SendTestEmailRequest) (*proto.SendTestEmailResponse, error)
+}
+
+type templateService struct {
+	repo       repository.TemplateRepository
+	blocks     repository.ContentBlockRepository
+	contacts   repository.ContactRepository
+	recipients repository.TestRecipientRepository
+	mailer     Mailer
+	tests      TestSender
+}
+
+// NewTemplateService constructs a new TemplateService. Templates may use
+// the content blocks in blocks. Previews may use contacts as sample data;
+// tests are sent to verified recipients only, with tests, or with mailer
+// if tests is nil.
+func NewTemplateService(
+	repo repository.TemplateRepository,
+	blocks repository.ContentBlockRepository,
+	contacts repository.ContactRepository,
+	recipients repository.TestRecipientRepository,
+	mailer Mailer,
+	tests TestSender,
+) TemplateService {
+	return &templateService{
+		repo:       repo,
+		blocks:     blocks,
+		contacts:   contacts,
+		recipients: recipients,
+		mailer:     mailer,
+		tests:      tests,
+	}
+}
+
+func (s *templateService) CreateTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.CreateTemplateRequest) (*proto.Template, error) {
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		return nil, status.Error(codes.InvalidArgument, "template name is required")
+	}
+	content, err := localizedContentFromProto(in.Language, in.Content, in.Variants, in.Layout)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, workspaceID, content); err != nil {
+		return nil, err
+	}
+	// The workspace is the authenticated account, so it is also the author.
+	t, v, err := s.repo.Create(ctx, workspaceID, name, content, render.TemplateRefs(content), workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return templateToProto(t, v), nil
+}
+
+func (s *templateService) UpdateTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.UpdateTemplateRequest) (*proto.Template, error) {
+	id, err := parseTemplateID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	content, err := localizedContentFromProto(in.Language, in.Content, in.Variants, in.Layout)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validate(ctx, workspaceID, content); err != nil {
+		return nil, err
+	}
+	return s.addVersion(ctx, workspaceID, id, strings.TrimSpace(in.Name), content, "", in.BaseVersion)
+}
+
+func (s *templateService) ListTemplates(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTemplatesRequest) (*proto.ListTemplatesResponse, error) {
+	limit, offset := pagination(in.PageSize, in.PageNumber)
+	items, err := s.repo.List(ctx, workspaceID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListTemplatesResponse{Templates: make([]*proto.Template, 0, len(items))}
+	for _, t := range items {
+		out.Templates = append(out.Templates, templateToProto(t, nil))
+	}
+	return out, nil
+}
+
+func (s *templateService) GetTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.GetTemplateRequest) (*proto.TemplateVersion, error) {
+	id, err := parseTemplateID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	v, err := s.getVersion(ctx, workspaceID, id, in.Version)
+	if err != nil {
+		return nil, err
+	}
+	return templateVersionToProto(v), nil
+}
+
+func (s *templateService) ListTemplateVersions(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTemplateVersionsRequest) (*proto.ListTemplateVersionsResponse, error) {
+	id, err := parseTemplateID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := s.repo.ListVersions(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, status.Error(codes.NotFound, "template not found")
+	}
+	out := &proto.ListTemplateVersionsResponse{Versions: make([]*proto.TemplateVersion, 0, len(versions))}
+	for _, v := range versions {
+		out.Versions = append(out.Versions, templateVersionToProto(v))
+	}
+	return out, nil
+}
+
+func (s *templateService) DiffTemplateVersions(ctx context.Context, workspaceID uuid.UUID, in *proto.DiffTemplateVersionsRequest) (*proto.DiffTemplateVersionsResponse, error) {
+	id, err := parseTemplateID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if in.FromVersion <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "from_version is required")
+	}
+	from, err := s.getVersion(ctx, workspaceID, id, in.FromVersion)
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.getVersion(ctx, workspaceID, id, in.ToVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	fromName := fmt.Sprintf("version %d", from.Version)
+	toName := fmt.Sprintf("version %d", to.Version)
+	out := &proto.DiffTemplateVersionsResponse{}
+	diff := func(prefix string, a, b model.TemplateContent) {
+		fields := []struct {
+			name string
+			a, b string
+		}{
+			{"subject", a.Subject, b.Subject},
+			{"preheader", a.Preheader, b.Preheader},
+			{"html_body", a.HTMLBody, b.HTMLBody},
+			{"text_body", a.TextBody, b.TextBody},
+		}
+		for _, f := range fields {
+			if d := textdiff.Unified(fromName, toName, f.a, f.b, diffContextLines); d != "" {
+				out.Diffs = append(out.Diffs, &proto.TemplateFieldDiff{Field: prefix + f.name, Unified: d})
+			}
+		}
+	}
+	diff("", from.TemplateContent, to.TemplateContent)
+	for _, lang := range []model.Language{model.Language_EN, model.Language_FA} {
+		code := lang.String()
+		diff(code+"/", from.Variants[code], to.Variants[code])
+	}
+	return out, nil
+}
+
+func (s *templateService) RollbackTemplate(ctx context.Context, workspaceID uuid.UUID, in *proto.RollbackTemplateRequest) (*proto.Template, error) {
+	id, err := parseTemplateID(in.Id)
+	if err != nil {
+		return nil, err
+	}
+	if in.Version <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "version is required")
+	}
+	old, err := s.getVersion(ctx, workspaceID, id, in.Version)
+	if err != nil {
+		return nil, err
+	}
+	note := fmt.Sprintf("rollback to version %d", old.Version)
+	return s.addVersion(ctx, workspaceID, id, "", old.LocalizedContent, note, 0)
+}
+
+func (s *templateService) addVersion(
+	ctx context.Context,
+	workspaceID, id uuid.UUID,
+	name string,
+	content model.LocalizedContent,
+	note string,
+	baseVersion int32,
+) (*proto.Template, error) {
+	refs := render.TemplateRefs(content)
+	v, err := s.repo.AddVersion(ctx, workspaceID, id, name, content, refs, workspaceID, note, baseVersion)
+	if errors.Is(err, repository.ErrVersionConflict) {
+		return nil, status.Error(codes.Aborted, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, status.Error(codes.NotFound, "template not found")
+	}
+	t, err := s.repo.Get(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, status.Error(codes.NotFound, "template not found")
+	}
+	return templateToProto(t, v), nil
+}
+
+func (s *templateService) compile(ctx context.Context, workspaceID uuid.UUID, content model.LocalizedContent) (*render.Set, error) {
+	return compileTemplate(ctx, s.blocks, workspaceID, content)
+}
+
+// compileTemplate compiles content against the workspace's content blocks.
+// Problems are reported as FailedPrecondition.
+func compileTemplate(
+	ctx context.Context,
+	blocks repository.ContentBlockRepository,
+	workspaceID uuid.UUID,
+	content model.LocalizedContent,
+) (*render.Set, error) {
+	all, err := loadBlocks(ctx, blocks, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	// Workspaces have no custom field schema, so any custom field is accepted.
+	set, err := render.CompileSet(content, render.Options{Blocks: all})
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return set, nil
+}
+
+// validate reports problems in content as InvalidArgument.
+func (s *templateService) validate(ctx context.Context, workspaceID uuid.UUID, content model.LocalizedContent) error {
+	_, err := s.compile(ctx, workspaceID, content)
+	if status.Code(err) == codes.FailedPrecondition {
+		return status.Error(codes.InvalidArgument, status.Convert(err).Message())
+	}
+	return err
+}
+
+func (s *templateService) getVersion(ctx context.Context, workspaceID, id uuid.UUID, version int32) (*model.TemplateVersion, error) {
+	if version < 0 {
+		return nil, status.Error(codes.InvalidArgument, "invalid version")
+	}
+	v, err := s.repo.GetVersion(ctx, workspaceID, id, version)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, status.Error(codes.NotFound, "template version not found")
+	}
+	return v, nil
+}
+
+func parseTemplateID(raw string) (uuid.UUID, error) {
+	id, err := uuid.Parse(raw)
+	if err != nil {
+		return uuid.Nil, status.Error(codes.InvalidArgument, "invalid template id")
+	}
+	return id, nil
+}
+
+func templateContentFromProto(c *proto.TemplateContent) (model.TemplateContent, error) {
+	out := model.TemplateContent{
+		Subject:   strings.TrimSpace(c.GetSubject()),
+		Preheader: strings.TrimSpace(c.GetPreheader()),
+		HTMLBody:  c.GetHtmlBody(),
+		TextBody:  c.GetTextBody(),
+	}
+	if out.Subject == "" {
+		return out, status.Error(codes.InvalidArgument, "subject is required")
+	}
+	if out.HTMLBody == "" && out.TextBody == "" {
+		return out, status.Error(codes.InvalidArgument, "an HTML or text body is required")
+	}
+	if len(out.HTMLBody) > maxTemplateBodySize || len(out.TextBody) > maxTemplateBodySize {
+		return out, status.Errorf(codes.InvalidArgument, "template body exceeds %d bytes", maxTemplateBodySize)
+	}
+	return out, nil
+}
+
+func localizedContentFromProto(lang proto.Language, c *proto.TemplateContent, variants []*proto.TemplateVariant, layout string) (model.LocalizedContent, error) {
+	out := model.LocalizedContent{Lang: languageFromProto(lang), Layout: strings.TrimSpace(layout)}
+	var err error
+	if out.TemplateContent, err = templateContentFromProto(c); err != nil {
+		return out, err
+	}
+	if len(variants) > 0 {
+		out.Variants = make(model.TemplateVariants, len(variants))
+	}
+	for _, v := range variants {
+		vl := languageFromProto(v.GetLanguage())
+		if vl == out.Lang {
+			return out, status.Errorf(codes.InvalidArgument, "%s variant duplicates the template language", vl)
+		}
+		if _, dup := out.Variants[vl.String()]; dup {
+			return out, status.Errorf(codes.InvalidArgument, "duplicate %s variant", vl)
+		}
+		content, err := templateContentFromProto(v.GetContent())
+		if err != nil {
+			return out, status.Errorf(codes.InvalidArgument, "%s variant: %s", vl, status.Convert(err).Message())
+		}
+		out.Variants[vl.String()] = content
+	}
+	return out, nil
+}
+
+func languageFromProto(l proto.Language) model.Language {
+	if l == proto.Language_LANGUAGE_FA {
+		return model.Language_FA
+	}
+	return model.Language_EN
+}
+
+func languageToProto(l model.Language) proto.Language {
+	if l == model.Language_FA {
+		return proto.Language_LANGUAGE_FA
+	}
+	return proto.Language_LANGUAGE_EN
+}
+
+func templateToProto(t *model.Template, current *model.TemplateVersion) *proto.Template {
+	out := &proto.Template{
+		Id:             t.ID.String(),
+		Name:           t.Name,
+		CurrentVersion: t.CurrentVersion,
+		CreatedAt:      timestamppb.New(t.CreatedAt),
+		UpdatedAt:      timestamppb.New(t.UpdatedAt),
+	}
+	if current != nil {
+		out.Current = templateVersionToProto(current)
+	}
+	return out
+}
+
+func templateVersionToProto(v *model.TemplateVersion) *proto.TemplateVersion {
+	out := &proto.TemplateVersion{
+		TemplateId: v.TemplateID.String(),
+		Version:    v.Version,
+		Content:    templateContentToProto(v.TemplateContent),
+		AuthorId:   v.AuthorID.String(),
+		Note:       v.Note,
+		CreatedAt:  timestamppb.New(v.CreatedAt),
+		Language:   languageToProto(v.Lang),
+		Layout:     v.Layout,
+	}
+	for _, lang := range v.Languages()[1:] {
+		c, _ := v.ContentFor(lang)
+		out.Variants = append(out.Variants, &proto.TemplateVariant{
+			Language: languageToProto(lang),
+			Content:  templateContentToProto(c),
+		})
+	}
+	return out
+}
+
+func templateContentToProto(c model.TemplateContent) *proto.TemplateContent {
+	return &proto.TemplateContent{
+		Subject:   c.Subject,
+		Preheader: c.Preheader,
+		HtmlBody:  c.HTMLBody,
+		TextBody:  c.TextBody,
+	}
+}
@@ -0,0 +1,348 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/dkim"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeTemplateRepo is an in-memory repository.TemplateRepository
+type fakeTemplateRepo struct {
+	templates map[uuid.UUID]*model.Template
+	versions  map[uuid.UUID][]*model.TemplateVersion
+	// refs holds the block refs of each template's current version.
+	refs map[uuid.UUID][]string
+}
+
+func newFakeTemplateRepo() *fakeTemplateRepo {
+	return &fakeTemplateRepo{
+		templates: map[uuid.UUID]*model.Template{},
+		versions:  map[uuid.UUID][]*model.TemplateVersion{},
+		refs:      map[uuid.UUID][]string{},
+	}
+}
+
+func (f *fakeTemplateRepo) Create(ctx context.Context, workspaceID uuid.UUID, name string, content model.LocalizedContent, refs []string, authorID uuid.UUID) (*model.Template, *model.TemplateVersion, error) {
+	t := &model.Template{ID: uuid.New(), WorkspaceID: workspaceID, Name: name, CurrentVersion: 1, CreatedAt: time.Now()}
+	v := &model.TemplateVersion{TemplateID: t.ID, Version: 1, LocalizedContent: content, AuthorID: authorID}
+	f.templates[t.ID] = t
+	f.versions[t.ID] = []*model.TemplateVersion{v}
+	f.refs[t.ID] = refs
+	return t, v, nil
+}
+func (f *fakeTemplateRepo) AddVersion(ctx context.Context, workspaceID, templateID uuid.UUID, name string, content model.LocalizedContent, refs []string, authorID uuid.UUID, note string, baseVersion int32) (*model.TemplateVersion, error) {
+	t, _ := f.Get(ctx, workspaceID, templateID)
+	if t == nil {
+		return nil, nil
+	}
+	if baseVersion != 0 && baseVersion != t.CurrentVersion {
+		return nil, repository.ErrVersionConflict
+	}
+	t.CurrentVersion++
+	if name != "" {
+		t.Name = name
+	}
+	v := &model.TemplateVersion{TemplateID: t.ID, Version: t.CurrentVersion, LocalizedContent: content, AuthorID: authorID, Note: note}
+	f.versions[t.ID] = append(f.versions[t.ID], v)
+	f.refs[t.ID] = refs
+	return v, nil
+}
+func (f *fakeTemplateRepo) Get(ctx context.Context, workspaceID, templateID uuid.UUID) (*model.Template, error) {
+	t := f.templates[templateID]
+	if t == nil || t.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	return t, nil
+}
+func (f *fakeTemplateRepo) GetVersion(ctx context.Context, workspaceID, templateID uuid.UUID, version int32) (*model.TemplateVersion, error) {
+	t, _ := f.Get(ctx, workspaceID, templateID)
+	if t == nil {
+		return nil, nil
+	}
+	if version == 0 {
+		version = t.CurrentVersion
+	}
+	for _, v := range f.versions[templateID] {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return nil, nil
+}
+func (f *fakeTemplateRepo) List(ctx context.Context, workspaceID uuid.UUID, limit, offset int) ([]*model.Template, error) {
+	return nil, nil
+}
+func (f *fakeTemplateRepo) ListVersions(ctx context.Context, workspaceID, templateID uuid.UUID) ([]*model.TemplateVersion, error) {
+	return f.versions[templateID], nil
+}
+
+func TestTemplateService_Versioning(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil)
+
+	created, err := svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Welcome",
+		Content: &proto.TemplateContent{Subject: "Hi", HtmlBody: "<p>one</p>\n<p>two</p>\n"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), created.CurrentVersion)
+	assert.Equal(t, workspace.String(), created.Current.AuthorId)
+
+	updated, err := svc.UpdateTemplate(ctx, workspace, &proto.UpdateTemplateRequest{
+		Id:          created.Id,
+		Content:     &proto.TemplateContent{Subject: "Hello", HtmlBody: "<p>one</p>\n<p>2</p>\n"},
+		BaseVersion: 1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(2), updated.CurrentVersion)
+
+	// A stale editor is rejected rather than overwriting version 2.
+	_, err = svc.UpdateTemplate(ctx, workspace, &proto.UpdateTemplateRequest{
+		Id:          created.Id,
+		Content:     &proto.TemplateContent{Subject: "Stale", TextBody: "x"},
+		BaseVersion: 1,
+	})
+	assert.Equal(t, codes.Aborted, status.Code(err))
+
+	diff, err := svc.DiffTemplateVersions(ctx, workspace, &proto.DiffTemplateVersionsRequest{Id: created.Id, FromVersion: 1})
+	assert.NoError(t, err)
+	assert.Len(t, diff.Diffs, 2)
+	assert.Equal(t, "subject", diff.Diffs[0].Field)
+	assert.Equal(t, "html_body", diff.Diffs[1].Field)
+	assert.Contains(t, diff.Diffs[1].Unified, "-<p>two</p>\n+<p>2</p>\n")
+
+	rolled, err := svc.RollbackTemplate(ctx, workspace, &proto.RollbackTemplateRequest{Id: created.Id, Version: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int32(3), rolled.CurrentVersion)
+	assert.Equal(t, "Hi", rolled.Current.Content.Subject)
+	assert.Equal(t, "rollback to version 1", rolled.Current.Note)
+
+	v2, err := svc.GetTemplate(ctx, workspace, &proto.GetTemplateRequest{Id: created.Id, Version: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, "Hello", v2.Content.Subject)
+}
+
+func TestTemplateService_Validation(t *testing.T) {
+	ctx := context.Background()
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil)
+
+	_, err := svc.CreateTemplate(ctx, uuid.New(), &proto.CreateTemplateRequest{
+		Name:    "No body",
+		Content: &proto.TemplateContent{Subject: "Hi"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = svc.CreateTemplate(ctx, uuid.New(), &proto.CreateTemplateRequest{
+		Name:    "Unknown field",
+		Content: &proto.TemplateContent{Subject: "Hi {{contact.nickname}}", TextBody: "Hello"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "unknown field contact.nickname")
+
+	_, err = svc.GetTemplate(ctx, uuid.New(), &proto.GetTemplateRequest{Id: uuid.New().String()})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestTemplateService_Variants(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil)
+
+	created, err := svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:     "Welcome",
+		Content:  &proto.TemplateContent{Subject: "Hi", TextBody: "Hello"},
+		Language: proto.Language_LANGUAGE_EN,
+		Variants: []*proto.TemplateVariant{{
+			Language: proto.Language_LANGUAGE_FA,
+			Content:  &proto.TemplateContent{Subject: "سلام", TextBody: "درود"},
+		}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, proto.Language_LANGUAGE_EN, created.Current.Language)
+	if assert.Len(t, created.Current.Variants, 1) {
+		assert.Equal(t, proto.Language_LANGUAGE_FA, created.Current.Variants[0].Language)
+		assert.Equal(t, "سلام", created.Current.Variants[0].Content.Subject)
+	}
+
+	_, err = svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Same language",
+		Content: &proto.TemplateContent{Subject: "Hi", TextBody: "Hello"},
+		Variants: []*proto.TemplateVariant{{
+			Language: proto.Language_LANGUAGE_EN,
+			Content:  &proto.TemplateContent{Subject: "Hey", TextBody: "Hello"},
+		}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Broken variant",
+		Content: &proto.TemplateContent{Subject: "Hi", TextBody: "Hello"},
+		Variants: []*proto.TemplateVariant{{
+			Language: proto.Language_LANGUAGE_FA,
+			Content:  &proto.TemplateContent{Subject: "{{contact.nickname}}", TextBody: "x"},
+		}},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Contains(t, status.Convert(err).Message(), "fa variant")
+}
+
+func TestTemplateService_Preview(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, newFakeTestRecipientRepo(), &mockMailer{}, nil)
+
+	created, err := svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name: "Welcome",
+		Content: &proto.TemplateContent{
+			Subject: `Hi {{contact.first_name}}`,
+			HtmlBody: `<p>{{contact.custom.plan}}</p><a href="{{vars.unsubscribe_url}}">u</a>` +
+				`<a href="/pricing">p</a><a href="javascript:alert(1)">x</a><img src="https://cdn.example.com/a.png">`,
+		},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Synthetic data fills every field.
+	p, err := svc.PreviewTemplate(ctx, workspace, &proto.PreviewTemplateRequest{Id: created.Id})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "Hi Jane", p.Subject)
+	assert.Contains(t, p.HtmlBody, "<p>[plan]</p>")
+
+	var codesSeen []string
+	for _, w := range p.Warnings {
+		codesSeen = append(codesSeen, w.Code+": "+w.Message)
+	}
+	assert.Equal(t, []string{
+		`broken_link: <a href="/pricing">: relative URL will not resolve in an email`,
+		`broken_link: <a href="javascript:alert(1)">: unsupported URL scheme "javascript"`,
+	}, codesSeen)
+
+	// A sample without the fields reports them.
+	p, err = svc.PreviewTemplate(ctx, workspace, &proto.PreviewTemplateRequest{
+		Id:     created.Id,
+		Sample: &proto.PreviewTemplateRequest_Contact{Contact: &proto.SampleContact{Email: "a@example.com"}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	var missing []string
+	for _, w := range p.Warnings {
+		if w.Code == "missing_field" {
+			missing = append(missing, w.Message)
+		}
+	}
+	assert.Equal(t, []string{
+		"contact.custom.plan is empty for this contact and has no default",
+		"contact.first_name is empty for this contact and has no default",
+	}, missing)
+}
+
+func TestTemplateService_SendTestEmail(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	recipients := newFakeTestRecipientRepo()
+	mailer := &mockMailer{}
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, recipients, mailer, nil)
+
+	created, err := svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Welcome",
+		Content: &proto.TemplateContent{Subject: "Hello", HtmlBody: "<p>Hi</p>", TextBody: "Hi"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	r, _ := recipients.Add(ctx, workspace, "qa@example.com")
+	_, err = svc.SendTestEmail(ctx, workspace, &proto.SendTestEmailRequest{Id: created.Id, Recipients: []string{"qa@example.com"}})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Equal(t, 0, mailer.sent)
+
+	_, _ = recipients.MarkVerified(ctx, workspace, r.ID)
+	res, err := svc.SendTestEmail(ctx, workspace, &proto.SendTestEmailRequest{Id: created.Id, Recipients: []string{"QA@example.com", "qa@example.com"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(1), res.Sent)
+	assert.Equal(t, "qa@example.com", mailer.to)
+	assert.Equal(t, "[Test] Hello", mailer.subject)
+	assert.Equal(t, "<p>Hi</p>", mailer.html)
+
+	_, err = svc.SendTestEmail(ctx, workspace, &proto.SendTestEmailRequest{
+		Id:         created.Id,
+		Recipients: []string{"a@x.com", "b@x.com", "c@x.com", "d@x.com", "e@x.com", "f@x.com"},
+	})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTemplateService_SendTestEmailAsCampaign(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	recipients := newFakeTestRecipientRepo()
+	domainRepo := newFakeSendingDomainRepo()
+	sender := &recordingSender{}
+	tests := service.NewTestSender(domainRepo, service.NewMessageSigner(domainRepo, newTestBox()), testVERP, sender, mail.Address{Email: "no-reply@mailer.example"})
+	svc := service.NewTemplateService(newFakeTemplateRepo(), newFakeBlockRepo(nil), &mockContactRepo{}, recipients, &mockMailer{}, tests)
+
+	created, err := svc.CreateTemplate(ctx, workspace, &proto.CreateTemplateRequest{
+		Name:    "Welcome",
+		Content: &proto.TemplateContent{Subject: "Hello", TextBody: "Unsubscribe: {{vars.unsubscribe_url}}"},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	r, _ := recipients.Add(ctx, workspace, "qa@example.com")
+	_, _ = recipients.MarkVerified(ctx, workspace, r.ID)
+	d, err := service.NewSendingDomainService(domainRepo, nil, newTestBox(), "", "", "").
+		CreateSendingDomain(ctx, workspace, &proto.CreateSendingDomainRequest{Domain: "acme.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	in := &proto.SendTestEmailRequest{
+		Id:         created.Id,
+		Recipients: []string{"qa@example.com"},
+		Sender:     &proto.SenderIdentity{FromName: "Acme", FromEmail: "news@acme.com"},
+	}
+
+	// Like campaigns, tests are only sent from verified domains.
+	_, err = svc.SendTestEmail(ctx, workspace, in)
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+	assert.Empty(t, sender.msgs)
+
+	domainRepo.items[uuid.MustParse(d.Id)].Status = model.SendingDomainStatus_Verified
+	res, err := svc.SendTestEmail(ctx, workspace, in)
+	if !assert.NoError(t, err) || !assert.Len(t, sender.msgs, 1) {
+		return
+	}
+	assert.Equal(t, int32(1), res.Sent)
+	msg := sender.msgs[0]
+	assert.Equal(t, testVERP.Address(0), sender.envs[0].From)
+	_, traced := testVERP.Job(sender.envs[0].From)
+	assert.False(t, traced)
+	assert.Contains(t, msg, "From: Acme <news@acme.com>\r\n")
+	assert.Contains(t, msg, "Subject: [Test] Hello\r\n")
+	assert.Contains(t, msg, "List-Unsubscribe: <https://preview.invalid/unsubscribe_url>\r\n")
+	assert.Contains(t, msg, "Unsubscribe: https://preview.invalid/unsubscribe_url")
+	dns := dnsStub{}
+	dns.publish(d)
+	vs, err := dkim.Verify(ctx, dns, []byte(msg))
+	if assert.NoError(t, err) && assert.Len(t, vs, 1) {
+		assert.Equal(t, "acme.com", vs[0].Domain)
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	verifyRecipientPurpose  = "verify_test_recipient"
+	verifyRecipientTokenTTL = 3 * 24 * time.Hour
+	// verifyRecipientResend is how long after a verification email no
+	// other is sent to the same address, so workspaces cannot use them to
+	// mail it over and over.
+	verifyRecipientResend = 10 * time.Minute
+)
+
+// TestRecipientService manages the verified addresses template tests are
+// sent to.
+type TestRecipientService interface {
+	AddTestRecipient(ctx context.Context, workspaceID uuid.UUID, in *proto.AddTestRecipientRequest) (*proto.TestRecipient, error)
+	ListTestRecipients(ctx context.Context, workspaceID uuid.UUID, in *proto.ListTestRecipientsRequest) (*proto.ListTestRecipientsResponse, error)
+	DeleteTestRecipient(ctx context.Context, workspaceID uuid.UUID, in *proto.DeleteTestRecipientRequest) (*proto.DeleteTestRecipientResponse, error)
+	VerifyTestRecipient(ctx context.Context, in *proto.VerifyTestRecipientRequest) (*proto.TestRecipient, error)
+}
+
+type testRecipientService struct {
+	repo    repository.TestRecipientRepository
+	emails  EmailValidator
+	mailer  Mailer
+	signer  *signedlink.Signer
+	baseURL string
+}
+
+// NewTestRecipientService constructs a new TestRecipientService.
+// Verification links point to baseURL and are signed with signer.
+func NewTestRecipientService(
+	repo repository.TestRecipientRepository,
+	emails EmailValidator,
+	mailer Mailer,
+	signer *signedlink.Signer,
+	baseURL string,
+) TestRecipientService {
+	return &testRecipientService{
+		repo:    repo,
+		emails:  emails,
+		mailer:  mailer,
+		signer:  signer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// AddTestRecipient stores the address and emails it a verification link.
+// Already verified addresses are not emailed again, and others only once
+// per verifyRecipientResend: within it, adding fails with
+// RESOURCE_EXHAUSTED.
+func (s *testRecipientService) AddTestRecipient(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.AddTestRecipientRequest,
+) (*proto.TestRecipient, error) {
+	email, err := s.emails.Validate(ctx, in.Email)
+	if err != nil {
+		return nil, emailError(err)
+	}
+	r, err := s.repo.Add(ctx, workspaceID, email)
+	if err != nil {
+		return nil, err
+	}
+	if r.VerifiedAt != nil {
+		return testRecipientToProto(r), nil
+	}
+	// A failed send counts too, so retrying cannot get around the limit.
+	ok, err := s.repo.MarkVerificationSent(ctx, workspaceID, r.ID, time.Now().Add(-verifyRecipientResend))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, status.Error(codes.ResourceExhausted, "a verification email was sent to this address recently, try again later")
+	}
+
+	token := s.signer.Sign(verifyRecipientPurpose, map[string]string{
+		"workspace": workspaceID.String(),
+		"recipient": r.ID.String(),
+	}, verifyRecipientTokenTTL)
+	link := s.baseURL + "/test-recipients/verify?token=" + url.QueryEscape(token)
+	err = s.mailer.Send(ctx, &Message{
+		To:      r.Email,
+		Subject: "Confirm your address for test emails",
+		TextBody: "Someone asked to send test emails to this address.\n\n" +
+			"To allow it, open this link:\n" + link + "\n\n" +
+			"If this wasn't you, ignore this email.\n",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("send verification: %w", err)
+	}
+	return testRecipientToProto(r), nil
+}
+
+func (s *testRecipientService) ListTestRecipients(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.ListTestRecipientsRequest,
+) (*proto.ListTestRecipientsResponse, error) {
+	items, err := s.repo.List(ctx, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	out := &proto.ListTestRecipientsResponse{Recipients: make([]*proto.TestRecipient, 0, len(items))}
+	for _, r := range items {
+		out.Recipients = append(out.Recipients, testRecipientToProto(r))
+	}
+	return out, nil
+}
+
+func (s *testRecipientService) DeleteTestRecipient(
+	ctx context.Context,
+	workspaceID uuid.UUID,
+	in *proto.DeleteTestRecipientRequest,
+) (*proto.DeleteTestRecipientResponse, error) {
+	id, err := uuid.Parse(in.Id)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid test recipient id")
+	}
+	deleted, err := s.repo.Delete(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	return &proto.DeleteTestRecipientResponse{Deleted: deleted}, nil
+}
+
+// VerifyTestRecipient checks a verification token and marks the address as
+// verified.
+func (s *testRecipientService) VerifyTestRecipient(
+	ctx context.Context,
+	in *proto.VerifyTestRecipientRequest,
+) (*proto.TestRecipient, error) {
+	claims, err := s.signer.Verify(verifyRecipientPurpose, in.Token)
+	if err != nil {
+		if errors.Is(err, signedlink.ErrExpired) {
+			return nil, status.Error(codes.FailedPrecondition, "verification link expired")
+		}
+		return nil, status.Error(codes.InvalidArgument, "invalid verification link")
+	}
+	workspaceID, err1 := uuid.Parse(claims["workspace"])
+	id, err2 := uuid.Parse(claims["recipient"])
+	if err1 != nil || err2 != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid verification link")
+	}
+	r, err := s.repo.MarkVerified(ctx, workspaceID, id)
+	if err != nil {
+		return nil, err
+	}
+	if r == nil {
+		return nil, status.Error(codes.NotFound, "test recipient not found")
+	}
+	return testRecipientToProto(r), nil
+}
+
+func testRecipientToProto(r *model.TestRecipient) *proto.TestRecipient {
+	out := &proto.TestRecipient{
+		Id:        r.ID.String(),
+		Email:     r.Email,
+		Verified:  r.VerifiedAt != nil,
+		CreatedAt: timestamppb.New(r.CreatedAt),
+	}
+	if r.VerifiedAt != nil {
+		out.VerifiedAt = timestamppb.New(*r.VerifiedAt)
+	}
+	return out
+}
@@ -0,0 +1,172 @@
+package service_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/api/v1/proto"
+	"github.com/SinaHo/email-marketing-backend/internal/emailvalidation"
+	"github.com/SinaHo/email-marketing-backend/internal/handler"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeTestRecipientRepo is an in-memory repository.TestRecipientRepository
+type fakeTestRecipientRepo struct {
+	items map[uuid.UUID]*model.TestRecipient
+}
+
+func newFakeTestRecipientRepo() *fakeTestRecipientRepo {
+	return &fakeTestRecipientRepo{items: map[uuid.UUID]*model.TestRecipient{}}
+}
+
+func (f *fakeTestRecipientRepo) Add(ctx context.Context, workspaceID uuid.UUID, email string) (*model.TestRecipient, error) {
+	for _, r := range f.items {
+		if r.WorkspaceID == workspaceID && r.Email == email {
+			return r, nil
+		}
+	}
+	r := &model.TestRecipient{ID: uuid.New(), WorkspaceID: workspaceID, Email: email, CreatedAt: time.Now()}
+	f.items[r.ID] = r
+	return r, nil
+}
+func (f *fakeTestRecipientRepo) List(ctx context.Context, workspaceID uuid.UUID) ([]*model.TestRecipient, error) {
+	var out []*model.TestRecipient
+	for _, r := range f.items {
+		if r.WorkspaceID == workspaceID {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+func (f *fakeTestRecipientRepo) Delete(ctx context.Context, workspaceID, id uuid.UUID) (bool, error) {
+	r, ok := f.items[id]
+	if !ok || r.WorkspaceID != workspaceID {
+		return false, nil
+	}
+	delete(f.items, id)
+	return true, nil
+}
+func (f *fakeTestRecipientRepo) MarkVerified(ctx context.Context, workspaceID, id uuid.UUID) (*model.TestRecipient, error) {
+	r, ok := f.items[id]
+	if !ok || r.WorkspaceID != workspaceID {
+		return nil, nil
+	}
+	if r.VerifiedAt == nil {
+		now := time.Now()
+		r.VerifiedAt = &now
+	}
+	return r, nil
+}
+func (f *fakeTestRecipientRepo) MarkVerificationSent(ctx context.Context, workspaceID, id uuid.UUID, since time.Time) (bool, error) {
+	r, ok := f.items[id]
+	if !ok || r.WorkspaceID != workspaceID {
+		return false, nil
+	}
+	for _, o := range f.items {
+		if o.Email == r.Email && o.VerificationSentAt != nil && o.VerificationSentAt.After(since) {
+			return false, nil
+		}
+	}
+	now := time.Now()
+	r.VerificationSentAt = &now
+	return true, nil
+}
+func (f *fakeTestRecipientRepo) GetByEmails(ctx context.Context, workspaceID uuid.UUID, emails []string) ([]*model.TestRecipient, error) {
+	var out []*model.TestRecipient
+	for _, r := range f.items {
+		for _, e := range emails {
+			if r.WorkspaceID == workspaceID && r.Email == e {
+				out = append(out, r)
+			}
+		}
+	}
+	return out, nil
+}
+
+func TestTestRecipient_Verification(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	repo := newFakeTestRecipientRepo()
+	mailer := &mockMailer{}
+	svc := service.NewTestRecipientService(repo, emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com/")
+
+	r, err := svc.AddTestRecipient(ctx, workspace, &proto.AddTestRecipientRequest{Email: "QA@Example.com"})
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "qa@example.com", r.Email)
+	assert.False(t, r.Verified)
+	assert.Equal(t, 1, mailer.sent)
+
+	i := strings.Index(mailer.body, "https://example.com/test-recipients/verify?token=")
+	if !assert.GreaterOrEqual(t, i, 0) {
+		return
+	}
+	link := strings.Fields(mailer.body[i:])[0]
+
+	// Follow the link to the page the server serves it with. Opening it
+	// does not verify, so scanners cannot.
+	mux := http.NewServeMux()
+	mux.Handle("/test-recipients/verify", handler.NewTestRecipientVerifyPage(svc))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	list, _ := svc.ListTestRecipients(ctx, workspace, &proto.ListTestRecipientsRequest{})
+	assert.False(t, list.Recipients[0].Verified)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, link, nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "qa@example.com can now receive test emails")
+	list, _ = svc.ListTestRecipients(ctx, workspace, &proto.ListTestRecipientsRequest{})
+	assert.True(t, list.Recipients[0].Verified)
+
+	// Verified addresses are not emailed again.
+	_, err = svc.AddTestRecipient(ctx, workspace, &proto.AddTestRecipientRequest{Email: "qa@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, mailer.sent)
+
+	_, err = svc.VerifyTestRecipient(ctx, &proto.VerifyTestRecipientRequest{Token: "bogus"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "https://example.com/test-recipients/verify?token=bogus", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTestRecipient_ThrottlesVerification(t *testing.T) {
+	ctx := context.Background()
+	repo := newFakeTestRecipientRepo()
+	mailer := &mockMailer{}
+	svc := service.NewTestRecipientService(repo, emailvalidation.New(emailvalidation.Options{}), mailer, signedlink.New([]byte("k")), "https://example.com/")
+
+	workspace := uuid.New()
+	_, err := svc.AddTestRecipient(ctx, workspace, &proto.AddTestRecipientRequest{Email: "qa@example.com"})
+	assert.NoError(t, err)
+	_, err = svc.AddTestRecipient(ctx, workspace, &proto.AddTestRecipientRequest{Email: "qa@example.com"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	// Nor can another workspace mail the address meanwhile.
+	_, err = svc.AddTestRecipient(ctx, uuid.New(), &proto.AddTestRecipientRequest{Email: "qa@example.com"})
+	assert.Equal(t, codes.ResourceExhausted, status.Code(err))
+	assert.Equal(t, 1, mailer.sent)
+
+	// Once the interval has passed, a new link is sent.
+	for _, r := range repo.items {
+		if r.VerificationSentAt != nil {
+			earlier := r.VerificationSentAt.Add(-time.Hour)
+			r.VerificationSentAt = &earlier
+		}
+	}
+	_, err = svc.AddTestRecipient(ctx, workspace, &proto.AddTestRecipientRequest{Email: "qa@example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, mailer.sent)
+}
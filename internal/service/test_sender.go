@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/SinaHo/email-marketing-backend/internal/bounce"
+	"github.com/SinaHo/email-marketing-backend/internal/delivery"
+	"github.com/SinaHo/email-marketing-backend/internal/mail"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/google/uuid"
+)
+
+// TestEmail is a rendered template test.
+type TestEmail struct {
+	// From is the sender of the test. The TestSender's own address is
+	// used when its Email is empty.
+	From    mail.Address
+	ReplyTo string
+	To      []string
+	Subject string
+	Text    string
+	HTML    string
+	// UnsubscribeURL is the stand-in for the unsubscribe link the test
+	// body was rendered with.
+	UnsubscribeURL string
+}
+
+// TestSender sends template tests the way CampaignDelivery sends campaign
+// emails, so testers see what recipients will: DKIM-signed, with the
+// bounces return path and with List-Unsubscribe headers.
+type TestSender interface {
+	// SendTest sends email to each of its recipients in turn.
+	SendTest(ctx context.Context, workspaceID uuid.UUID, email *TestEmail) error
+}
+
+type testSender struct {
+	domains repository.SendingDomainRepository
+	signer  MessageSigner
+	verp    *bounce.VERP
+	sender  delivery.Sender
+	from    mail.Address
+}
+
+// NewTestSender returns a TestSender delivering with sender, from the
+// given address unless a test names its own sender. Senders of their own
+// must be on a verified sending domain of the workspace in domains, unless
+// domains is nil. Tests are DKIM-signed by signer unless it is nil, and
+// returned to the bounces address of verp unless it is nil. Their return
+// path traces to no send job, so their bounces do not suppress the tester.
+func NewTestSender(
+	domains repository.SendingDomainRepository,
+	signer MessageSigner,
+	verp *bounce.VERP,
+	sender delivery.Sender,
+	from mail.Address,
+) TestSender {
+	return &testSender{domains: domains, signer: signer, verp: verp, sender: sender, from: from}
+}
+
+func (s *testSender) SendTest(ctx context.Context, workspaceID uuid.UUID, email *TestEmail) error {
+	from := s.from
+	if email.From.Email != "" {
+		if s.domains != nil {
+			if err := checkSendingDomain(ctx, s.domains, workspaceID, email.From.Email); err != nil {
+				return err
+			}
+		}
+		from = email.From
+	}
+	for _, to := range email.To {
+		msg := &mail.Message{
+			From:    from,
+			To:      []mail.Address{{Email: to}},
+			Subject: email.Subject,
+			Text:    email.Text,
+			HTML:    email.HTML,
+			Headers: unsubscribeHeaders(email.UnsubscribeURL),
+		}
+		if email.ReplyTo != "" {
+			msg.ReplyTo = []mail.Address{{Email: email.ReplyTo}}
+		}
+		env, raw, err := buildCampaignEmail(s.verp, 0, msg, to)
+		if err != nil {
+			return fmt.Errorf("build email: %w", err)
+		}
+		if s.signer != nil {
+			if raw, err = s.signer.Sign(ctx, workspaceID, from.Email, raw); err != nil {
+				return fmt.Errorf("sign email: %w", err)
+			}
+		}
+		if err := s.sender.Send(ctx, env, raw); err != nil {
+			return fmt.Errorf("deliver email: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/SinaHo/email-marketing-backend/internal/htmlmail"
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/SinaHo/email-marketing-backend/internal/tracking"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	openPurpose  = "track_open"
+	clickPurpose = "track_click"
+
+	// trackingRepeatWindow is how long the same hit of a client is
+	// recorded only once, so reloads and floods do not fill the table.
+	trackingRepeatWindow = time.Minute
+	// maxRecentHits bounds the hits remembered for trackingRepeatWindow;
+	// beyond it they are forgotten and repeats recorded again.
+	maxRecentHits = 100000
+	// maxUserAgentBytes bounds the user agents recorded.
+	maxUserAgentBytes = 512
+)
+
+// TrackingOptions selects what a TrackingService tracks.
+type TrackingOptions struct {
+	Opens  bool
+	Clicks bool
+}
+
+// TrackingHit is a request to the open pixel or a tracked link.
+type TrackingHit struct {
+	Client ClientInfo
+	// Prefetch is set when the request was marked as a prefetch.
+	Prefetch bool
+}
+
+// TrackingService tracks the opens and clicks of campaign emails. Tracked
+// links carry a token signed for one recipient and link target, so the
+// redirector only leads to URLs that were in the message.
+type TrackingService interface {
+	// Track rewrites the links of the HTML body of job's email to tracked
+	// links and adds the open pixel. Links to the URLs in skip, such as
+	// the unsubscribe link, are left alone.
+	Track(job *model.SendJob, html string, skip ...string) (string, error)
+	// Open records an open. It fails with INVALID_ARGUMENT for invalid
+	// tokens.
+	Open(ctx context.Context, hit TrackingHit, token string) error
+	// Click records a click and returns the link target to redirect to.
+	// It fails with INVALID_ARGUMENT for invalid tokens.
+	Click(ctx context.Context, hit TrackingHit, token string) (string, error)
+}
+
+type trackingService struct {
+	events  repository.TrackingRepository
+	signer  *signedlink.Signer
+	baseURL string
+	opts    TrackingOptions
+	logger  *zap.SugaredLogger
+
+	mu     sync.Mutex
+	recent map[uint64]time.Time
+	swept  time.Time
+}
+
+// NewTrackingService constructs a new TrackingService. Links point to
+// baseURL and are signed with signer. Events are recorded on a best effort
+// basis: failures are logged, and do not keep the pixel from loading or
+// the link from redirecting. A client loading the same pixel or link again
+// within a minute is recorded once.
+func NewTrackingService(
+	events repository.TrackingRepository,
+	signer *signedlink.Signer,
+	baseURL string,
+	opts TrackingOptions,
+	logger *zap.SugaredLogger,
+) TrackingService {
+	return &trackingService{
+		events:  events,
+		signer:  signer,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		opts:    opts,
+		logger:  logger,
+		recent:  make(map[uint64]time.Time),
+	}
+}
+
+func (s *trackingService) Track(job *model.SendJob, html string, skip ...string) (string, error) {
+	claims := map[string]string{
+		"workspace": job.WorkspaceID.String(),
+		"campaign":  job.CampaignID.String(),
+		"contact":   job.ContactID.String(),
+		"job":       strconv.FormatInt(job.ID, 10),
+		"sent":      strconv.FormatInt(time.Now().Unix(), 10),
+	}
+	link := func(href string) (string, bool) {
+		if !s.opts.Clicks || slices.Contains(skip, href) {
+			return "", false
+		}
+		c := maps.Clone(claims)
+		c["url"] = href
+		return s.baseURL + "/track/click?token=" + url.QueryEscape(s.signer.Sign(clickPurpose, c, 0)), true
+	}
+	var pixel string
+	if s.opts.Opens {
+		pixel = s.baseURL + "/track/open?token=" + url.QueryEscape(s.signer.Sign(openPurpose, claims, 0))
+	}
+	return htmlmail.Track(html, link, pixel)
+}
+
+func (s *trackingService) Open(ctx context.Context, hit TrackingHit, token string) error {
+	e, sent, err := s.event(openPurpose, token)
+	if err != nil {
+		return err
+	}
+	e.Kind = model.TrackingEventKind_Open
+	s.record(ctx, e, hit, sent)
+	return nil
+}
+
+func (s *trackingService) Click(ctx context.Context, hit TrackingHit, token string) (string, error) {
+	e, sent, err := s.event(clickPurpose, token)
+	if err != nil {
+		return "", err
+	}
+	// Targets were checked when the link was signed; check them again
+	// so a leaked signing key cannot turn the redirector into a way to
+	// run scripts.
+	u, err := url.Parse(e.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", status.Error(codes.InvalidArgument, "invalid tracking link")
+	}
+	e.Kind = model.TrackingEventKind_Click
+	s.record(ctx, e, hit, sent)
+	return e.URL, nil
+}
+
+// event returns the event of a token, without its kind and client, and
+// the time the message was sent.
+func (s *trackingService) event(purpose, token string) (*model.TrackingEvent, time.Time, error) {
+	claims, err := s.signer.Verify(purpose, token)
+	if err != nil {
+		return nil, time.Time{}, status.Error(codes.InvalidArgument, "invalid tracking link")
+	}
+	workspaceID, err1 := uuid.Parse(claims["workspace"])
+	campaignID, err2 := uuid.Parse(claims["campaign"])
+	contactID, err3 := uuid.Parse(claims["contact"])
+	jobID, err4 := strconv.ParseInt(claims["job"], 10, 64)
+	sent, err5 := strconv.ParseInt(claims["sent"], 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || err4 != nil || err5 != nil {
+		return nil, time.Time{}, status.Error(codes.InvalidArgument, "invalid tracking link")
+	}
+	return &model.TrackingEvent{
+		WorkspaceID: workspaceID,
+		CampaignID:  campaignID,
+		ContactID:   contactID,
+		SendJobID:   jobID,
+		URL:         claims["url"],
+	}, time.Unix(sent, 0), nil
+}
+
+func (s *trackingService) record(ctx context.Context, e *model.TrackingEvent, hit TrackingHit, sent time.Time) {
+	e.IP, e.UserAgent = hit.Client.IP, truncateUTF8(strings.ToValidUTF8(hit.Client.UserAgent, ""), maxUserAgentBytes)
+	e.Agent = string(tracking.Classify(tracking.Request{
+		Click:     e.Kind == model.TrackingEventKind_Click,
+		UserAgent: hit.Client.UserAgent,
+		IP:        hit.Client.IP,
+		Prefetch:  hit.Prefetch,
+		SinceSend: time.Since(sent),
+	}))
+	if s.repeated(e, time.Now()) {
+		return
+	}
+	if err := s.events.Add(ctx, e); err != nil {
+		s.logger.Errorf("record %s of job %d: %v", e.Kind, e.SendJobID, err)
+	}
+}
+
+// repeated reports whether the same client made the hit of e within
+// trackingRepeatWindow, and otherwise remembers it. Prefetches and the
+// recipient's own hits are told apart by the class of client.
+func (s *trackingService) repeated(e *model.TrackingEvent, now time.Time) bool {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d\x00%s\x00%s\x00%s\x00%s\x00%s", e.SendJobID, e.Kind, e.URL, e.Agent, e.IP, e.UserAgent)
+	key := h.Sum64()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.swept) >= trackingRepeatWindow || len(s.recent) >= maxRecentHits {
+		for k, at := range s.recent {
+			if now.Sub(at) >= trackingRepeatWindow {
+				delete(s.recent, k)
+			}
+		}
+		if len(s.recent) >= maxRecentHits {
+			clear(s.recent)
+		}
+		s.swept = now
+	}
+	if at, ok := s.recent[key]; ok && now.Sub(at) < trackingRepeatWindow {
+		return true
+	}
+	s.recent[key] = now
+	return false
+}
+
+// truncateUTF8 returns s cut to at most n bytes without splitting a
+// character.
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,152 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeTrackingRepo struct {
+	events []*model.TrackingEvent
+	err    error
+}
+
+func (r *fakeTrackingRepo) Add(ctx context.Context, e *model.TrackingEvent) error {
+	if r.err != nil {
+		return r.err
+	}
+	r.events = append(r.events, e)
+	return nil
+}
+
+var trackedURL = regexp.MustCompile(`(?:href|src)="(https://mailer\.example/track/[^"]+)"`)
+
+// tokens returns the tokens of the tracked URLs in html, by path.
+func tokens(t *testing.T, html string) map[string][]string {
+	out := make(map[string][]string)
+	for _, m := range trackedURL.FindAllStringSubmatch(html, -1) {
+		u, err := url.Parse(m[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		out[u.Path] = append(out[u.Path], u.Query().Get("token"))
+	}
+	return out
+}
+
+func TestTracking(t *testing.T) {
+	ctx := context.Background()
+	events := &fakeTrackingRepo{}
+	svc := service.NewTrackingService(events, signedlink.New([]byte("k")), "https://mailer.example/",
+		service.TrackingOptions{Opens: true, Clicks: true}, zap.NewNop().Sugar())
+	job := &model.SendJob{ID: 7, CampaignID: uuid.New(), WorkspaceID: uuid.New(), ContactID: uuid.New(), Email: "ana@example.org"}
+
+	html, err := svc.Track(job, `<p><a href="https://acme.com/launch?a=1&amp;b=2">Launch</a> `+
+		`<a href="https://mailer.example/unsubscribe?token=x">Unsubscribe</a></p>`, "https://mailer.example/unsubscribe?token=x")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Contains(t, html, `<a href="https://mailer.example/unsubscribe?token=x">`)
+	toks := tokens(t, html)
+	if !assert.Len(t, toks["/track/click"], 1) || !assert.Len(t, toks["/track/open"], 1) {
+		return
+	}
+
+	browser := service.ClientInfo{IP: "198.51.100.7", UserAgent: "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0"}
+	assert.NoError(t, svc.Open(ctx, service.TrackingHit{Client: service.ClientInfo{IP: "17.58.101.1", UserAgent: "Mozilla/5.0"}}, toks["/track/open"][0]))
+	target, err := svc.Click(ctx, service.TrackingHit{Client: browser, Prefetch: true}, toks["/track/click"][0])
+	assert.NoError(t, err)
+	assert.Equal(t, "https://acme.com/launch?a=1&b=2", target)
+
+	if assert.Len(t, events.events, 2) {
+		open, click := events.events[0], events.events[1]
+		assert.Equal(t, model.TrackingEventKind_Open, open.Kind)
+		assert.Equal(t, "apple_mpp", open.Agent)
+		assert.Equal(t, job.CampaignID, open.CampaignID)
+		assert.Equal(t, job.ContactID, open.ContactID)
+		assert.Equal(t, int64(7), open.SendJobID)
+		assert.Equal(t, model.TrackingEventKind_Click, click.Kind)
+		assert.Equal(t, "https://acme.com/launch?a=1&b=2", click.URL)
+		assert.Equal(t, "prefetch", click.Agent)
+		assert.Equal(t, "198.51.100.7", click.IP)
+	}
+
+	// Recording is best effort: the link still redirects.
+	events.err = errors.New("database down")
+	target, err = svc.Click(ctx, service.TrackingHit{Client: browser}, toks["/track/click"][0])
+	assert.NoError(t, err)
+	assert.Equal(t, "https://acme.com/launch?a=1&b=2", target)
+}
+
+func TestTracking_InvalidTokens(t *testing.T) {
+	ctx := context.Background()
+	signer := signedlink.New([]byte("k"))
+	svc := service.NewTrackingService(&fakeTrackingRepo{}, signer, "https://mailer.example",
+		service.TrackingOptions{Opens: true, Clicks: true}, zap.NewNop().Sugar())
+	job := &model.SendJob{ID: 7, CampaignID: uuid.New(), WorkspaceID: uuid.New(), ContactID: uuid.New()}
+	html, _ := svc.Track(job, `<a href="https://acme.com/">x</a>`)
+	toks := tokens(t, html)
+
+	// Open and click tokens are not interchangeable.
+	_, err := svc.Click(ctx, service.TrackingHit{}, toks["/track/open"][0])
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	assert.Equal(t, codes.InvalidArgument, status.Code(svc.Open(ctx, service.TrackingHit{}, toks["/track/click"][0])))
+
+	// Only web links redirect, even when signed.
+	forged := signer.Sign("track_click", map[string]string{
+		"workspace": job.WorkspaceID.String(), "campaign": job.CampaignID.String(), "contact": job.ContactID.String(),
+		"job": "7", "sent": "0", "url": "javascript:alert(1)",
+	}, 0)
+	_, err = svc.Click(ctx, service.TrackingHit{}, forged)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestTracking_Disabled(t *testing.T) {
+	svc := service.NewTrackingService(&fakeTrackingRepo{}, signedlink.New([]byte("k")), "https://mailer.example",
+		service.TrackingOptions{}, zap.NewNop().Sugar())
+	html, err := svc.Track(&model.SendJob{ID: 1}, `<p><a href="https://acme.com/">x</a></p>`)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p><a href="https://acme.com/">x</a></p>`, html)
+}
+
+func TestTracking_Repeats(t *testing.T) {
+	ctx := context.Background()
+	events := &fakeTrackingRepo{}
+	svc := service.NewTrackingService(events, signedlink.New([]byte("k")), "https://mailer.example",
+		service.TrackingOptions{Opens: true, Clicks: true}, zap.NewNop().Sugar())
+	job := &model.SendJob{ID: 7, CampaignID: uuid.New(), WorkspaceID: uuid.New(), ContactID: uuid.New()}
+	html, _ := svc.Track(job, `<a href="https://acme.com/a">a</a> <a href="https://acme.com/b">b</a>`)
+	toks := tokens(t, html)
+
+	browser := service.ClientInfo{IP: "198.51.100.7", UserAgent: "Mozilla/5.0 " + strings.Repeat("é", 1000)}
+	for range 5 {
+		assert.NoError(t, svc.Open(ctx, service.TrackingHit{Client: browser}, toks["/track/open"][0]))
+	}
+	// Other links, and other clients, are recorded.
+	for _, tok := range toks["/track/click"] {
+		_, err := svc.Click(ctx, service.TrackingHit{Client: browser}, tok)
+		assert.NoError(t, err)
+	}
+	other := service.ClientInfo{IP: "203.0.113.9", UserAgent: "Mozilla/5.0"}
+	assert.NoError(t, svc.Open(ctx, service.TrackingHit{Client: other}, toks["/track/open"][0]))
+
+	if assert.Len(t, events.events, 4) {
+		ua := events.events[0].UserAgent
+		assert.LessOrEqual(t, len(ua), 512)
+		assert.True(t, utf8.ValidString(ua))
+		assert.True(t, strings.HasPrefix(ua, "Mozilla/5.0 éé"))
+	}
+}
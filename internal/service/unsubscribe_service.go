@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/repository"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	unsubscribePurpose = "unsubscribe"
+	// unsubscribeSource is the source of suppressions added by unsubscribe
+	// links.
+	unsubscribeSource = "unsubscribe_link"
+	// Consent sources of unsubscribes: a mail client's one-click request
+	// (RFC 8058), or the button of the landing page.
+	consentSourceOneClick = "one_click"
+	consentSourcePage     = "unsubscribe_page"
+)
+
+// Unsubscriber is the recipient an unsubscribe link was sent to.
+type Unsubscriber struct {
+	Email string
+	// Lang is the contact's language, for the landing page.
+	Lang model.Language
+	// Unsubscribed is set once the address is suppressed.
+	Unsubscribed bool
+}
+
+// UnsubscribeService implements the unsubscribe links of campaign emails.
+// Links carry a token signed for one recipient, so they work without
+// logging in and cannot be altered to unsubscribe someone else.
+type UnsubscribeService interface {
+	// URL returns the unsubscribe link of the recipient of job.
+	URL(job *model.SendJob) string
+	// Lookup returns the recipient of the link with token, without
+	// unsubscribing them. It fails with INVALID_ARGUMENT for invalid
+	// tokens.
+	Lookup(ctx context.Context, token string) (*Unsubscriber, error)
+	// Unsubscribe suppresses the recipient of the link with token, marks
+	// the contact unsubscribed and records it in the consent history.
+	// oneClick reports a one-click request of a mail client. Unsubscribing
+	// again changes nothing.
+	Unsubscribe(ctx context.Context, client ClientInfo, token string, oneClick bool) (*Unsubscriber, error)
+}
+
+type unsubscribeService struct {
+	contacts     repository.ContactRepository
+	suppressions repository.SuppressionRepository
+	consent      repository.ConsentRepository
+	signer       *signedlink.Signer
+	baseURL      string
+}
+
+// NewUnsubscribeService constructs a new UnsubscribeService. Links point to
+// baseURL and are signed with signer.
+func NewUnsubscribeService(
+	contacts repository.ContactRepository,
+	suppressions repository.SuppressionRepository,
+	consent repository.ConsentRepository,
+	signer *signedlink.Signer,
+	baseURL string,
+) UnsubscribeService {
+	return &unsubscribeService{
+		contacts:     contacts,
+		suppressions: suppressions,
+		consent:      consent,
+		signer:       signer,
+		baseURL:      strings.TrimRight(baseURL, "/"),
+	}
+}
+
+// URL signs tokens without expiry: RFC 8058 links must keep working for as
+// long as the message is kept.
+func (s *unsubscribeService) URL(job *model.SendJob) string {
+	token := s.signer.Sign(unsubscribePurpose, map[string]string{
+		"workspace": job.WorkspaceID.String(),
+		"contact":   job.ContactID.String(),
+		"campaign":  job.CampaignID.String(),
+		"email":     strings.ToLower(job.Email),
+	}, 0)
+	return s.baseURL + "/unsubscribe?token=" + url.QueryEscape(token)
+}
+
+// unsubscribeClaims are the verified contents of an unsubscribe token.
+type unsubscribeClaims struct {
+	workspaceID, contactID, campaignID uuid.UUID
+	email                              string
+}
+
+func (s *unsubscribeService) verify(token string) (*unsubscribeClaims, error) {
+	claims, err := s.signer.Verify(unsubscribePurpose, token)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "invalid unsubscribe link")
+	}
+	workspaceID, err1 := uuid.Parse(claims["workspace"])
+	contactID, err2 := uuid.Parse(claims["contact"])
+	campaignID, err3 := uuid.Parse(claims["campaign"])
+	email := claims["email"]
+	if err1 != nil || err2 != nil || err3 != nil || !strings.Contains(email, "@") {
+		return nil, status.Error(codes.InvalidArgument, "invalid unsubscribe link")
+	}
+	return &unsubscribeClaims{workspaceID: workspaceID, contactID: contactID, campaignID: campaignID, email: email}, nil
+}
+
+func (s *unsubscribeService) Lookup(ctx context.Context, token string) (*Unsubscriber, error) {
+	c, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	return s.unsubscriber(ctx, c)
+}
+
+func (s *unsubscribeService) Unsubscribe(ctx context.Context, client ClientInfo, token string, oneClick bool) (*Unsubscriber, error) {
+	c, err := s.verify(token)
+	if err != nil {
+		return nil, err
+	}
+	u, err := s.unsubscriber(ctx, c)
+	if err != nil || u.Unsubscribed {
+		return u, err
+	}
+
+	_, err = s.suppressions.Add(ctx, &model.Suppression{
+		WorkspaceID: c.workspaceID,
+		Kind:        model.SuppressionKind_Email,
+		Value:       c.email,
+		Reason:      model.SuppressionReason_Unsubscribed,
+		Source:      unsubscribeSource,
+	})
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.contacts.SetStatus(ctx, c.workspaceID, c.contactID,
+		[]model.ContactStatus{model.ContactStatus_Active, model.ContactStatus_Pending},
+		model.ContactStatus_Unsubscribed)
+	if err != nil {
+		return nil, err
+	}
+	source := consentSourcePage
+	if oneClick {
+		source = consentSourceOneClick
+	}
+	err = s.consent.Record(ctx, &model.ConsentRecord{
+		WorkspaceID: c.workspaceID,
+		ContactID:   c.contactID,
+		Action:      model.ConsentAction_Unsubscribed,
+		IP:          client.IP,
+		UserAgent:   client.UserAgent,
+		Source:      source + ":campaign/" + c.campaignID.String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	u.Unsubscribed = true
+	return u, nil
+}
+
+// unsubscriber returns the recipient of c. Contacts deleted since can
+// still unsubscribe their address.
+func (s *unsubscribeService) unsubscriber(ctx context.Context, c *unsubscribeClaims) (*Unsubscriber, error) {
+	u := &Unsubscriber{Email: c.email, Lang: model.Language_EN}
+	contact, err := s.contacts.GetContact(ctx, c.workspaceID, c.contactID)
+	if err != nil {
+		return nil, err
+	}
+	if contact != nil {
+		u.Lang = contact.Lang
+	}
+	sup, err := s.suppressions.Match(ctx, c.workspaceID, c.email, c.email[strings.LastIndexByte(c.email, '@')+1:])
+	if err != nil {
+		return nil, err
+	}
+	u.Unsubscribed = sup != nil && sup.Kind == model.SuppressionKind_Email && sup.Reason == model.SuppressionReason_Unsubscribed
+	return u, nil
+}
@@ -0,0 +1,85 @@
+package service_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/model"
+	"github.com/SinaHo/email-marketing-backend/internal/service"
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnsubscribe(t *testing.T) {
+	ctx := context.Background()
+	workspace := uuid.New()
+	contact := &model.Contact{ID: uuid.New(), WorkspaceID: workspace, Email: "Ana@Example.org", Lang: model.Language_FA, Status: model.ContactStatus_Active}
+	contacts := &mockContactRepo{contacts: []*model.Contact{contact}}
+	suppressions := &mockSuppressionRepo{}
+	consent := &mockConsentRepo{}
+	svc := service.NewUnsubscribeService(contacts, suppressions, consent, signedlink.New([]byte("k")), "https://mailer.example/")
+
+	job := &model.SendJob{ID: 1, CampaignID: uuid.New(), WorkspaceID: workspace, ContactID: contact.ID, Email: contact.Email}
+	link, err := url.Parse(svc.URL(job))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "https://mailer.example/unsubscribe", link.Scheme+"://"+link.Host+link.Path)
+	token := link.Query().Get("token")
+
+	// Looking the link up unsubscribes nobody.
+	u, err := svc.Lookup(ctx, token)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &service.Unsubscriber{Email: "ana@example.org", Lang: model.Language_FA}, u)
+	assert.Empty(t, suppressions.added)
+	assert.Equal(t, "example.org", suppressions.matchedDomain)
+
+	client := service.ClientInfo{IP: "203.0.113.7", UserAgent: "Gmail"}
+	u, err = svc.Unsubscribe(ctx, client, token, true)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.True(t, u.Unsubscribed)
+	if assert.Len(t, suppressions.added, 1) {
+		s := suppressions.added[0]
+		assert.Equal(t, model.SuppressionKind_Email, s.Kind)
+		assert.Equal(t, "ana@example.org", s.Value)
+		assert.Equal(t, model.SuppressionReason_Unsubscribed, s.Reason)
+		assert.Equal(t, "unsubscribe_link", s.Source)
+	}
+	assert.Equal(t, model.ContactStatus_Unsubscribed, contact.Status)
+	if assert.Len(t, consent.records, 1) {
+		r := consent.records[0]
+		assert.Equal(t, model.ConsentAction_Unsubscribed, r.Action)
+		assert.Equal(t, "203.0.113.7", r.IP)
+		assert.Equal(t, "Gmail", r.UserAgent)
+		assert.Equal(t, "one_click:campaign/"+job.CampaignID.String(), r.Source)
+	}
+
+	// Mail clients may repeat the request.
+	suppressions.matchResult = suppressions.added[0]
+	u, err = svc.Unsubscribe(ctx, client, token, false)
+	assert.NoError(t, err)
+	assert.True(t, u.Unsubscribed)
+	assert.Len(t, suppressions.added, 1)
+	assert.Len(t, consent.records, 1)
+}
+
+func TestUnsubscribe_InvalidToken(t *testing.T) {
+	signer := signedlink.New([]byte("k"))
+	svc := service.NewUnsubscribeService(&mockContactRepo{}, &mockSuppressionRepo{}, &mockConsentRepo{}, signer, "https://mailer.example")
+
+	job := &model.SendJob{CampaignID: uuid.New(), WorkspaceID: uuid.New(), ContactID: uuid.New(), Email: "ana@example.org"}
+	token, _ := url.Parse(svc.URL(job))
+	forged := token.Query().Get("token") + "x"
+	for _, tok := range []string{"", "forged.token", forged, signer.Sign("confirm", map[string]string{"email": "ana@example.org"}, 0)} {
+		_, err := svc.Lookup(context.Background(), tok)
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), tok)
+	}
+}
@@ -0,0 +1,46 @@
+package signedlink_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/signedlink"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	s := signedlink.New([]byte("secret"))
+	token := s.Sign("confirm", map[string]string{"contact": "c1", "list": "l1"}, time.Hour)
+
+	claims, err := s.Verify("confirm", token)
+	assert.NoError(t, err)
+	assert.Equal(t, "c1", claims["contact"])
+	assert.Equal(t, "l1", claims["list"])
+}
+
+func TestVerify_Rejects(t *testing.T) {
+	s := signedlink.New([]byte("secret"))
+	token := s.Sign("confirm", map[string]string{"contact": "c1"}, 0)
+
+	_, err := s.Verify("unsubscribe", token)
+	assert.ErrorIs(t, err, signedlink.ErrInvalid)
+
+	_, err = signedlink.New([]byte("other")).Verify("confirm", token)
+	assert.ErrorIs(t, err, signedlink.ErrInvalid)
+
+	_, err = s.Verify("confirm", token[:len(token)-2]+"xx")
+	assert.ErrorIs(t, err, signedlink.ErrInvalid)
+
+	_, err = s.Verify("confirm", "garbage")
+	assert.ErrorIs(t, err, signedlink.ErrInvalid)
+}
+
+func TestVerify_Expired(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := signedlink.New([]byte("secret")).WithClock(func() time.Time { return now })
+	token := s.Sign("confirm", nil, time.Minute)
+
+	later := s.WithClock(func() time.Time { return now.Add(2 * time.Minute) })
+	_, err := later.Verify("confirm", token)
+	assert.ErrorIs(t, err, signedlink.ErrExpired)
+}
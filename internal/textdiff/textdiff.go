@@ -0,0 +1,217 @@
+// Package textdiff computes line-based differences between two texts and
+// renders them in unified diff format.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// maxCells bounds the LCS table. Larger inputs are diffed as a whole
+// replacement of the differing middle section.
+const maxCells = 4_000_000
+
+type Kind int
+
+const (
+	Equal Kind = iota
+	Delete
+	Insert
+)
+
+// Op is one line of an edit script.
+type Op struct {
+	Kind Kind
+	Line string
+}
+
+// Lines returns the edit script turning a into b, one Op per line.
+func Lines(a, b string) []Op {
+	return diff(splitLines(a), splitLines(b))
+}
+
+// Unified renders the difference between a and b as a unified diff with
+// the given number of context lines. Equal inputs produce "".
+func Unified(fromName, toName, a, b string, context int) string {
+	ops := Lines(a, b)
+	hunks := groupHunks(ops, context)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(h.aStart, h.aLen), hunkRange(h.bStart, h.bLen))
+		for _, op := range ops[h.from:h.to] {
+			switch op.Kind {
+			case Equal:
+				sb.WriteByte(' ')
+			case Delete:
+				sb.WriteByte('-')
+			case Insert:
+				sb.WriteByte('+')
+			}
+			sb.WriteString(op.Line)
+			sb.WriteByte('\n')
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+func diff(a, b []string) []Op {
+	// Strip the common prefix and suffix; templates usually change in a
+	// small region, which keeps the LCS table small.
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	ops := make([]Op, 0, len(a)+len(b))
+	for _, l := range a[:pre] {
+		ops = append(ops, Op{Equal, l})
+	}
+	ops = append(ops, middle(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, l := range a[len(a)-suf:] {
+		ops = append(ops, Op{Equal, l})
+	}
+	return ops
+}
+
+// middle diffs the differing section with a longest-common-subsequence table.
+func middle(a, b []string) []Op {
+	var ops []Op
+	if len(a)*len(b) > maxCells {
+		for _, l := range a {
+			ops = append(ops, Op{Delete, l})
+		}
+		for _, l := range b {
+			ops = append(ops, Op{Insert, l})
+		}
+		return ops
+	}
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int32, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Equal, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Delete, a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Insert, b[j]})
+	}
+	return ops
+}
+
+type hunk struct {
+	from, to     int // range in ops
+	aStart, aLen int
+	bStart, bLen int
+}
+
+func groupHunks(ops []Op, context int) []hunk {
+	var hunks []hunk
+	aLine, bLine := 0, 0
+	// Line numbers before each op.
+	aAt := make([]int, len(ops)+1)
+	bAt := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aAt[i], bAt[i] = aLine, bLine
+		if op.Kind != Insert {
+			aLine++
+		}
+		if op.Kind != Delete {
+			bLine++
+		}
+	}
+	aAt[len(ops)], bAt[len(ops)] = aLine, bLine
+
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			i++
+			continue
+		}
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+		// Extend while the next change is within 2*context equal lines.
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			if run == len(ops) || run-end > 2*context {
+				end += min(context, run-end)
+				break
+			}
+			end = run
+		}
+		if len(hunks) > 0 && start < hunks[len(hunks)-1].to {
+			start = hunks[len(hunks)-1].to
+		}
+		hunks = append(hunks, hunk{
+			from: start, to: end,
+			aStart: aAt[start], aLen: aAt[end] - aAt[start],
+			bStart: bAt[start], bLen: bAt[end] - bAt[start],
+		})
+		i = end
+	}
+	return hunks
+}
+
+// hunkRange formats a 1-based range; empty ranges name the line before.
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
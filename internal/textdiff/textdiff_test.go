@@ -0,0 +1,40 @@
+package textdiff_test
+
+import (
+	"testing"
+
+	"github.com/SinaHo/email-marketing-backend/internal/textdiff"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	a := "<h1>Hello</h1>\n<p>one</p>\n<p>two</p>\n<p>three</p>\n<p>four</p>\n<p>five</p>\n"
+	b := "<h1>Hello</h1>\n<p>one</p>\n<p>TWO</p>\n<p>three</p>\n<p>four</p>\n<p>five</p>\n<p>six</p>\n"
+
+	got := textdiff.Unified("v1", "v2", a, b, 1)
+	want := "--- v1\n+++ v2\n" +
+		"@@ -2,3 +2,3 @@\n <p>one</p>\n-<p>two</p>\n+<p>TWO</p>\n <p>three</p>\n" +
+		"@@ -6 +6,2 @@\n <p>five</p>\n+<p>six</p>\n"
+	assert.Equal(t, want, got)
+}
+
+func TestUnified_MergesNearbyChanges(t *testing.T) {
+	got := textdiff.Unified("a", "b", "1\n2\n3\n4\n", "1\nX\n3\nY\n", 1)
+	assert.Equal(t, "--- a\n+++ b\n@@ -1,4 +1,4 @@\n 1\n-2\n+X\n 3\n-4\n+Y\n", got)
+}
+
+func TestUnified_EmptySides(t *testing.T) {
+	assert.Equal(t, "", textdiff.Unified("a", "b", "same\n", "same\n", 3))
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n", textdiff.Unified("a", "b", "", "x\ny", 3))
+	assert.Equal(t, "--- a\n+++ b\n@@ -1 +0,0 @@\n-x\n", textdiff.Unified("a", "b", "x", "", 3))
+}
+
+func TestLines(t *testing.T) {
+	ops := textdiff.Lines("a\nb\nc", "a\nc\nd")
+	assert.Equal(t, []textdiff.Op{
+		{Kind: textdiff.Equal, Line: "a"},
+		{Kind: textdiff.Delete, Line: "b"},
+		{Kind: textdiff.Equal, Line: "c"},
+		{Kind: textdiff.Insert, Line: "d"},
+	}, ops)
+}
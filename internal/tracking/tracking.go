@@ -0,0 +1,85 @@
+// Package tracking tells the requests of people opening emails and
+// following their links from those of machines.
+//
+// Many requests to the open pixel and tracked links are not made by the
+// recipient: Apple Mail Privacy Protection downloads the images of every
+// message on delivery, security gateways follow links to scan them, and
+// browsers prefetch pages. Classify recognises them from the user agent,
+// the client address, prefetch headers and how soon after sending the
+// request came.
+package tracking
+
+import (
+	"net"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Class is the kind of client behind a request.
+type Class string
+
+const (
+	// Human requests are made by the recipient's mail client or browser,
+	// possibly through a mail provider's image proxy.
+	Human Class = "human"
+	// AppleMPP requests are made by Apple Mail Privacy Protection, which
+	// downloads images whether or not the message is read.
+	AppleMPP Class = "apple_mpp"
+	// Prefetch requests are made ahead of the recipient, by browsers
+	// prefetching or by scanners checking a message on arrival.
+	Prefetch Class = "prefetch"
+	// Bot requests are made by crawlers, scripts and security scanners.
+	Bot Class = "bot"
+)
+
+// ScanWindow is how soon after sending a request is taken for a scanner
+// checking the message on arrival.
+const ScanWindow = 5 * time.Second
+
+// Request describes a request to the open pixel or a tracked link.
+type Request struct {
+	// Click is set for link clicks and clear for opens.
+	Click     bool
+	UserAgent string
+	IP        string
+	// Prefetch is set when the request was marked as a prefetch, for
+	// example by a Sec-Purpose or X-Moz header.
+	Prefetch bool
+	// SinceSend is the time since the message was sent, or 0 if unknown.
+	SinceSend time.Duration
+}
+
+var botAgent = regexp.MustCompile(`(?i)bot\b|crawl|spider|slurp|curl|wget|python|go-http-client|java/|okhttp|` +
+	`libwww|httpclient|headless|phantomjs|preview|scanner|barracuda|mimecast|proofpoint|ironport|messagelabs|` +
+	`symantec|trendmicro|fireeye|forcepoint|sophos|safelinks|urldefense`)
+
+// appleNet holds the addresses Apple's Mail Privacy Protection proxies
+// fetch from.
+var appleNet = &net.IPNet{IP: net.IPv4(17, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+
+// Classify returns the class of the client behind r.
+func Classify(r Request) Class {
+	ua := strings.TrimSpace(r.UserAgent)
+	switch {
+	case r.Prefetch:
+		return Prefetch
+	case ua == "" || botAgent.MatchString(ua):
+		return Bot
+	case !r.Click && isAppleMPP(ua, r.IP):
+		return AppleMPP
+	case r.SinceSend > 0 && r.SinceSend < ScanWindow:
+		return Prefetch
+	}
+	return Human
+}
+
+// isAppleMPP reports whether an open comes from Apple's proxies, which
+// fetch from Apple's own network with a bare "Mozilla/5.0" user agent.
+func isAppleMPP(ua, ip string) bool {
+	if ua == "Mozilla/5.0" {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	return addr != nil && appleNet.Contains(addr)
+}
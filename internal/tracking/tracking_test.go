@@ -0,0 +1,35 @@
+package tracking_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SinaHo/email-marketing-backend/internal/tracking"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	safari = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+	gmail  = "Mozilla/5.0 (Windows NT 5.1; rv:11.0) Gecko Firefox/11.0 (via ggpht.com GoogleImageProxy)"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		req  tracking.Request
+		want tracking.Class
+	}{
+		{"browser", tracking.Request{Click: true, UserAgent: safari, IP: "198.51.100.7", SinceSend: time.Hour}, tracking.Human},
+		{"image proxy", tracking.Request{UserAgent: gmail, IP: "66.249.84.1"}, tracking.Human},
+		{"apple mpp", tracking.Request{UserAgent: "Mozilla/5.0", IP: "203.0.113.9"}, tracking.AppleMPP},
+		{"apple network", tracking.Request{UserAgent: safari, IP: "17.58.101.1"}, tracking.AppleMPP},
+		{"click from apple network", tracking.Request{Click: true, UserAgent: safari, IP: "17.58.101.1"}, tracking.Human},
+		{"prefetch header", tracking.Request{Click: true, UserAgent: safari, Prefetch: true}, tracking.Prefetch},
+		{"scanned on arrival", tracking.Request{Click: true, UserAgent: safari, SinceSend: time.Second}, tracking.Prefetch},
+		{"no user agent", tracking.Request{Click: true}, tracking.Bot},
+		{"script", tracking.Request{Click: true, UserAgent: "python-requests/2.31"}, tracking.Bot},
+		{"gateway", tracking.Request{Click: true, UserAgent: "Mozilla/5.0 (compatible; Barracuda Sentinel)"}, tracking.Bot},
+	} {
+		assert.Equal(t, tc.want, tracking.Classify(tc.req), tc.name)
+	}
+}
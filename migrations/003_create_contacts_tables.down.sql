@@ -0,0 +1,5 @@
+-- Drop the contact tables
+DROP TABLE IF EXISTS segments;
+DROP TABLE IF EXISTS list_members;
+DROP TABLE IF EXISTS lists;
+DROP TABLE IF EXISTS contacts;
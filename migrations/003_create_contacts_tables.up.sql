@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS contacts (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email          TEXT NOT NULL,
+    first_name     TEXT NOT NULL DEFAULT '',
+    last_name      TEXT NOT NULL DEFAULT '',
+    lang           INTEGER NOT NULL DEFAULT 0,
+    status         TEXT NOT NULL DEFAULT 'active',
+    custom_fields  JSONB NOT NULL DEFAULT '{}',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, email)
+);
+
+CREATE TABLE IF NOT EXISTS lists (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name           TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS list_members (
+    list_id        UUID NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+    contact_id     UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (list_id, contact_id)
+);
+
+CREATE TABLE IF NOT EXISTS segments (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name           TEXT NOT NULL,
+    filter         JSONB NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,2 @@
+-- Drop the export jobs table
+DROP TABLE IF EXISTS export_jobs;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS export_jobs (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    format         TEXT NOT NULL,
+    status         TEXT NOT NULL,
+    file_path      TEXT NOT NULL DEFAULT '',
+    row_count      BIGINT NOT NULL DEFAULT 0,
+    error          TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    finished_at    TIMESTAMPTZ
+);
@@ -0,0 +1,5 @@
+-- Drop the suppressions table and membership status
+ALTER TABLE list_members
+    DROP COLUMN IF EXISTS unsubscribed_at,
+    DROP COLUMN IF EXISTS status;
+DROP TABLE IF EXISTS suppressions;
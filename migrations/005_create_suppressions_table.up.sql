@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS suppressions (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind           TEXT NOT NULL,
+    value          TEXT NOT NULL,
+    reason         TEXT NOT NULL,
+    source         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, kind, value)
+);
+
+ALTER TABLE list_members
+    ADD COLUMN IF NOT EXISTS status TEXT NOT NULL DEFAULT 'subscribed',
+    ADD COLUMN IF NOT EXISTS unsubscribed_at TIMESTAMPTZ;
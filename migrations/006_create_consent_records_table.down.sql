@@ -0,0 +1,2 @@
+-- Drop the consent records table
+DROP TABLE IF EXISTS consent_records;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS consent_records (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id     UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    list_id        UUID REFERENCES lists(id) ON DELETE SET NULL,
+    action         TEXT NOT NULL,
+    ip             TEXT NOT NULL DEFAULT '',
+    user_agent     TEXT NOT NULL DEFAULT '',
+    source         TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS consent_records_contact_idx ON consent_records (contact_id, created_at);
@@ -0,0 +1,3 @@
+-- Drop the tag tables
+DROP TABLE IF EXISTS contact_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id             UUID PRIMARY KEY,
+    workspace_id   UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name           TEXT NOT NULL,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS contact_tags (
+    contact_id     UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    tag_id         UUID NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (contact_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS contact_tags_tag_idx ON contact_tags (tag_id);
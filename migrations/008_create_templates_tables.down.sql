@@ -0,0 +1,3 @@
+-- Drop the template tables
+DROP TABLE IF EXISTS template_versions;
+DROP TABLE IF EXISTS templates;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS templates (
+    id               UUID PRIMARY KEY,
+    workspace_id     UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name             TEXT NOT NULL,
+    current_version  INTEGER NOT NULL,
+    created_at       TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at       TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS template_versions (
+    template_id    UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+    version        INTEGER NOT NULL,
+    subject        TEXT NOT NULL,
+    preheader      TEXT NOT NULL DEFAULT '',
+    html_body      TEXT NOT NULL DEFAULT '',
+    text_body      TEXT NOT NULL DEFAULT '',
+    author_id      UUID NOT NULL REFERENCES users(id),
+    note           TEXT NOT NULL DEFAULT '',
+    created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (template_id, version)
+);
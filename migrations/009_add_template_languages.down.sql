@@ -0,0 +1,4 @@
+-- Drop the template language columns
+ALTER TABLE template_versions
+    DROP COLUMN IF EXISTS variants,
+    DROP COLUMN IF EXISTS lang;
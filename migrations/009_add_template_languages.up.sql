@@ -0,0 +1,3 @@
+ALTER TABLE template_versions
+    ADD COLUMN IF NOT EXISTS lang     INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS variants JSONB NOT NULL DEFAULT '{}';
@@ -0,0 +1,2 @@
+-- Drop the test recipients table
+DROP TABLE IF EXISTS test_recipients;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS test_recipients (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email         TEXT NOT NULL,
+    verified_at   TIMESTAMPTZ,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, email)
+);
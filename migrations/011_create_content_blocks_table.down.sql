@@ -0,0 +1,6 @@
+-- Drop the content blocks table and template block references
+DROP INDEX IF EXISTS idx_template_versions_refs;
+ALTER TABLE template_versions
+    DROP COLUMN IF EXISTS block_refs,
+    DROP COLUMN IF EXISTS layout;
+DROP TABLE IF EXISTS content_blocks;
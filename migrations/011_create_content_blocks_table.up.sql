@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS content_blocks (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name          TEXT NOT NULL,
+    kind          TEXT NOT NULL,
+    lang          INTEGER NOT NULL DEFAULT 0,
+    html_body     TEXT NOT NULL DEFAULT '',
+    text_body     TEXT NOT NULL DEFAULT '',
+    variants      JSONB NOT NULL DEFAULT '{}',
+    -- Names of the blocks this block includes.
+    block_refs    TEXT[] NOT NULL DEFAULT '{}',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, name)
+);
+
+-- Names of the layout and blocks a template version uses.
+ALTER TABLE template_versions
+    ADD COLUMN IF NOT EXISTS layout     TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS block_refs TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE INDEX IF NOT EXISTS idx_content_blocks_refs ON content_blocks USING GIN (block_refs);
+CREATE INDEX IF NOT EXISTS idx_template_versions_refs ON template_versions USING GIN (block_refs);
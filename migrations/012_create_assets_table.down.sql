@@ -0,0 +1,2 @@
+-- Drop the assets table
+DROP TABLE IF EXISTS assets;
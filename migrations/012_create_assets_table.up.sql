@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS assets (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    filename      TEXT NOT NULL,
+    content_type  TEXT NOT NULL,
+    size          BIGINT NOT NULL,
+    width         INTEGER NOT NULL,
+    height        INTEGER NOT NULL,
+    sha256        TEXT NOT NULL,
+    storage_key   TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Uploading the same content twice returns the existing asset.
+    UNIQUE (workspace_id, sha256)
+);
+
+CREATE INDEX IF NOT EXISTS idx_assets_workspace_created ON assets (workspace_id, created_at DESC);
@@ -0,0 +1,2 @@
+-- Drop the campaigns table
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS campaigns (
+    id                UUID PRIMARY KEY,
+    workspace_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name              TEXT NOT NULL,
+    template_id       UUID NOT NULL,
+    template_version  INTEGER NOT NULL,
+    audience          JSONB NOT NULL,
+    from_name         TEXT NOT NULL DEFAULT '',
+    from_email        TEXT NOT NULL,
+    reply_to          TEXT NOT NULL DEFAULT '',
+    status            TEXT NOT NULL DEFAULT 'draft',
+    scheduled_at      TIMESTAMPTZ,
+    started_at        TIMESTAMPTZ,
+    finished_at       TIMESTAMPTZ,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    -- Versions are immutable, so the pinned content cannot change.
+    FOREIGN KEY (template_id, template_version) REFERENCES template_versions (template_id, version)
+);
+
+CREATE INDEX IF NOT EXISTS idx_campaigns_workspace_created ON campaigns (workspace_id, created_at DESC);
+-- The scheduler looks for due campaigns.
+CREATE INDEX IF NOT EXISTS idx_campaigns_due ON campaigns (scheduled_at) WHERE status = 'scheduled';
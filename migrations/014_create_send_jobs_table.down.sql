@@ -0,0 +1,7 @@
+-- Drop the send jobs table and campaign leases
+DROP TABLE IF EXISTS send_jobs;
+DROP INDEX IF EXISTS idx_campaigns_expanding;
+ALTER TABLE campaigns
+    DROP COLUMN IF EXISTS expanded_at,
+    DROP COLUMN IF EXISTS lease_expires_at,
+    DROP COLUMN IF EXISTS lease_owner;
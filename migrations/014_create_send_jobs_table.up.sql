@@ -0,0 +1,24 @@
+-- A scheduler replica holds the lease of a campaign while expanding its
+-- audience; another replica takes over once the lease expires.
+ALTER TABLE campaigns
+    ADD COLUMN IF NOT EXISTS lease_owner      TEXT,
+    ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS expanded_at      TIMESTAMPTZ;
+
+-- One job per campaign recipient. The unique key makes re-expanding an
+-- audience after a crash idempotent.
+CREATE TABLE IF NOT EXISTS send_jobs (
+    id            BIGSERIAL PRIMARY KEY,
+    campaign_id   UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    contact_id    UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    email         TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT 'pending',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (campaign_id, contact_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_send_jobs_pending ON send_jobs (campaign_id) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_campaigns_expanding ON campaigns (lease_expires_at)
+    WHERE status = 'sending' AND expanded_at IS NULL;
@@ -0,0 +1,10 @@
+-- Remove send job leasing and retries
+DROP INDEX IF EXISTS idx_send_jobs_campaign_status;
+DROP INDEX IF EXISTS idx_send_jobs_unrelayed;
+DROP INDEX IF EXISTS idx_send_jobs_available;
+ALTER TABLE send_jobs
+    DROP COLUMN IF EXISTS relayed_at,
+    DROP COLUMN IF EXISTS last_error,
+    DROP COLUMN IF EXISTS available_at,
+    DROP COLUMN IF EXISTS attempts;
+CREATE INDEX IF NOT EXISTS idx_send_jobs_pending ON send_jobs (campaign_id) WHERE status = 'pending';
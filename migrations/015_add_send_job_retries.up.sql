@@ -0,0 +1,13 @@
+-- Send jobs are leased by workers: a leased job is hidden until
+-- available_at, and attempts fences out workers whose lease expired.
+ALTER TABLE send_jobs
+    ADD COLUMN IF NOT EXISTS attempts     INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS available_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS last_error   TEXT NOT NULL DEFAULT '',
+    -- relayed_at is set once a pending job was handed to the Redis queue.
+    ADD COLUMN IF NOT EXISTS relayed_at   TIMESTAMPTZ;
+
+DROP INDEX IF EXISTS idx_send_jobs_pending;
+CREATE INDEX IF NOT EXISTS idx_send_jobs_available ON send_jobs (available_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS idx_send_jobs_unrelayed ON send_jobs (available_at) WHERE status = 'pending' AND relayed_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_send_jobs_campaign_status ON send_jobs (campaign_id, status);
@@ -0,0 +1,2 @@
+-- Drop the sending_domains table
+DROP TABLE IF EXISTS sending_domains;
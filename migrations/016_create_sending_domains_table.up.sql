@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS sending_domains (
+    id                UUID PRIMARY KEY,
+    workspace_id      UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    domain            TEXT NOT NULL,
+    dkim_selector     TEXT NOT NULL,
+    dkim_algorithm    TEXT NOT NULL,
+    -- PKCS #8 private key, encrypted with the dkim.encryption_key.
+    dkim_private_key  BYTEA NOT NULL,
+    -- The TXT record publishing the public key.
+    dkim_record       TEXT NOT NULL,
+    created_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    updated_at        TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (workspace_id, domain)
+);
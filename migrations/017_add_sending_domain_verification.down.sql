@@ -0,0 +1,8 @@
+-- Remove sending domain verification
+DROP INDEX IF EXISTS idx_sending_domains_checked;
+ALTER TABLE sending_domains
+    DROP COLUMN IF EXISTS status,
+    DROP COLUMN IF EXISTS verification_token,
+    DROP COLUMN IF EXISTS checks,
+    DROP COLUMN IF EXISTS checked_at,
+    DROP COLUMN IF EXISTS verified_at;
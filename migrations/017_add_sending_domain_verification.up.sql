@@ -0,0 +1,15 @@
+-- Sending domains are verified by checking their DNS records: an ownership
+-- token, SPF, the DKIM key and a DMARC policy.
+ALTER TABLE sending_domains
+    ADD COLUMN IF NOT EXISTS status              TEXT NOT NULL DEFAULT 'pending',
+    ADD COLUMN IF NOT EXISTS verification_token  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS checks              JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS checked_at          TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS verified_at         TIMESTAMPTZ;
+
+UPDATE sending_domains
+SET verification_token = md5(random()::text || id::text)
+WHERE verification_token = '';
+
+-- The scheduler rechecks the domains checked longest ago.
+CREATE INDEX IF NOT EXISTS idx_sending_domains_checked ON sending_domains (checked_at NULLS FIRST);
@@ -0,0 +1,2 @@
+-- Drop the bounces table
+DROP TABLE IF EXISTS bounces;
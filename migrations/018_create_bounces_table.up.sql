@@ -0,0 +1,17 @@
+-- Bounces reported for campaign emails. A job bounces at most once per
+-- kind, so a bounce message received twice is recorded once.
+CREATE TABLE IF NOT EXISTS bounces (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    campaign_id   UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    contact_id    UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    send_job_id   BIGINT NOT NULL REFERENCES send_jobs(id) ON DELETE CASCADE,
+    email         TEXT NOT NULL,
+    kind          TEXT NOT NULL,
+    status        TEXT NOT NULL DEFAULT '',
+    diagnostic    TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (send_job_id, kind)
+);
+
+CREATE INDEX IF NOT EXISTS idx_bounces_email ON bounces (workspace_id, email, created_at);
@@ -0,0 +1,2 @@
+-- Drop the replies table
+DROP TABLE IF EXISTS replies;
@@ -0,0 +1,19 @@
+-- Replies to campaign emails received by the inbound SMTP server. A message
+-- delivered twice is stored once.
+CREATE TABLE IF NOT EXISTS replies (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    campaign_id   UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    contact_id    UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    send_job_id   BIGINT NOT NULL REFERENCES send_jobs(id) ON DELETE CASCADE,
+    from_email    TEXT NOT NULL,
+    from_name     TEXT NOT NULL DEFAULT '',
+    subject       TEXT NOT NULL DEFAULT '',
+    text          TEXT NOT NULL DEFAULT '',
+    auto_reply    BOOLEAN NOT NULL DEFAULT FALSE,
+    message_id    TEXT NOT NULL DEFAULT '',
+    received_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (send_job_id, message_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_replies_workspace ON replies (workspace_id, received_at DESC);
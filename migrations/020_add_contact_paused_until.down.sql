@@ -0,0 +1,3 @@
+-- Drop the pause of contacts
+ALTER TABLE contacts
+    DROP COLUMN IF EXISTS paused_until;
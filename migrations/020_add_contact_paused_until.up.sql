@@ -0,0 +1,3 @@
+-- Contacts can pause campaign emails from the preference center.
+ALTER TABLE contacts
+    ADD COLUMN IF NOT EXISTS paused_until TIMESTAMPTZ;
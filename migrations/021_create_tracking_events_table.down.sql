@@ -0,0 +1,2 @@
+-- Drop the tracking events table
+DROP TABLE IF EXISTS tracking_events;
@@ -0,0 +1,18 @@
+-- Opens and clicks of campaign emails. Every request is kept, with the
+-- class of client that made it, so machine opens and clicks can be told
+-- from the recipient's.
+CREATE TABLE IF NOT EXISTS tracking_events (
+    id            UUID PRIMARY KEY,
+    workspace_id  UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    campaign_id   UUID NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+    contact_id    UUID NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+    send_job_id   BIGINT NOT NULL REFERENCES send_jobs(id) ON DELETE CASCADE,
+    kind          TEXT NOT NULL,
+    url           TEXT NOT NULL DEFAULT '',
+    agent         TEXT NOT NULL,
+    ip            TEXT NOT NULL DEFAULT '',
+    user_agent    TEXT NOT NULL DEFAULT '',
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_tracking_events_campaign ON tracking_events (campaign_id, kind, created_at);
@@ -0,0 +1,3 @@
+-- Drop the heartbeat of export jobs
+ALTER TABLE export_jobs
+    DROP COLUMN IF EXISTS heartbeat_at;
@@ -0,0 +1,4 @@
+-- Running exports renew heartbeat_at, so jobs whose server exited can be
+-- told apart and failed.
+ALTER TABLE export_jobs
+    ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
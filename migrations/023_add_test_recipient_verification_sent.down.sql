@@ -0,0 +1,5 @@
+-- Drop the verification throttle of test recipients
+DROP INDEX IF EXISTS idx_test_recipients_email;
+
+ALTER TABLE test_recipients
+    DROP COLUMN IF EXISTS verification_sent_at;
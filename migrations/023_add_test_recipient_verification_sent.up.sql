@@ -0,0 +1,5 @@
+-- verification_sent_at throttles verification emails to an address.
+ALTER TABLE test_recipients
+    ADD COLUMN IF NOT EXISTS verification_sent_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_test_recipients_email ON test_recipients (email);